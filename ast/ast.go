@@ -4,6 +4,13 @@ import "github.com/basis-ex/token"
 
 type Node interface {
 	TokenLiteral() string
+	// String prints the node as BASIC source.
+	String() string
+	// Pos is the position of the node's first character and End that of
+	// the character just after its last. Parentheses around an expression
+	// are part of it.
+	Pos() token.Position
+	End() token.Position
 }
 
 type Statement interface {
@@ -18,6 +25,27 @@ type Expression interface {
 
 type Program struct {
 	Statements map[int]Statement
+	// Source holds the text of each numbered line as it was written, for
+	// listings, error messages and the compiler's comments to show rather
+	// than text rebuilt from the tree. A program built other than by the
+	// parser may leave it empty.
+	Source map[int]string
+	// Indents holds how far each indented line was indented, in bytes:
+	// Source leaves that out, but the columns of positions count it.
+	Indents map[int]int
+	// Labels maps each named label to the line it marks.
+	Labels map[string]int
+	// Procedures maps each SUB name to its definition.
+	Procedures map[string]*Procedure
+}
+
+// Procedure is a SUB ... END SUB block: the SUB header is on Line and the
+// matching END SUB on EndLine.
+type Procedure struct {
+	Name    string
+	Params  []*Identifier
+	Line    int
+	EndLine int
 }
 
 func (p *Program) TokenLiteral() string {
@@ -32,6 +60,7 @@ func (p *Program) TokenLiteral() string {
 type LineStatement struct {
 	Token      token.Token
 	LineNumber int
+	Label      string
 	Statement  Statement
 }
 
@@ -46,19 +75,36 @@ type SequenceStatement struct {
 func (ss *SequenceStatement) statementNode()       {}
 func (ss *SequenceStatement) TokenLiteral() string { return "" }
 
+// LabelStatement marks a line with a name (MainLoop:) that GOTO and GOSUB
+// can use in place of its number.
+type LabelStatement struct {
+	Token token.Token
+	Name  string
+	Colon token.Position
+}
+
+func (ls *LabelStatement) statementNode()       {}
+func (ls *LabelStatement) TokenLiteral() string { return ls.Token.Literal }
+
 type PrintStatement struct {
 	Token           token.Token
 	Expressions     []Expression
 	Separators      []string
 	TrailingNewline bool
+	// TrailingSeparator is where the ; or , that ends the statement is,
+	// when TrailingNewline is false.
+	TrailingSeparator token.Position
 }
 
 func (ps *PrintStatement) statementNode()       {}
 func (ps *PrintStatement) TokenLiteral() string { return ps.Token.Literal }
 
+// LetStatement assigns Value to the variable Name, or with Index set, to
+// the element Name(Index) of an array.
 type LetStatement struct {
 	Token token.Token
 	Name  *Identifier
+	Index Expression
 	Value Expression
 }
 
@@ -98,14 +144,14 @@ type ReturnStatement struct {
 func (rs *ReturnStatement) statementNode()       {}
 func (rs *ReturnStatement) TokenLiteral() string { return rs.Token.Literal }
 
+// ForStatement is FOR Variable = Start TO Limit [STEP Step]. Without a
+// STEP, Step is a literal 1 that has no position in the source.
 type ForStatement struct {
-	Token     token.Token
-	Variable  *Identifier
-	Start     Expression
-	End       Expression
-	Step      Expression
-	Body      []Statement
-	LineStart int
+	Token    token.Token
+	Variable *Identifier
+	Start    Expression
+	Limit    Expression
+	Step     Expression
 }
 
 func (fs *ForStatement) statementNode()       {}
@@ -119,39 +165,377 @@ type NextStatement struct {
 func (ns *NextStatement) statementNode()       {}
 func (ns *NextStatement) TokenLiteral() string { return ns.Token.Literal }
 
+// InputStatement is INPUT ["prompt" (; | ,)] vars. QuestionMark is set for a
+// bare INPUT or a prompt followed by a semicolon, which print "? " after the
+// prompt; a prompt followed by a comma is printed as it stands.
 type InputStatement struct {
-	Token     token.Token
-	Prompt    string
-	Variables []*Identifier
+	Token        token.Token
+	Prompt       string
+	QuestionMark bool
+	Variables    []*Identifier
+}
+
+// PromptText is what INPUT prints before reading a line.
+func (is *InputStatement) PromptText() string {
+	if is.QuestionMark {
+		return is.Prompt + "? "
+	}
+	return is.Prompt
 }
 
 func (is *InputStatement) statementNode()       {}
 func (is *InputStatement) TokenLiteral() string { return is.Token.Literal }
 
+// EndStatement is END or SYSTEM. Status, when given, is the exit status
+// the program reports to the operating system.
 type EndStatement struct {
-	Token token.Token
+	Token  token.Token
+	Status Expression
 }
 
 func (es *EndStatement) statementNode()       {}
 func (es *EndStatement) TokenLiteral() string { return es.Token.Literal }
 
 type RemStatement struct {
-	Token   token.Token
-	Comment string
+	Token      token.Token
+	Comment    string
+	CommentPos token.Position
 }
 
 func (rs *RemStatement) statementNode()       {}
 func (rs *RemStatement) TokenLiteral() string { return rs.Token.Literal }
 
 type DimStatement struct {
-	Token token.Token
-	Name  *Identifier
-	Size  Expression
+	Token  token.Token
+	Name   *Identifier
+	Size   Expression
+	Rparen token.Position
 }
 
 func (ds *DimStatement) statementNode()       {}
 func (ds *DimStatement) TokenLiteral() string { return ds.Token.Literal }
 
+// DataStatement holds the constants of a DATA line, in order. Each value is
+// a *NumberLiteral or *StringLiteral.
+type DataStatement struct {
+	Token  token.Token
+	Values []Expression
+}
+
+func (ds *DataStatement) statementNode()       {}
+func (ds *DataStatement) TokenLiteral() string { return ds.Token.Literal }
+
+// ReadStatement reads DATA into Variables, each an *Identifier or, for an
+// array element, an *ArrayAccess.
+type ReadStatement struct {
+	Token     token.Token
+	Variables []Expression
+}
+
+func (rs *ReadStatement) statementNode()       {}
+func (rs *ReadStatement) TokenLiteral() string { return rs.Token.Literal }
+
+// RestoreStatement rewinds the DATA pointer, to the start of the program or
+// to the first DATA item at or after LineNumber when one is given.
+type RestoreStatement struct {
+	Token      token.Token
+	LineNumber Expression
+}
+
+func (rs *RestoreStatement) statementNode()       {}
+func (rs *RestoreStatement) TokenLiteral() string { return rs.Token.Literal }
+
+// DumpStatement prints the interpreter's state: variables, arrays, active
+// FOR loops and the GOSUB stack.
+type DumpStatement struct {
+	Token token.Token
+}
+
+func (ds *DumpStatement) statementNode()       {}
+func (ds *DumpStatement) TokenLiteral() string { return ds.Token.Literal }
+
+// SleepStatement pauses the program: SLEEP seconds.
+type SleepStatement struct {
+	Token   token.Token
+	Seconds Expression
+}
+
+func (ss *SleepStatement) statementNode()       {}
+func (ss *SleepStatement) TokenLiteral() string { return ss.Token.Literal }
+
+// ShellStatement runs an operating-system command, or an interactive shell
+// when Command is nil.
+type ShellStatement struct {
+	Token   token.Token
+	Command Expression
+}
+
+func (ss *ShellStatement) statementNode()       {}
+func (ss *ShellStatement) TokenLiteral() string { return ss.Token.Literal }
+
+// PokeStatement stores a byte in the simulated memory: POKE addr, value.
+type PokeStatement struct {
+	Token   token.Token
+	Address Expression
+	Value   Expression
+}
+
+func (ps *PokeStatement) statementNode()       {}
+func (ps *PokeStatement) TokenLiteral() string { return ps.Token.Literal }
+
+// OpenStatement opens a random-access file of fixed-length records:
+// OPEN "f" [FOR RANDOM] AS #n [LEN = size].
+type OpenStatement struct {
+	Token        token.Token
+	File         Expression
+	Number       Expression
+	RecordLength Expression // nil for the default length
+}
+
+func (op *OpenStatement) statementNode()       {}
+func (op *OpenStatement) TokenLiteral() string { return op.Token.Literal }
+
+// CloseStatement closes the listed file numbers, or every open file when
+// Numbers is empty.
+type CloseStatement struct {
+	Token   token.Token
+	Numbers []Expression
+}
+
+func (cs *CloseStatement) statementNode()       {}
+func (cs *CloseStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// FieldStatement divides a file's record buffer into string variables:
+// FIELD #n, width AS name$, ...
+type FieldStatement struct {
+	Token  token.Token
+	Number Expression
+	Fields []*FieldSpec
+}
+
+type FieldSpec struct {
+	Width    Expression
+	Variable *Identifier
+}
+
+func (fs *FieldStatement) statementNode()       {}
+func (fs *FieldStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// RecordStatement is GET #n [, record] or PUT #n [, record], told apart by
+// Token.Type. Without a record number the record after the last one used is
+// read or written.
+type RecordStatement struct {
+	Token  token.Token
+	Number Expression
+	Record Expression
+}
+
+func (rs *RecordStatement) statementNode()       {}
+func (rs *RecordStatement) TokenLiteral() string { return rs.Token.Literal }
+
+// JustifyStatement is LSET or RSET (by Token.Type), which stores a string in
+// a FIELD variable padded with spaces on the right or the left.
+type JustifyStatement struct {
+	Token token.Token
+	Name  *Identifier
+	Value Expression
+}
+
+func (js *JustifyStatement) statementNode()       {}
+func (js *JustifyStatement) TokenLiteral() string { return js.Token.Literal }
+
+// FilesStatement lists the files matching Pattern, or the whole current
+// directory when Pattern is nil.
+type FilesStatement struct {
+	Token   token.Token
+	Pattern Expression
+}
+
+func (fs *FilesStatement) statementNode()       {}
+func (fs *FilesStatement) TokenLiteral() string { return fs.Token.Literal }
+
+// KillStatement deletes the files matching File.
+type KillStatement struct {
+	Token token.Token
+	File  Expression
+}
+
+func (ks *KillStatement) statementNode()       {}
+func (ks *KillStatement) TokenLiteral() string { return ks.Token.Literal }
+
+// NameStatement renames a file: NAME "old" AS "new".
+type NameStatement struct {
+	Token token.Token
+	From  Expression
+	To    Expression
+}
+
+func (ns *NameStatement) statementNode()       {}
+func (ns *NameStatement) TokenLiteral() string { return ns.Token.Literal }
+
+// ChdirStatement changes the working directory.
+type ChdirStatement struct {
+	Token     token.Token
+	Directory Expression
+}
+
+func (cs *ChdirStatement) statementNode()       {}
+func (cs *ChdirStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// SubStatement opens a procedure: SUB Name(A, B$). Reaching it in normal
+// flow skips the body.
+type SubStatement struct {
+	Token  token.Token
+	Name   *Identifier
+	Params []*Identifier
+	Rparen token.Position // zero when there are no parentheses
+}
+
+func (ss *SubStatement) statementNode()       {}
+func (ss *SubStatement) TokenLiteral() string { return ss.Token.Literal }
+
+// EndSubStatement closes a procedure and returns to its caller.
+type EndSubStatement struct {
+	Token token.Token
+	Sub   token.Position
+}
+
+func (es *EndSubStatement) statementNode()       {}
+func (es *EndSubStatement) TokenLiteral() string { return es.Token.Literal }
+
+// CallStatement invokes a procedure: CALL Name(X, Y).
+type CallStatement struct {
+	Token     token.Token
+	Name      *Identifier
+	Arguments []Expression
+	Rparen    token.Position // zero when there are no parentheses
+}
+
+func (cs *CallStatement) statementNode()       {}
+func (cs *CallStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// HostCallStatement sends an event to the embedding program:
+// CALL HOST "event", arg, ...
+type HostCallStatement struct {
+	Token     token.Token
+	Event     Expression
+	Arguments []Expression
+}
+
+func (hs *HostCallStatement) statementNode()       {}
+func (hs *HostCallStatement) TokenLiteral() string { return hs.Token.Literal }
+
+// OnTimerStatement arms the timer trap: ON TIMER(seconds) GOSUB target.
+type OnTimerStatement struct {
+	Token    token.Token
+	Interval Expression
+	Target   Expression
+}
+
+func (ot *OnTimerStatement) statementNode()       {}
+func (ot *OnTimerStatement) TokenLiteral() string { return ot.Token.Literal }
+
+// TimerStatement is TIMER ON, TIMER OFF or TIMER STOP; Mode holds the
+// upper-cased word.
+type TimerStatement struct {
+	Token   token.Token
+	Mode    string
+	ModePos token.Position
+}
+
+func (ts *TimerStatement) statementNode()       {}
+func (ts *TimerStatement) TokenLiteral() string { return ts.Token.Literal }
+
+// ClsStatement clears the screen.
+type ClsStatement struct {
+	Token token.Token
+}
+
+func (cs *ClsStatement) statementNode()       {}
+func (cs *ClsStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// LocateStatement moves the cursor to Row, Column (both 1-based). Either may
+// be nil to keep the current value, as in LOCATE ,10.
+type LocateStatement struct {
+	Token  token.Token
+	Row    Expression
+	Column Expression
+}
+
+func (ls *LocateStatement) statementNode()       {}
+func (ls *LocateStatement) TokenLiteral() string { return ls.Token.Literal }
+
+// ColorStatement sets the text colours using the 16-colour GW-BASIC palette.
+// Either colour may be nil to leave it unchanged.
+type ColorStatement struct {
+	Token      token.Token
+	Foreground Expression
+	Background Expression
+}
+
+func (cs *ColorStatement) statementNode()       {}
+func (cs *ColorStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// ScreenStatement starts a graphics screen, clearing it: SCREEN 1 is 320 by
+// 200 pixels and SCREEN 2 is 640 by 200, as in GW-BASIC, and SCREEN 0 puts
+// the graphics screen away. With Height, as in SCREEN 800, 600, Mode is the
+// width of a screen of any size.
+type ScreenStatement struct {
+	Token  token.Token
+	Mode   Expression
+	Height Expression
+}
+
+func (ss *ScreenStatement) statementNode()       {}
+func (ss *ScreenStatement) TokenLiteral() string { return ss.Token.Literal }
+
+// PlotStatement sets the pixel at X, Y: PLOT x, y[, color]. Color is nil
+// for white.
+type PlotStatement struct {
+	Token token.Token
+	X     Expression
+	Y     Expression
+	Color Expression
+}
+
+func (ps *PlotStatement) statementNode()       {}
+func (ps *PlotStatement) TokenLiteral() string { return ps.Token.Literal }
+
+// DrawLineStatement draws a line, written as in GW-BASIC:
+// LINE (x1, y1)-(x2, y2)[, color]. Color is nil for white.
+type DrawLineStatement struct {
+	Token  token.Token
+	X1, Y1 Expression
+	X2, Y2 Expression
+	Rparen token.Position // of (x2, y2)
+	Color  Expression
+}
+
+func (dl *DrawLineStatement) statementNode()       {}
+func (dl *DrawLineStatement) TokenLiteral() string { return dl.Token.Literal }
+
+// CircleStatement draws a circle around X, Y: CIRCLE (x, y), radius[, color].
+// Color is nil for white.
+type CircleStatement struct {
+	Token  token.Token
+	X, Y   Expression
+	Radius Expression
+	Color  Expression
+}
+
+func (cs *CircleStatement) statementNode()       {}
+func (cs *CircleStatement) TokenLiteral() string { return cs.Token.Literal }
+
+// ScreenSaveStatement saves the graphics screen as a picture, a PNG or an
+// SVG as the file's name ends: SCREENSAVE "out.png".
+type ScreenSaveStatement struct {
+	Token token.Token
+	File  Expression
+}
+
+func (ss *ScreenSaveStatement) statementNode()       {}
+func (ss *ScreenSaveStatement) TokenLiteral() string { return ss.Token.Literal }
+
 type ExpressionStatement struct {
 	Token      token.Token
 	Expression Expression
@@ -160,8 +544,46 @@ type ExpressionStatement struct {
 func (es *ExpressionStatement) statementNode()       {}
 func (es *ExpressionStatement) TokenLiteral() string { return es.Token.Literal }
 
+// Parens records the outermost parentheses written around an expression,
+// which the tree otherwise leaves out: they are zero when there are none.
+type Parens struct {
+	Lparen token.Position
+	Rparen token.Position
+}
+
+// SetParens records that expr was written inside the parentheses at lparen
+// and rparen. The parser calls it; only the outermost pair is kept.
+func SetParens(expr Expression, lparen, rparen token.Position) {
+	if p := parens(expr); p != nil {
+		p.Lparen, p.Rparen = lparen, rparen
+	}
+}
+
+func parens(expr Expression) *Parens {
+	switch e := expr.(type) {
+	case *Identifier:
+		return &e.Parens
+	case *NumberLiteral:
+		return &e.Parens
+	case *BooleanLiteral:
+		return &e.Parens
+	case *StringLiteral:
+		return &e.Parens
+	case *InfixExpression:
+		return &e.Parens
+	case *PrefixExpression:
+		return &e.Parens
+	case *ArrayAccess:
+		return &e.Parens
+	case *CallExpression:
+		return &e.Parens
+	}
+	return nil
+}
+
 type Identifier struct {
 	Token token.Token
+	Parens
 	Value string
 }
 
@@ -170,14 +592,27 @@ func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
 type NumberLiteral struct {
 	Token token.Token
+	Parens
 	Value float64
 }
 
 func (nl *NumberLiteral) expressionNode()      {}
 func (nl *NumberLiteral) TokenLiteral() string { return nl.Token.Literal }
 
+// BooleanLiteral is TRUE or FALSE. It evaluates to the dialect's true value
+// (1 or -1) or to 0.
+type BooleanLiteral struct {
+	Token token.Token
+	Parens
+	Value bool
+}
+
+func (bl *BooleanLiteral) expressionNode()      {}
+func (bl *BooleanLiteral) TokenLiteral() string { return bl.Token.Literal }
+
 type StringLiteral struct {
 	Token token.Token
+	Parens
 	Value string
 }
 
@@ -185,7 +620,8 @@ func (sl *StringLiteral) expressionNode()      {}
 func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
 
 type InfixExpression struct {
-	Token    token.Token
+	Token token.Token
+	Parens
 	Left     Expression
 	Operator string
 	Right    Expression
@@ -195,7 +631,8 @@ func (ie *InfixExpression) expressionNode()      {}
 func (ie *InfixExpression) TokenLiteral() string { return ie.Token.Literal }
 
 type PrefixExpression struct {
-	Token    token.Token
+	Token token.Token
+	Parens
 	Operator string
 	Right    Expression
 }
@@ -205,9 +642,194 @@ func (pe *PrefixExpression) TokenLiteral() string { return pe.Token.Literal }
 
 type ArrayAccess struct {
 	Token token.Token
-	Name  *Identifier
-	Index Expression
+	Parens
+	Name   *Identifier
+	Index  Expression
+	Rparen token.Position
 }
 
 func (aa *ArrayAccess) expressionNode()      {}
 func (aa *ArrayAccess) TokenLiteral() string { return aa.Token.Literal }
+
+// CallExpression is a call to a built-in function such as UCASE$(A$).
+// Function holds the upper-cased name.
+type CallExpression struct {
+	Token token.Token
+	Parens
+	Function  string
+	Arguments []Expression
+	Rparen    token.Position // zero when there are no parentheses
+}
+
+func (ce *CallExpression) expressionNode()      {}
+func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+
+// Flatten returns the statements making up a line, expanding ':' sequences.
+func Flatten(stmt Statement) []Statement {
+	if seq, ok := stmt.(*SequenceStatement); ok {
+		return seq.Statements
+	}
+	return []Statement{stmt}
+}
+
+// DataValues returns every DATA constant in the program in line order.
+func DataValues(program *Program, lines []int) []Expression {
+	values := []Expression{}
+	for _, line := range lines {
+		for _, stmt := range Flatten(program.Statements[line]) {
+			if data, ok := stmt.(*DataStatement); ok {
+				values = append(values, data.Values...)
+			}
+		}
+	}
+	return values
+}
+
+// DataOffsets maps every program line to the index of the first DATA
+// constant at or after it, which is where RESTORE <line> repositions READ.
+func DataOffsets(program *Program, lines []int) map[int]int {
+	offsets := make(map[int]int, len(lines))
+	count := 0
+	for _, line := range lines {
+		offsets[line] = count
+		for _, stmt := range Flatten(program.Statements[line]) {
+			if data, ok := stmt.(*DataStatement); ok {
+				count += len(data.Values)
+			}
+		}
+	}
+	return offsets
+}
+
+// Layout is a line laid out for running: its statements in the order they
+// are written, with those after THEN and ELSE following the IF they belong
+// to, so that each has an index a RETURN, NEXT or skipped FOR can carry on
+// at. ':' sequences are not statements of their own.
+type Layout struct {
+	Statements []Statement
+	// Next holds, for each statement, the index of the one that runs after
+	// it when it does not jump; after the last statement following THEN
+	// that is past the ELSE branch. For an IF, Next is where the statements
+	// after THEN start, and Else where those after ELSE start, or where the
+	// IF ends when it has no ELSE. An index of len(Statements) ends the line.
+	Next, Else []int
+	// End holds, for each statement, the index after the last statement
+	// laid out inside it, which is only past the next for an IF.
+	End []int
+}
+
+// exit is a statement of a layout whose Next, or with onElse set its Else,
+// is the statement laid out next.
+type exit struct {
+	at     int
+	onElse bool
+}
+
+// LayOut lays out the statements making up a line.
+func LayOut(stmt Statement) Layout {
+	var l Layout
+	l.link(l.add(stmt, nil), len(l.Statements))
+	return l
+}
+
+// add appends stmt and the statements inside it to l, after those the
+// exits in pending leave to, and returns the exits of what it added.
+func (l *Layout) add(stmt Statement, pending []exit) []exit {
+	switch s := stmt.(type) {
+	case nil:
+		return pending
+	case *SequenceStatement:
+		for _, inner := range s.Statements {
+			pending = l.add(inner, pending)
+		}
+		return pending
+	}
+
+	i := len(l.Statements)
+	l.link(pending, i)
+	l.Statements = append(l.Statements, stmt)
+	l.Next = append(l.Next, i+1)
+	l.Else = append(l.Else, i+1)
+	l.End = append(l.End, i+1)
+	exits := []exit{{at: i}}
+	if s, ok := stmt.(*IfStatement); ok {
+		exits = l.add(s.Consequence, exits)
+		exits = append(exits, l.add(s.Alternative, []exit{{at: i, onElse: true}})...)
+	}
+	l.End[i] = len(l.Statements)
+	return exits
+}
+
+// link points each of exits at the statement at index to.
+func (l *Layout) link(exits []exit, to int) {
+	for _, e := range exits {
+		if e.onElse {
+			l.Else[e.at] = to
+		} else {
+			l.Next[e.at] = to
+		}
+	}
+}
+
+// LoopEnd is where the NEXT that closes a FOR is: Line is the index into
+// the program's lines of the line holding it, and Stmt its index in that
+// line's Layout. A loop that runs no times carries on with the statement
+// that runs after the NEXT, the NEXT's Next.
+type LoopEnd struct {
+	Line, Stmt int
+}
+
+// PairLoops matches every FOR on a numbered line, including those after
+// THEN or ELSE, with the NEXT that closes it in a single pass over the
+// program, so callers do not rescan the listing once per loop. A named
+// NEXT closes the innermost open FOR on that variable (and any loops left
+// open inside it); a bare NEXT closes the innermost loop. A NEXT after THEN
+// or ELSE only closes a FOR opened in that branch, as the branch may not
+// run; a FOR opened there and not closed stays open after the IF. FORs with
+// no NEXT are absent from the result.
+func PairLoops(program *Program, lines []int) map[*ForStatement]LoopEnd {
+	pairs := make(map[*ForStatement]LoopEnd)
+	open := []*ForStatement{}
+	for i, line := range lines {
+		// n counts the statements of the line in the order LayOut gives
+		// them.
+		n := 0
+		var pair func(stmt Statement, floor int)
+		pair = func(stmt Statement, floor int) {
+			switch s := stmt.(type) {
+			case nil:
+				return
+			case *SequenceStatement:
+				for _, inner := range s.Statements {
+					pair(inner, floor)
+				}
+				return
+			case *ForStatement:
+				open = append(open, s)
+			case *NextStatement:
+				match := len(open) - 1
+				if s.Variable != nil {
+					for match >= floor && open[match].Variable.Value != s.Variable.Value {
+						match--
+					}
+				}
+				if match >= floor {
+					pairs[open[match]] = LoopEnd{Line: i, Stmt: n}
+					open = open[:match]
+				}
+			case *IfStatement:
+				n++
+				before := len(open)
+				pair(s.Consequence, before)
+				then := append([]*ForStatement(nil), open[before:]...)
+				open = open[:before]
+				pair(s.Alternative, before)
+				open = append(open, then...)
+				return
+			}
+			n++
+		}
+		pair(program.Statements[line], 0)
+	}
+	return pairs
+}
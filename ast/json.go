@@ -0,0 +1,143 @@
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/token"
+)
+
+// JSON returns the tree rooted at node as indented JSON, for tools and
+// tests that want to see what the parser built. Each node is an object
+// whose "node" member names its type and whose "pos" and "end" members give
+// its span as "line:column", followed by one member per field, named as in
+// Go with a lower-case first letter:
+//
+//	{
+//	  "node": "LetStatement",
+//	  "pos": "1:4",
+//	  "end": "1:13",
+//	  "name": {"node": "Identifier", ..., "value": "A"},
+//	  "value": {"node": "NumberLiteral", ..., "value": 1}
+//	}
+//
+// A Program lists its lines in order, each with its number, the source as
+// written and the statement. Tokens and the positions of punctuation such
+// as parentheses are left out.
+func JSON(node Node) ([]byte, error) {
+	return json.MarshalIndent(dump(reflect.ValueOf(node)), "", "  ")
+}
+
+// object is a JSON object that keeps its members in the order they were
+// added.
+type object []member
+
+type member struct {
+	name  string
+	value interface{}
+}
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, m := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(m.name)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+var positionType = reflect.TypeOf(token.Position{})
+
+// dump converts v, a node or a value held in one, into what JSON encodes.
+func dump(v reflect.Value) interface{} {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if program, ok := v.Interface().(*Program); ok {
+			return dumpProgram(program)
+		}
+		if v.Kind() == reflect.Interface {
+			return dump(v.Elem())
+		}
+		return dumpStruct(v)
+	case reflect.Slice:
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = dump(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+// dumpStruct converts a pointer to a node, or to a part of one such as a
+// FieldSpec.
+func dumpStruct(v reflect.Value) object {
+	var o object
+	if node, ok := v.Interface().(Node); ok {
+		o = append(o,
+			member{"node", v.Elem().Type().Name()},
+			member{"pos", position(node.Pos())},
+			member{"end", position(node.End())})
+	}
+	s := v.Elem()
+	for i := 0; i < s.NumField(); i++ {
+		field := s.Type().Field(i)
+		if field.Name == "Token" || field.Anonymous || field.Type == positionType {
+			continue
+		}
+		name := strings.ToLower(field.Name[:1]) + field.Name[1:]
+		o = append(o, member{name, dump(s.Field(i))})
+	}
+	return o
+}
+
+func dumpProgram(program *Program) object {
+	numbers := make([]int, 0, len(program.Statements))
+	for line := range program.Statements {
+		numbers = append(numbers, line)
+	}
+	sort.Ints(numbers)
+	lines := make([]object, len(numbers))
+	for i, line := range numbers {
+		lines[i] = object{
+			{"line", line},
+			{"source", program.Source[line]},
+			{"statement", dump(reflect.ValueOf(program.Statements[line]))},
+		}
+	}
+	return object{
+		{"node", "Program"},
+		{"pos", position(program.Pos())},
+		{"end", position(program.End())},
+		{"lines", lines},
+	}
+}
+
+// position is p as "line:column", or nil for a node with no place in the
+// source.
+func position(p token.Position) interface{} {
+	if !p.IsValid() {
+		return nil
+	}
+	return p.String()
+}
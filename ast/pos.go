@@ -0,0 +1,333 @@
+package ast
+
+import (
+	"sort"
+
+	"github.com/basis-ex/token"
+)
+
+func (p *Program) Pos() token.Position {
+	if first := p.line(true); first != nil {
+		return first.Pos()
+	}
+	return token.Position{}
+}
+
+func (p *Program) End() token.Position {
+	if last := p.line(false); last != nil {
+		return last.End()
+	}
+	return token.Position{}
+}
+
+// line returns the statement on the program's first or last line.
+func (p *Program) line(first bool) Statement {
+	if len(p.Statements) == 0 {
+		return nil
+	}
+	lines := make([]int, 0, len(p.Statements))
+	for line := range p.Statements {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	if first {
+		return p.Statements[lines[0]]
+	}
+	return p.Statements[lines[len(lines)-1]]
+}
+
+// Span gives the columns of Source[line] that node covers, counting bytes
+// from 1: from its first character to just after its last. It returns
+// zeros for a node with no place in the source.
+func (p *Program) Span(line int, node Node) (start, end int) {
+	text, ok := p.Source[line]
+	pos, stop := node.Pos(), node.End()
+	if !ok || !pos.IsValid() || !stop.IsValid() {
+		return 0, 0
+	}
+	indent := p.Indents[line]
+	start, end = pos.Column-indent, stop.Column-indent
+	if stop.Line != pos.Line || end > len(text)+1 {
+		end = len(text) + 1
+	}
+	return start, end
+}
+
+func (ls *LineStatement) Pos() token.Position { return ls.Token.Pos() }
+func (ls *LineStatement) End() token.Position {
+	if ls.Statement == nil {
+		return ls.Token.End
+	}
+	return ls.Statement.End()
+}
+
+func (ss *SequenceStatement) Pos() token.Position {
+	if len(ss.Statements) == 0 {
+		return token.Position{}
+	}
+	return ss.Statements[0].Pos()
+}
+func (ss *SequenceStatement) End() token.Position {
+	if len(ss.Statements) == 0 {
+		return token.Position{}
+	}
+	return ss.Statements[len(ss.Statements)-1].End()
+}
+
+func (ls *LabelStatement) Pos() token.Position { return ls.Token.Pos() }
+func (ls *LabelStatement) End() token.Position { return after(ls.Colon, ls.Token) }
+
+func (ps *PrintStatement) Pos() token.Position { return ps.Token.Pos() }
+func (ps *PrintStatement) End() token.Position {
+	if ps.TrailingSeparator.IsValid() {
+		return after(ps.TrailingSeparator, ps.Token)
+	}
+	return lastEnd(ps.Token, ps.Expressions...)
+}
+
+func (ls *LetStatement) Pos() token.Position { return ls.Token.Pos() }
+func (ls *LetStatement) End() token.Position { return lastEnd(ls.Token, ls.Value) }
+
+func (is *IfStatement) Pos() token.Position { return is.Token.Pos() }
+func (is *IfStatement) End() token.Position {
+	if is.Alternative != nil {
+		return is.Alternative.End()
+	}
+	return is.Consequence.End()
+}
+
+// Pos of a jump written as a bare line number after THEN or ELSE is that
+// of the number.
+func (gs *GotoStatement) Pos() token.Position {
+	if gs.Token.Type == token.THEN || gs.Token.Type == token.ELSE {
+		return gs.LineNumber.Pos()
+	}
+	return gs.Token.Pos()
+}
+func (gs *GotoStatement) End() token.Position { return lastEnd(gs.Token, gs.LineNumber) }
+
+func (gs *GosubStatement) Pos() token.Position { return gs.Token.Pos() }
+func (gs *GosubStatement) End() token.Position { return lastEnd(gs.Token, gs.LineNumber) }
+
+func (rs *ReturnStatement) Pos() token.Position { return rs.Token.Pos() }
+func (rs *ReturnStatement) End() token.Position { return rs.Token.End }
+
+func (fs *ForStatement) Pos() token.Position { return fs.Token.Pos() }
+func (fs *ForStatement) End() token.Position {
+	if fs.Step != nil && fs.Step.Pos().IsValid() {
+		return fs.Step.End()
+	}
+	return lastEnd(fs.Token, fs.Limit)
+}
+
+func (ns *NextStatement) Pos() token.Position { return ns.Token.Pos() }
+func (ns *NextStatement) End() token.Position {
+	if ns.Variable == nil {
+		return ns.Token.End
+	}
+	return ns.Variable.End()
+}
+
+func (is *InputStatement) Pos() token.Position { return is.Token.Pos() }
+func (is *InputStatement) End() token.Position { return lastIdentifierEnd(is.Token, is.Variables) }
+
+func (es *EndStatement) Pos() token.Position { return es.Token.Pos() }
+func (es *EndStatement) End() token.Position { return lastEnd(es.Token, es.Status) }
+
+func (rs *RemStatement) Pos() token.Position { return rs.Token.Pos() }
+func (rs *RemStatement) End() token.Position {
+	if !rs.CommentPos.IsValid() {
+		return rs.Token.End
+	}
+	return token.Position{Line: rs.CommentPos.Line, Column: rs.CommentPos.Column + len(rs.Comment)}
+}
+
+func (ds *DimStatement) Pos() token.Position { return ds.Token.Pos() }
+func (ds *DimStatement) End() token.Position { return after(ds.Rparen, ds.Token) }
+
+func (ds *DataStatement) Pos() token.Position { return ds.Token.Pos() }
+func (ds *DataStatement) End() token.Position { return lastEnd(ds.Token, ds.Values...) }
+
+func (rs *ReadStatement) Pos() token.Position { return rs.Token.Pos() }
+func (rs *ReadStatement) End() token.Position { return lastEnd(rs.Token, rs.Variables...) }
+
+func (rs *RestoreStatement) Pos() token.Position { return rs.Token.Pos() }
+func (rs *RestoreStatement) End() token.Position { return lastEnd(rs.Token, rs.LineNumber) }
+
+func (ds *DumpStatement) Pos() token.Position { return ds.Token.Pos() }
+func (ds *DumpStatement) End() token.Position { return ds.Token.End }
+
+func (ss *SleepStatement) Pos() token.Position { return ss.Token.Pos() }
+func (ss *SleepStatement) End() token.Position { return lastEnd(ss.Token, ss.Seconds) }
+
+func (ss *ShellStatement) Pos() token.Position { return ss.Token.Pos() }
+func (ss *ShellStatement) End() token.Position { return lastEnd(ss.Token, ss.Command) }
+
+func (ps *PokeStatement) Pos() token.Position { return ps.Token.Pos() }
+func (ps *PokeStatement) End() token.Position { return lastEnd(ps.Token, ps.Address, ps.Value) }
+
+func (op *OpenStatement) Pos() token.Position { return op.Token.Pos() }
+func (op *OpenStatement) End() token.Position {
+	return lastEnd(op.Token, op.File, op.Number, op.RecordLength)
+}
+
+func (cs *CloseStatement) Pos() token.Position { return cs.Token.Pos() }
+func (cs *CloseStatement) End() token.Position { return lastEnd(cs.Token, cs.Numbers...) }
+
+func (fs *FieldStatement) Pos() token.Position { return fs.Token.Pos() }
+func (fs *FieldStatement) End() token.Position {
+	if len(fs.Fields) == 0 {
+		return lastEnd(fs.Token, fs.Number)
+	}
+	return fs.Fields[len(fs.Fields)-1].Variable.End()
+}
+
+func (rs *RecordStatement) Pos() token.Position { return rs.Token.Pos() }
+func (rs *RecordStatement) End() token.Position { return lastEnd(rs.Token, rs.Number, rs.Record) }
+
+func (js *JustifyStatement) Pos() token.Position { return js.Token.Pos() }
+func (js *JustifyStatement) End() token.Position { return lastEnd(js.Token, js.Value) }
+
+func (fs *FilesStatement) Pos() token.Position { return fs.Token.Pos() }
+func (fs *FilesStatement) End() token.Position { return lastEnd(fs.Token, fs.Pattern) }
+
+func (ks *KillStatement) Pos() token.Position { return ks.Token.Pos() }
+func (ks *KillStatement) End() token.Position { return lastEnd(ks.Token, ks.File) }
+
+func (ns *NameStatement) Pos() token.Position { return ns.Token.Pos() }
+func (ns *NameStatement) End() token.Position { return lastEnd(ns.Token, ns.From, ns.To) }
+
+func (cs *ChdirStatement) Pos() token.Position { return cs.Token.Pos() }
+func (cs *ChdirStatement) End() token.Position { return lastEnd(cs.Token, cs.Directory) }
+
+func (ss *SubStatement) Pos() token.Position { return ss.Token.Pos() }
+func (ss *SubStatement) End() token.Position { return after(ss.Rparen, ss.Name.Token) }
+
+func (es *EndSubStatement) Pos() token.Position { return es.Token.Pos() }
+func (es *EndSubStatement) End() token.Position {
+	if !es.Sub.IsValid() {
+		return es.Token.End
+	}
+	return token.Position{Line: es.Sub.Line, Column: es.Sub.Column + len("SUB")}
+}
+
+func (cs *CallStatement) Pos() token.Position { return cs.Token.Pos() }
+func (cs *CallStatement) End() token.Position { return after(cs.Rparen, cs.Name.Token) }
+
+func (hs *HostCallStatement) Pos() token.Position { return hs.Token.Pos() }
+func (hs *HostCallStatement) End() token.Position {
+	return lastEnd(hs.Token, append([]Expression{hs.Event}, hs.Arguments...)...)
+}
+
+func (ot *OnTimerStatement) Pos() token.Position { return ot.Token.Pos() }
+func (ot *OnTimerStatement) End() token.Position { return lastEnd(ot.Token, ot.Target) }
+
+func (ts *TimerStatement) Pos() token.Position { return ts.Token.Pos() }
+func (ts *TimerStatement) End() token.Position {
+	if !ts.ModePos.IsValid() {
+		return ts.Token.End
+	}
+	return token.Position{Line: ts.ModePos.Line, Column: ts.ModePos.Column + len(ts.Mode)}
+}
+
+func (cs *ClsStatement) Pos() token.Position { return cs.Token.Pos() }
+func (cs *ClsStatement) End() token.Position { return cs.Token.End }
+
+func (ls *LocateStatement) Pos() token.Position { return ls.Token.Pos() }
+func (ls *LocateStatement) End() token.Position { return lastEnd(ls.Token, ls.Row, ls.Column) }
+
+func (cs *ColorStatement) Pos() token.Position { return cs.Token.Pos() }
+func (cs *ColorStatement) End() token.Position {
+	return lastEnd(cs.Token, cs.Foreground, cs.Background)
+}
+
+func (ss *ScreenStatement) Pos() token.Position { return ss.Token.Pos() }
+func (ss *ScreenStatement) End() token.Position { return lastEnd(ss.Token, ss.Mode, ss.Height) }
+
+func (ps *PlotStatement) Pos() token.Position { return ps.Token.Pos() }
+func (ps *PlotStatement) End() token.Position { return lastEnd(ps.Token, ps.X, ps.Y, ps.Color) }
+
+func (dl *DrawLineStatement) Pos() token.Position { return dl.Token.Pos() }
+func (dl *DrawLineStatement) End() token.Position {
+	if dl.Color != nil {
+		return dl.Color.End()
+	}
+	return after(dl.Rparen, dl.Token)
+}
+
+func (cs *CircleStatement) Pos() token.Position { return cs.Token.Pos() }
+func (cs *CircleStatement) End() token.Position {
+	return lastEnd(cs.Token, cs.X, cs.Y, cs.Radius, cs.Color)
+}
+
+func (ss *ScreenSaveStatement) Pos() token.Position { return ss.Token.Pos() }
+func (ss *ScreenSaveStatement) End() token.Position { return lastEnd(ss.Token, ss.File) }
+
+func (es *ExpressionStatement) Pos() token.Position { return es.Token.Pos() }
+func (es *ExpressionStatement) End() token.Position { return lastEnd(es.Token, es.Expression) }
+
+func (i *Identifier) Pos() token.Position { return i.Parens.pos(i.Token.Pos()) }
+func (i *Identifier) End() token.Position { return i.Parens.end(i.Token.End) }
+
+func (nl *NumberLiteral) Pos() token.Position { return nl.Parens.pos(nl.Token.Pos()) }
+func (nl *NumberLiteral) End() token.Position { return nl.Parens.end(nl.Token.End) }
+
+func (bl *BooleanLiteral) Pos() token.Position { return bl.Parens.pos(bl.Token.Pos()) }
+func (bl *BooleanLiteral) End() token.Position { return bl.Parens.end(bl.Token.End) }
+
+// Pos and End of a quoted string include the quotes.
+func (sl *StringLiteral) Pos() token.Position { return sl.Parens.pos(sl.Token.Pos()) }
+func (sl *StringLiteral) End() token.Position { return sl.Parens.end(sl.Token.End) }
+
+func (ie *InfixExpression) Pos() token.Position { return ie.Parens.pos(ie.Left.Pos()) }
+func (ie *InfixExpression) End() token.Position { return ie.Parens.end(lastEnd(ie.Token, ie.Right)) }
+
+func (pe *PrefixExpression) Pos() token.Position { return pe.Parens.pos(pe.Token.Pos()) }
+func (pe *PrefixExpression) End() token.Position { return pe.Parens.end(lastEnd(pe.Token, pe.Right)) }
+
+func (aa *ArrayAccess) Pos() token.Position { return aa.Parens.pos(aa.Name.Pos()) }
+func (aa *ArrayAccess) End() token.Position { return aa.Parens.end(after(aa.Rparen, aa.Name.Token)) }
+
+func (ce *CallExpression) Pos() token.Position { return ce.Parens.pos(ce.Token.Pos()) }
+func (ce *CallExpression) End() token.Position { return ce.Parens.end(after(ce.Rparen, ce.Token)) }
+
+func (p Parens) pos(inner token.Position) token.Position {
+	if p.Lparen.IsValid() {
+		return p.Lparen
+	}
+	return inner
+}
+
+func (p Parens) end(inner token.Position) token.Position {
+	if p.Rparen.IsValid() {
+		return token.Position{Line: p.Rparen.Line, Column: p.Rparen.Column + 1}
+	}
+	return inner
+}
+
+// after is the position just after the one-character token at pos, or the
+// end of tok when pos is not in the source.
+func after(pos token.Position, tok token.Token) token.Position {
+	if !pos.IsValid() {
+		return tok.End
+	}
+	return token.Position{Line: pos.Line, Column: pos.Column + 1}
+}
+
+// lastEnd is the end of the last of exprs that is there, or of tok if none
+// is.
+func lastEnd(tok token.Token, exprs ...Expression) token.Position {
+	for i := len(exprs) - 1; i >= 0; i-- {
+		if exprs[i] != nil {
+			return exprs[i].End()
+		}
+	}
+	return tok.End
+}
+
+func lastIdentifierEnd(tok token.Token, idents []*Identifier) token.Position {
+	if len(idents) == 0 {
+		return tok.End
+	}
+	return idents[len(idents)-1].End()
+}
@@ -0,0 +1,439 @@
+package ast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/token"
+)
+
+// The String methods print a node back as BASIC source in one canonical
+// form: keywords in upper case, a space either side of each operator, ": "
+// between statements and "; " or ", " between PRINT items. Parentheses are
+// written only where the parser needs them to build the same tree, so
+// parsing what String returns gives back an equivalent node.
+
+func (p *Program) String() string {
+	lines := make([]int, 0, len(p.Statements))
+	for line := range p.Statements {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	var b strings.Builder
+	for _, line := range lines {
+		if line > 0 {
+			b.WriteString(strconv.Itoa(line))
+			b.WriteByte(' ')
+		}
+		b.WriteString(p.Statements[line].String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func (ls *LineStatement) String() string {
+	return strconv.Itoa(ls.LineNumber) + " " + ls.Statement.String()
+}
+
+func (ss *SequenceStatement) String() string {
+	var b strings.Builder
+	for i, stmt := range ss.Statements {
+		if i > 0 {
+			// A label already ends in its colon.
+			if _, ok := ss.Statements[i-1].(*LabelStatement); ok {
+				b.WriteByte(' ')
+			} else {
+				b.WriteString(": ")
+			}
+		}
+		b.WriteString(stmt.String())
+	}
+	return b.String()
+}
+
+func (ls *LabelStatement) String() string { return ls.Name + ":" }
+
+func (ps *PrintStatement) String() string {
+	var b strings.Builder
+	b.WriteString("PRINT")
+	for i, expr := range ps.Expressions {
+		if i == 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(expr.String())
+		if i < len(ps.Separators) {
+			if ps.Separators[i] == "" {
+				b.WriteByte(';')
+			} else {
+				b.WriteByte(',')
+			}
+			if i < len(ps.Expressions)-1 {
+				b.WriteByte(' ')
+			}
+		}
+	}
+	return b.String()
+}
+
+func (ls *LetStatement) String() string {
+	if ls.Index != nil {
+		return "LET " + ls.Name.String() + "(" + ls.Index.String() + ") = " + ls.Value.String()
+	}
+	return "LET " + ls.Name.String() + " = " + ls.Value.String()
+}
+
+func (is *IfStatement) String() string {
+	s := "IF " + is.Condition.String() + " THEN " + is.Consequence.String()
+	if is.Alternative != nil {
+		s += " ELSE " + is.Alternative.String()
+	}
+	return s
+}
+
+// String prints a jump written as a bare line number after THEN or ELSE as
+// it was written.
+func (gs *GotoStatement) String() string {
+	if gs.Token.Type == token.THEN || gs.Token.Type == token.ELSE {
+		return gs.LineNumber.String()
+	}
+	return "GOTO " + gs.LineNumber.String()
+}
+
+func (gs *GosubStatement) String() string { return "GOSUB " + gs.LineNumber.String() }
+
+func (rs *ReturnStatement) String() string { return "RETURN" }
+
+// String leaves out a STEP of 1, which the parser supplies when there is
+// none.
+func (fs *ForStatement) String() string {
+	s := "FOR " + fs.Variable.String() + " = " + fs.Start.String() + " TO " + fs.Limit.String()
+	if step, ok := fs.Step.(*NumberLiteral); !ok || step.Value != 1 {
+		s += " STEP " + fs.Step.String()
+	}
+	return s
+}
+
+func (ns *NextStatement) String() string {
+	if ns.Variable == nil {
+		return "NEXT"
+	}
+	return "NEXT " + ns.Variable.String()
+}
+
+func (is *InputStatement) String() string {
+	s := "INPUT"
+	if is.Prompt != "" || !is.QuestionMark {
+		s += ` "` + strings.ReplaceAll(is.Prompt, `"`, `""`) + `"`
+		if is.QuestionMark {
+			s += ";"
+		} else {
+			s += ","
+		}
+	}
+	if len(is.Variables) > 0 {
+		s += " " + identifiers(is.Variables)
+	}
+	return s
+}
+
+func (es *EndStatement) String() string {
+	s := "END"
+	if es.Token.Type == token.SYSTEM {
+		s = "SYSTEM"
+	}
+	if es.Status != nil {
+		s += " " + es.Status.String()
+	}
+	return s
+}
+
+func (rs *RemStatement) String() string {
+	if rs.Comment == "" {
+		return "REM"
+	}
+	return "REM " + rs.Comment
+}
+
+func (ds *DimStatement) String() string {
+	return "DIM " + ds.Name.String() + "(" + ds.Size.String() + ")"
+}
+
+func (ds *DataStatement) String() string { return "DATA " + expressions(ds.Values) }
+
+func (rs *ReadStatement) String() string { return "READ " + expressions(rs.Variables) }
+
+func (rs *RestoreStatement) String() string {
+	if rs.LineNumber == nil {
+		return "RESTORE"
+	}
+	return "RESTORE " + rs.LineNumber.String()
+}
+
+func (ds *DumpStatement) String() string { return "DUMP" }
+
+func (ss *SleepStatement) String() string { return "SLEEP " + ss.Seconds.String() }
+
+func (ss *ShellStatement) String() string {
+	if ss.Command == nil {
+		return "SHELL"
+	}
+	return "SHELL " + ss.Command.String()
+}
+
+func (ps *PokeStatement) String() string {
+	return "POKE " + ps.Address.String() + ", " + ps.Value.String()
+}
+
+func (op *OpenStatement) String() string {
+	s := "OPEN " + op.File.String() + " AS #" + op.Number.String()
+	if op.RecordLength != nil {
+		s += " LEN = " + op.RecordLength.String()
+	}
+	return s
+}
+
+func (cs *CloseStatement) String() string {
+	if len(cs.Numbers) == 0 {
+		return "CLOSE"
+	}
+	numbers := make([]string, len(cs.Numbers))
+	for i, n := range cs.Numbers {
+		numbers[i] = "#" + n.String()
+	}
+	return "CLOSE " + strings.Join(numbers, ", ")
+}
+
+func (fs *FieldStatement) String() string {
+	s := "FIELD #" + fs.Number.String()
+	for _, field := range fs.Fields {
+		s += ", " + field.Width.String() + " AS " + field.Variable.String()
+	}
+	return s
+}
+
+func (rs *RecordStatement) String() string {
+	s := "GET"
+	if rs.Token.Type == token.PUT {
+		s = "PUT"
+	}
+	s += " #" + rs.Number.String()
+	if rs.Record != nil {
+		s += ", " + rs.Record.String()
+	}
+	return s
+}
+
+func (js *JustifyStatement) String() string {
+	s := "LSET"
+	if js.Token.Type == token.RSET {
+		s = "RSET"
+	}
+	return s + " " + js.Name.String() + " = " + js.Value.String()
+}
+
+func (fs *FilesStatement) String() string {
+	if fs.Pattern == nil {
+		return "FILES"
+	}
+	return "FILES " + fs.Pattern.String()
+}
+
+func (ks *KillStatement) String() string { return "KILL " + ks.File.String() }
+
+func (ns *NameStatement) String() string {
+	return "NAME " + ns.From.String() + " AS " + ns.To.String()
+}
+
+func (cs *ChdirStatement) String() string { return "CHDIR " + cs.Directory.String() }
+
+func (ss *SubStatement) String() string {
+	if len(ss.Params) == 0 {
+		return "SUB " + ss.Name.String()
+	}
+	return "SUB " + ss.Name.String() + "(" + identifiers(ss.Params) + ")"
+}
+
+func (es *EndSubStatement) String() string { return "END SUB" }
+
+func (cs *CallStatement) String() string {
+	if len(cs.Arguments) == 0 {
+		return "CALL " + cs.Name.String()
+	}
+	return "CALL " + cs.Name.String() + "(" + expressions(cs.Arguments) + ")"
+}
+
+func (hs *HostCallStatement) String() string {
+	s := "CALL HOST " + hs.Event.String()
+	if len(hs.Arguments) > 0 {
+		s += ", " + expressions(hs.Arguments)
+	}
+	return s
+}
+
+func (ot *OnTimerStatement) String() string {
+	return "ON TIMER(" + ot.Interval.String() + ") GOSUB " + ot.Target.String()
+}
+
+func (ts *TimerStatement) String() string { return "TIMER " + ts.Mode }
+
+func (cs *ClsStatement) String() string { return "CLS" }
+
+func (ls *LocateStatement) String() string { return optionalArguments("LOCATE", ls.Row, ls.Column) }
+
+func (cs *ColorStatement) String() string {
+	return optionalArguments("COLOR", cs.Foreground, cs.Background)
+}
+
+func (ss *ScreenStatement) String() string { return optionalArguments("SCREEN", ss.Mode, ss.Height) }
+
+func (ps *PlotStatement) String() string {
+	return "PLOT " + ps.X.String() + ", " + ps.Y.String() + withColor(ps.Color)
+}
+
+func (dl *DrawLineStatement) String() string {
+	return "LINE (" + dl.X1.String() + ", " + dl.Y1.String() + ")-(" +
+		dl.X2.String() + ", " + dl.Y2.String() + ")" + withColor(dl.Color)
+}
+
+func (cs *CircleStatement) String() string {
+	return "CIRCLE (" + cs.X.String() + ", " + cs.Y.String() + "), " + cs.Radius.String() + withColor(cs.Color)
+}
+
+func (ss *ScreenSaveStatement) String() string { return "SCREENSAVE " + ss.File.String() }
+
+func (es *ExpressionStatement) String() string { return es.Expression.String() }
+
+func (i *Identifier) String() string { return i.Value }
+
+// String keeps the number as it was written when it still reads as the
+// same value; a DATA item such as -5 holds its sign apart from its token.
+func (nl *NumberLiteral) String() string {
+	if v, err := strconv.ParseFloat(nl.Token.Literal, 64); err == nil && v == nl.Value {
+		return nl.Token.Literal
+	}
+	return strconv.FormatFloat(nl.Value, 'f', -1, 64)
+}
+
+func (bl *BooleanLiteral) String() string {
+	if bl.Value {
+		return "TRUE"
+	}
+	return "FALSE"
+}
+
+// String quotes the string, including a DATA item that was written
+// without quotes, which reads back the same, and doubles any quote in it.
+func (sl *StringLiteral) String() string {
+	return `"` + strings.ReplaceAll(sl.Value, `"`, `""`) + `"`
+}
+
+func (ie *InfixExpression) String() string {
+	op := strings.ToUpper(ie.Operator)
+	prec := precedence(op)
+	return operand(ie.Left, prec, false) + " " + op + " " + operand(ie.Right, prec, true)
+}
+
+func (pe *PrefixExpression) String() string {
+	op := strings.ToUpper(pe.Operator)
+	right := pe.Right.String()
+	if _, ok := pe.Right.(*InfixExpression); ok {
+		right = "(" + right + ")"
+	}
+	if op == "NOT" {
+		return op + " " + right
+	}
+	return op + right
+}
+
+func (aa *ArrayAccess) String() string {
+	return aa.Name.String() + "(" + aa.Index.String() + ")"
+}
+
+// String writes a call with no arguments, such as TIMER or COMMAND$,
+// without parentheses.
+func (ce *CallExpression) String() string {
+	if len(ce.Arguments) == 0 {
+		return ce.Function
+	}
+	return ce.Function + "(" + expressions(ce.Arguments) + ")"
+}
+
+// precedence ranks the binary operators as the parser does, from IMP, which
+// binds most loosely, to *, / and MOD.
+func precedence(op string) int {
+	switch op {
+	case "IMP":
+		return 1
+	case "EQV":
+		return 2
+	case "XOR":
+		return 3
+	case "OR":
+		return 4
+	case "AND":
+		return 5
+	case "==", "<>":
+		return 6
+	case "<", ">", "<=", ">=":
+		return 7
+	case "+", "-":
+		return 8
+	}
+	return 9
+}
+
+// operand prints one side of an operator of precedence prec, in
+// parentheses when it binds more loosely or, on the right, as loosely:
+// operators group from the left, so A - (B - C) needs them and
+// (A - B) - C does not.
+func operand(expr Expression, prec int, right bool) string {
+	s := expr.String()
+	if inner, ok := expr.(*InfixExpression); ok {
+		p := precedence(strings.ToUpper(inner.Operator))
+		if p < prec || (right && p == prec) {
+			return "(" + s + ")"
+		}
+	}
+	return s
+}
+
+func expressions(exprs []Expression) string {
+	parts := make([]string, len(exprs))
+	for i, expr := range exprs {
+		parts[i] = expr.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+func identifiers(idents []*Identifier) string {
+	parts := make([]string, len(idents))
+	for i, ident := range idents {
+		parts[i] = ident.Value
+	}
+	return strings.Join(parts, ", ")
+}
+
+// optionalArguments prints a statement whose two arguments may each be
+// left out, as in LOCATE , 10.
+func optionalArguments(keyword string, first, second Expression) string {
+	switch {
+	case first == nil && second == nil:
+		return keyword
+	case second == nil:
+		return keyword + " " + first.String()
+	case first == nil:
+		return keyword + " , " + second.String()
+	}
+	return keyword + " " + first.String() + ", " + second.String()
+}
+
+// withColor prints the colour that ends a graphics statement, if it has
+// one.
+func withColor(color Expression) string {
+	if color == nil {
+		return ""
+	}
+	return ", " + color.String()
+}
@@ -0,0 +1,217 @@
+package ast
+
+import (
+	"fmt"
+	"sort"
+)
+
+// A Visitor's Visit method is called by Walk for each node it reaches. If
+// the visitor w it returns is not nil, Walk visits each of the node's
+// children with w, then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree rooted at node depth-first, in the order the
+// source is written: a program's lines in line order, then each statement's
+// parts from left to right, so the statements after THEN come before those
+// after ELSE. It starts by calling v.Visit(node). Parts that were left out,
+// such as the ELSE of an IF without one, are skipped.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		lines := make([]int, 0, len(n.Statements))
+		for line := range n.Statements {
+			lines = append(lines, line)
+		}
+		sort.Ints(lines)
+		for _, line := range lines {
+			Walk(v, n.Statements[line])
+		}
+	case *LineStatement:
+		walkStatement(v, n.Statement)
+	case *SequenceStatement:
+		for _, stmt := range n.Statements {
+			Walk(v, stmt)
+		}
+	case *PrintStatement:
+		walkList(v, n.Expressions)
+	case *LetStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Index)
+		walkExpression(v, n.Value)
+	case *IfStatement:
+		walkExpression(v, n.Condition)
+		walkStatement(v, n.Consequence)
+		walkStatement(v, n.Alternative)
+	case *GotoStatement:
+		walkExpression(v, n.LineNumber)
+	case *GosubStatement:
+		walkExpression(v, n.LineNumber)
+	case *ForStatement:
+		Walk(v, n.Variable)
+		walkExpression(v, n.Start)
+		walkExpression(v, n.Limit)
+		walkExpression(v, n.Step)
+	case *NextStatement:
+		if n.Variable != nil {
+			Walk(v, n.Variable)
+		}
+	case *InputStatement:
+		walkIdentifiers(v, n.Variables)
+	case *EndStatement:
+		walkExpression(v, n.Status)
+	case *DimStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Size)
+	case *DataStatement:
+		walkList(v, n.Values)
+	case *ReadStatement:
+		walkList(v, n.Variables)
+	case *RestoreStatement:
+		walkExpression(v, n.LineNumber)
+	case *SleepStatement:
+		walkExpression(v, n.Seconds)
+	case *ShellStatement:
+		walkExpression(v, n.Command)
+	case *PokeStatement:
+		walkExpression(v, n.Address)
+		walkExpression(v, n.Value)
+	case *OpenStatement:
+		walkExpression(v, n.File)
+		walkExpression(v, n.Number)
+		walkExpression(v, n.RecordLength)
+	case *CloseStatement:
+		walkList(v, n.Numbers)
+	case *FieldStatement:
+		walkExpression(v, n.Number)
+		for _, field := range n.Fields {
+			walkExpression(v, field.Width)
+			Walk(v, field.Variable)
+		}
+	case *RecordStatement:
+		walkExpression(v, n.Number)
+		walkExpression(v, n.Record)
+	case *JustifyStatement:
+		Walk(v, n.Name)
+		walkExpression(v, n.Value)
+	case *FilesStatement:
+		walkExpression(v, n.Pattern)
+	case *KillStatement:
+		walkExpression(v, n.File)
+	case *NameStatement:
+		walkExpression(v, n.From)
+		walkExpression(v, n.To)
+	case *ChdirStatement:
+		walkExpression(v, n.Directory)
+	case *SubStatement:
+		Walk(v, n.Name)
+		walkIdentifiers(v, n.Params)
+	case *CallStatement:
+		Walk(v, n.Name)
+		walkList(v, n.Arguments)
+	case *HostCallStatement:
+		walkExpression(v, n.Event)
+		walkList(v, n.Arguments)
+	case *OnTimerStatement:
+		walkExpression(v, n.Interval)
+		walkExpression(v, n.Target)
+	case *LocateStatement:
+		walkExpression(v, n.Row)
+		walkExpression(v, n.Column)
+	case *ColorStatement:
+		walkExpression(v, n.Foreground)
+		walkExpression(v, n.Background)
+	case *ScreenStatement:
+		walkExpression(v, n.Mode)
+		walkExpression(v, n.Height)
+	case *PlotStatement:
+		walkExpression(v, n.X)
+		walkExpression(v, n.Y)
+		walkExpression(v, n.Color)
+	case *DrawLineStatement:
+		walkExpression(v, n.X1)
+		walkExpression(v, n.Y1)
+		walkExpression(v, n.X2)
+		walkExpression(v, n.Y2)
+		walkExpression(v, n.Color)
+	case *CircleStatement:
+		walkExpression(v, n.X)
+		walkExpression(v, n.Y)
+		walkExpression(v, n.Radius)
+		walkExpression(v, n.Color)
+	case *ScreenSaveStatement:
+		walkExpression(v, n.File)
+	case *ExpressionStatement:
+		walkExpression(v, n.Expression)
+	case *InfixExpression:
+		walkExpression(v, n.Left)
+		walkExpression(v, n.Right)
+	case *PrefixExpression:
+		walkExpression(v, n.Right)
+	case *ArrayAccess:
+		Walk(v, n.Name)
+		walkExpression(v, n.Index)
+	case *CallExpression:
+		walkList(v, n.Arguments)
+	case *LabelStatement, *ReturnStatement, *RemStatement, *DumpStatement, *EndSubStatement,
+		*TimerStatement, *ClsStatement, *Identifier, *NumberLiteral, *BooleanLiteral, *StringLiteral:
+		// No children.
+	default:
+		panic(fmt.Sprintf("ast.Walk: unexpected node type %T", n))
+	}
+
+	v.Visit(nil)
+}
+
+func walkStatement(v Visitor, stmt Statement) {
+	if stmt != nil {
+		Walk(v, stmt)
+	}
+}
+
+func walkExpression(v Visitor, expr Expression) {
+	if expr != nil {
+		Walk(v, expr)
+	}
+}
+
+func walkList(v Visitor, exprs []Expression) {
+	for _, expr := range exprs {
+		walkExpression(v, expr)
+	}
+}
+
+func walkIdentifiers(v Visitor, idents []*Identifier) {
+	for _, ident := range idents {
+		Walk(v, ident)
+	}
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree rooted at node in the order of Walk, calling
+// f for each node. If f returns true, Inspect goes on to the node's
+// children, then calls f(nil).
+//
+// To see every statement, including those after THEN and ELSE, without
+// going into expressions:
+//
+//	ast.Inspect(stmt, func(n ast.Node) bool {
+//		_, ok := n.(ast.Statement)
+//		return ok
+//	})
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
@@ -0,0 +1,295 @@
+// Package basic embeds the BASIC interpreter in a Go program. An
+// Interpreter reads and writes only the streams it is given, so a service
+// can run BASIC scripts without touching its own standard input and output:
+//
+//	interp := basic.New(basic.WithStdin(strings.NewReader("42\n")))
+//	if err := interp.Load(source); err != nil {
+//		return err
+//	}
+//	if err := interp.Run(ctx); err != nil {
+//		return err
+//	}
+//	fmt.Print(interp.Output())
+package basic
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/graphics"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+// Value is a BASIC value: a number or a string.
+type Value = evaluator.Value
+
+// RuntimeError is the error Run returns when the program fails, carrying
+// the classic BASIC error code and the line that failed.
+type RuntimeError = evaluator.RuntimeError
+
+// Number returns a BASIC number, for host functions to return.
+func Number(n float64) Value { return evaluator.Number(n) }
+
+// String returns a BASIC string, for host functions to return.
+func String(s string) Value { return evaluator.String(s) }
+
+// Interpreter runs one BASIC program at a time. It is not safe for
+// concurrent use; give each goroutine its own.
+type Interpreter struct {
+	stdin   io.Reader
+	stdout  io.Writer
+	stderr  io.Writer
+	dialect dialect.Dialect
+	args    []string
+	shell   bool
+	funcs   map[string]evaluator.HostFunction
+	events  func(event string, args ...Value) error
+	hooks   evaluator.Hooks
+	screen  graphics.Backend
+
+	maxString, maxCells int
+
+	// captured holds the output when no stdout was given.
+	captured bytes.Buffer
+	program  *ast.Program
+	eval     *evaluator.Evaluator
+}
+
+// Option configures an Interpreter.
+type Option func(*Interpreter)
+
+// WithStdin makes INPUT read from r. Without it a program that asks for
+// input finds none.
+func WithStdin(r io.Reader) Option {
+	return func(in *Interpreter) { in.stdin = r }
+}
+
+// WithStdout sends the program's output to w. Without it the output is
+// kept for Output.
+func WithStdout(w io.Writer) Option {
+	return func(in *Interpreter) { in.stdout = w }
+}
+
+// WithStderr sends the error output of SHELL commands to w. Without it
+// that output is discarded.
+func WithStderr(w io.Writer) Option {
+	return func(in *Interpreter) { in.stderr = w }
+}
+
+// WithDialect selects the semantics programs follow, dialect.Standard by
+// default.
+func WithDialect(d dialect.Dialect) Option {
+	return func(in *Interpreter) { in.dialect = d }
+}
+
+// WithArgs sets the arguments a program sees through COMMAND$.
+func WithArgs(args ...string) Option {
+	return func(in *Interpreter) { in.args = args }
+}
+
+// WithShell lets programs run host commands with SHELL, which they cannot
+// by default.
+func WithShell(enabled bool) Option {
+	return func(in *Interpreter) { in.shell = enabled }
+}
+
+// WithEventHandler receives the events programs send with
+// CALL HOST "event", arg, ..., letting BASIC drive the embedding program
+// without access to the host system. An error from fn stops the program.
+// Without a handler, CALL HOST is a runtime error.
+func WithEventHandler(fn func(event string, args ...Value) error) Option {
+	return func(in *Interpreter) { in.events = fn }
+}
+
+// WithHooks observes runs as they happen, for tracers, coverage tools and
+// the like. Hooks can call the Interpreter's Snapshot and Lookup to see the
+// program's variables.
+func WithHooks(hooks evaluator.Hooks) Option {
+	return func(in *Interpreter) { in.hooks = hooks }
+}
+
+// WithGraphics makes SCREEN, PLOT, LINE, CIRCLE and SCREENSAVE draw with
+// b, such as a window of the host's, instead of on a graphics.Canvas
+// saved to a file. A Backend is used by one run at a time.
+func WithGraphics(b graphics.Backend) Option {
+	return func(in *Interpreter) { in.screen = b }
+}
+
+// WithMemoryLimits caps the length of any string, in bytes, and the total
+// number of array elements DIM may declare; a program that goes past
+// either stops with "Out of memory". Zero removes a cap. Both default to
+// evaluator.DefaultMaxStringLength and evaluator.DefaultMaxArrayCells.
+func WithMemoryLimits(maxString, maxArrayCells int) Option {
+	return func(in *Interpreter) { in.maxString, in.maxCells = maxString, maxArrayCells }
+}
+
+// New returns an Interpreter configured by opts.
+func New(opts ...Option) *Interpreter {
+	in := &Interpreter{
+		stdin:   strings.NewReader(""),
+		stderr:  io.Discard,
+		dialect: dialect.Standard,
+
+		maxString: evaluator.DefaultMaxStringLength,
+		maxCells:  evaluator.DefaultMaxArrayCells,
+	}
+	for _, opt := range opts {
+		opt(in)
+	}
+	return in
+}
+
+// ParseError lists the problems that stopped a program from loading.
+type ParseError struct {
+	Errors []string
+}
+
+func (e *ParseError) Error() string {
+	return "parse errors: " + strings.Join(e.Errors, "; ")
+}
+
+// ErrNoProgram is returned by Run when no program has been loaded.
+var ErrNoProgram = errors.New("basic: no program loaded")
+
+// RegisterFunction makes fn callable from BASIC as name, so an embedding
+// program can add its own built-ins:
+//
+//	interp.RegisterFunction("HTTPGET$", func(args ...basic.Value) (basic.Value, error) {
+//		...
+//		return basic.String(body), nil
+//	})
+//
+// Register functions before Load, which needs to know them to parse calls.
+// Read arguments with their AsNumber and AsString methods. A name ending
+// in $ must return a string, any other name a number; the wrong
+// type, or an error, stops the program with a runtime error naming the
+// function. Names that are BASIC keywords or functions are rejected.
+func (in *Interpreter) RegisterFunction(name string, fn func(args ...Value) (Value, error)) error {
+	if err := evaluator.CheckFunctionName(name); err != nil {
+		return fmt.Errorf("basic: %v", err)
+	}
+	if in.funcs == nil {
+		in.funcs = map[string]evaluator.HostFunction{}
+	}
+	in.funcs[strings.ToUpper(name)] = fn
+	return nil
+}
+
+// Load parses source, a program of numbered lines, replacing any program
+// loaded before. It returns a *ParseError if the program does not parse.
+func (in *Interpreter) Load(source string) error {
+	program, err := in.parse(lexer.New(source))
+	if err != nil {
+		return err
+	}
+	in.program, in.eval = program, nil
+	return nil
+}
+
+// LoadReader is Load for a program read from r, which is parsed as it is
+// read rather than first read whole, for a large generated program or one
+// arriving over a network. If reading r fails, it returns that error and
+// keeps the program loaded before.
+func (in *Interpreter) LoadReader(r io.Reader) error {
+	l := lexer.NewReader(r)
+	program, err := in.parse(l)
+	if l.Err() != nil {
+		return fmt.Errorf("basic: reading program: %w", l.Err())
+	}
+	if err != nil {
+		return err
+	}
+	in.program, in.eval = program, nil
+	return nil
+}
+
+func (in *Interpreter) parse(l *lexer.Lexer) (*ast.Program, error) {
+	l.SetDialect(in.dialect)
+	p := parser.New(l)
+	for name := range in.funcs {
+		p.AddFunctions(name)
+	}
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return nil, &ParseError{Errors: errs}
+	}
+	return program, nil
+}
+
+// Run runs the loaded program from the start with no variables set. When
+// ctx is cancelled the program stops before its next statement, or while
+// it waits in INPUT or SLEEP, and Run returns an *evaluator.CancelError that
+// wraps ctx.Err(). Other failures are BASIC runtime errors.
+func (in *Interpreter) Run(ctx context.Context) error {
+	if in.program == nil {
+		return ErrNoProgram
+	}
+
+	stdout := in.stdout
+	if stdout == nil {
+		in.captured.Reset()
+		stdout = &in.captured
+	}
+	eval := evaluator.New(in.program, evaluator.Options{Stdin: in.stdin, Stdout: stdout, Stderr: in.stderr})
+	eval.SetDialect(in.dialect)
+	eval.SetArgs(in.args)
+	eval.SetShellEnabled(in.shell)
+	eval.SetHooks(in.hooks)
+	eval.SetMaxStringLength(in.maxString)
+	eval.SetMaxArrayCells(in.maxCells)
+	if in.events != nil {
+		eval.SetEventHandler(in.events)
+	}
+	if in.screen != nil {
+		eval.SetGraphics(in.screen)
+	}
+	for name, fn := range in.funcs {
+		eval.RegisterFunction(name, fn)
+	}
+	in.eval = eval
+	return eval.Run(ctx)
+}
+
+// Output returns what the last run printed, when no WithStdout was given.
+func (in *Interpreter) Output() string {
+	return in.captured.String()
+}
+
+// Lookup returns the value a variable had when the last run ended.
+func (in *Interpreter) Lookup(name string) (Value, bool) {
+	if in.eval == nil {
+		return Value{}, false
+	}
+	return in.eval.Lookup(name)
+}
+
+// Snapshot copies the state of the running program, or of the last run
+// once it has ended.
+func (in *Interpreter) Snapshot() evaluator.Snapshot {
+	if in.eval == nil {
+		return evaluator.Snapshot{}
+	}
+	return in.eval.Snapshot()
+}
+
+// Eval runs source with the given options and returns what it printed,
+// for the common case of running a script once and using its output.
+func Eval(ctx context.Context, source string, opts ...Option) (string, error) {
+	in := New(opts...)
+	if in.stdout != nil {
+		return "", fmt.Errorf("basic: Eval captures output; do not use WithStdout")
+	}
+	if err := in.Load(source); err != nil {
+		return "", err
+	}
+	err := in.Run(ctx)
+	return in.Output(), err
+}
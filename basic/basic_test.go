@@ -0,0 +1,180 @@
+package basic_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basis-ex/basic"
+	"github.com/basis-ex/evaluator"
+)
+
+func TestRun(t *testing.T) {
+	interp := basic.New(basic.WithStdin(strings.NewReader("20\n")), basic.WithArgs("one", "two"))
+	if err := interp.Run(context.Background()); !errors.Is(err, basic.ErrNoProgram) {
+		t.Fatalf("Run before Load = %v, want ErrNoProgram", err)
+	}
+	src := "10 INPUT N\n20 LET A$ = COMMAND$(2)\n30 PRINT N * 2; A$\n"
+	if err := interp.Load(src); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := interp.Output(), "? 40two\n"; got != want {
+		t.Errorf("Output = %q, want %q", got, want)
+	}
+	if v, ok := interp.Lookup("A$"); !ok {
+		t.Error("A$ not set")
+	} else if s, _ := v.AsString(); s != "two" {
+		t.Errorf("A$ = %q, want \"two\"", s)
+	}
+
+	var perr *basic.ParseError
+	if err := interp.Load("10 PRINT (\n"); !errors.As(err, &perr) {
+		t.Errorf("Load of a bad program = %v, want a *ParseError", err)
+	}
+}
+
+func TestWithStdout(t *testing.T) {
+	var out strings.Builder
+	interp := basic.New(basic.WithStdout(&out))
+	if err := interp.Load("10 PRINT \"HI\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := interp.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "HI\n" || interp.Output() != "" {
+		t.Errorf("wrote %q and kept %q, want \"HI\\n\" written and nothing kept", out.String(), interp.Output())
+	}
+	if _, err := basic.Eval(context.Background(), "10 END\n", basic.WithStdout(&out)); err == nil {
+		t.Error("Eval with WithStdout succeeded")
+	}
+}
+
+func TestHostFunctions(t *testing.T) {
+	tests := []struct {
+		name, src, want, err string
+	}{
+		{name: "number", src: "10 PRINT TWICE(21)\n", want: "42\n"},
+		{name: "string", src: "10 PRINT GREET$(\"BOB\")\n", want: "HELLO, BOB\n"},
+		{name: "wrong type", src: "10 PRINT WRONG(1)\n", err: "must return a number"},
+		{name: "error", src: "10 PRINT FAIL(1)\n", err: "FAIL: no luck"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			interp := basic.New()
+			funcs := map[string]func(args ...basic.Value) (basic.Value, error){
+				"TWICE": func(args ...basic.Value) (basic.Value, error) {
+					n, _ := args[0].AsNumber()
+					return basic.Number(2 * n), nil
+				},
+				"GREET$": func(args ...basic.Value) (basic.Value, error) {
+					s, _ := args[0].AsString()
+					return basic.String("HELLO, " + s), nil
+				},
+				"WRONG": func(args ...basic.Value) (basic.Value, error) {
+					return basic.String("oops"), nil
+				},
+				"FAIL": func(args ...basic.Value) (basic.Value, error) {
+					return basic.Value{}, errors.New("no luck")
+				},
+			}
+			for name, fn := range funcs {
+				if err := interp.RegisterFunction(name, fn); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := interp.Load(tt.src); err != nil {
+				t.Fatal(err)
+			}
+			err := interp.Run(context.Background())
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := interp.Output(); got != tt.want {
+					t.Errorf("Output = %q, want %q", got, tt.want)
+				}
+				return
+			}
+			var rt *basic.RuntimeError
+			if !errors.As(err, &rt) || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Run = %v, want a runtime error containing %q", err, tt.err)
+			} else if rt.Line != 10 {
+				t.Errorf("error in line %d, want 10", rt.Line)
+			}
+		})
+	}
+
+	if err := basic.New().RegisterFunction("PRINT", nil); err == nil {
+		t.Error("registered PRINT as a function")
+	}
+}
+
+func TestEventHandler(t *testing.T) {
+	var events []string
+	interp := basic.New(basic.WithEventHandler(func(event string, args ...basic.Value) error {
+		if event == "quit" {
+			return errors.New("told to quit")
+		}
+		for _, arg := range args {
+			if s, ok := arg.AsString(); ok {
+				event += " " + s
+			} else if n, ok := arg.AsNumber(); ok {
+				event += fmt.Sprint(" ", n)
+			}
+		}
+		events = append(events, event)
+		return nil
+	}))
+	if err := interp.Load("10 LET S = 5\n20 CALL HOST \"score\", S * 2, \"ANN\"\n30 CALL HOST \"quit\"\n40 PRINT \"NOT REACHED\"\n"); err != nil {
+		t.Fatal(err)
+	}
+	err := interp.Run(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "told to quit") {
+		t.Errorf("Run = %v, want the handler's error", err)
+	}
+	if want := "score 10 ANN"; len(events) != 1 || events[0] != want {
+		t.Errorf("events %q, want [%q]", events, want)
+	}
+	if strings.Contains(interp.Output(), "NOT REACHED") {
+		t.Error("the program went on after the handler failed")
+	}
+
+	if _, err := basic.Eval(context.Background(), "10 CALL HOST \"score\"\n"); err == nil {
+		t.Error("CALL HOST without a handler succeeded")
+	}
+}
+
+func TestCancel(t *testing.T) {
+	tests := []struct {
+		name, src string
+	}{
+		{"loop over lines", "10 LET I = I + 1\n20 GOTO 10\n"},
+		{"loop within a line", "10 FOR I = 1 TO 2: LET I = 1: NEXT I\n"},
+		{"waiting in SLEEP", "10 SLEEP 60\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, err := basic.Eval(ctx, tt.src)
+			var cancelled *evaluator.CancelError
+			if !errors.As(err, &cancelled) || !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Eval = %v, want a CancelError wrapping the deadline", err)
+			}
+			if cancelled.Line != 10 && cancelled.Line != 20 {
+				t.Errorf("stopped in line %d", cancelled.Line)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("took %v to stop", elapsed)
+			}
+		})
+	}
+}
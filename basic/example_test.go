@@ -0,0 +1,46 @@
+package basic_test
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/basis-ex/basic"
+)
+
+func Example() {
+	interp := basic.New()
+	interp.RegisterFunction("DOUBLE", func(args ...basic.Value) (basic.Value, error) {
+		n, _ := args[0].AsNumber()
+		return basic.Number(2 * n), nil
+	})
+	err := interp.Load(`10 LET N = 6
+20 PRINT "TWICE "; N; " IS "; DOUBLE(N)
+30 LET R = DOUBLE(N) + 1
+`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := interp.Run(context.Background()); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(interp.Output())
+	r, _ := interp.Lookup("R")
+	n, _ := r.AsNumber()
+	fmt.Println("R =", n)
+	// Output:
+	// TWICE 6 IS 12
+	// R = 13
+}
+
+func ExampleEval() {
+	out, err := basic.Eval(context.Background(), "10 PRINT \"HELLO\"\n")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(out)
+	// Output:
+	// HELLO
+}
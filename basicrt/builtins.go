@@ -0,0 +1,164 @@
+package basicrt
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/basis-ex/intrinsic"
+)
+
+// builtin is one of the intrinsic functions, as listed in package
+// intrinsic, with the runtime's implementation.
+type builtin struct {
+	intrinsic.Function
+	fn func(args []Value) (Value, error)
+}
+
+// builtinFuncs implement the functions compiled programs can call: the
+// intrinsics less unsupportedBuiltins.
+var builtinFuncs = map[string]func(args []Value) (Value, error){
+	"UCASE$":   stringFunc(strings.ToUpper),
+	"LCASE$":   stringFunc(strings.ToLower),
+	"LTRIM$":   stringFunc(func(s string) string { return strings.TrimLeft(s, " ") }),
+	"RTRIM$":   stringFunc(func(s string) string { return strings.TrimRight(s, " ") }),
+	"TRIM$":    stringFunc(func(s string) string { return strings.Trim(s, " ") }),
+	"ENVIRON$": builtinEnviron,
+	"COMMAND$": builtinCommand,
+	"PEEK":     builtinPeek,
+	"TIMER":    builtinTimer,
+	"ROUND":    numberFunc(round),
+	"FIX":      numberFunc(fix),
+	"MIN":      numberFunc(func(x ...float64) float64 { return math.Min(x[0], x[1]) }),
+	"MAX":      numberFunc(func(x ...float64) float64 { return math.Max(x[0], x[1]) }),
+}
+
+var unsupportedBuiltins = []string{"LOF", "INPUT$"}
+
+var builtins = map[string]builtin{}
+
+func init() {
+	names := make([]string, 0, len(builtinFuncs))
+	for name, fn := range builtinFuncs {
+		info, _ := intrinsic.Lookup(name)
+		builtins[name] = builtin{info, fn}
+		names = append(names, name)
+	}
+	if err := intrinsic.Check("basicrt", names, unsupportedBuiltins...); err != nil {
+		panic(err)
+	}
+}
+
+// HasBuiltin reports whether compiled programs can call the built-in
+// function name.
+func HasBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+// CallBuiltin calls the built-in function name.
+func CallBuiltin(name string, args []Value) (Value, error) {
+	fn, ok := builtins[name]
+	if !ok {
+		return Value{}, fmt.Errorf("unknown function: %s", name)
+	}
+	if err := fn.CheckArity(len(args)); err != nil {
+		return Value{}, err
+	}
+	val, err := fn.fn(args)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %v", name, err)
+	}
+	return val, nil
+}
+
+func stringFunc(f func(string) string) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		if args[0].IsNumber() {
+			return Value{}, fmt.Errorf("expected string argument")
+		}
+		return StrVal(f(args[0].str)), nil
+	}
+}
+
+func numberFunc(f func(x ...float64) float64) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		nums := make([]float64, len(args))
+		for i, arg := range args {
+			if !arg.IsNumber() {
+				return Value{}, fmt.Errorf("expected number argument")
+			}
+			nums[i] = arg.num
+		}
+		return NumVal(f(nums...)), nil
+	}
+}
+
+func round(x ...float64) float64 {
+	if len(x) == 1 {
+		return positiveZero(math.Round(x[0]))
+	}
+	scale := math.Pow(10, math.Trunc(x[1]))
+	return positiveZero(math.Round(x[0]*scale) / scale)
+}
+
+// fix implements FIX, truncating toward zero.
+func fix(x ...float64) float64 {
+	return positiveZero(math.Trunc(x[0]))
+}
+
+// positiveZero turns the -0 that FIX and ROUND give for a small negative
+// number into 0, so that it prints without a sign.
+func positiveZero(x float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x
+}
+
+func builtinEnviron(args []Value) (Value, error) {
+	if !args[0].IsNumber() {
+		return StrVal(os.Getenv(args[0].str)), nil
+	}
+	env := os.Environ()
+	n := int(args[0].num)
+	if n < 1 || n > len(env) {
+		return StrVal(""), nil
+	}
+	return StrVal(env[n-1]), nil
+}
+
+func builtinPeek(args []Value) (Value, error) {
+	if !args[0].IsNumber() {
+		return Value{}, fmt.Errorf("expected number argument")
+	}
+	b, err := Peek(int(args[0].num))
+	if err != nil {
+		return Value{}, err
+	}
+	return NumVal(float64(b)), nil
+}
+
+func builtinTimer(args []Value) (Value, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return NumVal(now.Sub(midnight).Seconds()), nil
+}
+
+// builtinCommand reads the compiled program's own arguments.
+func builtinCommand(args []Value) (Value, error) {
+	programArgs := os.Args[1:]
+	if len(args) == 0 {
+		return StrVal(strings.Join(programArgs, " ")), nil
+	}
+	if !args[0].IsNumber() {
+		return Value{}, fmt.Errorf("expected number argument")
+	}
+	n := int(args[0].num)
+	if n < 1 || n > len(programArgs) {
+		return StrVal(""), nil
+	}
+	return StrVal(programArgs[n-1]), nil
+}
@@ -0,0 +1,121 @@
+package basicrt
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// MaxGosubDepth matches the interpreter's default GOSUB nesting limit.
+const MaxGosubDepth = 1000
+
+// ForLoop is an active FOR loop: its variable, bounds, and the index of the
+// FOR statement.
+type ForLoop struct {
+	Var     string
+	End     float64
+	Step    float64
+	StartPC int
+}
+
+// FindForLoop returns the index in loops of the innermost loop on the
+// variable name, or -1.
+func FindForLoop(loops []*ForLoop, name string) int {
+	for i := len(loops) - 1; i >= 0; i-- {
+		if loops[i].Var == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// DropForLoop ends the loop on name, and any inside it, for a FOR that
+// starts it again.
+func DropForLoop(loops []*ForLoop, name string) []*ForLoop {
+	if i := FindForLoop(loops, name); i >= 0 {
+		return loops[:i]
+	}
+	return loops
+}
+
+// LoopContinues reports whether a loop variable at value has not yet
+// passed end, going by step.
+func LoopContinues(value, end, step float64) bool {
+	if step < 0 {
+		return value >= end
+	}
+	return value <= end
+}
+
+// CallFrame is an active CALL of a SUB: where to return to, the caller's
+// environment and FOR loops to restore, and the caller's variables its
+// by-reference parameters are copied back to.
+type CallFrame struct {
+	ReturnPC int
+	Caller   *Env
+	ForLoops []*ForLoop
+	ByRef    map[string]string
+}
+
+// Dump implements DUMP, printing the same report as the interpreter.
+// lines holds the line of each statement, which loops and callStack index.
+func (e *Env) Dump(lines []int, loops []*ForLoop, callStack []int) {
+	quote := func(v Value) string {
+		if v.kind == stringKind {
+			return strconv.Quote(v.str)
+		}
+		return v.Inspect()
+	}
+
+	fmt.Fprintln(e.Stdout, "Variables:")
+	names := make([]string, 0, len(e.vars))
+	for name := range e.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintln(e.Stdout, "  (none)")
+	}
+	for _, name := range names {
+		fmt.Fprintf(e.Stdout, "  %s = %s\n", name, quote(e.vars[name]))
+	}
+
+	fmt.Fprintln(e.Stdout, "Arrays:")
+	names = names[:0]
+	for name := range e.arrays {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) == 0 {
+		fmt.Fprintln(e.Stdout, "  (none)")
+	}
+	for _, name := range names {
+		arr := e.arrays[name]
+		fmt.Fprintf(e.Stdout, "  %s(%d)", name, e.dims[name])
+		indexes := make([]int, 0, len(arr))
+		for i := range arr {
+			indexes = append(indexes, i)
+		}
+		sort.Ints(indexes)
+		for _, i := range indexes {
+			fmt.Fprintf(e.Stdout, " [%d]=%s", i, quote(arr[i]))
+		}
+		fmt.Fprintln(e.Stdout)
+	}
+
+	fmt.Fprintln(e.Stdout, "FOR loops:")
+	if len(loops) == 0 {
+		fmt.Fprintln(e.Stdout, "  (none)")
+	}
+	for _, loop := range loops {
+		fmt.Fprintf(e.Stdout, "  %s TO %g STEP %g (from line %d)\n", loop.Var, loop.End, loop.Step, lines[loop.StartPC])
+	}
+
+	fmt.Fprintln(e.Stdout, "GOSUB stack:")
+	if len(callStack) == 0 {
+		fmt.Fprintln(e.Stdout, "  (empty)")
+	}
+	for i := len(callStack) - 1; i >= 0; i-- {
+		fmt.Fprintf(e.Stdout, "  returns to line %d\n", lines[callStack[i]])
+	}
+}
@@ -0,0 +1,220 @@
+package basicrt
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dialect is what a program was compiled for of the interpreter's dialect:
+// the value of true, whether the logical operators work bitwise on 16-bit
+// integers, and how wide PRINT's zones are, 0 for a tab.
+type Dialect struct {
+	True         float64
+	BitwiseLogic bool
+	ZoneWidth    int
+}
+
+// Env holds the variables and arrays of a running program, or of one call
+// of a SUB, with the streams it reads and writes.
+type Env struct {
+	dialect Dialect
+	vars    map[string]Value
+	arrays  map[string]map[int]Value
+	dims    map[string]int
+	reader  *bufio.Reader
+	// column is where PRINT has left the output line, shared by every
+	// scope.
+	column *int
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// NewEnv returns the top-level environment of a run that reads INPUT from
+// stdin and writes its output to stdout and stderr.
+func NewEnv(d Dialect, stdin io.Reader, stdout, stderr io.Writer) *Env {
+	return &Env{
+		dialect: d,
+		vars:    map[string]Value{},
+		arrays:  map[string]map[int]Value{},
+		dims:    map[string]int{},
+		reader:  bufio.NewReader(stdin),
+		column:  new(int),
+		Stdin:   stdin,
+		Stdout:  stdout,
+		Stderr:  stderr,
+	}
+}
+
+// NewScope returns an empty environment for a SUB called from e, sharing
+// its dialect and streams.
+func (e *Env) NewScope() *Env {
+	return &Env{
+		dialect: e.dialect,
+		vars:    map[string]Value{},
+		arrays:  map[string]map[int]Value{},
+		dims:    map[string]int{},
+		reader:  e.reader,
+		column:  e.column,
+		Stdin:   e.Stdin,
+		Stdout:  e.Stdout,
+		Stderr:  e.Stderr,
+	}
+}
+
+// Get returns the variable name, or 0 if it was never set.
+func (e *Env) Get(name string) Value {
+	if v, ok := e.vars[name]; ok {
+		return v
+	}
+	return NumVal(0)
+}
+
+// Lookup returns the variable name and whether it has been set.
+func (e *Env) Lookup(name string) (Value, bool) {
+	v, ok := e.vars[name]
+	return v, ok
+}
+
+// Set sets the variable name.
+func (e *Env) Set(name string, val Value) {
+	e.vars[name] = val
+}
+
+// Bool returns the dialect's true value for true, and 0 for false.
+func (e *Env) Bool(b bool) Value {
+	if b {
+		return NumVal(e.dialect.True)
+	}
+	return NumVal(0)
+}
+
+// Truth is Bool for a number: the dialect's true value for true, and 0 for
+// false.
+func (e *Env) Truth(b bool) float64 {
+	if b {
+		return e.dialect.True
+	}
+	return 0
+}
+
+// Print writes text for PRINT, keeping track of the column it leaves the
+// output at.
+func (e *Env) Print(text string) {
+	fmt.Fprint(e.Stdout, text)
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		*e.column = utf8.RuneCountInString(text[i+1:])
+	} else {
+		*e.column += utf8.RuneCountInString(text)
+	}
+}
+
+// PrintZone moves the output to the start of the next print zone, as a
+// comma in PRINT does, or prints a tab if the dialect has no zones.
+func (e *Env) PrintZone() {
+	width := e.dialect.ZoneWidth
+	if width <= 0 {
+		e.Print("\t")
+		return
+	}
+	e.Print(strings.Repeat(" ", width-*e.column%width))
+}
+
+// ReadInput reads one line for INPUT, asking again with "?Redo from start"
+// until every numeric variable gets a number.
+func (e *Env) ReadInput(prompt string, names []string) ([]Value, error) {
+	for {
+		fmt.Fprint(e.Stdout, prompt)
+		line, err := e.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		// The answer ends the line.
+		*e.column = 0
+		items := strings.Split(strings.TrimSpace(line), ",")
+		values := make([]Value, len(names))
+		ok := true
+		for i, name := range names {
+			text := ""
+			if i < len(items) {
+				text = strings.TrimSpace(items[i])
+			}
+			if strings.HasSuffix(name, "$") {
+				values[i] = StrVal(text)
+				continue
+			}
+			if text == "" {
+				values[i] = NumVal(0)
+				continue
+			}
+			num, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				ok = false
+				break
+			}
+			values[i] = NumVal(num)
+		}
+		if ok {
+			return values, nil
+		}
+		fmt.Fprintln(e.Stdout, "?Redo from start")
+	}
+}
+
+// Dim declares array name with elements 0 to size, all 0 again if it was
+// declared before.
+func (e *Env) Dim(name string, size int) {
+	e.arrays[name] = map[int]Value{}
+	e.dims[name] = size
+}
+
+// Element returns the element of array name at index, 0 if it was never
+// set.
+func (e *Env) Element(name string, index Value) (Value, error) {
+	arr, idx, err := e.arrayIndex(name, index)
+	if err != nil {
+		return Value{}, err
+	}
+
+	val, ok := arr[idx]
+	if !ok {
+		return NumVal(0), nil
+	}
+
+	return val, nil
+}
+
+// SetElement sets an element of array name, for LET A(I) = value.
+func (e *Env) SetElement(name string, index, val Value) error {
+	arr, idx, err := e.arrayIndex(name, index)
+	if err != nil {
+		return err
+	}
+	arr[idx] = val
+	return nil
+}
+
+// arrayIndex returns array name and index as a subscript of it, which runs
+// from 0 to its DIM size.
+func (e *Env) arrayIndex(name string, index Value) (map[int]Value, int, error) {
+	arr, ok := e.arrays[name]
+	if !ok {
+		return nil, 0, fmt.Errorf("array %s not defined", name)
+	}
+
+	num, err := MustNumber(index)
+	if err != nil {
+		return nil, 0, fmt.Errorf("array index must be a number")
+	}
+
+	idx := int(num)
+	if size := e.dims[name]; idx < 0 || idx > size {
+		return nil, 0, fmt.Errorf("subscript %d out of range for %s(%d)", idx, name, size)
+	}
+	return arr, idx, nil
+}
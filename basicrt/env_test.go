@@ -0,0 +1,132 @@
+package basicrt
+
+import (
+	"strings"
+	"testing"
+)
+
+// newEnv returns an environment reading input and writing to out.
+func newEnv(d Dialect, input string, out *strings.Builder) *Env {
+	return NewEnv(d, strings.NewReader(input), out, out)
+}
+
+func TestPrintZone(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		texts []string
+		want  string
+	}{
+		{"tab without zones", 0, []string{"A", "", "B"}, "A\tB"},
+		{"next zone", 14, []string{"A", "", "B"}, "A             B"},
+		{"from a full zone", 4, []string{"ABCD", "", "E"}, "ABCD    E"},
+		{"after a newline", 4, []string{"ABCDEF\nG", "", "H"}, "ABCDEF\nG   H"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			e := newEnv(Dialect{ZoneWidth: tt.width}, "", &out)
+			for _, text := range tt.texts {
+				// An empty text is a comma.
+				if text == "" {
+					e.PrintZone()
+				} else {
+					e.Print(text)
+				}
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScopeSharesColumn(t *testing.T) {
+	var out strings.Builder
+	e := newEnv(Dialect{ZoneWidth: 4}, "", &out)
+	e.Print("AB")
+	sub := e.NewScope()
+	sub.PrintZone()
+	sub.Print("C")
+	if got, want := out.String(), "AB  C"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+	sub.Set("X", NumVal(1))
+	if _, ok := e.Lookup("X"); ok {
+		t.Error("a variable set in a SUB's scope is set in its caller's")
+	}
+}
+
+func TestVariables(t *testing.T) {
+	var out strings.Builder
+	e := newEnv(Dialect{}, "", &out)
+	if v := e.Get("A"); !v.IsNumber() || v.Number() != 0 {
+		t.Errorf("unset A is %s, want 0", v.Inspect())
+	}
+	if _, ok := e.Lookup("A"); ok {
+		t.Error("unset A was found")
+	}
+	e.Set("A$", StrVal("HI"))
+	if v, ok := e.Lookup("A$"); !ok || v.Inspect() != "HI" {
+		t.Errorf("A$ is %s, %v, want HI, true", v.Inspect(), ok)
+	}
+}
+
+func TestArrays(t *testing.T) {
+	var out strings.Builder
+	e := newEnv(Dialect{}, "", &out)
+	if _, err := e.Element("A", NumVal(0)); err == nil || err.Error() != "array A not defined" {
+		t.Errorf("A(0) before DIM: error %v", err)
+	}
+
+	e.Dim("A", 3)
+	if err := e.SetElement("A", NumVal(3), NumVal(7)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := e.Element("A", NumVal(3)); err != nil || v.Number() != 7 {
+		t.Errorf("A(3) is %s, %v, want 7", v.Inspect(), err)
+	}
+	if v, err := e.Element("A", NumVal(1)); err != nil || v.Number() != 0 {
+		t.Errorf("A(1) is %s, %v, want 0", v.Inspect(), err)
+	}
+
+	for _, index := range []Value{NumVal(-1), NumVal(4)} {
+		if err := e.SetElement("A", index, NumVal(1)); err == nil || !strings.Contains(err.Error(), "out of range for A(3)") {
+			t.Errorf("A(%s): error %v", index.Inspect(), err)
+		}
+	}
+	if _, err := e.Element("A", StrVal("1")); err == nil {
+		t.Error("A(\"1\") gave no error")
+	}
+
+	e.Dim("A", 3)
+	if v, _ := e.Element("A", NumVal(3)); v.Number() != 0 {
+		t.Errorf("A(3) after DIM again is %s, want 0", v.Inspect())
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	var out strings.Builder
+	e := newEnv(Dialect{}, "X, 2\n1, 2\n", &out)
+	values, err := e.ReadInput("? ", []string{"A", "B$", "C"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "? ?Redo from start\n? "; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+	var got []string
+	for _, v := range values {
+		got = append(got, v.Inspect())
+	}
+	if strings.Join(got, ",") != "1,2,0" {
+		t.Errorf("read %q, want 1, \"2\" and 0", got)
+	}
+	if !values[0].IsNumber() || values[1].IsNumber() {
+		t.Error("A read as a string or B$ as a number")
+	}
+
+	if _, err := e.ReadInput("? ", []string{"A"}); err == nil {
+		t.Error("no error at the end of the input")
+	}
+}
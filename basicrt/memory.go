@@ -0,0 +1,70 @@
+package basicrt
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// The simulated 64KB memory of PEEK and POKE, with the same magic
+// addresses as the interpreter's (see evaluator.Memory).
+const (
+	memorySize  = 65536
+	addrRandom  = 65520
+	addrSecond  = 65521
+	addrMinute  = 65522
+	addrHour    = 65523
+	addrJiffies = 65524
+	addrJiffyHi = 65525
+)
+
+var (
+	memory       [memorySize]byte
+	memoryOrigin = time.Now()
+)
+
+// Peek returns the byte at addr.
+func Peek(addr int) (byte, error) {
+	if addr < 0 || addr >= memorySize {
+		return 0, fmt.Errorf("address %d out of range 0-%d", addr, memorySize-1)
+	}
+	now := time.Now()
+	jiffies := now.Sub(memoryOrigin) * 60 / time.Second
+	switch addr {
+	case addrRandom:
+		return byte(rand.Intn(256)), nil
+	case addrSecond:
+		return byte(now.Second()), nil
+	case addrMinute:
+		return byte(now.Minute()), nil
+	case addrHour:
+		return byte(now.Hour()), nil
+	case addrJiffies:
+		return byte(jiffies), nil
+	case addrJiffyHi:
+		return byte(jiffies >> 8), nil
+	}
+	return memory[addr], nil
+}
+
+// Poke implements POKE addr, value.
+func Poke(addrVal, val Value) error {
+	if !addrVal.IsNumber() {
+		return fmt.Errorf("POKE address must be a number")
+	}
+	if !val.IsNumber() {
+		return fmt.Errorf("POKE value must be a number")
+	}
+	addr, value := int(addrVal.num), int(val.num)
+	if addr < 0 || addr >= memorySize {
+		return fmt.Errorf("POKE: address %d out of range 0-%d", addr, memorySize-1)
+	}
+	if value < 0 || value > 255 {
+		return fmt.Errorf("POKE: value %d out of range 0-255", value)
+	}
+	if addr >= addrRandom && addr <= addrJiffyHi {
+		return nil
+	}
+	memory[addr] = byte(value)
+	return nil
+}
@@ -0,0 +1,124 @@
+package basicrt
+
+import (
+	"fmt"
+	"math"
+)
+
+// Infix applies the binary operator op.
+func (e *Env) Infix(op string, left, right Value) (Value, error) {
+	if left.IsNumber() && right.IsNumber() {
+		switch op {
+		case "+":
+			return NumVal(left.num + right.num), nil
+		case "-":
+			return NumVal(left.num - right.num), nil
+		case "*":
+			return NumVal(left.num * right.num), nil
+		case "/":
+			if right.num == 0 {
+				return Value{}, fmt.Errorf("division by zero")
+			}
+			return NumVal(left.num / right.num), nil
+		case "MOD":
+			return NumVal(math.Mod(left.num, right.num)), nil
+		case "<":
+			return e.Bool(left.num < right.num), nil
+		case ">":
+			return e.Bool(left.num > right.num), nil
+		case "<=":
+			return e.Bool(left.num <= right.num), nil
+		case ">=":
+			return e.Bool(left.num >= right.num), nil
+		case "==":
+			return e.Bool(left.num == right.num), nil
+		case "<>":
+			return e.Bool(left.num != right.num), nil
+		case "AND", "OR", "XOR", "EQV", "IMP":
+			return e.logical(op, left.num, right.num)
+		}
+	}
+
+	if left.kind == stringKind && right.kind == stringKind {
+		switch op {
+		case "+":
+			return StrVal(left.str + right.str), nil
+		case "==":
+			return e.Bool(left.str == right.str), nil
+		case "<>":
+			return e.Bool(left.str != right.str), nil
+		}
+	}
+
+	return Value{}, fmt.Errorf("unsupported operation: %s %s %s", left.Inspect(), op, right.Inspect())
+}
+
+// Prefix applies the unary operator op.
+func (e *Env) Prefix(op string, right Value) (Value, error) {
+	switch op {
+	case "-":
+		if !right.IsNumber() {
+			return Value{}, fmt.Errorf("cannot negate non-number")
+		}
+		return NumVal(-right.num), nil
+	case "NOT":
+		if right.IsNumber() && e.dialect.BitwiseLogic {
+			n, err := toInt16(right.num)
+			if err != nil {
+				return Value{}, err
+			}
+			return NumVal(float64(^n)), nil
+		}
+		return e.Bool(!Truthy(right)), nil
+	default:
+		return Value{}, fmt.Errorf("unknown operator: %s", op)
+	}
+}
+
+// logical applies AND, OR, XOR, EQV or IMP, to truth values or, in a
+// bitwise dialect, to 16-bit integers.
+func (e *Env) logical(op string, a, b float64) (Value, error) {
+	if !e.dialect.BitwiseLogic {
+		x, y := a != 0, b != 0
+		switch op {
+		case "AND":
+			return e.Bool(x && y), nil
+		case "OR":
+			return e.Bool(x || y), nil
+		case "XOR":
+			return e.Bool(x != y), nil
+		case "EQV":
+			return e.Bool(x == y), nil
+		default:
+			return e.Bool(!x || y), nil
+		}
+	}
+	x, err := toInt16(a)
+	if err != nil {
+		return Value{}, err
+	}
+	y, err := toInt16(b)
+	if err != nil {
+		return Value{}, err
+	}
+	switch op {
+	case "AND":
+		return NumVal(float64(x & y)), nil
+	case "OR":
+		return NumVal(float64(x | y)), nil
+	case "XOR":
+		return NumVal(float64(x ^ y)), nil
+	case "EQV":
+		return NumVal(float64(^(x ^ y))), nil
+	default:
+		return NumVal(float64(^x | y)), nil
+	}
+}
+
+func toInt16(v float64) (int16, error) {
+	r := math.Round(v)
+	if !(r >= math.MinInt16 && r <= math.MaxInt16) {
+		return 0, fmt.Errorf("Overflow")
+	}
+	return int16(r), nil
+}
@@ -0,0 +1,157 @@
+package basicrt
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var (
+	gwbasic   = Dialect{True: -1, BitwiseLogic: true}
+	dartmouth = Dialect{True: 1}
+)
+
+func TestInfix(t *testing.T) {
+	tests := []struct {
+		d           Dialect
+		left        Value
+		op          string
+		right, want Value
+	}{
+		{gwbasic, NumVal(7), "+", NumVal(2), NumVal(9)},
+		{gwbasic, NumVal(7), "-", NumVal(2), NumVal(5)},
+		{gwbasic, NumVal(7), "*", NumVal(2), NumVal(14)},
+		{gwbasic, NumVal(7), "/", NumVal(2), NumVal(3.5)},
+		{gwbasic, NumVal(7), "MOD", NumVal(2), NumVal(1)},
+		{gwbasic, NumVal(1), "<", NumVal(2), NumVal(-1)},
+		{dartmouth, NumVal(1), "<", NumVal(2), NumVal(1)},
+		{gwbasic, NumVal(2), "<=", NumVal(1), NumVal(0)},
+		{gwbasic, NumVal(2), "==", NumVal(2), NumVal(-1)},
+		{gwbasic, StrVal("AB"), "+", StrVal("C"), StrVal("ABC")},
+		{gwbasic, StrVal("A"), "<>", StrVal("B"), NumVal(-1)},
+		{gwbasic, NumVal(12), "AND", NumVal(10), NumVal(8)},
+		{gwbasic, NumVal(12), "OR", NumVal(10), NumVal(14)},
+		{gwbasic, NumVal(12), "XOR", NumVal(10), NumVal(6)},
+		{gwbasic, NumVal(0), "EQV", NumVal(0), NumVal(-1)},
+		{gwbasic, NumVal(0), "IMP", NumVal(5), NumVal(-1)},
+		{dartmouth, NumVal(12), "AND", NumVal(10), NumVal(1)},
+		{dartmouth, NumVal(12), "XOR", NumVal(10), NumVal(0)},
+		{dartmouth, NumVal(1), "IMP", NumVal(0), NumVal(0)},
+	}
+	for _, tt := range tests {
+		e := NewEnv(tt.d, strings.NewReader(""), nil, nil)
+		got, err := e.Infix(tt.op, tt.left, tt.right)
+		if err != nil {
+			t.Errorf("%s %s %s: %v", tt.left.Inspect(), tt.op, tt.right.Inspect(), err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s %s %s = %s, want %s", tt.left.Inspect(), tt.op, tt.right.Inspect(), got.Inspect(), tt.want.Inspect())
+		}
+	}
+}
+
+func TestInfixErrors(t *testing.T) {
+	tests := []struct {
+		left  Value
+		op    string
+		right Value
+		want  string
+	}{
+		{NumVal(1), "/", NumVal(0), "division by zero"},
+		{StrVal("A"), "-", StrVal("B"), "unsupported operation: A - B"},
+		{StrVal("A"), "+", NumVal(1), "unsupported operation: A + 1"},
+		{NumVal(40000), "AND", NumVal(1), "Overflow"},
+		{NumVal(math.NaN()), "AND", NumVal(1), "Overflow"},
+		{NumVal(1), "XOR", NumVal(math.Inf(1)), "Overflow"},
+	}
+	e := NewEnv(gwbasic, strings.NewReader(""), nil, nil)
+	for _, tt := range tests {
+		_, err := e.Infix(tt.op, tt.left, tt.right)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s %s %s: error %v, want %q", tt.left.Inspect(), tt.op, tt.right.Inspect(), err, tt.want)
+		}
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	tests := []struct {
+		d           Dialect
+		op          string
+		right, want Value
+	}{
+		{gwbasic, "-", NumVal(3), NumVal(-3)},
+		{gwbasic, "NOT", NumVal(0), NumVal(-1)},
+		{gwbasic, "NOT", NumVal(5), NumVal(-6)},
+		{dartmouth, "NOT", NumVal(5), NumVal(0)},
+		{dartmouth, "NOT", StrVal(""), NumVal(1)},
+	}
+	for _, tt := range tests {
+		e := NewEnv(tt.d, strings.NewReader(""), nil, nil)
+		got, err := e.Prefix(tt.op, tt.right)
+		if err != nil || got != tt.want {
+			t.Errorf("%s %s = %s, %v, want %s", tt.op, tt.right.Inspect(), got.Inspect(), err, tt.want.Inspect())
+		}
+	}
+
+	e := NewEnv(gwbasic, strings.NewReader(""), nil, nil)
+	if _, err := e.Prefix("-", StrVal("A")); err == nil {
+		t.Error("-\"A\" gave no error")
+	}
+	if _, err := e.Prefix("NOT", NumVal(math.NaN())); err == nil || err.Error() != "Overflow" {
+		t.Errorf("NOT NaN: error %v, want Overflow", err)
+	}
+}
+
+func TestForLoops(t *testing.T) {
+	loops := []*ForLoop{{Var: "I"}, {Var: "J"}, {Var: "K"}}
+	if got := FindForLoop(loops, "J"); got != 1 {
+		t.Errorf("J is loop %d, want 1", got)
+	}
+	if got := FindForLoop(loops, "X"); got != -1 {
+		t.Errorf("X is loop %d, want -1", got)
+	}
+	if got := DropForLoop(loops, "J"); len(got) != 1 || got[0].Var != "I" {
+		t.Errorf("dropping J left %d loops, want only I", len(got))
+	}
+	if got := DropForLoop(loops, "X"); len(got) != 3 {
+		t.Errorf("dropping X left %d loops, want 3", len(got))
+	}
+
+	for _, tt := range []struct {
+		value, end, step float64
+		want             bool
+	}{
+		{1, 3, 1, true},
+		{3, 3, 1, true},
+		{4, 3, 1, false},
+		{3, 1, -1, true},
+		{0, 1, -1, false},
+	} {
+		if got := LoopContinues(tt.value, tt.end, tt.step); got != tt.want {
+			t.Errorf("LoopContinues(%g, %g, %g) = %v", tt.value, tt.end, tt.step, got)
+		}
+	}
+}
+
+func TestFixAndRoundGiveNoNegativeZero(t *testing.T) {
+	tests := []struct {
+		name string
+		args []Value
+		want float64
+	}{
+		{"FIX", []Value{NumVal(-0.5)}, 0},
+		{"FIX", []Value{NumVal(-1.5)}, -1},
+		{"ROUND", []Value{NumVal(-0.4)}, 0},
+		{"ROUND", []Value{NumVal(-0.04), NumVal(1)}, 0},
+	}
+	for _, tt := range tests {
+		got, err := CallBuiltin(tt.name, tt.args)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got.num != tt.want || math.Signbit(got.num) != math.Signbit(tt.want) {
+			t.Errorf("%s(%s) = %s, want %g", tt.name, tt.args[0].Inspect(), got.Inspect(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package basicrt
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CLS, LOCATE and COLOR, which like the interpreter's only write escape
+// sequences to a terminal.
+
+var ansiColors = [8]int{0, 4, 2, 6, 1, 5, 3, 7}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Cls implements CLS.
+func (e *Env) Cls() {
+	if isTerminal(e.Stdout) {
+		fmt.Fprint(e.Stdout, "\x1b[2J\x1b[H")
+	}
+}
+
+func screenArg(v *Value, what string, min, max int) (int, bool, error) {
+	if v == nil {
+		return 0, false, nil
+	}
+	if !v.IsNumber() {
+		return 0, false, fmt.Errorf("%s must be a number", what)
+	}
+	n := int(v.num)
+	if n < min || n > max {
+		return 0, false, fmt.Errorf("%s %d out of range %d-%d", what, n, min, max)
+	}
+	return n, true, nil
+}
+
+// Locate implements LOCATE; a nil row or column is left as it is.
+func (e *Env) Locate(rowVal, colVal *Value) error {
+	row, hasRow, err := screenArg(rowVal, "LOCATE row", 1, 1<<15)
+	if err != nil {
+		return err
+	}
+	col, hasCol, err := screenArg(colVal, "LOCATE column", 1, 1<<15)
+	if err != nil {
+		return err
+	}
+	if !isTerminal(e.Stdout) {
+		return nil
+	}
+	switch {
+	case hasRow && hasCol:
+		fmt.Fprintf(e.Stdout, "\x1b[%d;%dH", row, col)
+	case hasRow:
+		fmt.Fprintf(e.Stdout, "\x1b[%dd", row)
+	case hasCol:
+		fmt.Fprintf(e.Stdout, "\x1b[%dG", col)
+	}
+	return nil
+}
+
+func ansiColor(c, base, brightBase int) int {
+	if c >= 8 {
+		return brightBase + ansiColors[c-8]
+	}
+	return base + ansiColors[c]
+}
+
+// Color implements COLOR; a nil colour is left as it is.
+func (e *Env) Color(fgVal, bgVal *Value) error {
+	fg, hasFg, err := screenArg(fgVal, "COLOR foreground", 0, 15)
+	if err != nil {
+		return err
+	}
+	bg, hasBg, err := screenArg(bgVal, "COLOR background", 0, 15)
+	if err != nil {
+		return err
+	}
+	if !isTerminal(e.Stdout) {
+		return nil
+	}
+	if hasFg {
+		fmt.Fprintf(e.Stdout, "\x1b[%dm", ansiColor(fg, 30, 90))
+	}
+	if hasBg {
+		fmt.Fprintf(e.Stdout, "\x1b[%dm", ansiColor(bg, 40, 100))
+	}
+	return nil
+}
@@ -0,0 +1,9 @@
+package basicrt
+
+import "embed"
+
+// Source holds this package's Go files, so that basic compile -build can
+// build a program outside this module.
+//
+//go:embed *.go
+var Source embed.FS
@@ -0,0 +1,131 @@
+package basicrt
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+)
+
+// Shell implements SHELL; an empty command starts an interactive shell.
+func (e *Env) Shell(command Value) error {
+	if command.IsNumber() {
+		return fmt.Errorf("SHELL command must be a string")
+	}
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "windows" && command.str == "":
+		cmd = exec.Command("cmd")
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("cmd", "/C", command.str)
+	case command.str == "":
+		sh := os.Getenv("SHELL")
+		if sh == "" {
+			sh = "/bin/sh"
+		}
+		cmd = exec.Command(sh)
+	default:
+		cmd = exec.Command("/bin/sh", "-c", command.str)
+	}
+	cmd.Stdin = e.Stdin
+	cmd.Stdout = e.Stdout
+	cmd.Stderr = e.Stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); !ok {
+			return fmt.Errorf("SHELL: %v", err)
+		}
+	}
+	return nil
+}
+
+func stringArg(v Value, what string) (string, error) {
+	if v.IsNumber() {
+		return "", fmt.Errorf("%s must be a string", what)
+	}
+	return v.str, nil
+}
+
+// Files implements FILES, listing the files matching pattern, or all of
+// them when it is nil.
+func (e *Env) Files(patternVal *Value) error {
+	pattern := "*"
+	if patternVal != nil {
+		p, err := stringArg(*patternVal, "FILES pattern")
+		if err != nil {
+			return err
+		}
+		pattern = p
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("FILES: %v", err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("File not found")
+	}
+	sort.Strings(matches)
+	for _, name := range matches {
+		if info, err := os.Stat(name); err == nil && info.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintln(e.Stdout, name)
+	}
+	return nil
+}
+
+// Kill implements KILL, deleting the files matching a pattern.
+func Kill(patternVal Value) error {
+	pattern, err := stringArg(patternVal, "KILL file name")
+	if err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fmt.Errorf("KILL: %v", err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("File not found")
+	}
+	for _, name := range matches {
+		if err := os.Remove(name); err != nil {
+			return fmt.Errorf("KILL: %v", err)
+		}
+	}
+	return nil
+}
+
+// Rename implements NAME old AS new.
+func Rename(fromVal, toVal Value) error {
+	from, err := stringArg(fromVal, "NAME file name")
+	if err != nil {
+		return err
+	}
+	to, err := stringArg(toVal, "NAME file name")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(from); err != nil {
+		return fmt.Errorf("File not found")
+	}
+	if _, err := os.Stat(to); err == nil {
+		return fmt.Errorf("File already exists")
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fmt.Errorf("NAME: %v", err)
+	}
+	return nil
+}
+
+// Chdir implements CHDIR.
+func Chdir(dirVal Value) error {
+	dir, err := stringArg(dirVal, "CHDIR directory")
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("Path not found")
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package basicrt is the runtime of the Go programs package compiler
+// writes. A generated program holds only its own lines, as a switch over
+// them, and calls on this package for its values and variables, the
+// operators, the built-in functions and any statement that takes more
+// than a line or two of Go. Error messages match the interpreter's.
+package basicrt
+
+import (
+	"fmt"
+)
+
+type valueKind int
+
+const (
+	numberKind valueKind = iota
+	stringKind
+)
+
+// Value is a BASIC value, a number or a string.
+type Value struct {
+	kind valueKind
+	num  float64
+	str  string
+}
+
+// NumVal returns the number v as a Value.
+func NumVal(v float64) Value { return Value{kind: numberKind, num: v} }
+
+// StrVal returns the string v as a Value.
+func StrVal(v string) Value { return Value{kind: stringKind, str: v} }
+
+// IsNumber reports whether v is a number rather than a string.
+func (v Value) IsNumber() bool { return v.kind == numberKind }
+
+// Number returns v if it is a number, and 0 for a string.
+func (v Value) Number() float64 { return v.num }
+
+// Inspect returns v as PRINT shows it.
+func (v Value) Inspect() string {
+	if v.kind == numberKind {
+		return fmt.Sprintf("%g", v.num)
+	}
+	return v.str
+}
+
+// MustNumber returns v if it is a number, or an error for a string.
+func MustNumber(v Value) (float64, error) {
+	if !v.IsNumber() {
+		return 0, fmt.Errorf("expected number")
+	}
+	return v.num, nil
+}
+
+// Truthy decides conditions: a number other than 0, or a string other than
+// "", is true.
+func Truthy(v Value) bool {
+	if v.kind == numberKind {
+		return v.num != 0
+	}
+	return v.str != ""
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// benchPrograms are the workloads basic bench times when it is given no
+// programs of its own: a sieve, a bubble sort, string building and nested
+// FOR loops, each printing a line to show it ran to the end.
+//
+//go:embed bench/*.bas
+var benchPrograms embed.FS
+
+// benchEngines are what basic bench can time a program on: the evaluator,
+// the bytecode machine and the program compiled to an executable.
+var benchEngines = []string{"tree", "vm", "go"}
+
+// benchCommand times each program on each engine and prints a table of the
+// fastest of -count runs, so that the figures of two releases can be set
+// side by side. A program is built once, before its compiled runs are
+// timed; the interpreted figures include reading and parsing it, as a run
+// does.
+func benchCommand(fs *flag.FlagSet) func(args []string) {
+	count := fs.Int("count", 3, "time each program this many times on each engine and report the fastest")
+	engines := fs.String("engines", strings.Join(benchEngines, ","), "the engines to time, of "+strings.Join(benchEngines, ", "))
+	limit := fs.Duration("timeout", time.Minute, "give up on a run longer than this")
+	return func(args []string) {
+		programs := parseInterleaved(fs, args)
+		chosen := strings.Split(*engines, ",")
+		for _, name := range chosen {
+			if !isBenchEngine(name) {
+				fmt.Fprintf(os.Stderr, "unknown engine %q: use %s\n", name, strings.Join(benchEngines, ", "))
+				os.Exit(exitUsage)
+			}
+		}
+		if *count < 1 {
+			fmt.Fprintln(os.Stderr, "-count must be at least 1")
+			os.Exit(exitUsage)
+		}
+		runBenchmarks(programs, chosen, *count, *limit)
+	}
+}
+
+func isBenchEngine(name string) bool {
+	for _, engine := range benchEngines {
+		if name == engine {
+			return true
+		}
+	}
+	return false
+}
+
+func runBenchmarks(programs, engines []string, count int, limit time.Duration) {
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFileError)
+	}
+	dir, err := os.MkdirTemp("", "basic-bench-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFileError)
+	}
+	if len(programs) == 0 {
+		if programs, err = writeBenchPrograms(dir); err != nil {
+			os.RemoveAll(dir)
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFileError)
+		}
+	}
+
+	fmt.Printf("%-12s", "program")
+	for _, engine := range engines {
+		fmt.Printf(" %12s", engine)
+	}
+	fmt.Println()
+	// Why runs failed is said after the table, to keep it whole.
+	var failures []string
+	for i, prog := range programs {
+		fmt.Printf("%-12s", strings.TrimSuffix(filepath.Base(prog), filepath.Ext(prog)))
+		for _, engine := range engines {
+			elapsed, err := benchmark(self, prog, engine, filepath.Join(dir, executableName(fmt.Sprintf("prog%d.bas", i))), count, limit)
+			if err != nil {
+				fmt.Printf(" %12s", "failed")
+				failures = append(failures, fmt.Sprintf("%s on %s: %v", prog, engine, err))
+				continue
+			}
+			fmt.Printf(" %12v", elapsed.Round(time.Microsecond*100))
+		}
+		fmt.Println()
+	}
+	os.RemoveAll(dir)
+	for _, failure := range failures {
+		fmt.Fprintln(os.Stderr, failure)
+	}
+	if len(failures) > 0 {
+		os.Exit(exitRuntimeError)
+	}
+}
+
+// writeBenchPrograms writes benchPrograms into dir and returns their paths.
+func writeBenchPrograms(dir string) ([]string, error) {
+	names, err := benchPrograms.ReadDir("bench")
+	if err != nil {
+		return nil, err
+	}
+	var programs []string
+	for _, entry := range names {
+		data, err := benchPrograms.ReadFile("bench/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		prog := filepath.Join(dir, entry.Name())
+		if err := os.WriteFile(prog, data, 0o644); err != nil {
+			return nil, err
+		}
+		programs = append(programs, prog)
+	}
+	return programs, nil
+}
+
+// benchmark returns the fastest of count runs of prog on engine, building
+// it into the executable exe first for go, which is not timed. A run fails
+// if it exits with a status other than 0.
+func benchmark(self, prog, engine, exe string, count int, limit time.Duration) (time.Duration, error) {
+	name, args := self, append(append([]string{"run", "-engine=" + engine}, dialectArgs()...), prog)
+	if engine == "go" {
+		if err := compileExecutable(self, prog, exe); err != nil {
+			return 0, err
+		}
+		name, args = exe, nil
+	}
+
+	var fastest time.Duration
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		_, status, err := runWithInput(limit, nil, name, args...)
+		elapsed := time.Since(start)
+		if err != nil {
+			return 0, err
+		}
+		if status != 0 {
+			return 0, fmt.Errorf("exit status %d", status)
+		}
+		if i == 0 || elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return fastest, nil
+}
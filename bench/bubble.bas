@@ -0,0 +1,21 @@
+10 REM Bubble sort 1000 pseudo-random numbers from a fixed seed
+20 LET N = 1000
+30 DIM A(1000)
+40 LET S = 12345
+50 FOR I = 1 TO N
+60 LET S = (S * 1103 + 12345) MOD 65536
+70 LET A(I) = S
+80 NEXT I
+90 FOR I = 1 TO N - 1
+100 FOR J = 1 TO N - I
+110 IF A(J) <= A(J + 1) THEN GOTO 150
+120 LET T = A(J)
+130 LET A(J) = A(J + 1)
+140 LET A(J + 1) = T
+150 NEXT J
+160 NEXT I
+170 FOR I = 1 TO N - 1
+180 IF A(I) > A(I + 1) THEN PRINT "not sorted at "; I: END
+190 NEXT I
+200 PRINT "sorted "; N; " numbers from "; A(1); " to "; A(N)
+210 END
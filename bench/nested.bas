@@ -0,0 +1,11 @@
+10 REM Nested FOR loops doing arithmetic in the innermost
+20 LET T = 0
+30 FOR I = 1 TO 100
+40 FOR J = 1 TO 100
+50 FOR K = 1 TO 200
+60 LET T = T + I * J - K
+70 NEXT K
+80 NEXT J
+90 NEXT I
+100 PRINT "total "; T
+110 END
@@ -0,0 +1,18 @@
+10 REM Sieve of Eratosthenes, counting the primes up to 20000 five times over
+20 LET N = 20000
+30 DIM F(20000)
+40 FOR R = 1 TO 5
+50 LET C = 0
+60 FOR I = 2 TO N
+70 LET F(I) = 1
+80 NEXT I
+90 FOR I = 2 TO N
+100 IF F(I) == 0 THEN GOTO 150
+110 LET C = C + 1
+120 FOR J = I + I TO N STEP I
+130 LET F(J) = 0
+140 NEXT J
+150 NEXT I
+160 NEXT R
+170 PRINT C; " primes up to "; N
+180 END
@@ -0,0 +1,14 @@
+10 REM Build strings a piece at a time and compare them
+20 LET M = 0
+30 FOR R = 1 TO 2000
+40 LET S$ = ""
+50 FOR I = 1 TO 100
+60 LET S$ = S$ + "x"
+70 NEXT I
+80 LET U$ = UCASE$(S$)
+90 IF LCASE$(U$) == S$ THEN LET M = M + 1
+100 LET T$ = TRIM$("  " + U$ + "  ")
+110 IF T$ <> U$ THEN PRINT "TRIM$ failed": END
+120 NEXT R
+130 PRINT M; " of 2000 matched"
+140 END
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/basis-ex/basicrt"
+	"github.com/basis-ex/compiler"
+	"github.com/basis-ex/intrinsic"
+)
+
+// runtimeSources are the packages, by directory in this module, that a
+// compiled program needs to build, each with its embedded Go files. Their
+// tests are left out.
+var runtimeSources = map[string]embed.FS{
+	"basicrt":   basicrt.Source,
+	"intrinsic": intrinsic.Source,
+}
+
+// executableName is the name compile -build gives the executable when -o
+// does not: the program's file name without .bas, with .exe for Windows.
+func executableName(filename string) string {
+	name := "basic_out"
+	if filename != "-" {
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	goos := os.Getenv("GOOS")
+	if goos == "" {
+		goos = runtime.GOOS
+	}
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// buildExecutable builds the Go source of a compiled program into the
+// executable output with the Go toolchain. It builds in a temporary module
+// holding a copy of the runtime, so it works from any directory, and the
+// environment, GOOS and GOARCH included, is passed on to go build, which
+// cross-compiles as it would for any other program. env is added to it.
+func buildExecutable(code, output string, env ...string) error {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("building needs the Go toolchain: %v", err)
+	}
+	output, err = filepath.Abs(output)
+	if err != nil {
+		return err
+	}
+
+	dir, err := os.MkdirTemp("", "basic-build-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string][]byte{
+		"go.mod":       []byte(fmt.Sprintf("module %s\n\ngo 1.21\n", path.Dir(compiler.RuntimePackage))),
+		"main/main.go": []byte(code),
+	}
+	for pkg, src := range runtimeSources {
+		names, err := fs.Glob(src, "*.go")
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if strings.HasSuffix(name, "_test.go") {
+				continue
+			}
+			data, err := src.ReadFile(name)
+			if err != nil {
+				return err
+			}
+			files[pkg+"/"+name] = data
+		}
+	}
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command(goTool, "build", "-o", output, "./main")
+	cmd.Dir = dir
+	cmd.Env = append(append(os.Environ(), "GOWORK=off"), env...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go build: %v", err)
+	}
+	return nil
+}
+
+// wasmPage is the page that runs a program compiled for the browser, with
+// the JS shim that gives it a terminal.
+//
+//go:embed wasm.html
+var wasmPage string
+
+var wasmTemplate = template.Must(template.New("wasm").Parse(wasmPage))
+
+// wasmDirName is the directory compile -target wasm writes to when -o does
+// not name one: the program's file name without .bas, and _wasm.
+func wasmDirName(filename string) string {
+	name := "basic_out"
+	if filename != "-" {
+		name = strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename))
+	}
+	return name + "_wasm"
+}
+
+// buildWasm builds the Go source of a compiled program for the browser into
+// the directory dir: name.wasm, the WebAssembly module, wasm_exec.js, the
+// Go toolchain's loader for it, and index.html, which runs it with PRINT
+// written to the page and INPUT read with a prompt.
+func buildWasm(code, dir, name string) error {
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		return fmt.Errorf("building needs the Go toolchain: %v", err)
+	}
+	out, err := exec.Command(goTool, "env", "GOROOT").Output()
+	if err != nil {
+		return fmt.Errorf("go env GOROOT: %v", err)
+	}
+	goroot := strings.TrimSpace(string(out))
+	// Go 1.24 moved wasm_exec.js from misc/wasm to lib/wasm.
+	var loader []byte
+	for _, sub := range []string{"lib", "misc"} {
+		if loader, err = os.ReadFile(filepath.Join(goroot, sub, "wasm", "wasm_exec.js")); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("wasm_exec.js not found in %s", goroot)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	module := name + ".wasm"
+	if err := buildExecutable(code, filepath.Join(dir, module), "GOOS=js", "GOARCH=wasm"); err != nil {
+		return err
+	}
+	var page bytes.Buffer
+	if err := wasmTemplate.Execute(&page, struct{ Name, Module string }{name, module}); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "wasm_exec.js"), loader, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "index.html"), page.Bytes(), 0644)
+}
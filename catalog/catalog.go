@@ -0,0 +1,151 @@
+// Package catalog describes the statements, functions, operators and REPL
+// commands the interpreter supports. The REPL's HELP command prints it,
+// and other tools can use it for completion or hover text.
+package catalog
+
+import (
+	"sort"
+	"strings"
+)
+
+// Kind says what sort of thing an entry documents.
+type Kind string
+
+const (
+	Statement Kind = "statement"
+	Function  Kind = "function"
+	Operator  Kind = "operator"
+	Command   Kind = "command"
+)
+
+// Kinds lists the kinds in the order HELP shows them.
+var Kinds = []Kind{Statement, Function, Operator, Command}
+
+// Entry documents one keyword.
+type Entry struct {
+	Name    string
+	Kind    Kind
+	Syntax  string
+	Summary string
+}
+
+// Entries is the catalog, grouped by kind.
+var Entries = []Entry{
+	{"PRINT", Statement, `PRINT expr [; expr | , expr]...`, "Print values. A semicolon joins items, a comma moves to the next print zone, or prints a tab in the standard dialect, and a trailing separator suppresses the newline."},
+	{"LET", Statement, `LET var = expr`, "Assign a value to a variable. LET may be left out in the dialects where = compares."},
+	{"IF", Statement, `IF cond THEN stmt|line [ELSE stmt|line]`, "Run a statement, or jump to a line, depending on a condition."},
+	{"GOTO", Statement, `GOTO line|label`, "Jump to a line number or label."},
+	{"GOSUB", Statement, `GOSUB line|label`, "Call a subroutine; RETURN comes back to the statement after the GOSUB."},
+	{"RETURN", Statement, `RETURN`, "Return from the most recent GOSUB."},
+	{"FOR", Statement, `FOR var = start TO end [STEP step]`, "Start a counted loop that runs up to the matching NEXT."},
+	{"NEXT", Statement, `NEXT [var]`, "End a FOR loop, stepping its variable and looping while it has not passed the end."},
+	{"INPUT", Statement, `INPUT ["prompt" (;|,)] var [, var]...`, `Read a line of comma-separated values. A prompt followed by ";" or no prompt at all prints "? ". A numeric variable given text asks again with "?Redo from start".`},
+	{"DIM", Statement, `DIM name(size)`, "Declare an array."},
+	{"DATA", Statement, `DATA value [, value]...`, "Hold constants for READ."},
+	{"READ", Statement, `READ var [, var]...`, "Assign the next DATA values to variables."},
+	{"RESTORE", Statement, `RESTORE [line]`, "Read DATA again from the start, or from the first item at or after a line."},
+	{"REM", Statement, `REM comment`, "A comment; the rest of the line is ignored."},
+	{"END", Statement, `END [status]`, "Stop the program, optionally setting the exit status (0-255) reported to the shell."},
+	{"SYSTEM", Statement, `SYSTEM [status]`, "Stop the program like END; typed at the prompt it leaves the interpreter."},
+	{"SUB", Statement, `SUB name(params) ... END SUB`, "Define a procedure with local variables, called with CALL."},
+	{"CALL", Statement, `CALL name(args) | CALL HOST "event" [, arg]...`, "Call a SUB. Plain variables are passed by reference. CALL HOST sends an event to the program embedding the interpreter."},
+	{"DUMP", Statement, `DUMP`, "Print all variables, arrays, FOR loops and the GOSUB stack."},
+	{"POKE", Statement, `POKE addr, value`, "Write a byte to the simulated 64KB memory."},
+	{"OPEN", Statement, `OPEN file AS #n [LEN = size]`, "Open a random-access file of fixed-length records (128 bytes unless LEN is given)."},
+	{"CLOSE", Statement, `CLOSE [#n [, #n]...]`, "Close the given files, or all of them."},
+	{"FIELD", Statement, `FIELD #n, width AS var$ [, width AS var$]...`, "Divide a file's record buffer into string variables."},
+	{"GET", Statement, `GET #n [, record]`, "Read a record into the file's FIELD variables."},
+	{"PUT", Statement, `PUT #n [, record]`, "Write the record buffer to the file."},
+	{"LSET", Statement, `LSET var$ = expr`, "Store a string left-justified in a FIELD variable."},
+	{"RSET", Statement, `RSET var$ = expr`, "Store a string right-justified in a FIELD variable."},
+	{"FILES", Statement, `FILES ["pattern"]`, "List files matching a wildcard pattern."},
+	{"KILL", Statement, `KILL "file"`, "Delete files; wildcards are allowed."},
+	{"NAME", Statement, `NAME "old" AS "new"`, "Rename a file."},
+	{"CHDIR", Statement, `CHDIR "dir"`, "Change the current directory."},
+	{"CLS", Statement, `CLS`, "Clear the screen."},
+	{"LOCATE", Statement, `LOCATE [row] [, col]`, "Move the cursor."},
+	{"COLOR", Statement, `COLOR [fg] [, bg]`, "Set the text colours, 0-15 from the GW-BASIC palette."},
+	{"SCREEN", Statement, `SCREEN mode | SCREEN width, height`, "Start a graphics screen: 1 is 320x200, 2 is 640x200, 0 puts it away."},
+	{"PLOT", Statement, `PLOT x, y [, color]`, "Set a pixel of the graphics screen, white unless given a colour 0-15."},
+	{"LINE", Statement, `LINE (x1, y1)-(x2, y2) [, color]`, "Draw a line on the graphics screen."},
+	{"CIRCLE", Statement, `CIRCLE (x, y), radius [, color]`, "Draw a circle on the graphics screen."},
+	{"SCREENSAVE", Statement, `SCREENSAVE "file"`, "Save the graphics screen as a .png or .svg picture."},
+	{"SLEEP", Statement, `SLEEP seconds`, "Pause for a number of seconds; Ctrl-C cuts the pause short."},
+	{"SHELL", Statement, `SHELL ["command"]`, "Run an operating-system command, or an interactive shell."},
+	{"ON", Statement, `ON TIMER(seconds) GOSUB line`, "Name a subroutine to call every so many seconds once TIMER ON is given."},
+	{"TIMER", Statement, `TIMER ON | OFF | STOP`, "Start, stop or pause ON TIMER events. As a function, TIMER is the seconds since midnight."},
+
+	{"UCASE$", Function, `UCASE$(s$)`, "s$ in upper case."},
+	{"LCASE$", Function, `LCASE$(s$)`, "s$ in lower case."},
+	{"LTRIM$", Function, `LTRIM$(s$)`, "s$ without leading spaces."},
+	{"RTRIM$", Function, `RTRIM$(s$)`, "s$ without trailing spaces."},
+	{"TRIM$", Function, `TRIM$(s$)`, "s$ without leading or trailing spaces."},
+	{"ENVIRON$", Function, `ENVIRON$("NAME") | ENVIRON$(n)`, "An environment variable, or the nth NAME=value entry."},
+	{"COMMAND$", Function, `COMMAND$ | COMMAND$(n)`, "The arguments given after the program file, or the nth of them."},
+	{"PEEK", Function, `PEEK(addr)`, "Read a byte of the simulated memory."},
+	{"LOF", Function, `LOF(n)`, "The length in bytes of open file n."},
+	{"INPUT$", Function, `INPUT$(n [, #f])`, "Read n keys without echo, or the next n bytes of open file f."},
+	{"ROUND", Function, `ROUND(x [, digits])`, "x rounded, halves away from zero, to a number of decimal places."},
+	{"FIX", Function, `FIX(x)`, "x truncated toward zero."},
+	{"MIN", Function, `MIN(a, b)`, "The smaller of a and b."},
+	{"MAX", Function, `MAX(a, b)`, "The larger of a and b."},
+	{"TRUE", Function, `TRUE`, "The value of a true comparison: 1, or -1 in the msbasic and c64 dialects."},
+	{"FALSE", Function, `FALSE`, "The value of a false comparison, 0."},
+
+	{"MOD", Operator, `a MOD b`, "The remainder of a divided by b."},
+	{"AND", Operator, `a AND b`, "True if both are true; bitwise in the msbasic and c64 dialects."},
+	{"OR", Operator, `a OR b`, "True if either is true; bitwise in the msbasic and c64 dialects."},
+	{"XOR", Operator, `a XOR b`, "True if exactly one is true; bitwise in the msbasic and c64 dialects."},
+	{"EQV", Operator, `a EQV b`, "True if both are true or both false; bitwise in the msbasic and c64 dialects."},
+	{"IMP", Operator, `a IMP b`, "False only if a is true and b is false; bitwise in the msbasic and c64 dialects."},
+	{"NOT", Operator, `NOT a`, "True if a is false; bitwise in the msbasic and c64 dialects."},
+
+	{"RUN", Command, `RUN`, "Run the program from the start with no variables set."},
+	{"LIST", Command, `LIST [range] [>file | >>file]`, "Show the program, or write it to a file."},
+	{"LLIST", Command, `LLIST [range]`, "Print the listing to the printer file (see SET PRINTER)."},
+	{"NEW", Command, `NEW`, "Clear the program and its variables."},
+	{"CLEAR", Command, `CLEAR`, "Clear the variables, keeping the program."},
+	{"LOAD", Command, `LOAD file`, "Load a program from disk."},
+	{"SAVE", Command, `SAVE file`, "Save the program to disk."},
+	{"DELETE", Command, `DELETE n | DELETE n-m`, "Delete a line or a range of lines."},
+	{"EDIT", Command, `EDIT n`, "Edit a line in place."},
+	{"FIND", Command, `FIND "text" [range]`, "List the lines containing text."},
+	{"CHANGE", Command, `CHANGE /old/new/ [range]`, "Replace text throughout the program."},
+	{"VERIFY", Command, `VERIFY [range | file]`, "Print each line's checksum: a Fletcher-16 of its bytes, with spaces and tabs outside strings left out, as four hex digits (b*256+a, where for each byte c, a = (a+c) mod 255, then b = (b+a) mod 255). Given a file of \"line checksum\" pairs, list only the lines that differ, are missing or are not in it."},
+	{"CONT", Command, `CONT`, "Continue a stopped program; CONTINUE does the same."},
+	{"CONTINUE", Command, `CONTINUE`, "Continue a stopped program."},
+	{"STEP", Command, `STEP`, "Run one statement of the stopped program and show the next."},
+	{"BREAK", Command, `BREAK [n | CLEAR [n]]`, "Set, list or clear breakpoints."},
+	{"WATCH", Command, `WATCH [var | CLEAR]`, "Stop when a variable changes; list or clear watches."},
+	{"SAVESTATE", Command, `SAVESTATE file`, "Save the stopped program with its variables, arrays, DATA pointer, GOSUB stack and place, to resume later."},
+	{"LOADSTATE", Command, `LOADSTATE file`, "Load a program saved with SAVESTATE, stopped where it was saved; CONT resumes it."},
+	{"VARS", Command, `VARS`, "List the variables, arrays and open files of the last run."},
+	{"WORKSPACE", Command, `WORKSPACE [n | LIST]`, "Switch between program slots."},
+	{"SET", Command, `SET [PAGE n | PAGE OFF | PRINTER file | PROMPT "text"]`, "Change or show settings."},
+	{"HELP", Command, `HELP [keyword]`, "List the keywords, or describe one."},
+	{"EXIT", Command, `EXIT`, "Leave the interpreter; QUIT does the same."},
+	{"QUIT", Command, `QUIT`, "Leave the interpreter."},
+}
+
+// Lookup finds the entry for name, in any case.
+func Lookup(name string) (Entry, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	for _, e := range Entries {
+		if e.Name == name {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Names returns the sorted names of the entries of the given kind.
+func Names(kind Kind) []string {
+	names := []string{}
+	for _, e := range Entries {
+		if e.Kind == kind {
+			names = append(names, e.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,174 @@
+// Package check finds mistakes in a parsed program that can be seen
+// without running it, so that they are reported before the program starts
+// rather than when, or if, it reaches them.
+package check
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// UndefinedTarget is a line number that the program jumps to, with GOTO,
+// GOSUB, THEN, ELSE or ON TIMER, but does not have.
+type UndefinedTarget struct {
+	Target int
+	// From lists the lines holding the jumps, in order.
+	From []int
+}
+
+func (u UndefinedTarget) String() string {
+	from := make([]string, len(u.From))
+	for i, line := range u.From {
+		from[i] = fmt.Sprint(line)
+	}
+	lines := "line"
+	if len(from) > 1 {
+		lines = "lines"
+	}
+	return fmt.Sprintf("undefined line %d, jumped to from %s %s", u.Target, lines, strings.Join(from, ", "))
+}
+
+// UndefinedTargets lists, by target, every jump in program to a line
+// number it does not have. Only jumps to a number written in the program
+// are checked; one to a label or a computed line is found when it runs.
+func UndefinedTargets(program *ast.Program) []UndefinedTarget {
+	from := make(map[int][]int)
+	add := func(line int, expr ast.Expression) {
+		lit, ok := expr.(*ast.NumberLiteral)
+		if !ok {
+			return
+		}
+		target := int(lit.Value)
+		if _, ok := program.Statements[target]; ok {
+			return
+		}
+		if refs := from[target]; len(refs) == 0 || refs[len(refs)-1] != line {
+			from[target] = append(refs, line)
+		}
+	}
+	for _, line := range sortedLines(program) {
+		ast.Inspect(program.Statements[line], func(node ast.Node) bool {
+			switch s := node.(type) {
+			case *ast.GotoStatement:
+				add(line, s.LineNumber)
+			case *ast.GosubStatement:
+				add(line, s.LineNumber)
+			case *ast.OnTimerStatement:
+				add(line, s.Target)
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+	}
+
+	undefined := make([]UndefinedTarget, 0, len(from))
+	for target, lines := range from {
+		undefined = append(undefined, UndefinedTarget{Target: target, From: lines})
+	}
+	sort.Slice(undefined, func(i, j int) bool { return undefined[i].Target < undefined[j].Target })
+	return undefined
+}
+
+func sortedLines(program *ast.Program) []int {
+	lines := make([]int, 0, len(program.Statements))
+	for line := range program.Statements {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// UnmatchedNexts lists, in line order, the NEXT statements in program
+// that no FOR could have started: a NEXT on a variable no FOR in the
+// program counts with, or a NEXT without one in a program with no FOR at
+// all. Whichever way the program gets there, each stops with NEXT without
+// FOR.
+func UnmatchedNexts(program *ast.Program) []Problem {
+	counters := make(map[string]bool)
+	loops := false
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(*ast.ForStatement); ok {
+			counters[stmt.Variable.Value] = true
+			loops = true
+		}
+		return true
+	})
+
+	var problems []Problem
+	for _, line := range sortedLines(program) {
+		ast.Inspect(program.Statements[line], func(node ast.Node) bool {
+			stmt, ok := node.(*ast.NextStatement)
+			switch {
+			case !ok:
+			case stmt.Variable == nil && !loops:
+				problems = append(problems, Problem{Line: line, Message: "NEXT without FOR"})
+			case stmt.Variable != nil && !counters[stmt.Variable.Value]:
+				name := stmt.Variable.Value
+				problems = append(problems, Problem{Line: line, Message: fmt.Sprintf("NEXT %s without FOR %s", name, name)})
+			}
+			_, ok = node.(ast.Statement)
+			return ok
+		})
+	}
+	return problems
+}
+
+// UndefinedLabels lists, in line order, the GOTO, GOSUB and ON TIMER
+// jumps in program to a name that is not a label. Such a name is taken as
+// a variable holding the line to jump to, so only one that appears
+// nowhere else in the program, and so can only ever be 0, is listed.
+func UndefinedLabels(program *ast.Program) []Problem {
+	type jump struct {
+		line    int
+		keyword string
+		name    string
+	}
+	var jumps []jump
+	targets := make(map[*ast.Identifier]bool)
+	for _, line := range sortedLines(program) {
+		add := func(keyword string, expr ast.Expression) {
+			ident, ok := expr.(*ast.Identifier)
+			if !ok {
+				return
+			}
+			if _, ok := program.Labels[ident.Value]; ok {
+				return
+			}
+			jumps = append(jumps, jump{line, keyword, ident.Value})
+			targets[ident] = true
+		}
+		ast.Inspect(program.Statements[line], func(node ast.Node) bool {
+			switch s := node.(type) {
+			case *ast.GotoStatement:
+				add("GOTO", s.LineNumber)
+			case *ast.GosubStatement:
+				add("GOSUB", s.LineNumber)
+			case *ast.OnTimerStatement:
+				add("ON TIMER GOSUB", s.Target)
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+	}
+	if len(jumps) == 0 {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	ast.Inspect(program, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && !targets[ident] {
+			used[ident.Value] = true
+		}
+		return true
+	})
+	var problems []Problem
+	for _, j := range jumps {
+		if !used[j.name] {
+			problems = append(problems, Problem{Line: j.line, Message: fmt.Sprintf("%s %s: no such label", j.keyword, j.name)})
+		}
+	}
+	return problems
+}
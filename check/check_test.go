@@ -0,0 +1,90 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+// parse parses src, failing the test on a syntax error.
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse %q: %s", src, strings.Join(errs, "; "))
+	}
+	return program
+}
+
+func TestUndefinedTargets(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      []string
+	}{
+		{
+			name: "every target defined",
+			src:  "10 GOSUB 40\n20 IF X < 1 THEN 10 ELSE 30\n30 END\n40 ON TIMER(1) GOSUB 50: RETURN\n50 GOTO 30\n",
+		},
+		{
+			name: "GOTO",
+			src:  "10 GOTO 99\n",
+			want: []string{"undefined line 99, jumped to from line 10"},
+		},
+		{
+			name: "GOSUB",
+			src:  "10 GOSUB 99\n20 END\n",
+			want: []string{"undefined line 99, jumped to from line 10"},
+		},
+		{
+			name: "THEN and ELSE",
+			src:  "10 IF X < 1 THEN 98 ELSE 99\n",
+			want: []string{
+				"undefined line 98, jumped to from line 10",
+				"undefined line 99, jumped to from line 10",
+			},
+		},
+		{
+			name: "THEN GOTO",
+			src:  "10 IF X < 1 THEN GOTO 99\n",
+			want: []string{"undefined line 99, jumped to from line 10"},
+		},
+		{
+			name: "ON TIMER",
+			src:  "10 ON TIMER(1) GOSUB 99\n",
+			want: []string{"undefined line 99, jumped to from line 10"},
+		},
+		{
+			name: "one target from several lines, each listed once",
+			src:  "10 GOTO 99: GOSUB 99\n20 GOTO 99\n30 GOTO 5\n",
+			want: []string{
+				"undefined line 5, jumped to from line 30",
+				"undefined line 99, jumped to from lines 10, 20",
+			},
+		},
+		{
+			name: "labels and computed lines are left for run time",
+			src:  "10 GOTO Done\n20 LET L = 99: GOTO L\n30 GOSUB L + 1\n40 Done:\n",
+		},
+		{
+			name: "jumps after the number in a THEN",
+			src:  "10 IF X < 1 THEN 20: GOTO 99\n20 END\n",
+			want: []string{"undefined line 99, jumped to from line 10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, u := range UndefinedTargets(parse(t, tt.src)) {
+				got = append(got, u.String())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("UndefinedTargets = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/token"
+)
+
+// Dartmouth1964 lists, in line order, what in program the first Dartmouth
+// BASIC, of May 1964, would not have accepted, for teaching the language
+// as it was. It allowed one statement a line, from LET, PRINT, END, READ,
+// DATA, GOTO, IF, FOR, NEXT, GOSUB, RETURN, DIM and REM of those this
+// interpreter has; LET could not be left out, and IF only jumped to a line
+// number, with no ELSE. A variable was a letter with an optional digit and
+// an array a letter, all holding numbers, so strings were only printed,
+// and = compared only in IF, where a comparison was required. The program
+// ended with END, on its last line.
+func Dartmouth1964(program *ast.Program) []Problem {
+	c := &dartmouthChecker{}
+	lines := sortedLines(program)
+	for _, line := range lines {
+		c.line = line
+		stmts := ast.Flatten(program.Statements[line])
+		if len(stmts) > 1 {
+			c.report("only one statement is allowed on a line")
+		}
+		for _, stmt := range stmts {
+			c.statement(stmt)
+		}
+	}
+	if len(lines) > 0 {
+		last := lines[len(lines)-1]
+		if end, ok := program.Statements[last].(*ast.EndStatement); !ok || end.Token.Type != token.END {
+			c.line = last
+			c.report("the last line must be END")
+		}
+	}
+	return c.problems
+}
+
+type dartmouthChecker struct {
+	line     int
+	problems []Problem
+}
+
+func (c *dartmouthChecker) report(format string, args ...any) {
+	c.problems = append(c.problems, Problem{Line: c.line, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *dartmouthChecker) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.LetStatement:
+		if s.Token.Type != token.LET {
+			c.report("LET is required")
+		}
+		c.array(s.Name, s.Index)
+		c.expression(s.Value)
+	case *ast.PrintStatement:
+		for _, expr := range s.Expressions {
+			if _, ok := expr.(*ast.StringLiteral); !ok {
+				c.expression(expr)
+			}
+		}
+	case *ast.EndStatement:
+		if s.Token.Type != token.END {
+			c.report("%s is not Dartmouth BASIC; use END", strings.ToUpper(s.Token.Literal))
+		}
+		if s.Status != nil {
+			c.report("END takes no exit status")
+		}
+	case *ast.ReadStatement:
+		for _, v := range s.Variables {
+			c.expression(v)
+		}
+	case *ast.DataStatement:
+		for _, v := range s.Values {
+			if _, ok := v.(*ast.StringLiteral); ok {
+				c.report("DATA holds only numbers")
+				break
+			}
+		}
+	case *ast.GotoStatement:
+		c.lineNumber(s.LineNumber, "GOTO")
+	case *ast.GosubStatement:
+		c.lineNumber(s.LineNumber, "GOSUB")
+	case *ast.IfStatement:
+		c.condition(s.Condition)
+		if jump, ok := s.Consequence.(*ast.GotoStatement); !ok || jump.Token.Type != token.THEN {
+			c.report("THEN must be followed by a line number")
+		} else {
+			c.lineNumber(jump.LineNumber, "THEN")
+		}
+		if s.Alternative != nil {
+			c.report("ELSE is not Dartmouth BASIC")
+		}
+	case *ast.ForStatement:
+		c.variable(s.Variable)
+		c.expression(s.Start)
+		c.expression(s.Limit)
+		c.expression(s.Step)
+	case *ast.NextStatement:
+		if s.Variable == nil {
+			c.report("NEXT must name its variable")
+		} else {
+			c.variable(s.Variable)
+		}
+	case *ast.DimStatement:
+		c.array(s.Name, s.Size)
+		c.expression(s.Size)
+	case *ast.ReturnStatement, *ast.RemStatement:
+	case *ast.LabelStatement:
+		c.report("labels are not Dartmouth BASIC; use line numbers")
+	default:
+		c.report("%s is not a Dartmouth BASIC statement", strings.ToUpper(stmt.TokenLiteral()))
+	}
+}
+
+// lineNumber checks where a jump goes, which must be written as a number.
+func (c *dartmouthChecker) lineNumber(expr ast.Expression, keyword string) {
+	if _, ok := expr.(*ast.NumberLiteral); !ok {
+		c.report("%s must be followed by a line number", keyword)
+	}
+}
+
+// condition checks the condition of an IF: one comparison of two numbers.
+func (c *dartmouthChecker) condition(expr ast.Expression) {
+	infix, ok := expr.(*ast.InfixExpression)
+	if !ok || !isComparison(infix.Operator) {
+		c.report("IF needs a comparison, such as A < B")
+		c.expression(expr)
+		return
+	}
+	if infix.Token.Type == token.EQ {
+		c.report("write = to compare, not ==")
+	}
+	c.expression(infix.Left)
+	c.expression(infix.Right)
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "==", "<>", "<", ">", "<=", ">=":
+		return true
+	}
+	return false
+}
+
+// variable checks the name of a simple variable: a letter, then perhaps
+// a digit.
+func (c *dartmouthChecker) variable(ident *ast.Identifier) {
+	name := ident.Value
+	if len(name) > 2 || !isLetter(name[0]) || len(name) == 2 && !isDigit(name[1]) {
+		c.report("variable %s must be a letter, or a letter and a digit", name)
+	}
+}
+
+// array checks an array named by ident, when index is given, as a single
+// letter, or otherwise a simple variable.
+func (c *dartmouthChecker) array(ident *ast.Identifier, index ast.Expression) {
+	if index == nil {
+		c.variable(ident)
+		return
+	}
+	if name := ident.Value; len(name) > 1 || !isLetter(name[0]) {
+		c.report("array %s must be named by a single letter", name)
+	}
+	c.expression(index)
+}
+
+// expression checks expr, which must give a number by arithmetic alone.
+func (c *dartmouthChecker) expression(expr ast.Expression) {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral, nil:
+	case *ast.Identifier:
+		c.variable(node)
+	case *ast.ArrayAccess:
+		c.array(node.Name, node.Index)
+	case *ast.StringLiteral:
+		c.report("strings can only be printed")
+	case *ast.BooleanLiteral:
+		c.report("%s is not Dartmouth BASIC", strings.ToUpper(node.Token.Literal))
+	case *ast.CallExpression:
+		c.report("%s is not a Dartmouth BASIC function", node.Function)
+		for _, arg := range node.Arguments {
+			c.expression(arg)
+		}
+	case *ast.PrefixExpression:
+		if node.Operator != "-" {
+			c.report("%s is not a Dartmouth BASIC operator", strings.ToUpper(node.Operator))
+		}
+		c.expression(node.Right)
+	case *ast.InfixExpression:
+		switch op := node.Operator; {
+		case isComparison(op):
+			c.report("comparisons are only allowed as the condition of IF")
+		case op != "+" && op != "-" && op != "*" && op != "/":
+			c.report("%s is not a Dartmouth BASIC operator", strings.ToUpper(op))
+		}
+		c.expression(node.Left)
+		c.expression(node.Right)
+	}
+}
+
+func isLetter(b byte) bool { return b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' }
+
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
@@ -0,0 +1,229 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// Problem is a mistake found on one line of a program.
+type Problem struct {
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+}
+
+// valueType is what an expression gives: a number, a string, or, when that
+// cannot be told without running it, either.
+type valueType int
+
+const (
+	unknownType valueType = iota
+	numberType
+	stringType
+)
+
+func (t valueType) String() string {
+	switch t {
+	case numberType:
+		return "number"
+	case stringType:
+		return "string"
+	}
+	return "value"
+}
+
+// Types lists, in line order, the expressions and statements in program
+// that are sure to stop with a type mismatch when they run, such as
+// "A" + 1, FOR N$ = 1 TO 10 or GOTO "HELLO". A name ending in $ is taken
+// to hold a string and any other a number, as is a function's result, so a
+// string stored in a numeric variable is reported where it is stored.
+func Types(program *ast.Program) []Problem {
+	c := &typeChecker{}
+	for _, line := range sortedLines(program) {
+		c.line = line
+		ast.Walk(c, program.Statements[line])
+	}
+	return c.problems
+}
+
+type typeChecker struct {
+	line     int
+	problems []Problem
+}
+
+// Visit checks each statement, those after THEN and ELSE included, and
+// leaves the expressions inside it to c.statement.
+func (c *typeChecker) Visit(node ast.Node) ast.Visitor {
+	stmt, ok := node.(ast.Statement)
+	if !ok {
+		return nil
+	}
+	c.statement(stmt)
+	return c
+}
+
+func (c *typeChecker) report(format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Line: c.line, Message: fmt.Sprintf(format, args...)})
+}
+
+// number reports expr, the what of a statement, unless it may be a number.
+func (c *typeChecker) number(expr ast.Expression, what string) {
+	if expr != nil && c.expression(expr) == stringType {
+		c.report("%s must be a number", what)
+	}
+}
+
+// numbers checks the arguments of the graphics statement keyword, each a
+// number.
+func (c *typeChecker) numbers(keyword string, exprs ...ast.Expression) {
+	for _, expr := range exprs {
+		c.number(expr, keyword+" argument")
+	}
+}
+
+// target checks the line a GOTO, GOSUB or ON TIMER jumps to, which is a
+// number or a label.
+func (c *typeChecker) target(expr ast.Expression, keyword string) {
+	if c.expression(expr) == stringType {
+		c.report("%s needs a line number or label, not a string", keyword)
+	}
+}
+
+func (c *typeChecker) statement(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.PrintStatement:
+		for _, expr := range s.Expressions {
+			c.expression(expr)
+		}
+	case *ast.LetStatement:
+		c.number(s.Index, "array index")
+		c.assign(s.Name.Value, c.expression(s.Value))
+	case *ast.IfStatement:
+		c.expression(s.Condition)
+	case *ast.GotoStatement:
+		c.target(s.LineNumber, "GOTO")
+	case *ast.GosubStatement:
+		c.target(s.LineNumber, "GOSUB")
+	case *ast.OnTimerStatement:
+		c.number(s.Interval, "ON TIMER interval")
+		c.target(s.Target, "ON TIMER")
+	case *ast.ForStatement:
+		if nameType(s.Variable.Value) == stringType {
+			c.report("loop variable %s must be a number", s.Variable.Value)
+		}
+		c.number(s.Start, "FOR start value")
+		c.number(s.Limit, "FOR end value")
+		c.number(s.Step, "FOR step value")
+	case *ast.EndStatement:
+		c.number(s.Status, strings.ToUpper(s.Token.Literal)+" status")
+	case *ast.DimStatement:
+		c.number(s.Size, "DIM size")
+	case *ast.ReadStatement:
+		for _, target := range s.Variables {
+			if arr, ok := target.(*ast.ArrayAccess); ok {
+				c.number(arr.Index, "array index")
+			}
+		}
+	case *ast.RestoreStatement:
+		c.number(s.LineNumber, "RESTORE line")
+	case *ast.SleepStatement:
+		c.number(s.Seconds, "SLEEP time")
+	case *ast.PokeStatement:
+		c.number(s.Address, "POKE address")
+		c.number(s.Value, "POKE value")
+	case *ast.PlotStatement:
+		c.numbers("PLOT", s.X, s.Y, s.Color)
+	case *ast.DrawLineStatement:
+		c.numbers("LINE", s.X1, s.Y1, s.X2, s.Y2, s.Color)
+	case *ast.CircleStatement:
+		c.numbers("CIRCLE", s.X, s.Y, s.Radius, s.Color)
+	case *ast.ExpressionStatement:
+		c.expression(s.Expression)
+	}
+}
+
+// assign checks storing a value of type t in the variable name.
+func (c *typeChecker) assign(name string, t valueType) {
+	if want := nameType(name); t != unknownType && t != want {
+		c.report("type mismatch: %s variable %s given a %s", want, name, t)
+	}
+}
+
+// expression returns the type of expr, reporting the operators inside it
+// that are given the wrong types.
+func (c *typeChecker) expression(expr ast.Expression) valueType {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral, *ast.BooleanLiteral:
+		return numberType
+	case *ast.StringLiteral:
+		return stringType
+	case *ast.Identifier:
+		return nameType(node.Value)
+	case *ast.ArrayAccess:
+		c.number(node.Index, "array index")
+		return nameType(node.Name.Value)
+	case *ast.CallExpression:
+		for _, arg := range node.Arguments {
+			c.expression(arg)
+		}
+		return nameType(node.Function)
+	case *ast.PrefixExpression:
+		right := c.expression(node.Right)
+		if node.Operator == "-" && right == stringType {
+			c.report("type mismatch: -%s", right)
+		}
+		return numberType
+	case *ast.InfixExpression:
+		return c.infix(node)
+	}
+	return unknownType
+}
+
+// infix follows the evaluator: two numbers take any operator, while two
+// strings may only be joined with + or compared with == and <>.
+func (c *typeChecker) infix(node *ast.InfixExpression) valueType {
+	left, right := c.expression(node.Left), c.expression(node.Right)
+	mismatch := func() {
+		c.report("type mismatch: %s %s %s", left, node.Operator, right)
+	}
+	if left == unknownType || right == unknownType {
+		if node.Operator != "+" {
+			return numberType
+		}
+		if left == unknownType {
+			return right
+		}
+		return left
+	}
+	switch node.Operator {
+	case "+":
+		if left != right {
+			mismatch()
+			return unknownType
+		}
+		return left
+	case "==", "<>":
+		if left != right {
+			mismatch()
+		}
+	default:
+		if left == stringType || right == stringType {
+			mismatch()
+		}
+	}
+	return numberType
+}
+
+// nameType is the type a variable or function name holds: a string if it
+// ends in $, otherwise a number.
+func nameType(name string) valueType {
+	if strings.HasSuffix(name, "$") {
+		return stringType
+	}
+	return numberType
+}
@@ -0,0 +1,111 @@
+package check
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestTypes(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      []string
+	}{
+		{
+			name: "well typed",
+			src: "10 LET A$ = \"X\" + \"Y\": LET N = 1 + 2 * 3\n" +
+				"20 PRINT A$ == \"XY\"; N <> 3; -N; MAX(N, 1) + 1\n" +
+				"30 IF A$ <> \"\" THEN LET B$ = A$ ELSE LET N = N / 2\n" +
+				"40 FOR I = 1 TO N STEP 2: NEXT I\n" +
+				"50 DIM C(N): LET C(I) = N: GOTO 60\n" +
+				"60 END\n",
+		},
+		{
+			name: "string plus number",
+			src:  "10 PRINT \"A\" + 1\n",
+			want: []string{"line 10: type mismatch: string + number"},
+		},
+		{
+			name: "string in a number variable",
+			src:  "10 LET N = \"X\"\n",
+			want: []string{"line 10: type mismatch: number variable N given a string"},
+		},
+		{
+			name: "number in a string variable",
+			src:  "10 LET A$ = 5\n",
+			want: []string{"line 10: type mismatch: string variable A$ given a number"},
+		},
+		{
+			name: "string function into a number variable",
+			src:  "10 LET N = UCASE$(\"a\")\n",
+			want: []string{"line 10: type mismatch: number variable N given a string"},
+		},
+		{
+			name: "ordering strings",
+			src:  "10 IF \"A\" < \"B\" THEN PRINT 1\n",
+			want: []string{"line 10: type mismatch: string < string"},
+		},
+		{
+			name: "comparing a string with a number",
+			src:  "10 PRINT A$ == 1\n",
+			want: []string{"line 10: type mismatch: string == number"},
+		},
+		{
+			name: "negated string",
+			src:  "10 PRINT -A$\n",
+			want: []string{"line 10: type mismatch: -string"},
+		},
+		{
+			name: "after THEN and ELSE",
+			src:  "10 IF N THEN LET N = \"X\" ELSE LET A$ = 1\n",
+			want: []string{
+				"line 10: type mismatch: number variable N given a string",
+				"line 10: type mismatch: string variable A$ given a number",
+			},
+		},
+		{
+			name: "string FOR values",
+			src:  "10 FOR I = \"A\" TO 10 STEP \"B\": NEXT I\n",
+			want: []string{
+				"line 10: FOR start value must be a number",
+				"line 10: FOR step value must be a number",
+			},
+		},
+		{
+			name: "string array index and DIM size",
+			src:  "10 DIM A(\"X\")\n20 LET A(\"Y\") = 1\n30 PRINT A(B$)\n",
+			want: []string{
+				"line 10: DIM size must be a number",
+				"line 20: array index must be a number",
+				"line 30: array index must be a number",
+			},
+		},
+		{
+			name: "statement arguments",
+			src:  "10 SLEEP \"X\"\n20 PLOT 1, A$\n30 POKE 1, \"X\"\n",
+			want: []string{
+				"line 10: SLEEP time must be a number",
+				"line 20: PLOT argument must be a number",
+				"line 30: POKE value must be a number",
+			},
+		},
+		{
+			name: "a mismatch is reported once, not again by what uses it",
+			src:  "10 PRINT (\"A\" + 1) + 2\n20 LET N = \"A\" + 1\n",
+			want: []string{
+				"line 10: type mismatch: string + number",
+				"line 20: type mismatch: string + number",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, problem := range Types(parse(t, tt.src)) {
+				got = append(got, problem.String())
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Types = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/basis-ex/evaluator"
+)
+
+// checkpoint is what SAVESTATE writes: the program, so that LOADSTATE
+// needs nothing else, and the state it was stopped in.
+type checkpoint struct {
+	Program []string           `json:"program"`
+	State   evaluator.Snapshot `json:"state"`
+}
+
+// saveState handles SAVESTATE, writing the workspace's stopped program to
+// filename so that LOADSTATE can resume it later.
+func saveState(ws *workspace, filename string) error {
+	if filename == "" {
+		return fmt.Errorf("usage: SAVESTATE <file>")
+	}
+	if ws.stopped == nil || programSource(ws.lines) != ws.stoppedSource {
+		return fmt.Errorf("no stopped program to save")
+	}
+
+	cp := checkpoint{State: ws.stopped.Snapshot()}
+	if cp.State.Calls > 0 {
+		return fmt.Errorf("can't save a program stopped inside a SUB")
+	}
+	for _, num := range sortedLineNumbers(ws.lines) {
+		cp.Program = append(cp.Program, ws.lines[num])
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0o644)
+}
+
+// loadState handles LOADSTATE, replacing the workspace's program with the
+// one saved in filename and stopping it where it was saved, ready for CONT
+// or STEP.
+func loadState(ws *workspace, dbg *debugger, filename string) error {
+	if filename == "" {
+		return fmt.Errorf("usage: LOADSTATE <file>")
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	lines := make(map[int]string, len(cp.Program))
+	for _, text := range cp.Program {
+		num, ok, _ := splitLineNumber(text)
+		if !ok {
+			return fmt.Errorf("%s: program line without a number: %s", filename, text)
+		}
+		lines[num] = text
+	}
+	eval := loadProgram(lines)
+	if eval == nil {
+		return fmt.Errorf("%s: the saved program does not parse", filename)
+	}
+	session := evaluator.NewEnvironment()
+	eval.SetEnvironment(session)
+	if err := eval.Restore(cp.State); err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	dbg.attach(eval)
+	ws.lines, ws.session = lines, session
+	ws.stopped, ws.last = eval, eval
+	ws.stoppedSource = programSource(lines)
+	return nil
+}
@@ -0,0 +1,973 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/check"
+	"github.com/basis-ex/compiler"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/lsp"
+	"github.com/basis-ex/optimize"
+	"github.com/basis-ex/parser"
+	"github.com/basis-ex/token"
+	"github.com/basis-ex/transpile"
+	"github.com/basis-ex/vm"
+)
+
+// command is one of the tool's subcommands, as in "basic run prog.bas".
+// setup registers the command's flags and returns the function that parses
+// args and does the work, exiting with one of the exit codes on failure.
+type command struct {
+	name    string
+	args    string
+	summary string
+	setup   func(fs *flag.FlagSet) func(args []string)
+}
+
+// run parses args for the command and runs it.
+func (cmd *command) run(args []string) {
+	cmd.setup(newFlagSet(cmd))(args)
+}
+
+// commands lists the subcommands in the order usage shows them. help is
+// added by init, since it lists the others.
+var commands = []*command{
+	{"run", "[flags] file.bas|- [args...]", "run a program; arguments after the file are COMMAND$", runCommand},
+	{"repl", "[flags]", "start the interactive interpreter (the default with no arguments)", replCommand},
+	{"compile", "[flags] file.bas|-", "translate a program to Go source", compileCommand},
+	{"fmt", "[flags] file.bas...", "print programs in canonical form, or rewrite them with -w", fmtCommand},
+	{"lint", "file.bas...", "check programs for errors without running them", lintCommand},
+	{"test", "[flags] [file.bas|dir]...", "run programs and compare their output with .out files", testCommand},
+	{"selftest", "[flags] [file.bas|dir]...", "run programs interpreted, on the VM, compiled and translated and compare them", selftestCommand},
+	{"lsp", "[flags]", "serve the Language Server Protocol on standard input and output, for editors", lspCommand},
+	{"bench", "[flags] [file.bas...]", "time programs, or the built-in workloads, interpreted, on the VM and compiled", benchCommand},
+	{"serve", "[flags]", "run programs sent over HTTP, sandboxed, and answer with their output as JSON", serveCommand},
+}
+
+func init() {
+	commands = append(commands, &command{"help", "[command]", "show usage for the tool or one command", helpCommand})
+}
+
+func lookupCommand(name string) (*command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return nil, false
+}
+
+// newFlagSet returns the flag set for a subcommand, whose usage message
+// names the command and its arguments.
+func newFlagSet(cmd *command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: basic %s %s\n\n%s.\n", cmd.name, cmd.args, capitalize(cmd.summary))
+		var hasFlags bool
+		fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintln(fs.Output(), "\nFlags:")
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseInterleaved parses fs from args, allowing flags after positional
+// arguments too, as in "basic compile prog.bas -o prog.go". It returns the
+// positional arguments.
+func parseInterleaved(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		if fs.NArg() == 0 {
+			return positional
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// usage prints the tool's summary of subcommands.
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: basic <command> [flags] [arguments]")
+	fmt.Fprintln(out, "       basic [flags] [file.bas|- [args...]]")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(out, "\nRun \"basic help <command>\" for a command's flags. Without a command,")
+	fmt.Fprintln(out, "basic runs the file given, or starts the REPL, and takes these flags:")
+	fmt.Fprintln(out)
+	flag.PrintDefaults()
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// addRuntimeFlags registers the flags that shape how every program runs,
+// in the REPL or from the command line.
+func addRuntimeFlags(fs *flag.FlagSet) {
+	fs.IntVar(&pageLength, "page", 0, "pause output with --More-- every N lines when running interactively")
+	fs.IntVar(&maxGosubDepth, "gosub-depth", evaluator.DefaultMaxGosubDepth, "maximum GOSUB nesting before \"Out of memory\" (0 for no limit)")
+	fs.IntVar(&maxStringLength, "max-string", evaluator.DefaultMaxStringLength, "longest string, in bytes, before \"Out of memory\" (0 for no limit)")
+	fs.IntVar(&maxArrayCells, "max-array", evaluator.DefaultMaxArrayCells, "most array elements DIM may declare in all, before \"Out of memory\" (0 for no limit)")
+	addDialectFlag(fs)
+	addStrictFlag(fs)
+	addStrictDartmouthFlag(fs)
+	fs.BoolVar(&noShell, "no-shell", false, "make the SHELL statement an error instead of running host commands")
+}
+
+func addDialectFlag(fs *flag.FlagSet) {
+	fs.Var(dialectFlag{&basicDialect}, "dialect", "semantics to follow: "+strings.Join(dialect.Names(), ", "))
+	addEscapesFlag(fs)
+}
+
+// addEscapesFlag registers -escapes, for the commands that read programs
+// as the dialect does.
+func addEscapesFlag(fs *flag.FlagSet) {
+	fs.Var(escapesFlag{&basicDialect}, "escapes", `read backslash escapes such as \n and \" in strings`)
+}
+
+// dialectFlag sets a dialect by name.
+type dialectFlag struct{ d *dialect.Dialect }
+
+func (f dialectFlag) String() string {
+	if f.d == nil {
+		return ""
+	}
+	return f.d.Name
+}
+
+func (f dialectFlag) Set(name string) error {
+	d, ok := dialect.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown dialect %q (choose from %s)", name, strings.Join(dialect.Names(), ", "))
+	}
+	d.BackslashEscapes = f.d.BackslashEscapes
+	*f.d = d
+	return nil
+}
+
+// escapesFlag turns on backslash escapes in strings, whichever dialect
+// -dialect chooses.
+type escapesFlag struct{ d *dialect.Dialect }
+
+func (f escapesFlag) String() string {
+	if f.d == nil {
+		return "false"
+	}
+	return strconv.FormatBool(f.d.BackslashEscapes)
+}
+
+func (f escapesFlag) Set(s string) error {
+	on, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	f.d.BackslashEscapes = on
+	return nil
+}
+
+func (f escapesFlag) IsBoolFlag() bool { return true }
+
+// programFlags are the flags for running one program from the command
+// line rather than the REPL.
+type programFlags struct {
+	code      lineFlag
+	inputFile string
+	answers   lineFlag
+}
+
+func (pf *programFlags) add(fs *flag.FlagSet) {
+	fs.Var(&pf.code, "e", "run this program text (repeat to add lines) instead of a file")
+	fs.StringVar(&pf.inputFile, "input", "", "answer INPUT statements from this file, one line each")
+	fs.Var(&pf.answers, "answer", "answer the next INPUT statement with this line (repeatable)")
+	fs.Int64Var(&maxSteps, "max-steps", 0, "stop the program after this many statements (0 for no limit)")
+	fs.DurationVar(&timeout, "timeout", 0, "stop the program after it has run this long, e.g. 5s (0 for no limit)")
+	fs.BoolVar(&showTime, "time", false, "report run time, statements executed and peak memory on stderr")
+	fs.BoolVar(&showCover, "cover", false, "list the program on stderr with how often each line ran, and the share of lines covered")
+	fs.StringVar(&coverProfile, "coverprofile", "", "write line coverage as JSON to this file")
+	fs.Var(engineFlag{&engine}, "engine", "what runs the program: tree, the evaluator, or vm, the faster bytecode machine")
+	fs.BoolVar(&dumpAST, "ast", false, "print the parsed program as JSON instead of running it")
+	fs.BoolVar(&dumpTokens, "tokens", false, "print the lexer's tokens, one a line, instead of running the program")
+}
+
+// engineFlag sets engine, accepting only the names it knows.
+type engineFlag struct{ e *string }
+
+func (f engineFlag) String() string {
+	if f.e == nil {
+		return ""
+	}
+	return *f.e
+}
+
+func (f engineFlag) Set(name string) error {
+	if name != "tree" && name != "vm" {
+		return fmt.Errorf("unknown engine %q (choose from tree, vm)", name)
+	}
+	*f.e = name
+	return nil
+}
+
+// openScript sets up script from -input or -answer.
+func (pf *programFlags) openScript() {
+	if pf.inputFile != "" {
+		f, err := os.Open(pf.inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFileError)
+		}
+		script = bufio.NewReader(f)
+	} else if len(pf.answers) > 0 {
+		script = bufio.NewReader(strings.NewReader(pf.answers.String() + "\n"))
+	}
+}
+
+// run runs the -e text, with args as COMMAND$, or else the file named by
+// args[0]. It reports whether there was anything to run.
+func (pf *programFlags) run(args []string) bool {
+	pf.openScript()
+	if len(pf.code) > 0 {
+		content, err := readProgramSource("-e", pf.code.String()+"\n")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFileError)
+		}
+		programArgs = args
+		runSource(content)
+		return true
+	}
+	if len(args) > 0 {
+		programArgs = args[1:]
+		runFile(args[0])
+		return true
+	}
+	return false
+}
+
+func runCommand(fs *flag.FlagSet) func(args []string) {
+	addRuntimeFlags(fs)
+	pf := &programFlags{}
+	pf.add(fs)
+	return func(args []string) {
+		fs.Parse(args)
+		if !pf.run(fs.Args()) {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+	}
+}
+
+func replCommand(fs *flag.FlagSet) func(args []string) {
+	addRuntimeFlags(fs)
+	fs.StringVar(&initFile, "init", "", "startup script to run instead of ~/.basicrc")
+	return func(args []string) {
+		fs.Parse(args)
+		if fs.NArg() > 0 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		runREPL()
+	}
+}
+
+func compileCommand(fs *flag.FlagSet) func(args []string) {
+	addDialectFlag(fs)
+	addStrictFlag(fs)
+	addStrictDartmouthFlag(fs)
+	output := fs.String("o", "-", "file to write the Go source to, or - for stdout; with -build, the executable")
+	build := fs.Bool("build", false, "build an executable with the Go toolchain instead of writing Go source")
+	target := fs.String("target", "go", "what to write: go; wasm, a WebAssembly module and page to run it in a browser, in the directory -o; or python or javascript source")
+	fs.BoolVar(&dropDead, "drop-dead", false, "leave out lines that can never run")
+	fs.StringVar(&sourceMap, "sourcemap", "", "also write a JSON map from the Go lines to the BASIC lines to this file")
+	return func(args []string) {
+		files := parseInterleaved(fs, args)
+		if len(files) != 1 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		switch *target {
+		case "go":
+		case "wasm":
+			if *output == "-" {
+				*output = wasmDirName(files[0])
+			}
+			buildWasmFile(files[0], *output)
+			return
+		case "python", "javascript":
+			if *build || sourceMap != "" {
+				fmt.Fprintf(os.Stderr, "-build and -sourcemap are for the go and wasm targets\n")
+				os.Exit(exitUsage)
+			}
+			translateFile(files[0], *output, *target)
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown target %q: use go, wasm, python or javascript\n", *target)
+			os.Exit(exitUsage)
+		}
+		if *build {
+			if *output == "-" {
+				*output = executableName(files[0])
+			}
+			buildFile(files[0], *output)
+			return
+		}
+		compileFile(files[0], *output)
+	}
+}
+
+// fmtCommand prints each program in canonical form: each numbered line is
+// parsed and printed back from its syntax tree, with keywords in upper case,
+// keyword abbreviations such as P. spelled out, even spacing around
+// operators and separators, and the line numbers right-aligned. Other lines,
+// such as %INCLUDE directives, are kept as written. A program that does not
+// parse is reported and left alone. With -w it rewrites the files instead,
+// and -l lists the files that would change.
+func fmtCommand(fs *flag.FlagSet) func(args []string) {
+	write := fs.Bool("w", false, "write the result back to the file instead of printing it")
+	list := fs.Bool("l", false, "list the files whose formatting differs")
+	return func(args []string) {
+		formatFiles(fs, parseInterleaved(fs, args), *write, *list)
+	}
+}
+
+func formatFiles(fs *flag.FlagSet, files []string, write, list bool) {
+	if len(files) == 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	status := 0
+	for _, name := range files {
+		original, err := os.ReadFile(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			status = exitFileError
+			continue
+		}
+		formatted, errs := formatSource(string(original))
+		if len(errs) > 0 {
+			for _, msg := range errs {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", name, msg)
+			}
+			if status == 0 {
+				status = exitSyntaxError
+			}
+			continue
+		}
+		switch {
+		case list:
+			if formatted != string(original) {
+				fmt.Println(name)
+			}
+		case write:
+			if formatted != string(original) {
+				if err := os.WriteFile(name, []byte(formatted), 0644); err != nil {
+					fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+					status = exitFileError
+				}
+			}
+		default:
+			fmt.Print(formatted)
+		}
+	}
+	os.Exit(status)
+}
+
+// formatSource formats program text, keeping the lines in the order they
+// were written, or returns the errors that stop it being parsed.
+func formatSource(src string) (string, []string) {
+	type sourceLine struct {
+		text     string
+		num      int
+		numbered bool
+	}
+	var lines []sourceLine
+	var program strings.Builder
+	width := 0
+	scanner := bufio.NewScanner(strings.NewReader(src))
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), " \t\r")
+		num, hasNum, rest := splitLineNumber(text)
+		if _, ok := includeTarget(rest); !hasNum || ok {
+			lines = append(lines, sourceLine{text: text})
+			continue
+		}
+		text = fmt.Sprintf("%d %s", num, token.ExpandAbbreviations(rest))
+		lines = append(lines, sourceLine{text: text, num: num, numbered: true})
+		program.WriteString(text)
+		program.WriteByte('\n')
+		width = max(width, len(strconv.Itoa(num)))
+	}
+
+	// The whole program is parsed once for its errors, as some, such as a
+	// SUB without END SUB, only show across lines.
+	p := parser.New(lexer.New(program.String()))
+	p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		return "", errs
+	}
+
+	var b strings.Builder
+	var errs []string
+	for _, line := range lines {
+		if !line.numbered {
+			b.WriteString(line.text)
+			b.WriteByte('\n')
+			continue
+		}
+		stmt := parser.New(lexer.New(line.text)).ParseProgram().Statements[line.num]
+		formatted := stmt.String()
+		// Reading the result back must give the same line, or formatting
+		// would have changed what it does.
+		again := parser.New(lexer.New(fmt.Sprintf("%d %s", line.num, formatted))).ParseProgram().Statements[line.num]
+		if again == nil || again.String() != formatted {
+			errs = append(errs, fmt.Sprintf("line %d: cannot be formatted", line.num))
+			continue
+		}
+		fmt.Fprintf(&b, "%*d %s\n", width, line.num, formatted)
+	}
+	return b.String(), errs
+}
+
+// addStrictFlag registers -strict, for the commands that run or compile
+// programs and for lint.
+func addStrictFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&strict, "strict", false, "treat type mismatches found before running, such as \"A\" + 1, as errors")
+}
+
+// addStrictDartmouthFlag registers -strict-dartmouth, which reads programs
+// in the dartmouth dialect and refuses those with anything the first
+// Dartmouth BASIC did not have.
+func addStrictDartmouthFlag(fs *flag.FlagSet) {
+	fs.BoolFunc("strict-dartmouth", "accept only Dartmouth BASIC as of 1964, in the dartmouth dialect: its statements, LET required, one statement a line and no ELSE", func(value string) error {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		strictDartmouth = on
+		if on {
+			basicDialect = dialect.Dartmouth
+		}
+		return nil
+	})
+}
+
+// lintCommand parses each program, with its includes, and reports the
+// errors found, jumps to lines and labels that do not exist and NEXTs no
+// FOR starts, exiting with exitSyntaxError if there were any. Code that
+// can never run is reported as a warning, which does not change the exit
+// status. Type mismatches are warnings too, or errors with -strict, and
+// with -strict-dartmouth what Dartmouth BASIC lacked is an error.
+func lintCommand(fs *flag.FlagSet) func(args []string) {
+	addStrictFlag(fs)
+	addStrictDartmouthFlag(fs)
+	addEscapesFlag(fs)
+	return func(args []string) {
+		lintFiles(fs, parseInterleaved(fs, args))
+	}
+}
+
+func lintFiles(fs *flag.FlagSet, files []string) {
+	if len(files) == 0 {
+		fs.Usage()
+		os.Exit(exitUsage)
+	}
+
+	status := 0
+	for _, name := range files {
+		content, err := readProgram(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			status = exitFileError
+			continue
+		}
+		p := parser.New(newLexer(content))
+		program := p.ParseProgram()
+		for _, err := range p.ErrorList() {
+			fmt.Printf("%s: %s\n", name, err.Msg)
+			if excerpt := parseExcerpt(err); excerpt != "" {
+				fmt.Println(indent(excerpt, "    "))
+			}
+		}
+		if len(p.Errors()) > 0 {
+			if status == 0 {
+				status = exitSyntaxError
+			}
+			continue
+		}
+		undefined := check.UndefinedTargets(program)
+		for _, u := range undefined {
+			fmt.Printf("%s: %v\n", name, u)
+		}
+		jumps := append(check.UnmatchedNexts(program), check.UndefinedLabels(program)...)
+		for _, problem := range jumps {
+			fmt.Printf("%s: %v\n", name, problem)
+		}
+		if len(undefined)+len(jumps) > 0 && status == 0 {
+			status = exitSyntaxError
+		}
+		problems := check.Types(program)
+		for _, problem := range problems {
+			if strict {
+				fmt.Printf("%s: %v\n", name, problem)
+			} else {
+				fmt.Printf("%s: warning: %v\n", name, problem)
+			}
+		}
+		if strict && len(problems) > 0 && status == 0 {
+			status = exitSyntaxError
+		}
+		if strictDartmouth {
+			problems := check.Dartmouth1964(program)
+			for _, problem := range problems {
+				fmt.Printf("%s: %v\n", name, problem)
+			}
+			if len(problems) > 0 && status == 0 {
+				status = exitSyntaxError
+			}
+		}
+		for _, dead := range optimize.FindDeadCode(program) {
+			fmt.Printf("%s: warning: %v\n", name, dead)
+		}
+	}
+	os.Exit(status)
+}
+
+// lspCommand runs a language server for an editor, which starts it and
+// talks to it over standard input and output until it sends exit.
+// Programs are checked as lint checks them, in the dialect given.
+func lspCommand(fs *flag.FlagSet) func(args []string) {
+	addDialectFlag(fs)
+	addStrictFlag(fs)
+	return func(args []string) {
+		if len(parseInterleaved(fs, args)) > 0 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		server := lsp.NewServer(os.Stdout, lsp.Options{Dialect: basicDialect, Strict: strict})
+		if err := server.Serve(os.Stdin); err != nil {
+			fmt.Fprintf(os.Stderr, "lsp: %v\n", err)
+			os.Exit(exitRuntimeError)
+		}
+	}
+}
+
+// testCommand runs every program that has an expected-output file beside
+// it, prog.out or prog.expected for prog.bas, and compares what the
+// program prints, errors included, with that file. prog.in or prog.input,
+// when present, answers its INPUT statements. Directories are searched for
+// such programs; the default is the current directory. -format chooses
+// how the results are written, for people or for CI tools.
+func testCommand(fs *flag.FlagSet) func(args []string) {
+	limit := fs.Duration("timeout", 10*time.Second, "fail a program that runs longer than this")
+	format := fs.String("format", "text", "how to write the results: "+strings.Join(testFormats, ", "))
+	return func(args []string) {
+		targets := parseInterleaved(fs, args)
+		if !isTestFormat(*format) {
+			fmt.Fprintf(os.Stderr, "unknown format %q: use %s\n", *format, strings.Join(testFormats, ", "))
+			os.Exit(exitUsage)
+		}
+		runTests(targets, *limit, *format)
+	}
+}
+
+// expectedExts are the extensions of the file beside a program holding
+// its expected output, and inputExts of the one answering its INPUT
+// statements, in the order they are looked for.
+var (
+	expectedExts = []string{".out", ".expected"}
+	inputExts    = []string{".in", ".input"}
+)
+
+func runTests(targets []string, limit time.Duration, format string) {
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFileError)
+	}
+
+	programs := findPrograms(targets, expectedExts...)
+	if len(programs) == 0 && format == "text" {
+		fmt.Println("no programs with .out or .expected files found")
+		return
+	}
+
+	report := newTestReport(os.Stdout, format, len(programs))
+	for _, prog := range programs {
+		start := time.Now()
+		msg := runTest(self, prog, limit)
+		report.result(prog, msg, time.Since(start))
+	}
+	if !report.finish() {
+		os.Exit(exitRuntimeError)
+	}
+}
+
+// findPrograms returns the programs named by targets, searching those
+// that are directories for programs with a file of one of the extensions
+// beside them, or for every program when none are given. It exits if a
+// target is missing.
+func findPrograms(targets []string, beside ...string) []string {
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+	var programs []string
+	for _, target := range targets {
+		found, err := testPrograms(target, beside)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFileError)
+		}
+		programs = append(programs, found...)
+	}
+	return programs
+}
+
+// testPrograms returns target if it is a program, or the programs in the
+// directory target that have a file of one of the extensions beside, or
+// all of them when beside is empty.
+func testPrograms(target string, beside []string) ([]string, error) {
+	info, err := os.Stat(target)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{target}, nil
+	}
+	matches, err := filepath.Glob(filepath.Join(target, "*.bas"))
+	if err != nil {
+		return nil, err
+	}
+	var programs []string
+	for _, prog := range matches {
+		if _, ok := besideFile(prog, beside); ok || len(beside) == 0 {
+			programs = append(programs, prog)
+		}
+	}
+	return programs, nil
+}
+
+// runTest runs one program in a child process and returns why it failed,
+// or "" if its output matched.
+func runTest(self, prog string, limit time.Duration) string {
+	expected, ok := besideFile(prog, expectedExts)
+	if !ok {
+		return "no .out or .expected file"
+	}
+	want, err := os.ReadFile(expected)
+	if err != nil {
+		return err.Error()
+	}
+
+	args := []string{"run", "-timeout", limit.String()}
+	if in, ok := besideFile(prog, inputExts); ok {
+		args = append(args, "-input", in)
+	}
+	args = append(args, prog)
+	got, _ := exec.Command(self, args...).CombinedOutput()
+
+	if bytes.Equal(got, want) {
+		return ""
+	}
+	if n, g, w, ok := firstDifference(got, want); ok {
+		return fmt.Sprintf("output line %d is %q, want %q", n, g, w)
+	}
+	return "output differs"
+}
+
+// firstDifference returns the number of the first line, counted from 1,
+// at which a and b differ, and that line of each.
+func firstDifference(a, b []byte) (n int, lineA, lineB string, ok bool) {
+	aLines := strings.Split(string(a), "\n")
+	bLines := strings.Split(string(b), "\n")
+	for i := 0; i < len(aLines) || i < len(bLines); i++ {
+		lineA, lineB = "", ""
+		if i < len(aLines) {
+			lineA = aLines[i]
+		}
+		if i < len(bLines) {
+			lineB = bLines[i]
+		}
+		if lineA != lineB {
+			return i + 1, lineA, lineB, true
+		}
+	}
+	return 0, "", "", false
+}
+
+// selftestCommand runs each program in the interpreter, on the bytecode
+// machine when it takes the program, compiled to an executable, and
+// translated to each of the translators' languages that is installed,
+// giving each the same INPUT answers, from prog.in or prog.input beside
+// prog.bas when there is one, and reports any difference in what they
+// print or the status they exit with. Runtime errors are written in a form of each
+// one's own, so only that the program stopped with one is compared.
+// Directories are searched for programs; the default is the current
+// directory. A program that does not compile is skipped.
+func selftestCommand(fs *flag.FlagSet) func(args []string) {
+	addDialectFlag(fs)
+	limit := fs.Duration("timeout", 10*time.Second, "fail a program that runs longer than this, either way")
+	return func(args []string) {
+		runSelftests(parseInterleaved(fs, args), *limit)
+	}
+}
+
+func runSelftests(targets []string, limit time.Duration) {
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFileError)
+	}
+	programs := findPrograms(targets)
+	if len(programs) == 0 {
+		fmt.Println("no programs found")
+		return
+	}
+	dir, err := os.MkdirTemp("", "basic-selftest-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitFileError)
+	}
+
+	differed, skipped := 0, 0
+	for i, prog := range programs {
+		exe := filepath.Join(dir, executableName(fmt.Sprintf("prog%d.bas", i)))
+		msg, compiled := selftest(self, prog, exe, limit)
+		switch {
+		case !compiled:
+			skipped++
+			fmt.Printf("skip %s: %s\n", prog, msg)
+		case msg != "":
+			differed++
+			fmt.Printf("FAIL %s: %s\n", prog, msg)
+		default:
+			fmt.Printf("ok   %s\n", prog)
+		}
+	}
+	os.RemoveAll(dir)
+	fmt.Printf("%d agreed, %d differed, %d skipped\n", len(programs)-differed-skipped, differed, skipped)
+	if differed > 0 {
+		os.Exit(exitRuntimeError)
+	}
+}
+
+// selftest builds prog into the executable exe and runs it, the
+// interpreter and, if they take prog, the bytecode machine and the
+// translations of it, written beside exe, returning how they differ, or ""
+// if they agree. compiled is false, with the compiler's
+// complaint, if prog did not build.
+func selftest(self, prog, exe string, limit time.Duration) (msg string, compiled bool) {
+	if err := compileExecutable(self, prog, exe); err != nil {
+		return err.Error(), false
+	}
+
+	var input []byte
+	if in, ok := besideFile(prog, inputExts); ok {
+		var err error
+		if input, err = os.ReadFile(in); err != nil {
+			return err.Error(), true
+		}
+	}
+	interpreted, interpretedStatus, err := runWithInput(limit, input, self, append(append([]string{"run"}, dialectArgs()...), prog)...)
+	if err != nil {
+		return err.Error() + " interpreted", true
+	}
+	built, builtStatus, err := runWithInput(limit, input, exe)
+	if err != nil {
+		return err.Error() + " compiled", true
+	}
+
+	if n, i, b, ok := firstDifference(interpreted, built); ok {
+		return fmt.Sprintf("output line %d is %q interpreted, %q compiled", n, i, b), true
+	}
+	if interpretedStatus != builtStatus {
+		return fmt.Sprintf("exit status is %d interpreted, %d compiled", interpretedStatus, builtStatus), true
+	}
+
+	if vmTakes(prog) {
+		onVM, vmStatus, err := runWithInput(limit, input, self, append(append([]string{"run", "-engine", "vm"}, dialectArgs()...), prog)...)
+		if err != nil {
+			return err.Error() + " on the VM", true
+		}
+		if n, i, v, ok := firstDifference(interpreted, onVM); ok {
+			return fmt.Sprintf("output line %d is %q interpreted, %q on the VM", n, i, v), true
+		}
+		if interpretedStatus != vmStatus {
+			return fmt.Sprintf("exit status is %d interpreted, %d on the VM", interpretedStatus, vmStatus), true
+		}
+	}
+
+	for _, tr := range translators {
+		run, err := exec.LookPath(tr.command)
+		if err != nil {
+			continue
+		}
+		code, ok := translate(prog, tr.target)
+		if !ok {
+			continue
+		}
+		file := exe + tr.ext
+		if err := os.WriteFile(file, []byte(code), 0644); err != nil {
+			return err.Error(), true
+		}
+		translated, translatedStatus, err := runWithInput(limit, input, run, append(append([]string{}, tr.args...), file)...)
+		if err != nil {
+			return fmt.Sprintf("%v in %s", err, tr.language), true
+		}
+		if n, i, t, ok := firstDifference(interpreted, translated); ok {
+			return fmt.Sprintf("output line %d is %q interpreted, %q in %s", n, i, t, tr.language), true
+		}
+		if interpretedStatus != translatedStatus {
+			return fmt.Sprintf("exit status is %d interpreted, %d in %s", interpretedStatus, translatedStatus, tr.language), true
+		}
+	}
+	return "", true
+}
+
+// translators are the languages compile -target translates programs to,
+// with the command that runs them. selftest compares those whose command
+// is installed. Python runs isolated, so that a translation named like a
+// standard module, such as numbers.py, is not imported in its place.
+var translators = []struct {
+	target, language, ext, command string
+	args                           []string
+}{
+	{"python", "Python", ".py", "python3", []string{"-I"}},
+	{"javascript", "JavaScript", ".js", "node", nil},
+}
+
+// selftestProgram parses prog, which selftest has already seen compile, in
+// basicDialect.
+func selftestProgram(prog string) (*ast.Program, bool) {
+	content, err := readProgram(prog)
+	if err != nil {
+		return nil, false
+	}
+	p := parser.New(newLexer(content))
+	program := p.ParseProgram()
+	return program, len(p.Errors()) == 0
+}
+
+// vmTakes reports whether the bytecode machine can run prog, which
+// selftest has already seen compile, in basicDialect.
+func vmTakes(prog string) bool {
+	program, ok := selftestProgram(prog)
+	if !ok {
+		return false
+	}
+	_, err := vm.Compile(program)
+	return err == nil
+}
+
+// translate translates prog into the language target, reporting false if
+// the translator cannot take it.
+func translate(prog, target string) (string, bool) {
+	program, ok := selftestProgram(prog)
+	if !ok {
+		return "", false
+	}
+	code, err := transpile.Translate(program, target, compiler.Options{Dialect: basicDialect})
+	return code, err == nil
+}
+
+// dialectArgs are the flags that give a child process basicDialect.
+func dialectArgs() []string {
+	return []string{"-dialect", basicDialect.Name, "-escapes=" + strconv.FormatBool(basicDialect.BackslashEscapes)}
+}
+
+// compileExecutable compiles prog into the executable exe, running self, in
+// basicDialect. Its error is the first line of the compiler's complaint,
+// with the line that introduces, if any.
+func compileExecutable(self, prog, exe string) error {
+	out, err := exec.Command(self, append(append([]string{"compile", "-build", "-o", exe}, dialectArgs()...), prog)...).CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	msg := lines[0]
+	if len(lines) > 1 && strings.HasSuffix(msg, ":") {
+		msg += " " + strings.TrimSpace(lines[1])
+	}
+	return errors.New(msg)
+}
+
+// runWithInput runs the command name with input as its standard input and
+// returns its standard output and exit status. It fails if the command
+// could not be run or ran longer than limit.
+func runWithInput(limit time.Duration, input []byte, name string, args ...string) ([]byte, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), limit)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return out, 0, fmt.Errorf("ran longer than %v", limit)
+	}
+	var exit *exec.ExitError
+	if errors.As(err, &exit) {
+		return out, exit.ExitCode(), nil
+	}
+	return out, 0, err
+}
+
+// besideFile returns the first file beside prog with one of the
+// extensions exts in place of its own.
+func besideFile(prog string, exts []string) (string, bool) {
+	for _, ext := range exts {
+		if name := withExt(prog, ext); fileExists(name) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+func withExt(name, ext string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ext
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func helpCommand(fs *flag.FlagSet) func(args []string) {
+	return func(args []string) {
+		if len(args) == 0 {
+			addTopLevelFlags(flag.CommandLine)
+			flag.CommandLine.SetOutput(os.Stdout)
+			usage()
+			return
+		}
+		cmd, ok := lookupCommand(args[0])
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+			os.Exit(exitUsage)
+		}
+		cmdFlags := newFlagSet(cmd)
+		cmd.setup(cmdFlags)
+		cmdFlags.SetOutput(os.Stdout)
+		cmdFlags.Usage()
+	}
+}
@@ -1,15 +1,37 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
+	"go/format"
+	"go/scanner"
 	"sort"
 	"strings"
 
 	"github.com/basis-ex/ast"
+	"github.com/basis-ex/basicrt"
+	"github.com/basis-ex/dialect"
 )
 
-// Compile converts a parsed BASIC program into a standalone Go source file.
-func Compile(program *ast.Program) (string, error) {
+// Options adjusts how a program is compiled.
+type Options struct {
+	// Dialect selects semantics such as the value of true; the zero value
+	// is dialect.Standard.
+	Dialect dialect.Dialect
+}
+
+// RuntimePackage is the import path of the package the Go that Compile
+// writes calls on, which must be available where it is built.
+const RuntimePackage = "github.com/basis-ex/basicrt"
+
+// Compile converts a parsed BASIC program into a Go main package of one
+// file, which imports RuntimePackage.
+func Compile(program *ast.Program, opts ...Options) (string, error) {
+	var opt Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
 	lines := make([]int, 0, len(program.Statements))
 	for line := range program.Statements {
 		lines = append(lines, line)
@@ -21,61 +43,316 @@ func Compile(program *ast.Program) (string, error) {
 		lineIndex[line] = i
 	}
 
+	// Pair each FOR with its NEXT up front so loops that run zero times can
+	// jump straight past the body.
+	forNext := ast.PairLoops(program, lines)
+
+	// The program counter counts statements as ast.LayOut lays them out,
+	// those of a ':' sequence and those after THEN and ELSE each on its
+	// own, so that a RETURN, NEXT or END SUB carries on in the middle of a
+	// line, even inside an IF branch, and a jump stops the rest of it, as
+	// in the interpreter. lineStart holds the first statement of each
+	// line, and one more for the end of the program.
+	var stmts []ast.Statement
+	var stmtLines, next, orElse, end []int
+	lineStart := make([]int, len(lines)+1)
+	for i, line := range lines {
+		first := len(stmts)
+		lineStart[i] = first
+		layout := ast.LayOut(program.Statements[line])
+		for n, stmt := range layout.Statements {
+			stmts = append(stmts, stmt)
+			stmtLines = append(stmtLines, line)
+			next = append(next, first+layout.Next[n])
+			orElse = append(orElse, first+layout.Else[n])
+			end = append(end, first+layout.End[n])
+		}
+	}
+	lineStart[len(lines)] = len(stmts)
+
+	// The body is written first, as the imports depend on what it uses.
 	var out strings.Builder
 
-	out.WriteString("package main\n\n")
-	out.WriteString("import (\n")
-	out.WriteString("\t\"bufio\"\n\t\"fmt\"\n\t\"math\"\n\t\"os\"\n\t\"strconv\"\n\t\"strings\"\n")
-	out.WriteString(")\n\n")
-	out.WriteString("// keep imports used even for tiny programs\n")
-	out.WriteString("var _ = []interface{}{strconv.ParseFloat, strings.TrimSpace}\n\n")
-	out.WriteString(runtimeHelpers)
+	fmt.Fprintf(&out, "// dialect is the dialect %q.\nvar dialect = basicrt.Dialect{True: %g, BitwiseLogic: %t, ZoneWidth: %d}\n\n", opt.Dialect.Name, opt.Dialect.True(), opt.Dialect.BitwiseLogic, opt.Dialect.ZoneWidth)
 
-	fmt.Fprintf(&out, "var programLines = []int{%s}\n", joinInts(lines, ","))
+	out.WriteString("// statementLines holds the line of each statement, which pc counts.\n")
+	fmt.Fprintf(&out, "var statementLines = []int{%s}\n\n", joinInts(stmtLines, ","))
+	out.WriteString("// lineIndex maps each line to its first statement.\n")
 	out.WriteString("var lineIndex = map[int]int{\n")
-	for _, line := range lines {
-		fmt.Fprintf(&out, "\t%d: %d,\n", line, lineIndex[line])
+	for i, line := range lines {
+		fmt.Fprintf(&out, "\t%d: %d,\n", line, lineStart[i])
 	}
 	out.WriteString("}\n\n")
 
-	out.WriteString("func run() error {\n")
-	out.WriteString("\tenv := newEnv()\n")
+	data := emitData(&out, ast.DataValues(program, lines))
+	if usesRestoreLine(program, lines) {
+		offsets := ast.DataOffsets(program, lines)
+		out.WriteString("var dataOffsets = map[int]int{\n")
+		for _, line := range lines {
+			fmt.Fprintf(&out, "\t%d: %d,\n", line, offsets[line])
+		}
+		out.WriteString("}\n\n")
+	}
+
+	tmpCounter := 0
+	labelIndex := make(map[string]int, len(program.Labels))
+	for label, line := range program.Labels {
+		labelIndex[label] = lineStart[lineIndex[line]]
+	}
+	// A subroutine's loops must be structured ones, and a structured loop
+	// may GOSUB a subroutine, so the loops found with every candidate
+	// subroutine decide which remain, and are found again if any went.
+	// Both work in lines; the FOR and NEXT of each loop are lines of one
+	// statement.
+	j := findJumps(program, lines, lineIndex)
+	lineSubs := findSubroutines(program, lines, j, forNext)
+	lineLoops := structuredLoops(program, lines, lineIndex, forNext, j, lineSubs)
+	if dropUnstructured(program, lines, lineSubs, lineLoops) {
+		lineLoops = structuredLoops(program, lines, lineIndex, forNext, j, lineSubs)
+	}
+	loops := make(map[int]int)
+	for from, next := range lineLoops {
+		loops[lineStart[from]] = lineStart[next]
+	}
+
+	u := &unit{
+		program:    program,
+		stmts:      stmts,
+		stmtLines:  stmtLines,
+		next:       next,
+		orElse:     orElse,
+		end:        end,
+		lineIndex:  lineIndex,
+		lineStart:  lineStart,
+		forNext:    forNext,
+		loops:      loops,
+		labelIndex: labelIndex,
+		data:       data,
+		imports:    map[string]bool{},
+	}
+	numbers, unread := numericVariables(u)
+	u.numbers = numbers
+	u.subs = make(map[int]*subroutine, len(lineSubs))
+	for from, to := range lineSubs {
+		sub := u.newSubroutine(lineStart[from], lineStart[to+1]-1)
+		u.subs[sub.from] = sub
+	}
+	u.callStack = usesCallStack(u)
+
+	out.WriteString("// run runs the program, reading INPUT from stdin and writing to stdout and\n")
+	out.WriteString("// stderr, so it can be called with streams other than the process's own.\n")
+	out.WriteString("func run(stdin io.Reader, stdout, stderr io.Writer) error {\n")
+	out.WriteString("\tenv := basicrt.NewEnv(dialect, stdin, stdout, stderr)\n")
 	out.WriteString("\tcallStack := []int{}\n")
-	out.WriteString("\tforLoops := map[string]*forLoopState{}\n")
+	out.WriteString("\tforLoops := []*basicrt.ForLoop{}\n")
+	out.WriteString("\tframes := []*basicrt.CallFrame{}\n")
 	out.WriteString("\thalted := false\n")
 	out.WriteString("\tpc := 0\n")
-	out.WriteString("\t_ = env\n\t_ = callStack\n\t_ = forLoops\n\n")
-	out.WriteString("\tfor pc < len(programLines) && !halted {\n")
-	out.WriteString("\t\tswitch programLines[pc] {\n")
+	out.WriteString("\tdataPtr := 0\n")
+	out.WriteString("\t_ = env\n\t_ = callStack\n\t_ = forLoops\n\t_ = frames\n\t_ = dataPtr\n\n")
+	if len(numbers) > 0 {
+		locals := make([]string, 0, len(numbers))
+		for _, local := range numbers {
+			locals = append(locals, local)
+		}
+		sort.Strings(locals)
+		out.WriteString("\t// The variables that only ever hold numbers.\n")
+		fmt.Fprintf(&out, "\tvar %s float64\n", strings.Join(locals, ", "))
+		for _, local := range unread {
+			fmt.Fprintf(&out, "\t_ = %s\n", local)
+		}
+		out.WriteString("\n")
+	}
+	for i := range stmts {
+		if sub, ok := u.subs[i]; ok && !sub.inline {
+			if err := emitSubroutine(newEmitter(&out, "\t", &tmpCounter, u), sub); err != nil {
+				return "", err
+			}
+			out.WriteString("\n")
+		}
+	}
+	out.WriteString("\tfor pc < len(statementLines) && !halted {\n")
+	out.WriteString("\t\tswitch pc {\n")
 
-	tmpCounter := 0
-	for _, line := range lines {
-		stmt := program.Statements[line]
-		out.WriteString(fmt.Sprintf("\t\tcase %d:\n", line))
-		out.WriteString("\t\t\t{\n")
-		emitter := newEmitter(&out, "\t\t\t\t", &tmpCounter)
-		if err := emitStatement(emitter, stmt); err != nil {
+	for i := 0; i < len(stmts); i++ {
+		if sub, ok := u.subs[i]; ok {
+			// Only GOSUB reaches a subroutine, and it calls it.
+			i = sub.to
+			continue
+		}
+		out.WriteString(fmt.Sprintf("\t\tcase %d:\n", i))
+		emitter := newEmitter(&out, "\t\t\t", &tmpCounter, u)
+		last, err := emitStatementAt(emitter, i)
+		if err != nil {
 			return "", err
 		}
-		out.WriteString("\t\t\t}\n")
+		if last != i {
+			// The statements up to last ran in a Go loop, and nothing
+			// jumps into them, so they have no case of their own.
+			emitter.line("pc = %d", last)
+			i = last
+		}
+	}
+
+	if len(u.problems) > 0 {
+		return "", &UnsupportedError{Problems: u.problems}
 	}
 
 	out.WriteString("\t\tdefault:\n")
-	out.WriteString("\t\t\treturn fmt.Errorf(\"unknown line %d\", programLines[pc])\n")
+	out.WriteString("\t\t\treturn fmt.Errorf(\"unknown statement %d\", pc)\n")
 	out.WriteString("\t\t}\n")
 	out.WriteString("\t\tpc++\n")
 	out.WriteString("\t}\n")
 	out.WriteString("\treturn nil\n")
 	out.WriteString("}\n\n")
 
+	out.WriteString("// exitStatus is set by END n or SYSTEM n.\n")
+	out.WriteString("var exitStatus int\n\n")
 	out.WriteString("func main() {\n")
-	out.WriteString("\tif err := run(); err != nil {\n")
+	out.WriteString("\tif err := run(os.Stdin, os.Stdout, os.Stderr); err != nil {\n")
 	out.WriteString("\t\tfmt.Fprintf(os.Stderr, \"error: %v\\n\", err)\n")
 	out.WriteString("\t\tos.Exit(1)\n")
 	out.WriteString("\t}\n")
+	out.WriteString("\tos.Exit(exitStatus)\n")
 	out.WriteString("}\n")
 
-	return out.String(), nil
+	var src strings.Builder
+	src.WriteString("package main\n\n")
+	src.WriteString("import (\n")
+	for _, pkg := range []string{"fmt", "io", "math", "os", "time"} {
+		if pkg == "fmt" || pkg == "io" || pkg == "os" || u.imports[pkg] {
+			fmt.Fprintf(&src, "\t%q\n", pkg)
+		}
+	}
+	fmt.Fprintf(&src, "\n\t%q\n", RuntimePackage)
+	src.WriteString(")\n\n")
+	src.WriteString(out.String())
+
+	formatted, err := format.Source([]byte(src.String()))
+	if err != nil {
+		return "", formatError(src.String(), err)
+	}
+	return string(formatted), nil
+}
+
+// formatError reports Go that go/format rejected, which is a bug in the
+// compiler rather than in the program: the error, with the line of src it
+// is on.
+func formatError(src string, err error) error {
+	msg := fmt.Sprintf("compiler: internal error: generated Go does not parse: %v", err)
+	var list scanner.ErrorList
+	if errors.As(err, &list) && len(list) > 0 {
+		lines := strings.Split(src, "\n")
+		if n := list[0].Pos.Line; n >= 1 && n <= len(lines) {
+			msg += "\n    " + strings.TrimSpace(lines[n-1])
+		}
+	}
+	return errors.New(msg)
+}
+
+// Unsupported describes one construct the compiler cannot translate.
+type Unsupported struct {
+	Line      int
+	Source    string
+	Construct string
+}
+
+// UnsupportedError lists every construct that blocked compilation, so users
+// can fix them all in one go rather than one per attempt.
+type UnsupportedError struct {
+	Problems []Unsupported
+}
+
+func (e *UnsupportedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d unsupported construct(s) in program:", len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  line %d: %s is not supported by the compiler", p.Line, p.Construct)
+		if p.Source != "" {
+			fmt.Fprintf(&b, "\n    %s", p.Source)
+		}
+	}
+	return b.String()
+}
+
+// unit is the state shared by every emitter while compiling one program.
+type unit struct {
+	program *ast.Program
+	// stmts are the program's statements in the order pc counts them, with
+	// the line of each in stmtLines. next, orElse and end hold the
+	// statements' Next, Else and End from their lines' layouts, as indices
+	// into stmts; stmt is the statement being emitted.
+	stmts     []ast.Statement
+	stmtLines []int
+	next      []int
+	orElse    []int
+	end       []int
+	stmt      int
+	lineIndex map[int]int
+	lineStart []int
+	forNext   map[*ast.ForStatement]ast.LoopEnd
+	// loops are the FOR/NEXT pairs compiled to Go for loops, from the
+	// statement holding the FOR to the one holding the NEXT.
+	loops map[int]int
+	// numbers are the variables kept in float64 locals, as found by
+	// numericVariables.
+	numbers map[string]string
+	// subs are the subroutines compiled to Go functions, by their first
+	// statement. callStack is set when some GOSUB still goes through the
+	// dispatch, and inSub while a subroutine's function is being written.
+	subs       map[int]*subroutine
+	callStack  bool
+	inSub      bool
+	labelIndex map[string]int
+	data       dataTable
+	line       int
+	problems   []Unsupported
+	// imports are the standard packages, beyond those every program
+	// needs, that the code emitted so far uses.
+	imports map[string]bool
+}
+
+// dataTable describes how the program's DATA constants were laid out in the
+// generated source: the slice holding them and the constructor that turns
+// one element into a Value.
+type dataTable struct {
+	slice string
+	wrap  string
+}
+
+// emitData writes the DATA constants as a typed Go slice. Programs whose DATA
+// is all numbers (or all strings) get a plain []float64 ([]string) so READ is
+// a simple indexed load; mixed DATA falls back to a []Value.
+func emitData(out *strings.Builder, values []ast.Expression) dataTable {
+	if len(values) == 0 {
+		return dataTable{}
+	}
+
+	nums := []string{}
+	strs := []string{}
+	mixed := []string{}
+	for _, value := range values {
+		switch lit := value.(type) {
+		case *ast.NumberLiteral:
+			nums = append(nums, fmt.Sprintf("%g", lit.Value))
+			mixed = append(mixed, fmt.Sprintf("basicrt.NumVal(%g)", lit.Value))
+		case *ast.StringLiteral:
+			strs = append(strs, fmt.Sprintf("%q", lit.Value))
+			mixed = append(mixed, fmt.Sprintf("basicrt.StrVal(%q)", lit.Value))
+		}
+	}
+
+	switch {
+	case len(strs) == 0:
+		fmt.Fprintf(out, "var dataNums = []float64{%s}\n\n", strings.Join(nums, ", "))
+		return dataTable{slice: "dataNums", wrap: "basicrt.NumVal"}
+	case len(nums) == 0:
+		fmt.Fprintf(out, "var dataStrs = []string{%s}\n\n", strings.Join(strs, ", "))
+		return dataTable{slice: "dataStrs", wrap: "basicrt.StrVal"}
+	default:
+		fmt.Fprintf(out, "var dataValues = []basicrt.Value{%s}\n\n", strings.Join(mixed, ", "))
+		return dataTable{slice: "dataValues"}
+	}
 }
 
 // emitter helps build Go code while keeping indentation and unique temp names.
@@ -83,10 +360,34 @@ type emitter struct {
 	buf     *strings.Builder
 	indent  string
 	counter *int
+	unit    *unit
+	// branch is set inside an IF, or in a case followed by a jump past an
+	// ELSE branch, and left once this emitter has written code that always
+	// leaves the statement. straight is set where statements run straight
+	// through rather than each in a case of the dispatch: in a loop
+	// compiled to a Go for loop, a subroutine's function, or a subroutine
+	// written out at its GOSUB.
+	branch   bool
+	left     bool
+	straight bool
+}
+
+func newEmitter(buf *strings.Builder, indent string, counter *int, u *unit) *emitter {
+	return &emitter{buf: buf, indent: indent, counter: counter, unit: u}
 }
 
-func newEmitter(buf *strings.Builder, indent string, counter *int) *emitter {
-	return &emitter{buf: buf, indent: indent, counter: counter}
+// unsupported records a construct that cannot be compiled against the BASIC
+// line currently being emitted.
+func (e *emitter) unsupported(node ast.Node) {
+	construct := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	if lit := node.TokenLiteral(); lit != "" {
+		construct = fmt.Sprintf("%s (%s)", strings.ToUpper(lit), construct)
+	}
+	e.unit.problems = append(e.unit.problems, Unsupported{
+		Line:      e.unit.line,
+		Source:    e.unit.program.Source[e.unit.line],
+		Construct: construct,
+	})
 }
 
 func (e *emitter) line(format string, args ...interface{}) {
@@ -99,7 +400,68 @@ func (e *emitter) temp() string {
 }
 
 func (e *emitter) nested() *emitter {
-	return &emitter{buf: e.buf, indent: e.indent + "\t", counter: e.counter}
+	return &emitter{buf: e.buf, indent: e.indent + "\t", counter: e.counter, unit: e.unit, branch: e.branch, straight: e.straight}
+}
+
+// after returns the first statement of the line after line, where a jump
+// past that line lands.
+func (u *unit) after(line int) int {
+	return u.lineStart[u.lineIndex[line]+1]
+}
+
+// back is the statement pc is left at for the program to carry on, once pc
+// is stepped past it, after the statement being emitted: the one before
+// the next to run, which after the last statement following THEN is past
+// the ELSE branch.
+func (u *unit) back() int {
+	return u.next[u.stmt] - 1
+}
+
+// leave follows code that has set pc. Inside an IF the rest of the branch
+// must not run, and a jump past an ELSE branch must not follow, so it
+// leaves the dispatch switch straight away; elsewhere the statement is the
+// whole of its case. In a subroutine's function it returns from that.
+func (e *emitter) leave() {
+	switch {
+	case e.unit.inSub:
+		e.line("return nil")
+	case e.branch:
+		e.line("break")
+	}
+	e.left = true
+}
+
+// emitStatementAt emits statement i in a block of its own, or, when it is
+// the FOR of a structured loop, the whole loop. Where statements run
+// straight through, an IF is emitted with its branches. It returns the
+// index of the last statement emitted.
+func emitStatementAt(e *emitter, i int) (int, error) {
+	u := e.unit
+	u.line, u.stmt = u.stmtLines[i], i
+	if text := u.program.Source[u.line]; text != "" && u.lineStart[u.lineIndex[u.line]] == i {
+		// The line as written, so the Go can be read against it.
+		e.line("// %s", text)
+	}
+	e.line("{")
+	last := i
+	var err error
+	body := e.nested()
+	switch next, ok := u.loops[i]; {
+	case ok:
+		err = emitLoop(body, u.stmts[i].(*ast.ForStatement), i, next)
+		last = next
+	case e.straight:
+		err = emitStatement(body, u.stmts[i])
+		last = u.end[i] - 1
+	default:
+		body.branch = u.next[i] != i+1
+		err = emitStatement(body, u.stmts[i])
+		if body.branch && !body.left {
+			body.line("pc = %d", u.next[i]-1)
+		}
+	}
+	e.line("}")
+	return last, err
 }
 
 func emitStatement(e *emitter, stmt ast.Statement) error {
@@ -115,11 +477,16 @@ func emitStatement(e *emitter, stmt ast.Statement) error {
 	case *ast.GosubStatement:
 		return emitGosub(e, s)
 	case *ast.ReturnStatement:
+		if e.unit.inSub {
+			e.leave()
+			return nil
+		}
 		e.line("if len(callStack) == 0 {")
 		e.nested().line("return fmt.Errorf(\"RETURN without GOSUB\")")
 		e.line("}")
 		e.line("pc = callStack[len(callStack)-1]")
 		e.line("callStack = callStack[:len(callStack)-1]")
+		e.leave()
 		return nil
 	case *ast.ForStatement:
 		return emitFor(e, s)
@@ -128,13 +495,121 @@ func emitStatement(e *emitter, stmt ast.Statement) error {
 	case *ast.InputStatement:
 		return emitInput(e, s)
 	case *ast.EndStatement:
-		e.line("halted = true")
-		return nil
+		return emitEnd(e, s)
 	case *ast.RemStatement:
 		return nil
+	case *ast.LabelStatement:
+		return nil
 	case *ast.DimStatement:
-		e.line("env.ensureArray(%q)", s.Name.Value)
+		size, err := emitExpression(e, s.Size)
+		if err != nil {
+			return err
+		}
+		sizeNum := e.temp()
+		e.line("%s, err := basicrt.MustNumber(%s)", sizeNum, size)
+		e.line("if err != nil {")
+		e.nested().line("return fmt.Errorf(\"DIM size must be a number\")")
+		e.line("}")
+		e.line("env.Dim(%q, int(%s))", s.Name.Value, sizeNum)
+		return nil
+	case *ast.DumpStatement:
+		e.line("env.Dump(statementLines, forLoops, callStack)")
+		return nil
+	case *ast.PokeStatement:
+		addr, err := emitExpression(e, s.Address)
+		if err != nil {
+			return err
+		}
+		val, err := emitExpression(e, s.Value)
+		if err != nil {
+			return err
+		}
+		e.line("if err := basicrt.Poke(%s, %s); err != nil {", addr, val)
+		e.nested().line("return err")
+		e.line("}")
+		return nil
+	case *ast.FilesStatement:
+		pattern, err := emitOptional(e, s.Pattern)
+		if err != nil {
+			return err
+		}
+		e.line("if err := env.Files(%s); err != nil {", pattern)
+		e.nested().line("return err")
+		e.line("}")
+		return nil
+	case *ast.KillStatement:
+		return emitCall(e, "basicrt.Kill", s.File)
+	case *ast.NameStatement:
+		return emitCall(e, "basicrt.Rename", s.From, s.To)
+	case *ast.ChdirStatement:
+		return emitCall(e, "basicrt.Chdir", s.Directory)
+	case *ast.SubStatement:
+		return emitSub(e, s)
+	case *ast.CallStatement:
+		return emitCallSub(e, s)
+	case *ast.EndSubStatement:
+		return emitEndSub(e)
+	case *ast.ClsStatement:
+		e.line("env.Cls()")
+		return nil
+	case *ast.LocateStatement:
+		row, err := emitOptional(e, s.Row)
+		if err != nil {
+			return err
+		}
+		col, err := emitOptional(e, s.Column)
+		if err != nil {
+			return err
+		}
+		e.line("if err := env.Locate(%s, %s); err != nil {", row, col)
+		e.nested().line("return err")
+		e.line("}")
 		return nil
+	case *ast.ColorStatement:
+		fg, err := emitOptional(e, s.Foreground)
+		if err != nil {
+			return err
+		}
+		bg, err := emitOptional(e, s.Background)
+		if err != nil {
+			return err
+		}
+		e.line("if err := env.Color(%s, %s); err != nil {", fg, bg)
+		e.nested().line("return err")
+		e.line("}")
+		return nil
+	case *ast.ShellStatement:
+		command := "basicrt.StrVal(\"\")"
+		if s.Command != nil {
+			val, err := emitExpression(e, s.Command)
+			if err != nil {
+				return err
+			}
+			command = val
+		}
+		e.line("if err := env.Shell(%s); err != nil {", command)
+		e.nested().line("return err")
+		e.line("}")
+		return nil
+	case *ast.SleepStatement:
+		seconds, err := emitExpression(e, s.Seconds)
+		if err != nil {
+			return err
+		}
+		secs := e.temp()
+		e.line("%s, err := basicrt.MustNumber(%s)", secs, seconds)
+		e.line("if err != nil || %s < 0 {", secs)
+		e.nested().line("return fmt.Errorf(\"SLEEP requires a number of seconds\")")
+		e.line("}")
+		e.unit.imports["time"] = true
+		e.line("time.Sleep(time.Duration(%s * float64(time.Second)))", secs)
+		return nil
+	case *ast.DataStatement:
+		return nil
+	case *ast.ReadStatement:
+		return emitRead(e, s)
+	case *ast.RestoreStatement:
+		return emitRestore(e, s)
 	case *ast.ExpressionStatement:
 		val, err := emitExpression(e, s.Expression)
 		if err != nil {
@@ -143,20 +618,25 @@ func emitStatement(e *emitter, stmt ast.Statement) error {
 		e.line("_ = %s", val)
 		return nil
 	case *ast.SequenceStatement:
+		// Only a branch of an IF still holds a sequence.
 		for _, inner := range s.Statements {
 			if err := emitStatement(e, inner); err != nil {
 				return err
 			}
+			if e.left {
+				break
+			}
 		}
 		return nil
 	default:
-		return fmt.Errorf("compiler: unsupported statement %T", stmt)
+		e.unsupported(stmt)
+		return nil
 	}
 }
 
 func emitPrint(e *emitter, stmt *ast.PrintStatement) error {
 	if len(stmt.Expressions) == 0 {
-		e.line("fmt.Println()")
+		e.line(`env.Print("\n")`)
 		return nil
 	}
 
@@ -165,41 +645,87 @@ func emitPrint(e *emitter, stmt *ast.PrintStatement) error {
 		if err != nil {
 			return err
 		}
-		e.line("fmt.Print(%s.inspect())", val)
+		e.line("env.Print(%s.Inspect())", val)
 
 		if i < len(stmt.Separators) {
-			sep := stmt.Separators[i]
-			e.line("fmt.Print(%q)", sep)
+			if sep := stmt.Separators[i]; sep == "\t" {
+				e.line("env.PrintZone()")
+			} else {
+				e.line("env.Print(%q)", sep)
+			}
 		}
 	}
 
 	if stmt.TrailingNewline {
-		e.line("fmt.Println()")
+		e.line(`env.Print("\n")`)
 	}
 	return nil
 }
 
 func emitLet(e *emitter, stmt *ast.LetStatement) error {
+	if stmt.Index != nil {
+		return emitElementAssignment(e, stmt)
+	}
+	if _, ok := e.unit.numbers[stmt.Name.Value]; ok {
+		val, err := emitNumber(e, stmt.Value)
+		if err != nil {
+			return err
+		}
+		e.assignNumber(stmt.Name.Value, val)
+		return nil
+	}
 	val, err := emitExpression(e, stmt.Value)
 	if err != nil {
 		return err
 	}
-	e.line("env.set(%q, %s)", stmt.Name.Value, val)
+	e.line("env.Set(%q, %s)", stmt.Name.Value, val)
 	return nil
 }
 
-func emitIf(e *emitter, stmt *ast.IfStatement) error {
-	cond, err := emitExpression(e, stmt.Condition)
+// emitElementAssignment emits LET A(I) = value, which works out the index
+// and value before checking the subscript, as the interpreter does.
+func emitElementAssignment(e *emitter, stmt *ast.LetStatement) error {
+	index, err := emitExpression(e, stmt.Index)
 	if err != nil {
 		return err
 	}
-	e.line("if truthy(%s) {", cond)
-	if err := emitStatement(e.nested(), stmt.Consequence); err != nil {
+	val, err := emitExpression(e, stmt.Value)
+	if err != nil {
+		return err
+	}
+	e.line("if err := env.SetElement(%q, %s, %s); err != nil {", stmt.Name.Value, index, val)
+	e.nested().line("return err")
+	e.line("}")
+	return nil
+}
+
+func emitIf(e *emitter, stmt *ast.IfStatement) error {
+	if !e.straight {
+		return emitIfJump(e, stmt)
+	}
+	if isNumber(e.unit.numbers, stmt.Condition) {
+		cond, err := emitNumber(e, stmt.Condition)
+		if err != nil {
+			return err
+		}
+		e.line("if %s != 0 {", cond)
+	} else {
+		cond, err := emitExpression(e, stmt.Condition)
+		if err != nil {
+			return err
+		}
+		e.line("if basicrt.Truthy(%s) {", cond)
+	}
+	branch := e.nested()
+	branch.branch = true
+	if err := emitStatement(branch, stmt.Consequence); err != nil {
 		return err
 	}
 	if stmt.Alternative != nil {
 		e.line("} else {")
-		if err := emitStatement(e.nested(), stmt.Alternative); err != nil {
+		branch := e.nested()
+		branch.branch = true
+		if err := emitStatement(branch, stmt.Alternative); err != nil {
 			return err
 		}
 	}
@@ -207,156 +733,346 @@ func emitIf(e *emitter, stmt *ast.IfStatement) error {
 	return nil
 }
 
+// emitIfJump emits an IF in the dispatch, where the statements after THEN
+// and ELSE are laid out after it with cases of their own: it carries on
+// with those after THEN, or when its condition is false jumps to those
+// after ELSE.
+func emitIfJump(e *emitter, stmt *ast.IfStatement) error {
+	if isNumber(e.unit.numbers, stmt.Condition) {
+		cond, err := emitNumber(e, stmt.Condition)
+		if err != nil {
+			return err
+		}
+		e.line("if %s == 0 {", cond)
+	} else {
+		cond, err := emitExpression(e, stmt.Condition)
+		if err != nil {
+			return err
+		}
+		e.line("if !basicrt.Truthy(%s) {", cond)
+	}
+	skip := e.nested()
+	skip.line("pc = %d", e.unit.orElse[e.unit.stmt]-1)
+	skip.leave()
+	e.line("}")
+	return nil
+}
+
 func emitGoto(e *emitter, stmt *ast.GotoStatement) error {
-	targetVal, err := emitExpression(e, stmt.LineNumber)
+	target, err := emitJumpTarget(e, stmt.LineNumber, "GOTO")
 	if err != nil {
 		return err
 	}
-	numVar := e.temp()
-	e.line("%s, err := mustNumber(%s)", numVar, targetVal)
-	e.line("if err != nil {")
-	e.nested().line("return fmt.Errorf(\"GOTO requires a number\")")
-	e.line("}")
-	e.line("lineNum := int(%s)", numVar)
-	e.line("idx, ok := lineIndex[lineNum]")
-	e.line("if !ok {")
-	e.nested().line("return fmt.Errorf(\"line %d not found\", lineNum)")
-	e.line("}")
-	e.line("pc = idx - 1")
+	e.line("pc = %s - 1", target)
+	e.leave()
 	return nil
 }
 
 func emitGosub(e *emitter, stmt *ast.GosubStatement) error {
-	targetVal, err := emitExpression(e, stmt.LineNumber)
+	if sub, ok := e.unit.subroutine(stmt.LineNumber); ok {
+		return emitGosubCall(e, sub)
+	}
+	target, err := emitJumpTarget(e, stmt.LineNumber, "GOSUB")
 	if err != nil {
 		return err
 	}
+	e.line("if len(callStack) >= basicrt.MaxGosubDepth {")
+	e.nested().line("return fmt.Errorf(\"Out of memory in line %d\")", e.unit.line)
+	e.line("}")
+	e.line("callStack = append(callStack, %d)", e.unit.back())
+	e.line("pc = %s - 1", target)
+	e.leave()
+	return nil
+}
+
+// emitJumpTarget produces the program index a GOTO or GOSUB lands on. Named
+// labels are resolved at compile time; anything else is a line number
+// computed and looked up at run time.
+func emitJumpTarget(e *emitter, expr ast.Expression, keyword string) (string, error) {
+	if ident, ok := expr.(*ast.Identifier); ok {
+		if idx, ok := e.unit.labelIndex[ident.Value]; ok {
+			return fmt.Sprintf("%d", idx), nil
+		}
+	}
+
+	targetVal, err := emitExpression(e, expr)
+	if err != nil {
+		return "", err
+	}
 	numVar := e.temp()
-	e.line("%s, err := mustNumber(%s)", numVar, targetVal)
+	idx := e.temp()
+	e.line("%s, err := basicrt.MustNumber(%s)", numVar, targetVal)
 	e.line("if err != nil {")
-	e.nested().line("return fmt.Errorf(\"GOSUB requires a number\")")
+	e.nested().line("return fmt.Errorf(\"%s requires a number\")", keyword)
 	e.line("}")
-	e.line("lineNum := int(%s)", numVar)
-	e.line("idx, ok := lineIndex[lineNum]")
+	e.line("%s, ok := lineIndex[int(%s)]", idx, numVar)
 	e.line("if !ok {")
-	e.nested().line("return fmt.Errorf(\"line %d not found\", lineNum)")
+	e.nested().line("return fmt.Errorf(%q, int(%s))", "line %d not found", numVar)
 	e.line("}")
-	e.line("callStack = append(callStack, pc)")
-	e.line("pc = idx - 1")
+	return idx, nil
+}
+
+// emitEnd stops the program. END n and SYSTEM n also set the status main
+// exits with.
+func emitEnd(e *emitter, stmt *ast.EndStatement) error {
+	if stmt.Status != nil {
+		statusVal, err := emitExpression(e, stmt.Status)
+		if err != nil {
+			return err
+		}
+		numVar := e.temp()
+		e.line("%s, err := basicrt.MustNumber(%s)", numVar, statusVal)
+		e.unit.imports["math"] = true
+		e.line("if err != nil || %s < 0 || %s > 255 || %s != math.Trunc(%s) {", numVar, numVar, numVar, numVar)
+		e.nested().line("return fmt.Errorf(%q)", strings.ToUpper(stmt.Token.Literal)+" status must be 0 to 255")
+		e.line("}")
+		e.line("exitStatus = int(%s)", numVar)
+	}
+	e.line("halted = true")
+	e.leave()
 	return nil
 }
 
 func emitFor(e *emitter, stmt *ast.ForStatement) error {
-	startVal, err := emitExpression(e, stmt.Start)
-	if err != nil {
-		return err
-	}
-	endVal, err := emitExpression(e, stmt.End)
-	if err != nil {
-		return err
-	}
-	stepVal, err := emitExpression(e, stmt.Step)
+	startNum, endNum, stepNum, err := emitForBounds(e, stmt)
 	if err != nil {
 		return err
 	}
 
-	startNum := e.temp()
-	endNum := e.temp()
-	stepNum := e.temp()
-
-	e.line("%s, err := mustNumber(%s)", startNum, startVal)
-	e.line("if err != nil {")
-	e.nested().line("return fmt.Errorf(\"FOR start value must be a number\")")
-	e.line("}")
-	e.line("%s, err := mustNumber(%s)", endNum, endVal)
-	e.line("if err != nil {")
-	e.nested().line("return fmt.Errorf(\"FOR end value must be a number\")")
-	e.line("}")
-	e.line("%s, err := mustNumber(%s)", stepNum, stepVal)
-	e.line("if err != nil {")
-	e.nested().line("return fmt.Errorf(\"FOR step value must be a number\")")
+	e.assignNumber(stmt.Variable.Value, startNum)
+	e.line("forLoops = basicrt.DropForLoop(forLoops, %q)", stmt.Variable.Value)
+	e.line("if basicrt.LoopContinues(%s, %s, %s) {", startNum, endNum, stepNum)
+	e.nested().line("forLoops = append(forLoops, &basicrt.ForLoop{Var: %q, End: %s, Step: %s, StartPC: %d})", stmt.Variable.Value, endNum, stepNum, e.unit.back())
+	e.line("} else {")
+	if next, ok := e.unit.forNext[stmt]; ok {
+		// As in the interpreter, the loop carries on after its NEXT.
+		skip := e.nested()
+		skip.line("pc = %d", e.unit.next[e.unit.lineStart[next.Line]+next.Stmt]-1)
+		skip.leave()
+	} else {
+		e.nested().line("return fmt.Errorf(\"FOR without NEXT\")")
+	}
 	e.line("}")
-
-	e.line("env.set(%q, numVal(%s))", stmt.Variable.Value, startNum)
-	e.line("forLoops[%q] = &forLoopState{End: %s, Step: %s, StartPC: pc}", stmt.Variable.Value, endNum, stepNum)
 	return nil
 }
 
+// emitForBounds works out a FOR's start, end and step, each of which must
+// be a number, into float64 temporaries.
+func emitForBounds(e *emitter, stmt *ast.ForStatement) (startNum, endNum, stepNum string, err error) {
+	bounds := []struct {
+		expr ast.Expression
+		what string
+		val  string
+		num  string
+	}{
+		{expr: stmt.Start, what: "start"},
+		{expr: stmt.Limit, what: "end"},
+		{expr: stmt.Step, what: "step"},
+	}
+	// All three are worked out before any is checked, and a bound that is
+	// sure to be a number needs no check, only keeping as it is now.
+	for i := range bounds {
+		b := &bounds[i]
+		if isNumber(e.unit.numbers, b.expr) {
+			num, err := emitNumber(e, b.expr)
+			if err != nil {
+				return "", "", "", err
+			}
+			b.num = e.temp()
+			e.line("%s := %s", b.num, num)
+			continue
+		}
+		b.val, err = emitExpression(e, b.expr)
+		if err != nil {
+			return "", "", "", err
+		}
+	}
+	for i := range bounds {
+		b := &bounds[i]
+		if b.num != "" {
+			continue
+		}
+		b.num = e.temp()
+		e.line("%s, err := basicrt.MustNumber(%s)", b.num, b.val)
+		e.line("if err != nil {")
+		e.nested().line("return fmt.Errorf(\"FOR %s value must be a number\")", b.what)
+		e.line("}")
+	}
+	return bounds[0].num, bounds[1].num, bounds[2].num, nil
+}
+
 func emitNext(e *emitter, stmt *ast.NextStatement) error {
-	varName := stmt.Variable
-	if varName != nil {
-		e.line("loopName := %q", varName.Value)
+	loopIdx := e.temp()
+	if stmt.Variable != nil {
+		e.line("%s := basicrt.FindForLoop(forLoops, %q)", loopIdx, stmt.Variable.Value)
 	} else {
-		e.line("loopName := \"\"")
-		e.line("for name := range forLoops {")
-		e.nested().line("loopName = name")
-		e.nested().line("break")
-		e.line("}")
+		e.line("%s := len(forLoops) - 1", loopIdx)
 	}
 
-	e.line("if loopName == \"\" {")
+	e.line("if %s < 0 {", loopIdx)
 	e.nested().line("return fmt.Errorf(\"NEXT without FOR\")")
 	e.line("}")
 
-	e.line("loopState, ok := forLoops[loopName]")
-	e.line("if !ok {")
-	e.nested().line("return fmt.Errorf(\"NEXT without matching FOR\")")
-	e.line("}")
-
-	e.line("val := env.get(loopName)")
-	e.line("if !val.isNumber() {")
-	e.nested().line("return fmt.Errorf(\"loop variable must be a number\")")
-	e.line("}")
+	loopState := e.temp()
+	e.line("forLoops = forLoops[:%s+1]", loopIdx)
+	e.line("%s := forLoops[%s]", loopState, loopIdx)
 
 	newVal := e.temp()
-	e.line("%s := val.num + loopState.Step", newVal)
-	e.line("shouldContinue := false")
-	e.line("if loopState.Step > 0 {")
-	e.nested().line("shouldContinue = %s <= loopState.End", newVal)
+	local, ok := "", false
+	if stmt.Variable != nil {
+		local, ok = e.unit.numbers[stmt.Variable.Value]
+	}
+	if ok {
+		e.line("%s := %s + %s.Step", newVal, local, loopState)
+	} else {
+		val := e.temp()
+		e.line("%s := env.Get(%s.Var)", val, loopState)
+		e.line("if !%s.IsNumber() {", val)
+		e.nested().line("return fmt.Errorf(\"loop variable must be a number\")")
+		e.line("}")
+		e.line("%s := %s.Number() + %s.Step", newVal, val, loopState)
+	}
+	e.line("if basicrt.LoopContinues(%s, %s.End, %s.Step) {", newVal, loopState, loopState)
+	loop := e.nested()
+	if ok {
+		loop.line("%s = %s", local, newVal)
+	} else {
+		loop.line("env.Set(%s.Var, basicrt.NumVal(%s))", loopState, newVal)
+	}
+	loop.line("pc = %s.StartPC", loopState)
+	loop.leave()
 	e.line("} else {")
-	e.nested().line("shouldContinue = %s >= loopState.End", newVal)
+	e.nested().line("forLoops = forLoops[:%s]", loopIdx)
 	e.line("}")
+	return nil
+}
 
-	e.line("if shouldContinue {")
-	e.nested().line("env.set(loopName, numVal(%s))", newVal)
-	e.nested().line("pc = loopState.StartPC")
-	e.line("} else {")
-	e.nested().line("delete(forLoops, loopName)")
+// emitRead emits READ, which, as in the interpreter, works out an array
+// element's index before reading its item, and will not put a string item
+// in a numeric variable.
+func emitRead(e *emitter, stmt *ast.ReadStatement) error {
+	data := e.unit.data
+	for _, target := range stmt.Variables {
+		name, index := "", ""
+		switch v := target.(type) {
+		case *ast.Identifier:
+			name = v.Value
+		case *ast.ArrayAccess:
+			name = v.Name.Value
+			var err error
+			if index, err = emitExpression(e, v.Index); err != nil {
+				return err
+			}
+		}
+		if data.slice == "" {
+			e.line("return fmt.Errorf(\"Out of DATA\")")
+			return nil
+		}
+		e.line("if dataPtr >= len(%s) {", data.slice)
+		e.nested().line("return fmt.Errorf(\"Out of DATA\")")
+		e.line("}")
+		if !strings.HasSuffix(name, "$") {
+			switch data.slice {
+			case "dataStrs":
+				e.line("return fmt.Errorf(\"Type mismatch in READ\")")
+				return nil
+			case "dataValues":
+				e.line("if !%s[dataPtr].IsNumber() {", data.slice)
+				e.nested().line("return fmt.Errorf(\"Type mismatch in READ\")")
+				e.line("}")
+			}
+		}
+		item := fmt.Sprintf("%s(%s[dataPtr])", data.wrap, data.slice)
+		local, isLocal := e.unit.numbers[name]
+		switch {
+		case index != "":
+			e.line("if err := env.SetElement(%q, %s, %s); err != nil {", name, index, item)
+			e.nested().line("return err")
+			e.line("}")
+		case isLocal && data.slice == "dataNums":
+			e.line("%s = %s[dataPtr]", local, data.slice)
+		default:
+			e.line("env.Set(%q, %s)", name, item)
+		}
+		e.line("dataPtr++")
+	}
+	return nil
+}
+
+func emitRestore(e *emitter, stmt *ast.RestoreStatement) error {
+	if stmt.LineNumber == nil {
+		e.line("dataPtr = 0")
+		return nil
+	}
+
+	targetVal, err := emitExpression(e, stmt.LineNumber)
+	if err != nil {
+		return err
+	}
+	numVar := e.temp()
+	offset := e.temp()
+	e.line("%s, err := basicrt.MustNumber(%s)", numVar, targetVal)
+	e.line("if err != nil {")
+	e.nested().line("return fmt.Errorf(\"RESTORE requires a number\")")
+	e.line("}")
+	e.line("%s, ok := dataOffsets[int(%s)]", offset, numVar)
+	e.line("if !ok {")
+	e.nested().line("return fmt.Errorf(%q, int(%s))", "line %d not found", numVar)
 	e.line("}")
+	e.line("dataPtr = %s", offset)
 	return nil
 }
 
-func emitInput(e *emitter, stmt *ast.InputStatement) error {
-	if stmt.Prompt != "" {
-		prompt := stmt.Prompt
-		e.line("fmt.Print(%q)", prompt)
-		if !strings.HasSuffix(prompt, " ") {
-			e.line("fmt.Print(\" \")")
+// usesRestoreLine reports whether any RESTORE names a line, which is the
+// only time the generated program needs its line-to-DATA offset table.
+func usesRestoreLine(program *ast.Program, lines []int) bool {
+	for _, line := range lines {
+		if containsStatement(program.Statements[line], func(stmt ast.Statement) bool {
+			restore, ok := stmt.(*ast.RestoreStatement)
+			return ok && restore.LineNumber != nil
+		}) {
+			return true
 		}
 	}
+	return false
+}
+
+// containsStatement reports whether match holds for stmt or any statement
+// nested inside it through ':' sequences and IF branches.
+func containsStatement(stmt ast.Statement, match func(ast.Statement) bool) bool {
+	switch s := stmt.(type) {
+	case *ast.SequenceStatement:
+		for _, inner := range s.Statements {
+			if containsStatement(inner, match) {
+				return true
+			}
+		}
+		return false
+	case *ast.IfStatement:
+		if match(s) || containsStatement(s.Consequence, match) {
+			return true
+		}
+		return s.Alternative != nil && containsStatement(s.Alternative, match)
+	default:
+		return match(stmt)
+	}
+}
 
-	e.line("line, err := env.reader.ReadString('\\n')")
+func emitInput(e *emitter, stmt *ast.InputStatement) error {
+	names := make([]string, len(stmt.Variables))
+	for i, ident := range stmt.Variables {
+		names[i] = fmt.Sprintf("%q", ident.Value)
+	}
+	e.line("values, err := env.ReadInput(%q, []string{%s})", stmt.PromptText(), strings.Join(names, ", "))
 	e.line("if err != nil {")
 	e.nested().line("return err")
 	e.line("}")
-	e.line("line = strings.TrimSpace(line)")
-	e.line("parts := strings.Split(line, \",\")")
-
 	for i, ident := range stmt.Variables {
-		valVar := e.temp()
-		e.line("var %s Value", valVar)
-		e.line("if len(parts) > %d {", i)
-		valEmitter := e.nested()
-		valEmitter.line("text := strings.TrimSpace(parts[%d])", i)
-		valEmitter.line("if num, err := strconv.ParseFloat(text, 64); err == nil {")
-		valEmitter.nested().line("%s = numVal(num)", valVar)
-		valEmitter.line("} else {")
-		valEmitter.nested().line("%s = strVal(text)", valVar)
-		valEmitter.line("}")
-		e.line("} else {")
-		e.nested().line("%s = numVal(0)", valVar)
-		e.line("}")
-		e.line("env.set(%q, %s)", ident.Value, valVar)
+		if local, ok := e.unit.numbers[ident.Value]; ok {
+			e.line("%s = values[%d].Number()", local, i)
+		} else {
+			e.line("env.Set(%q, values[%d])", ident.Value, i)
+		}
 	}
 	return nil
 }
@@ -365,17 +1081,31 @@ func emitExpression(e *emitter, expr ast.Expression) (string, error) {
 	switch node := expr.(type) {
 	case *ast.NumberLiteral:
 		tmp := e.temp()
-		e.line("%s := numVal(%g)", tmp, node.Value)
+		e.line("%s := basicrt.NumVal(%g)", tmp, node.Value)
 		return tmp, nil
 	case *ast.StringLiteral:
 		tmp := e.temp()
-		e.line("%s := strVal(%q)", tmp, node.Value)
+		e.line("%s := basicrt.StrVal(%q)", tmp, node.Value)
+		return tmp, nil
+	case *ast.BooleanLiteral:
+		tmp := e.temp()
+		e.line("%s := env.Bool(%t)", tmp, node.Value)
 		return tmp, nil
 	case *ast.Identifier:
+		if local, ok := e.unit.numbers[node.Value]; ok {
+			return "basicrt.NumVal(" + local + ")", nil
+		}
 		tmp := e.temp()
-		e.line("%s := env.get(%q)", tmp, node.Value)
+		e.line("%s := env.Get(%q)", tmp, node.Value)
 		return tmp, nil
 	case *ast.InfixExpression:
+		if e.unit.native(node) {
+			num, err := emitNumber(e, node)
+			if err != nil {
+				return "", err
+			}
+			return "basicrt.NumVal(" + num + ")", nil
+		}
 		left, err := emitExpression(e, node.Left)
 		if err != nil {
 			return "", err
@@ -385,18 +1115,44 @@ func emitExpression(e *emitter, expr ast.Expression) (string, error) {
 			return "", err
 		}
 		tmp := e.temp()
-		e.line("%s, err := applyInfix(%q, %s, %s)", tmp, node.Operator, left, right)
+		e.line("%s, err := env.Infix(%q, %s, %s)", tmp, node.Operator, left, right)
+		e.line("if err != nil {")
+		e.nested().line("return err")
+		e.line("}")
+		return tmp, nil
+	case *ast.CallExpression:
+		if !basicrt.HasBuiltin(node.Function) {
+			e.unsupported(node)
+			return "basicrt.Value{}", nil
+		}
+		args := make([]string, len(node.Arguments))
+		for i, arg := range node.Arguments {
+			val, err := emitExpression(e, arg)
+			if err != nil {
+				return "", err
+			}
+			args[i] = val
+		}
+		tmp := e.temp()
+		e.line("%s, err := basicrt.CallBuiltin(%q, []basicrt.Value{%s})", tmp, node.Function, strings.Join(args, ", "))
 		e.line("if err != nil {")
 		e.nested().line("return err")
 		e.line("}")
 		return tmp, nil
 	case *ast.PrefixExpression:
+		if e.unit.native(node) {
+			num, err := emitNumber(e, node)
+			if err != nil {
+				return "", err
+			}
+			return "basicrt.NumVal(" + num + ")", nil
+		}
 		right, err := emitExpression(e, node.Right)
 		if err != nil {
 			return "", err
 		}
 		tmp := e.temp()
-		e.line("%s, err := applyPrefix(%q, %s)", tmp, node.Operator, right)
+		e.line("%s, err := env.Prefix(%q, %s)", tmp, node.Operator, right)
 		e.line("if err != nil {")
 		e.nested().line("return err")
 		e.line("}")
@@ -407,217 +1163,50 @@ func emitExpression(e *emitter, expr ast.Expression) (string, error) {
 			return "", err
 		}
 		tmp := e.temp()
-		e.line("%s, err := arrayAccess(env, %q, %s)", tmp, node.Name.Value, index)
+		e.line("%s, err := env.Element(%q, %s)", tmp, node.Name.Value, index)
 		e.line("if err != nil {")
 		e.nested().line("return err")
 		e.line("}")
 		return tmp, nil
 	default:
-		return "", fmt.Errorf("compiler: unsupported expression %T", expr)
-	}
-}
-
-func joinInts(values []int, sep string) string {
-	parts := make([]string, len(values))
-	for i, v := range values {
-		parts[i] = fmt.Sprintf("%d", v)
-	}
-	return strings.Join(parts, sep)
-}
-
-const runtimeHelpers = `
-type valueKind int
-
-const (
-	numberKind valueKind = iota
-	stringKind
-)
-
-type Value struct {
-	kind valueKind
-	num  float64
-	str  string
-}
-
-func numVal(v float64) Value { return Value{kind: numberKind, num: v} }
-func strVal(v string) Value  { return Value{kind: stringKind, str: v} }
-
-func (v Value) isNumber() bool { return v.kind == numberKind }
-func (v Value) inspect() string {
-	if v.kind == numberKind {
-		return fmt.Sprintf("%g", v.num)
-	}
-	return v.str
-}
-
-type env struct {
-	vars   map[string]Value
-	arrays map[string]map[int]Value
-	reader *bufio.Reader
-}
-
-func newEnv() *env {
-	return &env{
-		vars:   map[string]Value{},
-		arrays: map[string]map[int]Value{},
-		reader: bufio.NewReader(os.Stdin),
-	}
-}
-
-func (e *env) get(name string) Value {
-	if v, ok := e.vars[name]; ok {
-		return v
+		e.unsupported(expr)
+		return "basicrt.Value{}", nil
 	}
-	return numVal(0)
 }
 
-func (e *env) set(name string, val Value) {
-	e.vars[name] = val
-}
-
-func (e *env) ensureArray(name string) {
-	if _, ok := e.arrays[name]; !ok {
-		e.arrays[name] = map[int]Value{}
-	}
-}
-
-func (e *env) array(name string) (map[int]Value, bool) {
-	arr, ok := e.arrays[name]
-	return arr, ok
-}
-
-type forLoopState struct {
-	End     float64
-	Step    float64
-	StartPC int
-}
-
-func mustNumber(v Value) (float64, error) {
-	if !v.isNumber() {
-		return 0, fmt.Errorf("expected number")
-	}
-	return v.num, nil
-}
-
-func truthy(v Value) bool {
-	if v.kind == numberKind {
-		return v.num != 0
-	}
-	return v.str != ""
-}
-
-func applyPrefix(op string, right Value) (Value, error) {
-	switch op {
-	case "-":
-		if !right.isNumber() {
-			return Value{}, fmt.Errorf("cannot negate non-number")
-		}
-		return numVal(-right.num), nil
-	case "NOT":
-		if truthy(right) {
-			return numVal(0), nil
-		}
-		return numVal(1), nil
-	default:
-		return Value{}, fmt.Errorf("unknown operator: %s", op)
-	}
-}
-
-func applyInfix(op string, left, right Value) (Value, error) {
-	if left.isNumber() && right.isNumber() {
-		switch op {
-		case "+":
-			return numVal(left.num + right.num), nil
-		case "-":
-			return numVal(left.num - right.num), nil
-		case "*":
-			return numVal(left.num * right.num), nil
-		case "/":
-			if right.num == 0 {
-				return Value{}, fmt.Errorf("division by zero")
-			}
-			return numVal(left.num / right.num), nil
-		case "MOD":
-			return numVal(math.Mod(left.num, right.num)), nil
-		case "<":
-			if left.num < right.num {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case ">":
-			if left.num > right.num {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case "<=":
-			if left.num <= right.num {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case ">=":
-			if left.num >= right.num {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case "==":
-			if left.num == right.num {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case "<>":
-			if left.num != right.num {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case "AND":
-			if truthy(left) && truthy(right) {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case "OR":
-			if truthy(left) || truthy(right) {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		}
-	}
-
-	if left.kind == stringKind && right.kind == stringKind {
-		switch op {
-		case "+":
-			return strVal(left.str + right.str), nil
-		case "==":
-			if left.str == right.str {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
-		case "<>":
-			if left.str != right.str {
-				return numVal(1), nil
-			}
-			return numVal(0), nil
+// emitCall emits a call to a runtime helper that takes Values and returns
+// an error.
+func emitCall(e *emitter, helper string, args ...ast.Expression) error {
+	vals := make([]string, len(args))
+	for i, arg := range args {
+		val, err := emitExpression(e, arg)
+		if err != nil {
+			return err
 		}
+		vals[i] = val
 	}
-
-	return Value{}, fmt.Errorf("unsupported operation: %s %s %s", left.inspect(), op, right.inspect())
+	e.line("if err := %s(%s); err != nil {", helper, strings.Join(vals, ", "))
+	e.nested().line("return err")
+	e.line("}")
+	return nil
 }
 
-func arrayAccess(env *env, name string, index Value) (Value, error) {
-	arr, ok := env.array(name)
-	if !ok {
-		return Value{}, fmt.Errorf("array %s not defined", name)
+// emitOptional emits an optional argument, passing nil when it was left out.
+func emitOptional(e *emitter, expr ast.Expression) (string, error) {
+	if expr == nil {
+		return "nil", nil
 	}
-
-	idx, err := mustNumber(index)
+	val, err := emitExpression(e, expr)
 	if err != nil {
-		return Value{}, fmt.Errorf("array index must be a number")
+		return "", err
 	}
+	return "&" + val, nil
+}
 
-	val, ok := arr[int(idx)]
-	if !ok {
-		return numVal(0), nil
+func joinInts(values []int, sep string) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%d", v)
 	}
-
-	return val, nil
+	return strings.Join(parts, sep)
 }
-`
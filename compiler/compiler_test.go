@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+// run compiles src, runs the Go program it gives against this module's
+// runtime and returns what it printed.
+func run(t *testing.T, goTool, src string) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse %q: %s", src, strings.Join(errs, "; "))
+	}
+	code, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(file, []byte(code), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(goTool, "run", file)
+	cmd.Dir = ".."
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run: %v\n%s", err, out)
+	}
+	return string(out)
+}
+
+func TestLoopsAfterThen(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds each program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("needs the Go toolchain")
+	}
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "FOR and NEXT",
+			src:  "10 IF 1 THEN FOR I = 1 TO 3: PRINT I: NEXT I: PRINT \"AFTER\"\n20 PRINT \"L20\"\n",
+			want: "1\n2\n3\nAFTER\nL20\n",
+		},
+		{
+			name: "FOR that runs no times",
+			src:  "10 IF 1 THEN FOR I = 5 TO 1: PRINT \"BODY\": NEXT I: PRINT \"AFTER\"\n20 PRINT \"L20\"\n",
+			want: "AFTER\nL20\n",
+		},
+		{
+			name: "FOR inside a loop",
+			src:  "10 FOR J = 1 TO 2: IF J == 2 THEN FOR I = 1 TO 2: PRINT J * 10 + I: NEXT I\n20 NEXT J\n",
+			want: "21\n22\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(t, goTool, tt.src); got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGosubAfterThen(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds each program")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("needs the Go toolchain")
+	}
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "rest of the line",
+			src:  "10 IF 1 THEN GOSUB 100: PRINT \"BACK\"\n20 PRINT \"L20\"\n30 END\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: "SUB\nBACK\nL20\n",
+		},
+		{
+			name: "before ELSE",
+			src:  "10 IF 1 THEN GOSUB 100 ELSE PRINT \"ELSE\"\n20 PRINT \"L20\"\n30 END\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: "SUB\nL20\n",
+		},
+		{
+			name: "after ELSE",
+			src:  "10 IF 0 THEN PRINT \"THEN\" ELSE GOSUB 100: PRINT \"BACK\"\n20 PRINT \"L20\"\n30 END\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: "SUB\nBACK\nL20\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := run(t, goTool, tt.src); got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package compiler
+
+import (
+	"github.com/basis-ex/ast"
+)
+
+// structuredLoops finds the FOR/NEXT pairs that can be compiled to a Go for
+// loop rather than run through the line dispatch, by the index of the FOR
+// line to the index of its NEXT line. A loop qualifies when its FOR and
+// NEXT are lines of their own, no jump lands after the FOR and up to the
+// NEXT, and its body neither leaves it nor starts or ends a loop other
+// than one that qualifies too. The body may GOSUB one of subs, the
+// subroutines compiled to Go functions. A jump to a computed line could land anywhere, so a program
+// with one gets none.
+func structuredLoops(program *ast.Program, lines []int, lineIndex map[int]int, forNext map[*ast.ForStatement]ast.LoopEnd, j jumps, subs map[int]int) map[int]int {
+	if j.computed {
+		return nil
+	}
+	calls := map[*ast.GosubStatement]bool{}
+	for _, line := range lines {
+		ast.Inspect(program.Statements[line], func(node ast.Node) bool {
+			if gosub, ok := node.(*ast.GosubStatement); ok {
+				if i, ok := targetIndex(program, lineIndex, gosub.LineNumber); ok {
+					_, calls[gosub] = subs[i]
+				}
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+	}
+
+	loops := make(map[int]int)
+	// Inner loops are decided first, as whether an outer one qualifies
+	// depends on them.
+	for i := len(lines) - 1; i >= 0; i-- {
+		stmt, ok := program.Statements[lines[i]].(*ast.ForStatement)
+		if !ok {
+			continue
+		}
+		next, ok := forNext[stmt]
+		if !ok {
+			continue
+		}
+		if _, ok := program.Statements[lines[next.Line]].(*ast.NextStatement); !ok {
+			continue
+		}
+		if loopBodyQualifies(program, lines, j, calls, loops, stmt.Variable.Value, i, next.Line) {
+			loops[i] = next.Line
+		}
+	}
+	return loops
+}
+
+// loopBodyQualifies reports whether the lines after the FOR on name at
+// index from, up to its NEXT at index next, can run inside a Go for loop.
+// A FOR inside on the same variable ends the loop, which then has no NEXT,
+// so it is left to the dispatch to report. calls are the GOSUBs the body
+// may hold.
+func loopBodyQualifies(program *ast.Program, lines []int, j jumps, calls map[*ast.GosubStatement]bool, loops map[int]int, name string, from, next int) bool {
+	for i := from + 1; i <= next; i++ {
+		if j.targeted(i) {
+			return false
+		}
+		restarts := false
+		ast.Inspect(program.Statements[lines[i]], func(node ast.Node) bool {
+			if stmt, ok := node.(*ast.ForStatement); ok && stmt.Variable.Value == name {
+				restarts = true
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+		if restarts {
+			return false
+		}
+	}
+	for i := from + 1; i < next; i++ {
+		if end, ok := loops[i]; ok {
+			i = end
+			continue
+		}
+		stays := true
+		ast.Inspect(program.Statements[lines[i]], func(node ast.Node) bool {
+			switch s := node.(type) {
+			case *ast.GosubStatement:
+				if !calls[s] {
+					stays = false
+				}
+			case *ast.GotoStatement, *ast.ReturnStatement, *ast.EndStatement,
+				*ast.ForStatement, *ast.NextStatement, *ast.SubStatement, *ast.EndSubStatement,
+				*ast.CallStatement, *ast.OnTimerStatement, *ast.DumpStatement:
+				stays = false
+			}
+			_, ok := node.(ast.Statement)
+			return stays && ok
+		})
+		if !stays {
+			return false
+		}
+	}
+	return true
+}
+
+// emitLoop emits the FOR at statement from, the statements of its body and
+// its NEXT at statement next as a Go for loop. It does what emitFor and emitNext do
+// without keeping the loop in forLoops, which nothing inside can see.
+func emitLoop(e *emitter, stmt *ast.ForStatement, from, next int) error {
+	startNum, endNum, stepNum, err := emitForBounds(e, stmt)
+	if err != nil {
+		return err
+	}
+	name := stmt.Variable.Value
+	e.assignNumber(name, startNum)
+	e.line("forLoops = basicrt.DropForLoop(forLoops, %q)", name)
+	e.line("if basicrt.LoopContinues(%s, %s, %s) {", startNum, endNum, stepNum)
+	loop := e.nested()
+	loop.line("for {")
+	body := loop.nested()
+	body.straight = true
+	for i := from + 1; i < next; i++ {
+		last, err := emitStatementAt(body, i)
+		if err != nil {
+			return err
+		}
+		i = last
+	}
+
+	e.unit.line = e.unit.stmtLines[next]
+	if text := e.unit.program.Source[e.unit.line]; text != "" {
+		body.line("// %s", text)
+	}
+	newVal := e.temp()
+	if local, ok := e.unit.numbers[name]; ok {
+		body.line("%s := %s + %s", newVal, local, stepNum)
+	} else {
+		val := e.temp()
+		body.line("%s := env.Get(%q)", val, name)
+		body.line("if !%s.IsNumber() {", val)
+		body.nested().line("return fmt.Errorf(\"loop variable must be a number\")")
+		body.line("}")
+		body.line("%s := %s.Number() + %s", newVal, val, stepNum)
+	}
+	body.line("if !basicrt.LoopContinues(%s, %s, %s) {", newVal, endNum, stepNum)
+	body.nested().line("break")
+	body.line("}")
+	body.assignNumber(name, newVal)
+	loop.line("}")
+	e.line("}")
+	return nil
+}
@@ -0,0 +1,93 @@
+package compiler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// emitSub skips over a procedure body reached in normal flow.
+func emitSub(e *emitter, stmt *ast.SubStatement) error {
+	proc, ok := e.unit.program.Procedures[stmt.Name.Value]
+	if !ok {
+		e.line("return fmt.Errorf(%q)", fmt.Sprintf("SUB %s has no END SUB", stmt.Name.Value))
+		return nil
+	}
+	e.line("pc = %d", e.unit.after(proc.EndLine)-1)
+	e.leave()
+	return nil
+}
+
+// emitCallSub binds the arguments in a fresh scope and jumps into the
+// procedure. Plain variables are passed by reference.
+func emitCallSub(e *emitter, stmt *ast.CallStatement) error {
+	proc, ok := e.unit.program.Procedures[stmt.Name.Value]
+	if !ok {
+		e.line("return fmt.Errorf(%q)", fmt.Sprintf("SUB %s not defined", stmt.Name.Value))
+		return nil
+	}
+	if len(stmt.Arguments) != len(proc.Params) {
+		e.line("return fmt.Errorf(%q)", fmt.Sprintf("SUB %s expects %d argument(s), got %d", proc.Name, len(proc.Params), len(stmt.Arguments)))
+		return nil
+	}
+
+	e.line("if len(frames) >= basicrt.MaxGosubDepth {")
+	e.nested().line("return fmt.Errorf(\"Out of memory in line %d\")", e.unit.line)
+	e.line("}")
+
+	scope := e.temp()
+	e.line("%s := env.NewScope()", scope)
+	byRef := map[string]string{}
+	for i, arg := range stmt.Arguments {
+		val, err := emitExpression(e, arg)
+		if err != nil {
+			return err
+		}
+		param := proc.Params[i].Value
+		e.line("%s.Set(%q, %s)", scope, param, val)
+		if ident, ok := arg.(*ast.Identifier); ok {
+			byRef[param] = ident.Value
+		}
+	}
+
+	params := make([]string, 0, len(byRef))
+	for param := range byRef {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	refs := make([]string, len(params))
+	for i, param := range params {
+		refs[i] = fmt.Sprintf("%q: %q", param, byRef[param])
+	}
+
+	e.line("frames = append(frames, &basicrt.CallFrame{ReturnPC: %d, Caller: env, ForLoops: forLoops, ByRef: map[string]string{%s}})", e.unit.back(), strings.Join(refs, ", "))
+	e.line("env = %s", scope)
+	e.line("forLoops = []*basicrt.ForLoop{}")
+	e.line("pc = %d", e.unit.after(proc.Line)-1)
+	e.leave()
+	return nil
+}
+
+// emitEndSub returns from the innermost CALL, copying by-reference
+// parameters back.
+func emitEndSub(e *emitter) error {
+	frame := e.temp()
+	e.line("if len(frames) == 0 {")
+	e.nested().line("return fmt.Errorf(\"END SUB without CALL\")")
+	e.line("}")
+	e.line("%s := frames[len(frames)-1]", frame)
+	e.line("frames = frames[:len(frames)-1]")
+	e.line("for param, variable := range %s.ByRef {", frame)
+	inner := e.nested()
+	inner.line("if v, ok := env.Lookup(param); ok {")
+	inner.nested().line("%s.Caller.Set(variable, v)", frame)
+	inner.line("}")
+	e.line("}")
+	e.line("env = %s.Caller", frame)
+	e.line("forLoops = %s.ForLoops", frame)
+	e.line("pc = %s.ReturnPC", frame)
+	e.leave()
+	return nil
+}
@@ -0,0 +1,110 @@
+package compiler
+
+import (
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// SourceMap maps the lines of Go that Compile wrote back to the BASIC lines
+// they were compiled from, so that a panic or a debugger stopped in the
+// compiled program can be traced to the original listing.
+type SourceMap struct {
+	// Source names the BASIC program, when it came from a file.
+	Source string `json:"source,omitempty"`
+	// Lines lists the ranges of Go lines in order.
+	Lines []SourceRange `json:"lines"`
+}
+
+// SourceRange is a run of Go lines, counted from 1, compiled from one
+// BASIC line.
+type SourceRange struct {
+	GoStart int `json:"go_start"`
+	GoEnd   int `json:"go_end"`
+	Line    int `json:"line"`
+}
+
+// Line returns the BASIC line the Go line goLine was compiled from.
+func (m SourceMap) Line(goLine int) (int, bool) {
+	for _, r := range m.Lines {
+		if goLine >= r.GoStart && goLine <= r.GoEnd {
+			return r.Line, true
+		}
+	}
+	return 0, false
+}
+
+// MapSource works out the source map of code, the Go that Compile wrote
+// for program, from the comment holding each line as it was written.
+// A line's range starts at the case its comment opens and runs up to the
+// next line's, so the statements after the first of a ':' line, and the
+// NEXT of a loop compiled to a Go for loop, are counted to their own line.
+// The last line of a subroutine compiled to a function ends with it.
+// A program without Source, which has no such comments, maps to nothing.
+func MapSource(program *ast.Program, code string) SourceMap {
+	lines := make(map[string]int, len(program.Source))
+	for line, text := range program.Source {
+		if text != "" {
+			lines["// "+text] = line
+		}
+	}
+
+	m := SourceMap{Lines: []SourceRange{}}
+	goLines := strings.Split(code, "\n")
+	// open is set while the last range found still runs up to the next.
+	inRun, open := false, false
+	for i, text := range goLines {
+		text = strings.TrimSpace(text)
+		if strings.HasPrefix(text, "func run(") {
+			inRun = true
+			continue
+		}
+		if !inRun {
+			continue
+		}
+		if text == "default:" {
+			break
+		}
+		if n := len(m.Lines); open && isFunctionEnd(text) {
+			// The last line of a subroutine's function runs up to its
+			// closing brace.
+			end := i
+			for end > m.Lines[n-1].GoStart && strings.TrimSpace(goLines[end-1]) == "" {
+				end--
+			}
+			m.Lines[n-1].GoEnd = end
+			open = false
+			continue
+		}
+		line, ok := lines[text]
+		if !ok {
+			continue
+		}
+		start := i + 1
+		if i > 0 && strings.HasPrefix(strings.TrimSpace(goLines[i-1]), "case ") {
+			start = i
+		}
+		if n := len(m.Lines); open {
+			m.Lines[n-1].GoEnd = start - 1
+		}
+		m.Lines = append(m.Lines, SourceRange{GoStart: start, GoEnd: start, Line: line})
+		open = true
+	}
+	if n := len(m.Lines); open {
+		// The last line runs up to the dispatch's default case.
+		for i := m.Lines[n-1].GoStart; i < len(goLines); i++ {
+			if strings.TrimSpace(goLines[i-1]) == "default:" {
+				break
+			}
+			m.Lines[n-1].GoEnd = i
+		}
+	}
+	return m
+}
+
+// isFunctionEnd reports whether the Go line text follows a subroutine's
+// function: the comment opening the next, or the dispatch loop.
+func isFunctionEnd(text string) bool {
+	return strings.HasPrefix(text, "// gosub") && strings.Contains(text, " is the subroutine at line ") ||
+		strings.HasPrefix(text, "for pc < len(statementLines)")
+}
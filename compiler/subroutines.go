@@ -0,0 +1,304 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/basis-ex/ast"
+)
+
+// inlineStatements is the most statements, leaving out its RETURN, a
+// subroutine may have to be written out at each GOSUB rather than called.
+const inlineStatements = 2
+
+// jumps records the lines, by index, that GOTO, GOSUB and ON TIMER land on.
+type jumps struct {
+	gotos  []bool
+	gosubs []bool
+	// computed is set when some target is worked out as the program runs,
+	// and so could be any line.
+	computed bool
+}
+
+func findJumps(program *ast.Program, lines []int, lineIndex map[int]int) jumps {
+	j := jumps{gotos: make([]bool, len(lines)), gosubs: make([]bool, len(lines))}
+	target := func(expr ast.Expression, landed []bool) {
+		if i, ok := targetIndex(program, lineIndex, expr); ok {
+			landed[i] = true
+		} else if _, ok := expr.(*ast.NumberLiteral); !ok {
+			// A missing line fails when it runs, where a computed one
+			// could be any.
+			j.computed = true
+		}
+	}
+	for _, line := range lines {
+		ast.Inspect(program.Statements[line], func(node ast.Node) bool {
+			switch s := node.(type) {
+			case *ast.GotoStatement:
+				target(s.LineNumber, j.gotos)
+			case *ast.GosubStatement:
+				target(s.LineNumber, j.gosubs)
+			case *ast.OnTimerStatement:
+				target(s.Target, j.gotos)
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+	}
+	return j
+}
+
+func (j jumps) targeted(i int) bool {
+	return j.gotos[i] || j.gosubs[i]
+}
+
+// targetIndex returns the index of the line a jump to expr lands on, when
+// that is known before the program runs.
+func targetIndex(program *ast.Program, lineIndex map[int]int, expr ast.Expression) (int, bool) {
+	switch t := expr.(type) {
+	case *ast.NumberLiteral:
+		i, ok := lineIndex[int(t.Value)]
+		return i, ok
+	case *ast.Identifier:
+		if line, ok := program.Labels[t.Value]; ok {
+			return lineIndex[line], true
+		}
+	}
+	return 0, false
+}
+
+// findSubroutines finds the GOSUB targets that can be compiled to a Go
+// function, by the index of their first line to the index of the line
+// ending in their RETURN. A subroutine qualifies when only GOSUB lands on
+// its first line, the line before always leaves rather than running on
+// into it, and no jump lands on the lines after; its body may not jump,
+// GOSUB, CALL or DUMP. Its loops must be structured ones, which is for the
+// caller to check. A jump to a computed line could land anywhere, so a
+// program with one gets none.
+func findSubroutines(program *ast.Program, lines []int, j jumps, forNext map[*ast.ForStatement]ast.LoopEnd) map[int]int {
+	if j.computed {
+		return nil
+	}
+	// A FOR whose loop runs no times carries on after its NEXT, on the
+	// NEXT's line if anything follows it there, and otherwise on the next.
+	skippedTo := make([]bool, len(lines)+1)
+	for _, next := range forNext {
+		layout := ast.LayOut(program.Statements[lines[next.Line]])
+		if layout.Next[next.Stmt] < len(layout.Statements) {
+			skippedTo[next.Line] = true
+		} else {
+			skippedTo[next.Line+1] = true
+		}
+	}
+
+	subs := make(map[int]int)
+	for from := range lines {
+		if !j.gosubs[from] || j.gotos[from] || from == 0 || skippedTo[from] || !alwaysLeaves(program.Statements[lines[from-1]]) {
+			continue
+		}
+		for i := from; i < len(lines); i++ {
+			if i > from && j.targeted(i) || !staysInSubroutine(program.Statements[lines[i]]) {
+				break
+			}
+			if _, ok := lastStatement(program.Statements[lines[i]]).(*ast.ReturnStatement); ok {
+				subs[from] = i
+				break
+			}
+		}
+	}
+	return subs
+}
+
+// alwaysLeaves reports whether a line never runs on into the next one,
+// ending as it does in GOTO, RETURN, END or END SUB.
+func alwaysLeaves(stmt ast.Statement) bool {
+	switch lastStatement(stmt).(type) {
+	case *ast.GotoStatement, *ast.ReturnStatement, *ast.EndStatement, *ast.EndSubStatement:
+		return true
+	}
+	return false
+}
+
+// lastStatement returns the last of the statements making up a line.
+func lastStatement(stmt ast.Statement) ast.Statement {
+	stmts := ast.Flatten(stmt)
+	if len(stmts) == 0 {
+		return nil
+	}
+	return stmts[len(stmts)-1]
+}
+
+// staysInSubroutine reports whether a line of a subroutine's body only
+// leaves it by RETURN or END.
+func staysInSubroutine(stmt ast.Statement) bool {
+	stays := true
+	ast.Inspect(stmt, func(node ast.Node) bool {
+		switch node.(type) {
+		case *ast.GotoStatement, *ast.GosubStatement, *ast.OnTimerStatement, *ast.SubStatement,
+			*ast.EndSubStatement, *ast.CallStatement, *ast.DumpStatement:
+			stays = false
+		}
+		_, ok := node.(ast.Statement)
+		return stays && ok
+	})
+	return stays
+}
+
+// dropUnstructured removes from subs those holding a FOR or NEXT that
+// loops, the structured loops, does not compile to a Go for loop, and
+// reports whether it removed any.
+func dropUnstructured(program *ast.Program, lines []int, subs, loops map[int]int) bool {
+	inLoop := make([]bool, len(lines))
+	for from, next := range loops {
+		inLoop[from], inLoop[next] = true, true
+	}
+	dropped := false
+	for from, to := range subs {
+		for i := from; i <= to; i++ {
+			loop := false
+			ast.Inspect(program.Statements[lines[i]], func(node ast.Node) bool {
+				switch node.(type) {
+				case *ast.ForStatement, *ast.NextStatement:
+					loop = true
+				}
+				_, ok := node.(ast.Statement)
+				return ok
+			})
+			if loop && !inLoop[i] {
+				delete(subs, from)
+				dropped = true
+				break
+			}
+		}
+	}
+	return dropped
+}
+
+// subroutine is a GOSUB target compiled to a Go function, from its first
+// statement to the RETURN ending it, or written out in full at each GOSUB
+// when it is short.
+type subroutine struct {
+	line     int
+	from, to int
+	// ends is set when the subroutine may END the program.
+	ends   bool
+	inline bool
+}
+
+// newSubroutine describes the subroutine from statement from to statement
+// to.
+func (u *unit) newSubroutine(from, to int) *subroutine {
+	sub := &subroutine{line: u.stmtLines[from], from: from, to: to}
+	// Only a body that runs straight through to the RETURN is written out.
+	straight := true
+	for i := from; i < to; i++ {
+		ast.Inspect(u.stmts[i], func(node ast.Node) bool {
+			switch node.(type) {
+			case *ast.EndStatement:
+				sub.ends = true
+				straight = false
+			case *ast.ReturnStatement, *ast.ForStatement:
+				straight = false
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+	}
+	sub.inline = straight && to-from <= inlineStatements
+	return sub
+}
+
+func (sub *subroutine) name() string {
+	return fmt.Sprintf("gosub%d", sub.line)
+}
+
+// subroutine returns the subroutine a GOSUB to expr calls, if it is one.
+func (u *unit) subroutine(expr ast.Expression) (*subroutine, bool) {
+	i, ok := targetIndex(u.program, u.lineIndex, expr)
+	if !ok {
+		return nil, false
+	}
+	sub, ok := u.subs[u.lineStart[i]]
+	return sub, ok
+}
+
+// emitSubroutine writes sub as a Go function local to run, sharing its
+// variables. RETURN, and END after setting halted, return from it.
+func emitSubroutine(e *emitter, sub *subroutine) error {
+	u := e.unit
+	e.line("// %s is the subroutine at line %d.", sub.name(), sub.line)
+	e.line("%s := func() error {", sub.name())
+	body := e.nested()
+	body.straight = true
+	u.inSub = true
+	defer func() { u.inSub = false }()
+	for i := sub.from; i <= sub.to; i++ {
+		last, err := emitStatementAt(body, i)
+		if err != nil {
+			return err
+		}
+		switch u.stmts[i].(type) {
+		case *ast.ReturnStatement, *ast.EndStatement:
+			// The rest could never run.
+			last = sub.to
+		}
+		i = last
+	}
+	e.line("}")
+	return nil
+}
+
+// emitGosubCall emits a GOSUB to sub: a call of its function, or its
+// statements written out. The program then carries on after the GOSUB, as
+// it does after RETURN.
+func emitGosubCall(e *emitter, sub *subroutine) error {
+	u := e.unit
+	if u.callStack {
+		e.line("if len(callStack) >= basicrt.MaxGosubDepth {")
+		e.nested().line("return fmt.Errorf(\"Out of memory in line %d\")", u.line)
+		e.line("}")
+	}
+	if sub.inline {
+		line, stmt := u.line, u.stmt
+		inline := *e
+		inline.straight = true
+		for i := sub.from; i < sub.to; i++ {
+			last, err := emitStatementAt(&inline, i)
+			if err != nil {
+				return err
+			}
+			i = last
+		}
+		u.line, u.stmt = line, stmt
+		return nil
+	}
+	e.line("if err := %s(); err != nil {", sub.name())
+	e.nested().line("return err")
+	e.line("}")
+	if sub.ends {
+		e.line("if halted {")
+		e.nested().line("return nil")
+		e.line("}")
+	}
+	return nil
+}
+
+// usesCallStack reports whether any GOSUB goes through the dispatch, so
+// that the GOSUB stack is not always empty when a subroutine is called.
+func usesCallStack(u *unit) bool {
+	for _, stmt := range u.stmts {
+		uses := false
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			if gosub, ok := node.(*ast.GosubStatement); ok {
+				if _, ok := u.subroutine(gosub.LineNumber); !ok {
+					uses = true
+				}
+			}
+			_, ok := node.(ast.Statement)
+			return !uses && ok
+		})
+		if uses {
+			return true
+		}
+	}
+	return false
+}
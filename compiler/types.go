@@ -0,0 +1,332 @@
+package compiler
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// numericVariables finds the variables that only ever hold numbers, which
+// the compiled program keeps in float64 locals instead of its Env, by name
+// to the name of the local. A variable qualifies when everything stored in
+// it is sure to be a number: a numeric expression, a FOR, an INPUT into a
+// name without $, or a READ of DATA that is all numbers. One that is never
+// set reads as 0, so it qualifies too. A string variable never does, as it
+// also reads as 0 until set.
+//
+// A SUB's parameters and DUMP see variables by name, so a program with
+// either keeps them all in its Env, as does a loop that a NEXT without a
+// variable may close.
+func numericVariables(u *unit) (locals map[string]string, unread []string) {
+	var (
+		candidates = map[string]bool{}
+		read       = map[string]bool{}
+		excluded   = map[string]bool{}
+		lets       []*ast.LetStatement
+		forVars    []string
+		bareNext   = false
+		byName     = false
+	)
+	structured := map[ast.Statement]bool{}
+	for from, next := range u.loops {
+		structured[u.stmts[from]] = true
+		structured[u.stmts[next]] = true
+	}
+
+	var visit func(node ast.Node) bool
+	visit = func(node ast.Node) bool {
+		switch s := node.(type) {
+		case *ast.Identifier:
+			candidates[s.Value] = true
+			read[s.Value] = true
+		case *ast.ArrayAccess:
+			ast.Inspect(s.Index, visit)
+			return false
+		case *ast.DimStatement:
+			ast.Inspect(s.Size, visit)
+			return false
+		case *ast.GotoStatement:
+			if _, ok := u.labelIndex[identifierName(s.LineNumber)]; ok {
+				return false
+			}
+		case *ast.GosubStatement:
+			if _, ok := u.labelIndex[identifierName(s.LineNumber)]; ok {
+				return false
+			}
+		case *ast.LetStatement:
+			if s.Index != nil {
+				ast.Inspect(s.Index, visit)
+			} else {
+				candidates[s.Name.Value] = true
+				lets = append(lets, s)
+			}
+			ast.Inspect(s.Value, visit)
+			return false
+		case *ast.ForStatement:
+			candidates[s.Variable.Value] = true
+			if !structured[s] {
+				forVars = append(forVars, s.Variable.Value)
+			}
+			for _, expr := range []ast.Expression{s.Start, s.Limit, s.Step} {
+				ast.Inspect(expr, visit)
+			}
+			return false
+		case *ast.NextStatement:
+			if s.Variable == nil && !structured[s] {
+				bareNext = true
+			}
+			return false
+		case *ast.InputStatement:
+			for _, ident := range s.Variables {
+				candidates[ident.Value] = true
+				if strings.HasSuffix(ident.Value, "$") {
+					excluded[ident.Value] = true
+				}
+			}
+			return false
+		case *ast.ReadStatement:
+			for _, target := range s.Variables {
+				ident, ok := target.(*ast.Identifier)
+				if !ok {
+					ast.Inspect(target.(*ast.ArrayAccess).Index, visit)
+					continue
+				}
+				candidates[ident.Value] = true
+				if u.data.slice != "" && u.data.slice != "dataNums" {
+					excluded[ident.Value] = true
+				}
+			}
+			return false
+		case *ast.SubStatement, *ast.CallStatement, *ast.EndSubStatement, *ast.DumpStatement:
+			byName = true
+		}
+		return true
+	}
+	for _, stmt := range u.stmts {
+		ast.Inspect(stmt, visit)
+	}
+	if byName {
+		return nil, nil
+	}
+	if bareNext {
+		for _, name := range forVars {
+			excluded[name] = true
+		}
+	}
+
+	numbers := map[string]string{}
+	for name := range candidates {
+		if !excluded[name] {
+			numbers[name] = ""
+		}
+	}
+	// Each LET of a value that may not be a number rules its variable out,
+	// which may in turn rule out others given that variable.
+	for changed := true; changed; {
+		changed = false
+		for _, let := range lets {
+			name := let.Name.Value
+			if _, ok := numbers[name]; ok && !isNumber(numbers, let.Value) {
+				delete(numbers, name)
+				changed = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(numbers))
+	for name := range numbers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	taken := map[string]bool{}
+	for _, name := range names {
+		local := "num" + goIdentifier(name)
+		for n := 2; taken[local]; n++ {
+			local = fmt.Sprintf("num%s%d", goIdentifier(name), n)
+		}
+		taken[local] = true
+		numbers[name] = local
+		if !read[name] {
+			unread = append(unread, local)
+		}
+	}
+	return numbers, unread
+}
+
+func identifierName(expr ast.Expression) string {
+	if ident, ok := expr.(*ast.Identifier); ok {
+		return ident.Value
+	}
+	return ""
+}
+
+// goIdentifier makes a BASIC name usable in a Go identifier.
+func goIdentifier(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// isNumber reports whether expr is sure to give a number, or stop with an
+// error, when the variables in numbers hold numbers. Every operator but +
+// gives a number when it works at all, as does a function whose name has
+// no $.
+func isNumber(numbers map[string]string, expr ast.Expression) bool {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral, *ast.BooleanLiteral, *ast.PrefixExpression:
+		return true
+	case *ast.Identifier:
+		_, ok := numbers[node.Value]
+		return ok
+	case *ast.CallExpression:
+		return !strings.HasSuffix(node.Function, "$")
+	case *ast.InfixExpression:
+		if node.Operator != "+" {
+			return true
+		}
+		return isNumber(numbers, node.Left) && isNumber(numbers, node.Right)
+	}
+	return false
+}
+
+// nativeOperators are the operators on two numbers that compile to Go
+// operators, by the Go operator.
+var nativeOperators = map[string]string{
+	"+": "+", "-": "-", "*": "*", "/": "/", "MOD": "MOD",
+	"<": "<", ">": ">", "<=": "<=", ">=": ">=", "==": "==", "<>": "!=",
+}
+
+// native reports whether expr, a number, compiles to a float64 expression
+// without going through a Value.
+func (u *unit) native(expr ast.Expression) bool {
+	switch node := expr.(type) {
+	case *ast.Identifier:
+		_, ok := u.numbers[node.Value]
+		return ok
+	case *ast.PrefixExpression:
+		return node.Operator == "-" && isNumber(u.numbers, node.Right)
+	case *ast.InfixExpression:
+		_, ok := nativeOperators[node.Operator]
+		return ok && isNumber(u.numbers, node.Left) && isNumber(u.numbers, node.Right)
+	}
+	return false
+}
+
+// emitNumber emits expr, which isNumber, as a float64 expression.
+func emitNumber(e *emitter, expr ast.Expression) (string, error) {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral:
+		return e.float(node.Value), nil
+	case *ast.BooleanLiteral:
+		if node.Value {
+			return "dialect.True", nil
+		}
+		return "0.0", nil
+	}
+	if !e.unit.native(expr) {
+		val, err := emitExpression(e, expr)
+		if err != nil {
+			return "", err
+		}
+		return val + ".Number()", nil
+	}
+
+	switch node := expr.(type) {
+	case *ast.Identifier:
+		return e.unit.numbers[node.Value], nil
+	case *ast.PrefixExpression:
+		right, err := emitNumber(e, node.Right)
+		if err != nil {
+			return "", err
+		}
+		if constant(node.Right) {
+			right = e.variable(right)
+		}
+		return "(-" + right + ")", nil
+	}
+	node := expr.(*ast.InfixExpression)
+	left, err := emitNumber(e, node.Left)
+	if err != nil {
+		return "", err
+	}
+	right, err := emitNumber(e, node.Right)
+	if err != nil {
+		return "", err
+	}
+	if constant(node.Left) && constant(node.Right) {
+		left = e.variable(left)
+	}
+	switch op := nativeOperators[node.Operator]; op {
+	case "+", "-", "*":
+		return fmt.Sprintf("(%s %s %s)", left, op, right), nil
+	case "/":
+		tmp := e.temp()
+		e.line("if %s == 0 {", right)
+		e.nested().line("return fmt.Errorf(\"division by zero\")")
+		e.line("}")
+		e.line("%s := %s / %s", tmp, left, right)
+		return tmp, nil
+	case "MOD":
+		e.unit.imports["math"] = true
+		return fmt.Sprintf("math.Mod(%s, %s)", left, right), nil
+	default:
+		return fmt.Sprintf("env.Truth(%s %s %s)", left, op, right), nil
+	}
+}
+
+// constant reports whether emitNumber makes a Go constant of expr. Go
+// works out constant expressions exactly, without rounding each step or
+// keeping the sign of 0, so an operator is never given two.
+func constant(expr ast.Expression) bool {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral:
+		return true
+	case *ast.BooleanLiteral:
+		return !node.Value
+	}
+	return false
+}
+
+// variable puts the float64 expression val in a temporary, for Go to work
+// out as float64 arithmetic.
+func (e *emitter) variable(val string) string {
+	tmp := e.temp()
+	e.line("%s := %s", tmp, val)
+	return tmp
+}
+
+// float writes v as a Go float64 constant.
+func (e *emitter) float(v float64) string {
+	switch {
+	case math.IsInf(v, 0) || math.IsNaN(v) || v == 0 && math.Signbit(v):
+		e.unit.imports["math"] = true
+		if math.IsNaN(v) {
+			return "math.NaN()"
+		}
+		if v == 0 {
+			return "math.Copysign(0, -1)"
+		}
+		return fmt.Sprintf("math.Inf(%d)", int(math.Copysign(1, v)))
+	}
+	s := strconv.FormatFloat(v, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// assignNumber emits storing the float64 val in the variable name.
+func (e *emitter) assignNumber(name, val string) {
+	if local, ok := e.unit.numbers[name]; ok {
+		e.line("%s = %s", local, val)
+		return
+	}
+	e.line("env.Set(%q, basicrt.NumVal(%s))", name, val)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/catalog"
+	"github.com/basis-ex/token"
+)
+
+// lineNumberAfter lists the words that are followed by a line number.
+var lineNumberAfter = map[string]bool{
+	"GOTO": true, "GOSUB": true, "THEN": true, "ELSE": true, "RESTORE": true,
+	"LIST": true, "LLIST": true, "EDIT": true, "DELETE": true, "VERIFY": true, "BREAK": true,
+}
+
+// completeLine is the REPL's Tab completer. It completes file names after
+// LOAD, SAVE, LOADSTATE and SAVESTATE, line numbers of the program after GOTO, GOSUB, LIST and
+// the like, and otherwise keywords, built-in functions and the variables
+// the program uses. before is the text left of the cursor.
+func completeLine(lines map[int]string, before string) (int, []string) {
+	fields := strings.Fields(before)
+	first := ""
+	if len(fields) > 0 {
+		first = strings.ToUpper(fields[0])
+	}
+
+	if first == "LOAD" || first == "SAVE" || first == "LOADSTATE" || first == "SAVESTATE" {
+		if len(fields) > 1 || strings.HasSuffix(before, " ") {
+			word := before[strings.LastIndexAny(before, " \"")+1:]
+			return len([]rune(word)), completeFile(word)
+		}
+	}
+
+	start := len(before)
+	for start > 0 && isWordChar(before[start-1]) {
+		start--
+	}
+	word := before[start:]
+
+	previous := strings.Fields(strings.ToUpper(before[:start]))
+	if len(previous) > 0 && lineNumberAfter[previous[len(previous)-1]] {
+		if _, err := strconv.Atoi(word); err == nil || word == "" {
+			return len(word), completeLineNumber(lines, word)
+		}
+	}
+	if word == "" || isDigit(word[0]) {
+		return 0, nil
+	}
+
+	names := token.Names()
+	if strings.TrimSpace(before[:start]) == "" {
+		names = append(names, catalog.Names(catalog.Command)...)
+	}
+	names = append(names, programVariables(lines)...)
+
+	upper := strings.ToUpper(word)
+	seen := map[string]bool{}
+	candidates := []string{}
+	for _, name := range names {
+		if strings.HasPrefix(strings.ToUpper(name), upper) && !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+	return len(word), candidates
+}
+
+func completeFile(word string) []string {
+	matches, _ := filepath.Glob(word + "*")
+	for i, name := range matches {
+		if info, err := os.Stat(name); err == nil && info.IsDir() {
+			matches[i] = name + string(filepath.Separator)
+		}
+	}
+	return matches
+}
+
+func completeLineNumber(lines map[int]string, prefix string) []string {
+	candidates := []string{}
+	for _, num := range sortedLineNumbers(lines) {
+		if s := strconv.Itoa(num); strings.HasPrefix(s, prefix) {
+			candidates = append(candidates, s)
+		}
+	}
+	return candidates
+}
+
+// programVariables returns the variable names used in the program.
+func programVariables(lines map[int]string) []string {
+	names := []string{}
+	for _, text := range lines {
+		l := newLexer(text)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+			if tok.Type == token.IDENT && !token.IsBuiltin(strings.ToUpper(tok.Literal)) {
+				names = append(names, tok.Literal)
+			}
+		}
+	}
+	return names
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
@@ -0,0 +1,154 @@
+// Package coverage records which lines of a BASIC program run, for
+// checking that a test exercises a program or grading class exercises. A
+// Profile attaches to an evaluator through its hooks:
+//
+//	prof := coverage.New(program)
+//	eval.SetHooks(prof.Hooks())
+//	eval.Run(ctx)
+//	prof.WriteListing(os.Stdout)
+package coverage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/evaluator"
+)
+
+// Profile counts how many times each line of a program has started.
+type Profile struct {
+	program *ast.Program
+	lines   []int
+	counts  map[int]int64
+}
+
+// New returns an empty profile for program.
+func New(program *ast.Program) *Profile {
+	lines := make([]int, 0, len(program.Statements))
+	for num := range program.Statements {
+		lines = append(lines, num)
+	}
+	sort.Ints(lines)
+	return &Profile{program: program, lines: lines, counts: map[int]int64{}}
+}
+
+// Hooks returns evaluator hooks that record each line as it starts.
+func (p *Profile) Hooks() evaluator.Hooks {
+	return evaluator.Hooks{
+		OnLineStart: func(line int) { p.counts[line]++ },
+	}
+}
+
+// Executable reports whether a line counts towards coverage. Lines holding
+// only REM, DATA or a label do nothing when run, so they are left out.
+func (p *Profile) Executable(line int) bool {
+	for _, stmt := range ast.Flatten(p.program.Statements[line]) {
+		switch stmt.(type) {
+		case *ast.RemStatement, *ast.DataStatement, *ast.LabelStatement:
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+// Count returns how many times line has started.
+func (p *Profile) Count(line int) int64 {
+	return p.counts[line]
+}
+
+// Summary returns the number of executable lines that ran and the number
+// of executable lines.
+func (p *Profile) Summary() (covered, total int) {
+	for _, line := range p.lines {
+		if !p.Executable(line) {
+			continue
+		}
+		total++
+		if p.counts[line] > 0 {
+			covered++
+		}
+	}
+	return covered, total
+}
+
+// Percent is the share of executable lines that ran, 100 for a program
+// with none.
+func (p *Profile) Percent() float64 {
+	covered, total := p.Summary()
+	if total == 0 {
+		return 100
+	}
+	return 100 * float64(covered) / float64(total)
+}
+
+// WriteListing writes the program with each line's count in the margin,
+// ##### for an executable line that never ran and - for one that is not
+// executable, followed by a summary line.
+func (p *Profile) WriteListing(w io.Writer) error {
+	for _, line := range p.lines {
+		mark := "-"
+		if p.Executable(line) {
+			mark = "#####"
+			if n := p.counts[line]; n > 0 {
+				mark = fmt.Sprint(n)
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%9s  %s\n", mark, p.text(line)); err != nil {
+			return err
+		}
+	}
+	covered, total := p.Summary()
+	_, err := fmt.Fprintf(w, "coverage: %d of %d lines (%.1f%%)\n", covered, total, p.Percent())
+	return err
+}
+
+// Line is one line of a JSON report.
+type Line struct {
+	Line       int    `json:"line"`
+	Text       string `json:"text"`
+	Executable bool   `json:"executable"`
+	Count      int64  `json:"count"`
+}
+
+// Report is the JSON form of a profile.
+type Report struct {
+	Lines   []Line  `json:"lines"`
+	Covered int     `json:"covered"`
+	Total   int     `json:"total"`
+	Percent float64 `json:"percent"`
+}
+
+// Report returns the profile's contents for encoding.
+func (p *Profile) Report() Report {
+	r := Report{Lines: make([]Line, 0, len(p.lines)), Percent: p.Percent()}
+	for _, line := range p.lines {
+		r.Lines = append(r.Lines, Line{
+			Line:       line,
+			Text:       p.text(line),
+			Executable: p.Executable(line),
+			Count:      p.counts[line],
+		})
+	}
+	r.Covered, r.Total = p.Summary()
+	return r
+}
+
+// WriteJSON writes the profile as an indented JSON Report.
+func (p *Profile) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p.Report())
+}
+
+// text is the source of line, or its number alone if the program was
+// built without source.
+func (p *Profile) text(line int) string {
+	if text, ok := p.program.Source[line]; ok {
+		return text
+	}
+	return fmt.Sprint(line)
+}
@@ -1,6 +1,15 @@
+//go:build ignore
+
+// Debug is a scratch program that parses and runs a fixed program, listing
+// the statements it parsed to, for tracing the interpreter by hand:
+//
+//	go run debug.go
+//
+// It is kept out of the build, where its main would clash with the tool's.
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/basis-ex/evaluator"
 	"github.com/basis-ex/lexer"
@@ -29,8 +38,8 @@ func main() {
 		fmt.Printf("Line %d: %T\n", lineNum, stmt)
 	}
 
-	eval := evaluator.New(program)
-	if err := eval.Run(); err != nil {
+	eval := evaluator.New(program, evaluator.Options{})
+	if err := eval.Run(context.Background()); err != nil {
 		fmt.Printf("Runtime error: %v\n", err)
 	}
 }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/evaluator"
+)
+
+// debugger holds the REPL's breakpoints and watched variables. They apply
+// to every program started with RUN or STEP.
+type debugger struct {
+	breakpoints map[int]bool
+	watches     []string
+	// seen is the last value shown for each watched variable.
+	seen map[string]string
+}
+
+func newDebugger() *debugger {
+	return &debugger{breakpoints: map[int]bool{}, seen: map[string]string{}}
+}
+
+// attach installs the debugger's line hook on eval, which stops the
+// program at a breakpoint or when a watched variable changes.
+func (d *debugger) attach(eval *evaluator.Evaluator) {
+	d.seen = map[string]string{}
+	for _, name := range d.watches {
+		d.seen[name] = watchValue(eval, name)
+	}
+	eval.SetLineHook(func(line int) bool {
+		changed := d.reportWatches(eval)
+		return changed || d.breakpoints[line]
+	})
+}
+
+// reportWatches prints each watched variable whose value has changed since
+// it was last shown, and reports whether there were any.
+func (d *debugger) reportWatches(eval *evaluator.Evaluator) bool {
+	changed := false
+	for _, name := range d.watches {
+		value := watchValue(eval, name)
+		if value != d.seen[name] {
+			fmt.Printf("%s = %s (was %s)\n", name, value, d.seen[name])
+			d.seen[name] = value
+			changed = true
+		}
+	}
+	return changed
+}
+
+func watchValue(eval *evaluator.Evaluator, name string) string {
+	val, ok := eval.Lookup(name)
+	if !ok {
+		return "unset"
+	}
+	return evaluator.QuoteValue(val)
+}
+
+// breakCommand handles BREAK: with no argument it lists the breakpoints,
+// BREAK n sets one on line n, and BREAK CLEAR [n] removes one or all.
+func (d *debugger) breakCommand(lines map[int]string, arg string) error {
+	fields := strings.Fields(strings.ToUpper(arg))
+	switch {
+	case len(fields) == 0:
+		if len(d.breakpoints) == 0 {
+			fmt.Println("No breakpoints")
+			return nil
+		}
+		nums := make([]int, 0, len(d.breakpoints))
+		for n := range d.breakpoints {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for _, n := range nums {
+			fmt.Printf("Breakpoint at line %d\n", n)
+		}
+	case fields[0] == "CLEAR" && len(fields) == 1:
+		d.breakpoints = map[int]bool{}
+	case fields[0] == "CLEAR" && len(fields) == 2:
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || !d.breakpoints[n] {
+			return fmt.Errorf("no breakpoint at line %s", fields[1])
+		}
+		delete(d.breakpoints, n)
+	case len(fields) == 1:
+		n, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("usage: BREAK [n | CLEAR [n]]")
+		}
+		if _, ok := lines[n]; !ok {
+			return fmt.Errorf("line %d not found", n)
+		}
+		d.breakpoints[n] = true
+	default:
+		return fmt.Errorf("usage: BREAK [n | CLEAR [n]]")
+	}
+	return nil
+}
+
+// watchCommand handles WATCH: with no argument it lists the watched
+// variables, WATCH name adds one, and WATCH CLEAR removes them all.
+func (d *debugger) watchCommand(stopped *evaluator.Evaluator, arg string) error {
+	switch {
+	case arg == "":
+		if len(d.watches) == 0 {
+			fmt.Println("No watches")
+		}
+		for _, name := range d.watches {
+			fmt.Printf("Watching %s\n", name)
+		}
+	case strings.EqualFold(arg, "CLEAR"):
+		d.watches = nil
+	case strings.ContainsAny(arg, " \t,"):
+		return fmt.Errorf("usage: WATCH [name | CLEAR]")
+	default:
+		for _, name := range d.watches {
+			if name == arg {
+				return nil
+			}
+		}
+		d.watches = append(d.watches, arg)
+		if stopped != nil {
+			d.seen[arg] = watchValue(stopped, arg)
+		}
+	}
+	return nil
+}
+
+// step runs one statement of eval and shows the line that comes next. It
+// returns false when the program has ended or failed.
+func (d *debugger) step(eval *evaluator.Evaluator, lines map[int]string) bool {
+	running, err := eval.Step(context.Background())
+	d.reportWatches(eval)
+	if err != nil {
+		reportRuntimeError(err)
+		return false
+	}
+	if !running {
+		fmt.Println("Program ended")
+		return false
+	}
+	showNext(eval, lines)
+	return true
+}
+
+// showNext prints the line a stopped program will run next, and which of
+// its statements when it stopped part way through the line.
+func showNext(eval *evaluator.Evaluator, lines map[int]string) {
+	state := eval.State()
+	switch {
+	case state.Status == evaluator.Ended:
+	case state.Statement > 0:
+		fmt.Printf("Next: %s (statement %d)\n", lines[state.Line], state.Statement+1)
+	default:
+		fmt.Printf("Next: %s\n", lines[state.Line])
+	}
+}
+
+// showVars handles VARS, listing the variables, arrays and open files of
+// the program last run, whether it finished or was stopped.
+func showVars(eval *evaluator.Evaluator) {
+	if eval == nil {
+		fmt.Println("No program has been run")
+		return
+	}
+
+	fmt.Println("Variables:")
+	vars := eval.Variables()
+	if len(vars) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, v := range vars {
+		fmt.Printf("  %s = %s\n", v.Name, evaluator.QuoteValue(v.Value))
+	}
+
+	fmt.Println("Arrays:")
+	arrays := eval.Arrays()
+	if len(arrays) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, arr := range arrays {
+		fmt.Printf("  %s\n", evaluator.FormatArray(arr))
+	}
+
+	fmt.Println("Open files:")
+	files := eval.Files()
+	if len(files) == 0 {
+		fmt.Println("  (none)")
+	}
+	for _, f := range files {
+		fmt.Printf("  #%d %s (record length %d, last record %d)\n", f.Number, f.Name, f.RecordLength, f.Record)
+	}
+}
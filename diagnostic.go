@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/basis-ex/parser"
+)
+
+// printParseErrors lists a program's syntax errors under "Parser errors:",
+// each followed by the line it is on with the place marked.
+func printParseErrors(w io.Writer, errs []parser.Error) {
+	fmt.Fprintln(w, "Parser errors:")
+	for _, err := range errs {
+		fmt.Fprintln(w, "\t"+err.Msg)
+		if excerpt := parseExcerpt(err); excerpt != "" {
+			fmt.Fprintln(w, indent(excerpt, "\t  "))
+		}
+	}
+}
+
+// parseExcerpt is the source line of err with a marker under the place it
+// is about, or "" if the line is not known.
+func parseExcerpt(err parser.Error) string {
+	text := strings.TrimRight(err.Text, " \t")
+	if text == "" || !err.Pos.IsValid() {
+		return ""
+	}
+	end := err.Pos.Column + 1
+	if err.End.Line == err.Pos.Line && err.End.Column > end {
+		end = err.End.Column
+	}
+	return text + "\n" + marker(text, err.Pos.Column, end)
+}
+
+// marker underlines the columns of text from start up to end, counting
+// bytes from 1: a caret under the first and tildes under the rest. Tabs
+// before the start are kept, so the caret lines up however they are shown.
+func marker(text string, start, end int) string {
+	var b strings.Builder
+	for i := 0; i < start-1; i++ {
+		if i < len(text) && text[i] == '\t' {
+			b.WriteByte('\t')
+		} else {
+			b.WriteByte(' ')
+		}
+	}
+	b.WriteByte('^')
+	for i := start + 1; i < end; i++ {
+		b.WriteByte('~')
+	}
+	return b.String()
+}
+
+// indent puts prefix before each line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,87 @@
+// Package dialect describes the semantics that differ between BASIC
+// implementations, so the interpreter and compiler can agree on them.
+package dialect
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Dialect is a named set of semantic choices. The zero value behaves like
+// Standard.
+type Dialect struct {
+	Name string
+	// BitwiseLogic follows Microsoft BASIC: comparisons yield -1 for true,
+	// and AND, OR, XOR, EQV, IMP and NOT work bit by bit on 16-bit integers
+	// (so NOT 0 = -1). Otherwise true is 1 and the operators are logical.
+	BitwiseLogic bool
+	// EqualsCompares reads a single = in an expression as a comparison,
+	// as in IF A = B THEN, the way early BASICs do; == compares either
+	// way. Otherwise = only assigns.
+	EqualsCompares bool
+	// ZoneWidth is how many columns wide PRINT's zones are: a comma moves
+	// the output to the start of the next one. With 0, a comma prints a
+	// tab.
+	ZoneWidth int
+	// BackslashEscapes lets string literals use escapes as in C: \n, \t,
+	// \r, \", \\ and \xHH for any byte. Otherwise a backslash is an
+	// ordinary character. A doubled quote stands for one either way.
+	BackslashEscapes bool
+}
+
+var (
+	Standard  = Dialect{Name: "standard"}
+	Dartmouth = Dialect{Name: "dartmouth", EqualsCompares: true, ZoneWidth: 15}
+	MSBasic   = Dialect{Name: "msbasic", BitwiseLogic: true, EqualsCompares: true, ZoneWidth: 14}
+	C64       = Dialect{Name: "c64", BitwiseLogic: true, EqualsCompares: true, ZoneWidth: 10}
+)
+
+var dialects = map[string]Dialect{
+	Standard.Name:  Standard,
+	Dartmouth.Name: Dartmouth,
+	MSBasic.Name:   MSBasic,
+	C64.Name:       C64,
+}
+
+// Lookup finds a dialect by name.
+func Lookup(name string) (Dialect, bool) {
+	d, ok := dialects[name]
+	return d, ok
+}
+
+// Names lists the known dialects in sorted order.
+func Names() []string {
+	names := make([]string, 0, len(dialects))
+	for name := range dialects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// True is the number a true comparison produces.
+func (d Dialect) True() float64 {
+	if d.BitwiseLogic {
+		return -1
+	}
+	return 1
+}
+
+// Zone returns the spaces that take output at column, counted from 0, to
+// the start of the next print zone, or a tab if d has no zones.
+func (d Dialect) Zone(column int) string {
+	if d.ZoneWidth <= 0 {
+		return "\t"
+	}
+	return strings.Repeat(" ", d.ZoneWidth-column%d.ZoneWidth)
+}
+
+// Column returns the column output written at column is at after text:
+// each character takes one, and a newline goes back to column 0.
+func Column(column int, text string) int {
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		return utf8.RuneCountInString(text[i+1:])
+	}
+	return column + utf8.RuneCountInString(text)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/vm"
+)
+
+// runVM runs program on the bytecode machine, for -engine=vm, and exits
+// as runSource does. A program using statements the VM does not cover is
+// refused before it starts, naming the first of them.
+func runVM(program *ast.Program) {
+	if maxSteps > 0 || showCover || coverProfile != "" {
+		fmt.Fprintln(os.Stderr, "-max-steps, -cover and -coverprofile need -engine=tree")
+		os.Exit(exitUsage)
+	}
+	prog, err := vm.Compile(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Compile error: %v\n", err)
+		var unsupported *vm.UnsupportedError
+		if errors.As(err, &unsupported) {
+			fmt.Fprintln(os.Stderr, "Run it with -engine=tree instead.")
+		}
+		os.Exit(exitRuntimeError)
+	}
+
+	opts := vm.Options{
+		Dialect:         basicDialect,
+		Args:            programArgs,
+		MaxGosubDepth:   maxGosubDepth,
+		MaxStringLength: maxStringLength,
+		MaxArrayCells:   maxArrayCells,
+		Timeout:         timeout,
+	}
+	if script != nil {
+		opts.Stdin, opts.Script = script, true
+	}
+	machine := vm.New(prog, opts)
+	release := catchInterrupts(machine)
+	var before, after runtime.MemStats
+	if showTime {
+		runtime.ReadMemStats(&before)
+	}
+	start := time.Now()
+	err = machine.Run(context.Background())
+	elapsed := time.Since(start)
+	if showTime {
+		runtime.ReadMemStats(&after)
+	}
+	release()
+
+	status := runStatus(err, machine.ExitStatus())
+	if showTime {
+		reportStats(nil, elapsed, after.Mallocs-before.Mallocs)
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,198 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/intrinsic"
+)
+
+// builtin is an intrinsic function: its name and arguments, from the
+// shared list in package intrinsic, and the evaluator's implementation. The
+// argument count is checked before fn is called.
+type builtin struct {
+	intrinsic.Function
+	fn func(e *Evaluator, args []Value) (Value, error)
+}
+
+// builtinFuncs implement every intrinsic function.
+var builtinFuncs = map[string]func(e *Evaluator, args []Value) (Value, error){
+	"UCASE$":   stringFunc(strings.ToUpper),
+	"LCASE$":   stringFunc(strings.ToLower),
+	"LTRIM$":   stringFunc(func(s string) string { return strings.TrimLeft(s, " ") }),
+	"RTRIM$":   stringFunc(func(s string) string { return strings.TrimRight(s, " ") }),
+	"TRIM$":    stringFunc(func(s string) string { return strings.Trim(s, " ") }),
+	"ENVIRON$": builtinEnviron,
+	"COMMAND$": builtinCommand,
+	"PEEK":     builtinPeek,
+	"LOF":      builtinLOF,
+	"INPUT$":   builtinInputChars,
+	"TIMER":    builtinTimer,
+	"ROUND":    numberFunc(round),
+	"FIX":      numberFunc(fix),
+	"MIN":      numberFunc(func(x ...float64) float64 { return math.Min(x[0], x[1]) }),
+	"MAX":      numberFunc(func(x ...float64) float64 { return math.Max(x[0], x[1]) }),
+}
+
+var builtins = map[string]builtin{}
+
+func init() {
+	names := make([]string, 0, len(builtinFuncs))
+	for name, fn := range builtinFuncs {
+		info, _ := intrinsic.Lookup(name)
+		builtins[name] = builtin{info, fn}
+		names = append(names, name)
+	}
+	if err := intrinsic.Check("evaluator", names); err != nil {
+		panic(err)
+	}
+}
+
+func (e *Evaluator) evalArguments(exprs []ast.Expression) ([]Value, error) {
+	args := make([]Value, len(exprs))
+	for i, arg := range exprs {
+		val, err := e.evalExpression(arg)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+	return args, nil
+}
+
+func (e *Evaluator) evalCallExpression(call *ast.CallExpression) (Value, error) {
+	fn, ok := builtins[call.Function]
+	if !ok {
+		host, ok := e.hostFunctions[call.Function]
+		if !ok {
+			return Value{}, fmt.Errorf("unknown function: %s", call.Function)
+		}
+		args, err := e.evalArguments(call.Arguments)
+		if err != nil {
+			return Value{}, err
+		}
+		return e.callHost(call.Function, host, args)
+	}
+	if err := fn.CheckArity(len(call.Arguments)); err != nil {
+		return Value{}, err
+	}
+
+	args, err := e.evalArguments(call.Arguments)
+	if err != nil {
+		return Value{}, err
+	}
+	return e.callBuiltin(call.Function, fn, args)
+}
+
+// callBuiltin calls the built-in name, whose arguments have been counted.
+func (e *Evaluator) callBuiltin(name string, fn builtin, args []Value) (Value, error) {
+	val, err := fn.fn(e, args)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := e.checkString(val); err != nil {
+		return Value{}, err
+	}
+	return val, nil
+}
+
+// stringFunc adapts a string-to-string function to a one-argument builtin.
+func stringFunc(f func(string) string) func(*Evaluator, []Value) (Value, error) {
+	return func(_ *Evaluator, args []Value) (Value, error) {
+		s, ok := args[0].AsString()
+		if !ok {
+			return Value{}, errorf(TypeMismatch, "expected string argument")
+		}
+		return String(f(s)), nil
+	}
+}
+
+// numberFunc adapts a function of numbers to a builtin whose arguments must
+// all be numbers.
+func numberFunc(f func(x ...float64) float64) func(*Evaluator, []Value) (Value, error) {
+	return func(_ *Evaluator, args []Value) (Value, error) {
+		nums := make([]float64, len(args))
+		for i, arg := range args {
+			n, ok := arg.AsNumber()
+			if !ok {
+				return Value{}, errorf(TypeMismatch, "expected number argument")
+			}
+			nums[i] = n
+		}
+		return Number(f(nums...)), nil
+	}
+}
+
+// round implements ROUND(x) and ROUND(x, digits), rounding halves away from
+// zero. Negative digits round to tens, hundreds and so on.
+func round(x ...float64) float64 {
+	if len(x) == 1 {
+		return positiveZero(math.Round(x[0]))
+	}
+	scale := math.Pow(10, math.Trunc(x[1]))
+	return positiveZero(math.Round(x[0]*scale) / scale)
+}
+
+// fix implements FIX, truncating toward zero.
+func fix(x ...float64) float64 {
+	return positiveZero(math.Trunc(x[0]))
+}
+
+// positiveZero turns the -0 that FIX and ROUND give for a small negative
+// number into 0, so that it prints without a sign.
+func positiveZero(x float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x
+}
+
+// builtinEnviron implements ENVIRON$(name), the value of an environment
+// variable, and ENVIRON$(n), the nth "NAME=value" entry counting from 1.
+// Missing entries give an empty string.
+func builtinEnviron(e *Evaluator, args []Value) (Value, error) {
+	if err := e.checkHostAccess("reading the environment"); err != nil {
+		return Value{}, err
+	}
+	if name, ok := args[0].AsString(); ok {
+		return String(os.Getenv(name)), nil
+	}
+	env := os.Environ()
+	n := int(args[0].num)
+	if n < 1 || n > len(env) {
+		return String(""), nil
+	}
+	return String(env[n-1]), nil
+}
+
+// builtinCommand implements COMMAND$, the arguments given after the program
+// file joined by spaces, and COMMAND$(n), the nth argument counting from 1.
+func builtinCommand(e *Evaluator, args []Value) (Value, error) {
+	if len(args) == 0 {
+		return String(strings.Join(e.args, " ")), nil
+	}
+	num, ok := args[0].AsNumber()
+	if !ok {
+		return Value{}, errorf(TypeMismatch, "expected number argument")
+	}
+	n := int(num)
+	if n < 1 || n > len(e.args) {
+		return String(""), nil
+	}
+	return String(e.args[n-1]), nil
+}
+
+func builtinPeek(e *Evaluator, args []Value) (Value, error) {
+	addr, ok := args[0].AsNumber()
+	if !ok {
+		return Value{}, errorf(TypeMismatch, "expected number argument")
+	}
+	b, err := e.env.memory.Peek(int(addr))
+	if err != nil {
+		return Value{}, err
+	}
+	return Number(float64(b)), nil
+}
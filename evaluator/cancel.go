@@ -0,0 +1,78 @@
+package evaluator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/basis-ex/ast"
+)
+
+// CancelError is returned by Run, Continue and Step when their context was
+// cancelled. Line is the line that was about to run, or that was waiting
+// for input. It wraps the context's error, so errors.Is(err,
+// context.Canceled) and errors.Is(err, context.DeadlineExceeded) work.
+type CancelError struct {
+	Line int
+	Err  error
+}
+
+func (c *CancelError) Error() string {
+	return fmt.Sprintf("Cancelled in line %d: %v", c.Line, c.Err)
+}
+
+func (c *CancelError) Unwrap() error {
+	return c.Err
+}
+
+// waitForInput calls read, which blocks on the program's input, and returns
+// its result, or the context's error if the run is cancelled first. A read
+// given up on finishes in the background and what it read is dropped.
+func (e *Evaluator) waitForInput(read func() (string, error)) (string, error) {
+	done := e.ctx.Done()
+	if done == nil {
+		return read()
+	}
+
+	type result struct {
+		text string
+		err  error
+	}
+	results := make(chan result, 1)
+	go func() {
+		text, err := read()
+		results <- result{text, err}
+	}()
+
+	select {
+	case r := <-results:
+		return r.text, r.err
+	case <-done:
+		return "", e.ctx.Err()
+	}
+}
+
+// evalSleepStatement pauses for the given number of seconds. Ctrl-C, or
+// anything else that calls Interrupt, cuts the pause short, and so does
+// cancelling the run's context.
+func (e *Evaluator) evalSleepStatement(stmt *ast.SleepStatement) error {
+	val, err := e.evalExpression(stmt.Seconds)
+	if err != nil {
+		return err
+	}
+	secs, ok := val.AsNumber()
+	if !ok || secs < 0 {
+		return fmt.Errorf("SLEEP requires a number of seconds")
+	}
+
+	timer := time.NewTimer(time.Duration(secs * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-e.wake:
+		// Leave the interrupt pending so the program breaks before its
+		// next statement.
+	case <-e.ctx.Done():
+		return e.ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package evaluator
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/basis-ex/ast"
+)
+
+// expression is an ast.Expression compiled into a Go closure. It evaluates
+// the expression in env without deciding again, each time it runs, what
+// kind of node it is and which operator it applies.
+type expression func(env *Environment) (Value, error)
+
+// compiledExpressions holds the closures for the expressions of a
+// program, one map for each kind of node that is worth compiling, so that
+// finding one hashes only a pointer. Literals and variables are quicker
+// to evaluate than to look up.
+type compiledExpressions struct {
+	infix  map[*ast.InfixExpression]expression
+	prefix map[*ast.PrefixExpression]expression
+	array  map[*ast.ArrayAccess]expression
+	call   map[*ast.CallExpression]expression
+}
+
+// compileExpressions compiles the expressions of the statements programs
+// run in their loops, PRINT, LET, IF, FOR, GOTO and GOSUB, so that
+// evalExpression runs them as closures. The expressions of other
+// statements, and of statements typed at the REPL, are evaluated as they
+// stand.
+func (e *Evaluator) compileExpressions() {
+	c := compiledExpressions{
+		infix:  make(map[*ast.InfixExpression]expression),
+		prefix: make(map[*ast.PrefixExpression]expression),
+		array:  make(map[*ast.ArrayAccess]expression),
+		call:   make(map[*ast.CallExpression]expression),
+	}
+	add := func(exprs ...ast.Expression) {
+		for _, expr := range exprs {
+			switch node := expr.(type) {
+			case *ast.InfixExpression:
+				c.infix[node] = e.compile(node)
+			case *ast.PrefixExpression:
+				c.prefix[node] = e.compile(node)
+			case *ast.ArrayAccess:
+				c.array[node] = e.compile(node)
+			case *ast.CallExpression:
+				c.call[node] = e.compile(node)
+			}
+		}
+	}
+	// A layout holds every statement of its line, those after THEN and
+	// ELSE included.
+	for _, line := range e.code {
+		for _, stmt := range line.Statements {
+			switch s := stmt.(type) {
+			case *ast.PrintStatement:
+				add(s.Expressions...)
+			case *ast.LetStatement:
+				add(s.Index, s.Value)
+			case *ast.IfStatement:
+				add(s.Condition)
+			case *ast.ForStatement:
+				add(s.Start, s.Limit, s.Step)
+			case *ast.GotoStatement:
+				add(s.LineNumber)
+			case *ast.GosubStatement:
+				add(s.LineNumber)
+			}
+		}
+	}
+	e.compiled = c
+}
+
+// compile turns expr into a closure that gives the same value, or the same
+// error, as evalExpression.
+func (e *Evaluator) compile(expr ast.Expression) expression {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral:
+		val := Number(node.Value)
+		return func(*Environment) (Value, error) { return val, nil }
+	case *ast.StringLiteral:
+		val := String(node.Value)
+		return func(*Environment) (Value, error) { return val, nil }
+	case *ast.BooleanLiteral:
+		// TRUE is looked up each time, as the dialect may change.
+		b := node.Value
+		return func(*Environment) (Value, error) { return e.boolValue(b), nil }
+	case *ast.Identifier:
+		// The variable is looked up once and then read through its
+		// pointer, until the environment changes, as it does for a CALL, or
+		// loses its variables. An unset variable reads as 0.
+		name := node.Value
+		var (
+			cached     *Environment
+			generation int
+			slot       *Value
+		)
+		return func(env *Environment) (Value, error) {
+			if slot == nil || env != cached || env.generation != generation {
+				slot, cached, generation = env.variables[name], env, env.generation
+				if slot == nil {
+					return Value{}, nil
+				}
+			}
+			return *slot, nil
+		}
+	case *ast.InfixExpression:
+		return e.compileInfix(node)
+	case *ast.PrefixExpression:
+		right, op := e.compile(node.Right), node.Operator
+		return func(env *Environment) (Value, error) {
+			val, err := right(env)
+			if err != nil {
+				return Value{}, err
+			}
+			return e.evalPrefix(op, val)
+		}
+	case *ast.ArrayAccess:
+		index, name := e.compile(node.Index), node.Name.Value
+		return func(env *Environment) (Value, error) {
+			arr, ok := env.GetArray(name)
+			if !ok {
+				return Value{}, errorf(SubscriptOutOfRange, "array %s not defined", name)
+			}
+			val, err := index(env)
+			if err != nil {
+				return Value{}, err
+			}
+			return arrayElement(name, arr, val)
+		}
+	case *ast.CallExpression:
+		return e.compileCall(node)
+	default:
+		return func(*Environment) (Value, error) {
+			return Value{}, fmt.Errorf("unknown expression type: %T", expr)
+		}
+	}
+}
+
+func (e *Evaluator) compileInfix(node *ast.InfixExpression) expression {
+	left, right, op := e.compile(node.Left), e.compile(node.Right), node.Operator
+	// Arithmetic and comparison on two numbers are done by a function
+	// chosen here; anything else, such as joining strings, dividing by zero,
+	// the logical operators or a type mismatch, is left to evalInfix.
+	var numeric func(x, y float64) (Value, bool)
+	switch op {
+	case "+":
+		numeric = func(x, y float64) (Value, bool) { return Number(x + y), true }
+	case "-":
+		numeric = func(x, y float64) (Value, bool) { return Number(x - y), true }
+	case "*":
+		numeric = func(x, y float64) (Value, bool) { return Number(x * y), true }
+	case "/":
+		numeric = func(x, y float64) (Value, bool) { return Number(x / y), y != 0 }
+	case "MOD":
+		numeric = func(x, y float64) (Value, bool) { return Number(math.Mod(x, y)), true }
+	case "<":
+		numeric = func(x, y float64) (Value, bool) { return e.boolValue(x < y), true }
+	case ">":
+		numeric = func(x, y float64) (Value, bool) { return e.boolValue(x > y), true }
+	case "<=":
+		numeric = func(x, y float64) (Value, bool) { return e.boolValue(x <= y), true }
+	case ">=":
+		numeric = func(x, y float64) (Value, bool) { return e.boolValue(x >= y), true }
+	case "==":
+		numeric = func(x, y float64) (Value, bool) { return e.boolValue(x == y), true }
+	case "<>":
+		numeric = func(x, y float64) (Value, bool) { return e.boolValue(x != y), true }
+	default:
+		numeric = func(x, y float64) (Value, bool) { return Value{}, false }
+	}
+	return func(env *Environment) (Value, error) {
+		l, err := left(env)
+		if err != nil {
+			return Value{}, err
+		}
+		r, err := right(env)
+		if err != nil {
+			return Value{}, err
+		}
+		if x, ok := l.AsNumber(); ok {
+			if y, ok := r.AsNumber(); ok {
+				if val, ok := numeric(x, y); ok {
+					return val, nil
+				}
+			}
+		}
+		return e.evalInfix(op, l, r)
+	}
+}
+
+// compileCall compiles a call to a built-in or host function. Host
+// functions may be registered after the program is loaded, so they are
+// looked up when the call runs.
+func (e *Evaluator) compileCall(node *ast.CallExpression) expression {
+	name := node.Function
+	args := make([]expression, len(node.Arguments))
+	for i, arg := range node.Arguments {
+		args[i] = e.compile(arg)
+	}
+	evalArgs := func(env *Environment) ([]Value, error) {
+		vals := make([]Value, len(args))
+		for i, arg := range args {
+			val, err := arg(env)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return vals, nil
+	}
+
+	fn, ok := builtins[name]
+	if !ok {
+		return func(env *Environment) (Value, error) {
+			host, ok := e.hostFunctions[name]
+			if !ok {
+				return Value{}, fmt.Errorf("unknown function: %s", name)
+			}
+			vals, err := evalArgs(env)
+			if err != nil {
+				return Value{}, err
+			}
+			return e.callHost(name, host, vals)
+		}
+	}
+	if err := fn.CheckArity(len(args)); err != nil {
+		return func(*Environment) (Value, error) { return Value{}, err }
+	}
+	return func(env *Environment) (Value, error) {
+		vals, err := evalArgs(env)
+		if err != nil {
+			return Value{}, err
+		}
+		return e.callBuiltin(name, fn, vals)
+	}
+}
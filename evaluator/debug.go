@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/basis-ex/ast"
+)
+
+// SetLineHook installs a function that Run and Continue call with each line
+// number before running it. When the hook returns true the program stops
+// there with a *BreakError, as if interrupted, and can be resumed with
+// Continue or Step. Debuggers use it for breakpoints and watches; nil
+// removes the hook.
+func (e *Evaluator) SetLineHook(hook func(line int) bool) {
+	e.lineHook = hook
+}
+
+// Step runs the next statement of the program and stops again, so a line
+// of several colon-separated statements takes several steps. On a program
+// that has not been run yet it runs the first statement. It reports false
+// once the program has ended or failed; the line hook is not called.
+// State reports where it stopped.
+//
+// ctx is taken as Run and Continue take it: when it is cancelled, before
+// the statement or while the statement waits in INPUT or SLEEP, Step
+// returns a *CancelError and the statement runs again on the next step.
+func (e *Evaluator) Step(ctx context.Context) (bool, error) {
+	if e.halted || e.currentLine >= len(e.lines) {
+		return false, nil
+	}
+	if err := ctx.Err(); err != nil {
+		return true, &CancelError{Line: e.lines[e.currentLine], Err: err}
+	}
+	if !e.started {
+		// The first step starts the run, and SetTimeout's clock with it.
+		e.stats = Stats{}
+		e.deadline = time.Now().Add(e.timeout)
+	}
+	e.ctx = ctx
+	e.running, e.started = true, true
+	err := e.step()
+	e.running, e.ctx = false, context.Background()
+	if err != nil {
+		var cancelled *CancelError
+		return errors.As(err, &cancelled), err
+	}
+	if e.halted || e.currentLine >= len(e.lines) {
+		e.closeFiles()
+		return false, nil
+	}
+	return true, nil
+}
+
+// NextLine returns the number of the line holding the statement the
+// program will run next, and false if it has ended.
+func (e *Evaluator) NextLine() (int, bool) {
+	if e.halted || e.currentLine >= len(e.lines) {
+		return 0, false
+	}
+	return e.lines[e.currentLine], true
+}
+
+// Lookup returns the current value of a variable, as seen from the line
+// about to run.
+func (e *Evaluator) Lookup(name string) (Value, bool) {
+	return e.env.Get(name)
+}
+
+// Exec runs a statement typed at the prompt in the program's current state,
+// so a stopped program's variables can be printed or changed before it is
+// continued. Statements that would move the program, such as GOTO, GOSUB
+// or NEXT, are refused and leave it where it was.
+func (e *Evaluator) Exec(stmt ast.Statement) error {
+	calls, loops, frames := len(e.callStack), len(e.forLoops), len(e.frames)
+	halted, env := e.halted, e.env
+
+	e.jumped = false
+	err := e.evalStatement(stmt)
+
+	if e.jumped || len(e.callStack) != calls || len(e.forLoops) != loops || len(e.frames) != frames || e.halted != halted {
+		e.jumped, e.halted, e.env = false, halted, env
+		e.callStack = e.callStack[:min(calls, len(e.callStack))]
+		e.forLoops = e.forLoops[:min(loops, len(e.forLoops))]
+		e.frames = e.frames[:min(frames, len(e.frames))]
+		return fmt.Errorf("statement not allowed while a program is stopped")
+	}
+	return err
+}
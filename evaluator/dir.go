@@ -0,0 +1,121 @@
+package evaluator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/basis-ex/ast"
+)
+
+// evalFilesStatement prints the names matching a pattern such as "*.bas",
+// one per line, with a trailing / on directories.
+func (e *Evaluator) evalFilesStatement(stmt *ast.FilesStatement) error {
+	if err := e.checkHostAccess("FILES"); err != nil {
+		return err
+	}
+	pattern := "*"
+	if stmt.Pattern != nil {
+		p, err := e.stringArg(stmt.Pattern, "FILES pattern")
+		if err != nil {
+			return err
+		}
+		pattern = p
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fileError("FILES", err)
+	}
+	if len(matches) == 0 {
+		return errorf(FileNotFound, "File not found")
+	}
+	sort.Strings(matches)
+
+	for _, name := range matches {
+		if info, err := os.Stat(name); err == nil && info.IsDir() {
+			name += "/"
+		}
+		if _, err := fmt.Fprintln(e.out, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evalKillStatement deletes a file. Wildcards delete every match.
+func (e *Evaluator) evalKillStatement(stmt *ast.KillStatement) error {
+	if err := e.checkHostAccess("KILL"); err != nil {
+		return err
+	}
+	pattern, err := e.stringArg(stmt.File, "KILL file name")
+	if err != nil {
+		return err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return fileError("KILL", err)
+	}
+	if len(matches) == 0 {
+		return errorf(FileNotFound, "File not found")
+	}
+	for _, name := range matches {
+		if err := os.Remove(name); err != nil {
+			return fileError("KILL", err)
+		}
+	}
+	return nil
+}
+
+func (e *Evaluator) evalNameStatement(stmt *ast.NameStatement) error {
+	if err := e.checkHostAccess("NAME"); err != nil {
+		return err
+	}
+	from, err := e.stringArg(stmt.From, "NAME file name")
+	if err != nil {
+		return err
+	}
+	to, err := e.stringArg(stmt.To, "NAME file name")
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(from); err != nil {
+		return errorf(FileNotFound, "File not found")
+	}
+	if _, err := os.Stat(to); err == nil {
+		return errorf(FileAlreadyExists, "File already exists")
+	}
+	if err := os.Rename(from, to); err != nil {
+		return fileError("NAME", err)
+	}
+	return nil
+}
+
+func (e *Evaluator) evalChdirStatement(stmt *ast.ChdirStatement) error {
+	if err := e.checkHostAccess("CHDIR"); err != nil {
+		return err
+	}
+	dir, err := e.stringArg(stmt.Directory, "CHDIR directory")
+	if err != nil {
+		return err
+	}
+	if err := os.Chdir(dir); err != nil {
+		return errorf(PathNotFound, "Path not found")
+	}
+	return nil
+}
+
+func (e *Evaluator) stringArg(expr ast.Expression, what string) (string, error) {
+	val, err := e.evalExpression(expr)
+	if err != nil {
+		return "", err
+	}
+	str, ok := val.AsString()
+	if !ok {
+		return "", errorf(TypeMismatch, "%s must be a string", what)
+	}
+	return str, nil
+}
@@ -0,0 +1,84 @@
+package evaluator
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dump implements the DUMP statement, printing every scalar variable, each
+// array with its dimension, the active FOR loops (innermost last) and the
+// GOSUB stack (innermost first). Inside a SUB the variables and loops are the
+// procedure's own, and the active CALLs are listed too.
+func (e *Evaluator) dump() error {
+	var b strings.Builder
+
+	b.WriteString("Variables:\n")
+	vars := e.Variables()
+	if len(vars) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, v := range vars {
+		fmt.Fprintf(&b, "  %s = %s\n", v.Name, QuoteValue(v.Value))
+	}
+
+	b.WriteString("Arrays:\n")
+	arrays := e.Arrays()
+	if len(arrays) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, arr := range arrays {
+		fmt.Fprintf(&b, "  %s\n", FormatArray(arr))
+	}
+
+	b.WriteString("FOR loops:\n")
+	if len(e.forLoops) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, loop := range e.forLoops {
+		fmt.Fprintf(&b, "  %s TO %g STEP %g (from line %d)\n", loop.Variable, loop.End, loop.Step, e.lines[loop.StartLine])
+	}
+
+	b.WriteString("GOSUB stack:\n")
+	if len(e.callStack) == 0 {
+		b.WriteString("  (empty)\n")
+	}
+	for i := len(e.callStack) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "  returns to line %d\n", e.callSite(e.callStack[i]))
+	}
+
+	if len(e.frames) > 0 {
+		b.WriteString("SUB calls:\n")
+		for i := len(e.frames) - 1; i >= 0; i-- {
+			frame := e.frames[i]
+			fmt.Fprintf(&b, "  %s called from line %d\n", frame.proc.Name, e.lines[frame.returnLine])
+		}
+	}
+
+	_, err := fmt.Fprint(e.out, b.String())
+	return err
+}
+
+// FormatArray shows an array as NAME(size) followed by its set elements in
+// index order, as DUMP prints it.
+func FormatArray(arr Array) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s(%d)", arr.Name, arr.Size)
+	indexes := make([]int, 0, len(arr.Elements))
+	for i := range arr.Elements {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	for _, i := range indexes {
+		fmt.Fprintf(&b, " [%d]=%s", i, QuoteValue(arr.Elements[i]))
+	}
+	return b.String()
+}
+
+// QuoteValue shows strings quoted so they can be told apart from numbers.
+func QuoteValue(val Value) string {
+	if s, ok := val.AsString(); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return val.Inspect()
+}
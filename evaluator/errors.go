@@ -0,0 +1,156 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/basis-ex/ast"
+)
+
+// ErrorCode is the number Microsoft BASIC gives a runtime error, so
+// programs and embedders can tell errors apart without matching messages.
+type ErrorCode int
+
+const (
+	NextWithoutFor      ErrorCode = 1
+	ReturnWithoutGosub  ErrorCode = 3
+	OutOfData           ErrorCode = 4
+	IllegalFunctionCall ErrorCode = 5
+	Overflow            ErrorCode = 6
+	OutOfMemory         ErrorCode = 7
+	UndefinedLine       ErrorCode = 8
+	SubscriptOutOfRange ErrorCode = 9
+	DivisionByZero      ErrorCode = 11
+	TypeMismatch        ErrorCode = 13
+	CantContinue        ErrorCode = 17
+	ForWithoutNext      ErrorCode = 26
+	FieldOverflow       ErrorCode = 50
+	BadFileNumber       ErrorCode = 52
+	FileNotFound        ErrorCode = 53
+	FileAlreadyOpen     ErrorCode = 55
+	DeviceIOError       ErrorCode = 57
+	FileAlreadyExists   ErrorCode = 58
+	InputPastEnd        ErrorCode = 62
+	BadRecordNumber     ErrorCode = 63
+	PermissionDenied    ErrorCode = 70
+	PathNotFound        ErrorCode = 76
+)
+
+var codeNames = map[ErrorCode]string{
+	NextWithoutFor:      "NEXT without FOR",
+	ReturnWithoutGosub:  "RETURN without GOSUB",
+	OutOfData:           "Out of DATA",
+	IllegalFunctionCall: "Illegal function call",
+	Overflow:            "Overflow",
+	OutOfMemory:         "Out of memory",
+	UndefinedLine:       "Undefined line number",
+	SubscriptOutOfRange: "Subscript out of range",
+	DivisionByZero:      "Division by zero",
+	TypeMismatch:        "Type mismatch",
+	CantContinue:        "Can't continue",
+	ForWithoutNext:      "FOR without NEXT",
+	FieldOverflow:       "FIELD overflow",
+	BadFileNumber:       "Bad file number",
+	FileNotFound:        "File not found",
+	FileAlreadyOpen:     "File already open",
+	DeviceIOError:       "Device I/O error",
+	FileAlreadyExists:   "File already exists",
+	InputPastEnd:        "Input past end",
+	BadRecordNumber:     "Bad record number",
+	PermissionDenied:    "Permission denied",
+	PathNotFound:        "Path not found",
+}
+
+// String returns the classic message for the code.
+func (c ErrorCode) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Error %d", int(c))
+}
+
+// RuntimeError is a BASIC error that stopped a program. Run, Continue and
+// Step return it, so an embedder can use errors.As to find the code and
+// line rather than parse the message.
+type RuntimeError struct {
+	Code ErrorCode
+	// Line is the number of the line that failed, and Source its text.
+	Line   int
+	Source string
+	// Column and EndColumn give the part of Source that was running, the
+	// statement, counting bytes from 1 to just after its last character.
+	// They are 0 when that is not known.
+	Column, EndColumn int
+	// Gosubs are the lines of the active GOSUBs, innermost first.
+	Gosubs []int
+	// Err is the error itself, whose message gives the detail.
+	Err error
+}
+
+func (e *RuntimeError) Error() string {
+	if e.Code == OutOfMemory {
+		return fmt.Sprintf("%v in line %d%s", e.Err, e.Line, formatGosubs(e.Gosubs))
+	}
+	return fmt.Sprintf("error at line %d: %v%s", e.Line, e.Err, formatGosubs(e.Gosubs))
+}
+
+func (e *RuntimeError) Unwrap() error { return e.Err }
+
+// codedError is an error raised with a BASIC error code.
+type codedError struct {
+	code ErrorCode
+	msg  string
+}
+
+func (e *codedError) Error() string { return e.msg }
+
+// errorf returns an error with the given code and message.
+func errorf(code ErrorCode, format string, args ...any) error {
+	return &codedError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// fileError describes a failed file operation, with the code for the kind
+// of failure.
+func fileError(op string, err error) error {
+	code := DeviceIOError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = FileNotFound
+	case errors.Is(err, fs.ErrPermission):
+		code = PermissionDenied
+	case errors.Is(err, fs.ErrExist):
+		code = FileAlreadyExists
+	}
+	return errorf(code, "%s: %v", op, err)
+}
+
+// errorCode finds the code for err: the one it was raised with, Out of
+// memory, or Illegal function call for anything else, as classic BASIC
+// reports a bad argument.
+func errorCode(err error) ErrorCode {
+	var coded *codedError
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.Is(err, errOutOfMemory):
+		return OutOfMemory
+	}
+	return IllegalFunctionCall
+}
+
+// runtimeError wraps err, raised by stmt on line lineNum, as a
+// *RuntimeError. stmt is nil for an error between statements.
+func (e *Evaluator) runtimeError(lineNum int, stmt ast.Statement, err error) error {
+	rt := &RuntimeError{
+		Code:   errorCode(err),
+		Line:   lineNum,
+		Source: e.program.Source[lineNum],
+		Gosubs: e.gosubLines(),
+		Err:    err,
+	}
+	if stmt != nil {
+		rt.Column, rt.EndColumn = e.program.Span(lineNum, stmt)
+	}
+	return rt
+}
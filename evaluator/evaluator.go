@@ -2,70 +2,79 @@ package evaluator
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/basis-ex/ast"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/graphics"
+	"io"
 	"math"
 	"os"
-	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
-type ValueType string
-
-const (
-	NUMBER_VAL ValueType = "NUMBER"
-	STRING_VAL ValueType = "STRING"
-	ARRAY_VAL  ValueType = "ARRAY"
-)
-
-type Value interface {
-	Type() ValueType
-	Inspect() string
-}
-
-type NumberValue struct {
-	Value float64
-}
-
-func (n *NumberValue) Type() ValueType { return NUMBER_VAL }
-func (n *NumberValue) Inspect() string { return fmt.Sprintf("%g", n.Value) }
-
-type StringValue struct {
-	Value string
-}
-
-func (s *StringValue) Type() ValueType { return STRING_VAL }
-func (s *StringValue) Inspect() string { return s.Value }
-
 type ArrayValue struct {
 	Elements map[int]Value
+	Size     int
 }
 
-func (a *ArrayValue) Type() ValueType { return ARRAY_VAL }
-func (a *ArrayValue) Inspect() string { return "[ARRAY]" }
-
 type Environment struct {
-	variables map[string]Value
-	arrays    map[string]*ArrayValue
-	reader    *bufio.Reader
+	// variables holds each variable's value behind a pointer, which
+	// compiled expressions keep to read it without a map lookup; see
+	// closures.go. generation changes whenever variables are removed, so
+	// that they know to look again.
+	variables  map[string]*Value
+	generation int
+	arrays     map[string]*ArrayValue
+	memory     *Memory
+	reader     *bufio.Reader
+	// keyboard is the file behind reader when it is one, so INPUT$ can
+	// put a terminal into single-key mode.
+	keyboard *os.File
 }
 
 func NewEnvironment() *Environment {
 	return &Environment{
-		variables: make(map[string]Value),
+		variables: make(map[string]*Value),
 		arrays:    make(map[string]*ArrayValue),
+		memory:    NewMemory(),
 		reader:    bufio.NewReader(os.Stdin),
+		keyboard:  os.Stdin,
+	}
+}
+
+// NewScope returns an empty environment for a procedure's local variables.
+// It shares the caller's memory and input reader.
+func (e *Environment) NewScope() *Environment {
+	return &Environment{
+		variables: make(map[string]*Value),
+		arrays:    make(map[string]*ArrayValue),
+		memory:    e.memory,
+		reader:    e.reader,
+		keyboard:  e.keyboard,
 	}
 }
 
 func (e *Environment) Get(name string) (Value, bool) {
 	val, ok := e.variables[name]
-	return val, ok
+	if !ok {
+		return Value{}, false
+	}
+	return *val, true
 }
 
 func (e *Environment) Set(name string, val Value) {
-	e.variables[name] = val
+	if p, ok := e.variables[name]; ok {
+		*p = val
+		return
+	}
+	p := new(Value)
+	*p = val
+	e.variables[name] = p
 }
 
 func (e *Environment) GetArray(name string) (*ArrayValue, bool) {
@@ -77,64 +86,417 @@ func (e *Environment) SetArray(name string, arr *ArrayValue) {
 	e.arrays[name] = arr
 }
 
+// DefaultMaxGosubDepth is how deeply GOSUBs may nest before the program is
+// stopped with an "Out of memory" error.
+const DefaultMaxGosubDepth = 1000
+
+// errOutOfMemory mirrors the classic BASIC message for a runaway GOSUB, or
+// a string or array past the limits in limits.go.
+var errOutOfMemory = errors.New("Out of memory")
+
 type Evaluator struct {
-	env         *Environment
-	program     *ast.Program
-	lines       []int
-	currentLine int
-	callStack   []int
-	forLoops    map[string]*ForLoopState
-	halted      bool
+	// plan is the program, resolved for running; see plan.go.
+	*plan
+	// compiled holds the program's expressions as closures; see
+	// closures.go.
+	compiled      compiledExpressions
+	env           *Environment
+	currentLine   int
+	stmtIndex     int
+	next          position
+	jumped        bool
+	callStack     []position
+	maxGosubDepth int
+	// maxStringLength and maxArrayCells are the memory limits; see
+	// limits.go.
+	maxStringLength int
+	maxArrayCells   int
+	forLoops        []*ForLoopState
+	dataPtr         int
+	halted          bool
+	exitStatus      int
+	stats           Stats
+	maxSteps        int64
+	timeout         time.Duration
+	deadline        time.Time
+	args            []string
+	allowShell      bool
+	sandboxed       bool
+	terminal        bool
+	files           map[int]*randomFile
+	frames          []*callFrame
+	dialect         dialect.Dialect
+	// column is where PRINT has left the output line, for its zones.
+	column int
+	// graphics is what the graphics statements draw with, and screenOn
+	// whether SCREEN has started a screen; see graphics.go.
+	graphics      graphics.Backend
+	screenOn      bool
+	timer         eventTimer
+	inputRetry    bool
+	scripted      bool
+	interrupted   atomic.Bool
+	paused        atomic.Bool
+	running       bool
+	started       bool
+	wake          chan struct{}
+	hostFunctions map[string]HostFunction
+	events        EventHandler
+	ctx           context.Context
+	lineHook      func(line int) bool
+	hooks         Hooks
+	out           io.Writer
+	errOut        io.Writer
 }
 
+// ForLoopState is an active FOR loop. Loops are kept innermost-last so a
+// bare NEXT closes the most recent FOR.
 type ForLoopState struct {
 	Variable  string
 	End       float64
 	Step      float64
-	NextLine  int
 	StartLine int
+	// body is the index in StartLine's layout of the statement after the
+	// FOR, which may be inside the same THEN or ELSE branch.
+	body int
 }
 
-func New(program *ast.Program) *Evaluator {
-	lines := make([]int, 0, len(program.Statements))
-	for lineNum := range program.Statements {
-		lines = append(lines, lineNum)
+// Options chooses the streams a program uses. A nil field leaves the
+// process's own standard stream in place.
+type Options struct {
+	// Stdin is read by INPUT and INPUT$.
+	Stdin io.Reader
+	// Stdout receives PRINT and every other statement's output.
+	Stdout io.Writer
+	// Stderr receives the error output of SHELL commands.
+	Stderr io.Writer
+}
+
+// New prepares program to run with the streams in opts.
+func New(program *ast.Program, opts Options) *Evaluator {
+	e := &Evaluator{
+		plan:            newPlan(program),
+		env:             NewEnvironment(),
+		callStack:       []position{},
+		maxGosubDepth:   DefaultMaxGosubDepth,
+		maxStringLength: DefaultMaxStringLength,
+		maxArrayCells:   DefaultMaxArrayCells,
+		forLoops:        []*ForLoopState{},
+		halted:          false,
+		out:             os.Stdout,
+		errOut:          os.Stderr,
+		terminal:        isTerminal(os.Stdout),
+		files:           make(map[int]*randomFile),
+		timer:           eventTimer{target: -1},
+		inputRetry:      true,
+		wake:            make(chan struct{}, 1),
+		ctx:             context.Background(),
+	}
+	e.compileExpressions()
+	if opts.Stdin != nil {
+		e.SetStdin(opts.Stdin)
+	}
+	if opts.Stdout != nil {
+		e.SetOutput(opts.Stdout)
+	}
+	if opts.Stderr != nil {
+		e.SetErrorOutput(opts.Stderr)
 	}
-	sort.Ints(lines)
+	return e
+}
+
+// SetEnvironment makes the program use env for its variables, arrays and
+// memory instead of a fresh environment, so that a REPL can keep them
+// between RUN and statements typed at the prompt. Call it before Run.
+func (e *Evaluator) SetEnvironment(env *Environment) {
+	e.env = env
+}
+
+// SetArgs sets the command-line arguments reported by COMMAND$.
+func (e *Evaluator) SetArgs(args []string) {
+	e.args = args
+}
+
+// SetMaxGosubDepth limits how many GOSUBs may be active at once. A value of
+// zero or less removes the limit.
+func (e *Evaluator) SetMaxGosubDepth(n int) {
+	e.maxGosubDepth = n
+}
 
-	return &Evaluator{
-		env:       NewEnvironment(),
-		program:   program,
-		lines:     lines,
-		callStack: []int{},
-		forLoops:  make(map[string]*ForLoopState),
-		halted:    false,
+// BreakError is returned by Run and Continue when the program was stopped by
+// Interrupt. Line is the line that would have run next.
+type BreakError struct {
+	Line int
+}
+
+func (b *BreakError) Error() string {
+	return fmt.Sprintf("Break in line %d", b.Line)
+}
+
+// Interrupt asks the running program to stop before its next statement, as
+// Ctrl-C does. It is safe to call from another goroutine, such as a signal
+// handler. Run then returns a *BreakError, and Continue picks up from there.
+func (e *Evaluator) Interrupt() {
+	e.interrupted.Store(true)
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ErrExecutionLimit is returned, wrapped, by Run and Continue when the
+// program goes past the limits set with SetMaxSteps or SetTimeout.
+var ErrExecutionLimit = errors.New("program exceeded execution limit")
+
+// SetMaxSteps stops the program with ErrExecutionLimit once it has executed
+// n statements, so a runaway loop in an untrusted program cannot run
+// forever. A value of zero or less removes the limit.
+func (e *Evaluator) SetMaxSteps(n int64) {
+	e.maxSteps = n
+}
+
+// SetTimeout stops the program with ErrExecutionLimit once it has run for
+// d, measured from Run. The clock is checked between statements, so a
+// program waiting for INPUT is not stopped until it gets its answer. A
+// duration of zero or less removes the limit.
+func (e *Evaluator) SetTimeout(d time.Duration) {
+	e.timeout = d
+}
+
+// SetInputRetry chooses what INPUT does when a numeric variable is given
+// something that is not a number. By default it prints "?Redo from start"
+// and asks again, as classic BASIC does. With retry disabled the statement
+// fails with a type mismatch instead, which suits an embedder whose input
+// comes from a script that cannot answer a second prompt.
+func (e *Evaluator) SetInputRetry(enabled bool) {
+	e.inputRetry = enabled
+}
+
+// SetInput makes INPUT, and INPUT$ from the keyboard, read from r instead
+// of the terminal, one answer per line. Each answer is echoed after its
+// prompt so the output reads like a session at the keyboard, and an INPUT
+// that finds r exhausted fails rather than waiting. Call it after
+// SetEnvironment, which brings its own reader.
+func (e *Evaluator) SetInput(r io.Reader) {
+	e.SetStdin(r)
+	e.scripted = true
+}
+
+// SetStdin makes INPUT and INPUT$ read what the user types from r instead
+// of standard input. Call it after SetEnvironment, which brings its own
+// reader.
+func (e *Evaluator) SetStdin(r io.Reader) {
+	e.env.reader = bufio.NewReader(r)
+	e.env.keyboard, _ = r.(*os.File)
+}
+
+// SetOutput sends the program's output to w instead of standard output.
+// CLS, LOCATE and COLOR only write their control codes when w is a
+// terminal.
+func (e *Evaluator) SetOutput(w io.Writer) {
+	e.out = w
+	f, ok := w.(*os.File)
+	e.terminal = ok && isTerminal(f)
+}
+
+// SetErrorOutput sends what SHELL commands write to their standard error
+// to w instead of the interpreter's.
+func (e *Evaluator) SetErrorOutput(w io.Writer) {
+	e.errOut = w
+}
+
+// SetPageLength turns on --More-- pagination every n lines of output. Paging
+// only happens when both stdin and stdout are terminals; redirected output is
+// never paused. A length of zero or less turns paging off.
+func (e *Evaluator) SetPageLength(n int) {
+	if pager, ok := e.out.(*Pager); ok {
+		e.out = pager.w
+	}
+	if n > 0 && e.terminal && e.env.keyboard != nil && isTerminal(e.env.keyboard) {
+		e.out = NewPager(e.out, e.env.reader, n)
 	}
 }
 
-func (e *Evaluator) Run() error {
+// Run runs the program from its first line. It stops early, returning a
+// *CancelError, if ctx is cancelled; see Continue.
+func (e *Evaluator) Run(ctx context.Context) error {
 	if len(e.lines) == 0 {
 		return nil
 	}
 
-	e.currentLine = 0
+	e.currentLine, e.stmtIndex = 0, 0
+	e.stats = Stats{}
+	e.deadline = time.Now().Add(e.timeout)
+	return e.run(ctx, false)
+}
 
+// Continue resumes a program stopped by Interrupt, Pause, Step or the line
+// hook at the statement where it broke off, with its variables, loops and
+// GOSUB stack as they were. The line hook is not consulted for that first line, so a
+// breakpoint there does not stop the program again at once.
+//
+// ctx is checked before every statement and while the program waits in
+// INPUT or SLEEP. Once it is cancelled the run returns a *CancelError,
+// which wraps ctx.Err(); the program is left where it stopped and can be
+// continued with a fresh context.
+func (e *Evaluator) Continue(ctx context.Context) error {
+	if e.halted || e.currentLine >= len(e.lines) {
+		return errorf(CantContinue, "Can't continue")
+	}
+	return e.run(ctx, true)
+}
+
+func (e *Evaluator) run(ctx context.Context, resumed bool) error {
+	e.ctx = ctx
+	defer func() { e.ctx = context.Background() }()
+
+	e.running, e.started = true, true
+	defer func() { e.running = false }()
+	e.paused.Store(false)
+
+	done := ctx.Done()
 	for e.currentLine < len(e.lines) && !e.halted {
-		lineNum := e.lines[e.currentLine]
-		stmt := e.program.Statements[lineNum]
+		line := e.lines[e.currentLine]
+		// Cancellation and Ctrl-C are noticed between statements, not
+		// just between lines, so a loop that never leaves its line still
+		// stops.
+		select {
+		case <-done:
+			return &CancelError{Line: line, Err: ctx.Err()}
+		default:
+		}
+		// Load first: Swap is a locked write, too slow for every statement.
+		if e.interrupted.Load() && e.interrupted.Swap(false) {
+			select {
+			case <-e.wake:
+			default:
+			}
+			// Open files stay open so the program can be continued.
+			return &BreakError{Line: line}
+		}
+		if e.stmtIndex == 0 && e.lineHook != nil && !resumed && e.lineHook(line) {
+			return &BreakError{Line: line}
+		}
+		if e.paused.Load() && e.paused.Swap(false) {
+			return &BreakError{Line: line}
+		}
+		resumed = false
 
-		err := e.evalStatement(stmt)
-		if err != nil {
-			return fmt.Errorf("error at line %d: %v", lineNum, err)
+		if err := e.step(); err != nil {
+			return err
 		}
+	}
 
-		e.currentLine++
+	e.sampleMemory()
+	e.closeFiles()
+	return nil
+}
+
+// step runs the statement at currentLine and stmtIndex, or enters the ON
+// TIMER handler if an event is due before it.
+func (e *Evaluator) step() error {
+	lineNum := e.lines[e.currentLine]
+
+	trapped, err := e.pollTimer()
+	if err != nil {
+		e.closeFiles()
+		return e.runtimeError(lineNum, nil, err)
+	}
+	if trapped {
+		return nil
+	}
+
+	if e.stmtIndex == 0 && e.hooks.OnLineStart != nil {
+		e.hooks.OnLineStart(lineNum)
+	}
+
+	e.jumped = false
+	stmt := e.statements(e.currentLine)[e.stmtIndex]
+	err = e.evalStatement(stmt)
+	if err != nil && e.ctx.Err() != nil {
+		// Cancelled while waiting; the statement runs again on Continue.
+		return &CancelError{Line: lineNum, Err: e.ctx.Err()}
+	}
+	if err != nil {
+		e.closeFiles()
+		if errors.Is(err, ErrExecutionLimit) {
+			return fmt.Errorf("%w in line %d%s", err, lineNum, formatGosubs(e.gosubLines()))
+		}
+		return e.runtimeError(lineNum, stmt, err)
 	}
 
+	if !e.jumped {
+		e.next = e.after()
+	}
+	e.currentLine, e.stmtIndex = e.next.line, e.next.stmt
+	if e.currentLine < len(e.lines) && e.stmtIndex >= len(e.statements(e.currentLine)) {
+		e.currentLine, e.stmtIndex = e.currentLine+1, 0
+	}
 	return nil
 }
 
+// callSite is the number of the line a GOSUB stack entry returns to.
+func (e *Evaluator) callSite(pos position) int {
+	return e.lines[pos.line]
+}
+
+// gosubLines lists the lines of the active GOSUBs, innermost first.
+func (e *Evaluator) gosubLines() []int {
+	lines := make([]int, 0, len(e.callStack))
+	for i := len(e.callStack) - 1; i >= 0; i-- {
+		lines = append(lines, e.callSite(e.callStack[i]))
+	}
+	return lines
+}
+
+// formatGosubs describes GOSUB lines, innermost first, for inclusion in
+// runtime error messages.
+func formatGosubs(lines []int) string {
+	if len(lines) == 0 {
+		return ""
+	}
+
+	const shown = 10
+	parts := []string{}
+	for _, line := range lines[:min(len(lines), shown)] {
+		parts = append(parts, fmt.Sprintf("line %d", line))
+	}
+	if len(lines) > shown {
+		parts = append(parts, fmt.Sprintf("... %d more", len(lines)-shown))
+	}
+	return " (GOSUB from " + strings.Join(parts, " <- ") + ")"
+}
+
 func (e *Evaluator) evalStatement(stmt ast.Statement) error {
+	// A sequence only groups the statements of a line, so it is neither
+	// counted nor reported; each of its statements is.
+	if seq, ok := stmt.(*ast.SequenceStatement); ok {
+		for _, inner := range seq.Statements {
+			if err := e.evalStatement(inner); err != nil {
+				return err
+			}
+			if e.jumped || e.halted {
+				break
+			}
+		}
+		return nil
+	}
+
+	e.stats.Statements++
+	if e.maxSteps > 0 && e.stats.Statements > e.maxSteps {
+		return fmt.Errorf("%w: more than %d statements", ErrExecutionLimit, e.maxSteps)
+	}
+	if e.stats.Statements%statsInterval == 0 {
+		e.sampleMemory()
+		if e.timeout > 0 && time.Now().After(e.deadline) {
+			return fmt.Errorf("%w: ran longer than %v", ErrExecutionLimit, e.timeout)
+		}
+	}
+
+	if e.hooks.OnStatement != nil {
+		e.hooks.OnStatement(e.lineNumber(), stmt)
+	}
+
 	switch s := stmt.(type) {
 	case *ast.PrintStatement:
 		return e.evalPrintStatement(s)
@@ -155,22 +517,76 @@ func (e *Evaluator) evalStatement(stmt ast.Statement) error {
 	case *ast.InputStatement:
 		return e.evalInputStatement(s)
 	case *ast.EndStatement:
-		e.halted = true
-		return nil
+		return e.evalEndStatement(s)
 	case *ast.RemStatement:
 		return nil
+	case *ast.LabelStatement:
+		return nil
 	case *ast.DimStatement:
 		return e.evalDimStatement(s)
+	case *ast.DumpStatement:
+		return e.dump()
+	case *ast.ShellStatement:
+		return e.evalShellStatement(s)
+	case *ast.SleepStatement:
+		return e.evalSleepStatement(s)
+	case *ast.PokeStatement:
+		return e.evalPokeStatement(s)
+	case *ast.OpenStatement:
+		return e.evalOpenStatement(s)
+	case *ast.CloseStatement:
+		return e.evalCloseStatement(s)
+	case *ast.FieldStatement:
+		return e.evalFieldStatement(s)
+	case *ast.RecordStatement:
+		return e.evalRecordStatement(s)
+	case *ast.JustifyStatement:
+		return e.evalJustifyStatement(s)
+	case *ast.FilesStatement:
+		return e.evalFilesStatement(s)
+	case *ast.KillStatement:
+		return e.evalKillStatement(s)
+	case *ast.NameStatement:
+		return e.evalNameStatement(s)
+	case *ast.ChdirStatement:
+		return e.evalChdirStatement(s)
+	case *ast.SubStatement:
+		return e.evalSubStatement(s)
+	case *ast.EndSubStatement:
+		return e.evalEndSubStatement()
+	case *ast.CallStatement:
+		return e.evalCallStatement(s)
+	case *ast.HostCallStatement:
+		return e.evalHostCallStatement(s)
+	case *ast.OnTimerStatement:
+		return e.evalOnTimerStatement(s)
+	case *ast.TimerStatement:
+		return e.evalTimerStatement(s)
+	case *ast.ClsStatement:
+		return e.cls()
+	case *ast.LocateStatement:
+		return e.evalLocateStatement(s)
+	case *ast.ScreenStatement:
+		return e.evalScreenStatement(s)
+	case *ast.PlotStatement:
+		return e.evalPlotStatement(s)
+	case *ast.DrawLineStatement:
+		return e.evalDrawLineStatement(s)
+	case *ast.CircleStatement:
+		return e.evalCircleStatement(s)
+	case *ast.ScreenSaveStatement:
+		return e.evalScreenSaveStatement(s)
+	case *ast.ColorStatement:
+		return e.evalColorStatement(s)
+	case *ast.DataStatement:
+		return nil
+	case *ast.ReadStatement:
+		return e.evalReadStatement(s)
+	case *ast.RestoreStatement:
+		return e.evalRestoreStatement(s)
 	case *ast.ExpressionStatement:
 		_, err := e.evalExpression(s.Expression)
 		return err
-	case *ast.SequenceStatement:
-		for _, inner := range s.Statements {
-			if err := e.evalStatement(inner); err != nil {
-				return err
-			}
-		}
-		return nil
 	default:
 		return fmt.Errorf("unknown statement type: %T", stmt)
 	}
@@ -178,7 +594,7 @@ func (e *Evaluator) evalStatement(stmt ast.Statement) error {
 
 func (e *Evaluator) evalPrintStatement(stmt *ast.PrintStatement) error {
 	if len(stmt.Expressions) == 0 {
-		fmt.Println()
+		e.print("\n")
 		return nil
 	}
 
@@ -188,27 +604,70 @@ func (e *Evaluator) evalPrintStatement(stmt *ast.PrintStatement) error {
 			return err
 		}
 
-		fmt.Print(val.Inspect())
+		e.print(val.Inspect())
 
 		if i < len(stmt.Separators) {
-			fmt.Print(stmt.Separators[i])
+			sep := stmt.Separators[i]
+			if sep == "\t" {
+				sep = e.dialect.Zone(e.column)
+			}
+			e.print(sep)
 		}
 	}
 
 	if stmt.TrailingNewline {
-		fmt.Println()
+		e.print("\n")
 	}
 
 	return nil
 }
 
+// print writes text for PRINT, keeping track of the column it leaves the
+// output at.
+func (e *Evaluator) print(text string) {
+	fmt.Fprint(e.out, text)
+	e.column = dialect.Column(e.column, text)
+}
+
 func (e *Evaluator) evalLetStatement(stmt *ast.LetStatement) error {
+	if stmt.Index != nil {
+		return e.evalElementAssignment(stmt)
+	}
+
+	val, err := e.evalExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+
+	e.setVariable(stmt.Name.Value, val)
+	return nil
+}
+
+// evalElementAssignment runs LET A(I) = value, which needs A to have been
+// DIMmed with room for I. The index and value are worked out first.
+func (e *Evaluator) evalElementAssignment(stmt *ast.LetStatement) error {
+	indexVal, err := e.evalExpression(stmt.Index)
+	if err != nil {
+		return err
+	}
 	val, err := e.evalExpression(stmt.Value)
 	if err != nil {
 		return err
 	}
+	return e.setElement(stmt.Name.Value, indexVal, val)
+}
 
-	e.env.Set(stmt.Name.Value, val)
+// setElement stores val in element indexVal of array name.
+func (e *Evaluator) setElement(name string, indexVal, val Value) error {
+	arr, ok := e.env.GetArray(name)
+	if !ok {
+		return errorf(SubscriptOutOfRange, "array %s not defined", name)
+	}
+	index, err := arrayIndex(name, arr, indexVal)
+	if err != nil {
+		return err
+	}
+	arr.Elements[index] = val
 	return nil
 }
 
@@ -218,6 +677,15 @@ func (e *Evaluator) evalIfStatement(stmt *ast.IfStatement) error {
 		return err
 	}
 
+	// An IF of the program goes on to its branch's statements, laid out
+	// after it; one run by Exec runs its branch itself.
+	if i, ok := e.branches[stmt]; ok {
+		if !isTruthy(condition) {
+			e.jump(e.currentLine, e.code[e.currentLine].Else[i])
+		}
+		return nil
+	}
+
 	if isTruthy(condition) {
 		return e.evalStatement(stmt.Consequence)
 	} else if stmt.Alternative != nil {
@@ -228,58 +696,64 @@ func (e *Evaluator) evalIfStatement(stmt *ast.IfStatement) error {
 }
 
 func (e *Evaluator) evalGotoStatement(stmt *ast.GotoStatement) error {
-	lineVal, err := e.evalExpression(stmt.LineNumber)
+	target, err := e.jumpTarget(stmt.LineNumber, "GOTO")
 	if err != nil {
 		return err
 	}
 
-	numVal, ok := lineVal.(*NumberValue)
-	if !ok {
-		return fmt.Errorf("GOTO requires a number")
+	e.jump(target, 0)
+	return nil
+}
+
+// jumpTarget works out the line index a GOTO or GOSUB refers to: either a
+// named label or an expression giving a line number. Labels and constant
+// line numbers were resolved by the plan; anything else is evaluated.
+func (e *Evaluator) jumpTarget(expr ast.Expression, keyword string) (int, error) {
+	if i, ok := e.targets[expr]; ok {
+		return i, nil
 	}
 
-	targetLine := int(numVal.Value)
-	for i, line := range e.lines {
-		if line == targetLine {
-			e.currentLine = i - 1
-			return nil
-		}
+	lineVal, err := e.evalExpression(expr)
+	if err != nil {
+		return 0, err
 	}
 
-	return fmt.Errorf("line %d not found", targetLine)
+	numVal, ok := lineVal.AsNumber()
+	if !ok {
+		return 0, errorf(TypeMismatch, "%s requires a number", keyword)
+	}
+
+	i, ok := e.lineIndex[int(numVal)]
+	if !ok {
+		return 0, errorf(UndefinedLine, "line %d not found", int(numVal))
+	}
+	return i, nil
 }
 
 func (e *Evaluator) evalGosubStatement(stmt *ast.GosubStatement) error {
-	lineVal, err := e.evalExpression(stmt.LineNumber)
+	target, err := e.jumpTarget(stmt.LineNumber, "GOSUB")
 	if err != nil {
 		return err
 	}
 
-	numVal, ok := lineVal.(*NumberValue)
-	if !ok {
-		return fmt.Errorf("GOSUB requires a number")
+	if e.maxGosubDepth > 0 && len(e.callStack) >= e.maxGosubDepth {
+		return errOutOfMemory
 	}
 
-	e.callStack = append(e.callStack, e.currentLine)
-
-	targetLine := int(numVal.Value)
-	for i, line := range e.lines {
-		if line == targetLine {
-			e.currentLine = i - 1
-			return nil
-		}
-	}
-
-	return fmt.Errorf("line %d not found", targetLine)
+	e.callStack = append(e.callStack, e.after())
+	e.jump(target, 0)
+	return nil
 }
 
 func (e *Evaluator) evalReturnStatement(stmt *ast.ReturnStatement) error {
 	if len(e.callStack) == 0 {
-		return fmt.Errorf("RETURN without GOSUB")
+		return errorf(ReturnWithoutGosub, "RETURN without GOSUB")
 	}
 
-	e.currentLine = e.callStack[len(e.callStack)-1]
+	ret := e.callStack[len(e.callStack)-1]
 	e.callStack = e.callStack[:len(e.callStack)-1]
+	e.jump(ret.line, ret.stmt)
+	e.timerReturned()
 
 	return nil
 }
@@ -290,19 +764,19 @@ func (e *Evaluator) evalForStatement(stmt *ast.ForStatement) error {
 		return err
 	}
 
-	startNum, ok := startVal.(*NumberValue)
+	startNum, ok := startVal.AsNumber()
 	if !ok {
-		return fmt.Errorf("FOR start value must be a number")
+		return errorf(TypeMismatch, "FOR start value must be a number")
 	}
 
-	endVal, err := e.evalExpression(stmt.End)
+	endVal, err := e.evalExpression(stmt.Limit)
 	if err != nil {
 		return err
 	}
 
-	endNum, ok := endVal.(*NumberValue)
+	endNum, ok := endVal.AsNumber()
 	if !ok {
-		return fmt.Errorf("FOR end value must be a number")
+		return errorf(TypeMismatch, "FOR end value must be a number")
 	}
 
 	stepVal, err := e.evalExpression(stmt.Step)
@@ -310,102 +784,262 @@ func (e *Evaluator) evalForStatement(stmt *ast.ForStatement) error {
 		return err
 	}
 
-	stepNum, ok := stepVal.(*NumberValue)
+	stepNum, ok := stepVal.AsNumber()
 	if !ok {
-		return fmt.Errorf("FOR step value must be a number")
+		return errorf(TypeMismatch, "FOR step value must be a number")
 	}
 
-	e.env.Set(stmt.Variable.Value, startNum)
+	e.setVariable(stmt.Variable.Value, Number(startNum))
+
+	// Re-entering a FOR on a variable that is already looping restarts it,
+	// discarding that loop and anything nested inside it.
+	if i := e.findForLoop(stmt.Variable.Value); i >= 0 {
+		e.forLoops = e.forLoops[:i]
+	}
 
-	e.forLoops[stmt.Variable.Value] = &ForLoopState{
+	if !loopContinues(startNum, endNum, stepNum) {
+		next, ok := e.forNext[stmt]
+		if !ok {
+			return errorf(ForWithoutNext, "FOR without NEXT")
+		}
+		e.jump(next.Line, e.code[next.Line].Next[next.Stmt])
+		return nil
+	}
+
+	e.forLoops = append(e.forLoops, &ForLoopState{
 		Variable:  stmt.Variable.Value,
-		End:       endNum.Value,
-		Step:      stepNum.Value,
+		End:       endNum,
+		Step:      stepNum,
 		StartLine: e.currentLine,
-	}
+		body:      e.after().stmt,
+	})
 
 	return nil
 }
 
 func (e *Evaluator) evalNextStatement(stmt *ast.NextStatement) error {
-	var varName string
+	loopIndex := len(e.forLoops) - 1
 	if stmt.Variable != nil {
-		varName = stmt.Variable.Value
-	} else {
-		for name := range e.forLoops {
-			varName = name
-			break
-		}
+		loopIndex = e.findForLoop(stmt.Variable.Value)
 	}
 
-	if varName == "" {
-		return fmt.Errorf("NEXT without FOR")
+	if loopIndex < 0 {
+		return errorf(NextWithoutFor, "NEXT without FOR")
 	}
 
-	loopState, ok := e.forLoops[varName]
-	if !ok {
-		return fmt.Errorf("NEXT without matching FOR")
-	}
+	// NEXT on an outer variable implicitly closes any loops nested inside it.
+	e.forLoops = e.forLoops[:loopIndex+1]
+	loopState := e.forLoops[loopIndex]
+	varName := loopState.Variable
 
 	val, ok := e.env.Get(varName)
 	if !ok {
-		return fmt.Errorf("loop variable %s not found", varName)
+		return errorf(NextWithoutFor, "loop variable %s not found", varName)
 	}
 
-	numVal, ok := val.(*NumberValue)
+	numVal, ok := val.AsNumber()
 	if !ok {
-		return fmt.Errorf("loop variable must be a number")
+		return errorf(TypeMismatch, "loop variable must be a number")
 	}
 
-	newVal := numVal.Value + loopState.Step
+	newVal := numVal + loopState.Step
 
-	shouldContinue := false
-	if loopState.Step > 0 {
-		shouldContinue = newVal <= loopState.End
+	if loopContinues(newVal, loopState.End, loopState.Step) {
+		e.setVariable(varName, Number(newVal))
+		e.jump(loopState.StartLine, loopState.body)
 	} else {
-		shouldContinue = newVal >= loopState.End
+		e.forLoops = e.forLoops[:loopIndex]
 	}
 
-	if shouldContinue {
-		e.env.Set(varName, &NumberValue{Value: newVal})
-		e.currentLine = loopState.StartLine
-	} else {
-		delete(e.forLoops, varName)
-	}
+	return nil
+}
 
+// evalEndStatement stops the program, recording the status given to END n
+// or SYSTEM n for ExitStatus.
+func (e *Evaluator) evalEndStatement(stmt *ast.EndStatement) error {
+	if stmt.Status != nil {
+		val, err := e.evalExpression(stmt.Status)
+		if err != nil {
+			return err
+		}
+		num, ok := val.AsNumber()
+		if !ok || num < 0 || num > 255 || num != math.Trunc(num) {
+			return errorf(IllegalFunctionCall, "%s status must be 0 to 255", strings.ToUpper(stmt.Token.Literal))
+		}
+		e.exitStatus = int(num)
+	}
+	e.halted = true
 	return nil
 }
 
-func (e *Evaluator) evalInputStatement(stmt *ast.InputStatement) error {
-	if stmt.Prompt != "" {
-		fmt.Print(stmt.Prompt)
-		if !strings.HasSuffix(stmt.Prompt, " ") {
-			fmt.Print(" ")
+// ExitStatus is the status the program gave to END n or SYSTEM n, or 0 if
+// it ended without one.
+func (e *Evaluator) ExitStatus() int {
+	return e.exitStatus
+}
+
+// findForLoop returns the position of the active loop on name, or -1.
+func (e *Evaluator) findForLoop(name string) int {
+	for i := len(e.forLoops) - 1; i >= 0; i-- {
+		if e.forLoops[i].Variable == name {
+			return i
 		}
 	}
+	return -1
+}
 
-	input, err := e.env.reader.ReadString('\n')
-	if err != nil {
-		return err
+// loopContinues reports whether a loop variable holding value is still
+// within bounds. The same test runs before the first pass, so a loop whose
+// start is already past its end executes zero times.
+func loopContinues(value, end, step float64) bool {
+	if step < 0 {
+		return value >= end
 	}
+	return value <= end
+}
 
-	input = strings.TrimSpace(input)
-	values := strings.Split(input, ",")
+func (e *Evaluator) evalInputStatement(stmt *ast.InputStatement) error {
+	for {
+		fmt.Fprint(e.out, stmt.PromptText())
+
+		input, err := e.waitForInput(func() (string, error) {
+			return e.env.reader.ReadString('\n')
+		})
+		if e.ctx.Err() != nil {
+			return err
+		}
+		if e.scripted {
+			if err == io.EOF && input == "" {
+				return errorf(InputPastEnd, "Out of INPUT answers")
+			}
+			fmt.Fprintln(e.out, strings.TrimRight(input, "\r\n"))
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		if err == io.EOF {
+			return errorf(InputPastEnd, "Input past end")
+		}
+		if err != nil {
+			return err
+		}
+		if pager, ok := e.out.(*Pager); ok {
+			pager.Reset()
+		}
+		// The answer ends the line.
+		e.column = 0
 
-	for i, variable := range stmt.Variables {
-		if i >= len(values) {
-			e.env.Set(variable.Value, &NumberValue{Value: 0})
+		values, ok := InputValues(input, stmt.Variables)
+		if !ok {
+			if !e.inputRetry {
+				return errorf(TypeMismatch, "Type mismatch in INPUT")
+			}
+			fmt.Fprintln(e.out, "?Redo from start")
 			continue
 		}
 
-		val := strings.TrimSpace(values[i])
-		if num, err := strconv.ParseFloat(val, 64); err == nil {
-			e.env.Set(variable.Value, &NumberValue{Value: num})
-		} else {
-			e.env.Set(variable.Value, &StringValue{Value: val})
+		for i, variable := range stmt.Variables {
+			e.setVariable(variable.Value, values[i])
+		}
+		return nil
+	}
+}
+
+// InputValues splits a line of INPUT into one value per variable. String
+// variables (names ending in $) take the text as typed; the others need a
+// number, and ok is false when one of them gets anything else. Missing
+// items are 0 or the empty string.
+func InputValues(input string, variables []*ast.Identifier) ([]Value, bool) {
+	items := strings.Split(strings.TrimSpace(input), ",")
+	values := make([]Value, len(variables))
+
+	for i, variable := range variables {
+		text := ""
+		if i < len(items) {
+			text = strings.TrimSpace(items[i])
+		}
+
+		if strings.HasSuffix(variable.Value, "$") {
+			values[i] = String(text)
+			continue
+		}
+		if text == "" {
+			values[i] = Number(0)
+			continue
+		}
+		num, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, false
+		}
+		values[i] = Number(num)
+	}
+	return values, true
+}
+
+// evalReadStatement reads DATA into each variable or array element in
+// turn. An element's index is worked out before its item is read, and a
+// string item will not go in a numeric variable.
+func (e *Evaluator) evalReadStatement(stmt *ast.ReadStatement) error {
+	for _, target := range stmt.Variables {
+		switch target := target.(type) {
+		case *ast.Identifier:
+			val, err := e.readData(target.Value)
+			if err != nil {
+				return err
+			}
+			e.setVariable(target.Value, val)
+		case *ast.ArrayAccess:
+			indexVal, err := e.evalExpression(target.Index)
+			if err != nil {
+				return err
+			}
+			val, err := e.readData(target.Name.Value)
+			if err != nil {
+				return err
+			}
+			if err := e.setElement(target.Name.Value, indexVal, val); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
+
+// readData takes the next DATA item, for the variable or array name.
+func (e *Evaluator) readData(name string) (Value, error) {
+	if e.dataPtr >= len(e.data) {
+		return Value{}, errorf(OutOfData, "Out of DATA")
+	}
+	val := e.data[e.dataPtr]
+	if _, ok := val.AsNumber(); !ok && !strings.HasSuffix(name, "$") {
+		return Value{}, errorf(TypeMismatch, "Type mismatch in READ")
+	}
+	e.dataPtr++
+	return val, nil
+}
+
+func (e *Evaluator) evalRestoreStatement(stmt *ast.RestoreStatement) error {
+	if stmt.LineNumber == nil {
+		e.dataPtr = 0
+		return nil
+	}
 
+	lineVal, err := e.evalExpression(stmt.LineNumber)
+	if err != nil {
+		return err
+	}
+
+	numVal, ok := lineVal.AsNumber()
+	if !ok {
+		return errorf(TypeMismatch, "RESTORE requires a number")
+	}
+
+	targetLine := int(numVal)
+	offset, ok := e.dataOffsets[targetLine]
+	if !ok {
+		return errorf(UndefinedLine, "line %d not found", targetLine)
+	}
+	e.dataPtr = offset
 	return nil
 }
 
@@ -415,12 +1049,15 @@ func (e *Evaluator) evalDimStatement(stmt *ast.DimStatement) error {
 		return err
 	}
 
-	_, ok := sizeVal.(*NumberValue)
+	sizeNum, ok := sizeVal.AsNumber()
 	if !ok {
-		return fmt.Errorf("DIM size must be a number")
+		return errorf(TypeMismatch, "DIM size must be a number")
 	}
 
-	arr := &ArrayValue{Elements: make(map[int]Value)}
+	if err := e.checkArrayCells(stmt.Name.Value, int(sizeNum)); err != nil {
+		return err
+	}
+	arr := &ArrayValue{Elements: make(map[int]Value), Size: int(sizeNum)}
 	e.env.SetArray(stmt.Name.Value, arr)
 
 	return nil
@@ -429,175 +1066,218 @@ func (e *Evaluator) evalDimStatement(stmt *ast.DimStatement) error {
 func (e *Evaluator) evalExpression(expr ast.Expression) (Value, error) {
 	switch node := expr.(type) {
 	case *ast.NumberLiteral:
-		return &NumberValue{Value: node.Value}, nil
+		return Number(node.Value), nil
 	case *ast.StringLiteral:
-		return &StringValue{Value: node.Value}, nil
+		return String(node.Value), nil
+	case *ast.BooleanLiteral:
+		return e.boolValue(node.Value), nil
 	case *ast.Identifier:
 		val, ok := e.env.Get(node.Value)
 		if !ok {
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		}
 		return val, nil
+	// Operators, arrays and calls in the program are usually compiled; see
+	// closures.go.
 	case *ast.InfixExpression:
+		if fn, ok := e.compiled.infix[node]; ok {
+			return fn(e.env)
+		}
 		return e.evalInfixExpression(node)
 	case *ast.PrefixExpression:
+		if fn, ok := e.compiled.prefix[node]; ok {
+			return fn(e.env)
+		}
 		return e.evalPrefixExpression(node)
 	case *ast.ArrayAccess:
+		if fn, ok := e.compiled.array[node]; ok {
+			return fn(e.env)
+		}
 		return e.evalArrayAccess(node)
+	case *ast.CallExpression:
+		if fn, ok := e.compiled.call[node]; ok {
+			return fn(e.env)
+		}
+		return e.evalCallExpression(node)
 	default:
-		return nil, fmt.Errorf("unknown expression type: %T", expr)
+		return Value{}, fmt.Errorf("unknown expression type: %T", expr)
 	}
 }
 
 func (e *Evaluator) evalInfixExpression(expr *ast.InfixExpression) (Value, error) {
 	left, err := e.evalExpression(expr.Left)
 	if err != nil {
-		return nil, err
+		return Value{}, err
 	}
 
 	right, err := e.evalExpression(expr.Right)
 	if err != nil {
-		return nil, err
+		return Value{}, err
 	}
+	return e.evalInfix(expr.Operator, left, right)
+}
 
-	leftNum, leftIsNum := left.(*NumberValue)
-	rightNum, rightIsNum := right.(*NumberValue)
+// evalInfix applies the binary operator op to two values.
+func (e *Evaluator) evalInfix(op string, left, right Value) (Value, error) {
+	leftNum, leftIsNum := left.AsNumber()
+	rightNum, rightIsNum := right.AsNumber()
 
 	if leftIsNum && rightIsNum {
-		switch expr.Operator {
+		switch op {
 		case "+":
-			return &NumberValue{Value: leftNum.Value + rightNum.Value}, nil
+			return Number(leftNum + rightNum), nil
 		case "-":
-			return &NumberValue{Value: leftNum.Value - rightNum.Value}, nil
+			return Number(leftNum - rightNum), nil
 		case "*":
-			return &NumberValue{Value: leftNum.Value * rightNum.Value}, nil
+			return Number(leftNum * rightNum), nil
 		case "/":
-			if rightNum.Value == 0 {
-				return nil, fmt.Errorf("division by zero")
+			if rightNum == 0 {
+				return Value{}, errorf(DivisionByZero, "division by zero")
 			}
-			return &NumberValue{Value: leftNum.Value / rightNum.Value}, nil
+			return Number(leftNum / rightNum), nil
 		case "MOD":
-			return &NumberValue{Value: math.Mod(leftNum.Value, rightNum.Value)}, nil
+			return Number(math.Mod(leftNum, rightNum)), nil
 		case "<":
-			if leftNum.Value < rightNum.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftNum < rightNum {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		case ">":
-			if leftNum.Value > rightNum.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftNum > rightNum {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		case "<=":
-			if leftNum.Value <= rightNum.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftNum <= rightNum {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		case ">=":
-			if leftNum.Value >= rightNum.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftNum >= rightNum {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		case "==":
-			if leftNum.Value == rightNum.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftNum == rightNum {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		case "<>":
-			if leftNum.Value != rightNum.Value {
-				return &NumberValue{Value: 1}, nil
-			}
-			return &NumberValue{Value: 0}, nil
-		case "AND":
-			if isTruthy(left) && isTruthy(right) {
-				return &NumberValue{Value: 1}, nil
+			if leftNum != rightNum {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
-		case "OR":
-			if isTruthy(left) || isTruthy(right) {
-				return &NumberValue{Value: 1}, nil
-			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
+		case "AND", "OR", "XOR", "EQV", "IMP":
+			return e.evalLogical(op, leftNum, rightNum)
 		}
 	}
 
-	leftStr, leftIsStr := left.(*StringValue)
-	rightStr, rightIsStr := right.(*StringValue)
+	leftStr, leftIsStr := left.AsString()
+	rightStr, rightIsStr := right.AsString()
 
 	if leftIsStr && rightIsStr {
-		switch expr.Operator {
+		switch op {
 		case "+":
-			return &StringValue{Value: leftStr.Value + rightStr.Value}, nil
+			if err := e.checkStringLength(len(leftStr) + len(rightStr)); err != nil {
+				return Value{}, err
+			}
+			return String(leftStr + rightStr), nil
 		case "==":
-			if leftStr.Value == rightStr.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftStr == rightStr {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		case "<>":
-			if leftStr.Value != rightStr.Value {
-				return &NumberValue{Value: 1}, nil
+			if leftStr != rightStr {
+				return e.boolValue(true), nil
 			}
-			return &NumberValue{Value: 0}, nil
+			return Number(0), nil
 		}
 	}
 
-	return nil, fmt.Errorf("unsupported operation: %s %s %s", left.Type(), expr.Operator, right.Type())
+	return Value{}, errorf(TypeMismatch, "unsupported operation: %s %s %s", left.Type(), op, right.Type())
 }
 
 func (e *Evaluator) evalPrefixExpression(expr *ast.PrefixExpression) (Value, error) {
 	right, err := e.evalExpression(expr.Right)
 	if err != nil {
-		return nil, err
+		return Value{}, err
 	}
+	return e.evalPrefix(expr.Operator, right)
+}
 
-	switch expr.Operator {
+// evalPrefix applies the unary operator op to a value.
+func (e *Evaluator) evalPrefix(op string, right Value) (Value, error) {
+	switch op {
 	case "-":
-		if num, ok := right.(*NumberValue); ok {
-			return &NumberValue{Value: -num.Value}, nil
+		if num, ok := right.AsNumber(); ok {
+			return Number(-num), nil
 		}
-		return nil, fmt.Errorf("cannot negate non-number")
+		return Value{}, errorf(TypeMismatch, "cannot negate non-number")
 	case "NOT":
-		if isTruthy(right) {
-			return &NumberValue{Value: 0}, nil
+		if num, ok := right.AsNumber(); ok && e.dialect.BitwiseLogic {
+			n, err := toInt16(num)
+			if err != nil {
+				return Value{}, err
+			}
+			return Number(float64(^n)), nil
 		}
-		return &NumberValue{Value: 1}, nil
+		return e.boolValue(!isTruthy(right)), nil
 	default:
-		return nil, fmt.Errorf("unknown operator: %s", expr.Operator)
+		return Value{}, fmt.Errorf("unknown operator: %s", op)
 	}
 }
 
 func (e *Evaluator) evalArrayAccess(expr *ast.ArrayAccess) (Value, error) {
 	arr, ok := e.env.GetArray(expr.Name.Value)
 	if !ok {
-		return nil, fmt.Errorf("array %s not defined", expr.Name.Value)
+		return Value{}, errorf(SubscriptOutOfRange, "array %s not defined", expr.Name.Value)
 	}
 
 	indexVal, err := e.evalExpression(expr.Index)
 	if err != nil {
-		return nil, err
+		return Value{}, err
 	}
+	return arrayElement(expr.Name.Value, arr, indexVal)
+}
 
-	indexNum, ok := indexVal.(*NumberValue)
-	if !ok {
-		return nil, fmt.Errorf("array index must be a number")
+// arrayElement returns the element of arr, the array name, at index, 0 if
+// it was never set.
+func arrayElement(name string, arr *ArrayValue, indexVal Value) (Value, error) {
+	index, err := arrayIndex(name, arr, indexVal)
+	if err != nil {
+		return Value{}, err
 	}
 
-	index := int(indexNum.Value)
 	val, ok := arr.Elements[index]
 	if !ok {
-		return &NumberValue{Value: 0}, nil
+		return Number(0), nil
 	}
 
 	return val, nil
 }
 
+// arrayIndex turns indexVal into a subscript of arr, the array name, which
+// runs from 0 to its DIM size.
+func arrayIndex(name string, arr *ArrayValue, indexVal Value) (int, error) {
+	indexNum, ok := indexVal.AsNumber()
+	if !ok {
+		return 0, errorf(TypeMismatch, "array index must be a number")
+	}
+
+	index := int(indexNum)
+	if index < 0 || index > arr.Size {
+		return 0, errorf(SubscriptOutOfRange, "subscript %d out of range for %s(%d)", index, name, arr.Size)
+	}
+	return index, nil
+}
+
+// isTruthy decides conditions for IF and the logical operators: any
+// non-zero number is true (so both 1 and -1 count, whatever the dialect), and
+// a string is true unless it is empty.
 func isTruthy(val Value) bool {
-	switch v := val.(type) {
-	case *NumberValue:
-		return v.Value != 0
-	case *StringValue:
-		return v.Value != ""
-	default:
-		return false
+	if val.isString {
+		return val.str != ""
 	}
+	return val.num != 0
 }
@@ -0,0 +1,414 @@
+package evaluator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+// load parses src and prepares it to run on the tree interpreter, printing
+// to out.
+func load(t *testing.T, src string, out io.Writer) *Evaluator {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse %q: %s", src, strings.Join(errs, "; "))
+	}
+	return New(program, Options{Stdin: strings.NewReader(""), Stdout: out})
+}
+
+// run runs src on the tree interpreter and returns what it printed.
+func run(t *testing.T, src string) (string, error) {
+	t.Helper()
+	var out strings.Builder
+	err := load(t, src, &out).Run(context.Background())
+	return out.String(), err
+}
+
+func TestForRunningNoTimesCarriesOnAfterNext(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "rest of the NEXT's line",
+			src:  "10 FOR I = 5 TO 1: PRINT \"BODY\": NEXT I: PRINT \"AFTER\"\n20 PRINT \"L20\"\n",
+			want: "AFTER\nL20\n",
+		},
+		{
+			name: "NEXT on a later line",
+			src:  "10 FOR I = 5 TO 1\n20 PRINT \"BODY\"\n30 NEXT I: PRINT \"AFTER\"\n40 PRINT \"L40\"\n",
+			want: "AFTER\nL40\n",
+		},
+		{
+			name: "NEXT ends its line",
+			src:  "10 FOR I = 1 TO 0 STEP 1: PRINT \"BODY\": NEXT\n20 PRINT \"L20\"\n",
+			want: "L20\n",
+		},
+		{
+			name: "inner loop of one that runs",
+			src:  "10 FOR I = 1 TO 2: FOR J = 1 TO 0: PRINT \"BODY\": NEXT J: PRINT I: NEXT I\n",
+			want: "1\n2\n",
+		},
+		{
+			name: "loop after THEN",
+			src:  "10 IF 1 THEN FOR I = 5 TO 1: PRINT \"BODY\": NEXT I: PRINT \"AFTER\"\n20 PRINT \"L20\"\n",
+			want: "AFTER\nL20\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRead(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+		code            ErrorCode
+	}{
+		{
+			name: "variables and array elements",
+			src:  "10 DIM A(2)\n20 FOR I = 0 TO 2: READ A(I): NEXT I\n30 READ N$\n40 PRINT A(0) + A(1) + A(2), N$\n50 DATA 1, 2, 3, \"SUM\"\n",
+			want: "6\tSUM\n",
+		},
+		{
+			name: "string into a numeric variable",
+			src:  "10 READ A\n20 DATA \"TEXT\"\n",
+			code: TypeMismatch,
+		},
+		{
+			name: "string into a numeric array",
+			src:  "10 DIM A(1)\n20 READ A(1)\n30 DATA \"TEXT\"\n",
+			code: TypeMismatch,
+		},
+		{
+			name: "element past the end",
+			src:  "10 DIM A(1)\n20 READ A(2)\n30 DATA 5\n",
+			code: SubscriptOutOfRange,
+		},
+		{
+			name: "out of DATA",
+			src:  "10 READ A, B\n20 DATA 1\n",
+			code: OutOfData,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src)
+			if tt.code != 0 {
+				var rt *RuntimeError
+				if !errors.As(err, &rt) || rt.Code != tt.code {
+					t.Fatalf("error %v, want code %d", err, tt.code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "arithmetic",
+			src:  "10 PRINT 1 + 2 * 3; 7 / 2; 7 MOD 3; -2 * 3\n",
+			want: "73.51-6\n",
+		},
+		{
+			name: "comparisons and logic",
+			src:  "10 PRINT 1 < 2; 2 < 1; 1 AND 0; NOT 0\n",
+			want: "1001\n",
+		},
+		{
+			name: "strings and functions",
+			src:  "10 LET A$ = \" ab \"\n20 PRINT UCASE$(A$) + \"!\"; TRIM$(A$); FIX(-2.7); MIN(3, 1); ROUND(2.567, 2)\n",
+			want: " AB !ab-212.57\n",
+		},
+		{
+			name: "FIX and ROUND give 0, not -0",
+			src:  "10 PRINT FIX(-0.5); ROUND(-0.4); ROUND(-0.04, 1); FIX(-1.5)\n",
+			want: "000-1\n",
+		},
+		{
+			name: "print separators",
+			src:  "10 PRINT \"A\", \"B\"\n20 PRINT \"C\";\n30 PRINT \"D\"\n",
+			want: "A\tB\nCD\n",
+		},
+		{
+			name: "GOSUB and RETURN",
+			src:  "10 GOSUB 100\n20 PRINT \"BACK\"\n30 END\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: "SUB\nBACK\n",
+		},
+		{
+			name: "GOSUB after THEN",
+			src:  "10 IF 1 THEN GOSUB 100: PRINT \"BACK\"\n20 PRINT \"L20\"\n30 END\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: "SUB\nBACK\nL20\n",
+		},
+		{
+			name: "GOSUB before ELSE",
+			src:  "10 IF 1 THEN GOSUB 100 ELSE PRINT \"ELSE\"\n20 PRINT \"L20\"\n30 END\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: "SUB\nL20\n",
+		},
+		{
+			name: "IF, ELSE and a jump",
+			src:  "10 LET I = 5\n20 IF I > 3 THEN PRINT \"BIG\" ELSE PRINT \"SMALL\"\n30 IF I < 3 THEN 50\n40 PRINT \"FELL\"\n50 END\n",
+			want: "BIG\nFELL\n",
+		},
+		{
+			name: "nested FOR",
+			src:  "10 FOR I = 1 TO 3\n20 FOR J = I TO 2\n30 PRINT I; J\n40 NEXT J\n50 NEXT I\n",
+			want: "11\n12\n22\n",
+		},
+		{
+			name: "negative STEP",
+			src:  "10 FOR I = 10 TO 1 STEP -4: PRINT I: NEXT I\n",
+			want: "10\n6\n2\n",
+		},
+		{
+			name: "FOR and NEXT after THEN",
+			src:  "10 IF 1 THEN FOR I = 1 TO 3: PRINT I: NEXT I: PRINT \"AFTER\"\n20 PRINT \"L20\"\n",
+			want: "1\n2\n3\nAFTER\nL20\n",
+		},
+		{
+			name: "FOR after THEN inside a loop",
+			src:  "10 FOR J = 1 TO 2: IF J == 2 THEN FOR I = 1 TO 2: PRINT J * 10 + I: NEXT I\n20 NEXT J\n",
+			want: "21\n22\n",
+		},
+		{
+			name: "FOR after ELSE",
+			src:  "10 IF 0 THEN PRINT \"THEN\" ELSE FOR I = 1 TO 2: PRINT I: NEXT I\n20 PRINT \"L20\"\n",
+			want: "1\n2\nL20\n",
+		},
+		{
+			name: "arrays",
+			src:  "10 DIM A(3)\n20 FOR I = 0 TO 3: LET A(I) = I * I: NEXT I\n30 PRINT A(3) + A(2)\n",
+			want: "13\n",
+		},
+		{
+			name: "RESTORE",
+			src:  "10 READ A: RESTORE: READ B: PRINT A + B\n20 DATA 21\n",
+			want: "42\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuntimeErrors(t *testing.T) {
+	tests := []struct {
+		name, src string
+		code      ErrorCode
+		line      int
+	}{
+		{"division by zero", "10 PRINT 1 / 0\n", DivisionByZero, 10},
+		{"RETURN without GOSUB", "10 PRINT 1\n20 RETURN\n", ReturnWithoutGosub, 20},
+		{"NEXT without FOR", "10 NEXT I\n", NextWithoutFor, 10},
+		{"subscript past DIM", "10 DIM A(2)\n20 LET A(3) = 1\n", SubscriptOutOfRange, 20},
+		{"out of DATA", "10 READ A\n", OutOfData, 10},
+		{"SHELL disabled", "10 PRINT 1\n20 SHELL \"echo hi\"\n", PermissionDenied, 20},
+		{"INPUT at the end of input", "10 PRINT 1\n20 INPUT A\n", InputPastEnd, 20},
+		{"END status out of range", "10 END 256\n", IllegalFunctionCall, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := run(t, tt.src)
+			var rt *RuntimeError
+			if !errors.As(err, &rt) {
+				t.Fatalf("error %v, want a runtime error", err)
+			}
+			if rt.Code != tt.code || rt.Line != tt.line {
+				t.Errorf("error %d in line %d, want %d in line %d", rt.Code, rt.Line, tt.code, tt.line)
+			}
+		})
+	}
+}
+
+func TestCancelOneLineLoop(t *testing.T) {
+	e := load(t, "10 FOR I = 1 TO 1000000000: LET X = I: NEXT I\n", io.Discard)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := e.Run(ctx)
+	var ce *CancelError
+	if !errors.As(err, &ce) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error %v, want a CancelError for the deadline", err)
+	}
+	if ce.Line != 10 {
+		t.Errorf("cancelled in line %d, want 10", ce.Line)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v to notice the deadline", elapsed)
+	}
+}
+
+func TestStepTakesContext(t *testing.T) {
+	var out strings.Builder
+	e := load(t, "10 PRINT \"A\": SLEEP 60\n20 PRINT \"B\"\n", &out)
+	if running, err := e.Step(context.Background()); !running || err != nil {
+		t.Fatalf("first step = %v, %v", running, err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	running, err := e.Step(cancelled)
+	var ce *CancelError
+	if !running || !errors.As(err, &ce) || ce.Line != 10 {
+		t.Fatalf("step with a cancelled context = %v, %v, want a CancelError in line 10", running, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	running, err = e.Step(ctx)
+	if !running || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("step cancelled in SLEEP = %v, %v, want the deadline", running, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v to notice the deadline", elapsed)
+	}
+	if state := e.State(); state.Line != 10 || state.Statement != 1 {
+		t.Errorf("stopped at %d:%d, want the SLEEP again at 10:1", state.Line, state.Statement)
+	}
+	if out.String() != "A\n" {
+		t.Errorf("printed %q, want \"A\\n\"", out.String())
+	}
+}
+
+func TestStepUnderTimeout(t *testing.T) {
+	e := load(t, "10 FOR I = 1 TO 1000: LET X = I: NEXT I\n", io.Discard)
+	e.SetTimeout(time.Minute)
+	for steps := 0; steps < 2*statsInterval; steps++ {
+		if running, err := e.Step(context.Background()); !running || err != nil {
+			t.Fatalf("step %d = %v, %v", steps+1, running, err)
+		}
+	}
+}
+
+func TestOnStatementSeesEachStatementOnce(t *testing.T) {
+	e := load(t, "10 PRINT 1: IF 1 THEN PRINT 2: PRINT 3\n", io.Discard)
+	var seen []string
+	e.SetHooks(Hooks{OnStatement: func(line int, stmt ast.Statement) {
+		seen = append(seen, fmt.Sprintf("%d %T", line, stmt))
+	}})
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	want := []string{"10 *ast.PrintStatement", "10 *ast.IfStatement", "10 *ast.PrintStatement", "10 *ast.PrintStatement"}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("OnStatement saw %q, want %q", seen, want)
+	}
+	if n := e.Stats().Statements; n != int64(len(want)) {
+		t.Errorf("counted %d statements, want %d", n, len(want))
+	}
+
+	// Exec is given a whole line, which is a sequence.
+	seen = nil
+	p := parser.New(lexer.New("10 PRINT 4: PRINT 5\n"))
+	if err := e.Exec(p.ParseProgram().Statements[10]); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if len(seen) != 2 {
+		t.Errorf("OnStatement saw %q for a line of two statements", seen)
+	}
+}
+
+func TestInterruptOneLineLoop(t *testing.T) {
+	e := load(t, "10 FOR I = 1 TO 1000000000: LET X = X + 1: NEXT I\n", io.Discard)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		e.Interrupt()
+	}()
+
+	err := e.Run(context.Background())
+	var be *BreakError
+	if !errors.As(err, &be) || be.Line != 10 {
+		t.Fatalf("error %v, want a break in line 10", err)
+	}
+
+	// CONT picks up at the statement where it broke off.
+	x, _ := e.Lookup("X")
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := e.Continue(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("continue: %v, want the deadline", err)
+	}
+	if y, _ := e.Lookup("X"); y.num <= x.num {
+		t.Errorf("X went from %v to %v after CONT", x.num, y.num)
+	}
+}
+
+func TestTimerFiresInOneLineLoop(t *testing.T) {
+	src := "10 ON TIMER(0.02) GOSUB 40: TIMER ON\n" +
+		"20 FOR I = 1 TO 1000000000: LET I = I + T * 1000000000: NEXT I\n" +
+		"30 PRINT \"FIRED\": END\n" +
+		"40 LET T = 1: RETURN\n"
+	var out strings.Builder
+	e := load(t, src, &out)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := e.Run(ctx); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := out.String(); got != "FIRED\n" {
+		t.Errorf("printed %q, want %q", got, "FIRED\n")
+	}
+}
+
+func TestBitwiseOverflow(t *testing.T) {
+	// N is infinity less itself, not a number.
+	const nan = "10 LET A = 1000000000: FOR I = 1 TO 9: LET A = A * A: NEXT I: LET N = A - A\n"
+	tests := []struct {
+		name, src string
+	}{
+		{"past 16 bits", "20 PRINT 40000 AND 1\n"},
+		{"NaN operand", nan + "20 PRINT N AND 1\n"},
+		{"NaN under NOT", nan + "20 PRINT NOT N\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := load(t, tt.src, io.Discard)
+			e.SetDialect(dialect.MSBasic)
+			err := e.Run(context.Background())
+			var rt *RuntimeError
+			if !errors.As(err, &rt) || rt.Code != Overflow {
+				t.Errorf("error %v, want Overflow", err)
+			}
+		})
+	}
+}
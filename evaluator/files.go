@@ -0,0 +1,290 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/token"
+)
+
+// DefaultRecordLength is the record size used when OPEN has no LEN clause.
+const DefaultRecordLength = 128
+
+const maxFileNumber = 255
+
+// randomFile is an open random-access file. Records are read into and
+// written from buffer; FIELD carves the buffer into named string variables.
+type randomFile struct {
+	f          *os.File
+	recordLen  int
+	buffer     []byte
+	fields     []boundField
+	lastRecord int
+	readPos    int64 // where INPUT$(n, #f) reads next
+}
+
+type boundField struct {
+	name   string
+	offset int
+	width  int
+}
+
+func (e *Evaluator) evalOpenStatement(stmt *ast.OpenStatement) error {
+	if err := e.checkHostAccess("OPEN"); err != nil {
+		return err
+	}
+	nameVal, err := e.evalExpression(stmt.File)
+	if err != nil {
+		return err
+	}
+	name, ok := nameVal.AsString()
+	if !ok {
+		return errorf(TypeMismatch, "OPEN file name must be a string")
+	}
+
+	num, err := e.fileNumber(stmt.Number)
+	if err != nil {
+		return err
+	}
+	if _, open := e.files[num]; open {
+		return errorf(FileAlreadyOpen, "file #%d already open", num)
+	}
+
+	recordLen := DefaultRecordLength
+	if stmt.RecordLength != nil {
+		lenVal, err := e.evalExpression(stmt.RecordLength)
+		if err != nil {
+			return err
+		}
+		n, ok := lenVal.AsNumber()
+		if !ok || n < 1 || n > 32767 {
+			return fmt.Errorf("record length must be a number from 1 to 32767")
+		}
+		recordLen = int(n)
+	}
+
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fileError("OPEN", err)
+	}
+
+	e.files[num] = &randomFile{
+		f:         f,
+		recordLen: recordLen,
+		buffer:    []byte(strings.Repeat(" ", recordLen)),
+	}
+	return nil
+}
+
+func (e *Evaluator) evalCloseStatement(stmt *ast.CloseStatement) error {
+	if len(stmt.Numbers) == 0 {
+		return e.closeFiles()
+	}
+
+	for _, expr := range stmt.Numbers {
+		num, err := e.fileNumber(expr)
+		if err != nil {
+			return err
+		}
+		if file, ok := e.files[num]; ok {
+			delete(e.files, num)
+			if err := file.f.Close(); err != nil {
+				return fileError("CLOSE", err)
+			}
+		}
+	}
+	return nil
+}
+
+// closeFiles closes every open file; Run calls it when the program stops.
+func (e *Evaluator) closeFiles() error {
+	var firstErr error
+	for num, file := range e.files {
+		delete(e.files, num)
+		if err := file.f.Close(); err != nil && firstErr == nil {
+			firstErr = fileError("CLOSE", err)
+		}
+	}
+	return firstErr
+}
+
+func (e *Evaluator) evalFieldStatement(stmt *ast.FieldStatement) error {
+	file, err := e.openFile(stmt.Number)
+	if err != nil {
+		return err
+	}
+
+	fields := []boundField{}
+	offset := 0
+	for _, spec := range stmt.Fields {
+		widthVal, err := e.evalExpression(spec.Width)
+		if err != nil {
+			return err
+		}
+		width, ok := widthVal.AsNumber()
+		if !ok || width < 0 {
+			return fmt.Errorf("FIELD width must be a non-negative number")
+		}
+		if offset+int(width) > file.recordLen {
+			return errorf(FieldOverflow, "FIELD overflow: fields need more than the %d-byte record", file.recordLen)
+		}
+		fields = append(fields, boundField{name: spec.Variable.Value, offset: offset, width: int(width)})
+		offset += int(width)
+	}
+
+	file.fields = fields
+	e.loadFields(file)
+	return nil
+}
+
+func (e *Evaluator) evalRecordStatement(stmt *ast.RecordStatement) error {
+	file, err := e.openFile(stmt.Number)
+	if err != nil {
+		return err
+	}
+
+	record := file.lastRecord + 1
+	if stmt.Record != nil {
+		recVal, err := e.evalExpression(stmt.Record)
+		if err != nil {
+			return err
+		}
+		n, ok := recVal.AsNumber()
+		if !ok || n < 1 {
+			return errorf(BadRecordNumber, "record number must be a number of at least 1")
+		}
+		record = int(n)
+	}
+	pos := int64(record-1) * int64(file.recordLen)
+
+	if stmt.Token.Type == token.PUT {
+		if _, err := file.f.WriteAt(file.buffer, pos); err != nil {
+			return fileError("PUT", err)
+		}
+	} else {
+		n, err := file.f.ReadAt(file.buffer, pos)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fileError("GET", err)
+		}
+		// Reading past the end gives blank fields.
+		for i := n; i < len(file.buffer); i++ {
+			file.buffer[i] = ' '
+		}
+		e.loadFields(file)
+	}
+
+	file.lastRecord = record
+	return nil
+}
+
+func (e *Evaluator) evalJustifyStatement(stmt *ast.JustifyStatement) error {
+	val, err := e.evalExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	str, ok := val.AsString()
+	if !ok {
+		return errorf(TypeMismatch, "%s needs a string value", stmt.Token.Literal)
+	}
+
+	file, field, ok := e.findField(stmt.Name.Value)
+	if !ok {
+		// Not a FIELD variable: justify within the variable's current length.
+		current, _ := e.env.Get(stmt.Name.Value)
+		currentStr, _ := current.AsString()
+		width := len(currentStr)
+		e.setVariable(stmt.Name.Value, String(justify(str, width, stmt.Token.Type == token.RSET)))
+		return nil
+	}
+
+	text := justify(str, field.width, stmt.Token.Type == token.RSET)
+	copy(file.buffer[field.offset:field.offset+field.width], text)
+	e.setVariable(field.name, String(text))
+	return nil
+}
+
+// justify pads s with spaces to width, on the left when right is true, and
+// truncates it if it is too long.
+func justify(s string, width int, right bool) string {
+	if len(s) >= width {
+		return s[:width]
+	}
+	pad := strings.Repeat(" ", width-len(s))
+	if right {
+		return pad + s
+	}
+	return s + pad
+}
+
+// loadFields copies the record buffer into the file's FIELD variables.
+func (e *Evaluator) loadFields(file *randomFile) {
+	for _, field := range file.fields {
+		e.setVariable(field.name, String(string(file.buffer[field.offset:field.offset+field.width])))
+	}
+}
+
+// findField finds the open file whose FIELD statement bound name, checking
+// files in number order so the result does not depend on map iteration.
+func (e *Evaluator) findField(name string) (*randomFile, boundField, bool) {
+	nums := make([]int, 0, len(e.files))
+	for num := range e.files {
+		nums = append(nums, num)
+	}
+	sort.Ints(nums)
+
+	for _, num := range nums {
+		file := e.files[num]
+		for _, field := range file.fields {
+			if field.name == name {
+				return file, field, true
+			}
+		}
+	}
+	return nil, boundField{}, false
+}
+
+func (e *Evaluator) fileNumber(expr ast.Expression) (int, error) {
+	val, err := e.evalExpression(expr)
+	if err != nil {
+		return 0, err
+	}
+	num, ok := val.AsNumber()
+	if !ok || num < 1 || num > maxFileNumber {
+		return 0, errorf(BadFileNumber, "file number must be from 1 to %d", maxFileNumber)
+	}
+	return int(num), nil
+}
+
+func (e *Evaluator) openFile(expr ast.Expression) (*randomFile, error) {
+	num, err := e.fileNumber(expr)
+	if err != nil {
+		return nil, err
+	}
+	file, ok := e.files[num]
+	if !ok {
+		return nil, errorf(BadFileNumber, "file #%d not open", num)
+	}
+	return file, nil
+}
+
+// builtinLOF implements LOF(n), the length in bytes of open file n.
+func builtinLOF(e *Evaluator, args []Value) (Value, error) {
+	num, ok := args[0].AsNumber()
+	if !ok {
+		return Value{}, errorf(TypeMismatch, "expected number argument")
+	}
+	file, ok := e.files[int(num)]
+	if !ok {
+		return Value{}, errorf(BadFileNumber, "file #%d not open", int(num))
+	}
+	info, err := file.f.Stat()
+	if err != nil {
+		return Value{}, err
+	}
+	return Number(float64(info.Size())), nil
+}
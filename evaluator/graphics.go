@@ -0,0 +1,138 @@
+package evaluator
+
+import (
+	"errors"
+	"math"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/graphics"
+)
+
+// screenModes are the sizes of the graphics screens SCREEN starts by
+// number, as in GW-BASIC on a CGA. SCREEN 0, text only, has none.
+var screenModes = map[int][2]int{1: {320, 200}, 2: {640, 200}}
+
+// maxScreenSize is the widest and tallest screen SCREEN width, height
+// starts.
+const maxScreenSize = 4096
+
+// defaultColor is what the graphics statements draw in when not given a
+// colour: white.
+const defaultColor = 15
+
+// SetGraphics makes the graphics statements draw with b instead of on the
+// graphics.Canvas SCREEN otherwise starts, which SCREENSAVE saves as a PNG
+// or SVG. Call it before Run.
+func (e *Evaluator) SetGraphics(b graphics.Backend) {
+	e.graphics = b
+}
+
+func (e *Evaluator) evalScreenStatement(stmt *ast.ScreenStatement) error {
+	var width, height int
+	if stmt.Height == nil {
+		mode, _, err := e.screenArg(stmt.Mode, "SCREEN mode", 0, 2)
+		if err != nil {
+			return err
+		}
+		if mode == 0 {
+			e.screenOn = false
+			return nil
+		}
+		width, height = screenModes[mode][0], screenModes[mode][1]
+	} else {
+		var err error
+		if width, _, err = e.screenArg(stmt.Mode, "SCREEN width", 1, maxScreenSize); err != nil {
+			return err
+		}
+		if height, _, err = e.screenArg(stmt.Height, "SCREEN height", 1, maxScreenSize); err != nil {
+			return err
+		}
+	}
+
+	if e.graphics == nil {
+		e.graphics = graphics.NewCanvas()
+	}
+	if err := e.graphics.Screen(width, height); err != nil {
+		return err
+	}
+	e.screenOn = true
+	return nil
+}
+
+func (e *Evaluator) evalPlotStatement(stmt *ast.PlotStatement) error {
+	coords, color, err := e.drawingArgs("PLOT", stmt.Color, stmt.X, stmt.Y)
+	if err != nil {
+		return err
+	}
+	return drawError(e.graphics.Plot(coords[0], coords[1], color))
+}
+
+func (e *Evaluator) evalDrawLineStatement(stmt *ast.DrawLineStatement) error {
+	coords, color, err := e.drawingArgs("LINE", stmt.Color, stmt.X1, stmt.Y1, stmt.X2, stmt.Y2)
+	if err != nil {
+		return err
+	}
+	return drawError(e.graphics.Line(coords[0], coords[1], coords[2], coords[3], color))
+}
+
+func (e *Evaluator) evalCircleStatement(stmt *ast.CircleStatement) error {
+	coords, color, err := e.drawingArgs("CIRCLE", stmt.Color, stmt.X, stmt.Y)
+	if err != nil {
+		return err
+	}
+	radius, _, err := e.screenArg(stmt.Radius, "CIRCLE radius", 0, math.MaxInt16)
+	if err != nil {
+		return err
+	}
+	return drawError(e.graphics.Circle(coords[0], coords[1], radius, color))
+}
+
+// drawingArgs evaluates the coordinates and colour of the graphics
+// statement keyword, once SCREEN has started a screen to draw on.
+// Coordinates may be off the screen, within the range of an integer.
+func (e *Evaluator) drawingArgs(keyword string, colorExpr ast.Expression, exprs ...ast.Expression) ([]int, int, error) {
+	if !e.screenOn {
+		return nil, 0, errorf(IllegalFunctionCall, "%s needs a graphics screen; use SCREEN first", keyword)
+	}
+	coords := make([]int, len(exprs))
+	for i, expr := range exprs {
+		n, _, err := e.screenArg(expr, keyword+" coordinate", math.MinInt16, math.MaxInt16)
+		if err != nil {
+			return nil, 0, err
+		}
+		coords[i] = n
+	}
+	color, hasColor, err := e.screenArg(colorExpr, keyword+" colour", 0, 15)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !hasColor {
+		color = defaultColor
+	}
+	return coords, color, nil
+}
+
+// drawError reports a backend that will hold no more as out of memory.
+func drawError(err error) error {
+	if errors.Is(err, graphics.ErrTooManyShapes) {
+		return errorf(OutOfMemory, "Out of memory: %v", err)
+	}
+	return err
+}
+
+func (e *Evaluator) evalScreenSaveStatement(stmt *ast.ScreenSaveStatement) error {
+	if err := e.checkHostAccess("SCREENSAVE"); err != nil {
+		return err
+	}
+	filename, err := e.stringArg(stmt.File, "SCREENSAVE file name")
+	if err != nil {
+		return err
+	}
+	if !e.screenOn {
+		return errorf(IllegalFunctionCall, "nothing to save; use SCREEN first")
+	}
+	if err := e.graphics.Save(filename); err != nil {
+		return fileError("SCREENSAVE", err)
+	}
+	return nil
+}
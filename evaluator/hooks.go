@@ -0,0 +1,45 @@
+package evaluator
+
+import "github.com/basis-ex/ast"
+
+// Hooks let a tool such as a tracer, coverage collector or visualizer
+// observe a program as it runs. Each hook is optional and is called on the
+// goroutine running the program, before the evaluator goes on, so it may
+// call Snapshot, Lookup or Variables to look at the program's state but
+// should not run or change it.
+type Hooks struct {
+	// OnLineStart is called with each line number before the line runs,
+	// whether by Run, Continue or Step.
+	OnLineStart func(line int)
+	// OnStatement is called before each statement runs, once for each
+	// statement of a line joined with colons, those after an IF's THEN or
+	// ELSE included.
+	OnStatement func(line int, stmt ast.Statement)
+	// OnVariableSet is called after the program assigns a scalar variable,
+	// by LET, FOR, NEXT, INPUT, READ, LSET, RSET, FIELD or GET.
+	OnVariableSet func(line int, name string, value Value)
+}
+
+// SetHooks installs hooks, replacing any installed before. The zero Hooks
+// removes them.
+func (e *Evaluator) SetHooks(hooks Hooks) {
+	e.hooks = hooks
+}
+
+// lineNumber is the number of the line at currentLine, or zero when the
+// program has run off its end.
+func (e *Evaluator) lineNumber() int {
+	if e.currentLine < 0 || e.currentLine >= len(e.lines) {
+		return 0
+	}
+	return e.lines[e.currentLine]
+}
+
+// setVariable assigns a scalar variable on behalf of the program and
+// reports the change to OnVariableSet.
+func (e *Evaluator) setVariable(name string, val Value) {
+	e.env.Set(name, val)
+	if e.hooks.OnVariableSet != nil {
+		e.hooks.OnVariableSet(e.lineNumber(), name, val)
+	}
+}
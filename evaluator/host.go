@@ -0,0 +1,105 @@
+package evaluator
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/token"
+)
+
+// HostFunction is a function an embedding program makes callable from
+// BASIC. It receives the evaluated arguments, each a Value made by Number
+// or String, and returns the result, made the same way.
+type HostFunction func(args ...Value) (Value, error)
+
+// RegisterFunction makes fn callable from BASIC as name, in any case. A
+// name ending in $ must return a string and any other name a number; a
+// function that returns the wrong type, or an error, stops the program
+// with a runtime error. The parser only reads NAME(...) as a call once it
+// has been told the name with parser.AddFunctions.
+func (e *Evaluator) RegisterFunction(name string, fn HostFunction) error {
+	name = strings.ToUpper(name)
+	if err := CheckFunctionName(name); err != nil {
+		return err
+	}
+	if e.hostFunctions == nil {
+		e.hostFunctions = map[string]HostFunction{}
+	}
+	e.hostFunctions[name] = fn
+	return nil
+}
+
+// CheckFunctionName reports why name cannot be used for a host function:
+// it must be a letter followed by letters and digits, optionally ending in
+// $, and must not be a keyword or built-in function.
+func CheckFunctionName(name string) error {
+	upper := strings.ToUpper(name)
+	body := strings.TrimSuffix(upper, "$")
+	if body == "" || body[0] < 'A' || body[0] > 'Z' {
+		return fmt.Errorf("invalid function name %q", name)
+	}
+	for _, c := range body {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return fmt.Errorf("invalid function name %q", name)
+		}
+	}
+	if token.LookupIdent(upper) != token.IDENT || token.IsBuiltin(upper) {
+		return fmt.Errorf("%s is already a BASIC keyword or function", upper)
+	}
+	return nil
+}
+
+// callHost calls a registered function and checks the type of its result.
+func (e *Evaluator) callHost(name string, fn HostFunction, args []Value) (Value, error) {
+	val, err := fn(args...)
+	if err != nil {
+		return Value{}, fmt.Errorf("%s: %w", name, err)
+	}
+	wantString := strings.HasSuffix(name, "$")
+	if val.isString == wantString {
+		if err := e.checkString(val); err != nil {
+			return Value{}, err
+		}
+		return val, nil
+	}
+	want := "a number"
+	if wantString {
+		want = "a string"
+	}
+	return Value{}, errorf(TypeMismatch, "Type mismatch: %s must return %s", name, want)
+}
+
+// EventHandler receives the events a program sends with
+// CALL HOST "event", arg, .... The event name is passed as written; the
+// arguments are Values, IsString telling strings from numbers. An error
+// stops the program.
+type EventHandler func(event string, args ...Value) error
+
+// SetEventHandler sets the function CALL HOST sends events to. Without
+// one, CALL HOST is a runtime error.
+func (e *Evaluator) SetEventHandler(fn EventHandler) {
+	e.events = fn
+}
+
+func (e *Evaluator) evalHostCallStatement(stmt *ast.HostCallStatement) error {
+	if e.events == nil {
+		return fmt.Errorf("CALL HOST: no host is listening")
+	}
+	val, err := e.evalExpression(stmt.Event)
+	if err != nil {
+		return err
+	}
+	event, ok := val.AsString()
+	if !ok {
+		return errorf(TypeMismatch, "CALL HOST event must be a string")
+	}
+	args, err := e.evalArguments(stmt.Arguments)
+	if err != nil {
+		return err
+	}
+	if err := e.events(event, args...); err != nil {
+		return fmt.Errorf("CALL HOST %q: %w", event, err)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package evaluator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/basis-ex/term"
+)
+
+// builtinInputChars implements INPUT$(n), which reads exactly n characters
+// from the keyboard without echoing them or waiting for Enter, and
+// INPUT$(n, #f), which reads the next n bytes of open file f.
+func builtinInputChars(e *Evaluator, args []Value) (Value, error) {
+	count, ok := args[0].AsNumber()
+	if !ok || count < 1 || count > 32767 {
+		return Value{}, fmt.Errorf("character count must be a number from 1 to 32767")
+	}
+	n := int(count)
+
+	if len(args) == 2 {
+		num, ok := args[1].AsNumber()
+		if !ok {
+			return Value{}, errorf(TypeMismatch, "file number must be a number")
+		}
+		file, ok := e.files[int(num)]
+		if !ok {
+			return Value{}, errorf(BadFileNumber, "file #%d not open", int(num))
+		}
+		buf := make([]byte, n)
+		read, err := file.f.ReadAt(buf, file.readPos)
+		if read < n {
+			if err != nil && !errors.Is(err, io.EOF) {
+				return Value{}, err
+			}
+			return Value{}, errorf(InputPastEnd, "Input past end")
+		}
+		file.readPos += int64(n)
+		return String(string(buf)), nil
+	}
+
+	// Keys are only delivered one at a time once the terminal's line
+	// editing is off; redirected input is read as it comes.
+	if e.env.keyboard != nil {
+		fd := int(e.env.keyboard.Fd())
+		if state, err := term.MakeCbreak(fd); err == nil {
+			defer term.Restore(fd, state)
+		}
+	}
+
+	keys, err := e.waitForInput(func() (string, error) {
+		var b strings.Builder
+		for i := 0; i < n; i++ {
+			r, _, err := e.env.reader.ReadRune()
+			if err != nil {
+				return "", err
+			}
+			b.WriteRune(r)
+		}
+		return b.String(), nil
+	})
+	if errors.Is(err, io.EOF) {
+		return Value{}, errorf(InputPastEnd, "Input past end")
+	}
+	if err != nil {
+		return Value{}, err
+	}
+	return String(keys), nil
+}
@@ -0,0 +1,69 @@
+package evaluator
+
+import "sort"
+
+// Variable is a scalar variable and its value, as reported by Variables.
+type Variable struct {
+	Name  string
+	Value Value
+}
+
+// Array is an array and the elements that have been set, as reported by
+// Arrays. Size is the DIM size, or zero for an array that was never DIMmed.
+type Array struct {
+	Name     string
+	Size     int
+	Elements map[int]Value
+}
+
+// FileChannel is an open file, as reported by Files. Record is the last
+// record read or written with GET or PUT, zero if there has been none.
+type FileChannel struct {
+	Number       int    `json:"number"`
+	Name         string `json:"name"`
+	RecordLength int    `json:"record_length"`
+	Record       int    `json:"record"`
+}
+
+// Variables returns the scalar variables visible to the line about to run,
+// sorted by name. Inside a SUB these are the procedure's own. Together with
+// Arrays and Files it lets a host inspect a finished or stopped program.
+func (e *Evaluator) Variables() []Variable {
+	vars := make([]Variable, 0, len(e.env.variables))
+	for name, val := range e.env.variables {
+		vars = append(vars, Variable{Name: name, Value: *val})
+	}
+	sort.Slice(vars, func(i, j int) bool { return vars[i].Name < vars[j].Name })
+	return vars
+}
+
+// Arrays returns the arrays visible to the line about to run, sorted by
+// name. The element maps are copies.
+func (e *Evaluator) Arrays() []Array {
+	arrays := make([]Array, 0, len(e.env.arrays))
+	for name, arr := range e.env.arrays {
+		elements := make(map[int]Value, len(arr.Elements))
+		for i, val := range arr.Elements {
+			elements[i] = val
+		}
+		arrays = append(arrays, Array{Name: name, Size: arr.Size, Elements: elements})
+	}
+	sort.Slice(arrays, func(i, j int) bool { return arrays[i].Name < arrays[j].Name })
+	return arrays
+}
+
+// Files returns the open file channels in number order. Files are closed
+// when a program ends, so only a stopped program has any.
+func (e *Evaluator) Files() []FileChannel {
+	files := make([]FileChannel, 0, len(e.files))
+	for num, file := range e.files {
+		files = append(files, FileChannel{
+			Number:       num,
+			Name:         file.f.Name(),
+			RecordLength: file.recordLen,
+			Record:       file.lastRecord,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Number < files[j].Number })
+	return files
+}
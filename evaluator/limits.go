@@ -0,0 +1,61 @@
+package evaluator
+
+import "fmt"
+
+// DefaultMaxStringLength and DefaultMaxArrayCells bound the memory a
+// program's strings and arrays may take, so that a runaway loop such as
+// LET A$ = A$ + A$ stops with "Out of memory" instead of exhausting the
+// host.
+const (
+	DefaultMaxStringLength = 1 << 20
+	DefaultMaxArrayCells   = 1 << 20
+)
+
+// SetMaxStringLength limits how many bytes a string may hold. A value of
+// zero or less removes the limit.
+func (e *Evaluator) SetMaxStringLength(n int) {
+	e.maxStringLength = n
+}
+
+// SetMaxArrayCells limits the total number of elements, across all the
+// arrays in scope, that DIM may declare. DIM A(N) takes N+1 cells. A value
+// of zero or less removes the limit.
+func (e *Evaluator) SetMaxArrayCells(n int) {
+	e.maxArrayCells = n
+}
+
+// checkString returns an "Out of memory" error if val is a string longer
+// than the limit.
+func (e *Evaluator) checkString(val Value) error {
+	if s, ok := val.AsString(); ok {
+		return e.checkStringLength(len(s))
+	}
+	return nil
+}
+
+// checkStringLength is checkString for a string of n bytes not yet built.
+func (e *Evaluator) checkStringLength(n int) error {
+	if e.maxStringLength > 0 && n > e.maxStringLength {
+		return fmt.Errorf("%w: string longer than %d characters", errOutOfMemory, e.maxStringLength)
+	}
+	return nil
+}
+
+// checkArrayCells returns an "Out of memory" error if declaring name with
+// size would take the arrays past the limit. An array being re-DIMmed no
+// longer counts its old size.
+func (e *Evaluator) checkArrayCells(name string, size int) error {
+	if e.maxArrayCells <= 0 {
+		return nil
+	}
+	cells := size + 1
+	for other, arr := range e.env.arrays {
+		if other != name {
+			cells += arr.Size + 1
+		}
+	}
+	if size < 0 || cells > e.maxArrayCells {
+		return fmt.Errorf("%w: arrays would need more than %d cells", errOutOfMemory, e.maxArrayCells)
+	}
+	return nil
+}
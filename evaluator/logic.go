@@ -0,0 +1,74 @@
+package evaluator
+
+import (
+	"math"
+
+	"github.com/basis-ex/dialect"
+)
+
+// SetDialect selects the semantics that vary between BASICs, such as
+// whether true is 1 or -1 and whether AND/OR act bitwise.
+func (e *Evaluator) SetDialect(d dialect.Dialect) {
+	e.dialect = d
+}
+
+// boolValue converts a Go bool into the dialect's BASIC truth value.
+func (e *Evaluator) boolValue(b bool) Value {
+	if b {
+		return Number(e.dialect.True())
+	}
+	return Number(0)
+}
+
+// evalLogical applies AND, OR, XOR, EQV or IMP. With bitwise logic the
+// operands are rounded to 16-bit integers and combined bit by bit; otherwise
+// they are treated as truth values.
+func (e *Evaluator) evalLogical(op string, a, b float64) (Value, error) {
+	if !e.dialect.BitwiseLogic {
+		x, y := a != 0, b != 0
+		switch op {
+		case "AND":
+			return e.boolValue(x && y), nil
+		case "OR":
+			return e.boolValue(x || y), nil
+		case "XOR":
+			return e.boolValue(x != y), nil
+		case "EQV":
+			return e.boolValue(x == y), nil
+		default: // IMP
+			return e.boolValue(!x || y), nil
+		}
+	}
+
+	x, err := toInt16(a)
+	if err != nil {
+		return Value{}, err
+	}
+	y, err := toInt16(b)
+	if err != nil {
+		return Value{}, err
+	}
+	var r int16
+	switch op {
+	case "AND":
+		r = x & y
+	case "OR":
+		r = x | y
+	case "XOR":
+		r = x ^ y
+	case "EQV":
+		r = ^(x ^ y)
+	default: // IMP
+		r = ^x | y
+	}
+	return Number(float64(r)), nil
+}
+
+// toInt16 rounds a number to the 16-bit integer the bitwise operators use.
+func toInt16(v float64) (int16, error) {
+	r := math.Round(v)
+	if !(r >= math.MinInt16 && r <= math.MaxInt16) {
+		return 0, errorf(Overflow, "Overflow")
+	}
+	return int16(r), nil
+}
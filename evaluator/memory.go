@@ -0,0 +1,96 @@
+package evaluator
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/basis-ex/ast"
+)
+
+// MemorySize is the size of the address space seen by PEEK and POKE.
+const MemorySize = 65536
+
+// Addresses at the top of memory are wired to the outside world instead of
+// storage, for programs written against a real machine's memory map. They
+// read as described and ignore POKEs.
+const (
+	AddrRandom  = 65520 // a fresh random byte on every read
+	AddrSecond  = 65521 // wall-clock second, 0-59
+	AddrMinute  = 65522 // wall-clock minute, 0-59
+	AddrHour    = 65523 // wall-clock hour, 0-23
+	AddrJiffies = 65524 // 1/60 s ticks since the program started, low byte
+	AddrJiffyHi = 65525 // ... and high byte
+)
+
+// Memory is the simulated 64KB memory behind PEEK and POKE. Ordinary
+// addresses hold whatever was last POKEd there, starting at zero.
+type Memory struct {
+	bytes   [MemorySize]byte
+	started time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{started: time.Now()}
+}
+
+func (m *Memory) Peek(addr int) (byte, error) {
+	if addr < 0 || addr >= MemorySize {
+		return 0, fmt.Errorf("address %d out of range 0-%d", addr, MemorySize-1)
+	}
+
+	now := time.Now()
+	jiffies := now.Sub(m.started) * 60 / time.Second
+	switch addr {
+	case AddrRandom:
+		return byte(rand.Intn(256)), nil
+	case AddrSecond:
+		return byte(now.Second()), nil
+	case AddrMinute:
+		return byte(now.Minute()), nil
+	case AddrHour:
+		return byte(now.Hour()), nil
+	case AddrJiffies:
+		return byte(jiffies), nil
+	case AddrJiffyHi:
+		return byte(jiffies >> 8), nil
+	}
+	return m.bytes[addr], nil
+}
+
+func (m *Memory) Poke(addr int, value int) error {
+	if addr < 0 || addr >= MemorySize {
+		return fmt.Errorf("address %d out of range 0-%d", addr, MemorySize-1)
+	}
+	if value < 0 || value > 255 {
+		return fmt.Errorf("value %d out of range 0-255", value)
+	}
+	if addr >= AddrRandom && addr <= AddrJiffyHi {
+		return nil
+	}
+	m.bytes[addr] = byte(value)
+	return nil
+}
+
+func (e *Evaluator) evalPokeStatement(stmt *ast.PokeStatement) error {
+	addr, err := e.evalExpression(stmt.Address)
+	if err != nil {
+		return err
+	}
+	value, err := e.evalExpression(stmt.Value)
+	if err != nil {
+		return err
+	}
+	addrNum, ok := addr.AsNumber()
+	if !ok {
+		return errorf(TypeMismatch, "POKE address must be a number")
+	}
+	valueNum, ok := value.AsNumber()
+	if !ok {
+		return errorf(TypeMismatch, "POKE value must be a number")
+	}
+	if err := e.env.memory.Poke(int(addrNum), int(valueNum)); err != nil {
+		return fmt.Errorf("POKE: %v", err)
+	}
+	return nil
+}
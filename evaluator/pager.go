@@ -0,0 +1,91 @@
+package evaluator
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const morePrompt = "--More--"
+
+// Pager is an output device that pauses with a --More-- prompt after a
+// screenful of lines, the way the old CRT terminal drivers did. Typing Q at
+// the prompt turns paging off for the rest of the run.
+type Pager struct {
+	w          io.Writer
+	in         *bufio.Reader
+	pageLength int
+	lines      int
+}
+
+// NewPager wraps w so that output pauses every pageLength lines, waiting for
+// a line of input from in before continuing.
+func NewPager(w io.Writer, in *bufio.Reader, pageLength int) *Pager {
+	return &Pager{w: w, in: in, pageLength: pageLength}
+}
+
+func (p *Pager) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		if p.pageLength <= 0 {
+			n, err := p.w.Write(b)
+			return written + n, err
+		}
+
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			n, err := p.w.Write(b)
+			return written + n, err
+		}
+
+		n, err := p.w.Write(b[:i+1])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		b = b[i+1:]
+
+		p.lines++
+		if p.lines >= p.pageLength-1 {
+			if err := p.more(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Reset starts a fresh page, used after the user has typed a response to
+// INPUT since they have clearly seen everything printed so far.
+func (p *Pager) Reset() {
+	p.lines = 0
+}
+
+func (p *Pager) more() error {
+	p.lines = 0
+	if _, err := fmt.Fprint(p.w, morePrompt); err != nil {
+		return err
+	}
+
+	answer, err := p.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.EqualFold(strings.TrimSpace(answer), "Q") {
+		p.pageLength = 0
+	}
+	return nil
+}
+
+// isTerminal reports whether f is attached to an interactive character
+// device rather than a file or pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
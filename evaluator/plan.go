@@ -0,0 +1,109 @@
+package evaluator
+
+import (
+	"sort"
+
+	"github.com/basis-ex/ast"
+)
+
+// plan is a program worked out once, when the evaluator is made, so that
+// running it does not decide the same things again every time a statement
+// executes. It is never changed after newPlan returns.
+type plan struct {
+	program *ast.Program
+	// lines holds the line numbers in order; the program counter is an
+	// index into it.
+	lines      []int
+	lineIndex  map[int]int
+	labelIndex map[string]int
+	// code holds each line, by index, laid out into its statements, and
+	// branches the index in its line of each IF there.
+	code     []ast.Layout
+	branches map[*ast.IfStatement]int
+	// targets maps the target of each GOTO, GOSUB and ON TIMER that names
+	// a label or an existing line to that line's index. Computed targets,
+	// and lines that do not exist, are left to be worked out when the
+	// jump runs, which is when they are an error.
+	targets map[ast.Expression]int
+	// forNext maps every FOR to where its NEXT is. FORs with no NEXT are
+	// absent.
+	forNext map[*ast.ForStatement]ast.LoopEnd
+	// data holds the DATA constants in order, and dataOffsets the index
+	// of the first one at or after each line, for RESTORE.
+	data        []Value
+	dataOffsets map[int]int
+}
+
+func newPlan(program *ast.Program) *plan {
+	lines := make([]int, 0, len(program.Statements))
+	for lineNum := range program.Statements {
+		lines = append(lines, lineNum)
+	}
+	sort.Ints(lines)
+
+	p := &plan{
+		program:     program,
+		lines:       lines,
+		lineIndex:   make(map[int]int, len(lines)),
+		labelIndex:  make(map[string]int, len(program.Labels)),
+		code:        make([]ast.Layout, len(lines)),
+		branches:    make(map[*ast.IfStatement]int),
+		targets:     make(map[ast.Expression]int),
+		forNext:     ast.PairLoops(program, lines),
+		data:        []Value{},
+		dataOffsets: ast.DataOffsets(program, lines),
+	}
+	for i, line := range lines {
+		p.lineIndex[line] = i
+		p.code[i] = ast.LayOut(program.Statements[line])
+		for n, stmt := range p.code[i].Statements {
+			if s, ok := stmt.(*ast.IfStatement); ok {
+				p.branches[s] = n
+			}
+		}
+	}
+	for label, line := range program.Labels {
+		p.labelIndex[label] = p.lineIndex[line]
+	}
+
+	for _, value := range ast.DataValues(program, lines) {
+		switch lit := value.(type) {
+		case *ast.NumberLiteral:
+			p.data = append(p.data, Number(lit.Value))
+		case *ast.StringLiteral:
+			p.data = append(p.data, String(lit.Value))
+		}
+	}
+
+	for _, line := range p.code {
+		for _, stmt := range line.Statements {
+			p.resolve(stmt)
+		}
+	}
+	return p
+}
+
+// resolve records what can be known ahead of time about stmt.
+func (p *plan) resolve(stmt ast.Statement) {
+	switch s := stmt.(type) {
+	case *ast.GotoStatement:
+		p.resolveTarget(s.LineNumber)
+	case *ast.GosubStatement:
+		p.resolveTarget(s.LineNumber)
+	case *ast.OnTimerStatement:
+		p.resolveTarget(s.Target)
+	}
+}
+
+func (p *plan) resolveTarget(expr ast.Expression) {
+	switch target := expr.(type) {
+	case *ast.Identifier:
+		if i, ok := p.labelIndex[target.Value]; ok {
+			p.targets[expr] = i
+		}
+	case *ast.NumberLiteral:
+		if i, ok := p.lineIndex[int(target.Value)]; ok {
+			p.targets[expr] = i
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/basis-ex/ast"
+)
+
+// callFrame is an active CALL. The procedure runs in its own environment;
+// the caller's environment and FOR loops are restored by END SUB.
+type callFrame struct {
+	proc       *ast.Procedure
+	returnLine int // index of the CALL's line
+	returnStmt int // position in that line of the statement after the CALL
+	caller     *Environment
+	forLoops   []*ForLoopState
+	// byRef maps parameters that were passed a plain variable to that
+	// variable, so END SUB can copy the final value back.
+	byRef map[string]string
+}
+
+// evalSubStatement skips over a procedure body reached in normal flow.
+func (e *Evaluator) evalSubStatement(stmt *ast.SubStatement) error {
+	proc, ok := e.program.Procedures[stmt.Name.Value]
+	if !ok {
+		return fmt.Errorf("SUB %s has no END SUB", stmt.Name.Value)
+	}
+	e.jump(e.lineIndex[proc.EndLine]+1, 0)
+	return nil
+}
+
+// evalCallStatement binds the arguments and jumps into the procedure.
+// Arguments that are plain variables are passed by reference, anything else
+// by value.
+func (e *Evaluator) evalCallStatement(stmt *ast.CallStatement) error {
+	proc, ok := e.program.Procedures[stmt.Name.Value]
+	if !ok {
+		return errorf(UndefinedLine, "SUB %s not defined", stmt.Name.Value)
+	}
+	if len(stmt.Arguments) != len(proc.Params) {
+		return fmt.Errorf("SUB %s expects %d argument(s), got %d", proc.Name, len(proc.Params), len(stmt.Arguments))
+	}
+	if e.maxGosubDepth > 0 && len(e.frames) >= e.maxGosubDepth {
+		return errOutOfMemory
+	}
+
+	scope := e.env.NewScope()
+	byRef := make(map[string]string)
+	for i, arg := range stmt.Arguments {
+		val, err := e.evalExpression(arg)
+		if err != nil {
+			return err
+		}
+		param := proc.Params[i].Value
+		scope.Set(param, val)
+		if ident, ok := arg.(*ast.Identifier); ok {
+			byRef[param] = ident.Value
+		}
+	}
+
+	e.frames = append(e.frames, &callFrame{
+		proc:       proc,
+		returnLine: e.currentLine,
+		returnStmt: e.after().stmt,
+		caller:     e.env,
+		forLoops:   e.forLoops,
+		byRef:      byRef,
+	})
+	e.env = scope
+	e.forLoops = []*ForLoopState{}
+	e.jump(e.lineIndex[proc.Line]+1, 0)
+	return nil
+}
+
+// evalEndSubStatement returns from the innermost CALL, copying by-reference
+// parameters back to the caller's variables.
+func (e *Evaluator) evalEndSubStatement() error {
+	if len(e.frames) == 0 {
+		return fmt.Errorf("END SUB without CALL")
+	}
+	frame := e.frames[len(e.frames)-1]
+	e.frames = e.frames[:len(e.frames)-1]
+
+	for param, variable := range frame.byRef {
+		if val, ok := e.env.Get(param); ok {
+			frame.caller.Set(variable, val)
+		}
+	}
+
+	e.env = frame.caller
+	e.forLoops = frame.forLoops
+	e.jump(frame.returnLine, frame.returnStmt)
+	return nil
+}
@@ -0,0 +1,18 @@
+package evaluator
+
+// SetSandboxed shuts the program off from the host, for running programs
+// from people who should not reach it, as a server does: SHELL, the file
+// and directory statements OPEN, FILES, KILL, NAME and CHDIR, SCREENSAVE
+// and ENVIRON$ all fail with "Permission denied", whatever SetShellEnabled allows.
+func (e *Evaluator) SetSandboxed(sandboxed bool) {
+	e.sandboxed = sandboxed
+}
+
+// checkHostAccess returns the error for what, a statement or function that
+// reaches the host, when the program is sandboxed.
+func (e *Evaluator) checkHostAccess(what string) error {
+	if e.sandboxed {
+		return errorf(PermissionDenied, "%s is disabled", what)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package evaluator
+
+import (
+	"fmt"
+
+	"github.com/basis-ex/ast"
+)
+
+// ansiColors maps the GW-BASIC palette (0 black, 1 blue, 2 green, 3 cyan,
+// 4 red, 5 magenta, 6 brown, 7 white) onto ANSI colour numbers. Colours 8-15
+// are the bright versions of 0-7.
+var ansiColors = [8]int{0, 4, 2, 6, 1, 5, 3, 7}
+
+// The screen statements write ANSI escape sequences. When output is not a
+// terminal they do nothing, so redirected output stays clean text.
+
+func (e *Evaluator) cls() error {
+	if !e.terminal {
+		return nil
+	}
+	_, err := fmt.Fprint(e.out, "\x1b[2J\x1b[H")
+	return err
+}
+
+func (e *Evaluator) evalLocateStatement(stmt *ast.LocateStatement) error {
+	row, hasRow, err := e.screenArg(stmt.Row, "LOCATE row", 1, 1<<15)
+	if err != nil {
+		return err
+	}
+	col, hasCol, err := e.screenArg(stmt.Column, "LOCATE column", 1, 1<<15)
+	if err != nil {
+		return err
+	}
+	if !e.terminal {
+		return nil
+	}
+
+	switch {
+	case hasRow && hasCol:
+		_, err = fmt.Fprintf(e.out, "\x1b[%d;%dH", row, col)
+	case hasRow:
+		_, err = fmt.Fprintf(e.out, "\x1b[%dd", row)
+	case hasCol:
+		_, err = fmt.Fprintf(e.out, "\x1b[%dG", col)
+	}
+	return err
+}
+
+func (e *Evaluator) evalColorStatement(stmt *ast.ColorStatement) error {
+	fg, hasFg, err := e.screenArg(stmt.Foreground, "COLOR foreground", 0, 15)
+	if err != nil {
+		return err
+	}
+	bg, hasBg, err := e.screenArg(stmt.Background, "COLOR background", 0, 15)
+	if err != nil {
+		return err
+	}
+	if !e.terminal {
+		return nil
+	}
+
+	if hasFg {
+		if _, err := fmt.Fprintf(e.out, "\x1b[%dm", ansiColor(fg, 30, 90)); err != nil {
+			return err
+		}
+	}
+	if hasBg {
+		if _, err := fmt.Fprintf(e.out, "\x1b[%dm", ansiColor(bg, 40, 100)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ansiColor(c, base, brightBase int) int {
+	if c >= 8 {
+		return brightBase + ansiColors[c-8]
+	}
+	return base + ansiColors[c]
+}
+
+// screenArg evaluates an optional numeric argument and checks its range.
+func (e *Evaluator) screenArg(expr ast.Expression, what string, min, max int) (int, bool, error) {
+	if expr == nil {
+		return 0, false, nil
+	}
+	val, err := e.evalExpression(expr)
+	if err != nil {
+		return 0, false, err
+	}
+	num, ok := val.AsNumber()
+	if !ok {
+		return 0, false, errorf(TypeMismatch, "%s must be a number", what)
+	}
+	n := int(num)
+	if n < min || n > max {
+		return 0, false, fmt.Errorf("%s %d out of range %d-%d", what, n, min, max)
+	}
+	return n, true, nil
+}
@@ -0,0 +1,77 @@
+package evaluator
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/basis-ex/ast"
+)
+
+// SetShellEnabled allows or forbids the SHELL statement. It is off by
+// default so an embedded or server-side interpreter cannot run commands on
+// the host unless its owner opts in.
+func (e *Evaluator) SetShellEnabled(enabled bool) {
+	e.allowShell = enabled
+}
+
+// evalShellStatement runs SHELL "command" through the system shell, or
+// starts an interactive shell when no command is given. The command's output
+// is streamed as it is produced; its exit status is ignored, as in GW-BASIC.
+func (e *Evaluator) evalShellStatement(stmt *ast.ShellStatement) error {
+	if err := e.checkHostAccess("SHELL"); err != nil {
+		return err
+	}
+	if !e.allowShell {
+		return errorf(PermissionDenied, "SHELL is disabled")
+	}
+
+	var cmd *exec.Cmd
+	if stmt.Command == nil {
+		cmd = interactiveShell()
+	} else {
+		val, err := e.evalExpression(stmt.Command)
+		if err != nil {
+			return err
+		}
+		command, ok := val.AsString()
+		if !ok {
+			return errorf(TypeMismatch, "SHELL command must be a string")
+		}
+		cmd = shellCommand(command)
+	}
+
+	// An interactive shell needs the terminal itself, not a pipe from the
+	// reader.
+	cmd.Stdin = e.env.reader
+	if e.env.keyboard != nil {
+		cmd.Stdin = e.env.keyboard
+	}
+	cmd.Stdout = e.out
+	cmd.Stderr = e.errOut
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return fileError("SHELL", err)
+	}
+	return nil
+}
+
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
+
+func interactiveShell() *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd")
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return exec.Command(sh)
+	}
+	return exec.Command("/bin/sh")
+}
@@ -0,0 +1,324 @@
+package evaluator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Snapshot is a copy of a program's state at one point. Hooks and other
+// tools read it to look at a program without stopping it, and Restore
+// puts a stopped program back into the state it records, so a long run
+// can be checkpointed with encoding/json and resumed later.
+//
+// Open files, the simulated memory and ON TIMER are not part of the
+// snapshot; a restored program starts with no files open.
+type Snapshot struct {
+	// Line is the number of the line holding the next statement, and
+	// Statement its place in the line counting from zero. Line is zero
+	// once the program has ended.
+	Line      int `json:"line"`
+	Statement int `json:"statement"`
+	// Variables, Arrays and Files are as returned by the methods of the
+	// same names.
+	Variables []Variable    `json:"variables"`
+	Arrays    []Array       `json:"arrays"`
+	Files     []FileChannel `json:"files,omitempty"`
+	// Gosubs are the places active GOSUBs return to, innermost last.
+	Gosubs []Position `json:"gosubs"`
+	// Loops are the active FOR loops, innermost last.
+	Loops []Loop `json:"loops"`
+	// DataPointer counts the DATA items READ has used.
+	DataPointer int `json:"data_pointer"`
+	// Calls is the depth of active SUB calls. Restore refuses a snapshot
+	// taken inside a SUB.
+	Calls int `json:"calls"`
+}
+
+// Position is a statement of the program by line number and its place
+// among the line's colon-separated statements.
+type Position struct {
+	Line      int `json:"line"`
+	Statement int `json:"statement"`
+}
+
+// Loop is an active FOR loop in a Snapshot. Body is where NEXT goes back
+// to: the statement after the FOR.
+type Loop struct {
+	Variable string   `json:"variable"`
+	End      float64  `json:"end"`
+	Step     float64  `json:"step"`
+	Body     Position `json:"body"`
+}
+
+// Snapshot copies the program's current state.
+func (e *Evaluator) Snapshot() Snapshot {
+	s := Snapshot{
+		Variables:   e.Variables(),
+		Arrays:      e.Arrays(),
+		Files:       e.Files(),
+		Gosubs:      make([]Position, 0, len(e.callStack)),
+		Loops:       make([]Loop, 0, len(e.forLoops)),
+		DataPointer: e.dataPtr,
+		Calls:       len(e.frames),
+	}
+	if !e.halted && e.currentLine < len(e.lines) {
+		s.Line, s.Statement = e.lines[e.currentLine], e.stmtIndex
+	}
+	for _, pos := range e.callStack {
+		s.Gosubs = append(s.Gosubs, Position{e.lines[pos.line], pos.stmt})
+	}
+	for _, loop := range e.forLoops {
+		s.Loops = append(s.Loops, Loop{
+			Variable: loop.Variable,
+			End:      loop.End,
+			Step:     loop.Step,
+			Body:     Position{e.lines[loop.StartLine], loop.body},
+		})
+	}
+	return s
+}
+
+// Restore puts the program into the state s records, replacing its
+// variables, arrays, GOSUB stack and FOR loops and closing any open files,
+// so that Continue carries on from where the snapshot was taken. The
+// snapshot must come from the same program, or one with the same line
+// numbers, and fit the evaluator's limits; Restore changes nothing if it
+// does not.
+func (e *Evaluator) Restore(s Snapshot) error {
+	if s.Calls > 0 {
+		return fmt.Errorf("can't restore a program stopped inside a SUB")
+	}
+	index := func(pos Position) (int, error) {
+		i, ok := e.lineIndex[pos.Line]
+		if !ok {
+			return 0, fmt.Errorf("line %d not found", pos.Line)
+		}
+		if pos.Statement < 0 || pos.Statement >= len(e.statements(i)) {
+			return 0, fmt.Errorf("line %d has no statement %d", pos.Line, pos.Statement+1)
+		}
+		return i, nil
+	}
+
+	current, stmt := len(e.lines), 0
+	if s.Line != 0 {
+		i, err := index(Position{s.Line, s.Statement})
+		if err != nil {
+			return err
+		}
+		current, stmt = i, s.Statement
+	}
+	callStack := make([]position, 0, len(s.Gosubs))
+	for _, ret := range s.Gosubs {
+		// A GOSUB that ended its line returns one past its last statement.
+		i, err := e.resumeIndex(ret)
+		if err != nil {
+			return err
+		}
+		callStack = append(callStack, position{i, ret.Statement})
+	}
+	if e.maxGosubDepth > 0 && len(callStack) > e.maxGosubDepth {
+		return fmt.Errorf("%w: %d GOSUBs active, more than %d", errOutOfMemory, len(callStack), e.maxGosubDepth)
+	}
+	loops := make([]*ForLoopState, 0, len(s.Loops))
+	for _, loop := range s.Loops {
+		i, err := e.resumeIndex(loop.Body)
+		if err != nil {
+			return err
+		}
+		if loop.Variable == "" || strings.HasSuffix(loop.Variable, "$") {
+			return fmt.Errorf("FOR loop has bad variable %q", loop.Variable)
+		}
+		loops = append(loops, &ForLoopState{Variable: loop.Variable, End: loop.End, Step: loop.Step, StartLine: i, body: loop.Body.Statement})
+	}
+	if s.DataPointer < 0 || s.DataPointer > len(e.data) {
+		return fmt.Errorf("DATA pointer %d is out of range", s.DataPointer)
+	}
+	if err := e.checkSnapshotValues(s); err != nil {
+		return err
+	}
+
+	e.closeFiles()
+	// Clear the maps in place: the REPL shares them with its session.
+	clear(e.env.variables)
+	e.env.generation++
+	clear(e.env.arrays)
+	for _, v := range s.Variables {
+		e.env.Set(v.Name, v.Value)
+	}
+	for _, a := range s.Arrays {
+		arr := &ArrayValue{Size: a.Size, Elements: make(map[int]Value, len(a.Elements))}
+		for i, val := range a.Elements {
+			arr.Elements[i] = val
+		}
+		e.env.SetArray(a.Name, arr)
+	}
+	e.currentLine, e.stmtIndex = current, stmt
+	e.callStack, e.forLoops, e.frames = callStack, loops, nil
+	e.dataPtr = s.DataPointer
+	e.halted, e.jumped, e.started = s.Line == 0, false, true
+	return nil
+}
+
+// resumeIndex is the index of the line pos names, for a place the program
+// goes back to: a GOSUB return or a FOR loop's body. Either may be one past
+// the line's last statement, when the GOSUB or FOR ended it.
+func (e *Evaluator) resumeIndex(pos Position) (int, error) {
+	i, ok := e.lineIndex[pos.Line]
+	if !ok {
+		return 0, fmt.Errorf("line %d not found", pos.Line)
+	}
+	if pos.Statement < 0 || pos.Statement > len(e.statements(i)) {
+		return 0, fmt.Errorf("line %d has no statement %d", pos.Line, pos.Statement+1)
+	}
+	return i, nil
+}
+
+// checkSnapshotValues checks the variables and arrays of s before Restore
+// puts them in place: each must hold the type its name calls for, every
+// element must lie within its array's size, and the strings and arrays
+// must fit the limits a running program is held to.
+func (e *Evaluator) checkSnapshotValues(s Snapshot) error {
+	checkValue := func(name string, val Value) error {
+		if strings.HasSuffix(name, "$") != val.isString {
+			return errorf(TypeMismatch, "%s holds the wrong type", name)
+		}
+		return e.checkString(val)
+	}
+	for _, v := range s.Variables {
+		if v.Name == "" {
+			return fmt.Errorf("variable has no name")
+		}
+		if err := checkValue(v.Name, v.Value); err != nil {
+			return err
+		}
+	}
+	cells := 0
+	for _, a := range s.Arrays {
+		if a.Name == "" {
+			return fmt.Errorf("array has no name")
+		}
+		if a.Size < 0 {
+			return errorf(SubscriptOutOfRange, "array %s has size %d", a.Name, a.Size)
+		}
+		cells += a.Size + 1
+		if e.maxArrayCells > 0 && cells > e.maxArrayCells {
+			return fmt.Errorf("%w: arrays would need more than %d cells", errOutOfMemory, e.maxArrayCells)
+		}
+		for i, val := range a.Elements {
+			if i < 0 || i > a.Size {
+				return errorf(SubscriptOutOfRange, "subscript %d out of range for %s(%d)", i, a.Name, a.Size)
+			}
+			if err := checkValue(a.Name, val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonValue is how a Value is written in a snapshot. JSON has no way to
+// write NaN or the infinities, which overflow can leave in a variable, so
+// those numbers go in NonFinite as "NaN", "+Inf" or "-Inf" instead.
+type jsonValue struct {
+	Number    *float64 `json:"number,omitempty"`
+	NonFinite *string  `json:"nonfinite,omitempty"`
+	String    *string  `json:"string,omitempty"`
+}
+
+func toJSONValue(val Value) jsonValue {
+	switch {
+	case val.isString:
+		return jsonValue{String: &val.str}
+	case math.IsNaN(val.num) || math.IsInf(val.num, 0):
+		// FormatFloat writes these as exactly "NaN", "+Inf" and "-Inf".
+		text := strconv.FormatFloat(val.num, 'g', -1, 64)
+		return jsonValue{NonFinite: &text}
+	}
+	return jsonValue{Number: &val.num}
+}
+
+func (jv jsonValue) value() (Value, error) {
+	switch {
+	case jv.Number != nil:
+		return Number(*jv.Number), nil
+	case jv.NonFinite != nil:
+		switch *jv.NonFinite {
+		case "NaN":
+			return Number(math.NaN()), nil
+		case "+Inf":
+			return Number(math.Inf(1)), nil
+		case "-Inf":
+			return Number(math.Inf(-1)), nil
+		}
+		return Value{}, fmt.Errorf("bad non-finite number %q", *jv.NonFinite)
+	case jv.String != nil:
+		return String(*jv.String), nil
+	}
+	return Value{}, fmt.Errorf("value has neither a number nor a string")
+}
+
+// MarshalJSON writes the variable as its name and a number or string.
+func (v Variable) MarshalJSON() ([]byte, error) {
+	val := toJSONValue(v.Value)
+	return json.Marshal(struct {
+		Name string `json:"name"`
+		jsonValue
+	}{v.Name, val})
+}
+
+func (v *Variable) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name string `json:"name"`
+		jsonValue
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	val, err := raw.value()
+	if err != nil {
+		return fmt.Errorf("variable %s: %v", raw.Name, err)
+	}
+	v.Name, v.Value = raw.Name, val
+	return nil
+}
+
+// MarshalJSON writes the array's name, size and the elements that have
+// been set, keyed by index.
+func (a Array) MarshalJSON() ([]byte, error) {
+	elements := make(map[string]jsonValue, len(a.Elements))
+	for i, val := range a.Elements {
+		elements[strconv.Itoa(i)] = toJSONValue(val)
+	}
+	return json.Marshal(struct {
+		Name     string               `json:"name"`
+		Size     int                  `json:"size"`
+		Elements map[string]jsonValue `json:"elements"`
+	}{a.Name, a.Size, elements})
+}
+
+func (a *Array) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Name     string               `json:"name"`
+		Size     int                  `json:"size"`
+		Elements map[string]jsonValue `json:"elements"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	a.Name, a.Size, a.Elements = raw.Name, raw.Size, make(map[int]Value, len(raw.Elements))
+	for key, jv := range raw.Elements {
+		i, err := strconv.Atoi(key)
+		if err != nil {
+			return fmt.Errorf("array %s: bad index %q", raw.Name, key)
+		}
+		val, err := jv.value()
+		if err != nil {
+			return fmt.Errorf("array %s(%d): %v", raw.Name, i, err)
+		}
+		a.Elements[i] = val
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package evaluator
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotKeepsNonFiniteNumbers(t *testing.T) {
+	src := "10 LET A = 1000000000: FOR I = 1 TO 9: LET A = A * A: NEXT I\n" +
+		"20 LET B = -A: LET N = A - A: DIM C(2): LET C(1) = N\n"
+	e := load(t, src, io.Discard)
+	if err := e.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(e.Snapshot())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	restored := load(t, src, io.Discard)
+	if err := restored.Restore(s); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+
+	number := func(name string) float64 {
+		t.Helper()
+		val, ok := restored.env.Get(name)
+		if !ok {
+			t.Fatalf("%s not restored", name)
+		}
+		n, _ := val.AsNumber()
+		return n
+	}
+	if a := number("A"); !math.IsInf(a, 1) {
+		t.Errorf("A = %v, want +Inf", a)
+	}
+	if b := number("B"); !math.IsInf(b, -1) {
+		t.Errorf("B = %v, want -Inf", b)
+	}
+	if n := number("N"); !math.IsNaN(n) {
+		t.Errorf("N = %v, want NaN", n)
+	}
+	if c, _ := restored.env.arrays["C"].Elements[1].AsNumber(); !math.IsNaN(c) {
+		t.Errorf("C(1) = %v, want NaN", c)
+	}
+}
+
+func TestRestoreRejectsMalformedSnapshots(t *testing.T) {
+	const src = "10 GOSUB 30: PRINT \"BACK\"\n20 END\n30 FOR I = 1 TO 2: NEXT I: RETURN\n"
+	tests := []struct {
+		name, snapshot, want string
+	}{
+		{
+			name:     "element past the array's size",
+			snapshot: `{"arrays":[{"name":"A","size":2,"elements":{"3":{"number":1}}}]}`,
+			want:     "subscript 3 out of range",
+		},
+		{
+			name:     "negative element",
+			snapshot: `{"arrays":[{"name":"A","size":2,"elements":{"-1":{"number":1}}}]}`,
+			want:     "subscript -1 out of range",
+		},
+		{
+			name:     "negative size",
+			snapshot: `{"arrays":[{"name":"A","size":-5,"elements":{}}]}`,
+			want:     "has size -5",
+		},
+		{
+			name:     "arrays past the cell limit",
+			snapshot: `{"arrays":[{"name":"A","size":10,"elements":{}},{"name":"B","size":10,"elements":{}}]}`,
+			want:     "Out of memory",
+		},
+		{
+			name:     "string past the length limit",
+			snapshot: `{"variables":[{"name":"A$","string":"` + strings.Repeat("X", 17) + `"}]}`,
+			want:     "Out of memory",
+		},
+		{
+			name:     "string in a number variable",
+			snapshot: `{"variables":[{"name":"A","string":"X"}]}`,
+			want:     "wrong type",
+		},
+		{
+			name:     "number in a string array",
+			snapshot: `{"arrays":[{"name":"A$","size":1,"elements":{"0":{"number":1}}}]}`,
+			want:     "wrong type",
+		},
+		{
+			name:     "GOSUB returning to a missing statement",
+			snapshot: `{"gosubs":[{"line":10,"statement":7}]}`,
+			want:     "line 10 has no statement 8",
+		},
+		{
+			name:     "GOSUBs past the depth limit",
+			snapshot: `{"gosubs":[{"line":10,"statement":1},{"line":10,"statement":1},{"line":10,"statement":1},{"line":10,"statement":1}]}`,
+			want:     "Out of memory",
+		},
+		{
+			name:     "FOR loop on a string variable",
+			snapshot: `{"loops":[{"variable":"I$","end":2,"step":1,"body":{"line":30,"statement":1}}]}`,
+			want:     "bad variable",
+		},
+		{
+			name:     "DATA pointer out of range",
+			snapshot: `{"data_pointer":1}`,
+			want:     "DATA pointer 1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Snapshot
+			if err := json.Unmarshal([]byte(tt.snapshot), &s); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			e := load(t, src, io.Discard)
+			e.SetMaxArrayCells(16)
+			e.SetMaxStringLength(16)
+			e.SetMaxGosubDepth(3)
+			err := e.Restore(s)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Restore = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSnapshotRejectsBadValues(t *testing.T) {
+	for _, data := range []string{
+		`{"variables":[{"name":"A"}]}`,
+		`{"variables":[{"name":"A","nonfinite":"Huge"}]}`,
+		`{"arrays":[{"name":"A","size":1,"elements":{"one":{"number":1}}}]}`,
+	} {
+		var s Snapshot
+		if err := json.Unmarshal([]byte(data), &s); err == nil {
+			t.Errorf("Unmarshal(%s) succeeded", data)
+		}
+	}
+}
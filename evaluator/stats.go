@@ -0,0 +1,59 @@
+package evaluator
+
+// Stats describes the work done by a run, for the -time flag. Memory is
+// sampled every statsInterval statements and when the program ends or
+// stops, so a peak that lasts only a few statements can be missed.
+type Stats struct {
+	// Statements is the number of statements executed, counting an IF
+	// and the statement after its THEN separately.
+	Statements int64
+	// PeakVariables and PeakElements are the most scalar variables and
+	// array elements that held a value at once.
+	PeakVariables int
+	PeakElements  int
+	// PeakBytes estimates the storage those values took: eight bytes for
+	// a number, and a string's length plus sixteen for a string.
+	PeakBytes int
+}
+
+const statsInterval = 256
+
+// Stats returns the counts for the current or most recent run.
+func (e *Evaluator) Stats() Stats {
+	e.sampleMemory()
+	return e.stats
+}
+
+// sampleMemory updates the peaks in e.stats from the variables and arrays
+// now set, including those of callers suspended in a CALL.
+func (e *Evaluator) sampleMemory() {
+	envs := []*Environment{e.env}
+	for _, frame := range e.frames {
+		envs = append(envs, frame.caller)
+	}
+
+	vars, elements, bytes := 0, 0, 0
+	for _, env := range envs {
+		for _, val := range env.variables {
+			vars++
+			bytes += valueBytes(*val)
+		}
+		for _, arr := range env.arrays {
+			elements += len(arr.Elements)
+			for _, val := range arr.Elements {
+				bytes += valueBytes(val)
+			}
+		}
+	}
+
+	e.stats.PeakVariables = max(e.stats.PeakVariables, vars)
+	e.stats.PeakElements = max(e.stats.PeakElements, elements)
+	e.stats.PeakBytes = max(e.stats.PeakBytes, bytes)
+}
+
+func valueBytes(val Value) int {
+	if s, ok := val.AsString(); ok {
+		return len(s) + 16
+	}
+	return 8
+}
@@ -0,0 +1,115 @@
+package evaluator
+
+import (
+	"context"
+
+	"github.com/basis-ex/ast"
+)
+
+// position is a statement of the program: the index of its line in lines,
+// and its index in that line's layout, which gives those after THEN and
+// ELSE places of their own.
+type position struct {
+	line, stmt int
+}
+
+// jump makes the statement at line and stmt run next. A stmt past the end
+// of the line moves on to the following line.
+func (e *Evaluator) jump(line, stmt int) {
+	e.next = position{line, stmt}
+	e.jumped = true
+}
+
+// statements returns the statements of the line at index i.
+func (e *Evaluator) statements(i int) []ast.Statement {
+	return e.code[i].Statements
+}
+
+// after is where the program carries on once the statement running now
+// is done, unless it jumps: the next in its line, or past the ELSE branch
+// after the last statement following THEN.
+func (e *Evaluator) after() position {
+	if e.currentLine >= len(e.lines) {
+		// A statement run by Exec once the program has ended.
+		return position{e.currentLine, 0}
+	}
+	return position{e.currentLine, e.code[e.currentLine].Next[e.stmtIndex]}
+}
+
+// Status says whether a program has started, is running or has ended.
+type Status int
+
+const (
+	// NotStarted is a program that has been neither run nor stepped.
+	NotStarted Status = iota
+	// Running is a program inside Run, Resume or Step; hooks see it.
+	Running
+	// Stopped is a program paused, interrupted, stepped part way or
+	// stopped by an error, which leaves it at the failing statement.
+	Stopped
+	// Ended is a program that has run off its end or reached END.
+	Ended
+)
+
+func (s Status) String() string {
+	switch s {
+	case NotStarted:
+		return "not started"
+	case Running:
+		return "running"
+	case Stopped:
+		return "stopped"
+	default:
+		return "ended"
+	}
+}
+
+// State describes where a program is, for debuggers and visualizers.
+type State struct {
+	Status Status
+	// Line is the number of the line holding the next statement, and
+	// Statement that statement's place among the line's colon-separated
+	// statements, counting from zero. While the program runs they are
+	// the statement running now. Both are zero once it has ended.
+	Line      int
+	Statement int
+	// Next is the statement itself, nil once the program has ended.
+	Next ast.Statement
+}
+
+// State reports where the program is. Call it between steps, after Run or
+// Resume returns, or from a hook; it is not safe to call from another
+// goroutine while the program runs.
+func (e *Evaluator) State() State {
+	if e.halted || e.currentLine >= len(e.lines) {
+		return State{Status: Ended}
+	}
+	state := State{
+		Status:    Stopped,
+		Line:      e.lines[e.currentLine],
+		Statement: e.stmtIndex,
+		Next:      e.statements(e.currentLine)[e.stmtIndex],
+	}
+	switch {
+	case e.running:
+		state.Status = Running
+	case !e.started:
+		state.Status = NotStarted
+	}
+	return state
+}
+
+// Pause asks the running program to stop before its next statement, even
+// in the middle of a line. Run or Resume then returns a *BreakError. It is
+// safe to call from another goroutine, and has no effect on a program that
+// is not running.
+func (e *Evaluator) Pause() {
+	e.paused.Store(true)
+}
+
+// Resume runs a program stopped by Pause, Interrupt, the line hook or Step
+// on from the statement where it stopped. It is Continue under the name
+// debuggers expect, and takes ctx the same way.
+func (e *Evaluator) Resume(ctx context.Context) error {
+	return e.Continue(ctx)
+}
@@ -0,0 +1,108 @@
+package evaluator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/basis-ex/ast"
+)
+
+type timerState int
+
+const (
+	timerOff timerState = iota
+	timerOn
+	timerStopped
+)
+
+// eventTimer is the ON TIMER trap. While it is on, the main loop checks it
+// before every statement; when the interval has passed it GOSUBs to the
+// handler as if a GOSUB had been inserted ahead of the statement about to
+// run. Further events wait until the handler RETURNs.
+type eventTimer struct {
+	interval time.Duration
+	target   int // line index of the handler; -1 until ON TIMER runs
+	state    timerState
+	next     time.Time
+	pending  bool
+	// depth is the GOSUB depth while the handler runs, zero otherwise.
+	depth int
+}
+
+func (e *Evaluator) evalOnTimerStatement(stmt *ast.OnTimerStatement) error {
+	val, err := e.evalExpression(stmt.Interval)
+	if err != nil {
+		return err
+	}
+	secs, ok := val.AsNumber()
+	if !ok || secs <= 0 || secs > 86400 {
+		return fmt.Errorf("ON TIMER interval must be a number of seconds from 1 to 86400")
+	}
+
+	target, err := e.jumpTarget(stmt.Target, "ON TIMER")
+	if err != nil {
+		return err
+	}
+
+	e.timer.interval = time.Duration(secs * float64(time.Second))
+	e.timer.target = target
+	e.timer.next = time.Now().Add(e.timer.interval)
+	return nil
+}
+
+func (e *Evaluator) evalTimerStatement(stmt *ast.TimerStatement) error {
+	switch stmt.Mode {
+	case "ON":
+		if e.timer.state == timerOff {
+			e.timer.next = time.Now().Add(e.timer.interval)
+		}
+		e.timer.state = timerOn
+	case "OFF":
+		e.timer.state = timerOff
+		e.timer.pending = false
+	case "STOP":
+		// Events are still noticed, but only handled after TIMER ON.
+		e.timer.state = timerStopped
+	}
+	return nil
+}
+
+// pollTimer is called by Run before each statement. It reports whether it
+// diverted control into the timer handler.
+func (e *Evaluator) pollTimer() (bool, error) {
+	if e.timer.state == timerOff || e.timer.target < 0 {
+		return false, nil
+	}
+
+	if now := time.Now(); !now.Before(e.timer.next) {
+		e.timer.pending = true
+		e.timer.next = now.Add(e.timer.interval)
+	}
+	if !e.timer.pending || e.timer.state != timerOn || e.timer.depth > 0 {
+		return false, nil
+	}
+
+	if e.maxGosubDepth > 0 && len(e.callStack) >= e.maxGosubDepth {
+		return false, errOutOfMemory
+	}
+	e.timer.pending = false
+	// RETURN resumes at the statement that has not run yet.
+	e.callStack = append(e.callStack, position{e.currentLine, e.stmtIndex})
+	e.timer.depth = len(e.callStack)
+	e.currentLine, e.stmtIndex = e.timer.target, 0
+	return true, nil
+}
+
+// timerReturned re-arms the trap once its handler has RETURNed.
+func (e *Evaluator) timerReturned() {
+	if e.timer.depth > 0 && len(e.callStack) < e.timer.depth {
+		e.timer.depth = 0
+	}
+}
+
+// builtinTimer implements TIMER, the seconds elapsed since midnight.
+func builtinTimer(_ *Evaluator, _ []Value) (Value, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return Number(now.Sub(midnight).Seconds()), nil
+}
@@ -0,0 +1,49 @@
+package evaluator
+
+import "fmt"
+
+type ValueType string
+
+const (
+	NUMBER_VAL ValueType = "NUMBER"
+	STRING_VAL ValueType = "STRING"
+)
+
+// Value is a BASIC number or string. It is a small struct rather than a
+// pointer so that literals and arithmetic results are passed and stored
+// without allocating; the zero Value is the number 0, which is what an
+// unset variable reads as. Build values with Number and String.
+type Value struct {
+	str      string
+	num      float64
+	isString bool
+}
+
+// Number returns the number n as a Value.
+func Number(n float64) Value { return Value{num: n} }
+
+// String returns the string s as a Value.
+func String(s string) Value { return Value{str: s, isString: true} }
+
+func (v Value) Type() ValueType {
+	if v.isString {
+		return STRING_VAL
+	}
+	return NUMBER_VAL
+}
+
+// IsString reports whether v is a string rather than a number.
+func (v Value) IsString() bool { return v.isString }
+
+// AsNumber returns v's number, and false if v is a string.
+func (v Value) AsNumber() (float64, bool) { return v.num, !v.isString }
+
+// AsString returns v's text, and false if v is a number.
+func (v Value) AsString() (string, bool) { return v.str, v.isString }
+
+func (v Value) Inspect() string {
+	if v.isString {
+		return v.str
+	}
+	return fmt.Sprintf("%g", v.num)
+}
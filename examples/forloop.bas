@@ -0,0 +1,6 @@
+10 REM A tight FOR loop of arithmetic, to time with -time
+20 LET S = 0
+30 FOR I = 1 TO 1000000
+40 LET S = S + I * 2 - 1
+50 NEXT I
+60 PRINT S
@@ -6,7 +6,7 @@
 55 GOSUB 500
 60 PRINT "LUNAR LANDER - BEGIN DESCENT"
 70 PRINT "ALT=", ALT, " VEL=", VEL, " FUEL=", FUEL
-80 INPUT "THRUST (0-50)? "; T
+80 INPUT "THRUST (0-50)? ", T
 90 IF T < 0 THEN LET T = 0
 100 IF T > 50 THEN LET T = 50
 110 IF FUEL <= 0 THEN LET T = 0
@@ -1,5 +1,5 @@
 10 REM Multiplication Table
-20 INPUT "Enter a number: "; N
+20 INPUT "Enter a number"; N
 30 PRINT "Multiplication table for "; N
 40 FOR I = 1 TO 10
 50 LET R = N * I
@@ -0,0 +1,8 @@
+10 REM Numbers at the edges, which every backend must print alike
+20 LET A = 1000000000
+30 FOR I = 1 TO 9: LET A = A * A: NEXT I
+40 LET N = A - A
+50 PRINT "INFINITY"; A; -A; "NOT A NUMBER"; N
+60 PRINT "FIX AND ROUND"; FIX(-0.5); ROUND(-0.4); ROUND(-0.04, 1); FIX(N); ROUND(A)
+70 PRINT "MIN AND MAX"; MIN(0, -0); MAX(-0, 0); MIN(N, 1); MIN(-A, N); MAX(A, N)
+80 PRINT "NEGATIVE ZERO"; -0; 0 * -1
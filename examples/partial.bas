@@ -5,7 +5,7 @@
 50 LET GRAV = -0.16
 60 PRINT "LUNAR LANDER - BEGIN DESCENT"
 70 PRINT "ALT=", ALT, " VEL=", VEL, " FUEL=", FUEL
-80 INPUT "THRUST (0-50)? "; T
+80 INPUT "THRUST (0-50)? ", T
 90 IF T < 0 THEN LET T = 0
 100 IF T > 50 THEN LET T = 50
 110 IF FUEL <= 0 THEN LET T = 0
@@ -22,3 +22,4 @@
 310 IF VEL > -5 THEN PRINT "SOFT LANDING, NICE JOB": GOTO 400
 320 IF VEL > -15 THEN PRINT "ROUGH LANDING, MODULE DAMAGED": GOTO 400
 330 PRINT "CRASH! IMPACT VELOCITY=", VEL
+400 END
@@ -0,0 +1,219 @@
+package fileformat
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var errTruncated = errors.New("tokenized program ends in the middle of a line")
+
+// Decode turns a tokenized program, protected or not, into its text, a
+// numbered line to a line, as GW-BASIC would LIST it.
+func Decode(data []byte) (string, error) {
+	return decode(data, false)
+}
+
+// DecodeSource is Decode for a program to be run here rather than listed.
+// Its numbers are written as plain decimals, the way the lexer reads them:
+// .25 as 0.25, 1500# as 1500, 1E+10 as 10000000000 and &H1F as 31.
+func DecodeSource(data []byte) (string, error) {
+	return decode(data, true)
+}
+
+func decode(data []byte, plain bool) (string, error) {
+	if !IsTokenized(data) {
+		return "", ErrNotTokenized
+	}
+	body := data[1:]
+	if data[0] == headerProtected {
+		body = unprotect(body)
+	}
+
+	var b strings.Builder
+	for {
+		if len(body) < 2 {
+			return "", errTruncated
+		}
+		if body[0] == 0 && body[1] == 0 {
+			return b.String(), nil
+		}
+		if len(body) < 4 {
+			return "", errTruncated
+		}
+		number := int(binary.LittleEndian.Uint16(body[2:]))
+		text, n, err := decodeLine(body[4:], plain)
+		if err != nil {
+			return "", lineError(number, "%v", err)
+		}
+		fmt.Fprintf(&b, "%d %s\n", number, text)
+		body = body[4+n:]
+	}
+}
+
+// decodeLine returns the text of the tokenized line at the start of data
+// and how many bytes it took, its closing zero included. With plain set
+// its numbers are written as decodePlainNumber writes them.
+func decodeLine(data []byte, plain bool) (string, int, error) {
+	var b strings.Builder
+	// Strings, and what follows REM or DATA, up to the end of the line or
+	// the DATA statement, are kept as typed.
+	var quoted, rem, inData bool
+	for i := 0; ; {
+		if i >= len(data) {
+			return "", 0, errTruncated
+		}
+		c := data[i]
+		next := func(k int) byte {
+			if i+k < len(data) {
+				return data[i+k]
+			}
+			return 0
+		}
+		switch {
+		case c == 0:
+			return b.String(), i + 1, nil
+		case rem:
+			writeChar(&b, c)
+			i++
+		case quoted:
+			quoted = c != '"'
+			writeChar(&b, c)
+			i++
+		case c == '"':
+			quoted = true
+			b.WriteByte(c)
+			i++
+		case inData:
+			inData = c != ':'
+			writeChar(&b, c)
+			i++
+
+		// An apostrophe is kept as :REM', and ELSE as :ELSE, the colon
+		// not shown; WHILE is followed by a + not shown either.
+		case c == ':' && next(1) == tokRem && next(2) == tokQuote:
+			b.WriteByte('\'')
+			rem = true
+			i += 3
+		case c == ':' && next(1) == tokElse:
+			b.WriteString("ELSE")
+			i += 2
+		case c == tokWhile && next(1) == tokPlus:
+			b.WriteString("WHILE")
+			i += 2
+
+		case c >= numOctal && c <= numDouble:
+			decodeNumber := decodeNumber
+			if plain {
+				decodeNumber = decodePlainNumber
+			}
+			text, n, err := decodeNumber(data[i:])
+			if err != nil {
+				return "", 0, err
+			}
+			b.WriteString(text)
+			i += n
+		case c >= 0x80:
+			tok := uint16(c)
+			if c >= 0xFD {
+				if i+1 >= len(data) {
+					return "", 0, errTruncated
+				}
+				tok = tok<<8 | uint16(data[i+1])
+				i++
+			}
+			i++
+			keyword, ok := keywords[tok]
+			if !ok {
+				return "", 0, fmt.Errorf("unknown token %#x", tok)
+			}
+			b.WriteString(keyword)
+			rem = tok == tokRem || tok == tokQuote
+			inData = tok == tokData
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+}
+
+// numberSize is how many bytes follow each number token but intSmall's.
+var numberSize = map[byte]int{
+	numOctal: 2, numHex: 2, numPointer: 2, numLine: 2, numByte: 1,
+	numInt: 2, numSingle: 4, numDouble: 8,
+}
+
+// decodeNumber returns the text of the number constant at the start of
+// data, as LIST shows it, and how many bytes it took.
+func decodeNumber(data []byte) (string, int, error) {
+	c := data[0]
+	if c >= intSmall && c <= intSmall+10 {
+		return strconv.Itoa(int(c - intSmall)), 1, nil
+	}
+	n, ok := numberSize[c]
+	if !ok {
+		return "", 0, fmt.Errorf("unknown number token %#x", c)
+	}
+	if len(data) < 1+n {
+		return "", 0, errTruncated
+	}
+	v := data[1 : 1+n]
+	switch c {
+	case numOctal:
+		return "&O" + strconv.FormatUint(uint64(binary.LittleEndian.Uint16(v)), 8), 1 + n, nil
+	case numHex:
+		return "&H" + strings.ToUpper(strconv.FormatUint(uint64(binary.LittleEndian.Uint16(v)), 16)), 1 + n, nil
+	case numPointer:
+		return "", 0, fmt.Errorf("a jump to a memory address, which only a running program holds")
+	case numLine:
+		return strconv.Itoa(int(binary.LittleEndian.Uint16(v))), 1 + n, nil
+	case numByte:
+		return strconv.Itoa(int(v[0])), 1 + n, nil
+	case numInt:
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(v)))), 1 + n, nil
+	case numSingle:
+		return formatSingle(fromMBF(v)), 1 + n, nil
+	default:
+		return formatDouble(fromMBF(v)), 1 + n, nil
+	}
+}
+
+// decodePlainNumber is decodeNumber for the lexer rather than for LIST:
+// it writes the number in decimal, with no exponent or type, a 0 before
+// the point and a negative one in parentheses. &H and &O constants are
+// 16-bit integers, so &HFFFF is (-1), as in GW-BASIC.
+func decodePlainNumber(data []byte) (string, int, error) {
+	text, n, err := decodeNumber(data)
+	if err != nil {
+		return "", 0, err
+	}
+	v := data[1:n]
+	var f float64
+	bitSize := 64
+	switch data[0] {
+	case numOctal, numHex:
+		f = float64(int16(binary.LittleEndian.Uint16(v)))
+	case numSingle:
+		f, bitSize = fromMBF(v), 32
+	case numDouble:
+		f = fromMBF(v)
+	default:
+		return text, n, nil
+	}
+	text = strconv.FormatFloat(f, 'f', -1, bitSize)
+	if f < 0 {
+		text = "(" + text + ")"
+	}
+	return text, n, nil
+}
+
+// writeChar writes c, a byte of code page 437, as UTF-8.
+func writeChar(b *strings.Builder, c byte) {
+	if c < 0x80 {
+		b.WriteByte(c)
+		return
+	}
+	b.WriteRune(cp437[c-0x80])
+}
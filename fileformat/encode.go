@@ -0,0 +1,363 @@
+package fileformat
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// programStart is the address the links between lines count from, as if
+// the program had been loaded there. GW-BASIC links the lines afresh when
+// it loads a program and only looks for the zero link at the end.
+const programStart = 0x126E
+
+// maxLineNumber is the highest line number GW-BASIC allows.
+const maxLineNumber = 65529
+
+// Encode tokenizes source, program text of numbered lines, as GW-BASIC
+// saves a program, or, with protected set, as SAVE ,P saves it. Lines are
+// written in the order given; blank ones are skipped. Keywords are found
+// as GW-BASIC finds them, at the start of any name, so TOTAL is kept as TO
+// and TAL, which Decode joins again.
+func Encode(source string, protected bool) ([]byte, error) {
+	var body []byte
+	scanner := bufio.NewScanner(strings.NewReader(source))
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		digits := strings.IndexFunc(text, func(r rune) bool { return r < '0' || r > '9' })
+		if digits < 0 {
+			digits = len(text)
+		}
+		if digits == 0 {
+			return nil, fmt.Errorf("%q has no line number", text)
+		}
+		number, err := strconv.Atoi(text[:digits])
+		if err != nil || number > maxLineNumber {
+			return nil, fmt.Errorf("line number %s is past %d", text[:digits], maxLineNumber)
+		}
+		tokens, err := encodeLine(strings.TrimLeft(text[digits:], " "))
+		if err != nil {
+			return nil, lineError(number, "%v", err)
+		}
+		next := programStart + len(body) + 4 + len(tokens) + 1
+		if next > math.MaxUint16 {
+			return nil, fmt.Errorf("program too large for GW-BASIC")
+		}
+		body = binary.LittleEndian.AppendUint16(body, uint16(next))
+		body = binary.LittleEndian.AppendUint16(body, uint16(number))
+		body = append(append(body, tokens...), 0)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	body = append(body, 0, 0)
+
+	header := byte(headerPlain)
+	if protected {
+		header = headerProtected
+		body = protect(body)
+	}
+	return append(append([]byte{header}, body...), endOfFile), nil
+}
+
+// wordKeywords are the keywords that start with a letter, longest first,
+// so that the longest one a name starts with is found first.
+var wordKeywords = func() []string {
+	var words []string
+	for _, keyword := range keywords {
+		if keyword[0] >= 'A' && keyword[0] <= 'Z' {
+			words = append(words, keyword)
+		}
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if len(words[i]) != len(words[j]) {
+			return len(words[i]) > len(words[j])
+		}
+		return words[i] < words[j]
+	})
+	return words
+}()
+
+// tokenOf is the token for each keyword.
+var tokenOf = func() map[string]uint16 {
+	tokens := make(map[string]uint16, len(keywords))
+	for tok, keyword := range keywords {
+		tokens[keyword] = tok
+	}
+	return tokens
+}()
+
+// encodeLine tokenizes the text of one line, after its number.
+func encodeLine(text string) ([]byte, error) {
+	var out []byte
+	// lineNumbers is set after a keyword such as GOTO, for the numbers
+	// that follow it, and kept over the spaces, commas and dashes between
+	// them, as in ON X GOTO 10, 20 and LIST 10-20.
+	lineNumbers := false
+	src := []rune(text)
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '"':
+			end := i + 1
+			for end < len(src) && src[end] != '"' {
+				end++
+			}
+			if end < len(src) {
+				end++
+			}
+			b, err := encodeChars(src[i:end])
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+			i = end
+			continue
+		case c == '\'':
+			b, err := encodeChars(src[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			return append(append(out, ':', tokRem, tokQuote), b...), nil
+		case c == ' ' || c == ',':
+			out = append(out, byte(c))
+			i++
+			continue
+		case c == '-' && lineNumbers:
+			out = append(out, byte(tokenOf["-"]))
+			i++
+			continue
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			end := numberEnd(src, i)
+			b, err := encodeNumber(string(src[i:end]), lineNumbers)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, b...)
+			i = end
+			continue
+		case c == '&':
+			end := i + 1
+			base, prefix := 8, ""
+			if end < len(src) && (unicode.ToUpper(src[end]) == 'H' || unicode.ToUpper(src[end]) == 'O') {
+				prefix = string(unicode.ToUpper(src[end]))
+				if prefix == "H" {
+					base = 16
+				}
+				end++
+			}
+			start := end
+			for end < len(src) && isDigit(src[end], base) {
+				end++
+			}
+			v, err := strconv.ParseUint(string(src[start:end]), base, 16)
+			if err != nil {
+				return nil, fmt.Errorf("bad number &%s%s", prefix, string(src[start:end]))
+			}
+			tok := byte(numOctal)
+			if base == 16 {
+				tok = numHex
+			}
+			out = binary.LittleEndian.AppendUint16(append(out, tok), uint16(v))
+			i = end
+		case unicode.IsLetter(c) && c < 0x80:
+			keyword := keywordAt(src[i:])
+			if keyword == "" {
+				end := i
+				for end < len(src) && src[end] < 0x80 && (unicode.IsLetter(src[end]) || unicode.IsDigit(src[end]) || src[end] == '.') {
+					end++
+				}
+				if end < len(src) && strings.ContainsRune("$%!#", src[end]) {
+					end++
+				}
+				out = append(out, strings.ToUpper(string(src[i:end]))...)
+				i = end
+				break
+			}
+			i += len(keyword)
+			tok := tokenOf[keyword]
+			switch tok {
+			case tokElse:
+				out = append(out, ':', tokElse)
+			case tokWhile:
+				out = append(out, tokWhile, tokPlus)
+			default:
+				if tok > 0xFF {
+					out = append(out, byte(tok>>8))
+				}
+				out = append(out, byte(tok))
+			}
+			if tok == tokRem || tok == tokData {
+				rest := src[i:]
+				if tok == tokData {
+					rest = src[i:dataEnd(src, i)]
+				}
+				b, err := encodeChars(rest)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, b...)
+				i += len(rest)
+			}
+			lineNumbers = lineKeyword(tok)
+			continue
+		default:
+			if tok, ok := tokenOf[string(c)]; ok {
+				out = append(out, byte(tok))
+			} else {
+				b, err := encodeChars(src[i : i+1])
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, b...)
+			}
+			i++
+		}
+		lineNumbers = false
+	}
+	return out, nil
+}
+
+// keywordAt returns the longest keyword src starts with, in capitals, or
+// "" if it starts with none.
+func keywordAt(src []rune) string {
+	upper := strings.ToUpper(string(src))
+	for _, keyword := range wordKeywords {
+		if strings.HasPrefix(upper, keyword) {
+			return keyword
+		}
+	}
+	return ""
+}
+
+// dataEnd returns where the DATA statement whose items start at i ends:
+// at a colon outside quotes, or the end of the line.
+func dataEnd(src []rune, i int) int {
+	quoted := false
+	for ; i < len(src); i++ {
+		switch {
+		case src[i] == '"':
+			quoted = !quoted
+		case src[i] == ':' && !quoted:
+			return i
+		}
+	}
+	return i
+}
+
+// numberEnd returns where the number that starts at i ends: after its
+// digits and point, its exponent and its type, if it has them.
+func numberEnd(src []rune, i int) int {
+	for i < len(src) && (isDigit(src[i], 10) || src[i] == '.') {
+		i++
+	}
+	if i < len(src) && (src[i] == 'E' || src[i] == 'e' || src[i] == 'D' || src[i] == 'd') {
+		j := i + 1
+		if j < len(src) && (src[j] == '+' || src[j] == '-') {
+			j++
+		}
+		if j < len(src) && isDigit(src[j], 10) {
+			for i = j; i < len(src) && isDigit(src[i], 10); i++ {
+			}
+		}
+	}
+	if i < len(src) && strings.ContainsRune("%!#", src[i]) {
+		i++
+	}
+	return i
+}
+
+func isDigit(r rune, base int) bool {
+	switch {
+	case r >= '0' && r <= '7':
+		return true
+	case r == '8' || r == '9':
+		return base >= 10
+	}
+	r = unicode.ToUpper(r)
+	return base == 16 && r >= 'A' && r <= 'F'
+}
+
+// encodeNumber tokenizes the number text as GW-BASIC does: as a line
+// number after GOTO and the like; as an integer when it is a whole number
+// that fits in one with no point, exponent or type to say otherwise; as a
+// double with a D exponent, a # or more than seven digits; and otherwise
+// as a single.
+func encodeNumber(text string, lineNumber bool) ([]byte, error) {
+	suffix := text[len(text)-1]
+	digits := text
+	if strings.ContainsRune("%!#", rune(suffix)) {
+		digits = text[:len(text)-1]
+	} else {
+		suffix = 0
+	}
+	upper := strings.ToUpper(digits)
+	double := suffix == '#' || strings.Contains(upper, "D")
+	v, err := strconv.ParseFloat(strings.Replace(upper, "D", "E", 1), 64)
+	if err != nil {
+		return nil, fmt.Errorf("bad number %s", text)
+	}
+	whole := !strings.ContainsAny(upper, ".ED")
+
+	switch {
+	case lineNumber && whole && suffix == 0 && v <= maxLineNumber:
+		return binary.LittleEndian.AppendUint16([]byte{numLine}, uint16(v)), nil
+	case suffix == '%' || whole && suffix == 0 && v <= math.MaxInt16:
+		if v > math.MaxInt16 || !whole {
+			return nil, fmt.Errorf("%s does not fit in an integer", text)
+		}
+		switch {
+		case v <= 10:
+			return []byte{intSmall + byte(v)}, nil
+		case v <= 255:
+			return []byte{numByte, byte(v)}, nil
+		}
+		return binary.LittleEndian.AppendUint16([]byte{numInt}, uint16(v)), nil
+	}
+	if !double && suffix != '!' && significantDigits(strings.SplitN(upper, "E", 2)[0]) > 7 {
+		double = true
+	}
+	tok, size := byte(numSingle), 4
+	if double {
+		tok, size = numDouble, 8
+	}
+	b, ok := toMBF(v, size)
+	if !ok {
+		return nil, fmt.Errorf("%s is too large", text)
+	}
+	return append([]byte{tok}, b...), nil
+}
+
+// encodeChars writes runes in code page 437.
+func encodeChars(runes []rune) ([]byte, error) {
+	out := make([]byte, 0, len(runes))
+	for _, r := range runes {
+		if r < 0x80 {
+			out = append(out, byte(r))
+			continue
+		}
+		b, ok := cp437Byte[r]
+		if !ok {
+			return nil, fmt.Errorf("%q cannot be written in code page 437", r)
+		}
+		out = append(out, b)
+	}
+	return out, nil
+}
+
+// cp437Byte is the byte of code page 437 for each character of cp437.
+var cp437Byte = func() map[rune]byte {
+	bytes := make(map[rune]byte, len(cp437))
+	for i, r := range cp437 {
+		bytes[r] = byte(0x80 + i)
+	}
+	return bytes
+}()
@@ -0,0 +1,78 @@
+// Package fileformat reads and writes programs in the tokenized form
+// GW-BASIC and BASICA save them in by default, so that programs archived
+// only in that form can be loaded, and programs written here taken back.
+//
+// A tokenized file starts with 0xFF, or 0xFE if it was saved with SAVE ,P
+// and is protected, its lines encrypted so that GW-BASIC will run but not
+// list them. Then come the lines, each a link to the next, its line number
+// and its text with the keywords and numbers tokenized, ending in a zero
+// byte, and a zero link after the last. Text past ASCII is in code page
+// 437, which Decode turns into UTF-8 and Encode back.
+package fileformat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The first byte of a tokenized file.
+const (
+	headerPlain     = 0xFF
+	headerProtected = 0xFE
+)
+
+// endOfFile is the byte GW-BASIC writes after the program, as DOS text
+// files end.
+const endOfFile = 0x1A
+
+// ErrNotTokenized is returned by Decode for data that does not start as a
+// tokenized program does.
+var ErrNotTokenized = errors.New("not a tokenized GW-BASIC program")
+
+// IsTokenized reports whether data starts as a tokenized program does,
+// protected or not, rather than as program text, which cannot start with
+// either byte.
+func IsTokenized(data []byte) bool {
+	return len(data) > 0 && (data[0] == headerPlain || data[0] == headerProtected)
+}
+
+// The keys GW-BASIC encrypts protected programs with: each byte is
+// combined with the bytes of both at its place in the file, so the pattern
+// repeats every 13 times 11 bytes.
+var (
+	protectKey13 = [13]byte{0xA9, 0x84, 0x8D, 0xCD, 0x75, 0x83, 0x43, 0x63, 0x24, 0x83, 0x19, 0xF7, 0x9A}
+	protectKey11 = [11]byte{0x1E, 0x1D, 0xC4, 0x77, 0x26, 0x97, 0xE0, 0x74, 0x59, 0x88, 0x7C}
+)
+
+// unprotect decrypts the lines of a protected program, which follow its
+// header.
+func unprotect(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, c := range data {
+		n := i % (13 * 11)
+		c -= byte(11 - n%11)
+		c ^= protectKey13[n%13] ^ protectKey11[n%11]
+		c += byte(13 - n%13)
+		out[i] = c
+	}
+	return out
+}
+
+// protect encrypts the lines of a program as SAVE ,P does; unprotect
+// undoes it.
+func protect(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, c := range data {
+		n := i % (13 * 11)
+		c -= byte(13 - n%13)
+		c ^= protectKey13[n%13] ^ protectKey11[n%11]
+		c += byte(11 - n%11)
+		out[i] = c
+	}
+	return out
+}
+
+// lineError is an error in the numbered line of a program.
+func lineError(line int, format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,81 @@
+package fileformat
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+func TestDecodeSourceNumbers(t *testing.T) {
+	tests := []struct {
+		src, list, plain string
+	}{
+		{"10 PRINT .25", "10 PRINT .25\n", "10 PRINT 0.25\n"},
+		{"10 PRINT 1500#", "10 PRINT 1500#\n", "10 PRINT 1500\n"},
+		{"10 PRINT &H1F; &O17", "10 PRINT &H1F; &O17\n", "10 PRINT 31; 15\n"},
+		{"10 PRINT 1E+10", "10 PRINT 1E+10\n", "10 PRINT 10000000000\n"},
+		{"10 PRINT 1D-5", "10 PRINT 1D-05\n", "10 PRINT 0.00001\n"},
+		{"10 LET X = 2 * &HFFFF", "10 LET X = 2 * &HFFFF\n", "10 LET X = 2 * (-1)\n"},
+		{"10 GOTO 100: PRINT 12345; 7", "10 GOTO 100: PRINT 12345; 7\n", "10 GOTO 100: PRINT 12345; 7\n"},
+	}
+	for _, tt := range tests {
+		data, err := Encode(tt.src, false)
+		if err != nil {
+			t.Fatalf("encode %q: %v", tt.src, err)
+		}
+		if got, err := Decode(data); err != nil || got != tt.list {
+			t.Errorf("Decode(%q) = %q, %v, want %q", tt.src, got, err, tt.list)
+		}
+		got, err := DecodeSource(data)
+		if err != nil || got != tt.plain {
+			t.Errorf("DecodeSource(%q) = %q, %v, want %q", tt.src, got, err, tt.plain)
+			continue
+		}
+		parse(t, tt.src, got)
+	}
+}
+
+// TestRoundTripExamples saves each example tokenized, plain and protected,
+// loads it back and checks that it parses to the same program. GW-BASIC
+// keeps names in capitals, so case is not compared.
+func TestRoundTripExamples(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*.bas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := parse(t, file, string(src))
+		for _, protected := range []bool{false, true} {
+			data, err := Encode(string(src), protected)
+			if err != nil {
+				t.Fatalf("%s: encode: %v", file, err)
+			}
+			text, err := DecodeSource(data)
+			if err != nil {
+				t.Fatalf("%s: decode: %v", file, err)
+			}
+			if got := parse(t, file, text); !strings.EqualFold(got, want) {
+				t.Errorf("%s (protected %v) loads back as\n%s\nwant\n%s", file, protected, got, want)
+			}
+		}
+	}
+}
+
+// parse parses src and prints it back in canonical form.
+func parse(t *testing.T, name, src string) string {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("%s: parse: %s\n%s", name, strings.Join(errs, "; "), src)
+	}
+	return program.String()
+}
@@ -0,0 +1,112 @@
+package fileformat
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// fromMBF reads a number in Microsoft Binary Format, as GW-BASIC keeps
+// singles, in 4 bytes, and doubles, in 8: the mantissa, low byte first,
+// with the sign in place of its leading 1 bit, then the exponent, biased by
+// 128 and 0 for the number 0.
+func fromMBF(b []byte) float64 {
+	n := len(b) - 1
+	exp := int(b[n])
+	if exp == 0 {
+		return 0
+	}
+	var m uint64
+	for i := n - 1; i >= 0; i-- {
+		m = m<<8 | uint64(b[i])
+	}
+	bits := uint(8 * n)
+	m |= 1 << (bits - 1)
+	v := math.Ldexp(float64(m), exp-128-int(bits))
+	if b[n-1]&0x80 != 0 {
+		v = -v
+	}
+	return v
+}
+
+// toMBF writes v in Microsoft Binary Format in size bytes, 4 or 8, and
+// reports false if it is too large to.
+func toMBF(v float64, size int) ([]byte, bool) {
+	b := make([]byte, size)
+	if v == 0 {
+		return b, true
+	}
+	n := size - 1
+	bits := uint(8 * n)
+	frac, exp := math.Frexp(math.Abs(v))
+	m := uint64(math.Round(math.Ldexp(frac, int(bits))))
+	if m == 1<<bits {
+		m >>= 1
+		exp++
+	}
+	exp += 128
+	if exp <= 0 {
+		return b, true
+	}
+	if exp > 255 {
+		return nil, false
+	}
+	for i := 0; i < n; i++ {
+		b[i] = byte(m >> (8 * i))
+	}
+	b[n-1] &^= 0x80
+	if v < 0 {
+		b[n-1] |= 0x80
+	}
+	b[n] = byte(exp)
+	return b, true
+}
+
+// formatSingle writes a single as LIST does: with no 0 before the point,
+// and a ! after a whole number that would otherwise read as an integer.
+func formatSingle(v float64) string {
+	s := formatNumber(float64(float32(v)), 32, 7)
+	if !strings.ContainsAny(s, ".E") && math.Abs(v) <= math.MaxInt16 {
+		s += "!"
+	}
+	return s
+}
+
+// formatDouble writes a double as LIST does: with D for its exponent, and
+// a # after one that would otherwise read as a single, having no more than
+// seven digits.
+func formatDouble(v float64) string {
+	s := strings.Replace(formatNumber(v, 64, 16), "E", "D", 1)
+	if !strings.Contains(s, "D") && significantDigits(s) <= 7 {
+		s += "#"
+	}
+	return s
+}
+
+// formatNumber writes v in as few digits as read back as the same number
+// of bitSize bits, with an exponent only if it is smaller than 0.0001 or
+// has more than digits digits before the point, and no 0 before the point.
+func formatNumber(v float64, bitSize, digits int) string {
+	e := strconv.FormatFloat(v, 'e', -1, bitSize)
+	exp, _ := strconv.Atoi(e[strings.IndexByte(e, 'e')+1:])
+	s := strconv.FormatFloat(v, 'f', -1, bitSize)
+	if exp < -4 || exp >= digits {
+		s = strings.ToUpper(e)
+	}
+	if strings.HasPrefix(s, "0.") {
+		s = s[1:]
+	}
+	return s
+}
+
+// significantDigits counts the digits of a number written without an
+// exponent, leaving out the zeros that lead it.
+func significantDigits(s string) int {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+	return len(strings.TrimLeft(digits, "0"))
+}
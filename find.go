@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/basis-ex/parser"
+)
+
+// findLines handles FIND "text" [range], listing every line in the range
+// whose text contains the search string. The quotes may be left off when
+// the text has no spaces.
+func findLines(lines map[int]string, arg string) error {
+	text, rest, err := findArgs(arg)
+	if err != nil {
+		return err
+	}
+	nums, err := linesInRange(lines, rest)
+	if err != nil {
+		return err
+	}
+
+	found := 0
+	for _, num := range nums {
+		if strings.Contains(lineBody(lines[num]), text) {
+			fmt.Println(lines[num])
+			found++
+		}
+	}
+	if found == 0 {
+		fmt.Printf("%q not found\n", text)
+	}
+	return nil
+}
+
+func findArgs(arg string) (string, string, error) {
+	arg = strings.TrimSpace(arg)
+	if strings.HasPrefix(arg, `"`) {
+		end := strings.Index(arg[1:], `"`)
+		if end < 0 {
+			return "", "", fmt.Errorf("missing closing quote")
+		}
+		text := arg[1 : end+1]
+		if text == "" {
+			return "", "", fmt.Errorf("usage: FIND \"text\" [range]")
+		}
+		return text, arg[end+2:], nil
+	}
+	fields := strings.Fields(arg)
+	if len(fields) == 0 {
+		return "", "", fmt.Errorf("usage: FIND \"text\" [range]")
+	}
+	return fields[0], strings.TrimSpace(arg[len(fields[0]):]), nil
+}
+
+// changeLines handles CHANGE /old/new/ [range], replacing every occurrence
+// of old with new in the lines of the range. Any character not used in old
+// or new can stand in for the slashes. Line numbers themselves are never
+// changed. Each modified line is shown, with a warning if it no longer
+// parses.
+func changeLines(lines map[int]string, arg string) error {
+	arg = strings.TrimSpace(arg)
+	if arg == "" {
+		return fmt.Errorf("usage: CHANGE /old/new/ [range]")
+	}
+	delim := arg[:1]
+	parts := strings.SplitN(arg[1:], delim, 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return fmt.Errorf("usage: CHANGE /old/new/ [range]")
+	}
+	old, replacement, rest := parts[0], parts[1], ""
+	if len(parts) == 3 {
+		rest = parts[2]
+	}
+
+	nums, err := linesInRange(lines, rest)
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	for _, num := range nums {
+		body := lineBody(lines[num])
+		if !strings.Contains(body, old) {
+			continue
+		}
+		prefix := lines[num][:len(lines[num])-len(body)]
+		lines[num] = prefix + strings.ReplaceAll(body, old, replacement)
+		fmt.Println(lines[num])
+		changed++
+
+		p := parser.New(newLexer(lines[num]))
+		p.ParseProgram()
+		if len(p.Errors()) > 0 {
+			fmt.Printf("  warning: line %d no longer parses: %s\n", num, strings.Join(p.Errors(), "; "))
+		}
+	}
+	fmt.Printf("%d line(s) changed\n", changed)
+	return nil
+}
+
+// linesInRange returns the stored line numbers in a LIST-style range, in
+// order; an empty range means the whole program.
+func linesInRange(lines map[int]string, rangeArg string) ([]int, error) {
+	start, end, hasRange, err := parseListArgs(rangeArg)
+	if err != nil {
+		return nil, err
+	}
+	nums := sortedLineNumbers(lines)
+	if !hasRange {
+		return nums, nil
+	}
+	nums = nums[sort.SearchInts(nums, start):]
+	for i, num := range nums {
+		if end != -1 && num > end {
+			return nums[:i], nil
+		}
+	}
+	return nums, nil
+}
+
+// lineBody returns a stored line without its leading line number.
+func lineBody(line string) string {
+	return strings.TrimLeftFunc(line, unicode.IsDigit)
+}
@@ -0,0 +1,209 @@
+package graphics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxShapes is how many points, lines and circles a Canvas keeps before
+// refusing more, so a program drawing in an endless loop runs out of
+// memory as BASIC does rather than as the process does.
+const MaxShapes = 1 << 20
+
+// ErrTooManyShapes is returned by a Canvas asked to draw past MaxShapes.
+var ErrTooManyShapes = errors.New("too much drawn on one screen")
+
+// Canvas is a Backend that keeps what is drawn as a list of shapes, so
+// that it can be saved either as an SVG of those shapes, which stays sharp
+// at any size, or as a PNG of the pixels they cover.
+type Canvas struct {
+	width, height int
+	shapes        []shape
+}
+
+type shapeKind int
+
+const (
+	point shapeKind = iota
+	line
+	circle
+)
+
+// shape is a point at x1, y1; a line from x1, y1 to x2, y2; or a circle
+// centred on x1, y1 with radius r.
+type shape struct {
+	kind           shapeKind
+	x1, y1, x2, y2 int
+	r              int
+	color          int
+}
+
+// NewCanvas returns a Canvas with no screen yet.
+func NewCanvas() *Canvas {
+	return &Canvas{}
+}
+
+func (c *Canvas) Screen(width, height int) error {
+	c.width, c.height = width, height
+	c.shapes = nil
+	return nil
+}
+
+func (c *Canvas) Plot(x, y, color int) error {
+	return c.add(shape{kind: point, x1: x, y1: y, color: color})
+}
+
+func (c *Canvas) Line(x1, y1, x2, y2, color int) error {
+	return c.add(shape{kind: line, x1: x1, y1: y1, x2: x2, y2: y2, color: color})
+}
+
+func (c *Canvas) Circle(x, y, radius, color int) error {
+	return c.add(shape{kind: circle, x1: x, y1: y, r: radius, color: color})
+}
+
+func (c *Canvas) add(s shape) error {
+	if c.width == 0 {
+		return ErrNoScreen
+	}
+	if len(c.shapes) >= MaxShapes {
+		return ErrTooManyShapes
+	}
+	c.shapes = append(c.shapes, s)
+	return nil
+}
+
+// Save writes the picture as a PNG or an SVG, as the extension of filename
+// says.
+func (c *Canvas) Save(filename string) error {
+	if c.width == 0 {
+		return ErrNoScreen
+	}
+	var write func(io.Writer) error
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".png":
+		write = func(w io.Writer) error { return png.Encode(w, c.Image()) }
+	case ".svg":
+		write = c.WriteSVG
+	default:
+		return fmt.Errorf("cannot save a picture as %q; use .png or .svg", ext)
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Image draws the picture's pixels.
+func (c *Canvas) Image() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, c.width, c.height), Palette)
+	for _, s := range c.shapes {
+		set := func(x, y int) { img.SetColorIndex(x, y, uint8(s.color)) }
+		switch s.kind {
+		case point:
+			set(s.x1, s.y1)
+		case line:
+			rasterLine(s.x1, s.y1, s.x2, s.y2, set)
+		case circle:
+			rasterCircle(s.x1, s.y1, s.r, set)
+		}
+	}
+	return img
+}
+
+// rasterLine calls set for each pixel of the line from x1, y1 to x2, y2,
+// by Bresenham's algorithm.
+func rasterLine(x1, y1, x2, y2 int, set func(x, y int)) {
+	dx, sx := abs(x2-x1), sign(x2-x1)
+	dy, sy := -abs(y2-y1), sign(y2-y1)
+	err := dx + dy
+	for {
+		set(x1, y1)
+		if x1 == x2 && y1 == y2 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x1 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y1 += sy
+		}
+	}
+}
+
+// rasterCircle calls set for each pixel of the circle around cx, cy of
+// radius r, by the midpoint algorithm, one octant mirrored eight ways.
+func rasterCircle(cx, cy, r int, set func(x, y int)) {
+	x, y := r, 0
+	err := 1 - r
+	for x >= y {
+		for _, p := range [8][2]int{{x, y}, {y, x}, {-y, x}, {-x, y}, {-x, -y}, {-y, -x}, {y, -x}, {x, -y}} {
+			set(cx+p[0], cy+p[1])
+		}
+		y++
+		if err < 0 {
+			err += 2*y + 1
+		} else {
+			x--
+			err += 2*(y-x) + 1
+		}
+	}
+}
+
+// WriteSVG writes the picture as SVG, each shape an element, a pixel wide
+// and centred on the pixels it covers.
+func (c *Canvas) WriteSVG(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %[1]d %[2]d\" shape-rendering=\"crispEdges\">\n", c.width, c.height)
+	fmt.Fprintf(b, "<rect width=\"%d\" height=\"%d\" fill=\"%s\"/>\n", c.width, c.height, hex(0))
+	for _, s := range c.shapes {
+		switch s.kind {
+		case point:
+			fmt.Fprintf(b, "<rect x=\"%d\" y=\"%d\" width=\"1\" height=\"1\" fill=\"%s\"/>\n", s.x1, s.y1, hex(s.color))
+		case line:
+			fmt.Fprintf(b, "<line x1=\"%d.5\" y1=\"%d.5\" x2=\"%d.5\" y2=\"%d.5\" stroke=\"%s\" stroke-linecap=\"square\"/>\n", s.x1, s.y1, s.x2, s.y2, hex(s.color))
+		case circle:
+			fmt.Fprintf(b, "<circle cx=\"%d.5\" cy=\"%d.5\" r=\"%d\" fill=\"none\" stroke=\"%s\"/>\n", s.x1, s.y1, s.r, hex(s.color))
+		}
+	}
+	b.WriteString("</svg>\n")
+	return b.Flush()
+}
+
+// hex writes colour i of Palette as SVG does.
+func hex(i int) string {
+	r, g, b, _ := Palette[i].RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package graphics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// pixels draws c and returns its pixels a row a line, each the hex digit
+// of its colour, with '.' for colour 0.
+func pixels(c *Canvas) string {
+	img := c.Image()
+	var b strings.Builder
+	for y := img.Rect.Min.Y; y < img.Rect.Max.Y; y++ {
+		for x := img.Rect.Min.X; x < img.Rect.Max.X; x++ {
+			if i := img.ColorIndexAt(x, y); i == 0 {
+				b.WriteByte('.')
+			} else {
+				b.WriteByte("0123456789abcdef"[i])
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestCanvasDraws(t *testing.T) {
+	tests := []struct {
+		name string
+		draw func(c *Canvas)
+		want string
+	}{
+		{
+			name: "points",
+			draw: func(c *Canvas) {
+				c.Plot(0, 0, 15)
+				c.Plot(6, 4, 4)
+				c.Plot(3, 2, 1)
+			},
+			want: "" +
+				"f......\n" +
+				".......\n" +
+				"...1...\n" +
+				".......\n" +
+				"......4\n",
+		},
+		{
+			name: "points off the screen",
+			draw: func(c *Canvas) {
+				c.Plot(-1, 0, 15)
+				c.Plot(7, 0, 15)
+				c.Plot(0, 5, 15)
+			},
+			want: "" +
+				".......\n" +
+				".......\n" +
+				".......\n" +
+				".......\n" +
+				".......\n",
+		},
+		{
+			name: "horizontal and vertical lines",
+			draw: func(c *Canvas) {
+				c.Line(1, 0, 5, 0, 2)
+				c.Line(6, 4, 6, 1, 3)
+			},
+			want: "" +
+				".22222.\n" +
+				"......3\n" +
+				"......3\n" +
+				"......3\n" +
+				"......3\n",
+		},
+		{
+			name: "shallow and steep lines",
+			draw: func(c *Canvas) {
+				c.Line(0, 0, 3, 1, 5)
+				c.Line(6, 0, 5, 4, 6)
+			},
+			want: "" +
+				"55....6\n" +
+				"..55..6\n" +
+				".....6.\n" +
+				".....6.\n" +
+				".....6.\n",
+		},
+		{
+			name: "line running off the screen",
+			draw: func(c *Canvas) {
+				c.Line(-2, 2, 20, 2, 7)
+			},
+			want: "" +
+				".......\n" +
+				".......\n" +
+				"7777777\n" +
+				".......\n" +
+				".......\n",
+		},
+		{
+			name: "later shapes draw over earlier ones",
+			draw: func(c *Canvas) {
+				c.Line(0, 1, 6, 1, 1)
+				c.Plot(3, 1, 14)
+			},
+			want: "" +
+				".......\n" +
+				"111e111\n" +
+				".......\n" +
+				".......\n" +
+				".......\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCanvas()
+			if err := c.Screen(7, 5); err != nil {
+				t.Fatal(err)
+			}
+			tt.draw(c)
+			if got := pixels(c); got != tt.want {
+				t.Errorf("drew\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanvasCircles(t *testing.T) {
+	tests := []struct {
+		name    string
+		x, y, r int
+		want    string
+	}{
+		{
+			name: "radius 2",
+			x:    3, y: 3, r: 2,
+			want: "" +
+				".......\n" +
+				"..###..\n" +
+				".#...#.\n" +
+				".#...#.\n" +
+				".#...#.\n" +
+				"..###..\n" +
+				".......\n",
+		},
+		{
+			name: "radius 3",
+			x:    3, y: 3, r: 3,
+			want: "" +
+				"..###..\n" +
+				".#...#.\n" +
+				"#.....#\n" +
+				"#.....#\n" +
+				"#.....#\n" +
+				".#...#.\n" +
+				"..###..\n",
+		},
+		{
+			name: "radius 0 is a point",
+			x:    3, y: 3, r: 0,
+			want: "" +
+				".......\n" +
+				".......\n" +
+				".......\n" +
+				"...#...\n" +
+				".......\n" +
+				".......\n" +
+				".......\n",
+		},
+		{
+			name: "clipped at the corner",
+			x:    0, y: 0, r: 2,
+			want: "" +
+				"..#....\n" +
+				"..#....\n" +
+				"##.....\n" +
+				".......\n" +
+				".......\n" +
+				".......\n" +
+				".......\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCanvas()
+			c.Screen(7, 7)
+			if err := c.Circle(tt.x, tt.y, tt.r, 15); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.ReplaceAll(pixels(c), "f", "#")
+			if got != tt.want {
+				t.Errorf("drew\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanvasScreen(t *testing.T) {
+	c := NewCanvas()
+	for _, draw := range []func() error{
+		func() error { return c.Plot(0, 0, 1) },
+		func() error { return c.Line(0, 0, 1, 1, 1) },
+		func() error { return c.Circle(0, 0, 1, 1) },
+		func() error { return c.Save("picture.png") },
+	} {
+		if err := draw(); !errors.Is(err, ErrNoScreen) {
+			t.Errorf("drawing before SCREEN = %v, want ErrNoScreen", err)
+		}
+	}
+
+	c.Screen(3, 2)
+	c.Line(0, 0, 2, 1, 9)
+	c.Screen(2, 2)
+	if got, want := pixels(c), "..\n..\n"; got != want {
+		t.Errorf("SCREEN again left\n%s", got)
+	}
+}
+
+func TestCanvasWriteSVG(t *testing.T) {
+	c := NewCanvas()
+	c.Screen(10, 8)
+	c.Plot(1, 2, 15)
+	c.Line(0, 0, 9, 7, 4)
+	c.Circle(5, 4, 3, 2)
+	var b strings.Builder
+	if err := c.WriteSVG(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`width="10" height="8"`,
+		`<rect x="1" y="2" width="1" height="1" fill="#ffffff"/>`,
+		`<line x1="0.5" y1="0.5" x2="9.5" y2="7.5" stroke="#aa0000"`,
+		`<circle cx="5.5" cy="4.5" r="3" fill="none" stroke="#00aa00"/>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("SVG has no %s:\n%s", want, b.String())
+		}
+	}
+}
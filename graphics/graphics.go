@@ -0,0 +1,41 @@
+// Package graphics is what the graphics statements SCREEN, PLOT, LINE,
+// CIRCLE and SCREENSAVE draw on. They go through Backend, so a program
+// embedding the interpreter can draw them its own way, say on a window or
+// an HTML canvas; Canvas, the Backend the interpreter uses unless told
+// otherwise, keeps the picture in memory to save as PNG or SVG.
+package graphics
+
+import (
+	"errors"
+	"image/color"
+)
+
+// Backend draws what the graphics statements ask for. Screen starts a
+// picture width by height pixels, cleared to colour 0, and comes before
+// anything else. Coordinates count from the top left pixel, 0, 0, and may
+// fall outside the picture, which shows only the part inside. Colours are
+// indexes into Palette. Save writes the picture to the file filename.
+type Backend interface {
+	Screen(width, height int) error
+	Plot(x, y, color int) error
+	Line(x1, y1, x2, y2, color int) error
+	Circle(x, y, radius, color int) error
+	Save(filename string) error
+}
+
+// Palette is the 16 colours of the CGA palette GW-BASIC draws with: black,
+// blue, green, cyan, red, magenta, brown and white, then their bright
+// versions.
+var Palette = color.Palette{
+	color.RGBA{0x00, 0x00, 0x00, 0xFF}, color.RGBA{0x00, 0x00, 0xAA, 0xFF},
+	color.RGBA{0x00, 0xAA, 0x00, 0xFF}, color.RGBA{0x00, 0xAA, 0xAA, 0xFF},
+	color.RGBA{0xAA, 0x00, 0x00, 0xFF}, color.RGBA{0xAA, 0x00, 0xAA, 0xFF},
+	color.RGBA{0xAA, 0x55, 0x00, 0xFF}, color.RGBA{0xAA, 0xAA, 0xAA, 0xFF},
+	color.RGBA{0x55, 0x55, 0x55, 0xFF}, color.RGBA{0x55, 0x55, 0xFF, 0xFF},
+	color.RGBA{0x55, 0xFF, 0x55, 0xFF}, color.RGBA{0x55, 0xFF, 0xFF, 0xFF},
+	color.RGBA{0xFF, 0x55, 0x55, 0xFF}, color.RGBA{0xFF, 0x55, 0xFF, 0xFF},
+	color.RGBA{0xFF, 0xFF, 0x55, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+}
+
+// ErrNoScreen is returned by a Backend asked to draw or save before Screen.
+var ErrNoScreen = errors.New("no graphics screen; use SCREEN first")
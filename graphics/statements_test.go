@@ -0,0 +1,41 @@
+package graphics_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/basic"
+	"github.com/basis-ex/graphics"
+)
+
+// TestStatementsDraw runs the graphics statements of a program onto a
+// small Canvas and checks the pixels they set.
+func TestStatementsDraw(t *testing.T) {
+	canvas := graphics.NewCanvas()
+	src := "10 SCREEN 7, 5\n" +
+		"20 PLOT 0, 0\n" +
+		"30 PLOT 6, 0, 1\n" +
+		"40 LINE (0, 4)-(6, 4), 2\n" +
+		"50 CIRCLE (3, 2), 1, 4\n"
+	if _, err := basic.Eval(context.Background(), src, basic.WithGraphics(canvas)); err != nil {
+		t.Fatal(err)
+	}
+	img := canvas.Image()
+	var b strings.Builder
+	for y := 0; y < img.Rect.Dy(); y++ {
+		for x := 0; x < img.Rect.Dx(); x++ {
+			b.WriteByte(".123456789abcdef"[img.ColorIndexAt(x, y)])
+		}
+		b.WriteByte('\n')
+	}
+	want := "" +
+		"f.....1\n" +
+		"...4...\n" +
+		"..4.4..\n" +
+		"...4...\n" +
+		"2222222\n"
+	if b.String() != want {
+		t.Errorf("drew\n%s\nwant\n%s", b.String(), want)
+	}
+}
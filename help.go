@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/basis-ex/catalog"
+)
+
+// showHelp handles HELP. With no argument it lists every keyword by kind;
+// HELP keyword shows its syntax and what it does.
+func showHelp(arg string) error {
+	if arg == "" {
+		for _, kind := range catalog.Kinds {
+			fmt.Printf("%ss:\n", strings.ToUpper(string(kind[:1]))+string(kind[1:]))
+			fmt.Printf("  %s\n", strings.Join(catalog.Names(kind), " "))
+		}
+		fmt.Println("Type HELP <keyword> for details.")
+		return nil
+	}
+
+	entry, ok := catalog.Lookup(arg)
+	if !ok {
+		return fmt.Errorf("no help for %s", arg)
+	}
+	fmt.Printf("%s (%s)\n  %s\n", entry.Syntax, entry.Kind, entry.Summary)
+	return nil
+}
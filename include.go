@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/fileformat"
+	"github.com/basis-ex/parser"
+)
+
+// includer merges %INCLUDE'd files into one program. Every numbered line
+// remembers the file and line it came from so clashes and syntax errors can
+// be reported against the file the user actually needs to edit.
+type includer struct {
+	origins map[int]origin
+	active  []string
+	out     strings.Builder
+}
+
+type origin struct {
+	file  string
+	where string
+}
+
+// readProgram loads a BASIC source file, expanding include directives:
+//
+//	%INCLUDE "lib.bas"
+//	100 REM $INCLUDE: "lib.bas"
+//
+// The included file's numbered lines are merged into the program. Paths are
+// relative to the including file, and a file that (directly or indirectly)
+// includes itself is an error.
+func readProgram(filename string) (string, error) {
+	inc := &includer{origins: make(map[int]origin)}
+	if err := inc.load(filename, ""); err != nil {
+		return "", err
+	}
+	return inc.out.String(), nil
+}
+
+// readProgramSource is readProgram for program text that did not come from
+// a file, such as standard input or -e. name labels it in error messages,
+// and included files are found relative to the current directory.
+func readProgramSource(name, content string) (string, error) {
+	inc := &includer{origins: make(map[int]origin)}
+	if err := inc.expand(name, name, content); err != nil {
+		return "", err
+	}
+	return inc.out.String(), nil
+}
+
+func (inc *includer) load(filename, from string) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		abs = filename
+	}
+	for _, open := range inc.active {
+		if open == abs {
+			chain := append(append([]string{}, inc.active...), abs)
+			for i := range chain {
+				chain[i] = filepath.Base(chain[i])
+			}
+			return fmt.Errorf("%s: include cycle: %s", from, strings.Join(chain, " -> "))
+		}
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		if from != "" {
+			return fmt.Errorf("%s: %v", from, err)
+		}
+		return err
+	}
+	if fileformat.IsTokenized(content) {
+		text, err := fileformat.DecodeSource(content)
+		if err != nil {
+			return fmt.Errorf("%s: %v", filename, err)
+		}
+		content = []byte(text)
+	}
+	return inc.expand(filename, abs, string(content))
+}
+
+// expand merges the lines of one source, read from filename, into the
+// program. abs identifies the source for cycle detection.
+func (inc *includer) expand(filename, abs, content string) error {
+	inc.active = append(inc.active, abs)
+	defer func() { inc.active = inc.active[:len(inc.active)-1] }()
+
+	included := len(inc.active) > 1
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		text := scanner.Text()
+		where := fmt.Sprintf("%s:%d", filename, lineNo)
+
+		num, hasNum, rest := splitLineNumber(text)
+		if target, ok := includeTarget(rest); ok {
+			if hasNum {
+				if err := inc.claim(num, filename, where); err != nil {
+					return err
+				}
+				fmt.Fprintf(&inc.out, "%d REM included %s\n", num, target)
+			}
+			path := target
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			if err := inc.load(path, where); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if included && strings.TrimSpace(text) != "" {
+			if !hasNum {
+				return fmt.Errorf("%s: included files may only contain numbered lines", where)
+			}
+			p := parser.New(newLexer(text))
+			p.ParseProgram()
+			if errs := p.Errors(); len(errs) > 0 {
+				return fmt.Errorf("%s: %s", where, strings.Join(errs, "; "))
+			}
+		}
+		if hasNum {
+			if err := inc.claim(num, filename, where); err != nil {
+				return err
+			}
+		}
+
+		inc.out.WriteString(text)
+		inc.out.WriteByte('\n')
+	}
+
+	return scanner.Err()
+}
+
+// claim records that a line number is defined at where, failing if a
+// different file already defined it. Within one file a later line simply
+// replaces an earlier one with the same number, as it always has.
+func (inc *includer) claim(num int, file, where string) error {
+	if other, ok := inc.origins[num]; ok && other.file != file {
+		return fmt.Errorf("%s: line %d already defined at %s", where, num, other.where)
+	}
+	inc.origins[num] = origin{file: file, where: where}
+	return nil
+}
+
+// splitLineNumber separates a leading BASIC line number from the rest of
+// the text.
+func splitLineNumber(text string) (int, bool, string) {
+	trimmed := strings.TrimSpace(text)
+	end := 0
+	for end < len(trimmed) && trimmed[end] >= '0' && trimmed[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return 0, false, trimmed
+	}
+	num, err := strconv.Atoi(trimmed[:end])
+	if err != nil {
+		return 0, false, trimmed
+	}
+	return num, true, strings.TrimSpace(trimmed[end:])
+}
+
+// includeTarget recognises %INCLUDE "file" and REM $INCLUDE: "file" and
+// returns the quoted file name.
+func includeTarget(stmt string) (string, bool) {
+	upper := strings.ToUpper(stmt)
+	var rest string
+	switch {
+	case strings.HasPrefix(upper, "%INCLUDE"):
+		rest = stmt[len("%INCLUDE"):]
+	case strings.HasPrefix(upper, "REM"):
+		after := strings.TrimSpace(stmt[len("REM"):])
+		if !strings.HasPrefix(strings.ToUpper(after), "$INCLUDE") {
+			return "", false
+		}
+		rest = strings.TrimPrefix(after[len("$INCLUDE"):], ":")
+	default:
+		return "", false
+	}
+
+	rest = strings.TrimSpace(rest)
+	if len(rest) < 2 || (rest[0] != '"' && rest[0] != '\'') {
+		return "", false
+	}
+	end := strings.IndexByte(rest[1:], rest[0])
+	if end < 0 {
+		return "", false
+	}
+	return rest[1 : end+1], true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/basis-ex/evaluator"
+)
+
+// catchInterrupts turns Ctrl-C into a call to eval.Interrupt, so that a
+// runaway program stops with "Break in line N" instead of killing the
+// interpreter, until the returned function is called. eval is an
+// *evaluator.Evaluator or a *vm.Machine.
+func catchInterrupts(eval interface{ Interrupt() }) (release func()) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-sigs:
+				eval.Interrupt()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// execute calls run, which is eval.Run or eval.Continue, with Ctrl-C
+// caught. It reports whether the program broke off and can be continued
+// with CONT.
+func execute(eval *evaluator.Evaluator, run func(context.Context) error) bool {
+	release := catchInterrupts(eval)
+	err := run(context.Background())
+	release()
+
+	var brk *evaluator.BreakError
+	if errors.As(err, &brk) {
+		fmt.Println()
+		fmt.Println(brk)
+		return true
+	}
+	if err != nil {
+		reportRuntimeError(err)
+	}
+	return false
+}
+
+// reportRuntimeError prints a program's error on stderr, followed for a
+// BASIC runtime error by its code and the line that failed, with the
+// statement that failed marked.
+func reportRuntimeError(err error) {
+	fmt.Fprintf(os.Stderr, "Runtime error: %v\n", err)
+	var rt *evaluator.RuntimeError
+	if errors.As(err, &rt) && rt.Source != "" {
+		fmt.Fprintf(os.Stderr, "  %s  [error %d: %v]\n", rt.Source, rt.Code, rt.Code)
+		if rt.Column > 0 && rt.EndColumn > rt.Column {
+			fmt.Fprintf(os.Stderr, "  %s\n", marker(rt.Source, rt.Column, rt.EndColumn))
+		}
+	}
+}
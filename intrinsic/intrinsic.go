@@ -0,0 +1,94 @@
+// Package intrinsic lists the built-in functions, with the arguments each
+// takes, for the parser and every backend to share. Each backend supplies
+// its own implementation of the functions and checks it against the list
+// with Check when it starts, so a function added in one place cannot be
+// missing, or take different arguments, in another.
+package intrinsic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Function is a built-in function taking between Min and Max arguments.
+type Function struct {
+	Name     string
+	Min, Max int
+}
+
+// Functions are the built-in functions. TIMER is also a statement keyword,
+// so unlike the others its name is not read as an identifier.
+var Functions = []Function{
+	{"UCASE$", 1, 1},
+	{"LCASE$", 1, 1},
+	{"LTRIM$", 1, 1},
+	{"RTRIM$", 1, 1},
+	{"TRIM$", 1, 1},
+	{"ENVIRON$", 1, 1},
+	{"COMMAND$", 0, 1},
+	{"PEEK", 1, 1},
+	{"LOF", 1, 1},
+	{"INPUT$", 1, 2},
+	{"TIMER", 0, 0},
+	{"ROUND", 1, 2},
+	{"FIX", 1, 1},
+	{"MIN", 2, 2},
+	{"MAX", 2, 2},
+}
+
+var byName = map[string]Function{}
+
+func init() {
+	for _, fn := range Functions {
+		byName[fn.Name] = fn
+	}
+}
+
+// Lookup finds the built-in function called name, in upper case.
+func Lookup(name string) (Function, bool) {
+	fn, ok := byName[name]
+	return fn, ok
+}
+
+// CheckArity reports an error if fn cannot take n arguments.
+func (fn Function) CheckArity(n int) error {
+	if n >= fn.Min && n <= fn.Max {
+		return nil
+	}
+	if fn.Min == fn.Max {
+		return fmt.Errorf("%s expects %d argument(s), got %d", fn.Name, fn.Min, n)
+	}
+	return fmt.Errorf("%s expects %d to %d arguments, got %d", fn.Name, fn.Min, fn.Max, n)
+}
+
+// Check compares the functions a backend implements with Functions: each
+// must be implemented or named in unsupported, and nothing else
+// implemented. The error lists what is wrong, naming the backend.
+func Check(backend string, implemented []string, unsupported ...string) error {
+	seen := map[string]bool{}
+	var unknown, missing []string
+	for _, name := range append(implemented, unsupported...) {
+		if _, ok := byName[name]; !ok {
+			unknown = append(unknown, name)
+		}
+		seen[name] = true
+	}
+	for _, fn := range Functions {
+		if !seen[fn.Name] {
+			missing = append(missing, fn.Name)
+		}
+	}
+	if len(unknown) == 0 && len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing "+strings.Join(missing, ", "))
+	}
+	if len(unknown) > 0 {
+		problems = append(problems, "not built-in functions: "+strings.Join(unknown, ", "))
+	}
+	return fmt.Errorf("intrinsic: %s functions: %s", backend, strings.Join(problems, "; "))
+}
@@ -0,0 +1,10 @@
+package intrinsic
+
+import "embed"
+
+// Source holds this package's Go files, which the runtime of compiled
+// programs needs, so that basic compile -build can build one outside this
+// module.
+//
+//go:embed *.go
+var Source embed.FS
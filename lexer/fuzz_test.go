@@ -0,0 +1,52 @@
+package lexer
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/iotest"
+
+	"github.com/basis-ex/token"
+)
+
+// addExamples seeds f with the programs in examples/.
+func addExamples(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*.bas"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("10 PRINT \"UNENDED\n"))
+	f.Add([]byte("10 A$ = \"X\": B = 1.5E+3 <> &HFF\r\n"))
+}
+
+// FuzzLexer lexes data to the end. Every token takes at least one byte, so
+// lexing fails if it reads more tokens than data has bytes rather than
+// ending. It lexes data a second time through NewReader, a byte per read,
+// and fails too if the two differ.
+func FuzzLexer(f *testing.F) {
+	addExamples(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		whole := New(string(data))
+		chunked := NewReader(iotest.OneByteReader(bytes.NewReader(data)))
+		for n := 0; ; n++ {
+			if n > len(data) {
+				t.Fatalf("%d tokens from %d bytes without reaching EOF", n, len(data))
+			}
+			tok := whole.NextToken()
+			if other := chunked.NextToken(); other != tok {
+				t.Fatalf("token %d is %+v read whole, %+v read a byte at a time", n, tok, other)
+			}
+			if tok.Type == token.EOF {
+				return
+			}
+		}
+	})
+}
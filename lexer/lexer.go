@@ -1,7 +1,10 @@
 package lexer
 
 import (
+	"github.com/basis-ex/dialect"
 	"github.com/basis-ex/token"
+	"io"
+	"sort"
 	"strings"
 	"unicode"
 )
@@ -12,38 +15,176 @@ type Lexer struct {
 	readPosition int
 	ch           byte
 	line         int
+	lineStarts   []int
+	// inRemark is set after a REM, whose comment is read as one token.
+	inRemark bool
+	// dialect is what the source is written in; its BackslashEscapes
+	// says whether strings may contain backslash escapes.
+	dialect dialect.Dialect
+	// problem says what is wrong with the ILLEGAL token being read, and
+	// problems holds what was wrong with those read so far.
+	problem  string
+	problems map[token.Position]string
+
+	// A lexer made by NewReader holds in input only the source from base
+	// on, reading more from r as it goes and dropping what it no longer
+	// needs. Offsets such as position count from the start of the source.
+	r     io.Reader
+	chunk []byte
+	err   error
+	base  int
+	// tokenStart is where the token being read starts.
+	tokenStart int
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input, line: 1}
+	l := &Lexer{input: input, line: 1, lineStarts: []int{0}}
+	l.readChar()
+	return l
+}
+
+// SetDialect makes the lexer read string literals as d does, and a parser
+// made from it read the source as d does. Call it before the first
+// NextToken.
+func (l *Lexer) SetDialect(d dialect.Dialect) {
+	l.dialect = d
+}
+
+// Dialect returns the dialect set with SetDialect.
+func (l *Lexer) Dialect() dialect.Dialect {
+	return l.dialect
+}
+
+// readSize is how much a lexer made by NewReader reads at a time.
+const readSize = 4096
+
+// NewReader returns a lexer that reads its source from r as it needs it,
+// rather than all at once, so a large program is never held whole in
+// memory. It keeps the line being read and the one before it, which is as
+// far back as LineText can go. Use Err to find whether reading failed;
+// the lexer treats a failure as the end of the source.
+func NewReader(r io.Reader) *Lexer {
+	l := &Lexer{r: r, chunk: make([]byte, readSize), line: 1, lineStarts: []int{0}}
 	l.readChar()
 	return l
 }
 
+// Err returns the error, other than io.EOF, that stopped a lexer made by
+// NewReader reading its source, or nil.
+func (l *Lexer) Err() error {
+	return l.err
+}
+
+// more reads the next piece of a streamed source onto input, first
+// dropping the text before offset keep. It reports whether there was more
+// to read.
+func (l *Lexer) more(keep int) bool {
+	if l.r == nil {
+		return false
+	}
+	if keep > l.base {
+		l.input = l.input[keep-l.base:]
+		l.base = keep
+	}
+	for {
+		n, err := l.r.Read(l.chunk)
+		l.input += string(l.chunk[:n])
+		if err != nil {
+			l.r = nil
+			if err != io.EOF {
+				l.err = err
+			}
+			return n > 0
+		}
+		if n > 0 {
+			return true
+		}
+	}
+}
+
+// keep is the offset of the earliest text a streaming lexer still needs:
+// the start of the token being read, or of the line before the current
+// one.
+func (l *Lexer) keep() int {
+	return min(l.tokenStart, l.lineStarts[max(l.line-2, 0)])
+}
+
+// text returns the source from offset from up to offset to.
+func (l *Lexer) text(from, to int) string {
+	return l.input[from-l.base : to-l.base]
+}
+
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0
+	if l.readPosition-l.base < len(l.input) || l.more(l.keep()) {
+		l.ch = l.input[l.readPosition-l.base]
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch = 0
 	}
 	l.position = l.readPosition
 	l.readPosition++
 }
 
 func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
-		return 0
+	if l.readPosition-l.base < len(l.input) || l.more(l.keep()) {
+		return l.input[l.readPosition-l.base]
 	}
-	return l.input[l.readPosition]
+	return 0
 }
 
+// NextToken returns the next token, with the position of its first
+// character and of the one just after it.
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
-
+	l.tokenStart = l.position
 	l.skipWhitespace()
+	line, start := l.line, l.position
+	l.tokenStart = start
+	tok := l.scan()
+	tok.Line = line
+	tok.Column = start - l.lineStarts[line-1] + 1
+	if l.problem != "" {
+		if l.problems == nil {
+			l.problems = make(map[token.Position]string)
+		}
+		l.problems[tok.Pos()] = l.problem
+		l.problem = ""
+	}
+	tok.End = tok.Pos()
+	if tok.Type == token.COMMENT {
+		// A comment ends at its last character, not the spaces after it.
+		tok.End.Column += len(tok.Literal)
+	} else if end := min(l.position, l.base+len(l.input)); end > start {
+		tok.End = l.positionOf(end - 1)
+		tok.End.Column++
+	}
+	return tok
+}
+
+// Problem says what is wrong with the ILLEGAL token the lexer returned at
+// pos, such as "unterminated string", or returns "" for a character that
+// simply starts no token.
+func (l *Lexer) Problem(pos token.Position) string {
+	return l.problems[pos]
+}
+
+// positionOf returns the line and column of a byte offset the lexer has
+// reached.
+func (l *Lexer) positionOf(offset int) token.Position {
+	line := sort.Search(len(l.lineStarts), func(i int) bool { return l.lineStarts[i] > offset })
+	return token.Position{Line: line, Column: offset - l.lineStarts[line-1] + 1}
+}
+
+func (l *Lexer) scan() token.Token {
+	var tok token.Token
 
 	tok.Line = l.line
 
+	if l.inRemark {
+		l.inRemark = false
+		if comment := l.readComment(); comment != "" {
+			return token.Token{Type: token.COMMENT, Literal: comment, Line: l.line}
+		}
+	}
+
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
@@ -91,13 +232,23 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.COLON, l.ch, l.line)
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch, l.line)
+	case '#':
+		tok = newToken(token.HASH, l.ch, l.line)
 	case '"':
+		start := l.position
+		value, closed := l.readString()
+		if !closed {
+			// The string runs to the end of the line, which is left to
+			// end it.
+			l.problem = "unterminated string"
+			return token.Token{Type: token.ILLEGAL, Literal: l.text(start, min(l.position, l.base+len(l.input))), Line: l.line}
+		}
 		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Literal = value
 		tok.Line = l.line
 	case '\n':
 		tok = newToken(token.NEWLINE, l.ch, l.line)
-		l.line++
+		l.newLine()
 	case 0:
 		tok.Literal = ""
 		tok.Type = token.EOF
@@ -107,11 +258,16 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(strings.ToUpper(tok.Literal))
 			tok.Line = l.line
+			l.inRemark = tok.Type == token.REM
 			return tok
 		} else if isDigit(l.ch) {
 			tok.Type = token.NUMBER
 			tok.Literal = l.readNumber()
 			tok.Line = l.line
+			if strings.Count(tok.Literal, ".") > 1 {
+				tok.Type = token.ILLEGAL
+				l.problem = "malformed number " + tok.Literal
+			}
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch, l.line)
@@ -122,6 +278,29 @@ func (l *Lexer) NextToken() token.Token {
 	return tok
 }
 
+// newLine records that the character under the cursor ends a source line.
+func (l *Lexer) newLine() {
+	l.line++
+	l.lineStarts = append(l.lineStarts, l.position+1)
+}
+
+// LineText returns the raw source text of a line the lexer has reached,
+// without its trailing newline. A lexer made by NewReader has only the
+// current line and the one before it, and returns "" for the others.
+func (l *Lexer) LineText(line int) string {
+	if line < 1 || line > len(l.lineStarts) || l.lineStarts[line-1] < l.base {
+		return ""
+	}
+	start := l.lineStarts[line-1]
+	for strings.IndexByte(l.input[start-l.base:], '\n') < 0 && l.more(min(l.keep(), start)) {
+	}
+	text := l.input[start-l.base:]
+	if end := strings.IndexByte(text, '\n'); end >= 0 {
+		text = text[:end]
+	}
+	return strings.TrimRight(text, "\r")
+}
+
 func (l *Lexer) skipWhitespace() {
 	for l.ch == ' ' || l.ch == '\t' || l.ch == '\r' {
 		l.readChar()
@@ -133,7 +312,26 @@ func (l *Lexer) readIdentifier() string {
 	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	// A trailing $ marks a string name, as in A$ or UCASE$.
+	if l.ch == '$' {
+		l.readChar()
+	}
+	return l.text(position, l.position)
+}
+
+// readComment reads the rest of a remark up to the end of the line or a
+// ':' outside quotes, which starts the next statement, and returns it
+// without surrounding spaces.
+func (l *Lexer) readComment() string {
+	position := l.position
+	quoted := false
+	for l.ch != 0 && l.ch != '\n' && (quoted || l.ch != ':') {
+		if l.ch == '"' {
+			quoted = !quoted
+		}
+		l.readChar()
+	}
+	return strings.TrimSpace(l.text(position, l.position))
 }
 
 func (l *Lexer) readNumber() string {
@@ -141,19 +339,80 @@ func (l *Lexer) readNumber() string {
 	for isDigit(l.ch) || l.ch == '.' {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.text(position, l.position)
 }
 
-func (l *Lexer) readString() string {
+// readString reads a string literal up to its closing quote and returns
+// its value: a doubled quote inside it stands for one, as in
+// "SAY ""HI""", and with escapes on, a backslash starts an escape. closed
+// is false if the line ends before the string does.
+func (l *Lexer) readString() (value string, closed bool) {
+	var b strings.Builder
 	l.readChar()
-	position := l.position
-	for l.ch != '"' && l.ch != 0 {
-		if l.ch == '\n' {
-			l.line++
+	for l.ch != 0 && l.ch != '\n' {
+		switch {
+		case l.ch == '"':
+			if l.peekChar() != '"' {
+				return b.String(), true
+			}
+			l.readChar()
+		case l.ch == '\\' && l.dialect.BackslashEscapes:
+			l.readChar()
+			l.readEscape(&b)
+			continue
+		}
+		b.WriteByte(l.ch)
+		l.readChar()
+	}
+	return b.String(), false
+}
+
+// readEscape reads what follows a backslash in a string and writes the
+// character it stands for. An escape it does not know is kept as written.
+func (l *Lexer) readEscape(b *strings.Builder) {
+	switch l.ch {
+	case 'n':
+		b.WriteByte('\n')
+	case 't':
+		b.WriteByte('\t')
+	case 'r':
+		b.WriteByte('\r')
+	case '"', '\\':
+		b.WriteByte(l.ch)
+	case 'x':
+		hi, lo := hexValue(l.peekChar()), -1
+		if hi >= 0 {
+			l.readChar()
+			lo = hexValue(l.peekChar())
+		}
+		if lo < 0 {
+			// Not two hex digits: keep what was read.
+			b.WriteString("\\x")
+			if hi >= 0 {
+				b.WriteByte(l.ch)
+			}
+			l.readChar()
+			return
 		}
 		l.readChar()
+		b.WriteByte(byte(hi<<4 | lo))
+	default:
+		b.WriteByte('\\')
+		return
+	}
+	l.readChar()
+}
+
+func hexValue(ch byte) int {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	case 'A' <= ch && ch <= 'F':
+		return int(ch-'A') + 10
 	}
-	return l.input[position:l.position]
+	return -1
 }
 
 func isLetter(ch byte) bool {
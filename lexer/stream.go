@@ -0,0 +1,94 @@
+package lexer
+
+import "github.com/basis-ex/token"
+
+// TokenSource is anything that produces tokens one at a time, such as a
+// *Lexer.
+type TokenSource interface {
+	NextToken() token.Token
+}
+
+// TokenStream is the lookahead interface shared by tools built on the lexer
+// (formatters, highlighters, dialect importers). Positions are token indexes
+// and stay valid for the life of the stream, so a tool can remember Pos(),
+// try a parse, and Reset() back if it does not pan out.
+type TokenStream interface {
+	// Next returns the current token and advances past it.
+	Next() token.Token
+	// Peek returns the token n places ahead without consuming anything;
+	// Peek(0) is the token the next call to Next will return.
+	Peek(n int) token.Token
+	// Pos reports the index of the token Next will return.
+	Pos() int
+	// Reset moves the stream back (or forward) to a position from Pos.
+	Reset(pos int)
+}
+
+// Stream is a buffering TokenStream over any TokenSource. Tokens are pulled
+// from the source only as far as they are needed; once EOF is reached it is
+// returned for every read past the end.
+type Stream struct {
+	src    TokenSource
+	tokens []token.Token
+	pos    int
+	eof    bool
+}
+
+// NewStream wraps src in a Stream.
+func NewStream(src TokenSource) *Stream {
+	return &Stream{src: src}
+}
+
+// NewTokenStream lexes input and returns a Stream over its tokens.
+func NewTokenStream(input string) *Stream {
+	return NewStream(New(input))
+}
+
+func (s *Stream) Next() token.Token {
+	tok := s.Peek(0)
+	if s.pos < len(s.tokens) {
+		s.pos++
+	}
+	return tok
+}
+
+func (s *Stream) Peek(n int) token.Token {
+	if n < 0 {
+		n = 0
+	}
+	if !s.fill(s.pos + n) {
+		return s.tokens[len(s.tokens)-1]
+	}
+	return s.tokens[s.pos+n]
+}
+
+func (s *Stream) Pos() int {
+	return s.pos
+}
+
+func (s *Stream) Reset(pos int) {
+	if pos < 0 {
+		pos = 0
+	}
+	s.fill(pos)
+	if pos > len(s.tokens) {
+		pos = len(s.tokens)
+	}
+	s.pos = pos
+}
+
+// fill buffers tokens up to and including index i. It reports false when the
+// source ran out first, in which case the last buffered token is EOF.
+func (s *Stream) fill(i int) bool {
+	for len(s.tokens) <= i {
+		if s.eof {
+			return false
+		}
+		tok := s.src.NextToken()
+		s.tokens = append(s.tokens, tok)
+		if tok.Type == token.EOF {
+			s.eof = true
+		}
+	}
+	return true
+}
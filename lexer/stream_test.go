@@ -0,0 +1,65 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/basis-ex/token"
+)
+
+func TestStreamPeekAndNext(t *testing.T) {
+	s := NewTokenStream("10 PRINT X")
+	if got := s.Peek(2).Literal; got != "X" {
+		t.Errorf("Peek(2) is %q, want X", got)
+	}
+	if got := s.Peek(0).Literal; got != "10" {
+		t.Errorf("Peek(0) is %q, want 10", got)
+	}
+	want := []string{"10", "PRINT", "X", ""}
+	for i, lit := range want {
+		if tok := s.Next(); tok.Literal != lit {
+			t.Errorf("token %d is %q, want %q", i, tok.Literal, lit)
+		}
+	}
+	// Past the end every read is the EOF.
+	for i := 0; i < 3; i++ {
+		if tok := s.Next(); tok.Type != token.EOF {
+			t.Errorf("read %d past the end is %v, want EOF", i, tok.Type)
+		}
+	}
+	if tok := s.Peek(10); tok.Type != token.EOF {
+		t.Errorf("Peek(10) is %v, want EOF", tok.Type)
+	}
+}
+
+func TestStreamReset(t *testing.T) {
+	s := NewTokenStream("10 GOTO 20\n20 END")
+	s.Next()
+	mark := s.Pos()
+	for s.Next().Type != token.NEWLINE {
+	}
+	if got := s.Next().Literal; got != "20" {
+		t.Fatalf("after the NEWLINE read %q, want 20", got)
+	}
+
+	s.Reset(mark)
+	if s.Pos() != mark {
+		t.Errorf("Pos is %d after Reset(%d)", s.Pos(), mark)
+	}
+	if tok := s.Next(); tok.Type != token.GOTO {
+		t.Errorf("after Reset read %v, want GOTO", tok.Type)
+	}
+
+	// Forward past what has been read, and past the end.
+	s.Reset(5)
+	if got := s.Next().Literal; got != "END" {
+		t.Errorf("after Reset(5) read %q, want END", got)
+	}
+	s.Reset(100)
+	if tok := s.Next(); tok.Type != token.EOF {
+		t.Errorf("after Reset past the end read %v, want EOF", tok.Type)
+	}
+	s.Reset(-1)
+	if got := s.Next().Literal; got != "10" {
+		t.Errorf("after Reset(-1) read %q, want 10", got)
+	}
+}
@@ -0,0 +1,76 @@
+package lineedit
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AddHistory remembers line for recall with Up. Blank lines and repeats of
+// the previous line are skipped. With a history file set, the line is also
+// appended to it.
+func (ed *Editor) AddHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(ed.history); n > 0 && ed.history[n-1] == line {
+		return
+	}
+	ed.history = append(ed.history, line)
+	if len(ed.history) > MaxHistory {
+		ed.history = ed.history[len(ed.history)-MaxHistory:]
+	}
+
+	if ed.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(ed.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// History returns the remembered lines, oldest first.
+func (ed *Editor) History() []string {
+	return append([]string(nil), ed.history...)
+}
+
+// SetHistoryFile loads earlier history from path and appends later lines
+// to it, so history carries over between sessions. A missing file is not an
+// error. A file that has grown past MaxHistory lines is cut back to the
+// most recent ones.
+func (ed *Editor) SetHistoryFile(path string) error {
+	ed.historyFile = path
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(lines) > MaxHistory {
+		lines = lines[len(lines)-MaxHistory:]
+		content := strings.Join(lines, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			return err
+		}
+	}
+	ed.history = lines
+	return nil
+}
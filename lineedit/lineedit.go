@@ -0,0 +1,263 @@
+// Package lineedit reads a line of text from a terminal with cursor
+// movement and in-place editing. It uses the term package to take keys one
+// at a time, Ctrl-C included, and only the standard library otherwise.
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/basis-ex/term"
+)
+
+// ErrInterrupted is returned when Ctrl-C is pressed while editing.
+var ErrInterrupted = errors.New("interrupted")
+
+// MaxHistory is how many lines an editor remembers.
+const MaxHistory = 500
+
+// Editor edits lines typed on in, echoing to out.
+type Editor struct {
+	in          *os.File
+	out         io.Writer
+	reader      *bufio.Reader
+	history     []string
+	historyFile string
+
+	// Complete, when set, is called when Tab is pressed with the text
+	// before the cursor. It returns how many runes at the end of that text
+	// make up the word being completed, and the words that could replace
+	// it.
+	Complete func(before string) (wordLen int, candidates []string)
+}
+
+// New returns an editor reading keys from in and drawing on out.
+func New(in *os.File, out io.Writer) *Editor {
+	return &Editor{in: in, out: out, reader: bufio.NewReader(in)}
+}
+
+// Edit shows prompt followed by text with the cursor at the end and lets
+// the user change it. Left and Right (or Ctrl-B and Ctrl-F) move the cursor,
+// Home and End (or Ctrl-A and Ctrl-E) jump to either end, Backspace and
+// Delete remove characters, Ctrl-K and Ctrl-U cut to the end or the start of
+// the line, and Enter accepts the result. Ctrl-D on an empty line returns
+// io.EOF. When in is not a terminal, Edit returns term.ErrUnsupported.
+func (ed *Editor) Edit(prompt, text string) (string, error) {
+	return ed.edit(prompt, text, false)
+}
+
+// ReadLine prints prompt and reads a line with the same editing keys as
+// Edit. Up and Down (or Ctrl-P and Ctrl-N) step through earlier lines, and
+// each non-empty line read is added to the history. When in is not a
+// terminal the line is read as plain text and the history is left alone.
+// The result has no trailing newline; io.EOF means the input has ended.
+func (ed *Editor) ReadLine(prompt string) (string, error) {
+	line, err := ed.edit(prompt, "", true)
+	if !errors.Is(err, term.ErrUnsupported) {
+		if err == nil {
+			ed.AddHistory(line)
+		}
+		return line, err
+	}
+
+	fmt.Fprint(ed.out, prompt)
+	line, err = ed.reader.ReadString('\n')
+	if err != nil && (line == "" || !errors.Is(err, io.EOF)) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (ed *Editor) edit(prompt, text string, useHistory bool) (string, error) {
+	fd := int(ed.in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return "", term.ErrUnsupported
+	}
+	defer term.Restore(fd, state)
+
+	buf := []rune(text)
+	pos := len(buf)
+	// recalled is the history entry on show; len(ed.history) is the line
+	// being typed, which draft keeps while older lines are shown.
+	recalled := len(ed.history)
+	draft := buf
+	recall := func(to int) {
+		if !useHistory || to < 0 || to > len(ed.history) || to == recalled {
+			return
+		}
+		if recalled == len(ed.history) {
+			draft = buf
+		}
+		recalled = to
+		if to == len(ed.history) {
+			buf = draft
+		} else {
+			buf = []rune(ed.history[to])
+		}
+		pos = len(buf)
+	}
+	ed.redraw(prompt, buf, pos)
+
+	lastTab := false
+	for {
+		r, _, err := ed.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		tab := r == '\t'
+		switch r {
+		case '\t':
+			buf, pos = ed.complete(buf, pos, lastTab)
+		case '\r', '\n':
+			fmt.Fprint(ed.out, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			fmt.Fprint(ed.out, "^C\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				fmt.Fprint(ed.out, "\r\n")
+				return "", io.EOF
+			}
+			buf, pos = deleteAt(buf, pos)
+		case 1: // Ctrl-A
+			pos = 0
+		case 5: // Ctrl-E
+			pos = len(buf)
+		case 2: // Ctrl-B
+			pos = max(pos-1, 0)
+		case 6: // Ctrl-F
+			pos = min(pos+1, len(buf))
+		case 16: // Ctrl-P
+			recall(recalled - 1)
+		case 14: // Ctrl-N
+			recall(recalled + 1)
+		case 11: // Ctrl-K
+			buf = buf[:pos]
+		case 21: // Ctrl-U
+			buf = append([]rune{}, buf[pos:]...)
+			pos = 0
+		case 8, 127: // Backspace
+			if pos > 0 {
+				buf, pos = deleteAt(buf, pos-1)
+			}
+		case 27: // escape sequence
+			switch seq := ed.escapeSequence(); seq {
+			case "A":
+				recall(recalled - 1)
+			case "B":
+				recall(recalled + 1)
+			default:
+				buf, pos = editKey(seq, buf, pos)
+			}
+		default:
+			if unicode.IsPrint(r) {
+				buf = append(buf[:pos], append([]rune{r}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		lastTab = tab
+		ed.redraw(prompt, buf, pos)
+	}
+}
+
+// complete handles Tab. A single candidate replaces the word before the
+// cursor; several are narrowed to their longest common prefix, and listed
+// below the line when Tab is pressed twice in a row.
+func (ed *Editor) complete(buf []rune, pos int, again bool) ([]rune, int) {
+	if ed.Complete == nil {
+		return buf, pos
+	}
+	wordLen, candidates := ed.Complete(string(buf[:pos]))
+	if len(candidates) == 0 || wordLen > pos {
+		fmt.Fprint(ed.out, "\a")
+		return buf, pos
+	}
+
+	prefix := []rune(candidates[0])
+	for _, c := range candidates[1:] {
+		prefix = commonPrefix(prefix, []rune(c))
+	}
+	if len(prefix) > wordLen || len(candidates) == 1 {
+		replaced := append(append([]rune{}, buf[:pos-wordLen]...), prefix...)
+		buf = append(replaced, buf[pos:]...)
+		pos = len(replaced)
+	}
+
+	if len(candidates) > 1 && again {
+		fmt.Fprintf(ed.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	}
+	return buf, pos
+}
+
+// commonPrefix returns the longest prefix shared by a and b, ignoring case.
+func commonPrefix(a, b []rune) []rune {
+	n := 0
+	for n < len(a) && n < len(b) && unicode.ToUpper(a[n]) == unicode.ToUpper(b[n]) {
+		n++
+	}
+	return a[:n]
+}
+
+// escapeSequence reads the rest of an ESC [ ... or ESC O ... sequence, as
+// sent by the cursor and editing keys, and returns what follows the
+// introducer: "A" for Up, "3~" for Delete and so on.
+func (ed *Editor) escapeSequence() string {
+	intro, _, err := ed.reader.ReadRune()
+	if err != nil || (intro != '[' && intro != 'O') {
+		return ""
+	}
+
+	seq := ""
+	for {
+		r, _, err := ed.reader.ReadRune()
+		if err != nil {
+			return ""
+		}
+		seq += string(r)
+		if r >= '@' && r <= '~' {
+			return seq
+		}
+	}
+}
+
+// editKey applies the cursor or editing key named by an escape sequence.
+func editKey(seq string, buf []rune, pos int) ([]rune, int) {
+	switch seq {
+	case "D":
+		pos = max(pos-1, 0)
+	case "C":
+		pos = min(pos+1, len(buf))
+	case "H", "1~", "7~":
+		pos = 0
+	case "F", "4~", "8~":
+		pos = len(buf)
+	case "3~":
+		buf, pos = deleteAt(buf, pos)
+	}
+	return buf, pos
+}
+
+// deleteAt removes the rune at i, if there is one, and leaves the cursor
+// there.
+func deleteAt(buf []rune, i int) ([]rune, int) {
+	if i < len(buf) {
+		buf = append(buf[:i], buf[i+1:]...)
+	}
+	return buf, i
+}
+
+// redraw rewrites the whole line and puts the cursor back at pos.
+func (ed *Editor) redraw(prompt string, buf []rune, pos int) {
+	fmt.Fprintf(ed.out, "\r%s%s\x1b[K\r", prompt, string(buf))
+	if col := len([]rune(prompt)) + pos; col > 0 {
+		fmt.Fprintf(ed.out, "\x1b[%dC", col)
+	}
+}
@@ -0,0 +1,232 @@
+package lsp
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+	"github.com/basis-ex/token"
+)
+
+// document is an open program, parsed, with the places its line numbers,
+// labels and SUBs are defined and referred to.
+type document struct {
+	uri     string
+	lines   []string
+	program *ast.Program
+	errors  []parser.Error
+	tokens  *lexer.Stream
+	// includes is set when the program includes other files, whose lines
+	// it cannot see, and computed when it jumps to a line worked out as it
+	// runs, which could be any.
+	includes bool
+	computed bool
+
+	defs map[symbol]token.Token
+	refs []reference
+}
+
+// symbol is something a program names: a line, by its number, a label or
+// a SUB.
+type symbol struct {
+	kind symbolKind
+	name string
+}
+
+type symbolKind int
+
+const (
+	lineSymbol symbolKind = iota
+	labelSymbol
+	subSymbol
+)
+
+// reference is a use of a symbol: the target of a jump or RESTORE, or the
+// name a CALL calls.
+type reference struct {
+	symbol
+	tok token.Token
+}
+
+func newDocument(uri, text string, opts Options) *document {
+	d := &document{uri: uri, lines: splitLines(text), defs: make(map[symbol]token.Token)}
+
+	// Include directives are blanked, keeping the lines where they are,
+	// as the parser does not read them.
+	src := make([]string, len(d.lines))
+	for i, line := range d.lines {
+		if isInclude(line) {
+			d.includes = true
+			continue
+		}
+		src[i] = line
+	}
+	source := strings.Join(src, "\n")
+
+	l := lexer.New(source)
+	l.SetDialect(opts.Dialect)
+	p := parser.New(l)
+	d.program = p.ParseProgram()
+	d.errors = p.ErrorList()
+	d.tokens = p.Tokens()
+
+	d.index()
+	return d
+}
+
+// isInclude reports whether a line is an include directive, %INCLUDE
+// "file" or REM $INCLUDE: "file", with or without a line number.
+func isInclude(line string) bool {
+	upper := strings.ToUpper(strings.TrimLeft(strings.TrimSpace(line), "0123456789"))
+	upper = strings.TrimSpace(upper)
+	if strings.HasPrefix(upper, "%INCLUDE") {
+		return true
+	}
+	rest, ok := strings.CutPrefix(upper, "REM")
+	return ok && strings.HasPrefix(strings.TrimSpace(rest), "$INCLUDE")
+}
+
+// index finds where the symbols are defined and referred to.
+func (d *document) index() {
+	// A line number is the first token on its line.
+	d.tokens.Reset(0)
+	for tok := (token.Token{Type: token.NEWLINE}); tok.Type != token.EOF; tok = d.tokens.Next() {
+		next := d.tokens.Peek(0)
+		if tok.Type != token.NEWLINE || next.Type != token.NUMBER {
+			continue
+		}
+		if n, err := strconv.Atoi(next.Literal); err == nil {
+			d.defs[symbol{lineSymbol, strconv.Itoa(n)}] = next
+		}
+	}
+
+	target := func(expr ast.Expression) {
+		switch t := expr.(type) {
+		case nil:
+		case *ast.NumberLiteral:
+			if t.Token.Type == token.NUMBER && t.Value == float64(int(t.Value)) {
+				d.refs = append(d.refs, reference{symbol{lineSymbol, strconv.Itoa(int(t.Value))}, t.Token})
+			} else {
+				d.computed = true
+			}
+		case *ast.Identifier:
+			if _, ok := d.program.Labels[t.Value]; ok {
+				d.refs = append(d.refs, reference{symbol{labelSymbol, t.Value}, t.Token})
+			} else {
+				d.computed = true
+			}
+		default:
+			d.computed = true
+		}
+	}
+	for _, stmt := range d.program.Statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch s := node.(type) {
+			case *ast.LabelStatement:
+				d.defs[symbol{labelSymbol, s.Name}] = s.Token
+			case *ast.SubStatement:
+				d.defs[symbol{subSymbol, s.Name.Value}] = s.Name.Token
+			case *ast.GotoStatement:
+				target(s.LineNumber)
+			case *ast.GosubStatement:
+				target(s.LineNumber)
+			case *ast.OnTimerStatement:
+				target(s.Target)
+			case *ast.RestoreStatement:
+				target(s.LineNumber)
+			case *ast.CallStatement:
+				if _, ok := d.program.Procedures[s.Name.Value]; ok {
+					d.refs = append(d.refs, reference{symbol{subSymbol, s.Name.Value}, s.Name.Token})
+				}
+			}
+			_, ok := node.(ast.Statement)
+			return ok
+		})
+	}
+}
+
+// symbolAt returns the symbol defined or referred to at pos, with the
+// range of its name there.
+func (d *document) symbolAt(pos Position) (symbol, Range, bool) {
+	for sym, tok := range d.defs {
+		if r := d.tokenRange(tok); r.contains(pos) {
+			return sym, r, true
+		}
+	}
+	for _, ref := range d.refs {
+		if r := d.tokenRange(ref.tok); r.contains(pos) {
+			return ref.symbol, r, true
+		}
+	}
+	return symbol{}, Range{}, false
+}
+
+// occurrences returns the definition of sym, if the program has one, and
+// every reference to it.
+func (d *document) occurrences(sym symbol) []token.Token {
+	var toks []token.Token
+	if def, ok := d.defs[sym]; ok {
+		toks = append(toks, def)
+	}
+	for _, ref := range d.refs {
+		if ref.symbol == sym {
+			toks = append(toks, ref.tok)
+		}
+	}
+	return toks
+}
+
+// tokenAt returns the token at pos, other than a NEWLINE or EOF.
+func (d *document) tokenAt(pos Position) (token.Token, bool) {
+	d.tokens.Reset(0)
+	for tok := d.tokens.Next(); tok.Type != token.EOF; tok = d.tokens.Next() {
+		if tok.Type == token.NEWLINE {
+			continue
+		}
+		if d.tokenRange(tok).contains(pos) {
+			return tok, true
+		}
+	}
+	return token.Token{}, false
+}
+
+// position converts a place the lexer gives, a line and a byte column both
+// counted from 1, to an LSP Position.
+func (d *document) position(p token.Position) Position {
+	line := p.Line - 1
+	if line < 0 || line >= len(d.lines) {
+		return Position{Line: max(line, 0)}
+	}
+	text := d.lines[line]
+	col := min(max(p.Column-1, 0), len(text))
+	return Position{Line: line, Character: utf16Len(text[:col])}
+}
+
+func (d *document) tokenRange(tok token.Token) Range {
+	end := tok.End
+	if !end.IsValid() || end == tok.Pos() {
+		end = token.Position{Line: tok.Line, Column: tok.Column + len(tok.Literal)}
+	}
+	return Range{d.position(tok.Pos()), d.position(end)}
+}
+
+// lineRange is the range of the source line holding the numbered line n,
+// from its number to its end, and whether there is one.
+func (d *document) lineRange(n int) (Range, bool) {
+	def, ok := d.defs[symbol{lineSymbol, strconv.Itoa(n)}]
+	if !ok {
+		return Range{}, false
+	}
+	start := d.position(def.Pos())
+	return Range{start, Position{Line: start.Line, Character: utf16Len(d.lines[start.Line])}}, true
+}
+
+// lineText is the source text of the line pos is on.
+func (d *document) lineText(pos Position) string {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return ""
+	}
+	return strings.TrimSpace(d.lines[pos.Line])
+}
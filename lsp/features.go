@@ -0,0 +1,397 @@
+package lsp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/catalog"
+	"github.com/basis-ex/check"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/optimize"
+	"github.com/basis-ex/token"
+)
+
+// diagnostics reports what basic lint would: the syntax errors, or, for a
+// program that parses, jumps to lines and labels it does not have, NEXTs
+// without a FOR, type mismatches and code that can never run. The checks
+// across lines are left out for a program that includes others.
+func (d *document) diagnostics(opts Options) []Diagnostic {
+	diags := []Diagnostic{}
+	add := func(r Range, severity int, msg string) {
+		diags = append(diags, Diagnostic{Range: r, Severity: severity, Source: "basic", Message: msg})
+	}
+	if len(d.errors) > 0 {
+		for _, err := range d.errors {
+			start := d.position(err.Pos)
+			end := start
+			if err.End.IsValid() {
+				end = d.position(err.End)
+			}
+			if end == start {
+				end.Character++
+			}
+			add(Range{start, end}, severityError, err.Msg)
+		}
+		return diags
+	}
+	onLine := func(line, severity int, msg string) {
+		if r, ok := d.lineRange(line); ok {
+			add(r, severity, msg)
+		}
+	}
+
+	if !d.includes {
+		for _, u := range check.UndefinedTargets(d.program) {
+			for _, ref := range d.refs {
+				if ref.symbol == (symbol{lineSymbol, strconv.Itoa(u.Target)}) {
+					add(d.tokenRange(ref.tok), severityError, fmt.Sprintf("undefined line %d", u.Target))
+				}
+			}
+		}
+		for _, problem := range append(check.UnmatchedNexts(d.program), check.UndefinedLabels(d.program)...) {
+			onLine(problem.Line, severityError, problem.Message)
+		}
+	}
+	severity := severityWarning
+	if opts.Strict {
+		severity = severityError
+	}
+	for _, problem := range check.Types(d.program) {
+		onLine(problem.Line, severity, problem.Message)
+	}
+	if !d.includes {
+		for _, dead := range optimize.FindDeadCode(d.program) {
+			r, ok := d.lineRange(dead.Line)
+			if !ok {
+				continue
+			}
+			msg := "this line can never run"
+			if dead.From > 0 {
+				r.Start = d.position(ast.Flatten(d.program.Statements[dead.Line])[dead.From].Pos())
+				msg = fmt.Sprintf("statements after %s can never run", dead.After)
+			}
+			diags = append(diags, Diagnostic{Range: r, Severity: severityWarning, Source: "basic", Message: msg, Tags: []int{tagUnnecessary}})
+		}
+	}
+	return diags
+}
+
+// definition returns where the line, label or SUB at pos is defined.
+func (d *document) definition(pos Position) []Location {
+	sym, _, ok := d.symbolAt(pos)
+	if !ok {
+		return []Location{}
+	}
+	def, ok := d.defs[sym]
+	if !ok {
+		return []Location{}
+	}
+	return []Location{{URI: d.uri, Range: d.tokenRange(def)}}
+}
+
+// references returns every place the symbol at pos is used, with its
+// definition when includeDecl is set.
+func (d *document) references(pos Position, includeDecl bool) []Location {
+	sym, _, ok := d.symbolAt(pos)
+	if !ok {
+		return []Location{}
+	}
+	locs := []Location{}
+	def, hasDef := d.defs[sym]
+	for _, tok := range d.occurrences(sym) {
+		if hasDef && tok == def && !includeDecl {
+			continue
+		}
+		locs = append(locs, Location{URI: d.uri, Range: d.tokenRange(tok)})
+	}
+	return locs
+}
+
+// hover describes the keyword or function at pos from the catalog, or,
+// for a line, label or SUB, shows the line that defines it.
+func (d *document) hover(pos Position) *Hover {
+	if sym, r, ok := d.symbolAt(pos); ok {
+		def, ok := d.defs[sym]
+		if !ok {
+			return nil
+		}
+		return &Hover{Contents: markdown("```basic\n" + d.lineText(d.position(def.Pos())) + "\n```"), Range: r}
+	}
+	tok, ok := d.tokenAt(pos)
+	if !ok || tok.Type == token.STRING || tok.Type == token.COMMENT || tok.Type == token.NUMBER {
+		return nil
+	}
+	entry, ok := catalog.Lookup(tok.Literal)
+	if !ok {
+		return nil
+	}
+	return &Hover{
+		Contents: markdown(fmt.Sprintf("```basic\n%s\n```\n%s (%s)", entry.Syntax, entry.Summary, entry.Kind)),
+		Range:    d.tokenRange(tok),
+	}
+}
+
+// completion offers what could be written at pos: the lines and labels
+// after a word that jumps, such as GOTO or THEN, the SUBs after CALL, and
+// otherwise the statements and functions. Each starts with the part of a
+// word already typed before pos.
+func (d *document) completion(pos Position) []CompletionItem {
+	var before string
+	if pos.Line >= 0 && pos.Line < len(d.lines) {
+		before = d.lines[pos.Line]
+		for i, n := range before {
+			if n >= 0x10000 {
+				pos.Character--
+			}
+			if pos.Character--; pos.Character < 0 {
+				before = before[:i]
+				break
+			}
+		}
+	}
+	rest := strings.TrimRightFunc(before, isWordRune)
+	word := strings.ToUpper(before[len(rest):])
+	fields := strings.Fields(strings.ToUpper(rest))
+	var previous string
+	if len(fields) > 0 {
+		previous = fields[len(fields)-1]
+	}
+
+	items := []CompletionItem{}
+	add := func(label string, kind int, detail string) {
+		if strings.HasPrefix(strings.ToUpper(label), word) {
+			items = append(items, CompletionItem{Label: label, Kind: kind, Detail: detail})
+		}
+	}
+	defined := func(kind symbolKind, itemKind int) {
+		for sym, def := range d.defs {
+			if sym.kind == kind {
+				add(sym.name, itemKind, d.lineText(d.position(def.Pos())))
+			}
+		}
+	}
+	switch previous {
+	case "GOTO", "GOSUB", "THEN", "ELSE", "RESTORE":
+		defined(lineSymbol, completionReference)
+		defined(labelSymbol, completionReference)
+	case "CALL":
+		defined(subSymbol, completionFunction)
+	default:
+		for _, e := range catalog.Entries {
+			switch e.Kind {
+			case catalog.Statement:
+				add(e.Name, completionKeyword, e.Syntax)
+			case catalog.Function:
+				add(e.Name, completionFunction, e.Syntax)
+			}
+		}
+	}
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i].Label, items[j].Label
+		if x, err := strconv.Atoi(a); err == nil {
+			if y, err := strconv.Atoi(b); err == nil {
+				return x < y
+			}
+		}
+		return a < b
+	})
+	return items
+}
+
+// isWordRune reports whether r can be part of a keyword or name, the
+// $ of a string function included.
+func isWordRune(r rune) bool {
+	return r == '$' || r == '_' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9'
+}
+
+func markdown(text string) MarkupContent {
+	return MarkupContent{Kind: "markdown", Value: text}
+}
+
+// symbols lists, in the order they are written, the program's SUBs, its
+// labels and the lines something jumps to, which are what give it shape;
+// listing every line would only repeat the program.
+func (d *document) symbols() []DocumentSymbol {
+	targeted := make(map[symbol]bool)
+	for _, ref := range d.refs {
+		targeted[ref.symbol] = true
+	}
+	syms := []DocumentSymbol{}
+	for sym, def := range d.defs {
+		var name string
+		var kind int
+		switch sym.kind {
+		case lineSymbol:
+			if !targeted[sym] {
+				continue
+			}
+			name, kind = "line "+sym.name, symbolNumber
+		case labelSymbol:
+			name, kind = sym.name, symbolKey
+		case subSymbol:
+			name, kind = "SUB "+sym.name, symbolFunction
+		}
+		r := d.tokenRange(def)
+		full := Range{Start: Position{Line: r.Start.Line}, End: Position{Line: r.Start.Line, Character: utf16Len(d.lines[r.Start.Line])}}
+		if sym.kind == subSymbol {
+			if proc, ok := d.program.Procedures[sym.name]; ok && proc.EndLine > 0 {
+				if end, ok := d.lineRange(proc.EndLine); ok {
+					full.End = end.End
+				}
+			}
+		}
+		syms = append(syms, DocumentSymbol{Name: name, Detail: d.lineText(r.Start), Kind: kind, Range: full, SelectionRange: r})
+	}
+	sort.Slice(syms, func(i, j int) bool {
+		a, b := syms[i].SelectionRange.Start, syms[j].SelectionRange.Start
+		return a.before(b)
+	})
+	return syms
+}
+
+// prepareRename returns the range of the line number, label or SUB name
+// at pos, or why it cannot be renamed.
+func (d *document) prepareRename(pos Position) (Range, error) {
+	sym, r, ok := d.symbolAt(pos)
+	if !ok {
+		return Range{}, fmt.Errorf("only line numbers, labels and SUB names can be renamed")
+	}
+	if sym.kind == lineSymbol {
+		if err := d.canRenumber(); err != nil {
+			return Range{}, err
+		}
+	}
+	return r, nil
+}
+
+// rename gives the symbol at pos the name newName everywhere it appears.
+// A line number may only be changed to one that keeps the line where it is
+// among the others, as moving it would change what the program does.
+func (d *document) rename(pos Position, newName string) (*WorkspaceEdit, error) {
+	if _, err := d.prepareRename(pos); err != nil {
+		return nil, err
+	}
+	sym, _, _ := d.symbolAt(pos)
+	newName = strings.TrimSpace(newName)
+	switch sym.kind {
+	case lineSymbol:
+		n, err := strconv.Atoi(newName)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%q is not a line number", newName)
+		}
+		old, _ := strconv.Atoi(sym.name)
+		if _, ok := d.program.Statements[old]; !ok {
+			return nil, fmt.Errorf("line %d does not exist", old)
+		}
+		if n != old {
+			if _, ok := d.program.Statements[n]; ok {
+				return nil, fmt.Errorf("line %d already exists", n)
+			}
+			lines := d.lineNumbers()
+			i := sort.SearchInts(lines, old)
+			if i > 0 && n <= lines[i-1] || i+1 < len(lines) && n >= lines[i+1] {
+				return nil, fmt.Errorf("line %d would move past other lines; renumber the program instead", old)
+			}
+		}
+		return d.renumberEdit(map[int]int{old: n}), nil
+	default:
+		if !isName(newName) {
+			return nil, fmt.Errorf("%q is not a name", newName)
+		}
+		if _, ok := d.defs[symbol{sym.kind, newName}]; ok && newName != sym.name {
+			return nil, fmt.Errorf("%s is already defined", newName)
+		}
+		var edits []TextEdit
+		for _, tok := range d.occurrences(sym) {
+			edits = append(edits, TextEdit{Range: d.tokenRange(tok), NewText: newName})
+		}
+		return &WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}, nil
+	}
+}
+
+// isName reports whether s reads as a single name the program could use,
+// rather than a keyword or anything else.
+func isName(s string) bool {
+	l := lexer.New(s)
+	tok := l.NextToken()
+	return tok.Type == token.IDENT && tok.Literal == s && l.NextToken().Type == token.EOF
+}
+
+// canRenumber says why the program's lines cannot be renumbered, or
+// returns nil if they can: every jump to them must be written as a number
+// or a label, and all of them must be in the document.
+func (d *document) canRenumber() error {
+	switch {
+	case len(d.errors) > 0:
+		return fmt.Errorf("the program has syntax errors")
+	case d.includes:
+		return fmt.Errorf("the program includes other files, whose jumps cannot be seen")
+	case d.computed:
+		return fmt.Errorf("the program jumps to computed lines, which renumbering cannot follow")
+	}
+	return nil
+}
+
+func (d *document) lineNumbers() []int {
+	var lines []int
+	for line := range d.program.Statements {
+		if line > 0 {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+// renumbered maps each of the program's line numbers, in order, to one
+// counting from start by step.
+func (d *document) renumbered(start, step int) map[int]int {
+	numbers := make(map[int]int)
+	for i, line := range d.lineNumbers() {
+		numbers[line] = start + i*step
+	}
+	return numbers
+}
+
+// renumberEdit changes the lines numbered as the keys of numbers to the
+// values, and every jump to them, leaving the number as written alone
+// where it does not change.
+func (d *document) renumberEdit(numbers map[int]int) *WorkspaceEdit {
+	edits := []TextEdit{}
+	edit := func(tok token.Token, old int) {
+		if n, ok := numbers[old]; ok && strconv.Itoa(n) != tok.Literal {
+			edits = append(edits, TextEdit{Range: d.tokenRange(tok), NewText: strconv.Itoa(n)})
+		}
+	}
+	for sym, def := range d.defs {
+		if sym.kind == lineSymbol {
+			old, _ := strconv.Atoi(sym.name)
+			edit(def, old)
+		}
+	}
+	for _, ref := range d.refs {
+		if ref.kind == lineSymbol {
+			old, _ := strconv.Atoi(ref.name)
+			edit(ref.tok, old)
+		}
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].Range.Start.before(edits[j].Range.Start) })
+	return &WorkspaceEdit{Changes: map[string][]TextEdit{d.uri: edits}}
+}
+
+// codeActions offers to renumber the program from 10 in steps of 10, when
+// it can be and is not numbered so already.
+func (d *document) codeActions() []CodeAction {
+	actions := []CodeAction{}
+	if d.canRenumber() != nil {
+		return actions
+	}
+	edit := d.renumberEdit(d.renumbered(10, 10))
+	if len(edit.Changes[d.uri]) == 0 {
+		return actions
+	}
+	return append(actions, CodeAction{Title: "Renumber lines from 10 in steps of 10", Kind: "source", Edit: edit})
+}
@@ -0,0 +1,265 @@
+// Package lsp serves the Language Server Protocol for BASIC programs, so
+// that an editor such as VS Code or Vim can show a program's errors as it
+// is written, jump from a GOTO, GOSUB or CALL to the line or SUB it names,
+// describe keywords on hover, complete keywords, jump targets and SUB
+// names, outline its labels, SUBs and jump targets, and rename labels,
+// SUBs and line numbers, or renumber the whole program, with every jump
+// kept pointing where it did.
+//
+// The server speaks JSON-RPC over a reader and writer, as an editor runs
+// it on standard input and output, and keeps each document whole, taking
+// the full text on every change.
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/basis-ex/dialect"
+)
+
+// Options are the settings a server checks programs with.
+type Options struct {
+	// Dialect selects how strings are read; the zero value is
+	// dialect.Standard.
+	Dialect dialect.Dialect
+	// Strict reports type mismatches as errors rather than warnings, as
+	// lint -strict does.
+	Strict bool
+}
+
+// Server is a language server for one editor session.
+type Server struct {
+	opts Options
+
+	mu   sync.Mutex
+	out  io.Writer
+	docs map[string]*document
+
+	initialized bool
+	shutdown    bool
+}
+
+// NewServer returns a server that writes its responses and notifications
+// to out.
+func NewServer(out io.Writer, opts Options) *Server {
+	return &Server{opts: opts, out: out, docs: make(map[string]*document)}
+}
+
+// Serve reads messages from in and handles each in turn until the editor
+// sends exit, or in ends. It returns an error if in ends before exit or a
+// message cannot be read or answered.
+func (s *Server) Serve(in io.Reader) error {
+	r := bufio.NewReader(in)
+	for {
+		msg, err := readMessage(r)
+		var parseErr *responseError
+		switch {
+		case errors.As(err, &parseErr):
+			if err := s.reply(nil, nil, parseErr); err != nil {
+				return err
+			}
+			continue
+		case errors.Is(err, io.EOF):
+			return fmt.Errorf("input ended without exit")
+		case err != nil:
+			return err
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return fmt.Errorf("exit without shutdown")
+			}
+			return nil
+		}
+		if err := s.handle(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// handle answers a request, or acts on a notification, which has no ID
+// and gets no answer.
+func (s *Server) handle(msg *message) error {
+	if msg.ID == nil {
+		s.notification(msg.Method, msg.Params)
+		return nil
+	}
+	if !s.initialized && msg.Method != "initialize" {
+		return s.reply(msg.ID, nil, &responseError{codeServerNotStarted, "initialize has not been sent"})
+	}
+	result, err := s.request(msg.Method, msg.Params)
+	var respErr *responseError
+	if err != nil && !errors.As(err, &respErr) {
+		respErr = &responseError{codeRequestFailed, err.Error()}
+	}
+	return s.reply(msg.ID, result, respErr)
+}
+
+func (s *Server) request(method string, params json.RawMessage) (any, error) {
+	switch method {
+	case "initialize":
+		s.initialized = true
+		return map[string]any{
+			"capabilities": map[string]any{
+				"textDocumentSync":       1, // the full text on every change
+				"hoverProvider":          true,
+				"completionProvider":     map[string]any{},
+				"definitionProvider":     true,
+				"referencesProvider":     true,
+				"documentSymbolProvider": true,
+				"renameProvider":         map[string]any{"prepareProvider": true},
+				"codeActionProvider":     true,
+			},
+			"serverInfo": map[string]any{"name": "basic"},
+		}, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/hover":
+		var p positionParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			if h := d.hover(p.Position); h != nil {
+				return h, nil
+			}
+			return nil, nil
+		})
+	case "textDocument/completion":
+		var p positionParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			return d.completion(p.Position), nil
+		})
+	case "textDocument/definition":
+		var p positionParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			return d.definition(p.Position), nil
+		})
+	case "textDocument/references":
+		var p struct {
+			positionParams
+			Context struct {
+				IncludeDeclaration bool `json:"includeDeclaration"`
+			} `json:"context"`
+		}
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			return d.references(p.Position, p.Context.IncludeDeclaration), nil
+		})
+	case "textDocument/documentSymbol":
+		var p documentParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			return d.symbols(), nil
+		})
+	case "textDocument/prepareRename":
+		var p positionParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			r, err := d.prepareRename(p.Position)
+			if err != nil {
+				return nil, err
+			}
+			return r, nil
+		})
+	case "textDocument/rename":
+		var p renameParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			return d.rename(p.Position, p.NewName)
+		})
+	case "textDocument/codeAction":
+		var p documentParams
+		return withDocument(s, params, &p, &p.TextDocument, func(d *document) (any, error) {
+			return d.codeActions(), nil
+		})
+	}
+	return nil, &responseError{codeMethodNotFound, "method not supported: " + method}
+}
+
+// withDocument decodes params into p and calls f with the document
+// p names.
+func withDocument(s *Server, params json.RawMessage, p any, id *textDocumentIdentifier, f func(*document) (any, error)) (any, error) {
+	if err := json.Unmarshal(params, p); err != nil {
+		return nil, &responseError{codeInvalidParams, err.Error()}
+	}
+	s.mu.Lock()
+	d, ok := s.docs[id.URI]
+	s.mu.Unlock()
+	if !ok {
+		return nil, &responseError{codeInvalidParams, "document not open: " + id.URI}
+	}
+	return f(d)
+}
+
+// notification handles the notifications that keep the documents up to
+// date, publishing each one's diagnostics as it changes. Others, such as
+// initialized, need nothing done.
+func (s *Server) notification(method string, params json.RawMessage) {
+	switch method {
+	case "textDocument/didOpen":
+		var p didOpenParams
+		if json.Unmarshal(params, &p) == nil {
+			s.update(p.TextDocument.URI, p.TextDocument.Text)
+		}
+	case "textDocument/didChange":
+		var p didChangeParams
+		if json.Unmarshal(params, &p) == nil && len(p.ContentChanges) > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+		}
+	case "textDocument/didClose":
+		var p documentParams
+		if json.Unmarshal(params, &p) == nil {
+			s.mu.Lock()
+			delete(s.docs, p.TextDocument.URI)
+			s.mu.Unlock()
+			s.publish(p.TextDocument.URI, []Diagnostic{})
+		}
+	}
+}
+
+// update parses the new text of a document and publishes its
+// diagnostics.
+func (s *Server) update(uri, text string) {
+	d := newDocument(uri, text, s.opts)
+	s.mu.Lock()
+	s.docs[uri] = d
+	s.mu.Unlock()
+	s.publish(uri, d.diagnostics(s.opts))
+}
+
+func (s *Server) publish(uri string, diags []Diagnostic) {
+	s.send(&message{
+		Method: "textDocument/publishDiagnostics",
+		Params: mustMarshal(map[string]any{"uri": uri, "diagnostics": diags}),
+	})
+}
+
+// reply answers the request with the given ID, with result or err.
+func (s *Server) reply(id *json.RawMessage, result any, err *responseError) error {
+	msg := &message{ID: id, Error: err}
+	if err == nil {
+		// A null result must still be sent, which omitempty would drop.
+		msg.Result = json.RawMessage("null")
+		if result != nil {
+			msg.Result = result
+		}
+	}
+	if id == nil {
+		null := json.RawMessage("null")
+		msg.ID = &null
+	}
+	return s.send(msg)
+}
+
+func (s *Server) send(msg *message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return writeMessage(s.out, msg)
+}
+
+func mustMarshal(v any) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
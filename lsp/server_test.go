@@ -0,0 +1,290 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client talks to a Server over in-memory pipes, as an editor would over
+// standard input and output.
+type client struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	nextID int
+	done   chan error
+	// diags holds the diagnostics last published for each document.
+	diags map[string][]Diagnostic
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, out: bufio.NewReader(outR), done: make(chan error, 1), diags: map[string][]Diagnostic{}}
+	go func() {
+		c.done <- NewServer(outW, Options{}).Serve(inR)
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+	c.request("initialize", map[string]any{}, nil)
+	c.notify("initialized", map[string]any{})
+	return c
+}
+
+func (c *client) send(msg *message) {
+	c.t.Helper()
+	if err := writeMessage(c.in, msg); err != nil {
+		c.t.Fatalf("write: %v", err)
+	}
+}
+
+func (c *client) notify(method string, params any) {
+	c.t.Helper()
+	c.send(&message{Method: method, Params: mustMarshal(params)})
+}
+
+// request sends a request and decodes its result into result, reading the
+// notifications that come before the answer on the way. It returns the
+// answer's error, if any.
+func (c *client) request(method string, params any, result any) *responseError {
+	c.t.Helper()
+	c.nextID++
+	id := json.RawMessage(mustMarshal(c.nextID))
+	c.send(&message{ID: &id, Method: method, Params: mustMarshal(params)})
+	for {
+		msg := c.read()
+		if msg.ID == nil {
+			continue
+		}
+		if string(*msg.ID) != string(id) {
+			c.t.Fatalf("answer to request %s, want %s", *msg.ID, id)
+		}
+		if msg.Error == nil && result != nil {
+			if err := json.Unmarshal(mustMarshal(msg.Result), result); err != nil {
+				c.t.Fatalf("%s result: %v", method, err)
+			}
+		}
+		return msg.Error
+	}
+}
+
+// read reads the server's next message, keeping the diagnostics it
+// publishes.
+func (c *client) read() *message {
+	c.t.Helper()
+	msg, err := readMessage(c.out)
+	if err != nil {
+		c.t.Fatalf("read: %v", err)
+	}
+	if msg.Method == "textDocument/publishDiagnostics" {
+		var p struct {
+			URI         string       `json:"uri"`
+			Diagnostics []Diagnostic `json:"diagnostics"`
+		}
+		if err := json.Unmarshal(msg.Params, &p); err != nil {
+			c.t.Fatalf("publishDiagnostics: %v", err)
+		}
+		c.diags[p.URI] = p.Diagnostics
+	}
+	return msg
+}
+
+// open opens a document and returns the diagnostics published for it.
+func (c *client) open(uri, text string) []Diagnostic {
+	c.t.Helper()
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": text}})
+	c.read()
+	return c.diags[uri]
+}
+
+// close shuts the server down as an editor does and checks that it
+// stopped cleanly.
+func (c *client) close() {
+	c.t.Helper()
+	c.request("shutdown", nil, nil)
+	c.notify("exit", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Errorf("Serve: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("server did not stop after exit")
+	}
+}
+
+func at(uri string, line, character int) map[string]any {
+	return map[string]any{
+		"textDocument": map[string]any{"uri": uri},
+		"position":     Position{Line: line, Character: character},
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name, text string
+		// want are the messages of the diagnostics, each prefixed by its
+		// severity, E or W, and the line it is on counting from 0.
+		want []string
+	}{
+		{
+			name: "clean program",
+			text: "10 PRINT \"HI\"\n20 END\n",
+		},
+		{
+			name: "undefined line",
+			text: "10 GOTO 99\n",
+			want: []string{"E0 undefined line 99"},
+		},
+		{
+			name: "code that can never run",
+			text: "10 END\n20 PRINT 1\n",
+			want: []string{"W1 this line can never run"},
+		},
+		{
+			name: "type mismatch",
+			text: "10 LET A = \"X\"\n",
+			want: []string{"W0 "},
+		},
+		{
+			name: "syntax error",
+			text: "10 PRINT (1\n",
+			want: []string{"E0 "},
+		},
+	}
+	c := newClient(t)
+	defer c.close()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.t = t
+			uri := "file:///" + strings.ReplaceAll(tt.name, " ", "_") + ".bas"
+			diags := c.open(uri, tt.text)
+			if len(diags) != len(tt.want) {
+				t.Fatalf("got %d diagnostics %+v, want %q", len(diags), diags, tt.want)
+			}
+			for i, d := range diags {
+				severity := "E"
+				if d.Severity == severityWarning {
+					severity = "W"
+				}
+				got := severity + string(rune('0'+d.Range.Start.Line)) + " " + d.Message
+				if !strings.HasPrefix(got, tt.want[i]) {
+					t.Errorf("diagnostic %q, want it to start %q", got, tt.want[i])
+				}
+			}
+		})
+	}
+	c.t = t
+}
+
+func TestDiagnosticsFollowChanges(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+	const uri = "file:///prog.bas"
+	if diags := c.open(uri, "10 GOTO 20\n"); len(diags) != 1 {
+		t.Fatalf("opened with %d diagnostics, want 1", len(diags))
+	}
+	c.notify("textDocument/didChange", map[string]any{
+		"textDocument":   map[string]any{"uri": uri},
+		"contentChanges": []map[string]any{{"text": "10 GOTO 20\n20 END\n"}},
+	})
+	c.read()
+	if diags := c.diags[uri]; len(diags) != 0 {
+		t.Errorf("after the fix, diagnostics %+v, want none", diags)
+	}
+	c.notify("textDocument/didOpen", map[string]any{"textDocument": map[string]any{"uri": uri, "text": "10 GOTO 30\n"}})
+	c.read()
+	c.notify("textDocument/didClose", map[string]any{"textDocument": map[string]any{"uri": uri}})
+	c.read()
+	if diags := c.diags[uri]; len(diags) != 0 {
+		t.Errorf("after closing, diagnostics %+v, want none", diags)
+	}
+}
+
+func TestHover(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+	const uri = "file:///hover.bas"
+	c.open(uri, "10 GOSUB 100\n20 END\n100 PRINT \"SUB\"\n110 RETURN\n")
+	tests := []struct {
+		name       string
+		line, char int
+		want       string
+	}{
+		{name: "keyword", line: 2, char: 5, want: "Print values"},
+		{name: "jump target", line: 0, char: 10, want: "100 PRINT \"SUB\""},
+		{name: "string", line: 2, char: 12},
+		{name: "past the end", line: 9, char: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.t = t
+			var h *Hover
+			if err := c.request("textDocument/hover", at(uri, tt.line, tt.char), &h); err != nil {
+				t.Fatalf("hover: %v", err)
+			}
+			switch {
+			case tt.want == "" && h != nil:
+				t.Errorf("hover %q, want none", h.Contents.Value)
+			case tt.want != "" && h == nil:
+				t.Errorf("no hover, want %q", tt.want)
+			case tt.want != "" && !strings.Contains(h.Contents.Value, tt.want):
+				t.Errorf("hover %q, want it to contain %q", h.Contents.Value, tt.want)
+			}
+		})
+	}
+	c.t = t
+}
+
+func TestCompletion(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+	const uri = "file:///complete.bas"
+	text := "10 GOTO 1\n20 CALL G\n30 PR\n40 LET A = TR\n" +
+		"100 SUB GREET\n110 PRINT \"HI\"\n120 END SUB\n130 Loop:\n140 GOSUB \n"
+	c.open(uri, text)
+	tests := []struct {
+		name       string
+		line, char int
+		want       []string
+	}{
+		{name: "line numbers after GOTO", line: 0, char: 9, want: []string{"10", "100", "110", "120", "130", "140"}},
+		{name: "lines and labels after GOSUB", line: 8, char: 10, want: []string{"10", "20", "30", "40", "100", "110", "120", "130", "140", "Loop"}},
+		{name: "SUBs after CALL", line: 1, char: 9, want: []string{"GREET"}},
+		{name: "statements", line: 2, char: 5, want: []string{"PRINT"}},
+		{name: "functions", line: 3, char: 13, want: []string{"TRIM$", "TRUE"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.t = t
+			var items []CompletionItem
+			if err := c.request("textDocument/completion", at(uri, tt.line, tt.char), &items); err != nil {
+				t.Fatalf("completion: %v", err)
+			}
+			var got []string
+			for _, item := range items {
+				got = append(got, item.Label)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("completions %q, want %q", got, tt.want)
+			}
+		})
+	}
+	c.t = t
+}
+
+func TestRequestErrors(t *testing.T) {
+	c := newClient(t)
+	defer c.close()
+	if err := c.request("textDocument/hover", at("file:///missing.bas", 0, 0), nil); err == nil || err.Code != codeInvalidParams {
+		t.Errorf("hover on an unopened document: %v, want code %d", err, codeInvalidParams)
+	}
+	if err := c.request("workspace/nonsense", nil, nil); err == nil || err.Code != codeMethodNotFound {
+		t.Errorf("unknown method: %v, want code %d", err, codeMethodNotFound)
+	}
+}
@@ -2,249 +2,1073 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/basis-ex/ast"
+	"github.com/basis-ex/catalog"
+	"github.com/basis-ex/check"
 	"github.com/basis-ex/compiler"
+	"github.com/basis-ex/coverage"
+	"github.com/basis-ex/dialect"
 	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/fileformat"
 	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/lineedit"
+	"github.com/basis-ex/optimize"
 	"github.com/basis-ex/parser"
+	"github.com/basis-ex/term"
+	"github.com/basis-ex/token"
+	"github.com/basis-ex/transpile"
+	"io"
 	"os"
+	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
+// pageLength is the --More-- page size applied to programs run from the
+// REPL or the command line; zero means output is never paused.
+var pageLength int
+
+// printerFile is where LLIST sends listings, standing in for a printer.
+var printerFile = "lpt1.txt"
+
+// maxGosubDepth bounds GOSUB nesting for every program the CLI runs.
+var maxGosubDepth int
+
+// maxStringLength and maxArrayCells, set by -max-string and -max-array,
+// bound the memory a program's strings and arrays may take.
+var (
+	maxStringLength int
+	maxArrayCells   int
+)
+
+// basicDialect selects the semantics used to run and compile programs.
+var basicDialect = dialect.Standard
+
+// strict is set by -strict to refuse programs with the type mismatches
+// that lint reports, rather than stop them when they reach one.
+var strict bool
+
+// strictDartmouth is set by -strict-dartmouth to refuse programs that the
+// Dartmouth BASIC of 1964 would not have run.
+var strictDartmouth bool
+
+// noShell disables the SHELL statement for programs the CLI runs.
+var noShell bool
+
+// Exit codes for a program run from the command line. A program that
+// finishes exits with the status it gave END or SYSTEM, 0 by default.
+const (
+	exitRuntimeError = 1   // the program stopped with a runtime error
+	exitUsage        = 2   // bad flags or arguments, as the flag package uses
+	exitSyntaxError  = 3   // the program does not parse
+	exitFileError    = 4   // a file could not be read or written
+	exitLimit        = 5   // the program ran past -max-steps or -timeout
+	exitBreak        = 130 // interrupted with Ctrl-C, as shells report SIGINT
+)
+
+// programArgs holds the command-line arguments after the .bas file, made
+// available to programs through COMMAND$.
+var programArgs []string
+
+// maxSteps and timeout, set by -max-steps and -timeout, bound how long a
+// program may run so that an infinite loop cannot hang a grader or server.
+var (
+	maxSteps int64
+	timeout  time.Duration
+)
+
+// showTime is set by -time to report on each run from the command line.
+var showTime bool
+
+// showCover and coverProfile are set by -cover and -coverprofile to record
+// which lines a run from the command line executes.
+var (
+	showCover    bool
+	coverProfile string
+)
+
+// engine is set by -engine to choose what runs a program from the command
+// line: "tree", the evaluator, or "vm", the bytecode machine.
+var engine = "tree"
+
+// dumpAST is set by -ast to print the parsed program as JSON instead of
+// running it.
+var dumpAST bool
+
+// dumpTokens is set by -tokens to print the lexer's tokens instead of
+// running the program.
+var dumpTokens bool
+
+// dropDead is set by -drop-dead to leave the lines a program can never
+// reach out of the Go that compile writes.
+var dropDead bool
+
+// sourceMap is set by -sourcemap to the file to write the JSON source map
+// of the Go that compile writes to.
+var sourceMap string
+
+// script, when set by -input or -answer, supplies the answers to INPUT
+// statements instead of the terminal. It is shared by every run so that
+// answers are used up in order.
+var script *bufio.Reader
+
 func main() {
-	compileOut := flag.String("compile", "", "write Go source for the BASIC program to this file (use '-' for stdout)")
+	if len(os.Args) > 1 {
+		if cmd, ok := lookupCommand(os.Args[1]); ok {
+			cmd.run(os.Args[2:])
+			return
+		}
+	}
+
+	flag.Usage = usage
+	pf, compileOut := addTopLevelFlags(flag.CommandLine)
 	flag.Parse()
 
 	args := flag.Args()
 	if *compileOut != "" {
 		if len(args) == 0 {
 			fmt.Fprintln(os.Stderr, "compile mode requires a BASIC file argument")
-			os.Exit(1)
+			os.Exit(exitUsage)
 		}
 		compileFile(args[0], *compileOut)
 		return
 	}
 
-	if len(args) > 0 {
-		runFile(args[0])
-		return
+	if !pf.run(args) {
+		runREPL()
 	}
+}
 
-	runREPL()
+// addTopLevelFlags registers the flags accepted without a subcommand: those
+// of run, repl and compile together, as before subcommands existed.
+func addTopLevelFlags(fs *flag.FlagSet) (*programFlags, *string) {
+	addRuntimeFlags(fs)
+	pf := &programFlags{}
+	pf.add(fs)
+	compileOut := fs.String("compile", "", "write Go source for the BASIC program to this file (use '-' for stdout)")
+	fs.BoolVar(&dropDead, "drop-dead", false, "with -compile, leave out lines that can never run")
+	fs.StringVar(&initFile, "init", "", "REPL startup script to run instead of ~/.basicrc")
+	return pf, compileOut
 }
 
 func runFile(filename string) {
-	content, err := os.ReadFile(filename)
+	var content string
+	var err error
+	if filename == "-" {
+		content, err = readStdinProgram()
+	} else {
+		content, err = readProgram(filename)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitFileError)
 	}
+	runSource(content)
+}
 
-	l := lexer.New(string(content))
+// readStdinProgram reads the whole program from standard input, for
+// "basic -". The program's own INPUT statements then find input exhausted.
+func readStdinProgram() (string, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return readProgramSource("<stdin>", string(data))
+}
+
+// runSource parses and runs a complete program and exits: with the
+// program's END or SYSTEM status if it finishes, otherwise with the exit
+// code for what went wrong.
+func runSource(content string) {
+	if dumpTokens {
+		printTokens(content)
+		os.Exit(0)
+	}
+
+	l := newLexer(content)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
 	if len(p.Errors()) > 0 {
-		fmt.Println("Parser errors:")
-		for _, msg := range p.Errors() {
-			fmt.Println("\t" + msg)
+		printParseErrors(os.Stdout, p.ErrorList())
+		os.Exit(exitSyntaxError)
+	}
+	if dumpAST {
+		printAST(program)
+		os.Exit(0)
+	}
+	optimize.Program(program, optimize.Options{Dialect: basicDialect, MaxStringLength: maxStringLength})
+	if !checkProgram(program) {
+		os.Exit(exitSyntaxError)
+	}
+	if engine == "vm" {
+		runVM(program)
+		return
+	}
+
+	eval := newEvaluator(program)
+	var prof *coverage.Profile
+	if showCover || coverProfile != "" {
+		prof = coverage.New(program)
+		eval.SetHooks(prof.Hooks())
+	}
+	release := catchInterrupts(eval)
+	var before, after runtime.MemStats
+	if showTime {
+		runtime.ReadMemStats(&before)
+	}
+	start := time.Now()
+	err := eval.Run(context.Background())
+	elapsed := time.Since(start)
+	if showTime {
+		runtime.ReadMemStats(&after)
+	}
+	release()
+
+	status := runStatus(err, eval.ExitStatus())
+	if showTime {
+		stats := eval.Stats()
+		reportStats(&stats, elapsed, after.Mallocs-before.Mallocs)
+	}
+	if prof != nil && !reportCoverage(prof) && status == 0 {
+		status = exitFileError
+	}
+	os.Exit(status)
+}
+
+// printAST prints program as the parser built it, in the JSON of ast.JSON.
+func printAST(program *ast.Program) {
+	data, err := ast.JSON(program)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitRuntimeError)
+	}
+	fmt.Println(string(data))
+}
+
+// newLexer returns a lexer for src that reads strings as basicDialect
+// does.
+func newLexer(src string) *lexer.Lexer {
+	l := lexer.New(src)
+	l.SetDialect(basicDialect)
+	return l
+}
+
+// printTokens prints the tokens the lexer makes of src, one a line with
+// its position, type and literal, up to and including the EOF.
+func printTokens(src string) {
+	l := newLexer(src)
+	for {
+		tok := l.NextToken()
+		fmt.Printf("%-8v %-10s %q\n", tok.Pos(), tok.Type, tok.Literal)
+		if tok.Type == token.EOF {
+			return
+		}
+	}
+}
+
+// checkProgram prints the jumps in program to lines it does not have, with
+// -strict its type mismatches, and with -strict-dartmouth what it has that
+// Dartmouth BASIC did not, as the parser's errors are printed. It reports
+// whether there were none.
+func checkProgram(program *ast.Program) bool {
+	ok := true
+	if undefined := check.UndefinedTargets(program); len(undefined) > 0 {
+		fmt.Println("Undefined line numbers:")
+		for _, u := range undefined {
+			fmt.Printf("\t%v\n", u)
+		}
+		ok = false
+	}
+	if strictDartmouth {
+		if problems := check.Dartmouth1964(program); len(problems) > 0 {
+			fmt.Println("Not Dartmouth BASIC:")
+			for _, problem := range problems {
+				fmt.Printf("\t%v\n", problem)
+			}
+			ok = false
+		}
+	}
+	if !strict {
+		return ok
+	}
+	if problems := check.Types(program); len(problems) > 0 {
+		fmt.Println("Type errors:")
+		for _, problem := range problems {
+			fmt.Printf("\t%v\n", problem)
+		}
+		ok = false
+	}
+	return ok
+}
+
+// checkJumps prints the NEXT statements in program that no FOR starts and
+// its jumps to labels it does not have, which a compiled program would
+// only stop on when it reached them. It reports whether there were none.
+func checkJumps(program *ast.Program) bool {
+	ok := true
+	if unmatched := check.UnmatchedNexts(program); len(unmatched) > 0 {
+		fmt.Println("NEXT without FOR:")
+		for _, problem := range unmatched {
+			fmt.Printf("\t%v\n", problem)
 		}
-		os.Exit(1)
+		ok = false
 	}
+	if undefined := check.UndefinedLabels(program); len(undefined) > 0 {
+		fmt.Println("Undefined labels:")
+		for _, problem := range undefined {
+			fmt.Printf("\t%v\n", problem)
+		}
+		ok = false
+	}
+	return ok
+}
 
-	eval := evaluator.New(program)
-	if err := eval.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Runtime error: %v\n", err)
-		os.Exit(1)
+// runStatus reports how a run that ended with err stopped, and returns
+// the exit code for it: status, the program's own, if it finished.
+func runStatus(err error, status int) int {
+	var brk *evaluator.BreakError
+	if errors.As(err, &brk) {
+		fmt.Fprintf(os.Stderr, "\n%v\n", brk)
+		return exitBreak
 	}
+	if err != nil {
+		reportRuntimeError(err)
+		if errors.Is(err, evaluator.ErrExecutionLimit) {
+			return exitLimit
+		}
+		return exitRuntimeError
+	}
+	return status
+}
+
+// reportCoverage prints the -cover listing to stderr and writes the
+// -coverprofile file. It reports false if the file could not be written.
+func reportCoverage(prof *coverage.Profile) bool {
+	if showCover {
+		fmt.Fprintln(os.Stderr)
+		prof.WriteListing(os.Stderr)
+	}
+	if coverProfile == "" {
+		return true
+	}
+	f, err := os.Create(coverProfile)
+	if err == nil {
+		err = prof.WriteJSON(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing coverage: %v\n", err)
+		return false
+	}
+	return true
+}
+
+// reportStats prints the -time report to stderr, after the program's own
+// output. allocs is the number of heap allocations made during the run.
+// stats is nil for the VM, which does not count statements.
+func reportStats(stats *evaluator.Stats, elapsed time.Duration, allocs uint64) {
+	fmt.Fprintf(os.Stderr, "\nTime:        %v\n", elapsed.Round(time.Microsecond))
+	if stats == nil {
+		fmt.Fprintf(os.Stderr, "Allocations: %d\n", allocs)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Statements:  %d", stats.Statements)
+	if secs := elapsed.Seconds(); secs > 0 {
+		fmt.Fprintf(os.Stderr, " (%.0f per second)", float64(stats.Statements)/secs)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Allocations: %d", allocs)
+	if stats.Statements > 0 {
+		fmt.Fprintf(os.Stderr, " (%.2f per statement)", float64(allocs)/float64(stats.Statements))
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Peak memory: %d variables, %d array elements, about %d bytes\n", stats.PeakVariables, stats.PeakElements, stats.PeakBytes)
+}
+
+// lineFlag collects a repeatable flag, such as -e or -answer, one line of
+// text per use.
+type lineFlag []string
+
+func (s *lineFlag) String() string { return strings.Join(*s, "\n") }
+
+func (s *lineFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// newEvaluator prepares an evaluator with the CLI's current settings.
+func newEvaluator(program *ast.Program) *evaluator.Evaluator {
+	eval := evaluator.New(program, evaluator.Options{})
+	eval.SetPageLength(pageLength)
+	eval.SetMaxGosubDepth(maxGosubDepth)
+	eval.SetMaxStringLength(maxStringLength)
+	eval.SetMaxArrayCells(maxArrayCells)
+	eval.SetArgs(programArgs)
+	eval.SetShellEnabled(!noShell)
+	eval.SetDialect(basicDialect)
+	eval.SetMaxSteps(maxSteps)
+	eval.SetTimeout(timeout)
+	if script != nil {
+		eval.SetInput(script)
+	}
+	return eval
 }
 
 func compileFile(filename, output string) {
-	content, err := os.ReadFile(filename)
+	code := compileProgram(filename)
+
+	if output == "-" {
+		fmt.Print(code)
+		return
+	}
+
+	if err := os.WriteFile(output, []byte(code), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
+		os.Exit(exitFileError)
+	}
+	fmt.Printf("Go source written to %s\n", output)
+	// The source imports the runtime, which is in this module, so go build
+	// run on it elsewhere cannot find it; compile -build brings a copy.
+	fmt.Printf("Build with: basic compile -build -o %s %s\n", executableName(filename), filename)
+	if sourceMap != "" {
+		fmt.Printf("Source map written to %s\n", sourceMap)
+	}
+}
+
+// buildFile compiles a program and builds it into the executable output.
+func buildFile(filename, output string) {
+	code := compileProgram(filename)
+	if err := buildExecutable(code, output); err != nil {
+		fmt.Fprintf(os.Stderr, "Build error: %v\n", err)
+		os.Exit(exitRuntimeError)
+	}
+	fmt.Printf("Executable written to %s\n", output)
+	if sourceMap != "" {
+		fmt.Printf("Source map written to %s\n", sourceMap)
+	}
+}
+
+// buildWasmFile compiles a program and builds it for the browser into the
+// directory dir.
+func buildWasmFile(filename, dir string) {
+	code := compileProgram(filename)
+	name := strings.TrimSuffix(wasmDirName(filename), "_wasm")
+	if err := buildWasm(code, dir, name); err != nil {
+		fmt.Fprintf(os.Stderr, "Build error: %v\n", err)
+		os.Exit(exitRuntimeError)
+	}
+	fmt.Printf("WebAssembly written to %s\n", dir)
+	fmt.Printf("Serve it with any web server, such as: cd %s && python3 -m http.server\n", dir)
+	if sourceMap != "" {
+		fmt.Printf("Source map written to %s\n", sourceMap)
+	}
+}
+
+// compileProgram reads, checks and compiles a program to Go source, exiting
+// with the status for whatever stops it.
+func compileProgram(filename string) string {
+	program := loadForCompile(filename)
+	code, err := compiler.Compile(program, compiler.Options{Dialect: basicDialect})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Compile error: %v\n", err)
+		os.Exit(exitRuntimeError)
+	}
+	if sourceMap != "" {
+		writeSourceMap(filename, program, code)
+	}
+	return code
+}
+
+// loadForCompile reads, parses and checks a program for compile, exiting
+// with the status for whatever stops it.
+func loadForCompile(filename string) *ast.Program {
+	var content string
+	var err error
+	if filename == "-" {
+		content, err = readStdinProgram()
+	} else {
+		content, err = readProgram(filename)
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error reading file: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitFileError)
 	}
 
-	l := lexer.New(string(content))
+	l := newLexer(content)
 	p := parser.New(l)
 	program := p.ParseProgram()
 
 	if len(p.Errors()) > 0 {
-		fmt.Println("Parser errors:")
-		for _, msg := range p.Errors() {
-			fmt.Println("\t" + msg)
-		}
-		os.Exit(1)
+		printParseErrors(os.Stdout, p.ErrorList())
+		os.Exit(exitSyntaxError)
+	}
+
+	optimize.Program(program, optimize.Options{Dialect: basicDialect})
+	if ok := checkProgram(program); !checkJumps(program) || !ok {
+		os.Exit(exitSyntaxError)
+	}
+	if dropDead {
+		optimize.DropDeadLines(program)
 	}
+	return program
+}
 
-	code, err := compiler.Compile(program)
+// translateFile translates a program into the language target, writing it
+// to output, or standard output for -.
+func translateFile(filename, output, target string) {
+	code, err := transpile.Translate(loadForCompile(filename), target, compiler.Options{Dialect: basicDialect})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Compile error: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitRuntimeError)
 	}
 
 	if output == "-" {
 		fmt.Print(code)
 		return
 	}
-
 	if err := os.WriteFile(output, []byte(code), 0644); err != nil {
 		fmt.Fprintf(os.Stderr, "Error writing output: %v\n", err)
-		os.Exit(1)
+		os.Exit(exitFileError)
+	}
+	language, run := "Python", "python3"
+	if target == "javascript" {
+		language, run = "JavaScript", "node"
+	}
+	fmt.Printf("%s source written to %s\n", language, output)
+	fmt.Printf("Run with: %s %s\n", run, output)
+}
+
+// writeSourceMap writes the source map of code, compiled from program, to
+// the file named by -sourcemap.
+func writeSourceMap(filename string, program *ast.Program, code string) {
+	m := compiler.MapSource(program, code)
+	if filename != "-" {
+		m.Source = filename
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err == nil {
+		err = os.WriteFile(sourceMap, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing source map: %v\n", err)
+		os.Exit(exitFileError)
 	}
-	fmt.Printf("Go source written to %s\n", output)
-	fmt.Printf("Build with: go build -o basic_out %s\n", output)
-	fmt.Printf("Run with:   go run %s\n", output)
 }
 
 func runREPL() {
 	fmt.Println("BASIC Interpreter v1.0")
-	fmt.Println("Type 'EXIT' to quit, 'RUN' to execute, 'LIST' to show program")
+	fmt.Println("Type 'EXIT' to quit, 'RUN' to execute, 'LIST' to show program, 'HELP' for help")
 	fmt.Println()
 
-	scanner := bufio.NewScanner(os.Stdin)
-	lines := make(map[int]string)
+	editor := lineedit.New(os.Stdin, os.Stdout)
+	if path := historyFile(); path != "" {
+		if err := editor.SetHistoryFile(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: history not loaded: %v\n", err)
+		}
+	}
+	r := &repl{
+		editor:     editor,
+		workspaces: map[int]*workspace{1: newWorkspace()},
+		current:    1,
+		dbg:        newDebugger(),
+	}
+	r.ws = r.workspaces[r.current]
+	editor.Complete = func(before string) (int, []string) {
+		return completeLine(r.ws.lines, before)
+	}
+	if !r.runInitFile() {
+		return
+	}
 
 	for {
-		fmt.Print("> ")
-		if !scanner.Scan() {
+		text, err := editor.ReadLine(workspacePrompt(r.current))
+		if errors.Is(err, lineedit.ErrInterrupted) {
+			continue
+		}
+		if err != nil || !r.command(text) {
 			break
 		}
+	}
+}
 
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" {
-			continue
-		}
+// repl is the state of an interactive session.
+type repl struct {
+	editor     *lineedit.Editor
+	workspaces map[int]*workspace
+	current    int
+	ws         *workspace
+	dbg        *debugger
+}
 
-		upperLine := strings.ToUpper(line)
+// command carries out one line typed at the prompt: a REPL command, a
+// program line to store, or a statement to run at once. It returns false
+// when the line asks to leave the REPL.
+func (r *repl) command(text string) bool {
+	line := token.ExpandAbbreviations(strings.TrimSpace(text))
+	if line == "" {
+		return true
+	}
 
-		if upperLine == "EXIT" || upperLine == "QUIT" {
-			break
+	upperLine := strings.ToUpper(line)
+
+	if upperLine == "EXIT" || upperLine == "QUIT" || upperLine == "SYSTEM" {
+		return false
+	}
+
+	if upperLine == "RUN" {
+		var broke bool
+		r.ws.session = evaluator.NewEnvironment()
+		r.ws.last, broke = runProgram(r.ws.lines, r.dbg, r.ws.session)
+		r.ws.stopped = nil
+		if broke {
+			r.ws.stopped = r.ws.last
 		}
+		r.ws.stoppedSource = programSource(r.ws.lines)
+		return true
+	}
 
-		if upperLine == "RUN" {
-			runProgram(lines)
-			continue
+	if upperLine == "WORKSPACE" || strings.HasPrefix(upperLine, "WORKSPACE ") {
+		n, err := workspaceCommand(r.workspaces, r.current, strings.TrimSpace(line[len("WORKSPACE"):]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
+		r.current, r.ws = n, r.workspaces[n]
+		return true
+	}
 
-		if upperLine == "DELETE" || strings.HasPrefix(upperLine, "DELETE ") {
-			arg := strings.TrimSpace(line[len("DELETE"):])
-			if arg == "" {
-				fmt.Println("Usage: DELETE <n> or DELETE <n-m>")
-				continue
-			}
-			deleted, err := deleteLines(lines, arg)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-				continue
-			}
-			if deleted == 0 {
-				fmt.Println("No matching lines to delete")
-			} else {
-				fmt.Printf("Deleted %d line(s)\n", deleted)
-			}
-			continue
+	if upperLine == "HELP" || strings.HasPrefix(upperLine, "HELP ") {
+		if err := showHelp(strings.TrimSpace(line[len("HELP"):])); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
+		return true
+	}
 
-		if upperLine == "LOAD" || strings.HasPrefix(upperLine, "LOAD ") {
-			filename := strings.TrimSpace(line[len("LOAD"):])
-			if filename == "" {
-				fmt.Println("Usage: LOAD <file.bas>")
-				continue
-			}
-			loaded, err := loadProgramFromFile(filename)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error loading program: %v\n", err)
-				continue
+	if upperLine == "VARS" {
+		showVars(r.ws.last)
+		return true
+	}
+
+	if upperLine == "STEP" {
+		if r.ws.stopped == nil || programSource(r.ws.lines) != r.ws.stoppedSource {
+			if r.ws.stopped = loadProgram(r.ws.lines); r.ws.stopped == nil {
+				return true
 			}
-			lines = loaded
-			fmt.Printf("Loaded %d lines from %s\n", len(lines), filename)
-			continue
+			r.ws.session = evaluator.NewEnvironment()
+			r.ws.stopped.SetEnvironment(r.ws.session)
+			r.ws.last = r.ws.stopped
+			r.ws.stoppedSource = programSource(r.ws.lines)
+			r.dbg.attach(r.ws.stopped)
 		}
+		if !r.dbg.step(r.ws.stopped, r.ws.lines) {
+			r.ws.stopped = nil
+		}
+		return true
+	}
 
-		if upperLine == "SAVE" || strings.HasPrefix(upperLine, "SAVE ") {
-			filename := strings.TrimSpace(line[len("SAVE"):])
-			if filename == "" {
-				fmt.Println("Usage: SAVE <file.bas>")
-				continue
-			}
-			if len(lines) == 0 {
-				fmt.Println("No program to save")
-				continue
-			}
-			if err := saveProgramToFile(lines, filename); err != nil {
-				fmt.Fprintf(os.Stderr, "Error saving program: %v\n", err)
-				continue
-			}
-			fmt.Printf("Saved %d lines to %s\n", len(lines), filename)
-			continue
+	if upperLine == "BREAK" || strings.HasPrefix(upperLine, "BREAK ") {
+		if err := r.dbg.breakCommand(r.ws.lines, strings.TrimSpace(line[len("BREAK"):])); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
+		return true
+	}
 
-		if upperLine == "LIST" || strings.HasPrefix(upperLine, "LIST ") {
-			arg := ""
-			if len(line) > len("LIST") {
-				arg = strings.TrimSpace(line[len("LIST"):])
-			}
-			if err := listProgram(lines, arg); err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			}
-			continue
+	if upperLine == "WATCH" || strings.HasPrefix(upperLine, "WATCH ") {
+		if err := r.dbg.watchCommand(r.ws.stopped, strings.TrimSpace(line[len("WATCH"):])); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		}
+		return true
+	}
 
-		if upperLine == "CLEAR" || upperLine == "NEW" {
-			lines = make(map[int]string)
-			fmt.Println("Program cleared")
-			continue
+	if upperLine == "CONT" || upperLine == "CONTINUE" {
+		// As in classic BASIC, a program cannot be continued once
+		// it has been changed.
+		if r.ws.stopped == nil || programSource(r.ws.lines) != r.ws.stoppedSource {
+			fmt.Println("Can't continue")
+			return true
 		}
+		if !execute(r.ws.stopped, r.ws.stopped.Continue) {
+			r.ws.stopped = nil
+		}
+		return true
+	}
 
-		l := lexer.New(line)
-		p := parser.New(l)
-		program := p.ParseProgram()
+	if upperLine == "SAVESTATE" || strings.HasPrefix(upperLine, "SAVESTATE ") {
+		if err := saveState(r.ws, strings.Trim(strings.TrimSpace(line[len("SAVESTATE"):]), `"`)); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
 
-		if err := handleProgramInput(program, p.Errors(), line, lines, true, true); err != nil {
+	if upperLine == "LOADSTATE" || strings.HasPrefix(upperLine, "LOADSTATE ") {
+		if err := loadState(r.ws, r.dbg, strings.Trim(strings.TrimSpace(line[len("LOADSTATE"):]), `"`)); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			continue
+			return true
+		}
+		showNext(r.ws.stopped, r.ws.lines)
+		return true
+	}
+
+	if upperLine == "DELETE" || strings.HasPrefix(upperLine, "DELETE ") {
+		arg := strings.TrimSpace(line[len("DELETE"):])
+		if arg == "" {
+			fmt.Println("Usage: DELETE <n> or DELETE <n-m>")
+			return true
+		}
+		deleted, err := deleteLines(r.ws.lines, arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return true
+		}
+		if deleted == 0 {
+			fmt.Println("No matching lines to delete")
+		} else {
+			fmt.Printf("Deleted %d line(s)\n", deleted)
 		}
+		return true
 	}
+
+	if upperLine == "EDIT" || strings.HasPrefix(upperLine, "EDIT ") {
+		edited, err := editLine(r.editor, r.ws.lines, strings.TrimSpace(line[len("EDIT"):]))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return true
+		}
+		if edited == "" {
+			return true
+		}
+		line = edited
+	}
+
+	if upperLine == "LOAD" || strings.HasPrefix(upperLine, "LOAD ") {
+		filename := strings.Trim(strings.TrimSpace(line[len("LOAD"):]), `"`)
+		if filename == "" {
+			fmt.Println("Usage: LOAD <file.bas>")
+			return true
+		}
+		loaded, err := loadProgramFromFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error loading program: %v\n", err)
+			return true
+		}
+		r.ws.lines = loaded
+		fmt.Printf("Loaded %d lines from %s\n", len(r.ws.lines), filename)
+		return true
+	}
+
+	if upperLine == "SAVE" || strings.HasPrefix(upperLine, "SAVE ") {
+		filename, format := splitSaveFormat(strings.TrimSpace(line[len("SAVE"):]))
+		if filename == "" || format == "" {
+			fmt.Println("Usage: SAVE <file.bas>[,A|,T|,P]")
+			return true
+		}
+		if len(r.ws.lines) == 0 {
+			fmt.Println("No program to save")
+			return true
+		}
+		if err := saveProgramToFile(r.ws.lines, filename, format); err != nil {
+			fmt.Fprintf(os.Stderr, "Error saving program: %v\n", err)
+			return true
+		}
+		fmt.Printf("Saved %d lines to %s\n", len(r.ws.lines), filename)
+		return true
+	}
+
+	if upperLine == "FIND" || strings.HasPrefix(upperLine, "FIND ") {
+		if err := findLines(r.ws.lines, line[len("FIND"):]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if upperLine == "CHANGE" || strings.HasPrefix(upperLine, "CHANGE ") {
+		if err := changeLines(r.ws.lines, line[len("CHANGE"):]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if upperLine == "LLIST" || strings.HasPrefix(upperLine, "LLIST ") {
+		if err := listToFile(r.ws.lines, strings.TrimSpace(line[len("LLIST"):]), printerFile, true); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if upperLine == "LIST" || strings.HasPrefix(upperLine, "LIST>") || strings.HasPrefix(upperLine, "LIST ") {
+		arg := ""
+		if len(line) > len("LIST") {
+			arg = strings.TrimSpace(line[len("LIST"):])
+		}
+		if err := listProgram(r.ws.lines, arg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if upperLine == "VERIFY" || strings.HasPrefix(upperLine, "VERIFY ") {
+		if err := verifyProgram(os.Stdout, r.ws.lines, strings.TrimSpace(line[len("VERIFY"):])); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if upperLine == "SET" || strings.HasPrefix(upperLine, "SET ") {
+		if err := setOption(strings.TrimSpace(line[len("SET"):])); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if upperLine == "CLEAR" {
+		r.ws.session = evaluator.NewEnvironment()
+		r.ws.stopped, r.ws.last = nil, nil
+		fmt.Println("Variables cleared")
+		return true
+	}
+
+	if upperLine == "NEW" {
+		r.ws.lines = make(map[int]string)
+		r.ws.session = evaluator.NewEnvironment()
+		r.ws.stopped, r.ws.last = nil, nil
+		fmt.Println("Program cleared")
+		return true
+	}
+
+	if command := misspelledCommand(line); command != "" {
+		fmt.Fprintf(os.Stderr, "Error: unknown command %s; did you mean %s?\n", strings.Fields(line)[0], command)
+		return true
+	}
+
+	l := newLexer(line)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	// Statements typed without a line number see and change the
+	// variables of the last RUN, or of the program that is stopped.
+	if stmt, ok := program.Statements[0]; ok && len(program.Statements) == 1 && len(p.Errors()) == 0 {
+		var err error
+		if r.ws.stopped != nil {
+			err = r.ws.stopped.Exec(stmt)
+		} else {
+			eval := newEvaluator(program)
+			eval.SetEnvironment(r.ws.session)
+			err = eval.Run(context.Background())
+			r.ws.last = eval
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		return true
+	}
+
+	if err := handleProgramInput(program, p.Errors(), line, r.ws.lines, true, true); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	}
+	return true
+}
+
+// misspelledCommand returns the REPL command that a typed line looks like a
+// slip for, as LIST for LSIT, or "" if it starts with a line number, a
+// keyword or a function, or is not close to a command.
+func misspelledCommand(line string) string {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+	word := strings.ToUpper(fields[0])
+	if isDigit(word[0]) || token.LookupIdent(word) != token.IDENT || token.IsBuiltin(word) {
+		return ""
+	}
+	return token.Nearest(word, catalog.Names(catalog.Command))
+}
+
+// historyFile is where the REPL keeps its history between sessions:
+// $BASIC_HISTORY if that is set, otherwise .basic_history in the home
+// directory. It returns "" when there is nowhere to keep it.
+func historyFile() string {
+	if path, ok := os.LookupEnv("BASIC_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".basic_history")
+}
+
+// editLine lets the user change program line arg in place and returns the
+// edited text, to be entered as if it had been typed. It returns "" when
+// there is nothing to enter: the edit was cancelled, or input is not a
+// terminal, in which case the line is printed so it can be retyped.
+func editLine(editor *lineedit.Editor, lines map[int]string, arg string) (string, error) {
+	if arg == "" {
+		return "", fmt.Errorf("usage: EDIT <line>")
+	}
+	lineNum, err := strconv.Atoi(arg)
+	if err != nil {
+		return "", fmt.Errorf("invalid line number: %s", arg)
+	}
+	text, ok := lines[lineNum]
+	if !ok {
+		return "", fmt.Errorf("line %d not found", lineNum)
+	}
+
+	edited, err := editor.Edit("", text)
+	switch {
+	case errors.Is(err, term.ErrUnsupported):
+		fmt.Println(text)
+		return "", nil
+	case errors.Is(err, lineedit.ErrInterrupted), errors.Is(err, io.EOF):
+		return "", nil
+	case err != nil:
+		return "", err
+	}
+	return strings.TrimSpace(edited), nil
 }
 
-func runProgram(lines map[int]string) {
+// runProgram runs the stored program under the debugger's breakpoints and
+// watches, keeping its variables in env. It returns the evaluator, nil if the program would not parse,
+// and whether the program was stopped, by Ctrl-C or the debugger, so that
+// CONT can resume it.
+func runProgram(lines map[int]string, dbg *debugger, env *evaluator.Environment) (*evaluator.Evaluator, bool) {
+	eval := loadProgram(lines)
+	if eval == nil {
+		return nil, false
+	}
+	eval.SetEnvironment(env)
+	dbg.attach(eval)
+	return eval, execute(eval, eval.Run)
+}
+
+// loadProgram parses the stored program and prepares an evaluator for it,
+// reporting any parser errors and returning nil if there are some.
+func loadProgram(lines map[int]string) *evaluator.Evaluator {
 	if len(lines) == 0 {
 		fmt.Println("No program to run")
-		return
+		return nil
 	}
 
-	lineNums := sortedLineNumbers(lines)
+	l := newLexer(programSource(lines))
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) > 0 {
+		printParseErrors(os.Stdout, p.ErrorList())
+		return nil
+	}
+	if !checkProgram(program) {
+		return nil
+	}
+
+	return newEvaluator(program)
+}
+
+// programSource joins the stored lines into program text, in line order.
+func programSource(lines map[int]string) string {
 	var programText strings.Builder
-	for _, num := range lineNums {
+	for _, num := range sortedLineNumbers(lines) {
 		programText.WriteString(lines[num])
 		programText.WriteByte('\n')
 	}
+	return programText.String()
+}
 
-	l := lexer.New(programText.String())
-	p := parser.New(l)
-	program := p.ParseProgram()
-
-	if len(p.Errors()) > 0 {
-		fmt.Println("Parser errors:")
-		for _, msg := range p.Errors() {
-			fmt.Println("\t" + msg)
+// setOption handles the REPL's SET command. With no argument it shows the
+// current settings.
+func setOption(arg string) error {
+	fields := strings.Fields(strings.ToUpper(arg))
+	if len(fields) == 0 {
+		if pageLength > 0 {
+			fmt.Printf("PAGE %d\n", pageLength)
+		} else {
+			fmt.Println("PAGE OFF")
 		}
-		return
+		fmt.Printf("PRINTER %s\n", printerFile)
+		fmt.Printf("PROMPT %q\n", promptText)
+		return nil
 	}
 
-	eval := evaluator.New(program)
-	if err := eval.Run(); err != nil {
-		fmt.Fprintf(os.Stderr, "Runtime error: %v\n", err)
+	switch fields[0] {
+	case "PAGE":
+		if len(fields) != 2 {
+			return fmt.Errorf("usage: SET PAGE <lines> or SET PAGE OFF")
+		}
+		if fields[1] == "OFF" {
+			pageLength = 0
+			return nil
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 2 {
+			return fmt.Errorf("page length must be a number of at least 2")
+		}
+		pageLength = n
+		return nil
+	case "PROMPT":
+		return setPrompt(strings.TrimSpace(arg)[len("PROMPT"):])
+	case "PRINTER":
+		// The file name keeps the case it was typed in.
+		names := strings.Fields(arg)
+		if len(names) != 2 {
+			return fmt.Errorf("usage: SET PRINTER <file>")
+		}
+		printerFile = names[1]
+		return nil
+	default:
+		return fmt.Errorf("unknown option %s", fields[0])
 	}
 }
 
+// listProgram handles LIST. arg is an optional range, optionally followed
+// by >file to write the listing to a file instead of the screen, or >>file
+// to add it to the end of one.
 func listProgram(lines map[int]string, arg string) error {
+	rangeArg, target, appendTo := arg, "", false
+	if i := strings.Index(arg, ">"); i >= 0 {
+		rangeArg, target = arg[:i], arg[i+1:]
+		if strings.HasPrefix(target, ">") {
+			target, appendTo = target[1:], true
+		}
+		target = strings.TrimSpace(target)
+		if target == "" {
+			return fmt.Errorf("usage: LIST [range] >file")
+		}
+	}
+	if target == "" {
+		return writeListing(os.Stdout, lines, rangeArg)
+	}
+	return listToFile(lines, rangeArg, target, appendTo)
+}
+
+// listToFile writes the listing of the lines in rangeArg to the named file,
+// replacing it or, with appendTo, adding to its end.
+func listToFile(lines map[int]string, rangeArg, filename string, appendTo bool) error {
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendTo {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	f, err := os.OpenFile(filename, flags, 0644)
+	if err != nil {
+		return err
+	}
+	if err := writeListing(f, lines, rangeArg); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeListing(w io.Writer, lines map[int]string, arg string) error {
 	if len(lines) == 0 {
 		fmt.Println("No program")
 		return nil
@@ -256,12 +1080,24 @@ func listProgram(lines map[int]string, arg string) error {
 	}
 
 	lineNums := sortedLineNumbers(lines)
+	if hasRange {
+		lineNums = lineNums[sort.SearchInts(lineNums, start):]
+	}
+
+	// Large listings are written through one buffer rather than a syscall
+	// per line.
+	out := bufio.NewWriter(w)
 	printed := false
 	for _, num := range lineNums {
-		if !hasRange || (num >= start && (end == -1 || num <= end)) {
-			fmt.Println(lines[num])
-			printed = true
+		if hasRange && end != -1 && num > end {
+			break
 		}
+		out.WriteString(lines[num])
+		out.WriteByte('\n')
+		printed = true
+	}
+	if err := out.Flush(); err != nil {
+		return err
 	}
 
 	if hasRange && !printed {
@@ -334,8 +1170,8 @@ func handleProgramInput(program *ast.Program, parseErrors []string, rawLine stri
 			if !allowImmediate {
 				return fmt.Errorf("line must start with a line number")
 			}
-			eval := evaluator.New(program)
-			if err := eval.Run(); err != nil {
+			eval := newEvaluator(program)
+			if err := eval.Run(context.Background()); err != nil {
 				return err
 			}
 		}
@@ -345,13 +1181,13 @@ func handleProgramInput(program *ast.Program, parseErrors []string, rawLine stri
 }
 
 func loadProgramFromFile(filename string) (map[int]string, error) {
-	content, err := os.ReadFile(filename)
+	content, err := readProgram(filename)
 	if err != nil {
 		return nil, err
 	}
 
 	loaded := make(map[int]string)
-	scanner := bufio.NewScanner(strings.NewReader(string(content)))
+	scanner := bufio.NewScanner(strings.NewReader(content))
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -359,7 +1195,7 @@ func loadProgramFromFile(filename string) (map[int]string, error) {
 			continue
 		}
 
-		l := lexer.New(line)
+		l := newLexer(line)
 		p := parser.New(l)
 		program := p.ParseProgram()
 		if err := handleProgramInput(program, p.Errors(), line, loaded, false, false); err != nil {
@@ -374,7 +1210,9 @@ func loadProgramFromFile(filename string) (map[int]string, error) {
 	return loaded, nil
 }
 
-func saveProgramToFile(lines map[int]string, filename string) error {
+// saveProgramToFile writes the program as text, format "A", or tokenized
+// as GW-BASIC saves it, "T", or protected as SAVE ,P does, "P".
+func saveProgramToFile(lines map[int]string, filename, format string) error {
 	lineNums := sortedLineNumbers(lines)
 	var builder strings.Builder
 
@@ -383,7 +1221,31 @@ func saveProgramToFile(lines map[int]string, filename string) error {
 		builder.WriteByte('\n')
 	}
 
-	return os.WriteFile(filename, []byte(builder.String()), 0644)
+	if format == "A" {
+		return os.WriteFile(filename, []byte(builder.String()), 0644)
+	}
+	data, err := fileformat.Encode(builder.String(), format == "P")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// splitSaveFormat splits the format GW-BASIC style off a SAVE argument:
+// "prog.bas",P is prog.bas in format "P". The quotes are optional. Text,
+// "A", is the default; an unknown format comes back as "".
+func splitSaveFormat(arg string) (filename, format string) {
+	filename, format = arg, "A"
+	if i := strings.LastIndexByte(arg, ','); i >= 0 {
+		filename = strings.TrimSpace(arg[:i])
+		format = strings.ToUpper(strings.TrimSpace(arg[i+1:]))
+		switch format {
+		case "A", "T", "P":
+		default:
+			format = ""
+		}
+	}
+	return strings.Trim(filename, `"`), format
 }
 
 func sortedLineNumbers(lines map[int]string) []int {
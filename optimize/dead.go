@@ -0,0 +1,255 @@
+package optimize
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// DeadCode is code that can never run: a whole line that no path through
+// the program reaches, or the statements of a line after one that always
+// leaves it, such as END or GOTO.
+type DeadCode struct {
+	Line int
+	// From is the position, among the line's statements separated by ':',
+	// of the first that cannot run; it is 0 when the whole line cannot.
+	From int
+	// After names the statement that leaves the line when From is not 0.
+	After string
+}
+
+func (d DeadCode) String() string {
+	if d.From > 0 {
+		return fmt.Sprintf("line %d: statements after %s can never run", d.Line, d.After)
+	}
+	return fmt.Sprintf("line %d can never run", d.Line)
+}
+
+// FindDeadCode lists, in line order, the code in program that can never
+// run. A line is reached by running on from the line before it, unless
+// that line always leaves, or by a GOTO, GOSUB, ON TIMER, CALL or FOR that
+// names or skips to it. A GOTO or GOSUB to a computed line could go
+// anywhere, so a program with one has no unreachable lines. Lines holding
+// only REM, DATA or labels do nothing, so they are not reported.
+func FindDeadCode(program *ast.Program) []DeadCode {
+	g := newFlowGraph(program)
+	reached := g.reachable()
+	var dead []DeadCode
+	for i, line := range g.lines {
+		if !reached[i] {
+			if executable(g.code[i]) {
+				dead = append(dead, DeadCode{Line: line})
+			}
+			continue
+		}
+		if n := leaves(g.code[i]); n < len(g.code[i])-1 && executable(g.code[i][n+1:]) {
+			after := strings.ToUpper(g.code[i][n].TokenLiteral())
+			if _, ok := g.code[i][n].(*ast.EndSubStatement); ok {
+				after = "END SUB"
+			}
+			dead = append(dead, DeadCode{Line: line, From: n + 1, After: after})
+		}
+	}
+	return dead
+}
+
+// DropDeadLines removes from program the lines that can never run and
+// returns their numbers. Lines that READ or RESTORE may still need, those
+// holding DATA or named by a RESTORE, are kept, as are the lines of SUB
+// procedures; when a RESTORE names a computed line nothing is removed.
+func DropDeadLines(program *ast.Program) []int {
+	g := newFlowGraph(program)
+	keep := g.reachable()
+	for i, stmts := range g.code {
+		for _, stmt := range stmts {
+			if _, ok := stmt.(*ast.DataStatement); ok {
+				keep[i] = true
+			}
+		}
+	}
+	for _, proc := range program.Procedures {
+		for i, line := range g.lines {
+			if line >= proc.Line && line <= proc.EndLine {
+				keep[i] = true
+			}
+		}
+	}
+	for _, stmts := range g.code {
+		for _, stmt := range stmts {
+			ast.Inspect(stmt, func(node ast.Node) bool {
+				restore, ok := node.(*ast.RestoreStatement)
+				if !ok || restore.LineNumber == nil {
+					_, ok := node.(ast.Statement)
+					return ok
+				}
+				lit, ok := restore.LineNumber.(*ast.NumberLiteral)
+				if !ok {
+					for i := range keep {
+						keep[i] = true
+					}
+				} else if i, ok := g.lineIndex[int(lit.Value)]; ok {
+					keep[i] = true
+				}
+				return false
+			})
+		}
+	}
+
+	var dropped []int
+	for i, line := range g.lines {
+		if keep[i] {
+			continue
+		}
+		dropped = append(dropped, line)
+		delete(program.Statements, line)
+		delete(program.Source, line)
+	}
+	for label, line := range program.Labels {
+		if _, ok := program.Statements[line]; !ok {
+			delete(program.Labels, label)
+		}
+	}
+	return dropped
+}
+
+// flowGraph is a program laid out for following the paths control can
+// take through it.
+type flowGraph struct {
+	program   *ast.Program
+	lines     []int
+	lineIndex map[int]int
+	code      [][]ast.Statement
+	forNext   map[*ast.ForStatement]ast.LoopEnd
+}
+
+func newFlowGraph(program *ast.Program) *flowGraph {
+	g := &flowGraph{program: program, lineIndex: make(map[int]int, len(program.Statements))}
+	for line := range program.Statements {
+		g.lines = append(g.lines, line)
+	}
+	sort.Ints(g.lines)
+	g.code = make([][]ast.Statement, len(g.lines))
+	for i, line := range g.lines {
+		g.lineIndex[line] = i
+		g.code[i] = ast.Flatten(program.Statements[line])
+	}
+	g.forNext = ast.PairLoops(program, g.lines)
+	return g
+}
+
+// reachable marks the index of every line that some path from the first
+// line reaches.
+func (g *flowGraph) reachable() []bool {
+	reached := make([]bool, len(g.lines))
+	var work []int
+	visit := func(i int) {
+		if i >= 0 && i < len(reached) && !reached[i] {
+			reached[i] = true
+			work = append(work, i)
+		}
+	}
+	everywhere := func() {
+		for i := range reached {
+			visit(i)
+		}
+	}
+	target := func(expr ast.Expression) {
+		switch t := expr.(type) {
+		case *ast.NumberLiteral:
+			if i, ok := g.lineIndex[int(t.Value)]; ok {
+				visit(i)
+			}
+			return
+		case *ast.Identifier:
+			if line, ok := g.program.Labels[t.Value]; ok {
+				visit(g.lineIndex[line])
+				return
+			}
+		}
+		everywhere()
+	}
+
+	visit(0)
+	for len(work) > 0 {
+		i := work[len(work)-1]
+		work = work[:len(work)-1]
+		n := leaves(g.code[i])
+		runs := g.code[i]
+		if n < len(runs) {
+			runs = runs[:n+1]
+		}
+		for _, stmt := range runs {
+			ast.Inspect(stmt, func(node ast.Node) bool {
+				switch s := node.(type) {
+				case *ast.GotoStatement:
+					target(s.LineNumber)
+				case *ast.GosubStatement:
+					target(s.LineNumber)
+				case *ast.OnTimerStatement:
+					target(s.Target)
+				case *ast.ForStatement:
+					// A loop that runs no times carries on after its NEXT.
+					if next, ok := g.forNext[s]; ok {
+						visit(next.Line)
+					}
+				case *ast.CallStatement:
+					if proc, ok := g.program.Procedures[s.Name.Value]; ok {
+						// The call enters the SUB line but runs its body,
+						// not the skip over it that running into it takes.
+						header := g.lineIndex[proc.Line]
+						reached[header] = true
+						visit(header + 1)
+					}
+				case *ast.SubStatement:
+					// Running into a SUB skips its body.
+					if proc, ok := g.program.Procedures[s.Name.Value]; ok {
+						visit(g.lineIndex[proc.EndLine] + 1)
+					}
+				}
+				_, ok := node.(ast.Statement)
+				return ok
+			})
+		}
+		if n == len(g.code[i]) {
+			visit(i + 1)
+		}
+	}
+	return reached
+}
+
+// leaves returns the position of the first of stmts that always leaves
+// the line, or len(stmts) if control can run on to the next line.
+func leaves(stmts []ast.Statement) int {
+	for n, stmt := range stmts {
+		if alwaysLeaves(stmt) {
+			return n
+		}
+	}
+	return len(stmts)
+}
+
+func alwaysLeaves(stmt ast.Statement) bool {
+	switch s := stmt.(type) {
+	case *ast.GotoStatement, *ast.EndStatement, *ast.ReturnStatement, *ast.EndSubStatement, *ast.SubStatement:
+		return true
+	case *ast.SequenceStatement:
+		return leaves(s.Statements) < len(s.Statements)
+	case *ast.IfStatement:
+		return s.Alternative != nil && alwaysLeaves(s.Consequence) && alwaysLeaves(s.Alternative)
+	}
+	return false
+}
+
+// executable reports whether any of stmts does something when run.
+func executable(stmts []ast.Statement) bool {
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.RemStatement, *ast.DataStatement, *ast.LabelStatement:
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package optimize
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestFindDeadCode(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      []string
+	}{
+		{
+			name: "line jumped over",
+			src:  "10 GOTO 30\n20 PRINT 1\n30 PRINT 2\n",
+			want: []string{"line 20 can never run"},
+		},
+		{
+			name: "statements after END",
+			src:  "10 PRINT 1: END: PRINT 2\n",
+			want: []string{"line 10: statements after END can never run"},
+		},
+		{
+			name: "statements after GOTO",
+			src:  "10 GOTO 20: PRINT 1\n20 END\n",
+			want: []string{"line 10: statements after GOTO can never run"},
+		},
+		{
+			name: "lines after END",
+			src:  "10 END\n20 PRINT 1\n30 PRINT 2\n",
+			want: []string{"line 20 can never run", "line 30 can never run"},
+		},
+		{
+			name: "GOSUB target and the line after it returns to",
+			src:  "10 GOSUB 100\n20 PRINT \"BACK\"\n30 END\n40 PRINT \"DEAD\"\n100 PRINT \"SUB\"\n110 RETURN\n",
+			want: []string{"line 40 can never run"},
+		},
+		{
+			name: "IF jumps only sometimes",
+			src:  "10 LET X = 1\n20 IF X == 0 THEN GOTO 40\n30 PRINT 1\n40 END\n",
+		},
+		{
+			name: "IF leaving on both branches",
+			src:  "10 IF X == 0 THEN GOTO 30 ELSE END\n20 PRINT 1\n30 END\n",
+			want: []string{"line 20 can never run"},
+		},
+		{
+			name: "computed GOTO could go anywhere",
+			src:  "10 LET X = 30: GOTO X\n20 PRINT 1\n30 END\n",
+		},
+		{
+			name: "ON TIMER target",
+			src:  "10 ON TIMER(1) GOSUB 100: TIMER ON\n20 END\n100 PRINT \"TICK\"\n110 RETURN\n",
+		},
+		{
+			name: "FOR running no times goes past its NEXT",
+			src:  "10 FOR I = 2 TO 1\n20 PRINT I: GOTO 20\n30 NEXT I\n40 PRINT \"DONE\"\n",
+		},
+		{
+			name: "side effects on a dead line are still dead",
+			src:  "10 END\n20 PRINT RND(1): LET A$ = INPUT$(1)\n",
+			want: []string{"line 20 can never run"},
+		},
+		{
+			name: "called SUB",
+			src:  "10 CALL GREET\n20 END\n30 SUB GREET\n40 PRINT \"HI\"\n50 END SUB\n60 PRINT \"DEAD\"\n",
+			want: []string{"line 60 can never run"},
+		},
+		{
+			name: "REM, DATA and labels do nothing",
+			src:  "10 END\n20 REM NOTES\n30 DATA 1, 2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, dead := range FindDeadCode(parse(t, tt.src)) {
+				got = append(got, dead.String())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindDeadCode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDropDeadLines(t *testing.T) {
+	tests := []struct {
+		name, src      string
+		dropped, lines []int
+	}{
+		{
+			name:    "unreached lines go",
+			src:     "10 GOTO 40\n20 PRINT 1\n30 PRINT 2\n40 END\n",
+			dropped: []int{20, 30},
+			lines:   []int{10, 40},
+		},
+		{
+			name:  "statements after a jump stay",
+			src:   "10 PRINT 1: GOTO 20: PRINT 2\n20 END\n",
+			lines: []int{10, 20},
+		},
+		{
+			name:    "DATA stays for READ",
+			src:     "10 READ A: PRINT A: END\n20 PRINT \"DEAD\"\n30 DATA 7\n",
+			dropped: []int{20},
+			lines:   []int{10, 30},
+		},
+		{
+			name:    "RESTORE target stays",
+			src:     "10 RESTORE 30: END\n20 PRINT \"DEAD\"\n30 PRINT \"KEPT\"\n",
+			dropped: []int{20},
+			lines:   []int{10, 30},
+		},
+		{
+			name:  "computed RESTORE keeps everything",
+			src:   "10 LET L = 30: RESTORE L: END\n20 PRINT \"DEAD\"\n30 DATA 1\n",
+			lines: []int{10, 20, 30},
+		},
+		{
+			name:    "GOTO and GOSUB targets stay",
+			src:     "10 GOSUB 30: GOTO 50\n20 PRINT \"DEAD\"\n30 RETURN\n40 PRINT \"DEAD\"\n50 END\n",
+			lines:   []int{10, 30, 50},
+			dropped: []int{20, 40},
+		},
+		{
+			name:  "SUB bodies stay",
+			src:   "10 CALL GREET\n20 END\n30 SUB GREET\n40 PRINT \"HI\"\n50 END SUB\n",
+			lines: []int{10, 20, 30, 40, 50},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			program := parse(t, tt.src)
+			dropped := DropDeadLines(program)
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("dropped %v, want %v", dropped, tt.dropped)
+			}
+			var lines []int
+			for line := range program.Statements {
+				lines = append(lines, line)
+			}
+			sort.Ints(lines)
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("left lines %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+}
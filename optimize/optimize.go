@@ -0,0 +1,327 @@
+// Package optimize simplifies the expressions of a parsed program before it
+// runs or is compiled, so that neither the evaluator nor the generated Go
+// works out at run time what could be worked out once:
+//
+//	program := parser.New(lexer.New(source)).ParseProgram()
+//	optimize.Program(program, optimize.Options{Dialect: d})
+//
+// Constant subexpressions are folded into literals, as are strings joined
+// from literals, and multiplying or dividing a number by 1 is dropped. A
+// rewrite never changes what a program prints or which error it stops
+// with: anything that could fail, such as dividing by zero, is left for the
+// program to do.
+package optimize
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/token"
+)
+
+// Options adjusts how a program is optimized.
+type Options struct {
+	// Dialect gives the value of a true comparison; the zero value is
+	// dialect.Standard. It must be the dialect the program runs in.
+	Dialect dialect.Dialect
+	// MaxStringLength is the longest string the program may build, as set
+	// for the evaluator; longer joins are left to fail when they run. Zero
+	// or less means no limit.
+	MaxStringLength int
+}
+
+// Program rewrites the expressions of every statement in program in place.
+func Program(program *ast.Program, opts Options) {
+	for _, stmt := range program.Statements {
+		statement(stmt, opts)
+	}
+}
+
+// statement rewrites the expressions of stmt and of the statements inside
+// it.
+func statement(stmt ast.Statement, opts Options) {
+	opt := func(expr *ast.Expression) {
+		if *expr != nil {
+			*expr = Expression(*expr, opts)
+		}
+	}
+	list := func(exprs []ast.Expression) {
+		for i := range exprs {
+			opt(&exprs[i])
+		}
+	}
+	switch s := stmt.(type) {
+	case *ast.SequenceStatement:
+		for _, inner := range s.Statements {
+			statement(inner, opts)
+		}
+	case *ast.IfStatement:
+		opt(&s.Condition)
+		statement(s.Consequence, opts)
+		if s.Alternative != nil {
+			statement(s.Alternative, opts)
+		}
+	case *ast.PrintStatement:
+		list(s.Expressions)
+	case *ast.LetStatement:
+		opt(&s.Index)
+		opt(&s.Value)
+	case *ast.GotoStatement:
+		opt(&s.LineNumber)
+	case *ast.GosubStatement:
+		opt(&s.LineNumber)
+	case *ast.ForStatement:
+		opt(&s.Start)
+		opt(&s.Limit)
+		opt(&s.Step)
+	case *ast.EndStatement:
+		opt(&s.Status)
+	case *ast.DimStatement:
+		opt(&s.Size)
+	case *ast.ReadStatement:
+		for _, target := range s.Variables {
+			if arr, ok := target.(*ast.ArrayAccess); ok {
+				opt(&arr.Index)
+			}
+		}
+	case *ast.RestoreStatement:
+		opt(&s.LineNumber)
+	case *ast.SleepStatement:
+		opt(&s.Seconds)
+	case *ast.ShellStatement:
+		opt(&s.Command)
+	case *ast.PokeStatement:
+		opt(&s.Address)
+		opt(&s.Value)
+	case *ast.OpenStatement:
+		opt(&s.File)
+		opt(&s.Number)
+		opt(&s.RecordLength)
+	case *ast.CloseStatement:
+		list(s.Numbers)
+	case *ast.FieldStatement:
+		opt(&s.Number)
+		for _, field := range s.Fields {
+			opt(&field.Width)
+		}
+	case *ast.RecordStatement:
+		opt(&s.Number)
+		opt(&s.Record)
+	case *ast.JustifyStatement:
+		opt(&s.Value)
+	case *ast.FilesStatement:
+		opt(&s.Pattern)
+	case *ast.KillStatement:
+		opt(&s.File)
+	case *ast.NameStatement:
+		opt(&s.From)
+		opt(&s.To)
+	case *ast.ChdirStatement:
+		opt(&s.Directory)
+	case *ast.CallStatement:
+		// A variable passed to a SUB is passed by reference, so an argument
+		// such as A*1 must not become A.
+		for i, arg := range s.Arguments {
+			folded := Expression(arg, opts)
+			switch folded.(type) {
+			case *ast.Identifier, *ast.ArrayAccess:
+			default:
+				s.Arguments[i] = folded
+			}
+		}
+	case *ast.HostCallStatement:
+		opt(&s.Event)
+		list(s.Arguments)
+	case *ast.OnTimerStatement:
+		opt(&s.Interval)
+		opt(&s.Target)
+	case *ast.LocateStatement:
+		opt(&s.Row)
+		opt(&s.Column)
+	case *ast.ColorStatement:
+		opt(&s.Foreground)
+		opt(&s.Background)
+	case *ast.ScreenStatement:
+		opt(&s.Mode)
+		opt(&s.Height)
+	case *ast.PlotStatement:
+		opt(&s.X)
+		opt(&s.Y)
+		opt(&s.Color)
+	case *ast.DrawLineStatement:
+		opt(&s.X1)
+		opt(&s.Y1)
+		opt(&s.X2)
+		opt(&s.Y2)
+		opt(&s.Color)
+	case *ast.CircleStatement:
+		opt(&s.X)
+		opt(&s.Y)
+		opt(&s.Radius)
+		opt(&s.Color)
+	case *ast.ScreenSaveStatement:
+		opt(&s.File)
+	case *ast.ExpressionStatement:
+		opt(&s.Expression)
+	}
+}
+
+// Expression returns expr simplified. Its operands are simplified in place.
+func Expression(expr ast.Expression, opts Options) ast.Expression {
+	switch node := expr.(type) {
+	case *ast.InfixExpression:
+		node.Left = Expression(node.Left, opts)
+		node.Right = Expression(node.Right, opts)
+		if folded := foldInfix(node, opts); folded != nil {
+			return folded
+		}
+		return simplify(node)
+	case *ast.PrefixExpression:
+		node.Right = Expression(node.Right, opts)
+		// Negating 0 would give -0, which prints differently from 0 and
+		// which a literal cannot hold.
+		if num, ok := node.Right.(*ast.NumberLiteral); ok && node.Operator == "-" && num.Value != 0 {
+			return number(node, -num.Value)
+		}
+	case *ast.ArrayAccess:
+		node.Index = Expression(node.Index, opts)
+	case *ast.CallExpression:
+		for i, arg := range node.Arguments {
+			node.Arguments[i] = Expression(arg, opts)
+		}
+	}
+	return expr
+}
+
+// foldInfix works out an operator whose operands are both literals, or
+// returns nil if it cannot be done without changing what the program does.
+func foldInfix(node *ast.InfixExpression, opts Options) ast.Expression {
+	if x, ok := node.Left.(*ast.NumberLiteral); ok {
+		if y, ok := node.Right.(*ast.NumberLiteral); ok {
+			return foldNumbers(node, x.Value, y.Value, opts)
+		}
+	}
+	x, ok := node.Left.(*ast.StringLiteral)
+	if !ok {
+		return nil
+	}
+	y, ok := node.Right.(*ast.StringLiteral)
+	if !ok {
+		return nil
+	}
+	switch node.Operator {
+	case "+":
+		if opts.MaxStringLength > 0 && len(x.Value)+len(y.Value) > opts.MaxStringLength {
+			return nil
+		}
+		s := x.Value + y.Value
+		return &ast.StringLiteral{Token: literal(node, token.STRING, s), Value: s}
+	case "==":
+		return truth(node, x.Value == y.Value, opts)
+	case "<>":
+		return truth(node, x.Value != y.Value, opts)
+	}
+	return nil
+}
+
+// foldNumbers is foldInfix for two numbers. Division by zero is left to
+// fail as the program runs, and results a literal cannot hold, -0 and
+// those that are not finite, are left to be worked out there too.
+func foldNumbers(node *ast.InfixExpression, x, y float64, opts Options) ast.Expression {
+	var v float64
+	switch node.Operator {
+	case "+":
+		v = x + y
+	case "-":
+		v = x - y
+	case "*":
+		v = x * y
+	case "/":
+		if y == 0 {
+			return nil
+		}
+		v = x / y
+	case "MOD":
+		v = math.Mod(x, y)
+	case "<":
+		return truth(node, x < y, opts)
+	case ">":
+		return truth(node, x > y, opts)
+	case "<=":
+		return truth(node, x <= y, opts)
+	case ">=":
+		return truth(node, x >= y, opts)
+	case "==":
+		return truth(node, x == y, opts)
+	case "<>":
+		return truth(node, x != y, opts)
+	default:
+		return nil
+	}
+	if math.IsInf(v, 0) || math.IsNaN(v) || (v == 0 && math.Signbit(v)) {
+		return nil
+	}
+	return number(node, v)
+}
+
+// simplify drops a multiplication or division by the literal 1 from a
+// number. The other operand must be one for certain: A*1 fails when A holds
+// a string. Multiplying by 0 is left alone, as X*0 is -0 when X is negative
+// and fails when X is a string.
+func simplify(node *ast.InfixExpression) ast.Expression {
+	switch node.Operator {
+	case "*":
+		if isOne(node.Right) && isNumeric(node.Left) {
+			return node.Left
+		}
+		if isOne(node.Left) && isNumeric(node.Right) {
+			return node.Right
+		}
+	case "/":
+		if isOne(node.Right) && isNumeric(node.Left) {
+			return node.Left
+		}
+	}
+	return node
+}
+
+func isOne(expr ast.Expression) bool {
+	num, ok := expr.(*ast.NumberLiteral)
+	return ok && num.Value == 1
+}
+
+// isNumeric reports whether expr, if it gives a value at all, gives a
+// number.
+func isNumeric(expr ast.Expression) bool {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral, *ast.BooleanLiteral, *ast.PrefixExpression:
+		return true
+	case *ast.InfixExpression:
+		if node.Operator == "+" {
+			return isNumeric(node.Left) || isNumeric(node.Right)
+		}
+		return true
+	}
+	return false
+}
+
+// number returns a literal holding v that takes the place of expr in the
+// source.
+func number(expr ast.Expression, v float64) *ast.NumberLiteral {
+	return &ast.NumberLiteral{Token: literal(expr, token.NUMBER, strconv.FormatFloat(v, 'g', -1, 64)), Value: v}
+}
+
+func truth(expr ast.Expression, b bool, opts Options) *ast.NumberLiteral {
+	if b {
+		return number(expr, opts.Dialect.True())
+	}
+	return number(expr, 0)
+}
+
+// literal is the token for a literal folded from expr, spanning its text.
+func literal(expr ast.Expression, typ token.TokenType, lit string) token.Token {
+	pos := expr.Pos()
+	return token.Token{Type: typ, Literal: lit, Line: pos.Line, Column: pos.Column, End: expr.End()}
+}
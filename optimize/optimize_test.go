@@ -0,0 +1,98 @@
+package optimize
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+	"github.com/basis-ex/vm"
+)
+
+// answers is given to INPUT in every run, so that the interactive examples
+// get some way in before they run out of input.
+const answers = "5\n50\n25\n10\n0\n50\n50\n"
+
+// parse parses src, failing the test on a syntax error.
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse: %s", strings.Join(errs, "; "))
+	}
+	return program
+}
+
+// runOn runs program on the tree interpreter, and on the bytecode machine
+// too when it takes the program, returning what each printed and the
+// error it stopped with.
+func runOn(t *testing.T, program *ast.Program) map[string]string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	results := map[string]string{}
+
+	var out strings.Builder
+	err := evaluator.New(program, evaluator.Options{Stdin: strings.NewReader(answers), Stdout: &out}).Run(ctx)
+	results["interpreter"] = fmt.Sprintf("%s\nerror: %v", out.String(), err)
+
+	if prog, err := vm.Compile(program); err == nil {
+		out.Reset()
+		err := vm.New(prog, vm.Options{Stdin: strings.NewReader(answers), Stdout: &out}).Run(ctx)
+		results["vm"] = fmt.Sprintf("%s\nerror: %v", out.String(), err)
+	}
+	return results
+}
+
+// TestOptimizedProgramsRunTheSame runs each example, and programs written
+// to go near the edges of what may be folded, with and without
+// optimization, and fails if the two differ in what they print or the
+// error they stop with.
+func TestOptimizedProgramsRunTheSame(t *testing.T) {
+	programs := map[string]string{
+		"division by zero":  "10 PRINT 1 + 2 * 3\n20 PRINT 10 / (5 - 5)\n",
+		"negative zero":     "10 LET X = -1\n20 PRINT X * 0, 0 * -1, -(0)\n",
+		"string times one":  "10 LET A$ = \"X\"\n20 PRINT A$ * 1\n",
+		"joined strings":    "10 PRINT \"AB\" + \"CD\" + \"EF\"\n",
+		"comparisons":       "10 PRINT 1 < 2; 2 > 3; \"A\" < \"B\"; 1 <> 1\n",
+		"overflowing fold":  "10 PRINT 100000 * 100000 * 100000 * 100000 * 100000 * 100000\n",
+		"variables by one":  "10 LET A = 7\n20 PRINT A * 1, A / 1, (A + 1) * 1\n",
+		"constant in loops": "10 FOR I = 1 TO 2 * 2 STEP 3 - 2\n20 PRINT I * (4 / 2)\n30 NEXT I\n",
+	}
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*.bas"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no programs in examples/")
+	}
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		programs[filepath.Base(file)] = string(src)
+	}
+
+	for name, src := range programs {
+		t.Run(name, func(t *testing.T) {
+			want := runOn(t, parse(t, src))
+			optimized := parse(t, src)
+			Program(optimized, Options{MaxStringLength: evaluator.DefaultMaxStringLength})
+			got := runOn(t, optimized)
+			for engine, w := range want {
+				if got[engine] != w {
+					t.Errorf("%s: optimized run gave\n%s\nwant\n%s", engine, got[engine], w)
+				}
+			}
+		})
+	}
+}
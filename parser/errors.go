@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/basis-ex/token"
+)
+
+// Error is a syntax error: what is wrong, where, and the source line it is
+// on, so a tool can show the line with the place marked.
+type Error struct {
+	Msg string
+	Pos token.Position
+	// End is just after the text the error is about. It is the zero
+	// Position when the error is about a place rather than some text, as at
+	// the end of a line.
+	End token.Position
+	// Text is the whole of the source line Pos is on.
+	Text string
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%v: %s", e.Pos, e.Msg)
+}
+
+// Errors returns the messages of the syntax errors found, in order.
+func (p *Parser) Errors() []string {
+	msgs := make([]string, len(p.errors))
+	for i, err := range p.errors {
+		msgs[i] = err.Msg
+	}
+	return msgs
+}
+
+// ErrorList returns the syntax errors found, in order, with their places.
+func (p *Parser) ErrorList() []Error {
+	return p.errors
+}
+
+// errorAt records a syntax error about the text from pos to end.
+func (p *Parser) errorAt(pos, end token.Position, format string, args ...any) {
+	p.errors = append(p.errors, Error{
+		Msg:  fmt.Sprintf(format, args...),
+		Pos:  pos,
+		End:  end,
+		Text: p.l.LineText(pos.Line),
+	})
+}
+
+// tokenError records a syntax error about tok, unless there is one
+// already on its line: the parser does not recover within a line, so any
+// error after the first follows from it.
+func (p *Parser) tokenError(tok token.Token, format string, args ...any) {
+	if n := len(p.errors); n > 0 && p.errors[n-1].Pos.Line == tok.Line {
+		return
+	}
+	end := tok.End
+	if tok.Type == token.NEWLINE || tok.Type == token.EOF {
+		end = token.Position{}
+	}
+	p.errorAt(tok.Pos(), end, format, args...)
+}
+
+func (p *Parser) peekError(t token.TokenType) {
+	p.tokenError(p.peekToken, "expected %s, found %s", expected(t), describe(p.peekToken))
+}
+
+func (p *Parser) noPrefixParseFnError(tok token.Token) {
+	p.tokenError(tok, "unexpected %s in expression", describe(tok))
+}
+
+// describe names tok as a message should: by its text, or for the end of
+// the line, by what it is.
+func describe(tok token.Token) string {
+	switch tok.Type {
+	case token.NEWLINE, token.EOF:
+		return "end of line"
+	case token.STRING:
+		return fmt.Sprintf("string %q", tok.Literal)
+	}
+	return "'" + tok.Literal + "'"
+}
+
+// expected names a kind of token a statement needs next.
+func expected(t token.TokenType) string {
+	switch t {
+	case token.IDENT:
+		return "a variable name"
+	case token.NUMBER:
+		return "a number"
+	case token.STRING:
+		return "a string"
+	}
+	if token.LookupIdent(string(t)) == t {
+		return string(t)
+	}
+	return "'" + string(t) + "'"
+}
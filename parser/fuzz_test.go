@@ -0,0 +1,44 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/lexer"
+)
+
+// maxFuzzInput is the most bytes FuzzParse parses, more than any of the
+// examples it starts from.
+const maxFuzzInput = 64 << 10
+
+// FuzzParse parses data as a program. It fails if the lexer or parser
+// panics, if the parse does not finish, as it would going round a loop at
+// the end of the source, or if what it parsed holds a statement that is a
+// nil pointer, which Walk cannot go into.
+func FuzzParse(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("..", "examples", "*.bas"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte("10 READ A(\n"))
+	f.Add([]byte("10 IF X THEN PRINT ELSE GOTO\n20 FOR I = 1 TO: NEXT\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Small inputs parse at once, so the fuzzer's time limit on each
+		// catches a parse that never finishes rather than a long program.
+		if len(data) > maxFuzzInput {
+			t.Skip("longer than the fuzzer needs")
+		}
+		program := New(lexer.New(string(data))).ParseProgram()
+		ast.Inspect(program, func(ast.Node) bool { return true })
+	})
+}
@@ -1,17 +1,22 @@
 package parser
 
 import (
-	"fmt"
 	"github.com/basis-ex/ast"
 	"github.com/basis-ex/lexer"
 	"github.com/basis-ex/token"
+	"sort"
 	"strconv"
+	"strings"
 )
 
 const (
 	_ int = iota
 	LOWEST
-	LOGICAL
+	IMPLIES // IMP
+	EQUIV   // EQV
+	EXCLOR  // XOR
+	LOGOR   // OR
+	LOGAND  // AND
 	EQUALS
 	LESSGREATER
 	SUM
@@ -21,8 +26,11 @@ const (
 )
 
 var precedences = map[token.TokenType]int{
-	token.OR:     LOGICAL,
-	token.AND:    LOGICAL,
+	token.IMP:    IMPLIES,
+	token.EQV:    EQUIV,
+	token.XOR:    EXCLOR,
+	token.OR:     LOGOR,
+	token.AND:    LOGAND,
 	token.EQ:     EQUALS,
 	token.NE:     EQUALS,
 	token.LT:     LESSGREATER,
@@ -38,14 +46,50 @@ var precedences = map[token.TokenType]int{
 }
 
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l *lexer.Lexer
+	// tokens holds every token read from l, for Tokens.
+	tokens *lexer.Stream
+	errors []Error
 
 	curToken  token.Token
 	peekToken token.Token
 
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
+
+	// equalsCompares is set when a single = in an expression compares,
+	// as the lexer's dialect says.
+	equalsCompares bool
+
+	// functions are names, beyond the built-ins, to parse as function
+	// calls, such as those an embedding program registers.
+	functions map[string]bool
+}
+
+// Tokens returns a stream over the tokens the parser has read, which
+// after ParseProgram are all those of the source, so a tool that parses
+// a program need not lex it again. It starts wherever the parser left
+// it; Reset(0) goes back to the first token.
+func (p *Parser) Tokens() *lexer.Stream {
+	return p.tokens
+}
+
+// AddFunctions makes the parser treat the given names as functions, so
+// NAME(a, b) is a call rather than an array element. Call it before
+// ParseProgram.
+func (p *Parser) AddFunctions(names ...string) {
+	if p.functions == nil {
+		p.functions = map[string]bool{}
+	}
+	for _, name := range names {
+		p.functions[strings.ToUpper(name)] = true
+	}
+}
+
+// isFunction reports whether name, in upper case, is called like a
+// function.
+func (p *Parser) isFunction(name string) bool {
+	return token.IsBuiltin(name) || p.functions[name]
 }
 
 type (
@@ -56,13 +100,16 @@ type (
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		tokens: lexer.NewStream(l),
 	}
 
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.NUMBER, p.parseNumberLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TIMER, p.parseTimerFunction)
+	p.registerPrefix(token.TRUE, p.parseBooleanLiteral)
+	p.registerPrefix(token.FALSE, p.parseBooleanLiteral)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.NOT, p.parsePrefixExpression)
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
@@ -81,7 +128,14 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(token.GE, p.parseInfixExpression)
 	p.registerInfix(token.AND, p.parseInfixExpression)
 	p.registerInfix(token.OR, p.parseInfixExpression)
+	p.registerInfix(token.XOR, p.parseInfixExpression)
+	p.registerInfix(token.EQV, p.parseInfixExpression)
+	p.registerInfix(token.IMP, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseArrayAccess)
+	if l.Dialect().EqualsCompares {
+		p.equalsCompares = true
+		p.registerInfix(token.ASSIGN, p.parseEqualsComparison)
+	}
 
 	p.nextToken()
 	p.nextToken()
@@ -91,7 +145,14 @@ func New(l *lexer.Lexer) *Parser {
 
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
-	p.peekToken = p.l.NextToken()
+	p.peekToken = p.tokens.Next()
+	// A token the lexer could not make sense of is reported as it is read,
+	// with what the lexer found wrong.
+	if p.peekToken.Type == token.ILLEGAL {
+		if problem := p.l.Problem(p.peekToken.Pos()); problem != "" {
+			p.tokenError(p.peekToken, "%s", problem)
+		}
+	}
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -111,16 +172,6 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	return false
 }
 
-func (p *Parser) Errors() []string {
-	return p.errors
-}
-
-func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
-}
-
 func (p *Parser) registerPrefix(tokenType token.TokenType, fn prefixParseFn) {
 	p.prefixParseFns[tokenType] = fn
 }
@@ -129,22 +180,18 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
-func (p *Parser) parseRemStatement() *ast.RemStatement {
+func (p *Parser) parseRemStatement() ast.Statement {
 	stmt := &ast.RemStatement{Token: p.curToken}
 
-	p.nextToken()
-
-	comment := ""
-	for !p.curTokenIs(token.EOF) && !p.curTokenIs(token.COLON) && !p.curTokenIs(token.NEWLINE) {
-		comment += p.curToken.Literal + " "
+	if p.peekTokenIs(token.COMMENT) {
 		p.nextToken()
+		stmt.Comment = p.curToken.Literal
+		stmt.CommentPos = p.curToken.Pos()
 	}
-
-	stmt.Comment = comment
 	return stmt
 }
 
-func (p *Parser) parseDimStatement() *ast.DimStatement {
+func (p *Parser) parseDimStatement() ast.Statement {
 	stmt := &ast.DimStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
@@ -163,11 +210,12 @@ func (p *Parser) parseDimStatement() *ast.DimStatement {
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	stmt.Rparen = p.curToken.Pos()
 
 	return stmt
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
@@ -176,6 +224,15 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	if p.peekTokenIs(token.LPAREN) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Index = p.parseExpression(LOWEST)
+		if !p.expectPeek(token.RPAREN) {
+			return nil
+		}
+	}
+
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -186,7 +243,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
-func (p *Parser) parseIfStatement() *ast.IfStatement {
+func (p *Parser) parseIfStatement() ast.Statement {
 	stmt := &ast.IfStatement{Token: p.curToken}
 
 	p.nextToken()
@@ -196,19 +253,42 @@ func (p *Parser) parseIfStatement() *ast.IfStatement {
 		return nil
 	}
 
+	then := p.curToken
 	p.nextToken()
-	stmt.Consequence = p.parseStatement()
+	stmt.Consequence = p.parseBranch(then)
 
 	if p.peekTokenIs(token.ELSE) {
 		p.nextToken()
+		els := p.curToken
 		p.nextToken()
-		stmt.Alternative = p.parseStatement()
+		stmt.Alternative = p.parseBranch(els)
 	}
 
 	return stmt
 }
 
-func (p *Parser) parseGotoStatement() *ast.GotoStatement {
+// parseBranch parses what follows THEN or ELSE, given as keyword: a
+// statement, or a bare line number, which jumps there as GOTO does.
+func (p *Parser) parseBranch(keyword token.Token) ast.Statement {
+	if p.curTokenIs(token.NUMBER) && (p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.EOF) || p.peekTokenIs(token.COLON) || p.peekTokenIs(token.ELSE)) {
+		jump := &ast.GotoStatement{Token: keyword, LineNumber: p.parseExpression(LOWEST)}
+		if !p.peekTokenIs(token.COLON) {
+			return jump
+		}
+		// Statements after the number, between colons, belong to the
+		// branch, although they can never run.
+		p.nextToken()
+		p.nextToken()
+		if p.curTokenIs(token.NEWLINE) || p.curTokenIs(token.EOF) {
+			return jump
+		}
+		rest := ast.Flatten(p.parseStatement())
+		return &ast.SequenceStatement{Statements: append([]ast.Statement{jump}, rest...)}
+	}
+	return p.parseStatement()
+}
+
+func (p *Parser) parseGotoStatement() ast.Statement {
 	stmt := &ast.GotoStatement{Token: p.curToken}
 
 	p.nextToken()
@@ -217,7 +297,7 @@ func (p *Parser) parseGotoStatement() *ast.GotoStatement {
 	return stmt
 }
 
-func (p *Parser) parseGosubStatement() *ast.GosubStatement {
+func (p *Parser) parseGosubStatement() ast.Statement {
 	stmt := &ast.GosubStatement{Token: p.curToken}
 
 	p.nextToken()
@@ -226,17 +306,25 @@ func (p *Parser) parseGosubStatement() *ast.GosubStatement {
 	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	return stmt
 }
 
-func (p *Parser) parseEndStatement() *ast.EndStatement {
+func (p *Parser) parseEndStatement() ast.Statement {
 	stmt := &ast.EndStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) || p.peekTokenIs(token.ELSE) {
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.Status = p.parseExpression(LOWEST)
+
 	return stmt
 }
 
-func (p *Parser) parsePrintStatement() *ast.PrintStatement {
+func (p *Parser) parsePrintStatement() ast.Statement {
 	stmt := &ast.PrintStatement{Token: p.curToken}
 	stmt.Expressions = []ast.Expression{}
 	stmt.Separators = []string{}
@@ -259,6 +347,7 @@ func (p *Parser) parsePrintStatement() *ast.PrintStatement {
 			stmt.Separators = append(stmt.Separators, "")
 			if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) {
 				stmt.TrailingNewline = false
+				stmt.TrailingSeparator = p.curToken.Pos()
 				break
 			}
 			p.nextToken()
@@ -267,6 +356,7 @@ func (p *Parser) parsePrintStatement() *ast.PrintStatement {
 			stmt.Separators = append(stmt.Separators, "\t")
 			if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) {
 				stmt.TrailingNewline = false
+				stmt.TrailingSeparator = p.curToken.Pos()
 				break
 			}
 			p.nextToken()
@@ -278,7 +368,7 @@ func (p *Parser) parsePrintStatement() *ast.PrintStatement {
 	return stmt
 }
 
-func (p *Parser) parseForStatement() *ast.ForStatement {
+func (p *Parser) parseForStatement() ast.Statement {
 	stmt := &ast.ForStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
@@ -299,7 +389,7 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 	}
 
 	p.nextToken()
-	stmt.End = p.parseExpression(LOWEST)
+	stmt.Limit = p.parseExpression(LOWEST)
 
 	if p.peekTokenIs(token.STEP) {
 		p.nextToken()
@@ -312,7 +402,7 @@ func (p *Parser) parseForStatement() *ast.ForStatement {
 	return stmt
 }
 
-func (p *Parser) parseNextStatement() *ast.NextStatement {
+func (p *Parser) parseNextStatement() ast.Statement {
 	stmt := &ast.NextStatement{Token: p.curToken}
 
 	if p.peekTokenIs(token.IDENT) {
@@ -323,18 +413,25 @@ func (p *Parser) parseNextStatement() *ast.NextStatement {
 	return stmt
 }
 
-func (p *Parser) parseInputStatement() *ast.InputStatement {
+func (p *Parser) parseInputStatement() ast.Statement {
 	stmt := &ast.InputStatement{Token: p.curToken}
 	stmt.Variables = []*ast.Identifier{}
+	stmt.QuestionMark = true
 
 	p.nextToken()
 
 	if p.curTokenIs(token.STRING) {
 		stmt.Prompt = p.curToken.Literal
-		if !p.expectPeek(token.SEMICOLON) && !p.expectPeek(token.COMMA) {
+		switch {
+		case p.peekTokenIs(token.SEMICOLON):
+		case p.peekTokenIs(token.COMMA):
+			stmt.QuestionMark = false
+		default:
+			p.peekError(token.SEMICOLON)
 			return nil
 		}
 		p.nextToken()
+		p.nextToken()
 	}
 
 	for {
@@ -355,20 +452,568 @@ func (p *Parser) parseInputStatement() *ast.InputStatement {
 	return stmt
 }
 
-func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+// parseDataStatement reads the comma-separated constants of a DATA line. An
+// item is a number (optionally signed), a quoted string, or any other run of
+// tokens, which is kept as an unquoted string.
+func (p *Parser) parseDataStatement() ast.Statement {
+	stmt := &ast.DataStatement{Token: p.curToken}
+	stmt.Values = []ast.Expression{}
+
+	for {
+		item := []token.Token{}
+		for !p.peekTokenIs(token.COMMA) && !p.peekTokenIs(token.COLON) &&
+			!p.peekTokenIs(token.NEWLINE) && !p.peekTokenIs(token.EOF) {
+			p.nextToken()
+			item = append(item, p.curToken)
+		}
+
+		value := p.dataItem(item)
+		if value == nil {
+			return nil
+		}
+		stmt.Values = append(stmt.Values, value)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) dataItem(item []token.Token) ast.Expression {
+	if len(item) == 1 && item[0].Type == token.STRING {
+		return &ast.StringLiteral{Token: item[0], Value: item[0].Literal}
+	}
+
+	sign := 1.0
+	digits := item
+	if len(item) == 2 && (item[0].Type == token.MINUS || item[0].Type == token.PLUS) {
+		if item[0].Type == token.MINUS {
+			sign = -1
+		}
+		digits = item[1:]
+	}
+	if len(digits) == 1 && digits[0].Type == token.NUMBER {
+		value, err := strconv.ParseFloat(digits[0].Literal, 64)
+		if err != nil {
+			p.tokenError(digits[0], "%s is not a number", digits[0].Literal)
+			return nil
+		}
+		// The literal starts at the sign, if there is one.
+		tok := digits[0]
+		tok.Line, tok.Column = item[0].Line, item[0].Column
+		return &ast.NumberLiteral{Token: tok, Value: sign * value}
+	}
+
+	words := make([]string, len(item))
+	for i, tok := range item {
+		words[i] = tok.Literal
+	}
+	tok := token.Token{Type: token.STRING, Literal: strings.Join(words, " "), Line: p.curToken.Line}
+	if len(item) > 0 {
+		tok.Line, tok.Column, tok.End = item[0].Line, item[0].Column, item[len(item)-1].End
+	}
+	return &ast.StringLiteral{Token: tok, Value: tok.Literal}
+}
+
+func (p *Parser) parseReadStatement() ast.Statement {
+	stmt := &ast.ReadStatement{Token: p.curToken}
+	stmt.Variables = []ast.Expression{}
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		var target ast.Expression = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if p.peekTokenIs(token.LPAREN) {
+			p.nextToken()
+			arr := &ast.ArrayAccess{Token: p.curToken, Name: target.(*ast.Identifier)}
+			p.nextToken()
+			arr.Index = p.parseExpression(LOWEST)
+			if !p.expectPeek(token.RPAREN) {
+				return nil
+			}
+			arr.Rparen = p.curToken.Pos()
+			target = arr
+		}
+		stmt.Variables = append(stmt.Variables, target)
+
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseRestoreStatement() ast.Statement {
+	stmt := &ast.RestoreStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) || p.peekTokenIs(token.ELSE) {
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.LineNumber = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+func (p *Parser) parseShellStatement() ast.Statement {
+	stmt := &ast.ShellStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) || p.peekTokenIs(token.ELSE) {
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.Command = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+func (p *Parser) parseSleepStatement() ast.Statement {
+	stmt := &ast.SleepStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Seconds = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+func (p *Parser) parsePlotStatement() ast.Statement {
+	stmt := &ast.PlotStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.X = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Y = p.parseExpression(LOWEST)
+	stmt.Color = p.parseColorArgument()
+
+	return stmt
+}
+
+func (p *Parser) parseDrawLineStatement() ast.Statement {
+	stmt := &ast.DrawLineStatement{Token: p.curToken}
+
+	var ok bool
+	if stmt.X1, stmt.Y1, ok = p.parsePoint(); !ok {
+		return nil
+	}
+	if !p.expectPeek(token.MINUS) {
+		return nil
+	}
+	if stmt.X2, stmt.Y2, ok = p.parsePoint(); !ok {
+		return nil
+	}
+	stmt.Rparen = p.curToken.Pos()
+	stmt.Color = p.parseColorArgument()
+
+	return stmt
+}
+
+func (p *Parser) parseCircleStatement() ast.Statement {
+	stmt := &ast.CircleStatement{Token: p.curToken}
+
+	var ok bool
+	if stmt.X, stmt.Y, ok = p.parsePoint(); !ok {
+		return nil
+	}
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Radius = p.parseExpression(LOWEST)
+	stmt.Color = p.parseColorArgument()
+
+	return stmt
+}
+
+// parsePoint reads the (x, y) that comes next, leaving its ) the current
+// token.
+func (p *Parser) parsePoint() (x, y ast.Expression, ok bool) {
+	if !p.expectPeek(token.LPAREN) {
+		return nil, nil, false
+	}
+	p.nextToken()
+	x = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.COMMA) {
+		return nil, nil, false
+	}
+	p.nextToken()
+	y = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil, nil, false
+	}
+	return x, y, true
+}
+
+// parseColorArgument reads the , color that may end a graphics statement,
+// returning nil if it is left out.
+func (p *Parser) parseColorArgument() ast.Expression {
+	if !p.peekTokenIs(token.COMMA) {
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
+func (p *Parser) parsePokeStatement() ast.Statement {
+	stmt := &ast.PokeStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.Address = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.COMMA) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+func (p *Parser) parseOpenStatement() ast.Statement {
+	stmt := &ast.OpenStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.File = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.FOR) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		if mode := strings.ToUpper(p.curToken.Literal); mode != "RANDOM" {
+			p.tokenError(p.curToken, "OPEN mode %s is not supported, only RANDOM", mode)
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+	stmt.Number = p.parseFileNumber()
+
+	if p.peekTokenIs(token.IDENT) && strings.ToUpper(p.peekToken.Literal) == "LEN" {
+		p.nextToken()
+		if !p.expectPeek(token.ASSIGN) {
+			return nil
+		}
+		p.nextToken()
+		stmt.RecordLength = p.parseExpression(LOWEST)
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseCloseStatement() ast.Statement {
+	stmt := &ast.CloseStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) || p.peekTokenIs(token.ELSE) {
+		return stmt
+	}
+
+	stmt.Numbers = append(stmt.Numbers, p.parseFileNumber())
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		stmt.Numbers = append(stmt.Numbers, p.parseFileNumber())
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseFieldStatement() ast.Statement {
+	stmt := &ast.FieldStatement{Token: p.curToken}
+	stmt.Number = p.parseFileNumber()
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		field := &ast.FieldSpec{Width: p.parseExpression(LOWEST)}
+		if !p.expectPeek(token.AS) || !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		field.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		stmt.Fields = append(stmt.Fields, field)
+	}
+
+	if len(stmt.Fields) == 0 {
+		p.errorAt(stmt.Token.Pos(), p.curToken.End, "FIELD needs at least one width AS variable")
+		return nil
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseRecordStatement() ast.Statement {
+	stmt := &ast.RecordStatement{Token: p.curToken}
+	stmt.Number = p.parseFileNumber()
+
+	if p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Record = p.parseExpression(LOWEST)
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseJustifyStatement() ast.Statement {
+	stmt := &ast.JustifyStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+func (p *Parser) parseSubStatement() ast.Statement {
+	stmt := &ast.SubStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return stmt
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Rparen = p.curToken.Pos()
+		return stmt
+	}
+
+	for {
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Params = append(stmt.Params, &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal})
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	stmt.Rparen = p.curToken.Pos()
+
+	return stmt
+}
+
+func (p *Parser) parseCallStatement() ast.Statement {
+	stmt := &ast.CallStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	// HOST followed by an event name sends an event to the embedding
+	// program. HOST alone, or HOST(...), still calls a SUB of that name.
+	if strings.ToUpper(p.curToken.Literal) == "HOST" && !p.peekTokenIs(token.LPAREN) &&
+		!p.peekTokenIs(token.EOF) && !p.peekTokenIs(token.NEWLINE) && !p.peekTokenIs(token.COLON) && !p.peekTokenIs(token.ELSE) {
+		return p.parseHostCallStatement(stmt.Token)
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.peekTokenIs(token.LPAREN) {
+		return stmt
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		stmt.Rparen = p.curToken.Pos()
+		return stmt
+	}
+
+	p.nextToken()
+	stmt.Arguments = append(stmt.Arguments, p.parseExpression(LOWEST))
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Arguments = append(stmt.Arguments, p.parseExpression(LOWEST))
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	stmt.Rparen = p.curToken.Pos()
+
+	return stmt
+}
+
+func (p *Parser) parseHostCallStatement(tok token.Token) ast.Statement {
+	stmt := &ast.HostCallStatement{Token: tok}
+
+	p.nextToken()
+	stmt.Event = p.parseExpression(LOWEST)
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		stmt.Arguments = append(stmt.Arguments, p.parseExpression(LOWEST))
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseOnStatement() ast.Statement {
+	stmt := &ast.OnTimerStatement{Token: p.curToken}
+
+	if !p.peekTokenIs(token.TIMER) {
+		p.tokenError(p.peekToken, "expected TIMER after ON, found %s", describe(p.peekToken))
+		return nil
+	}
+	p.nextToken()
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Interval = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+
+	if !p.expectPeek(token.GOSUB) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Target = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+func (p *Parser) parseTimerStatement() ast.Statement {
+	stmt := &ast.TimerStatement{Token: p.curToken}
+
+	p.nextToken()
+	mode := strings.ToUpper(p.curToken.Literal)
+	if mode != "ON" && mode != "OFF" && mode != "STOP" {
+		p.tokenError(p.curToken, "expected ON, OFF or STOP after TIMER, found %s", describe(p.curToken))
+		return nil
+	}
+	stmt.Mode = mode
+	stmt.ModePos = p.curToken.Pos()
+
+	return stmt
+}
+
+// parseTimerFunction parses TIMER used as a value: the seconds since
+// midnight.
+func (p *Parser) parseTimerFunction() ast.Expression {
+	return &ast.CallExpression{Token: p.curToken, Function: "TIMER"}
+}
+
+func (p *Parser) parseNameStatement() ast.Statement {
+	stmt := &ast.NameStatement{Token: p.curToken}
+
+	p.nextToken()
+	stmt.From = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.To = p.parseExpression(LOWEST)
+
+	return stmt
+}
+
+// parseFileNumber reads a file number written as #n or plain n.
+func (p *Parser) parseFileNumber() ast.Expression {
+	if p.peekTokenIs(token.HASH) {
+		p.nextToken()
+	}
+	p.nextToken()
+	return p.parseExpression(LOWEST)
+}
+
+// parseOptionalArguments reads up to max comma-separated arguments, any of
+// which may be left out (LOCATE ,10). Omitted arguments are nil.
+func (p *Parser) parseOptionalArguments(max int) []ast.Expression {
+	args := make([]ast.Expression, max)
+
+	for i := 0; i < max && !p.atStatementEnd(); i++ {
+		if !p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			args[i] = p.parseExpression(LOWEST)
+		}
+		if i < max-1 && p.peekTokenIs(token.COMMA) {
+			p.nextToken()
+			continue
+		}
+		break
+	}
+
+	return args
+}
+
+func (p *Parser) parseExpressionStatement() ast.Statement {
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
-	stmt.Expression = p.parseExpression(LOWEST)
+	if !p.equalsCompares {
+		stmt.Expression = p.parseExpression(LOWEST)
+		return stmt
+	}
+
+	// Where = compares, a statement that starts NAME = or NAME(I) = is
+	// an assignment with its LET left out, as those dialects allow.
+	left := p.parseExpression(EQUALS)
+	if p.peekTokenIs(token.ASSIGN) {
+		switch target := left.(type) {
+		case *ast.Identifier:
+			return p.parseImplicitLet(&ast.LetStatement{Token: stmt.Token, Name: target})
+		case *ast.ArrayAccess:
+			return p.parseImplicitLet(&ast.LetStatement{Token: stmt.Token, Name: target.Name, Index: target.Index})
+		}
+	}
+	stmt.Expression = p.parseInfixExpressions(left, LOWEST)
+	return stmt
+}
+
+// parseImplicitLet finishes stmt, read up to its =, with the value
+// assigned.
+func (p *Parser) parseImplicitLet(stmt *ast.LetStatement) ast.Statement {
+	p.nextToken()
+	p.nextToken()
+	stmt.Value = p.parseExpression(LOWEST)
 	return stmt
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
-		p.noPrefixParseFnError(p.curToken.Type)
+		p.noPrefixParseFnError(p.curToken)
 		return nil
 	}
-	leftExp := prefix()
+	return p.parseInfixExpressions(prefix(), precedence)
+}
 
+// parseInfixExpressions reads the operators that follow leftExp, and their
+// operands, while they bind tighter than precedence.
+func (p *Parser) parseInfixExpressions(leftExp ast.Expression, precedence int) ast.Expression {
 	for !p.peekTokenIs(token.EOF) && !p.peekTokenIs(token.NEWLINE) && !p.peekTokenIs(token.COLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
@@ -384,20 +1029,29 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return p.precedence(p.peekToken.Type)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+	return p.precedence(p.curToken.Type)
+}
+
+func (p *Parser) precedence(t token.TokenType) int {
+	if t == token.ASSIGN && p.equalsCompares {
+		return EQUALS
+	}
+	if p, ok := precedences[t]; ok {
 		return p
 	}
 	return LOWEST
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
+	// A built-in written without parentheses, like COMMAND$, is a call
+	// with no arguments.
+	if name := strings.ToUpper(p.curToken.Literal); p.isFunction(name) && !p.peekTokenIs(token.LPAREN) {
+		return &ast.CallExpression{Token: p.curToken, Function: name}
+	}
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
@@ -406,8 +1060,7 @@ func (p *Parser) parseNumberLiteral() ast.Expression {
 
 	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as number", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.tokenError(p.curToken, "%s is not a number", p.curToken.Literal)
 		return nil
 	}
 
@@ -415,6 +1068,10 @@ func (p *Parser) parseNumberLiteral() ast.Expression {
 	return lit
 }
 
+func (p *Parser) parseBooleanLiteral() ast.Expression {
+	return &ast.BooleanLiteral{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+}
+
 func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -446,7 +1103,16 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseEqualsComparison reads a single = as ==, for a dialect in which it
+// compares.
+func (p *Parser) parseEqualsComparison(left ast.Expression) ast.Expression {
+	expression := p.parseInfixExpression(left).(*ast.InfixExpression)
+	expression.Operator = "=="
+	return expression
+}
+
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	lparen := p.curToken.Pos()
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -454,6 +1120,7 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	ast.SetParens(exp, lparen, p.curToken.Pos())
 
 	return exp
 }
@@ -467,24 +1134,62 @@ func (p *Parser) parseArrayAccess(left ast.Expression) ast.Expression {
 		return nil
 	}
 
+	if name := strings.ToUpper(arr.Name.Value); p.isFunction(name) {
+		return p.parseCallExpression(arr.Name.Token, name)
+	}
+
 	p.nextToken()
 	arr.Index = p.parseExpression(LOWEST)
 
 	if !p.expectPeek(token.RPAREN) {
 		return nil
 	}
+	arr.Rparen = p.curToken.Pos()
 
 	return arr
 }
 
-func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+func (p *Parser) parseCallExpression(tok token.Token, name string) ast.Expression {
+	call := &ast.CallExpression{Token: tok, Function: name}
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		call.Rparen = p.curToken.Pos()
+		return call
+	}
+
+	p.nextToken()
+	call.Arguments = append(call.Arguments, p.parseCallArgument())
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		call.Arguments = append(call.Arguments, p.parseCallArgument())
+	}
+
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	call.Rparen = p.curToken.Pos()
+
+	return call
+}
+
+// parseCallArgument parses one built-in argument. A file number may be
+// written #n, as in INPUT$(1, #2).
+func (p *Parser) parseCallArgument() ast.Expression {
+	if p.curTokenIs(token.HASH) {
+		p.nextToken()
+	}
+	return p.parseExpression(LOWEST)
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
 	program.Statements = make(map[int]ast.Statement)
+	program.Source = make(map[int]string)
+	program.Indents = make(map[int]int)
+	program.Labels = make(map[string]int)
+	program.Procedures = make(map[string]*ast.Procedure)
 
 	for !p.curTokenIs(token.EOF) {
 		if p.curTokenIs(token.NEWLINE) {
@@ -496,6 +1201,17 @@ func (p *Parser) ParseProgram() *ast.Program {
 		if stmt != nil {
 			if lineStmt, ok := stmt.(*ast.LineStatement); ok {
 				program.Statements[lineStmt.LineNumber] = lineStmt.Statement
+				program.Source[lineStmt.LineNumber] = strings.TrimSpace(p.l.LineText(lineStmt.Token.Line))
+				if indent := lineStmt.Token.Column - 1; indent > 0 {
+					program.Indents[lineStmt.LineNumber] = indent
+				}
+				if lineStmt.Label != "" {
+					if other, dup := program.Labels[lineStmt.Label]; dup && other != lineStmt.LineNumber {
+						label := ast.Flatten(lineStmt.Statement)[0]
+						p.errorAt(label.Pos(), label.End(), "label %s defined on both line %d and line %d", lineStmt.Label, other, lineStmt.LineNumber)
+					}
+					program.Labels[lineStmt.Label] = lineStmt.LineNumber
+				}
 			} else {
 				program.Statements[0] = stmt
 			}
@@ -503,13 +1219,75 @@ func (p *Parser) ParseProgram() *ast.Program {
 		p.nextToken()
 	}
 
+	p.collectProcedures(program)
+
 	return program
 }
 
+// collectProcedures pairs each SUB with its END SUB and records the
+// procedure table. SUB and END SUB must each be on a line of their own, and
+// procedures may not nest.
+func (p *Parser) collectProcedures(program *ast.Program) {
+	lines := make([]int, 0, len(program.Statements))
+	for line := range program.Statements {
+		if line > 0 {
+			lines = append(lines, line)
+		}
+	}
+	sort.Ints(lines)
+
+	var (
+		open   *ast.Procedure
+		header *ast.SubStatement
+	)
+	for _, line := range lines {
+		stmt := program.Statements[line]
+		for _, inner := range ast.Flatten(stmt) {
+			switch s := inner.(type) {
+			case *ast.SubStatement:
+				if inner != stmt {
+					p.errorAt(s.Pos(), s.End(), "line %d: SUB must be on a line of its own", line)
+				}
+				if open != nil {
+					p.errorAt(s.Pos(), s.End(), "line %d: SUB %s inside SUB %s (line %d)", line, s.Name.Value, open.Name, open.Line)
+					continue
+				}
+				if other, dup := program.Procedures[s.Name.Value]; dup {
+					p.errorAt(s.Pos(), s.End(), "SUB %s defined on both line %d and line %d", s.Name.Value, other.Line, line)
+				}
+				open = &ast.Procedure{Name: s.Name.Value, Params: s.Params, Line: line}
+				header = s
+			case *ast.EndSubStatement:
+				if inner != stmt {
+					p.errorAt(s.Pos(), s.End(), "line %d: END SUB must be on a line of its own", line)
+				}
+				if open == nil {
+					p.errorAt(s.Pos(), s.End(), "line %d: END SUB without SUB", line)
+					continue
+				}
+				open.EndLine = line
+				program.Procedures[open.Name] = open
+				open = nil
+			}
+		}
+	}
+
+	if open != nil {
+		p.errorAt(header.Pos(), header.End(), "line %d: SUB %s without END SUB", open.Line, open.Name)
+	}
+}
+
 // parseStatementOrLine dispatches to line or regular statement parsing.
 func (p *Parser) parseStatementOrLine() ast.Statement {
 	if p.curToken.Type == token.NUMBER {
-		return p.parseLineStatement()
+		// The line it failed on is skipped whole.
+		if stmt := p.parseLineStatement(); stmt != nil {
+			return stmt
+		}
+		for !p.peekTokenIs(token.EOF) && !p.peekTokenIs(token.NEWLINE) {
+			p.nextToken()
+		}
+		return nil
 	}
 	return p.parseStatement()
 }
@@ -545,6 +1323,23 @@ func (p *Parser) parseStatement() ast.Statement {
 
 // parseSingleStatement parses a single BASIC statement (no ':' handling).
 func (p *Parser) parseSingleStatement() ast.Statement {
+	stmt := p.parseKeywordStatement()
+	if !p.curTokenIs(token.NEWLINE) && !p.curTokenIs(token.EOF) && !p.atStatementEnd() {
+		// What is left would otherwise be taken for another statement.
+		if _, ok := stmt.(*ast.ExpressionStatement); ok {
+			p.noPrefixParseFnError(p.peekToken)
+		} else {
+			p.tokenError(p.peekToken, "expected ':' or end of line, found %s", describe(p.peekToken))
+		}
+		for !p.peekTokenIs(token.EOF) && !p.peekTokenIs(token.NEWLINE) {
+			p.nextToken()
+		}
+	}
+	return stmt
+}
+
+// parseKeywordStatement parses a statement by its first token.
+func (p *Parser) parseKeywordStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.PRINT:
 		return p.parsePrintStatement()
@@ -565,29 +1360,166 @@ func (p *Parser) parseSingleStatement() ast.Statement {
 	case token.INPUT:
 		return p.parseInputStatement()
 	case token.END:
+		if p.peekTokenIs(token.SUB) {
+			stmt := &ast.EndSubStatement{Token: p.curToken}
+			p.nextToken()
+			stmt.Sub = p.curToken.Pos()
+			return stmt
+		}
 		return p.parseEndStatement()
+	case token.SYSTEM:
+		return p.parseEndStatement()
+	case token.SUB:
+		return p.parseSubStatement()
+	case token.CALL:
+		return p.parseCallStatement()
 	case token.REM:
 		return p.parseRemStatement()
 	case token.DIM:
 		return p.parseDimStatement()
+	case token.DATA:
+		return p.parseDataStatement()
+	case token.READ:
+		return p.parseReadStatement()
+	case token.RESTORE:
+		return p.parseRestoreStatement()
+	case token.DUMP:
+		return &ast.DumpStatement{Token: p.curToken}
+	case token.SHELL:
+		return p.parseShellStatement()
+	case token.SLEEP:
+		return p.parseSleepStatement()
+	case token.POKE:
+		return p.parsePokeStatement()
+	case token.OPEN:
+		return p.parseOpenStatement()
+	case token.CLOSE:
+		return p.parseCloseStatement()
+	case token.FIELD:
+		return p.parseFieldStatement()
+	case token.GET, token.PUT:
+		return p.parseRecordStatement()
+	case token.LSET, token.RSET:
+		return p.parseJustifyStatement()
+	case token.FILES:
+		stmt := &ast.FilesStatement{Token: p.curToken}
+		stmt.Pattern = p.parseOptionalArguments(1)[0]
+		return stmt
+	case token.KILL:
+		stmt := &ast.KillStatement{Token: p.curToken}
+		p.nextToken()
+		stmt.File = p.parseExpression(LOWEST)
+		return stmt
+	case token.NAME:
+		return p.parseNameStatement()
+	case token.CHDIR:
+		stmt := &ast.ChdirStatement{Token: p.curToken}
+		p.nextToken()
+		stmt.Directory = p.parseExpression(LOWEST)
+		return stmt
+	case token.ON:
+		return p.parseOnStatement()
+	case token.TIMER:
+		return p.parseTimerStatement()
+	case token.CLS:
+		return &ast.ClsStatement{Token: p.curToken}
+	case token.LOCATE:
+		stmt := &ast.LocateStatement{Token: p.curToken}
+		args := p.parseOptionalArguments(2)
+		stmt.Row, stmt.Column = args[0], args[1]
+		return stmt
+	case token.COLOR:
+		stmt := &ast.ColorStatement{Token: p.curToken}
+		args := p.parseOptionalArguments(2)
+		stmt.Foreground, stmt.Background = args[0], args[1]
+		return stmt
+	case token.SCREEN:
+		stmt := &ast.ScreenStatement{Token: p.curToken}
+		args := p.parseOptionalArguments(2)
+		stmt.Mode, stmt.Height = args[0], args[1]
+		return stmt
+	case token.PLOT:
+		return p.parsePlotStatement()
+	case token.LINE:
+		return p.parseDrawLineStatement()
+	case token.CIRCLE:
+		return p.parseCircleStatement()
+	case token.SCREENSAVE:
+		stmt := &ast.ScreenSaveStatement{Token: p.curToken}
+		p.nextToken()
+		stmt.File = p.parseExpression(LOWEST)
+		return stmt
 	default:
+		if keyword := p.misspelledKeyword(); keyword != "" {
+			p.tokenError(p.curToken, "unknown statement %s; did you mean %s?", p.curToken.Literal, keyword)
+			p.skipStatement()
+			return nil
+		}
 		return p.parseExpressionStatement()
 	}
 }
 
-func (p *Parser) parseLineStatement() *ast.LineStatement {
+// misspelledKeyword returns the keyword the name at the start of a
+// statement looks like a slip for, as PRINT for PRNT, or "" if it is not a
+// name or not close to one. A function name, for a call made for its
+// effect, is taken as written.
+func (p *Parser) misspelledKeyword() string {
+	if !p.curTokenIs(token.IDENT) || p.isFunction(strings.ToUpper(p.curToken.Literal)) {
+		return ""
+	}
+	return token.Suggest(p.curToken.Literal)
+}
+
+// atStatementEnd reports whether the statement parsed ends at the current
+// token: whether what follows is a ':', an ELSE or the end of the line.
+func (p *Parser) atStatementEnd() bool {
+	return p.peekTokenIs(token.EOF) || p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.COLON) || p.peekTokenIs(token.ELSE)
+}
+
+// skipStatement moves to the last token of the statement, so parsing
+// goes on after it.
+func (p *Parser) skipStatement() {
+	for !p.peekTokenIs(token.EOF) && !p.peekTokenIs(token.NEWLINE) && !p.peekTokenIs(token.COLON) {
+		p.nextToken()
+	}
+}
+
+func (p *Parser) parseLineStatement() ast.Statement {
 	stmt := &ast.LineStatement{Token: p.curToken}
 
 	lineNum, err := strconv.Atoi(p.curToken.Literal)
 	if err != nil {
-		p.errors = append(p.errors, fmt.Sprintf("could not parse %q as line number", p.curToken.Literal))
+		p.tokenError(p.curToken, "%s is not a line number", p.curToken.Literal)
 		return nil
 	}
 	stmt.LineNumber = lineNum
 
 	p.nextToken()
 
+	if p.curTokenIs(token.IDENT) && p.peekTokenIs(token.COLON) {
+		stmt.Statement = p.parseLabeledStatement()
+		stmt.Label = ast.Flatten(stmt.Statement)[0].(*ast.LabelStatement).Name
+		return stmt
+	}
+
 	stmt.Statement = p.parseStatement()
 
 	return stmt
 }
+
+// parseLabeledStatement handles a line that opens with "Name:". The label
+// becomes the first statement of the line, followed by whatever comes after
+// the colon.
+func (p *Parser) parseLabeledStatement() ast.Statement {
+	label := &ast.LabelStatement{Token: p.curToken, Name: p.curToken.Literal}
+
+	p.nextToken()
+	label.Colon = p.curToken.Pos()
+	if p.peekTokenIs(token.NEWLINE) || p.peekTokenIs(token.EOF) {
+		return label
+	}
+	p.nextToken()
+
+	stmts := append([]ast.Statement{label}, ast.Flatten(p.parseStatement())...)
+	return &ast.SequenceStatement{Statements: stmts}
+}
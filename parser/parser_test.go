@@ -0,0 +1,177 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/token"
+)
+
+// parse parses src, failing the test on a syntax error.
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse %q: %s", src, strings.Join(errs, "; "))
+	}
+	return program
+}
+
+// parseErrors parses src and returns its syntax errors.
+func parseErrors(src string) []string {
+	p := New(lexer.New(src))
+	p.ParseProgram()
+	return p.Errors()
+}
+
+func TestReadTargets(t *testing.T) {
+	program := parse(t, "10 READ A, B$(I + 1), C(2)\n")
+	read, ok := program.Statements[10].(*ast.ReadStatement)
+	if !ok {
+		t.Fatalf("line 10 is %T, want *ast.ReadStatement", program.Statements[10])
+	}
+	if got, want := read.String(), "READ A, B$(I + 1), C(2)"; got != want {
+		t.Errorf("READ printed as %q, want %q", got, want)
+	}
+	if _, ok := read.Variables[0].(*ast.Identifier); !ok {
+		t.Errorf("first target is %T, want *ast.Identifier", read.Variables[0])
+	}
+	for _, target := range read.Variables[1:] {
+		if _, ok := target.(*ast.ArrayAccess); !ok {
+			t.Errorf("target %s is %T, want *ast.ArrayAccess", target, target)
+		}
+	}
+}
+
+func TestLeftoverTokensAreASyntaxError(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"10 GOTO 20 30\n20 END\n", "expected ':' or end of line, found '30'"},
+		{"10 READ A B\n", "expected ':' or end of line, found 'B'"},
+		{"10 PRINT \"A\": DIM X(3) 4\n", "expected ':' or end of line, found '4'"},
+		{"10 S = 5\n", "unexpected '=' in expression"},
+	}
+	for _, tt := range tests {
+		errs := parseErrors(tt.src)
+		if len(errs) != 1 || errs[0] != tt.want {
+			t.Errorf("%q: errors %q, want [%q]", tt.src, errs, tt.want)
+		}
+	}
+}
+
+func TestLeftoverTokensLeaveNoStatement(t *testing.T) {
+	// Before, what was left of a line became a statement of line 0.
+	p := New(lexer.New("10 READ A(I) B\n20 END\n"))
+	program := p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatal("no syntax error")
+	}
+	if stmt, ok := program.Statements[0]; ok {
+		t.Errorf("line 0 holds %s", stmt)
+	}
+}
+
+func TestStatementsPrintAsParsed(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"10 let a = 1 + 2 * 3 - 4 / 2", "LET a = 1 + 2 * 3 - 4 / 2"},
+		{"10 print -a * 2; (1 + 2) * 3, \"X\"", "PRINT -a * 2; (1 + 2) * 3, \"X\""},
+		{"10 print a mod 3;", "PRINT a MOD 3;"},
+		{"10 if a > 1 and b < 2 or not c then 100 else print \"NO\"", "IF a > 1 AND b < 2 OR NOT c THEN 100 ELSE PRINT \"NO\""},
+		{"10 for i = 10 to 1 step -2: next i", "FOR i = 10 TO 1 STEP -2: NEXT i"},
+		{"10 gosub 200: goto 10", "GOSUB 200: GOTO 10"},
+		{"10 input \"NAME\"; n$, x", "INPUT \"NAME\"; n$, x"},
+		{"10 let a = b$(3) <> \"Q\" imp x xor y", "LET a = b$(3) <> \"Q\" IMP x XOR y"},
+		{"10 read a, b$(1): data 1, \"S\", -2.5", "READ a, b$(1): DATA 1, \"S\", -2.5"},
+		{"10 return: end", "RETURN: END"},
+	}
+	for _, tt := range tests {
+		program := parse(t, tt.src+"\n")
+		if got := program.Statements[10].String(); got != tt.want {
+			t.Errorf("%q printed as %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
+
+// grouped writes expr with each operation in parentheses, to show how the
+// parser grouped it.
+func grouped(expr ast.Expression) string {
+	switch e := expr.(type) {
+	case *ast.InfixExpression:
+		return "(" + grouped(e.Left) + " " + e.Operator + " " + grouped(e.Right) + ")"
+	case *ast.PrefixExpression:
+		return "(" + e.Operator + " " + grouped(e.Right) + ")"
+	}
+	return expr.String()
+}
+
+func TestPrecedence(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"8 / 4 / 2", "((8 / 4) / 2)"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+		{"-A * 2", "((- A) * 2)"},
+		{"A MOD 3 + 1", "((A MOD 3) + 1)"},
+		{"A + 1 < B * 2", "((A + 1) < (B * 2))"},
+		{"A < 1 AND B > 2", "((A < 1) AND (B > 2))"},
+		{"A OR B AND C", "(A OR (B AND C))"},
+		{"NOT A AND B", "((NOT A) AND B)"},
+		{"A XOR B OR C", "(A XOR (B OR C))"},
+		{"A IMP B EQV C", "(A IMP (B EQV C))"},
+	}
+	for _, tt := range tests {
+		program := parse(t, "10 LET X = "+tt.expr+"\n")
+		let, ok := program.Statements[10].(*ast.LetStatement)
+		if !ok {
+			t.Fatalf("%q parsed to %T", tt.expr, program.Statements[10])
+		}
+		if got := grouped(let.Value); got != tt.want {
+			t.Errorf("%q grouped as %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestSyntaxErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"10 FOR I = 1 10", "expected TO, found '10'"},
+		{"10 GOTO", "unexpected end of line in expression"},
+		{"10 LET = 5", "expected a variable name, found '='"},
+		{"10 PRINT (1 + 2", "expected ')', found end of line"},
+		{"10 LET A = 1 +", "unexpected end of line in expression"},
+		{"10 PRNT 1", "unknown statement PRNT; did you mean PRINT?"},
+	}
+	for _, tt := range tests {
+		errs := parseErrors(tt.src + "\n")
+		if len(errs) == 0 || errs[0] != tt.want {
+			t.Errorf("%q: errors %q, want %q first", tt.src, errs, tt.want)
+		}
+	}
+}
+
+func TestTokensHoldsTheSource(t *testing.T) {
+	src := "10 PRINT \"HI\"; X\n20 GOTO 10\n"
+	p := New(lexer.New(src))
+	p.ParseProgram()
+	tokens := p.Tokens()
+	tokens.Reset(0)
+	l := lexer.New(src)
+	for {
+		want := l.NextToken()
+		if got := tokens.Next(); got != want {
+			t.Fatalf("token %d is %v, want %v", tokens.Pos(), got, want)
+		}
+		if want.Type == token.EOF {
+			break
+		}
+	}
+}
@@ -0,0 +1,256 @@
+//go:build js && wasm
+
+// Command playground is the interpreter built for a web browser, so that
+// BASIC can be written and run in a page with no server behind it. It is
+// built with
+//
+//	GOOS=js GOARCH=wasm go build -o playground/basic.wasm ./playground
+//
+// and, loaded with the Go toolchain's wasm_exec.js, sets a global object
+// basic with three methods:
+//
+//	basic.load(source, {dialect})
+//	basic.run({print, input, args})
+//	basic.interrupt()
+//
+// load parses a program, replacing the one loaded before, and returns
+// null, or an array of its syntax errors. The dialect is "standard" unless
+// another is named.
+//
+// run runs the loaded program and returns a Promise that resolves when it
+// ends and rejects with an Error saying why if it fails or is interrupted.
+// print is called with each piece of output, and input, when the program
+// asks for a line, with the prompt printed so far on the last line; it
+// returns the line typed, or a Promise of it, or null for no more input.
+// args are what the program sees through COMMAND$.
+//
+// interrupt stops the running program before its next line, or while it
+// waits for input or in SLEEP.
+//
+// index.html is a page that uses them.
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"syscall/js"
+	"time"
+
+	"github.com/basis-ex/basic"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/evaluator"
+)
+
+// yieldEvery is how long a program runs before it gives the browser a
+// turn, to draw what it printed and to handle a click on Stop. Go in
+// WebAssembly holds the page's only thread until it sleeps or waits.
+const yieldEvery = 50 * time.Millisecond
+
+var (
+	interp *basic.Interpreter
+	// con is where the loaded program's INPUT and PRINT go; each run
+	// gives it that run's callbacks.
+	con    = &console{}
+	cancel context.CancelFunc
+)
+
+func main() {
+	js.Global().Set("basic", js.ValueOf(map[string]any{
+		"load":      js.FuncOf(load),
+		"run":       js.FuncOf(run),
+		"interrupt": js.FuncOf(interrupt),
+	}))
+	select {}
+}
+
+func load(this js.Value, args []js.Value) any {
+	if len(args) == 0 || args[0].Type() != js.TypeString {
+		return jsError("load needs the program's source")
+	}
+	d := dialect.Standard
+	if name := option(args, 1, "dialect"); name.Type() == js.TypeString {
+		var ok bool
+		if d, ok = dialect.Lookup(name.String()); !ok {
+			return jsError("unknown dialect " + name.String() + ": use " + strings.Join(dialect.Names(), ", "))
+		}
+	}
+
+	in := basic.New(
+		basic.WithStdin(con),
+		basic.WithStdout(con),
+		basic.WithStderr(con),
+		basic.WithDialect(d),
+		basic.WithHooks(evaluator.Hooks{OnLineStart: yielder()}),
+	)
+	err := in.Load(args[0].String())
+	var parseErr *basic.ParseError
+	if errors.As(err, &parseErr) {
+		errs := make([]any, len(parseErr.Errors))
+		for i, msg := range parseErr.Errors {
+			errs[i] = msg
+		}
+		return js.ValueOf(errs)
+	}
+	if err != nil {
+		return jsError(err.Error())
+	}
+	interp = in
+	return js.Null()
+}
+
+func run(this js.Value, args []js.Value) any {
+	var executor js.Func
+	executor = js.FuncOf(func(this js.Value, promise []js.Value) any {
+		executor.Release()
+		resolve, reject := promise[0], promise[1]
+		switch {
+		case interp == nil:
+			reject.Invoke(jsError(basic.ErrNoProgram.Error()))
+			return nil
+		case cancel != nil:
+			reject.Invoke(jsError("a program is already running"))
+			return nil
+		}
+
+		var ctx context.Context
+		ctx, cancel = context.WithCancel(context.Background())
+		con.start(ctx, option(args, 0, "print"), option(args, 0, "input"))
+		var progArgs []string
+		if a := option(args, 0, "args"); a.Type() == js.TypeObject {
+			for i := 0; i < a.Length(); i++ {
+				progArgs = append(progArgs, a.Index(i).String())
+			}
+		}
+		basic.WithArgs(progArgs...)(interp)
+
+		// The program runs on its own goroutine, as one that called back
+		// into JavaScript here could not wait for a Promise.
+		go func() {
+			err := interp.Run(ctx)
+			cancel()
+			cancel = nil
+			if err != nil {
+				reject.Invoke(jsError(err.Error()))
+				return
+			}
+			resolve.Invoke(js.Undefined())
+		}()
+		return nil
+	})
+	return js.Global().Get("Promise").New(executor)
+}
+
+func interrupt(this js.Value, args []js.Value) any {
+	if cancel != nil {
+		cancel()
+	}
+	return nil
+}
+
+// yielder returns a hook that sleeps briefly, letting the browser run,
+// each time the program has run for yieldEvery.
+func yielder() func(line int) {
+	last := time.Now()
+	return func(line int) {
+		if time.Since(last) >= yieldEvery {
+			time.Sleep(time.Millisecond)
+			last = time.Now()
+		}
+	}
+}
+
+// option returns the named property of the object args[i], or undefined
+// if there is no such argument.
+func option(args []js.Value, i int, name string) js.Value {
+	if len(args) <= i || args[i].Type() != js.TypeObject {
+		return js.Undefined()
+	}
+	return args[i].Get(name)
+}
+
+func jsError(msg string) js.Value {
+	return js.Global().Get("Error").New(msg)
+}
+
+// console is the program's standard input and output, passed to the
+// callbacks of the run: writes to print, and reads, when what was typed
+// before is used up, to input, with the last line printed as its prompt.
+type console struct {
+	ctx          context.Context
+	print, input js.Value
+	prompt       string
+	pending      string
+}
+
+func (c *console) start(ctx context.Context, print, input js.Value) {
+	*c = console{ctx: ctx, print: print, input: input}
+}
+
+func (c *console) Write(p []byte) (int, error) {
+	text := string(p)
+	if i := strings.LastIndexByte(text, '\n'); i >= 0 {
+		c.prompt = text[i+1:]
+	} else {
+		c.prompt += text
+	}
+	if c.print.Type() == js.TypeFunction {
+		c.print.Invoke(text)
+	}
+	return len(p), nil
+}
+
+func (c *console) Read(p []byte) (int, error) {
+	if c.pending == "" {
+		line, ok := c.ask()
+		if !ok {
+			return 0, io.EOF
+		}
+		c.pending = line + "\n"
+	}
+	n := copy(p, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// ask calls input for a line and waits for it, if it returns a Promise. It
+// reports false at the end of the input: when there is no input callback,
+// it gives or resolves to null or undefined, its Promise is rejected, or
+// the run is interrupted.
+func (c *console) ask() (string, bool) {
+	if c.input.Type() != js.TypeFunction {
+		return "", false
+	}
+	answer := c.input.Invoke(c.prompt)
+	if answer.Type() == js.TypeObject && answer.Get("then").Type() == js.TypeFunction {
+		answers := make(chan js.Value, 1)
+		resolved := js.FuncOf(func(this js.Value, args []js.Value) any {
+			if len(args) == 0 {
+				answers <- js.Undefined()
+			} else {
+				answers <- args[0]
+			}
+			return nil
+		})
+		rejected := js.FuncOf(func(this js.Value, args []js.Value) any {
+			answers <- js.Null()
+			return nil
+		})
+		answer.Call("then", resolved, rejected)
+		select {
+		case answer = <-answers:
+			resolved.Release()
+			rejected.Release()
+		case <-c.ctx.Done():
+			// The Promise may yet settle, calling one of them, so they
+			// are kept.
+			return "", false
+		}
+	}
+	if answer.IsNull() || answer.IsUndefined() {
+		return "", false
+	}
+	c.prompt = ""
+	return answer.String(), true
+}
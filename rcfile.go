@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// initFile is the startup script given with -init; when empty the REPL
+// reads ~/.basicrc if there is one.
+var initFile string
+
+// promptText is the REPL prompt, changed with SET PROMPT.
+var promptText = "> "
+
+// runInitFile feeds the lines of the startup script to the REPL as if they
+// had been typed: commands such as LOAD or SET, program lines, and
+// statements to run at once. Blank lines and lines starting with # or '
+// are skipped. It returns false if the script asked to leave the REPL.
+func (r *repl) runInitFile() bool {
+	path, required := initFile, true
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return true
+		}
+		path, required = filepath.Join(home, ".basicrc"), false
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if required || !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "Warning: startup file not read: %v\n", err)
+		}
+		return true
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "'") {
+			continue
+		}
+		if !r.command(line) {
+			return false
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: reading %s: %v\n", path, err)
+	}
+	return true
+}
+
+// setPrompt handles SET PROMPT text. The text keeps its case and may be
+// quoted to keep leading or trailing spaces.
+func setPrompt(text string) error {
+	text = strings.TrimSpace(text)
+	if len(text) >= 2 && strings.HasPrefix(text, `"`) && strings.HasSuffix(text, `"`) {
+		text = text[1 : len(text)-1]
+	}
+	if text == "" {
+		return fmt.Errorf(`usage: SET PROMPT "text"`)
+	}
+	promptText = text
+	return nil
+}
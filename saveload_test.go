@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestSaveAndLoadTokenized saves a program tokenized and protected and
+// loads it back, both naming the file in quotes, as GW-BASIC does.
+func TestSaveAndLoadTokenized(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "prog.bas")
+	r := &repl{workspaces: map[int]*workspace{1: newWorkspace()}, current: 1}
+	r.ws = r.workspaces[1]
+	// GW-BASIC lists these as .25, 12345678# and 1E+10.
+	want := "10 PRINT 0.25; 12345678; 10000000000"
+	r.ws.lines[10] = want
+
+	for _, format := range []string{"T", "P"} {
+		r.command(`SAVE "` + filename + `",` + format)
+		if _, err := os.Stat(filename); err != nil {
+			t.Fatalf("SAVE ,%s: %v", format, err)
+		}
+		r.ws.lines = map[int]string{}
+		r.command(`LOAD "` + filename + `"`)
+		if got := r.ws.lines[10]; got != want {
+			t.Errorf("SAVE ,%s then LOAD gives %q, want %q", format, got, want)
+		}
+		if err := os.Remove(filename); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestSaveAndLoadState saves a stopped program with SAVESTATE and loads it
+// back with LOADSTATE, naming the file in quotes as SAVE and LOAD take it.
+func TestSaveAndLoadState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "prog.state")
+	r := &repl{workspaces: map[int]*workspace{1: newWorkspace()}, current: 1, dbg: newDebugger()}
+	r.ws = r.workspaces[1]
+	r.ws.lines[10] = "10 LET A = 42"
+	r.ws.lines[20] = "20 PRINT A"
+	r.dbg.breakpoints[20] = true
+	r.command("RUN")
+	if r.ws.stopped == nil {
+		t.Fatal("RUN did not stop at the breakpoint")
+	}
+
+	r.command(`SAVESTATE "` + filename + `"`)
+	if _, err := os.Stat(filename); err != nil {
+		t.Fatalf("SAVESTATE: %v", err)
+	}
+	r.ws.lines, r.ws.stopped = map[int]string{}, nil
+	r.command(`LOADSTATE "` + filename + `"`)
+	if r.ws.stopped == nil || r.ws.lines[20] != "20 PRINT A" {
+		t.Fatalf("LOADSTATE left lines %v, stopped %v", r.ws.lines, r.ws.stopped != nil)
+	}
+	if line, ok := r.ws.stopped.NextLine(); !ok || line != 20 {
+		t.Errorf("LOADSTATE stopped at line %d, want 20", line)
+	}
+}
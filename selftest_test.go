@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestExamplesAgree runs each program in examples/ as basic selftest does,
+// on the tree interpreter, the bytecode machine, built with compile -build
+// and translated to Python and JavaScript where those are installed, and
+// fails on any difference between them.
+func TestExamplesAgree(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds the tool and every example")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("needs the Go toolchain")
+	}
+	dir := t.TempDir()
+	self := filepath.Join(dir, executableName("basic.bas"))
+	if out, err := exec.Command(goTool, "build", "-o", self, ".").CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+
+	programs := findPrograms([]string{"examples"})
+	if len(programs) == 0 {
+		t.Fatal("no programs in examples/")
+	}
+	onVM := 0
+	for _, prog := range programs {
+		if vmTakes(prog) {
+			onVM++
+		}
+		exe := filepath.Join(dir, executableName(filepath.Base(prog)))
+		t.Run(filepath.Base(prog), func(t *testing.T) {
+			msg, compiled := selftest(self, prog, exe, time.Minute)
+			if !compiled {
+				t.Fatalf("did not compile: %s", msg)
+			}
+			if msg != "" {
+				t.Error(msg)
+			}
+		})
+	}
+	if onVM == 0 {
+		t.Error("the VM took none of the examples")
+	}
+}
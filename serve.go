@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/basis-ex/check"
+	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/optimize"
+	"github.com/basis-ex/parser"
+)
+
+// serveLimits bound each program basic serve runs, as none of them can be
+// trusted.
+type serveLimits struct {
+	timeout   time.Duration
+	maxSteps  int64
+	maxOutput int
+	maxBody   int64
+}
+
+// runRequest is the body of a POST to /run: the program, what its INPUT
+// statements read, one answer a line, and its COMMAND$ arguments.
+type runRequest struct {
+	Program string   `json:"program"`
+	Input   string   `json:"input"`
+	Args    []string `json:"args"`
+}
+
+// runResponse says how a program ran. Status is the exit status basic run
+// would have given: the program's own when it finished, 1 for a runtime
+// error, 3 when it does not parse and 5 when it ran past a limit. Errors
+// are what stopped it from parsing, and Error what stopped it running.
+type runResponse struct {
+	Output     string        `json:"output"`
+	Status     int           `json:"status"`
+	Errors     []serveError  `json:"errors,omitempty"`
+	Error      *serveError   `json:"error,omitempty"`
+	Statements int64         `json:"statements"`
+	Elapsed    time.Duration `json:"elapsed_ns"`
+}
+
+// serveError is a problem with a program. For a syntax error, Line and
+// Column place it in the text sent, counting from 1; for a runtime error,
+// Line is the BASIC line that failed and Code its error code.
+type serveError struct {
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Code    int    `json:"code,omitempty"`
+}
+
+// serveCommand runs programs sent over HTTP and answers with their output
+// as JSON, for grading and playgrounds. Each runs sandboxed, unable to use
+// SHELL, files or the environment, and within the limits given, and at
+// most -workers run at once; the others wait their turn.
+func serveCommand(fs *flag.FlagSet) func(args []string) {
+	addDialectFlag(fs)
+	addStrictFlag(fs)
+	listen := fs.String("listen", ":8080", "the address to serve on")
+	workers := fs.Int("workers", runtime.NumCPU(), "how many programs may run at once")
+	var limits serveLimits
+	fs.DurationVar(&limits.timeout, "timeout", 5*time.Second, "stop a program after it has run this long")
+	fs.Int64Var(&limits.maxSteps, "max-steps", 10_000_000, "stop a program after this many statements")
+	fs.IntVar(&limits.maxOutput, "max-output", 1<<20, "stop a program once it has printed this many bytes")
+	fs.Int64Var(&limits.maxBody, "max-request", 1<<20, "refuse requests larger than this many bytes")
+	return func(args []string) {
+		fs.Parse(args)
+		if fs.NArg() > 0 {
+			fs.Usage()
+			os.Exit(exitUsage)
+		}
+		if *workers < 1 || limits.timeout <= 0 || limits.maxSteps <= 0 || limits.maxOutput <= 0 || limits.maxBody <= 0 {
+			fmt.Fprintln(os.Stderr, "-workers and the limits must be greater than 0")
+			os.Exit(exitUsage)
+		}
+		mux := http.NewServeMux()
+		mux.Handle("/run", &runHandler{limits: limits, slots: make(chan struct{}, *workers)})
+		log.Printf("serving on %s", *listen)
+		if err := http.ListenAndServe(*listen, mux); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(exitFileError)
+		}
+	}
+}
+
+type runHandler struct {
+	limits serveLimits
+	// slots holds a token for each program running.
+	slots chan struct{}
+}
+
+func (h *runHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "POST a program as JSON", http.StatusMethodNotAllowed)
+		return
+	}
+	var req runRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.limits.maxBody)).Decode(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "bad request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+		defer func() { <-h.slots }()
+	case <-r.Context().Done():
+		return
+	}
+	resp := runSandboxed(r.Context(), req, h.limits)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// runSandboxed parses and runs the program of req within limits, stopping
+// it early if ctx is cancelled, as it is when the client goes away.
+func runSandboxed(ctx context.Context, req runRequest, limits serveLimits) *runResponse {
+	resp := &runResponse{}
+	p := parser.New(newLexer(req.Program))
+	program := p.ParseProgram()
+	for _, err := range p.ErrorList() {
+		resp.Errors = append(resp.Errors, serveError{Message: err.Msg, Line: err.Pos.Line, Column: err.Pos.Column})
+	}
+	if len(resp.Errors) == 0 {
+		optimize.Program(program, optimize.Options{Dialect: basicDialect, MaxStringLength: evaluator.DefaultMaxStringLength})
+		for _, u := range check.UndefinedTargets(program) {
+			resp.Errors = append(resp.Errors, serveError{Message: u.String()})
+		}
+		if strict {
+			for _, problem := range check.Types(program) {
+				resp.Errors = append(resp.Errors, serveError{Message: problem.String()})
+			}
+		}
+	}
+	if len(resp.Errors) > 0 {
+		resp.Status = exitSyntaxError
+		return resp
+	}
+
+	// A program waiting in SLEEP is past the clock SetTimeout checks
+	// between statements, and PRINT does not stop for a failed write, so
+	// the run's context is cancelled for both limits, with the reason as
+	// its cause.
+	ctx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	ctx, cancel := context.WithTimeoutCause(ctx, limits.timeout, fmt.Errorf("%w: more than %v", evaluator.ErrExecutionLimit, limits.timeout))
+	defer cancel()
+	out := &limitedWriter{max: limits.maxOutput, stop: stop}
+	eval := evaluator.New(program, evaluator.Options{Stdout: out, Stderr: out})
+	eval.SetInput(strings.NewReader(req.Input))
+	eval.SetSandboxed(true)
+	eval.SetArgs(req.Args)
+	eval.SetDialect(basicDialect)
+	eval.SetMaxSteps(limits.maxSteps)
+	eval.SetTimeout(limits.timeout)
+
+	start := time.Now()
+	err := eval.Run(ctx)
+	resp.Elapsed = time.Since(start)
+	resp.Output = out.String()
+	resp.Statements = eval.Stats().Statements
+	resp.Status = eval.ExitStatus()
+	if err == nil && out.err != nil {
+		// The program may end with the statement that went past the
+		// limit, before the cancelled context is seen.
+		err = out.err
+	}
+	if err == nil {
+		return resp
+	}
+	resp.Error = &serveError{Message: err.Error()}
+	var rt *evaluator.RuntimeError
+	if errors.As(err, &rt) {
+		resp.Error.Line, resp.Error.Code = rt.Line, int(rt.Code)
+	}
+	var cancelled *evaluator.CancelError
+	if errors.As(err, &cancelled) {
+		resp.Error.Line = cancelled.Line
+		if cause := context.Cause(ctx); cause != cancelled.Err {
+			err = cause
+			resp.Error.Message = fmt.Sprintf("%v in line %d", cause, cancelled.Line)
+		}
+	}
+	resp.Status = exitRuntimeError
+	if errors.Is(err, evaluator.ErrExecutionLimit) || errors.Is(err, errOutputLimit) {
+		resp.Status = exitLimit
+	}
+	return resp
+}
+
+var errOutputLimit = errors.New("program exceeded output limit")
+
+// limitedWriter keeps what a program prints up to max bytes, and calls
+// stop with err, wrapping errOutputLimit, when it would go past them.
+type limitedWriter struct {
+	strings.Builder
+	max  int
+	stop context.CancelCauseFunc
+	err  error
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.Len()+len(p) > w.max {
+		n, _ := w.Builder.Write(p[:w.max-w.Len()])
+		w.err = fmt.Errorf("%w: more than %d bytes", errOutputLimit, w.max)
+		w.stop(w.err)
+		return n, w.err
+	}
+	return w.Builder.Write(p)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/basis-ex/evaluator"
+)
+
+// post sends program to a basic serve handler with the given limits and
+// returns the HTTP status and the decoded answer.
+func post(t *testing.T, limits serveLimits, body string) (int, runResponse) {
+	t.Helper()
+	srv := httptest.NewServer(&runHandler{limits: limits, slots: make(chan struct{}, 1)})
+	defer srv.Close()
+	res, err := http.Post(srv.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var resp runResponse
+	if res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+	}
+	return res.StatusCode, resp
+}
+
+func programBody(program string) string {
+	data, _ := json.Marshal(runRequest{Program: program, Input: "42\n"})
+	return string(data)
+}
+
+func TestServe(t *testing.T) {
+	limits := serveLimits{timeout: 200 * time.Millisecond, maxSteps: 10_000, maxOutput: 64, maxBody: 1 << 10}
+	tests := []struct {
+		name, program string
+		status        int
+		output        string
+		// message is part of the error that stopped the program, and code
+		// its runtime error code.
+		message string
+		code    evaluator.ErrorCode
+	}{
+		{
+			name:    "program runs",
+			program: "10 INPUT A\n20 PRINT A + 1\n",
+			output:  "43\n",
+		},
+		{
+			name:    "syntax error",
+			program: "10 PRINT (1\n",
+			status:  exitSyntaxError,
+		},
+		{
+			name:    "step cap",
+			program: "10 LET I = I + 1\n20 GOTO 10\n",
+			status:  exitLimit,
+			message: "10000",
+		},
+		{
+			name:    "timeout",
+			program: "10 SLEEP 5\n",
+			status:  exitLimit,
+			message: "more than 200ms",
+		},
+		{
+			name:    "output cap",
+			program: "10 PRINT \"0123456789\": GOTO 10\n",
+			status:  exitLimit,
+			output:  strings.Repeat("0123456789\n", 6)[:64],
+			message: "more than 64 bytes",
+		},
+		{
+			name:    "SHELL",
+			program: "10 SHELL \"echo hi\"\n",
+			status:  exitRuntimeError,
+			message: "SHELL",
+			code:    evaluator.PermissionDenied,
+		},
+		{
+			name:    "OPEN",
+			program: "10 OPEN \"x.dat\" FOR RANDOM AS #1 LEN = 20\n",
+			status:  exitRuntimeError,
+			code:    evaluator.PermissionDenied,
+		},
+		{
+			name:    "KILL",
+			program: "10 KILL \"*.bas\"\n",
+			status:  exitRuntimeError,
+			code:    evaluator.PermissionDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpStatus, resp := post(t, limits, programBody(tt.program))
+			if httpStatus != http.StatusOK {
+				t.Fatalf("HTTP status %d", httpStatus)
+			}
+			if resp.Status != tt.status {
+				t.Errorf("status %d, want %d (%+v)", resp.Status, tt.status, resp)
+			}
+			if tt.output != "" && !strings.HasSuffix(resp.Output, tt.output) {
+				t.Errorf("output %q, want it to end %q", resp.Output, tt.output)
+			}
+			if tt.status == exitLimit || tt.status == exitRuntimeError {
+				if resp.Error == nil {
+					t.Fatal("no error reported")
+				}
+				if !strings.Contains(resp.Error.Message, tt.message) {
+					t.Errorf("error %q, want it to contain %q", resp.Error.Message, tt.message)
+				}
+				if resp.Error.Code != int(tt.code) {
+					t.Errorf("error code %d, want %d", resp.Error.Code, tt.code)
+				}
+				if tt.code != 0 && resp.Error.Line != 10 {
+					t.Errorf("error in line %d, want 10", resp.Error.Line)
+				}
+			}
+			if tt.status == exitSyntaxError && len(resp.Errors) == 0 {
+				t.Error("no syntax errors reported")
+			}
+		})
+	}
+}
+
+func TestServeTimeoutStopsBusyLoop(t *testing.T) {
+	limits := serveLimits{timeout: 100 * time.Millisecond, maxSteps: 1 << 40, maxOutput: 64, maxBody: 1 << 10}
+	start := time.Now()
+	_, resp := post(t, limits, programBody("10 FOR I = 1 TO 2: LET I = 1: NEXT I\n"))
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("took %v to stop", elapsed)
+	}
+	if resp.Status != exitLimit {
+		t.Errorf("status %d, want %d (%+v)", resp.Status, exitLimit, resp)
+	}
+}
+
+func TestServeOutputCapIsExact(t *testing.T) {
+	limits := serveLimits{timeout: time.Second, maxSteps: 1_000_000, maxOutput: 25, maxBody: 1 << 10}
+	_, resp := post(t, limits, programBody("10 FOR I = 1 TO 100: PRINT \"ABCDEFGHIJ\": NEXT I\n"))
+	if len(resp.Output) != 25 {
+		t.Errorf("kept %d bytes of output, want 25", len(resp.Output))
+	}
+	if resp.Status != exitLimit {
+		t.Errorf("status %d, want %d", resp.Status, exitLimit)
+	}
+}
+
+func TestServeRejectsBadRequests(t *testing.T) {
+	limits := serveLimits{timeout: time.Second, maxSteps: 1000, maxOutput: 1000, maxBody: 64}
+	tests := []struct {
+		name, body string
+		want       int
+	}{
+		{"not JSON", "10 PRINT 1", http.StatusBadRequest},
+		{"too large", programBody("10 REM " + strings.Repeat("X", 100)), http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		if got, _ := post(t, limits, tt.body); got != tt.want {
+			t.Errorf("%s: HTTP status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	srv := httptest.NewServer(&runHandler{limits: limits, slots: make(chan struct{}, 1)})
+	defer srv.Close()
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: HTTP status %d, want %d", res.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
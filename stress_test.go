@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stressLines is how long a program TestLargeProgram loads, lists and runs.
+const stressLines = 100000
+
+// stressBudget is how long it may take. Work that grows with the square of
+// the length, such as looking a line up by walking the program, would take
+// minutes.
+const stressBudget = 20 * time.Second
+
+// writeStressProgram writes a program of stressLines lines to a file in
+// dir: a line adding to S for each but every thousandth, which GOSUBs to
+// the last line instead, and the two lines that print S and C and end.
+func writeStressProgram(t *testing.T, dir string) string {
+	t.Helper()
+	filename := filepath.Join(dir, "stress.bas")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	last := stressLines * 10
+	fmt.Fprintln(w, "10 LET S = 0: LET C = 0")
+	for n := 2; n <= stressLines-2; n++ {
+		if n%1000 == 0 {
+			fmt.Fprintf(w, "%d GOSUB %d\n", n*10, last)
+		} else {
+			fmt.Fprintf(w, "%d LET S = S + 1\n", n*10)
+		}
+	}
+	fmt.Fprintf(w, "%d PRINT S; C: END\n", last-10)
+	fmt.Fprintf(w, "%d LET C = C + 1: RETURN\n", last)
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestLargeProgram(t *testing.T) {
+	if testing.Short() {
+		t.Skip("loads a 100,000-line program")
+	}
+	filename := writeStressProgram(t, t.TempDir())
+	start := time.Now()
+
+	lines, err := loadProgramFromFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != stressLines {
+		t.Fatalf("loaded %d lines, want %d", len(lines), stressLines)
+	}
+
+	var listing strings.Builder
+	if err := writeListing(&listing, lines, ""); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(listing.String(), "\n"); n != stressLines {
+		t.Errorf("listed %d lines, want %d", n, stressLines)
+	}
+	if !strings.HasPrefix(listing.String(), "10 LET S = 0: LET C = 0\n20 LET S = S + 1\n") {
+		t.Errorf("listing starts %q", listing.String()[:40])
+	}
+
+	eval := loadProgram(lines)
+	if eval == nil {
+		t.Fatal("program did not load")
+	}
+	var out strings.Builder
+	eval.SetOutput(&out)
+	if err := eval.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// Lines 2 to stressLines-2, less the GOSUBs.
+	gosubs := (stressLines - 2) / 1000
+	if want := fmt.Sprintf("%d%d\n", stressLines-3-gosubs, gosubs); out.String() != want {
+		t.Errorf("printed %q, want %q", out.String(), want)
+	}
+
+	if elapsed := time.Since(start); elapsed > stressBudget {
+		t.Errorf("took %v, more than %v", elapsed, stressBudget)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build darwin || freebsd || openbsd || netbsd || dragonfly
+
+package term
+
+import "syscall"
+
+const (
+	ioctlGet = syscall.TIOCGETA
+	ioctlSet = syscall.TIOCSETA
+)
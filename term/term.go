@@ -0,0 +1,16 @@
+// Package term switches the controlling terminal in and out of the modes
+// needed for single-key input, using only the standard library. On systems
+// without support the functions report ErrUnsupported and callers fall back
+// to line-buffered input.
+package term
+
+import "errors"
+
+// ErrUnsupported is returned on platforms where the terminal mode cannot be
+// changed.
+var ErrUnsupported = errors.New("terminal control not supported on this platform")
+
+// State is a saved terminal mode, to be handed back to Restore.
+type State struct {
+	state termios
+}
@@ -0,0 +1,26 @@
+//go:build !linux && !darwin && !freebsd && !openbsd && !netbsd && !dragonfly
+
+package term
+
+type termios struct{}
+
+// IsTerminal reports whether fd refers to a terminal. Without terminal
+// support it always reports false.
+func IsTerminal(fd int) bool {
+	return false
+}
+
+// MakeCbreak is not available on this platform.
+func MakeCbreak(fd int) (*State, error) {
+	return nil, ErrUnsupported
+}
+
+// MakeRaw is not available on this platform.
+func MakeRaw(fd int) (*State, error) {
+	return nil, ErrUnsupported
+}
+
+// Restore is not available on this platform.
+func Restore(fd int, s *State) error {
+	return ErrUnsupported
+}
@@ -0,0 +1,72 @@
+//go:build linux || darwin || freebsd || openbsd || netbsd || dragonfly
+
+package term
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+type termios = syscall.Termios
+
+func getTermios(fd int) (*termios, error) {
+	var t termios
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlGet, uintptr(unsafe.Pointer(&t))); errno != 0 {
+		return nil, errno
+	}
+	return &t, nil
+}
+
+func setTermios(fd int, t *termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), ioctlSet, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// IsTerminal reports whether fd refers to a terminal.
+func IsTerminal(fd int) bool {
+	_, err := getTermios(fd)
+	return err == nil
+}
+
+// MakeCbreak turns off line buffering and echo so each key is readable as
+// soon as it is pressed. Signals such as Ctrl-C still work, and output is
+// processed as usual. It returns the previous state for Restore.
+func MakeCbreak(fd int) (*State, error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+	t := *old
+	t.Lflag &^= syscall.ICANON | syscall.ECHO
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, &t); err != nil {
+		return nil, err
+	}
+	return &State{state: *old}, nil
+}
+
+// MakeRaw is MakeCbreak with signal keys turned off as well, so Ctrl-C and
+// Ctrl-Z arrive as ordinary bytes for a line editor to handle.
+func MakeRaw(fd int) (*State, error) {
+	old, err := getTermios(fd)
+	if err != nil {
+		return nil, err
+	}
+	t := *old
+	t.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := setTermios(fd, &t); err != nil {
+		return nil, err
+	}
+	return &State{state: *old}, nil
+}
+
+// Restore puts the terminal back in a state returned by MakeCbreak or
+// MakeRaw.
+func Restore(fd int, s *State) error {
+	return setTermios(fd, &s.state)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// testFormats are the forms basic test can write its results in: text,
+// a line a program; tap, the Test Anything Protocol; and go, as go test -v
+// does, for the tools that read either.
+var testFormats = []string{"text", "tap", "go"}
+
+func isTestFormat(name string) bool {
+	for _, format := range testFormats {
+		if name == format {
+			return true
+		}
+	}
+	return false
+}
+
+// testReport writes the results of basic test, one program at a time, in
+// one of testFormats.
+type testReport struct {
+	out    io.Writer
+	format string
+	// total is how many programs there are to report, done how many have
+	// been and failed how many of those failed.
+	total  int
+	done   int
+	failed int
+	start  time.Time
+}
+
+func newTestReport(out io.Writer, format string, total int) *testReport {
+	r := &testReport{out: out, format: format, total: total, start: time.Now()}
+	if format == "tap" {
+		fmt.Fprintln(out, "TAP version 13")
+		fmt.Fprintf(out, "1..%d\n", total)
+	}
+	return r
+}
+
+// result reports the program prog, which took elapsed to run and failed
+// for the reason msg, or passed if msg is "".
+func (r *testReport) result(prog, msg string, elapsed time.Duration) {
+	r.done++
+	if msg != "" {
+		r.failed++
+	}
+	switch r.format {
+	case "tap":
+		if msg == "" {
+			fmt.Fprintf(r.out, "ok %d - %s\n", r.done, prog)
+			return
+		}
+		fmt.Fprintf(r.out, "not ok %d - %s\n", r.done, prog)
+		fmt.Fprintln(r.out, "  ---")
+		fmt.Fprintf(r.out, "  message: %s\n", strconv.Quote(msg))
+		fmt.Fprintf(r.out, "  duration_ms: %d\n", elapsed.Milliseconds())
+		fmt.Fprintln(r.out, "  ...")
+	case "go":
+		fmt.Fprintf(r.out, "=== RUN   %s\n", prog)
+		if msg == "" {
+			fmt.Fprintf(r.out, "--- PASS: %s (%.2fs)\n", prog, elapsed.Seconds())
+			return
+		}
+		fmt.Fprintf(r.out, "--- FAIL: %s (%.2fs)\n", prog, elapsed.Seconds())
+		fmt.Fprintf(r.out, "    %s\n", msg)
+	default:
+		if msg == "" {
+			fmt.Fprintf(r.out, "ok   %s\n", prog)
+		} else {
+			fmt.Fprintf(r.out, "FAIL %s: %s\n", prog, msg)
+		}
+	}
+}
+
+// finish writes the summary, and reports whether every program passed.
+func (r *testReport) finish() bool {
+	passed := r.total - r.failed
+	switch r.format {
+	case "tap":
+		fmt.Fprintf(r.out, "# %d passed, %d failed\n", passed, r.failed)
+	case "go":
+		status := "ok  "
+		if r.failed > 0 {
+			fmt.Fprintln(r.out, "FAIL")
+			status = "FAIL"
+		} else {
+			fmt.Fprintln(r.out, "PASS")
+		}
+		fmt.Fprintf(r.out, "%s\t%d programs\t%.3fs\n", status, r.total, time.Since(r.start).Seconds())
+	default:
+		fmt.Fprintf(r.out, "%d passed, %d failed\n", passed, r.failed)
+	}
+	return r.failed == 0
+}
@@ -1,11 +1,45 @@
 package token
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/intrinsic"
+)
+
 type TokenType string
 
 type Token struct {
 	Type    TokenType
 	Literal string
 	Line    int
+	// Column is where the token starts on Line, counting bytes from 1.
+	Column int
+	// End is the position just after the token's last character.
+	End Position
+}
+
+// Pos is the position of the token's first character.
+func (t Token) Pos() Position {
+	return Position{Line: t.Line, Column: t.Column}
+}
+
+// Position is a place in the source text: a line and a column, in bytes,
+// both counted from 1. The zero Position is no place, as for a node the
+// parser made up, such as the STEP 1 of a FOR without one.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// IsValid reports whether p is a place in the source.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
 }
 
 const (
@@ -16,6 +50,9 @@ const (
 	IDENT  = "IDENT"
 	NUMBER = "NUMBER"
 	STRING = "STRING"
+	// COMMENT is the text of a remark, as written, from after REM to the
+	// end of the statement.
+	COMMENT = "COMMENT"
 
 	ASSIGN = "="
 	PLUS   = "+"
@@ -24,61 +61,293 @@ const (
 	DIV    = "/"
 	MOD    = "MOD"
 
-	LT     = "<"
-	GT     = ">"
-	LE     = "<="
-	GE     = ">="
-	EQ     = "=="
-	NE     = "<>"
-
-	LPAREN = "("
-	RPAREN = ")"
-	COMMA  = ","
-	COLON  = ":"
+	LT = "<"
+	GT = ">"
+	LE = "<="
+	GE = ">="
+	EQ = "=="
+	NE = "<>"
+
+	LPAREN    = "("
+	RPAREN    = ")"
+	COMMA     = ","
+	COLON     = ":"
 	SEMICOLON = ";"
+	HASH      = "#"
+
+	PRINT   = "PRINT"
+	LET     = "LET"
+	IF      = "IF"
+	THEN    = "THEN"
+	ELSE    = "ELSE"
+	GOTO    = "GOTO"
+	GOSUB   = "GOSUB"
+	RETURN  = "RETURN"
+	FOR     = "FOR"
+	TO      = "TO"
+	STEP    = "STEP"
+	NEXT    = "NEXT"
+	INPUT   = "INPUT"
+	REM     = "REM"
+	END     = "END"
+	DIM     = "DIM"
+	DATA    = "DATA"
+	READ    = "READ"
+	RESTORE = "RESTORE"
+	DUMP    = "DUMP"
+	SHELL   = "SHELL"
+	CLS     = "CLS"
+	LOCATE  = "LOCATE"
+	COLOR   = "COLOR"
+	SCREEN  = "SCREEN"
+	PLOT    = "PLOT"
+	LINE    = "LINE"
+	CIRCLE  = "CIRCLE"
+	POKE    = "POKE"
+	OPEN    = "OPEN"
+	AS      = "AS"
+	CLOSE   = "CLOSE"
+	FIELD   = "FIELD"
+	GET     = "GET"
+	PUT     = "PUT"
+	LSET    = "LSET"
+	RSET    = "RSET"
+	FILES   = "FILES"
+	KILL    = "KILL"
+	NAME    = "NAME"
+	CHDIR   = "CHDIR"
+	SUB     = "SUB"
+	CALL    = "CALL"
+	ON      = "ON"
+	TIMER   = "TIMER"
+	SYSTEM  = "SYSTEM"
+	SLEEP   = "SLEEP"
+	AND     = "AND"
+	OR      = "OR"
+	XOR     = "XOR"
+	EQV     = "EQV"
+	IMP     = "IMP"
+	TRUE    = "TRUE"
+	FALSE   = "FALSE"
+	NOT     = "NOT"
 
-	PRINT  = "PRINT"
-	LET    = "LET"
-	IF     = "IF"
-	THEN   = "THEN"
-	ELSE   = "ELSE"
-	GOTO   = "GOTO"
-	GOSUB  = "GOSUB"
-	RETURN = "RETURN"
-	FOR    = "FOR"
-	TO     = "TO"
-	STEP   = "STEP"
-	NEXT   = "NEXT"
-	INPUT  = "INPUT"
-	REM    = "REM"
-	END    = "END"
-	DIM    = "DIM"
-	AND    = "AND"
-	OR     = "OR"
-	NOT    = "NOT"
+	SCREENSAVE = "SCREENSAVE"
 )
 
 var keywords = map[string]TokenType{
-	"PRINT":  PRINT,
-	"LET":    LET,
-	"IF":     IF,
-	"THEN":   THEN,
-	"ELSE":   ELSE,
-	"GOTO":   GOTO,
-	"GOSUB":  GOSUB,
-	"RETURN": RETURN,
-	"FOR":    FOR,
-	"TO":     TO,
-	"STEP":   STEP,
-	"NEXT":   NEXT,
-	"INPUT":  INPUT,
-	"REM":    REM,
-	"END":    END,
-	"DIM":    DIM,
-	"AND":    AND,
-	"OR":     OR,
-	"NOT":    NOT,
-	"MOD":    MOD,
+	"PRINT":   PRINT,
+	"LET":     LET,
+	"IF":      IF,
+	"THEN":    THEN,
+	"ELSE":    ELSE,
+	"GOTO":    GOTO,
+	"GOSUB":   GOSUB,
+	"RETURN":  RETURN,
+	"FOR":     FOR,
+	"TO":      TO,
+	"STEP":    STEP,
+	"NEXT":    NEXT,
+	"INPUT":   INPUT,
+	"REM":     REM,
+	"END":     END,
+	"DIM":     DIM,
+	"DATA":    DATA,
+	"READ":    READ,
+	"RESTORE": RESTORE,
+	"DUMP":    DUMP,
+	"SHELL":   SHELL,
+	"CLS":     CLS,
+	"LOCATE":  LOCATE,
+	"COLOR":   COLOR,
+	"SCREEN":  SCREEN,
+	"PLOT":    PLOT,
+	"LINE":    LINE,
+	"CIRCLE":  CIRCLE,
+	"POKE":    POKE,
+	"OPEN":    OPEN,
+	"AS":      AS,
+	"CLOSE":   CLOSE,
+	"FIELD":   FIELD,
+	"GET":     GET,
+	"PUT":     PUT,
+	"LSET":    LSET,
+	"RSET":    RSET,
+	"FILES":   FILES,
+	"KILL":    KILL,
+	"NAME":    NAME,
+	"CHDIR":   CHDIR,
+	"SUB":     SUB,
+	"CALL":    CALL,
+	"ON":      ON,
+	"TIMER":   TIMER,
+	"SYSTEM":  SYSTEM,
+	"SLEEP":   SLEEP,
+	"AND":     AND,
+	"OR":      OR,
+	"XOR":     XOR,
+	"EQV":     EQV,
+	"IMP":     IMP,
+	"TRUE":    TRUE,
+	"FALSE":   FALSE,
+	"NOT":     NOT,
+	"MOD":     MOD,
+
+	"SCREENSAVE": SCREENSAVE,
+}
+
+// IsBuiltin reports whether name, in upper case, is a built-in function.
+// Their names are identifiers rather than keywords, so a name followed by
+// "(" is parsed as a call.
+func IsBuiltin(name string) bool {
+	_, ok := intrinsic.Lookup(name)
+	return ok
+}
+
+// abbreviations are the shorthand forms accepted when typing lines: the
+// first letters of a keyword followed by a dot.
+var abbreviations = map[string]string{
+	"P.":   "PRINT",
+	"I.":   "INPUT",
+	"G.":   "GOTO",
+	"GOS.": "GOSUB",
+	"RET.": "RETURN",
+	"F.":   "FOR",
+	"N.":   "NEXT",
+	"T.":   "THEN",
+	"E.":   "END",
+	"D.":   "DATA",
+	"RE.":  "READ",
+	"RES.": "RESTORE",
+	"DI.":  "DIM",
+	"L.":   "LIST",
+}
+
+// ExpandAbbreviations rewrites the keyword abbreviations in a typed line,
+// such as P. for PRINT, into the full keywords. An abbreviation is only
+// recognised at the start of a word, in any case; text in quotes and after
+// REM is left alone.
+func ExpandAbbreviations(line string) string {
+	var b strings.Builder
+	inString := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '"' {
+			inString = !inString
+		}
+		startsWord := i == 0 || !isWordByte(line[i-1])
+		if inString || !startsWord || !isLetterByte(c) {
+			b.WriteByte(c)
+			continue
+		}
+
+		end := i
+		for end < len(line) && isLetterByte(line[end]) {
+			end++
+		}
+		word := strings.ToUpper(line[i:end])
+		if word == "REM" {
+			b.WriteString(line[i:])
+			break
+		}
+		full, ok := abbreviations[word+"."]
+		if !ok || end >= len(line) || line[end] != '.' {
+			b.WriteString(line[i:end])
+			i = end - 1
+			continue
+		}
+		b.WriteString(full)
+		if end+1 < len(line) && line[end+1] != ' ' {
+			b.WriteByte(' ')
+		}
+		i = end
+	}
+	return b.String()
+}
+
+func isLetterByte(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isWordByte(c byte) bool {
+	return isLetterByte(c) || ('0' <= c && c <= '9') || c == '$' || c == '_' || c == '.'
+}
+
+// Names returns every keyword and built-in function name, sorted.
+func Names() []string {
+	names := make([]string, 0, len(keywords)+len(intrinsic.Functions))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	for _, fn := range intrinsic.Functions {
+		if _, ok := keywords[fn.Name]; !ok {
+			names = append(names, fn.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Suggest returns the keyword nearest to word, in any case, for a "did you
+// mean" hint: one a typing slip or two away, as PRINT is from PRNT or
+// GOSUB from GOSUBB. It returns "" for a word too short to guess from or
+// too far from every keyword.
+func Suggest(word string) string {
+	if keywords[strings.ToUpper(word)] != "" {
+		return ""
+	}
+	names := make([]string, 0, len(keywords))
+	for name := range keywords {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return Nearest(word, names)
+}
+
+// Nearest is Suggest for other names, given in upper case, such as the
+// REPL's commands. Of names equally near, it returns the first.
+func Nearest(word string, names []string) string {
+	word = strings.ToUpper(word)
+	if len(word) < 3 {
+		return ""
+	}
+	limit := 1
+	if len(word) > 4 {
+		limit = 2
+	}
+
+	best, bestDistance := "", limit+1
+	for _, name := range names {
+		if d := editDistance(word, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+// editDistance counts the letters that must be inserted, deleted, changed
+// or swapped with their neighbour to turn a into b.
+func editDistance(a, b string) int {
+	prev2 := make([]int, len(b)+1)
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(b)]
 }
 
 func LookupIdent(ident string) TokenType {
@@ -0,0 +1,209 @@
+package transpile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/basis-ex/ast"
+)
+
+// block writes the statement of one function.
+type block struct {
+	t      *translator
+	out    *strings.Builder
+	indent string
+	// left is set once a statement has returned the next one to run,
+	// after which the rest of the block would never run.
+	left bool
+}
+
+func (b *block) write(format string, args ...interface{}) {
+	fmt.Fprintf(b.out, "%s%s%s\n", b.indent, fmt.Sprintf(format, args...), b.terminator(format))
+}
+
+// terminator is the semicolon a statement of the language ends with, which
+// a line opening or closing a block does not take.
+func (b *block) terminator(format string) string {
+	if strings.HasSuffix(format, "{") || strings.HasSuffix(format, ":") || format == "}" {
+		return ""
+	}
+	return b.t.lang.semicolon
+}
+
+// leave writes returning the index of the next statement to run.
+func (b *block) leave(format string, args ...interface{}) {
+	b.write("return "+format, args...)
+	b.left = true
+}
+
+func (b *block) nested() *block {
+	return &block{t: b.t, out: b.out, indent: b.indent + "    "}
+}
+
+func (b *block) temp() string {
+	b.t.temps++
+	return fmt.Sprintf("t%d", b.t.temps)
+}
+
+// statement writes stmt, statement i of the program.
+func (b *block) statement(stmt ast.Statement, i int) {
+	t := b.t
+	switch s := stmt.(type) {
+	case *ast.PrintStatement:
+		for j, expr := range s.Expressions {
+			b.write("rt.write(rt.text(%s))", b.expression(expr))
+			if j < len(s.Separators) && s.Separators[j] == "\t" {
+				b.write("rt.zone()")
+			} else if j < len(s.Separators) && s.Separators[j] != "" {
+				b.write("rt.write(%s)", quote(s.Separators[j]))
+			}
+		}
+		if s.TrailingNewline {
+			b.write("rt.write(\"\\n\")")
+		}
+	case *ast.LetStatement:
+		if s.Index != nil {
+			b.write("rt.set_element(%s, %s, %s)", quote(s.Name.Value), b.expression(s.Index), b.expression(s.Value))
+		} else {
+			b.write("rt.set(%s, %s)", quote(s.Name.Value), b.expression(s.Value))
+		}
+	case *ast.IfStatement:
+		// The statements after THEN and ELSE are laid out after the IF,
+		// each in a function of its own: it carries on with those after
+		// THEN, or returns the first of those after ELSE.
+		b.write(t.lang.ifThen(t.lang.not + "rt.truthy(" + b.expression(s.Condition) + ")"))
+		b.nested().write("return %d", t.orElse[i])
+		if t.lang.end != "" {
+			b.write(t.lang.end)
+		}
+	case *ast.GotoStatement:
+		b.leave("%s", b.target(s.LineNumber, "GOTO"))
+	case *ast.GosubStatement:
+		// RETURN carries on after the statement given, the one before the
+		// next to run, which after the last statement following THEN is
+		// past the ELSE branch.
+		b.leave("rt.gosub(%d, %s)", t.next[i]-1, b.target(s.LineNumber, "GOSUB"))
+	case *ast.ReturnStatement:
+		b.leave("rt.ret()")
+	case *ast.ForStatement:
+		start := fmt.Sprintf("%srt.start_for(%s, %s, %s, %s, %d)", t.lang.not, quote(s.Variable.Value),
+			b.expression(s.Start), b.expression(s.Limit), b.expression(s.Step), t.next[i]-1)
+		b.write(t.lang.ifThen(start))
+		if next, ok := t.forNext[s]; ok {
+			// As in the interpreter, a loop that runs no times carries on
+			// after its NEXT.
+			b.nested().write("return %d", t.next[t.lineStart[next.Line]+next.Stmt])
+		} else {
+			b.nested().write("rt.fail(\"FOR without NEXT\")")
+		}
+		if t.lang.end != "" {
+			b.write(t.lang.end)
+		}
+	case *ast.NextStatement:
+		name := t.lang.null
+		if s.Variable != nil {
+			name = quote(s.Variable.Value)
+		}
+		tmp := b.temp()
+		b.write("%s%s = rt.next_loop(%s)", t.lang.local, tmp, name)
+		b.write(t.lang.ifThen(tmp + " >= 0"))
+		b.nested().write("return %s", tmp)
+		if t.lang.end != "" {
+			b.write(t.lang.end)
+		}
+	case *ast.InputStatement:
+		names := make([]string, len(s.Variables))
+		for j, ident := range s.Variables {
+			names[j] = quote(ident.Value)
+		}
+		b.write("rt.input(%s, [%s])", quote(s.PromptText()), strings.Join(names, ", "))
+	case *ast.EndStatement:
+		status := t.lang.null
+		if s.Status != nil {
+			status = b.expression(s.Status)
+		}
+		b.leave("rt.end(%s, %s)", status, quote(strings.ToUpper(s.Token.Literal)))
+	case *ast.DimStatement:
+		b.write("rt.dim(%s, %s)", quote(s.Name.Value), b.expression(s.Size))
+	case *ast.ReadStatement:
+		for _, target := range s.Variables {
+			switch v := target.(type) {
+			case *ast.Identifier:
+				b.write("rt.read(%s)", quote(v.Value))
+			case *ast.ArrayAccess:
+				b.write("rt.read_element(%s, %s)", quote(v.Name.Value), b.expression(v.Index))
+			}
+		}
+	case *ast.RestoreStatement:
+		if s.LineNumber == nil {
+			b.write("rt.restore(%s)", t.lang.null)
+		} else {
+			b.write("rt.restore(%s)", b.expression(s.LineNumber))
+		}
+	case *ast.PokeStatement:
+		b.write("rt.poke(%s, %s)", b.expression(s.Address), b.expression(s.Value))
+	case *ast.SleepStatement:
+		b.write("rt.sleep(%s)", b.expression(s.Seconds))
+	case *ast.ExpressionStatement:
+		b.write("%s", b.expression(s.Expression))
+	case *ast.RemStatement, *ast.LabelStatement, *ast.DataStatement:
+	default:
+		t.unsupported(stmt)
+	}
+}
+
+// target writes the index of the statement a GOTO or GOSUB lands on: a
+// constant for a line or label the program has, or the line worked out
+// and looked up when it runs.
+func (b *block) target(expr ast.Expression, keyword string) string {
+	t := b.t
+	switch node := expr.(type) {
+	case *ast.Identifier:
+		if line, ok := t.program.Labels[node.Value]; ok {
+			return fmt.Sprint(t.lineStart[t.lineIndex[line]])
+		}
+	case *ast.NumberLiteral:
+		if i, ok := t.lineIndex[int(node.Value)]; ok && float64(int(node.Value)) == node.Value {
+			return fmt.Sprint(t.lineStart[i])
+		}
+	}
+	return fmt.Sprintf("rt.jump(%s, %s)", b.expression(expr), quote(keyword))
+}
+
+// expression writes expr as an expression giving a value of the runtime:
+// a number or a string.
+func (b *block) expression(expr ast.Expression) string {
+	t := b.t
+	switch node := expr.(type) {
+	case *ast.NumberLiteral:
+		return t.lang.number(node.Value)
+	case *ast.StringLiteral:
+		return quote(node.Value)
+	case *ast.BooleanLiteral:
+		if node.Value {
+			return t.lang.number(t.dialect.True())
+		}
+		return t.lang.number(0)
+	case *ast.Identifier:
+		return fmt.Sprintf("rt.get(%s)", quote(node.Value))
+	case *ast.InfixExpression:
+		return fmt.Sprintf("rt.infix(%s, %s, %s)", quote(node.Operator), b.expression(node.Left), b.expression(node.Right))
+	case *ast.PrefixExpression:
+		return fmt.Sprintf("rt.prefix(%s, %s)", quote(node.Operator), b.expression(node.Right))
+	case *ast.ArrayAccess:
+		return fmt.Sprintf("rt.element(%s, %s)", quote(node.Name.Value), b.expression(node.Index))
+	case *ast.CallExpression:
+		if !builtins[node.Function] {
+			t.unsupported(node)
+			return t.lang.null
+		}
+		args := make([]string, len(node.Arguments))
+		for i, arg := range node.Arguments {
+			args[i] = b.expression(arg)
+		}
+		return fmt.Sprintf("rt.call(%s, [%s])", quote(node.Function), strings.Join(args, ", "))
+	default:
+		t.unsupported(expr)
+		return t.lang.null
+	}
+}
@@ -0,0 +1,633 @@
+// Translated from BASIC, to run with Node.js. The runtime below holds the
+// values, operators, built-in functions and larger statements; the program
+// follows it, each statement a function that returns the index of the next
+// one to run. Error messages match those of the interpreter and the
+// compiled Go.
+
+"use strict";
+
+const fs = require("fs");
+
+class BasicError extends Error {}
+
+const NUMBER = /^([+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?|[+-]?(inf|infinity|nan))$/i;
+const MEMORY_SIZE = 65536;
+const ADDR_RANDOM = 65520;
+const ADDR_SECOND = 65521;
+const ADDR_MINUTE = 65522;
+const ADDR_HOUR = 65523;
+const ADDR_JIFFIES = 65524;
+const ADDR_JIFFY_HI = 65525;
+const MAX_GOSUB_DEPTH = 1000;
+
+// formatNumber returns x as PRINT shows it, as Go's %g does.
+function formatNumber(x) {
+	if (Number.isNaN(x)) {
+		return "NaN";
+	}
+	if (!Number.isFinite(x)) {
+		return x > 0 ? "+Inf" : "-Inf";
+	}
+	if (x === 0) {
+		return Object.is(x, -0) ? "-0" : "0";
+	}
+	const sign = x < 0 ? "-" : "";
+	const [mantissa, exponent] = Math.abs(x).toExponential().split("e");
+	const digits = mantissa.replace(".", "");
+	const exp = Number(exponent);
+	if (exp < -4 || exp >= 6) {
+		return sign + mantissa + "e" + (exp < 0 ? "-" : "+") + String(Math.abs(exp)).padStart(2, "0");
+	}
+	if (exp < 0) {
+		return sign + "0." + "0".repeat(-exp - 1) + digits;
+	}
+	if (digits.length <= exp + 1) {
+		return sign + digits + "0".repeat(exp + 1 - digits.length);
+	}
+	return sign + digits.slice(0, exp + 1) + "." + digits.slice(exp + 1);
+}
+
+function isNumber(v) {
+	return typeof v === "number";
+}
+
+function text(v) {
+	return isNumber(v) ? formatNumber(v) : v;
+}
+
+// goRound rounds half away from zero, as Go's math.Round does.
+function goRound(x) {
+	if (!Number.isFinite(x)) {
+		return x;
+	}
+	let t = Math.trunc(x);
+	if (Math.abs(x - t) >= 0.5) {
+		t += Math.sign(x);
+	}
+	return t;
+}
+
+// goMin returns the smaller of x and y as Go's math.Min does: -Infinity
+// beats NaN, NaN beats any other number, and -0 is smaller than 0.
+function goMin(x, y) {
+	if (x === -Infinity || y === -Infinity) {
+		return -Infinity;
+	}
+	return Math.min(x, y);
+}
+
+// goMax returns the larger of x and y as Go's math.Max does: Infinity
+// beats NaN, NaN beats any other number, and 0 is larger than -0.
+function goMax(x, y) {
+	if (x === Infinity || y === Infinity) {
+		return Infinity;
+	}
+	return Math.max(x, y);
+}
+
+// positiveZero turns -0 into 0, as FIX and ROUND give it.
+function positiveZero(x) {
+	return x === 0 ? 0 : x;
+}
+
+function toInt16(v) {
+	const r = goRound(v);
+	if (!(r >= -32768 && r <= 32767)) {
+		throw new BasicError("Overflow");
+	}
+	return r;
+}
+
+function parseNumber(s) {
+	const lower = s.toLowerCase().replace(/^\+/, "");
+	if (lower === "inf" || lower === "infinity") {
+		return Infinity;
+	}
+	if (lower === "-inf" || lower === "-infinity") {
+		return -Infinity;
+	}
+	if (lower.endsWith("nan")) {
+		return NaN;
+	}
+	return Number(s);
+}
+
+class Runtime {
+	constructor(statementLines, lineIndex, data, dataOffsets, arities, dialect) {
+		this.arities = arities;
+		this.statementLines = statementLines;
+		this.lineIndex = new Map(Object.entries(lineIndex).map(([k, v]) => [Number(k), v]));
+		this.data = data;
+		this.dataOffsets = new Map(Object.entries(dataOffsets).map(([k, v]) => [Number(k), v]));
+		[this.true, this.bitwise, this.zoneWidth] = dialect;
+		this.column = 0;
+		this.vars = new Map();
+		this.arrays = new Map();
+		this.dims = new Map();
+		this.callStack = [];
+		this.forLoops = [];
+		this.dataPtr = 0;
+		this.halted = false;
+		this.exitStatus = 0;
+		this.memory = new Uint8Array(MEMORY_SIZE);
+		this.origin = Date.now();
+		this.pending = "";
+	}
+
+	fail(message) {
+		throw new BasicError(message);
+	}
+
+	write(s) {
+		fs.writeSync(1, s);
+		const i = s.lastIndexOf("\n");
+		this.column = i >= 0 ? [...s.slice(i + 1)].length : this.column + [...s].length;
+	}
+
+	zone() {
+		if (this.zoneWidth <= 0) {
+			this.write("\t");
+		} else {
+			this.write(" ".repeat(this.zoneWidth - this.column % this.zoneWidth));
+		}
+	}
+
+	text(v) {
+		return text(v);
+	}
+
+	get(name) {
+		return this.vars.has(name) ? this.vars.get(name) : 0;
+	}
+
+	set(name, v) {
+		this.vars.set(name, v);
+	}
+
+	boolean(b) {
+		return b ? this.true : 0;
+	}
+
+	truthy(v) {
+		return isNumber(v) ? v !== 0 : v !== "";
+	}
+
+	infix(op, a, b) {
+		if (isNumber(a) && isNumber(b)) {
+			switch (op) {
+				case "+":
+					return a + b;
+				case "-":
+					return a - b;
+				case "*":
+					return a * b;
+				case "/":
+					if (b === 0) {
+						throw new BasicError("division by zero");
+					}
+					return a / b;
+				case "MOD":
+					return a % b;
+				case "<":
+					return this.boolean(a < b);
+				case ">":
+					return this.boolean(a > b);
+				case "<=":
+					return this.boolean(a <= b);
+				case ">=":
+					return this.boolean(a >= b);
+				case "==":
+					return this.boolean(a === b);
+				case "<>":
+					return this.boolean(a !== b);
+				case "AND":
+				case "OR":
+				case "XOR":
+				case "EQV":
+				case "IMP":
+					return this.logical(op, a, b);
+			}
+		}
+		if (!isNumber(a) && !isNumber(b)) {
+			switch (op) {
+				case "+":
+					return a + b;
+				case "==":
+					return this.boolean(a === b);
+				case "<>":
+					return this.boolean(a !== b);
+			}
+		}
+		throw new BasicError(`unsupported operation: ${text(a)} ${op} ${text(b)}`);
+	}
+
+	logical(op, a, b) {
+		if (!this.bitwise) {
+			const x = a !== 0;
+			const y = b !== 0;
+			switch (op) {
+				case "AND":
+					return this.boolean(x && y);
+				case "OR":
+					return this.boolean(x || y);
+				case "XOR":
+					return this.boolean(x !== y);
+				case "EQV":
+					return this.boolean(x === y);
+			}
+			return this.boolean(!x || y);
+		}
+		const x = toInt16(a);
+		const y = toInt16(b);
+		switch (op) {
+			case "AND":
+				return x & y;
+			case "OR":
+				return x | y;
+			case "XOR":
+				return x ^ y;
+			case "EQV":
+				return ~(x ^ y);
+		}
+		return ~x | y;
+	}
+
+	prefix(op, v) {
+		if (op === "-") {
+			if (!isNumber(v)) {
+				throw new BasicError("cannot negate non-number");
+			}
+			return -v;
+		}
+		if (op === "NOT") {
+			if (isNumber(v) && this.bitwise) {
+				return ~toInt16(v);
+			}
+			return this.boolean(!this.truthy(v));
+		}
+		throw new BasicError("unknown operator: " + op);
+	}
+
+	number(v, message) {
+		if (!isNumber(v)) {
+			throw new BasicError(message);
+		}
+		return v;
+	}
+
+	dim(name, size) {
+		this.arrays.set(name, new Map());
+		this.dims.set(name, Math.trunc(this.number(size, "DIM size must be a number")));
+	}
+
+	arrayIndex(name, index) {
+		if (!this.arrays.has(name)) {
+			throw new BasicError(`array ${name} not defined`);
+		}
+		const idx = Math.trunc(this.number(index, "array index must be a number"));
+		const size = this.dims.get(name);
+		if (!(idx >= 0 && idx <= size)) {
+			throw new BasicError(`subscript ${idx} out of range for ${name}(${size})`);
+		}
+		return idx;
+	}
+
+	element(name, index) {
+		const arr = this.arrays.get(name);
+		const idx = this.arrayIndex(name, index);
+		return arr.has(idx) ? arr.get(idx) : 0;
+	}
+
+	set_element(name, index, v) {
+		const idx = this.arrayIndex(name, index);
+		this.arrays.get(name).set(idx, v);
+	}
+
+	jump(target, keyword) {
+		const line = Math.trunc(this.number(target, keyword + " requires a number"));
+		if (!this.lineIndex.has(line)) {
+			throw new BasicError(`line ${line} not found`);
+		}
+		return this.lineIndex.get(line);
+	}
+
+	gosub(pc, target) {
+		if (this.callStack.length >= MAX_GOSUB_DEPTH) {
+			throw new BasicError(`Out of memory in line ${this.statementLines[pc]}`);
+		}
+		this.callStack.push(pc);
+		return target;
+	}
+
+	ret() {
+		if (this.callStack.length === 0) {
+			throw new BasicError("RETURN without GOSUB");
+		}
+		return this.callStack.pop() + 1;
+	}
+
+	// start_for starts the loop of the FOR at pc, reporting whether it runs.
+	start_for(name, start, end, step, pc) {
+		start = this.number(start, "FOR start value must be a number");
+		end = this.number(end, "FOR end value must be a number");
+		step = this.number(step, "FOR step value must be a number");
+		this.set(name, start);
+		for (let i = this.forLoops.length - 1; i >= 0; i--) {
+			if (this.forLoops[i].name === name) {
+				this.forLoops.length = i;
+				break;
+			}
+		}
+		if (!this.continues(start, end, step)) {
+			return false;
+		}
+		this.forLoops.push({ name, end, step, pc });
+		return true;
+	}
+
+	continues(value, end, step) {
+		return step < 0 ? value >= end : value <= end;
+	}
+
+	// next_loop steps the loop NEXT closes, returning the statement to go
+	// back to, or -1 when it is over.
+	next_loop(name) {
+		let i = this.forLoops.length - 1;
+		if (name !== null) {
+			while (i >= 0 && this.forLoops[i].name !== name) {
+				i--;
+			}
+		}
+		if (i < 0) {
+			throw new BasicError("NEXT without FOR");
+		}
+		this.forLoops.length = i + 1;
+		const loop = this.forLoops[i];
+		const value = this.number(this.get(loop.name), "loop variable must be a number") + loop.step;
+		if (this.continues(value, loop.end, loop.step)) {
+			this.set(loop.name, value);
+			return loop.pc + 1;
+		}
+		this.forLoops.length = i;
+		return -1;
+	}
+
+	// readLine reads a line of standard input, without waiting for more.
+	readLine() {
+		const buf = Buffer.alloc(4096);
+		while (!this.pending.includes("\n")) {
+			let n;
+			try {
+				n = fs.readSync(0, buf, 0, buf.length, null);
+			} catch (err) {
+				if (err.code === "EAGAIN") {
+					continue;
+				}
+				if (err.code === "EOF") {
+					n = 0;
+				} else {
+					throw err;
+				}
+			}
+			if (n === 0) {
+				throw new BasicError("EOF");
+			}
+			this.pending += buf.toString("utf8", 0, n);
+		}
+		const end = this.pending.indexOf("\n") + 1;
+		const line = this.pending.slice(0, end);
+		this.pending = this.pending.slice(end);
+		return line;
+	}
+
+	input(prompt, names) {
+		for (;;) {
+			this.write(prompt);
+			const items = this.readLine().trim().split(",");
+			this.column = 0;
+			const values = [];
+			for (const [i, name] of names.entries()) {
+				const item = i < items.length ? items[i].trim() : "";
+				if (name.endsWith("$")) {
+					values.push(item);
+				} else if (item === "") {
+					values.push(0);
+				} else if (NUMBER.test(item)) {
+					values.push(parseNumber(item));
+				} else {
+					break;
+				}
+			}
+			if (values.length === names.length) {
+				names.forEach((name, i) => this.set(name, values[i]));
+				return;
+			}
+			this.write("?Redo from start\n");
+		}
+	}
+
+	end(status, keyword) {
+		if (status !== null) {
+			if (!isNumber(status) || !(status >= 0 && status <= 255) || status !== Math.trunc(status)) {
+				throw new BasicError(keyword + " status must be 0 to 255");
+			}
+			this.exitStatus = status;
+		}
+		this.halted = true;
+		return this.statementLines.length;
+	}
+
+	read(name) {
+		this.set(name, this.readItem(name));
+	}
+
+	read_element(name, index) {
+		this.set_element(name, index, this.readItem(name));
+	}
+
+	readItem(name) {
+		if (this.dataPtr >= this.data.length) {
+			throw new BasicError("Out of DATA");
+		}
+		const v = this.data[this.dataPtr];
+		if (typeof v === "string" && !name.endsWith("$")) {
+			throw new BasicError("Type mismatch in READ");
+		}
+		this.dataPtr++;
+		return v;
+	}
+
+	restore(line) {
+		if (line === null) {
+			this.dataPtr = 0;
+			return;
+		}
+		const n = Math.trunc(this.number(line, "RESTORE requires a number"));
+		if (!this.dataOffsets.has(n)) {
+			throw new BasicError(`line ${n} not found`);
+		}
+		this.dataPtr = this.dataOffsets.get(n);
+	}
+
+	sleep(seconds) {
+		if (!isNumber(seconds) || seconds < 0) {
+			throw new BasicError("SLEEP requires a number of seconds");
+		}
+		Atomics.wait(new Int32Array(new SharedArrayBuffer(4)), 0, 0, seconds * 1000);
+	}
+
+	peek(addr) {
+		if (addr < 0 || addr >= MEMORY_SIZE) {
+			throw new BasicError(`address ${addr} out of range 0-${MEMORY_SIZE - 1}`);
+		}
+		const now = new Date();
+		const jiffies = Math.floor((Date.now() - this.origin) * 60 / 1000);
+		switch (addr) {
+			case ADDR_RANDOM:
+				return Math.floor(Math.random() * 256);
+			case ADDR_SECOND:
+				return now.getSeconds();
+			case ADDR_MINUTE:
+				return now.getMinutes();
+			case ADDR_HOUR:
+				return now.getHours();
+			case ADDR_JIFFIES:
+				return jiffies & 0xff;
+			case ADDR_JIFFY_HI:
+				return (jiffies >> 8) & 0xff;
+		}
+		return this.memory[addr];
+	}
+
+	poke(addr, value) {
+		addr = Math.trunc(this.number(addr, "POKE address must be a number"));
+		value = Math.trunc(this.number(value, "POKE value must be a number"));
+		if (addr < 0 || addr >= MEMORY_SIZE) {
+			throw new BasicError(`POKE: address ${addr} out of range 0-${MEMORY_SIZE - 1}`);
+		}
+		if (value < 0 || value > 255) {
+			throw new BasicError(`POKE: value ${value} out of range 0-255`);
+		}
+		if (addr >= ADDR_RANDOM && addr <= ADDR_JIFFY_HI) {
+			return;
+		}
+		this.memory[addr] = value;
+	}
+
+	call(name, args) {
+		const [low, high] = this.arities[name];
+		if (args.length < low || args.length > high) {
+			if (low === high) {
+				throw new BasicError(`${name} expects ${low} argument(s), got ${args.length}`);
+			}
+			throw new BasicError(`${name} expects ${low} to ${high} arguments, got ${args.length}`);
+		}
+		try {
+			return BUILTINS[name](this, ...args);
+		} catch (err) {
+			if (err instanceof BasicError) {
+				throw new BasicError(`${name}: ${err.message}`);
+			}
+			throw err;
+		}
+	}
+}
+
+function stringFunction(f) {
+	return (rt, s) => {
+		if (isNumber(s)) {
+			throw new BasicError("expected string argument");
+		}
+		return f(s);
+	};
+}
+
+function numberFunction(f) {
+	return (rt, ...args) => {
+		for (const arg of args) {
+			if (!isNumber(arg)) {
+				throw new BasicError("expected number argument");
+			}
+		}
+		return f(...args);
+	};
+}
+
+function builtinEnviron(rt, arg) {
+	if (!isNumber(arg)) {
+		return process.env[arg] ?? "";
+	}
+	const env = Object.entries(process.env).map(([k, v]) => `${k}=${v}`);
+	const n = Math.trunc(arg);
+	return n >= 1 && n <= env.length ? env[n - 1] : "";
+}
+
+function builtinCommand(rt, ...args) {
+	const programArgs = process.argv.slice(2);
+	if (args.length === 0) {
+		return programArgs.join(" ");
+	}
+	if (!isNumber(args[0])) {
+		throw new BasicError("expected number argument");
+	}
+	const n = Math.trunc(args[0]);
+	return n >= 1 && n <= programArgs.length ? programArgs[n - 1] : "";
+}
+
+function builtinPeek(rt, addr) {
+	if (!isNumber(addr)) {
+		throw new BasicError("expected number argument");
+	}
+	return rt.peek(Math.trunc(addr));
+}
+
+function builtinTimer(rt) {
+	const now = new Date();
+	const midnight = new Date(now.getFullYear(), now.getMonth(), now.getDate());
+	return (now - midnight) / 1000;
+}
+
+function builtinRound(x, digits) {
+	if (digits === undefined) {
+		return positiveZero(goRound(x));
+	}
+	const scale = Math.pow(10, Math.trunc(digits));
+	return positiveZero(goRound(x * scale) / scale);
+}
+
+function builtinFix(x) {
+	return positiveZero(Math.trunc(x));
+}
+
+const BUILTINS = {
+	"UCASE$": stringFunction((s) => s.toUpperCase()),
+	"LCASE$": stringFunction((s) => s.toLowerCase()),
+	"LTRIM$": stringFunction((s) => s.replace(/^ +/, "")),
+	"RTRIM$": stringFunction((s) => s.replace(/ +$/, "")),
+	"TRIM$": stringFunction((s) => s.replace(/^ +| +$/g, "")),
+	"ENVIRON$": builtinEnviron,
+	"COMMAND$": builtinCommand,
+	"PEEK": builtinPeek,
+	"TIMER": builtinTimer,
+	"ROUND": numberFunction(builtinRound),
+	"FIX": numberFunction(builtinFix),
+	"MIN": numberFunction(goMin),
+	"MAX": numberFunction(goMax),
+};
+
+function main(statements, statementLines, lineIndex, data, dataOffsets, arities, dialect) {
+	const rt = new Runtime(statementLines, lineIndex, data, dataOffsets, arities, dialect);
+	let pc = 0;
+	try {
+		while (pc < statements.length && !rt.halted) {
+			pc = statements[pc](rt);
+		}
+	} catch (err) {
+		if (!(err instanceof BasicError)) {
+			throw err;
+		}
+		fs.writeSync(2, `error: ${err.message}\n`);
+		process.exit(1);
+	}
+	process.exit(rt.exitStatus);
+}
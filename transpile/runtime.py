@@ -0,0 +1,502 @@
+# Translated from BASIC. The runtime below holds the values, operators,
+# built-in functions and larger statements; the program follows it, each
+# statement a function that returns the index of the next one to run.
+# Error messages match those of the interpreter and the compiled Go.
+
+import math
+import os
+import random
+import re
+import sys
+import time
+from datetime import datetime
+from decimal import Decimal
+
+
+class BasicError(Exception):
+    pass
+
+
+NUMBER = re.compile(r"[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?|[+-]?(inf|infinity|nan)", re.IGNORECASE)
+MEMORY_SIZE = 65536
+ADDR_RANDOM, ADDR_SECOND, ADDR_MINUTE, ADDR_HOUR, ADDR_JIFFIES, ADDR_JIFFY_HI = range(65520, 65526)
+MAX_GOSUB_DEPTH = 1000
+
+
+def format_number(x):
+    """Returns x as PRINT shows it, as Go's %g does."""
+    if math.isnan(x):
+        return "NaN"
+    if math.isinf(x):
+        return "+Inf" if x > 0 else "-Inf"
+    if x == 0:
+        return "-0" if math.copysign(1, x) < 0 else "0"
+    sign = "-" if x < 0 else ""
+    t = Decimal(repr(abs(x))).normalize().as_tuple()
+    digits = "".join(map(str, t.digits))
+    exp = len(digits) + t.exponent - 1
+    if exp < -4 or exp >= 6:
+        mantissa = digits[0] + ("." + digits[1:] if len(digits) > 1 else "")
+        return "%s%se%s%02d" % (sign, mantissa, "-" if exp < 0 else "+", abs(exp))
+    if exp < 0:
+        return sign + "0." + "0" * (-exp - 1) + digits
+    if len(digits) <= exp + 1:
+        return sign + digits + "0" * (exp + 1 - len(digits))
+    return sign + digits[:exp + 1] + "." + digits[exp + 1:]
+
+
+def is_number(v):
+    return not isinstance(v, str)
+
+
+def text(v):
+    return v if isinstance(v, str) else format_number(v)
+
+
+def go_trunc(x):
+    """Truncates toward zero as Go's math.Trunc does, keeping NaN, the
+    infinities and the sign of a zero."""
+    if math.isnan(x) or math.isinf(x):
+        return x
+    return math.copysign(float(math.trunc(x)), x)
+
+
+def go_round(x):
+    """Rounds half away from zero, as Go's math.Round does."""
+    t = go_trunc(x)
+    if abs(x - t) >= 0.5:
+        t += math.copysign(1, x)
+    return t
+
+
+def go_min(x, y):
+    """Returns the smaller of x and y as Go's math.Min does: -Inf beats
+    NaN, NaN beats any other number, and -0 is smaller than 0."""
+    if x == -math.inf or y == -math.inf:
+        return -math.inf
+    if math.isnan(x) or math.isnan(y):
+        return math.nan
+    if x == 0 and y == 0:
+        return x if math.copysign(1, x) < 0 else y
+    return x if x < y else y
+
+
+def go_max(x, y):
+    """Returns the larger of x and y as Go's math.Max does: +Inf beats
+    NaN, NaN beats any other number, and 0 is larger than -0."""
+    if x == math.inf or y == math.inf:
+        return math.inf
+    if math.isnan(x) or math.isnan(y):
+        return math.nan
+    if x == 0 and y == 0:
+        return y if math.copysign(1, x) < 0 else x
+    return x if x > y else y
+
+
+def positive_zero(x):
+    """Turns -0 into 0, as FIX and ROUND give it."""
+    return 0.0 if x == 0 else x
+
+
+def to_int16(v):
+    r = go_round(v)
+    # NaN fails the comparison too, and is an Overflow as in Go.
+    if not -32768 <= r <= 32767:
+        raise BasicError("Overflow")
+    return int(r)
+
+
+class Runtime:
+    def __init__(self, statement_lines, line_index, data, data_offsets, arities, dialect):
+        self.arities = arities
+        self.statement_lines = statement_lines
+        self.line_index = line_index
+        self.data = data
+        self.data_offsets = data_offsets
+        self.true, self.bitwise, self.zone_width = dialect
+        self.column = 0
+        self.vars = {}
+        self.arrays = {}
+        self.dims = {}
+        self.call_stack = []
+        self.for_loops = []
+        self.data_ptr = 0
+        self.halted = False
+        self.exit_status = 0
+        self.memory = bytearray(MEMORY_SIZE)
+        self.origin = time.time()
+
+    def fail(self, message):
+        raise BasicError(message)
+
+    def write(self, s):
+        sys.stdout.write(s)
+        i = s.rfind("\n")
+        self.column = len(s) - i - 1 if i >= 0 else self.column + len(s)
+
+    def zone(self):
+        if self.zone_width <= 0:
+            self.write("\t")
+        else:
+            self.write(" " * (self.zone_width - self.column % self.zone_width))
+
+    def text(self, v):
+        return text(v)
+
+    def get(self, name):
+        return self.vars.get(name, 0.0)
+
+    def set(self, name, v):
+        self.vars[name] = v
+
+    def boolean(self, b):
+        return self.true if b else 0.0
+
+    def truthy(self, v):
+        return v != "" if isinstance(v, str) else v != 0
+
+    def infix(self, op, a, b):
+        if is_number(a) and is_number(b):
+            if op == "+":
+                return a + b
+            if op == "-":
+                return a - b
+            if op == "*":
+                return a * b
+            if op == "/":
+                if b == 0:
+                    raise BasicError("division by zero")
+                return a / b
+            if op == "MOD":
+                try:
+                    return math.fmod(a, b)
+                except ValueError:
+                    return math.nan
+            if op == "<":
+                return self.boolean(a < b)
+            if op == ">":
+                return self.boolean(a > b)
+            if op == "<=":
+                return self.boolean(a <= b)
+            if op == ">=":
+                return self.boolean(a >= b)
+            if op == "==":
+                return self.boolean(a == b)
+            if op == "<>":
+                return self.boolean(a != b)
+            if op in ("AND", "OR", "XOR", "EQV", "IMP"):
+                return self.logical(op, a, b)
+        if isinstance(a, str) and isinstance(b, str):
+            if op == "+":
+                return a + b
+            if op == "==":
+                return self.boolean(a == b)
+            if op == "<>":
+                return self.boolean(a != b)
+        raise BasicError("unsupported operation: %s %s %s" % (text(a), op, text(b)))
+
+    def logical(self, op, a, b):
+        if not self.bitwise:
+            x, y = a != 0, b != 0
+            if op == "AND":
+                return self.boolean(x and y)
+            if op == "OR":
+                return self.boolean(x or y)
+            if op == "XOR":
+                return self.boolean(x != y)
+            if op == "EQV":
+                return self.boolean(x == y)
+            return self.boolean(not x or y)
+        x, y = to_int16(a), to_int16(b)
+        if op == "AND":
+            return float(x & y)
+        if op == "OR":
+            return float(x | y)
+        if op == "XOR":
+            return float(x ^ y)
+        if op == "EQV":
+            return float(~(x ^ y))
+        return float(~x | y)
+
+    def prefix(self, op, v):
+        if op == "-":
+            if not is_number(v):
+                raise BasicError("cannot negate non-number")
+            return -v
+        if op == "NOT":
+            if is_number(v) and self.bitwise:
+                return float(~to_int16(v))
+            return self.boolean(not self.truthy(v))
+        raise BasicError("unknown operator: " + op)
+
+    def number(self, v, message):
+        if not is_number(v):
+            raise BasicError(message)
+        return v
+
+    def dim(self, name, size):
+        self.arrays[name] = {}
+        self.dims[name] = int(self.number(size, "DIM size must be a number"))
+
+    def array_index(self, name, index):
+        if name not in self.arrays:
+            raise BasicError("array %s not defined" % name)
+        idx = int(self.number(index, "array index must be a number"))
+        size = self.dims[name]
+        if idx < 0 or idx > size:
+            raise BasicError("subscript %d out of range for %s(%d)" % (idx, name, size))
+        return idx
+
+    def element(self, name, index):
+        idx = self.array_index(name, index)
+        return self.arrays[name].get(idx, 0.0)
+
+    def set_element(self, name, index, v):
+        self.arrays[name][self.array_index(name, index)] = v
+
+    def jump(self, target, keyword):
+        line = int(self.number(target, keyword + " requires a number"))
+        if line not in self.line_index:
+            raise BasicError("line %d not found" % line)
+        return self.line_index[line]
+
+    def gosub(self, pc, target):
+        if len(self.call_stack) >= MAX_GOSUB_DEPTH:
+            raise BasicError("Out of memory in line %d" % self.statement_lines[pc])
+        self.call_stack.append(pc)
+        return target
+
+    def ret(self):
+        if not self.call_stack:
+            raise BasicError("RETURN without GOSUB")
+        return self.call_stack.pop() + 1
+
+    def start_for(self, name, start, end, step, pc):
+        """Starts the loop of the FOR at pc, reporting whether it runs."""
+        start = self.number(start, "FOR start value must be a number")
+        end = self.number(end, "FOR end value must be a number")
+        step = self.number(step, "FOR step value must be a number")
+        self.set(name, start)
+        for i in range(len(self.for_loops) - 1, -1, -1):
+            if self.for_loops[i][0] == name:
+                del self.for_loops[i:]
+                break
+        if not self.continues(start, end, step):
+            return False
+        self.for_loops.append((name, end, step, pc))
+        return True
+
+    def continues(self, value, end, step):
+        return value >= end if step < 0 else value <= end
+
+    def next_loop(self, name):
+        """Steps the loop NEXT closes, returning the statement to go back
+        to, or -1 when it is over."""
+        i = len(self.for_loops) - 1
+        if name is not None:
+            while i >= 0 and self.for_loops[i][0] != name:
+                i -= 1
+        if i < 0:
+            raise BasicError("NEXT without FOR")
+        del self.for_loops[i + 1:]
+        var, end, step, pc = self.for_loops[i]
+        value = self.number(self.get(var), "loop variable must be a number") + step
+        if self.continues(value, end, step):
+            self.set(var, value)
+            return pc + 1
+        del self.for_loops[i:]
+        return -1
+
+    def input(self, prompt, names):
+        while True:
+            self.write(prompt)
+            sys.stdout.flush()
+            line = sys.stdin.readline()
+            if not line.endswith("\n"):
+                raise BasicError("EOF")
+            self.column = 0
+            items = line.strip().split(",")
+            values = []
+            for i, name in enumerate(names):
+                item = items[i].strip() if i < len(items) else ""
+                if name.endswith("$"):
+                    values.append(item)
+                elif item == "":
+                    values.append(0.0)
+                elif NUMBER.fullmatch(item):
+                    values.append(float(item))
+                else:
+                    break
+            if len(values) == len(names):
+                for name, v in zip(names, values):
+                    self.set(name, v)
+                return
+            self.write("?Redo from start\n")
+
+    def end(self, status, keyword):
+        if status is not None:
+            if not is_number(status) or not 0 <= status <= 255 or status != go_trunc(status):
+                raise BasicError(keyword + " status must be 0 to 255")
+            self.exit_status = int(status)
+        self.halted = True
+        return len(self.statement_lines)
+
+    def read(self, name):
+        self.set(name, self.read_item(name))
+
+    def read_element(self, name, index):
+        self.set_element(name, index, self.read_item(name))
+
+    def read_item(self, name):
+        if self.data_ptr >= len(self.data):
+            raise BasicError("Out of DATA")
+        v = self.data[self.data_ptr]
+        if isinstance(v, str) and not name.endswith("$"):
+            raise BasicError("Type mismatch in READ")
+        self.data_ptr += 1
+        return v
+
+    def restore(self, line):
+        if line is None:
+            self.data_ptr = 0
+            return
+        n = int(self.number(line, "RESTORE requires a number"))
+        if n not in self.data_offsets:
+            raise BasicError("line %d not found" % n)
+        self.data_ptr = self.data_offsets[n]
+
+    def sleep(self, seconds):
+        if not is_number(seconds) or seconds < 0:
+            raise BasicError("SLEEP requires a number of seconds")
+        sys.stdout.flush()
+        time.sleep(seconds)
+
+    def peek(self, addr):
+        if addr < 0 or addr >= MEMORY_SIZE:
+            raise BasicError("address %d out of range 0-%d" % (addr, MEMORY_SIZE - 1))
+        now = datetime.now()
+        jiffies = int((time.time() - self.origin) * 60)
+        if addr == ADDR_RANDOM:
+            return random.randrange(256)
+        if addr == ADDR_SECOND:
+            return now.second
+        if addr == ADDR_MINUTE:
+            return now.minute
+        if addr == ADDR_HOUR:
+            return now.hour
+        if addr == ADDR_JIFFIES:
+            return jiffies & 0xFF
+        if addr == ADDR_JIFFY_HI:
+            return (jiffies >> 8) & 0xFF
+        return self.memory[addr]
+
+    def poke(self, addr, value):
+        addr = int(self.number(addr, "POKE address must be a number"))
+        value = int(self.number(value, "POKE value must be a number"))
+        if addr < 0 or addr >= MEMORY_SIZE:
+            raise BasicError("POKE: address %d out of range 0-%d" % (addr, MEMORY_SIZE - 1))
+        if value < 0 or value > 255:
+            raise BasicError("POKE: value %d out of range 0-255" % value)
+        if ADDR_RANDOM <= addr <= ADDR_JIFFY_HI:
+            return
+        self.memory[addr] = value
+
+    def call(self, name, args):
+        low, high = self.arities[name]
+        if not low <= len(args) <= high:
+            if low == high:
+                raise BasicError("%s expects %d argument(s), got %d" % (name, low, len(args)))
+            raise BasicError("%s expects %d to %d arguments, got %d" % (name, low, high, len(args)))
+        try:
+            return BUILTINS[name](self, *args)
+        except BasicError as err:
+            raise BasicError("%s: %s" % (name, err))
+
+
+def string_function(f):
+    def call(rt, s):
+        if is_number(s):
+            raise BasicError("expected string argument")
+        return f(s)
+    return call
+
+
+def number_function(f):
+    def call(rt, *args):
+        for arg in args:
+            if not is_number(arg):
+                raise BasicError("expected number argument")
+        return float(f(*args))
+    return call
+
+
+def builtin_environ(rt, arg):
+    if not is_number(arg):
+        return os.environ.get(arg, "")
+    env = ["%s=%s" % item for item in os.environ.items()]
+    n = int(arg)
+    return env[n - 1] if 1 <= n <= len(env) else ""
+
+
+def builtin_command(rt, *args):
+    program_args = sys.argv[1:]
+    if not args:
+        return " ".join(program_args)
+    if not is_number(args[0]):
+        raise BasicError("expected number argument")
+    n = int(args[0])
+    return program_args[n - 1] if 1 <= n <= len(program_args) else ""
+
+
+def builtin_peek(rt, addr):
+    if not is_number(addr):
+        raise BasicError("expected number argument")
+    return float(rt.peek(int(addr)))
+
+
+def builtin_timer(rt):
+    now = datetime.now()
+    midnight = now.replace(hour=0, minute=0, second=0, microsecond=0)
+    return (now - midnight).total_seconds()
+
+
+def builtin_round(x, digits=None):
+    if digits is None:
+        return positive_zero(go_round(x))
+    scale = math.pow(10, go_trunc(digits))
+    return positive_zero(go_round(x * scale) / scale)
+
+
+def builtin_fix(x):
+    return positive_zero(go_trunc(x))
+
+
+BUILTINS = {
+    "UCASE$": string_function(str.upper),
+    "LCASE$": string_function(str.lower),
+    "LTRIM$": string_function(lambda s: s.lstrip(" ")),
+    "RTRIM$": string_function(lambda s: s.rstrip(" ")),
+    "TRIM$": string_function(lambda s: s.strip(" ")),
+    "ENVIRON$": builtin_environ,
+    "COMMAND$": builtin_command,
+    "PEEK": builtin_peek,
+    "TIMER": builtin_timer,
+    "ROUND": number_function(builtin_round),
+    "FIX": number_function(builtin_fix),
+    "MIN": number_function(go_min),
+    "MAX": number_function(go_max),
+}
+
+
+def main(statements, statement_lines, line_index, data, data_offsets, arities, dialect):
+    rt = Runtime(statement_lines, line_index, data, data_offsets, arities, dialect)
+    pc = 0
+    try:
+        while pc < len(statements) and not rt.halted:
+            pc = statements[pc](rt)
+    except BasicError as err:
+        sys.stdout.flush()
+        sys.stderr.write("error: %s\n" % err)
+        sys.exit(1)
+    sys.stdout.flush()
+    sys.exit(rt.exit_status)
@@ -0,0 +1,324 @@
+// Package transpile translates a parsed BASIC program into Python or
+// JavaScript, for moving a program off BASIC rather than making it run
+// faster, which is what package compiler is for. The output is one file:
+// the target's runtime template, which holds the values, operators,
+// built-in functions and larger statements written once in that language,
+// followed by the program's own statements. As in the Go the compiler
+// writes, each statement is a case of its own, here a function returning
+// the next statement to run, so jumps, loops and their errors behave as
+// they do there.
+package transpile
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/compiler"
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/intrinsic"
+)
+
+// Targets lists the languages Translate writes, by name.
+var Targets = []string{"python", "javascript"}
+
+var (
+	//go:embed runtime.py
+	pythonRuntime string
+	//go:embed runtime.js
+	javascriptRuntime string
+)
+
+// language is what the translation needs to know of a target's syntax.
+type language struct {
+	runtime string
+	comment string
+	// function opens the function of statement i, and end closes a
+	// function or block, when the language needs it to.
+	function func(i int) string
+	end      string
+	// ifThen opens an IF with the condition cond.
+	ifThen func(cond string) string
+	// not negates a condition.
+	not string
+	// boolean writes false and true.
+	boolean [2]string
+	// semicolon ends a statement.
+	semicolon string
+	// local declares a local variable.
+	local string
+	// number and null write constants.
+	number func(v float64) string
+	null   string
+	// main runs the program, given its tables.
+	main string
+}
+
+var languages = map[string]*language{
+	"python": {
+		runtime:  pythonRuntime,
+		comment:  "#",
+		function: func(i int) string { return fmt.Sprintf("def s%d(rt):", i) },
+		ifThen:   func(cond string) string { return "if " + cond + ":" },
+		not:      "not ",
+		boolean:  [2]string{"False", "True"},
+		number: func(v float64) string {
+			switch {
+			case math.IsNaN(v):
+				return "math.nan"
+			case math.IsInf(v, 1):
+				return "math.inf"
+			case math.IsInf(v, -1):
+				return "-math.inf"
+			}
+			s := strconv.FormatFloat(v, 'g', -1, 64)
+			if !strings.ContainsAny(s, ".e") {
+				s += ".0"
+			}
+			return s
+		},
+		null: "None",
+		main: "if __name__ == \"__main__\":\n    main(STATEMENTS, STATEMENT_LINES, LINE_INDEX, DATA, DATA_OFFSETS, ARITIES, DIALECT)\n",
+	},
+	"javascript": {
+		runtime:   javascriptRuntime,
+		comment:   "//",
+		function:  func(i int) string { return fmt.Sprintf("function s%d(rt) {", i) },
+		end:       "}",
+		ifThen:    func(cond string) string { return "if (" + cond + ") {" },
+		not:       "!",
+		boolean:   [2]string{"false", "true"},
+		semicolon: ";",
+		local:     "const ",
+		number: func(v float64) string {
+			switch {
+			case math.IsNaN(v):
+				return "NaN"
+			case math.IsInf(v, 1):
+				return "Infinity"
+			case math.IsInf(v, -1):
+				return "-Infinity"
+			case v == 0 && math.Signbit(v):
+				return "-0"
+			}
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		},
+		null: "null",
+		main: "main(STATEMENTS, STATEMENT_LINES, LINE_INDEX, DATA, DATA_OFFSETS, ARITIES, DIALECT);\n",
+	},
+}
+
+// builtins are the functions the runtime templates implement: the
+// intrinsics less unsupportedBuiltins.
+var builtins = map[string]bool{
+	"UCASE$": true, "LCASE$": true, "LTRIM$": true, "RTRIM$": true, "TRIM$": true,
+	"ENVIRON$": true, "COMMAND$": true, "PEEK": true, "TIMER": true,
+	"ROUND": true, "FIX": true, "MIN": true, "MAX": true,
+}
+
+var unsupportedBuiltins = []string{"LOF", "INPUT$"}
+
+func init() {
+	names := make([]string, 0, len(builtins))
+	for name := range builtins {
+		names = append(names, name)
+	}
+	if err := intrinsic.Check("transpile", names, unsupportedBuiltins...); err != nil {
+		panic(err)
+	}
+}
+
+// Translate converts a parsed BASIC program into a program in the language
+// target, one of Targets. Statements the target cannot run, such as SUB
+// and the file statements, are listed in a *compiler.UnsupportedError.
+func Translate(program *ast.Program, target string, opts ...compiler.Options) (string, error) {
+	lang, ok := languages[target]
+	if !ok {
+		return "", fmt.Errorf("unknown target %q", target)
+	}
+	var opt compiler.Options
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+
+	lines := make([]int, 0, len(program.Statements))
+	for line := range program.Statements {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	t := &translator{
+		lang:      lang,
+		dialect:   opt.Dialect,
+		program:   program,
+		lineIndex: make(map[int]int, len(lines)),
+		lineStart: make([]int, len(lines)+1),
+		forNext:   ast.PairLoops(program, lines),
+	}
+	for i, line := range lines {
+		first := len(t.stmts)
+		t.lineIndex[line] = i
+		t.lineStart[i] = first
+		layout := ast.LayOut(program.Statements[line])
+		for n, stmt := range layout.Statements {
+			t.stmts = append(t.stmts, stmt)
+			t.stmtLines = append(t.stmtLines, line)
+			t.next = append(t.next, first+layout.Next[n])
+			t.orElse = append(t.orElse, first+layout.Else[n])
+		}
+	}
+	t.lineStart[len(lines)] = len(t.stmts)
+
+	var out strings.Builder
+	out.WriteString(lang.runtime)
+	for i, stmt := range t.stmts {
+		t.line = t.stmtLines[i]
+		out.WriteString("\n\n" + lang.function(i) + "\n")
+		if text := program.Source[t.line]; text != "" && t.lineStart[t.lineIndex[t.line]] == i {
+			// The line as written, so the two can be read side by side.
+			fmt.Fprintf(&out, "    %s %s\n", lang.comment, text)
+		}
+		b := &block{t: t, out: &out, indent: "    "}
+		b.statement(stmt, i)
+		if !b.left {
+			b.write("return %d", t.next[i])
+		}
+		if lang.end != "" {
+			out.WriteString(lang.end + "\n")
+		}
+	}
+	if len(t.problems) > 0 {
+		return "", &compiler.UnsupportedError{Problems: t.problems}
+	}
+
+	out.WriteString("\n\n")
+	t.tables(&out, lines)
+	out.WriteString("\n" + lang.main)
+	return out.String(), nil
+}
+
+// translator is the state of translating one program.
+type translator struct {
+	lang    *language
+	dialect dialect.Dialect
+	program *ast.Program
+	// stmts are the program's statements in the order the program counter
+	// counts them, as ast.LayOut lays out each line, with the line of each
+	// in stmtLines. next and orElse hold their Next and Else from the
+	// layout, as indices into stmts.
+	stmts     []ast.Statement
+	stmtLines []int
+	next      []int
+	orElse    []int
+	lineIndex map[int]int
+	lineStart []int
+	forNext   map[*ast.ForStatement]ast.LoopEnd
+	line      int
+	temps     int
+	problems  []compiler.Unsupported
+}
+
+// tables writes the program's statements, lines and DATA, the number of
+// arguments each built-in function takes and the dialect, which
+// the runtime template's main runs it with.
+func (t *translator) tables(out *strings.Builder, lines []int) {
+	var b strings.Builder
+	for i := range t.stmts {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "s%d", i)
+	}
+	t.constant(out, "STATEMENTS", "["+b.String()+"]")
+
+	b.Reset()
+	for i, line := range t.stmtLines {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d", line)
+	}
+	t.constant(out, "STATEMENT_LINES", "["+b.String()+"]")
+
+	b.Reset()
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d: %d", line, t.lineStart[i])
+	}
+	t.constant(out, "LINE_INDEX", "{"+b.String()+"}")
+
+	b.Reset()
+	for i, value := range ast.DataValues(t.program, lines) {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		switch v := value.(type) {
+		case *ast.NumberLiteral:
+			b.WriteString(t.lang.number(v.Value))
+		case *ast.StringLiteral:
+			b.WriteString(quote(v.Value))
+		default:
+			b.WriteString(quote(""))
+		}
+	}
+	t.constant(out, "DATA", "["+b.String()+"]")
+
+	b.Reset()
+	offsets := ast.DataOffsets(t.program, lines)
+	for i, line := range lines {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%d: %d", line, offsets[line])
+	}
+	t.constant(out, "DATA_OFFSETS", "{"+b.String()+"}")
+
+	b.Reset()
+	for _, fn := range intrinsic.Functions {
+		if !builtins[fn.Name] {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: [%d, %d]", quote(fn.Name), fn.Min, fn.Max)
+	}
+	t.constant(out, "ARITIES", "{"+b.String()+"}")
+
+	bitwise := t.lang.boolean[0]
+	if t.dialect.BitwiseLogic {
+		bitwise = t.lang.boolean[1]
+	}
+	t.constant(out, "DIALECT", fmt.Sprintf("[%s, %s, %d]", t.lang.number(t.dialect.True()), bitwise, t.dialect.ZoneWidth))
+}
+
+func (t *translator) constant(out *strings.Builder, name, value string) {
+	fmt.Fprintf(out, "%s%s = %s%s\n", t.lang.local, name, value, t.lang.semicolon)
+}
+
+// unsupported records a construct the target cannot run against the line
+// being translated.
+func (t *translator) unsupported(node ast.Node) {
+	construct := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	if lit := node.TokenLiteral(); lit != "" {
+		construct = fmt.Sprintf("%s (%s)", strings.ToUpper(lit), construct)
+	}
+	t.problems = append(t.problems, compiler.Unsupported{
+		Line:      t.line,
+		Source:    t.program.Source[t.line],
+		Construct: construct,
+	})
+}
+
+// quote writes s as a string constant, which JSON's syntax does for both
+// languages.
+func quote(s string) string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// lineChecksum computes the VERIFY checksum of one program line. The line is
+// first normalised so that spacing does not matter: outside string literals,
+// spaces and tabs are dropped; text inside quotes is kept exactly. Letter case
+// is kept too, since variable names are case-sensitive. The remaining bytes
+// are run through Fletcher-16, which (unlike a plain sum) also catches
+// transposed characters.
+func lineChecksum(line string) uint16 {
+	var sum1, sum2 uint16
+	inString := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '"' {
+			inString = !inString
+		}
+		if !inString {
+			if c == ' ' || c == '\t' || c == '\r' {
+				continue
+			}
+		}
+		sum1 = (sum1 + uint16(c)) % 255
+		sum2 = (sum2 + sum1) % 255
+	}
+	return sum2<<8 | sum1
+}
+
+// verifyProgram handles the REPL's VERIFY command, writing to w. With no
+// argument or a LIST-style range it prints each line's checksum; given a
+// file of expected "<line> <checksum>" pairs it reports only the lines that
+// differ.
+func verifyProgram(w io.Writer, lines map[int]string, arg string) error {
+	if len(lines) == 0 {
+		fmt.Fprintln(w, "No program")
+		return nil
+	}
+
+	start, end, hasRange, err := parseListArgs(arg)
+	if err != nil {
+		return compareChecksums(w, lines, arg)
+	}
+
+	lineNums := sortedLineNumbers(lines)
+	if hasRange {
+		lineNums = lineNums[sort.SearchInts(lineNums, start):]
+	}
+
+	out := bufio.NewWriter(w)
+	printed := false
+	for _, num := range lineNums {
+		if hasRange && end != -1 && num > end {
+			break
+		}
+		fmt.Fprintf(out, "%d %04X\n", num, lineChecksum(lines[num]))
+		printed = true
+	}
+	if err := out.Flush(); err != nil {
+		return err
+	}
+
+	if hasRange && !printed {
+		fmt.Fprintln(w, "No matching lines")
+	}
+	return nil
+}
+
+// compareChecksums checks lines against the checksums in filename, writing
+// a line to w for each that differs, is missing or is not in the file.
+func compareChecksums(w io.Writer, lines map[int]string, filename string) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	expected := make(map[int]uint16)
+	for i, text := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected <line> <checksum>", filename, i+1)
+		}
+		num, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid line number %q", filename, i+1, fields[0])
+		}
+		sum, err := strconv.ParseUint(fields[1], 16, 16)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid checksum %q", filename, i+1, fields[1])
+		}
+		expected[num] = uint16(sum)
+	}
+
+	bad := 0
+	for _, num := range sortedLineNumbers(lines) {
+		want, ok := expected[num]
+		if !ok {
+			fmt.Fprintf(w, "%d not in checksum list\n", num)
+			bad++
+			continue
+		}
+		if got := lineChecksum(lines[num]); got != want {
+			fmt.Fprintf(w, "%d checksum %04X, expected %04X\n", num, got, want)
+			bad++
+		}
+	}
+	missing := []int{}
+	for num := range expected {
+		if _, ok := lines[num]; !ok {
+			missing = append(missing, num)
+		}
+	}
+	sort.Ints(missing)
+	for _, num := range missing {
+		fmt.Fprintf(w, "%d missing\n", num)
+		bad++
+	}
+
+	if bad == 0 {
+		fmt.Fprintf(w, "All %d lines verified\n", len(lines))
+	}
+	return nil
+}
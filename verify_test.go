@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLineChecksum(t *testing.T) {
+	// abcde is Fletcher-16's usual check value.
+	if got := lineChecksum("abcde"); got != 0xC8F0 {
+		t.Errorf("checksum of abcde is %04X, want C8F0", got)
+	}
+	if got := lineChecksum(`10 PRINT "HI"`); got != 0xF6C5 {
+		t.Errorf(`checksum of 10 PRINT "HI" is %04X, want F6C5`, got)
+	}
+}
+
+func TestLineChecksumIgnoresSpacing(t *testing.T) {
+	want := lineChecksum(`10 PRINT "A B";X`)
+	for _, line := range []string{
+		`10PRINT"A B";X`,
+		"10\tPRINT  \"A B\" ; X",
+		"10 PRINT \"A B\";X\r",
+	} {
+		if got := lineChecksum(line); got != want {
+			t.Errorf("checksum of %q is %04X, want %04X", line, got, want)
+		}
+	}
+
+	for _, line := range []string{
+		`10 PRINT "A  B";X`, // spacing inside a string
+		`10 PRINT "AB";X`,
+		`10 PRINT "A B";x`, // case
+		`01 PRINT "A B";X`, // transposition
+	} {
+		if got := lineChecksum(line); got == want {
+			t.Errorf("checksum of %q is %04X, the same as the original's", line, got)
+		}
+	}
+}
+
+// checksumFile writes the checksums of lines to a file, as VERIFY prints
+// them, and returns its name.
+func checksumFile(t *testing.T, lines map[int]string) string {
+	t.Helper()
+	var list strings.Builder
+	if err := verifyProgram(&list, lines, ""); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "sums.txt")
+	if err := os.WriteFile(filename, []byte(list.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestVerifyAgainstFile(t *testing.T) {
+	published := map[int]string{
+		10: `10 PRINT "HI"`,
+		20: `20 LET X = 1`,
+		30: `30 END`,
+	}
+	sums := checksumFile(t, published)
+
+	tests := []struct {
+		name  string
+		lines map[int]string
+		want  string
+	}{
+		{
+			name:  "typed in with other spacing",
+			lines: map[int]string{10: `10 PRINT"HI"`, 20: `20 LET X=1`, 30: `30   END`},
+			want:  "All 3 lines verified\n",
+		},
+		{
+			name:  "a line mistyped",
+			lines: map[int]string{10: `10 PRINT "HO"`, 20: `20 LET X = 1`, 30: `30 END`},
+			want:  fmt.Sprintf("10 checksum %04X, expected F6C5\n", lineChecksum(`10 PRINT "HO"`)),
+		},
+		{
+			name:  "a line left out and one added",
+			lines: map[int]string{10: `10 PRINT "HI"`, 25: `25 STOP`, 30: `30 END`},
+			want:  "25 not in checksum list\n20 missing\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := verifyProgram(&out, tt.lines, sums); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("printed %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyBadFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "sums.txt")
+	if err := os.WriteFile(filename, []byte("10 F6C5\n20 XYZ\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err := verifyProgram(new(strings.Builder), map[int]string{10: `10 PRINT "HI"`}, filename)
+	if err == nil || !strings.Contains(err.Error(), `:2: invalid checksum "XYZ"`) {
+		t.Errorf("error %v, want one about line 2", err)
+	}
+}
@@ -0,0 +1,45 @@
+package vm
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+// benchmarkRun compiles src once and times running the bytecode, each run
+// on a new VM.
+func benchmarkRun(b *testing.B, src string) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		b.Fatalf("parse: %s", strings.Join(errs, "; "))
+	}
+	prog, err := Compile(program)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := New(prog, Options{Stdin: strings.NewReader(""), Stdout: io.Discard}).Run(context.Background())
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkForLoop(b *testing.B) {
+	benchmarkRun(b, "10 FOR I = 1 TO 10000\n20 NEXT I\n")
+}
+
+func BenchmarkArithmetic(b *testing.B) {
+	benchmarkRun(b, "10 LET S = 0\n20 FOR I = 1 TO 10000\n30 LET S = S + I * 2 - I / 4\n40 NEXT I\n50 PRINT S\n")
+}
+
+func BenchmarkNestedLoops(b *testing.B) {
+	benchmarkRun(b, "10 FOR I = 1 TO 100: FOR J = 1 TO 100\n20 LET A = I * J MOD 7\n30 NEXT J: NEXT I\n")
+}
@@ -0,0 +1,159 @@
+package vm
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/intrinsic"
+)
+
+// builtin is one of the intrinsic functions, as listed in package
+// intrinsic, with the machine's implementation.
+type builtin struct {
+	intrinsic.Function
+	fn func(m *Machine, args []evaluator.Value) (evaluator.Value, error)
+}
+
+// builtinFuncs implement the functions the machine provides: the
+// intrinsics less unsupportedBuiltins, which need the interpreter's memory
+// and files.
+var builtinFuncs = map[string]func(m *Machine, args []evaluator.Value) (evaluator.Value, error){
+	"UCASE$":   stringFunc(strings.ToUpper),
+	"LCASE$":   stringFunc(strings.ToLower),
+	"LTRIM$":   stringFunc(func(s string) string { return strings.TrimLeft(s, " ") }),
+	"RTRIM$":   stringFunc(func(s string) string { return strings.TrimRight(s, " ") }),
+	"TRIM$":    stringFunc(func(s string) string { return strings.Trim(s, " ") }),
+	"ENVIRON$": builtinEnviron,
+	"COMMAND$": builtinCommand,
+	"TIMER":    builtinTimer,
+	"ROUND":    numberFunc(round),
+	"FIX":      numberFunc(fix),
+	"MIN":      numberFunc(func(x ...float64) float64 { return math.Min(x[0], x[1]) }),
+	"MAX":      numberFunc(func(x ...float64) float64 { return math.Max(x[0], x[1]) }),
+}
+
+var unsupportedBuiltins = []string{"PEEK", "LOF", "INPUT$"}
+
+// builtins are the functions the machine provides, in the order of
+// intrinsic.Functions, and builtinIndex finds one's place by name.
+var (
+	builtins     []builtin
+	builtinIndex = map[string]int{}
+)
+
+func init() {
+	names := make([]string, 0, len(builtinFuncs))
+	for name := range builtinFuncs {
+		names = append(names, name)
+	}
+	if err := intrinsic.Check("vm", names, unsupportedBuiltins...); err != nil {
+		panic(err)
+	}
+	for _, info := range intrinsic.Functions {
+		if fn, ok := builtinFuncs[info.Name]; ok {
+			builtinIndex[info.Name] = len(builtins)
+			builtins = append(builtins, builtin{info, fn})
+		}
+	}
+}
+
+// call checks the arguments to fn, calls it and checks its result.
+func (m *Machine) call(fn builtin, args []evaluator.Value) (evaluator.Value, error) {
+	if err := fn.CheckArity(len(args)); err != nil {
+		return evaluator.Value{}, err
+	}
+	val, err := fn.fn(m, args)
+	if err != nil {
+		return evaluator.Value{}, fmt.Errorf("%s: %w", fn.Name, err)
+	}
+	if s, ok := val.AsString(); ok {
+		if err := m.checkStringLength(len(s)); err != nil {
+			return evaluator.Value{}, err
+		}
+	}
+	return val, nil
+}
+
+func stringFunc(f func(string) string) func(*Machine, []evaluator.Value) (evaluator.Value, error) {
+	return func(_ *Machine, args []evaluator.Value) (evaluator.Value, error) {
+		s, ok := args[0].AsString()
+		if !ok {
+			return evaluator.Value{}, errorf(evaluator.TypeMismatch, "expected string argument")
+		}
+		return evaluator.String(f(s)), nil
+	}
+}
+
+func numberFunc(f func(x ...float64) float64) func(*Machine, []evaluator.Value) (evaluator.Value, error) {
+	return func(_ *Machine, args []evaluator.Value) (evaluator.Value, error) {
+		var nums [2]float64
+		for i, arg := range args {
+			n, ok := arg.AsNumber()
+			if !ok {
+				return evaluator.Value{}, errorf(evaluator.TypeMismatch, "expected number argument")
+			}
+			nums[i] = n
+		}
+		return evaluator.Number(f(nums[:len(args)]...)), nil
+	}
+}
+
+func round(x ...float64) float64 {
+	if len(x) == 1 {
+		return positiveZero(math.Round(x[0]))
+	}
+	scale := math.Pow(10, math.Trunc(x[1]))
+	return positiveZero(math.Round(x[0]*scale) / scale)
+}
+
+// fix implements FIX, truncating toward zero.
+func fix(x ...float64) float64 {
+	return positiveZero(math.Trunc(x[0]))
+}
+
+// positiveZero turns the -0 that FIX and ROUND give for a small negative
+// number into 0, so that it prints without a sign.
+func positiveZero(x float64) float64 {
+	if x == 0 {
+		return 0
+	}
+	return x
+}
+
+func builtinEnviron(_ *Machine, args []evaluator.Value) (evaluator.Value, error) {
+	if name, ok := args[0].AsString(); ok {
+		return evaluator.String(os.Getenv(name)), nil
+	}
+	num, _ := args[0].AsNumber()
+	env := os.Environ()
+	n := int(num)
+	if n < 1 || n > len(env) {
+		return evaluator.String(""), nil
+	}
+	return evaluator.String(env[n-1]), nil
+}
+
+func builtinCommand(m *Machine, args []evaluator.Value) (evaluator.Value, error) {
+	if len(args) == 0 {
+		return evaluator.String(strings.Join(m.opts.Args, " ")), nil
+	}
+	num, ok := args[0].AsNumber()
+	if !ok {
+		return evaluator.Value{}, errorf(evaluator.TypeMismatch, "expected number argument")
+	}
+	n := int(num)
+	if n < 1 || n > len(m.opts.Args) {
+		return evaluator.String(""), nil
+	}
+	return evaluator.String(m.opts.Args[n-1]), nil
+}
+
+func builtinTimer(_ *Machine, _ []evaluator.Value) (evaluator.Value, error) {
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	return evaluator.Number(now.Sub(midnight).Seconds()), nil
+}
@@ -0,0 +1,521 @@
+// Package vm runs BASIC programs by compiling them to bytecode for a stack
+// machine, an alternative to the tree-walking evaluator for programs that
+// spend their time computing. It takes the same parsed program and gives
+// the same results, but looks variables up by slot rather than by name and
+// decides nothing at run time that can be decided once beforehand.
+//
+// The machine covers the core language: PRINT, LET, IF, GOTO, GOSUB,
+// FOR/NEXT, INPUT, DIM, DATA/READ/RESTORE, END and the built-in functions
+// that need no files or memory. Compile reports any other statement as an
+// *UnsupportedError, so a program either runs in full or not at all.
+package vm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/basis-ex/ast"
+	"github.com/basis-ex/evaluator"
+)
+
+// Program is a BASIC program compiled for a Machine. It is not changed by
+// running, so one Program can be run by several Machines.
+type Program struct {
+	code []instr
+	// lines holds the BASIC line number each instruction belongs to, and
+	// stmts the statement.
+	lines  []int
+	stmts  []ast.Statement
+	source map[int]string
+	// tree is the program the code was compiled from.
+	tree   *ast.Program
+	consts []evaluator.Value
+	// vars and arrays name the variable and array slots.
+	vars   []string
+	arrays []string
+	inputs []input
+	// lineStart maps each BASIC line number to its first instruction, for
+	// GOTO and GOSUB to a computed line.
+	lineStart   map[int]int
+	data        []evaluator.Value
+	dataOffsets map[int]int
+	// maxStack is the most values the program ever has on the stack.
+	maxStack int
+}
+
+// input is an INPUT statement with the slots of its variables.
+type input struct {
+	stmt  *ast.InputStatement
+	slots []int
+}
+
+// Unsupported describes one construct the machine cannot run.
+type Unsupported struct {
+	Line      int
+	Source    string
+	Construct string
+}
+
+// UnsupportedError lists every construct that stopped a program compiling,
+// so they can all be seen at once.
+type UnsupportedError struct {
+	Problems []Unsupported
+}
+
+func (e *UnsupportedError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d unsupported construct(s) in program:", len(e.Problems))
+	for _, p := range e.Problems {
+		fmt.Fprintf(&b, "\n  line %d: %s is not supported by the VM", p.Line, p.Construct)
+		if p.Source != "" {
+			fmt.Fprintf(&b, "\n    %s", p.Source)
+		}
+	}
+	return b.String()
+}
+
+// compiler holds the state of one Compile.
+type compiler struct {
+	program    *ast.Program
+	p          *Program
+	lines      []int
+	lineIndex  map[int]int
+	labelIndex map[string]int
+	forNext    map[*ast.ForStatement]ast.LoopEnd
+	varSlots   map[string]int
+	arraySlots map[string]int
+	constSlots map[evaluator.Value]int
+	// line is the BASIC line being compiled, and stmt the statement.
+	line int
+	stmt ast.Statement
+	// toLine lists instructions whose operand a is a line index, to be
+	// replaced by that line's first instruction once every line is laid
+	// out.
+	toLine []int
+	// toStmt lists instructions whose operand a numbers a statement,
+	// counting every line's statements in turn as ast.LayOut gives them, to
+	// be replaced by the instruction after that statement, which stmtEnds
+	// holds once it is compiled; firstStmt numbers the first statement of
+	// each line.
+	toStmt    []int
+	firstStmt []int
+	stmtEnds  []int
+	// depth is the number of values on the stack after the instructions
+	// emitted so far. Every statement leaves it as it found it.
+	depth    int
+	problems []Unsupported
+}
+
+// Compile translates program into bytecode.
+func Compile(program *ast.Program) (*Program, error) {
+	lines := make([]int, 0, len(program.Statements))
+	for line := range program.Statements {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+
+	c := &compiler{
+		program: program,
+		p: &Program{
+			source:      program.Source,
+			tree:        program,
+			lineStart:   make(map[int]int, len(lines)),
+			dataOffsets: ast.DataOffsets(program, lines),
+		},
+		lines:      lines,
+		lineIndex:  make(map[int]int, len(lines)),
+		labelIndex: make(map[string]int, len(program.Labels)),
+		forNext:    ast.PairLoops(program, lines),
+		varSlots:   map[string]int{},
+		arraySlots: map[string]int{},
+		constSlots: map[evaluator.Value]int{},
+	}
+	for i, line := range lines {
+		c.lineIndex[line] = i
+	}
+	for label, line := range program.Labels {
+		c.labelIndex[label] = c.lineIndex[line]
+	}
+	for _, value := range ast.DataValues(program, lines) {
+		switch lit := value.(type) {
+		case *ast.NumberLiteral:
+			c.p.data = append(c.p.data, evaluator.Number(lit.Value))
+		case *ast.StringLiteral:
+			c.p.data = append(c.p.data, evaluator.String(lit.Value))
+		}
+	}
+
+	c.firstStmt = make([]int, len(lines)+1)
+	for i, line := range lines {
+		c.firstStmt[i+1] = c.firstStmt[i] + len(ast.LayOut(program.Statements[line]).Statements)
+	}
+
+	starts := make([]int, len(lines)+1)
+	c.stmtEnds = make([]int, 0, c.firstStmt[len(lines)])
+	for i, line := range lines {
+		c.line = line
+		starts[i] = len(c.p.code)
+		c.p.lineStart[line] = starts[i]
+		for _, stmt := range ast.Flatten(program.Statements[line]) {
+			c.stmt = stmt
+			c.statement(i, stmt)
+		}
+	}
+	starts[len(lines)] = len(c.p.code)
+	c.emit(opEnd, 0, 0)
+
+	if len(c.problems) > 0 {
+		return nil, &UnsupportedError{Problems: c.problems}
+	}
+	for _, pc := range c.toLine {
+		c.p.code[pc].a = int32(starts[c.p.code[pc].a])
+	}
+	for _, pc := range c.toStmt {
+		c.p.code[pc].a = int32(c.stmtEnds[c.p.code[pc].a])
+	}
+	return c.p, nil
+}
+
+func (c *compiler) emit(op opcode, a, b int) int {
+	c.depth += stackEffect(op, a, b)
+	if c.depth > c.p.maxStack {
+		c.p.maxStack = c.depth
+	}
+	c.p.code = append(c.p.code, instr{op: op, a: int32(a), b: int32(b)})
+	c.p.lines = append(c.p.lines, c.line)
+	c.p.stmts = append(c.p.stmts, c.stmt)
+	return len(c.p.code) - 1
+}
+
+// stackEffect is how many values an instruction leaves on the stack, less
+// how many it takes off.
+func stackEffect(op opcode, a, b int) int {
+	switch op {
+	case opConst, opTrue, opFalse, opLoad, opBadCall, opRead:
+		return 1
+	case opAdd, opSub, opMul, opDiv, opMod, opLess, opGreater, opLessEqual, opGreaterEqual,
+		opEqual, opNotEqual, opAnd, opOr, opXor, opEqv, opImp:
+		effect := 0
+		if b&leftVar != 0 {
+			effect++
+		}
+		if b&(fromConst|fromVar) == fromStack {
+			effect--
+		}
+		return effect
+	case opBadOperator:
+		// It never finishes, but its operands are counted as taken.
+		if b == 1 {
+			return -1
+		}
+		return -2
+	case opCall:
+		return 1 - b
+	case opStoreElement:
+		return -2
+	case opStore, opPop, opPrint, opJumpFalse, opGotoLine, opGosubLine, opRestoreLine, opDim:
+		return -1
+	case opFor:
+		return -3
+	case opEnd:
+		return -a
+	}
+	return 0
+}
+
+// jumpToLine emits op with the first instruction of the line at index i as
+// its target.
+func (c *compiler) jumpToLine(op opcode, i int) int {
+	pc := c.emit(op, i, 0)
+	c.toLine = append(c.toLine, pc)
+	return pc
+}
+
+// numericName is 1 for a variable or array that holds numbers, with no $
+// on its name, and otherwise 0.
+func numericName(name string) int {
+	if strings.HasSuffix(name, "$") {
+		return 0
+	}
+	return 1
+}
+
+// jumpAfter emits op with the instruction after the statement at end as its
+// target: the next statement, or past the ELSE branch after the last
+// statement following THEN.
+func (c *compiler) jumpAfter(op opcode, end ast.LoopEnd) int {
+	pc := c.emit(op, c.firstStmt[end.Line]+end.Stmt, 0)
+	c.toStmt = append(c.toStmt, pc)
+	return pc
+}
+
+// unsupported records a construct the machine cannot run.
+func (c *compiler) unsupported(node ast.Node) {
+	construct := strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+	if lit := node.TokenLiteral(); lit != "" {
+		construct = fmt.Sprintf("%s (%s)", strings.ToUpper(lit), construct)
+	}
+	c.problems = append(c.problems, Unsupported{
+		Line:      c.line,
+		Source:    c.program.Source[c.line],
+		Construct: construct,
+	})
+}
+
+func (c *compiler) variable(name string) int {
+	slot, ok := c.varSlots[name]
+	if !ok {
+		slot = len(c.p.vars)
+		c.varSlots[name] = slot
+		c.p.vars = append(c.p.vars, name)
+	}
+	return slot
+}
+
+func (c *compiler) array(name string) int {
+	slot, ok := c.arraySlots[name]
+	if !ok {
+		slot = len(c.p.arrays)
+		c.arraySlots[name] = slot
+		c.p.arrays = append(c.p.arrays, name)
+	}
+	return slot
+}
+
+func (c *compiler) constant(val evaluator.Value) int {
+	slot, ok := c.constSlots[val]
+	if !ok {
+		slot = len(c.p.consts)
+		c.constSlots[val] = slot
+		c.p.consts = append(c.p.consts, val)
+	}
+	return slot
+}
+
+// statement compiles stmt, found on the line at index i. Each statement
+// but a ':' sequence records where its code ends, numbered as in the
+// line's layout.
+func (c *compiler) statement(i int, stmt ast.Statement) {
+	if _, ok := stmt.(*ast.SequenceStatement); !ok {
+		n := len(c.stmtEnds)
+		c.stmtEnds = append(c.stmtEnds, 0)
+		defer func() { c.stmtEnds[n] = len(c.p.code) }()
+	}
+	switch s := stmt.(type) {
+	case *ast.PrintStatement:
+		for n, expr := range s.Expressions {
+			c.expression(expr)
+			c.emit(opPrint, 0, 0)
+			if n < len(s.Separators) && s.Separators[n] == "\t" {
+				c.emit(opPrintZone, 0, 0)
+			} else if n < len(s.Separators) {
+				c.emit(opPrintText, c.constant(evaluator.String(s.Separators[n])), 0)
+			}
+		}
+		if len(s.Expressions) == 0 || s.TrailingNewline {
+			c.emit(opPrintLine, 0, 0)
+		}
+	case *ast.LetStatement:
+		if s.Index != nil {
+			c.expression(s.Index)
+			c.expression(s.Value)
+			c.emit(opStoreElement, c.array(s.Name.Value), 0)
+			return
+		}
+		c.expression(s.Value)
+		slot := c.variable(s.Name.Value)
+		// An operator at the top of the value stores its own result.
+		if last := &c.p.code[len(c.p.code)-1]; last.op >= opAdd && last.op <= opImp {
+			last.b |= toVar | int32(slot)<<4
+			c.depth--
+			return
+		}
+		c.emit(opStore, slot, 0)
+	case *ast.IfStatement:
+		c.expression(s.Condition)
+		skip := c.emit(opJumpFalse, 0, 0)
+		c.statement(i, s.Consequence)
+		if s.Alternative == nil {
+			c.p.code[skip].a = int32(len(c.p.code))
+			return
+		}
+		end := c.emit(opJump, 0, 0)
+		c.p.code[skip].a = int32(len(c.p.code))
+		c.statement(i, s.Alternative)
+		c.p.code[end].a = int32(len(c.p.code))
+	case *ast.GotoStatement:
+		c.jump(s.LineNumber, opJump, opGotoLine)
+	case *ast.GosubStatement:
+		// RETURN carries on with the instruction after the GOSUB, which is
+		// the rest of its branch when it follows THEN.
+		pc := c.jump(s.LineNumber, opGosub, opGosubLine)
+		c.p.code[pc].c = int32(pc + 1)
+	case *ast.ReturnStatement:
+		c.emit(opReturn, 0, 0)
+	case *ast.ForStatement:
+		c.expression(s.Start)
+		c.expression(s.Limit)
+		c.expression(s.Step)
+		next, ok := c.forNext[s]
+		var pc int
+		if ok {
+			pc = c.jumpAfter(opFor, next)
+		} else {
+			pc = c.emit(opFor, -1, 0)
+		}
+		c.p.code[pc].b = int32(c.variable(s.Variable.Value))
+		c.p.code[pc].c = int32(pc + 1)
+	case *ast.NextStatement:
+		slot := -1
+		if s.Variable != nil {
+			slot = c.variable(s.Variable.Value)
+		}
+		c.emit(opNext, slot, 0)
+	case *ast.InputStatement:
+		in := input{stmt: s}
+		for _, v := range s.Variables {
+			in.slots = append(in.slots, c.variable(v.Value))
+		}
+		c.emit(opInput, len(c.p.inputs), 0)
+		c.p.inputs = append(c.p.inputs, in)
+	case *ast.EndStatement:
+		if s.Status == nil {
+			c.emit(opEnd, 0, 0)
+			return
+		}
+		c.expression(s.Status)
+		c.emit(opEnd, 1, c.constant(evaluator.String(strings.ToUpper(s.Token.Literal))))
+	case *ast.DimStatement:
+		c.expression(s.Size)
+		c.emit(opDim, c.array(s.Name.Value), 0)
+	case *ast.ReadStatement:
+		for _, target := range s.Variables {
+			switch v := target.(type) {
+			case *ast.Identifier:
+				c.emit(opRead, numericName(v.Value), 0)
+				c.emit(opStore, c.variable(v.Value), 0)
+			case *ast.ArrayAccess:
+				c.expression(v.Index)
+				c.emit(opRead, numericName(v.Name.Value), 0)
+				c.emit(opStoreElement, c.array(v.Name.Value), 0)
+			}
+		}
+	case *ast.RestoreStatement:
+		if s.LineNumber == nil {
+			c.emit(opRestore, 0, 0)
+			return
+		}
+		if lit, ok := s.LineNumber.(*ast.NumberLiteral); ok {
+			if offset, ok := c.p.dataOffsets[int(lit.Value)]; ok {
+				c.emit(opRestore, offset, 0)
+				return
+			}
+		}
+		c.expression(s.LineNumber)
+		c.emit(opRestoreLine, 0, 0)
+	case *ast.ExpressionStatement:
+		c.expression(s.Expression)
+		c.emit(opPop, 0, 0)
+	case *ast.SequenceStatement:
+		for _, inner := range s.Statements {
+			c.statement(i, inner)
+		}
+	case *ast.RemStatement, *ast.LabelStatement, *ast.DataStatement:
+	default:
+		c.unsupported(stmt)
+	}
+}
+
+// jump compiles a GOTO or GOSUB to target: a direct jump when it names a
+// label or an existing line, otherwise one computed when it runs.
+func (c *compiler) jump(target ast.Expression, direct, computed opcode) int {
+	switch t := target.(type) {
+	case *ast.Identifier:
+		if i, ok := c.labelIndex[t.Value]; ok {
+			return c.jumpToLine(direct, i)
+		}
+	case *ast.NumberLiteral:
+		if i, ok := c.lineIndex[int(t.Value)]; ok {
+			return c.jumpToLine(direct, i)
+		}
+	}
+	c.expression(target)
+	return c.emit(computed, 0, 0)
+}
+
+func (c *compiler) expression(expr ast.Expression) {
+	switch node := expr.(type) {
+	case *ast.NumberLiteral:
+		c.emit(opConst, c.constant(evaluator.Number(node.Value)), 0)
+	case *ast.StringLiteral:
+		c.emit(opConst, c.constant(evaluator.String(node.Value)), 0)
+	case *ast.BooleanLiteral:
+		op := opFalse
+		if node.Value {
+			op = opTrue
+		}
+		c.emit(op, 0, 0)
+	case *ast.Identifier:
+		c.emit(opLoad, c.variable(node.Value), 0)
+	case *ast.InfixExpression:
+		op, ok := infixOps[node.Operator]
+		if !ok {
+			c.expression(node.Left)
+			c.expression(node.Right)
+			c.emit(opBadOperator, c.constant(evaluator.String(node.Operator)), 0)
+			return
+		}
+		// A variable on the left, and a constant or variable on the right,
+		// are read by the operator itself instead of being pushed first.
+		left, operands := 0, fromStack
+		if id, isVar := node.Left.(*ast.Identifier); isVar {
+			left, operands = c.variable(id.Value), leftVar
+		} else {
+			c.expression(node.Left)
+		}
+		right := 0
+		switch r := node.Right.(type) {
+		case *ast.NumberLiteral:
+			right, operands = c.constant(evaluator.Number(r.Value)), operands|fromConst
+		case *ast.StringLiteral:
+			right, operands = c.constant(evaluator.String(r.Value)), operands|fromConst
+		case *ast.Identifier:
+			right, operands = c.variable(r.Value), operands|fromVar
+		default:
+			c.expression(node.Right)
+		}
+		c.p.code[c.emit(op, left, operands)].c = int32(right)
+	case *ast.PrefixExpression:
+		c.expression(node.Right)
+		switch node.Operator {
+		case "-":
+			c.emit(opNeg, 0, 0)
+		case "NOT":
+			c.emit(opNot, 0, 0)
+		default:
+			c.emit(opBadOperator, c.constant(evaluator.String(node.Operator)), 1)
+		}
+	case *ast.ArrayAccess:
+		c.expression(node.Index)
+		c.emit(opArray, c.array(node.Name.Value), 0)
+	case *ast.CallExpression:
+		fn, ok := builtinIndex[node.Function]
+		if !ok {
+			c.unsupported(node)
+			return
+		}
+		// As in the evaluator, a call with the wrong number of arguments
+		// fails before any of them are worked out.
+		if builtins[fn].CheckArity(len(node.Arguments)) != nil {
+			c.emit(opBadCall, fn, len(node.Arguments))
+			return
+		}
+		for _, arg := range node.Arguments {
+			c.expression(arg)
+		}
+		c.emit(opCall, fn, len(node.Arguments))
+	default:
+		c.unsupported(expr)
+	}
+}
@@ -0,0 +1,95 @@
+package vm
+
+// opcode is a machine instruction. Operands are in instr's a, b and c; the
+// operators work on the value stack.
+type opcode uint8
+
+const (
+	opConst        opcode = iota // push consts[a]
+	opTrue                       // push the dialect's true value
+	opFalse                      // push 0
+	opLoad                       // push variable a
+	opStore                      // pop into variable a
+	opArray                      // pop an index and push that element of array a
+	opStoreElement               // pop a value and an index into that element of array a
+	opAdd                        // pop y, x; push x + y, each perhaps an operand instead
+	opSub                        // and so on for each binary operator
+	opMul
+	opDiv
+	opMod
+	opLess
+	opGreater
+	opLessEqual
+	opGreaterEqual
+	opEqual
+	opNotEqual
+	opAnd
+	opOr
+	opXor
+	opEqv
+	opImp
+	opNeg
+	opNot
+	opBadOperator // pop the operands of operator consts[a], prefix if b = 1, and fail
+	opCall        // call built-in a with the top b values as arguments
+	opBadCall     // fail, as built-in a cannot take b arguments
+	opPop         // discard the top value
+	opPrint       // pop and print a value
+	opPrintText   // print the string consts[a]
+	opPrintLine   // end the output line
+	opPrintZone   // move the output to the next print zone
+	opJump        // continue at a
+	opJumpFalse   // pop; continue at a if the value is false
+	opGotoLine    // pop a line number and continue there
+	opGosub       // GOSUB to a, returning to c
+	opGosubLine   // pop a line number and GOSUB there, returning to c
+	opReturn      // return from the innermost GOSUB
+	opFor         // pop step, end, start into loop variable b; body at c, or skip to a
+	opNext        // step the loop on variable a, or the innermost if a < 0
+	opInput       // run the INPUT statement inputs[a]
+	opRead        // push the next DATA value; with a = 1, fail if it is a string
+	opRestore     // point READ at DATA value a
+	opRestoreLine // pop a line number and point READ at its DATA
+	opDim         // pop a size and declare array a
+	opEnd         // stop; with a = 1, pop an exit status for the keyword consts[b]
+)
+
+// infixOps maps the binary operators to their instructions.
+var infixOps = map[string]opcode{
+	"+":   opAdd,
+	"-":   opSub,
+	"*":   opMul,
+	"/":   opDiv,
+	"MOD": opMod,
+	"<":   opLess,
+	">":   opGreater,
+	"<=":  opLessEqual,
+	">=":  opGreaterEqual,
+	"==":  opEqual,
+	"<>":  opNotEqual,
+	"AND": opAnd,
+	"OR":  opOr,
+	"XOR": opXor,
+	"EQV": opEqv,
+	"IMP": opImp,
+}
+
+// Where the operands of a binary operator come from, and where its result
+// goes, in operand b. The right-hand value is popped, or is constant or
+// variable c; with leftVar, the left-hand value is variable a rather than
+// the one below it; with toVar, the result is stored in variable b>>4
+// instead of pushed. Working in place saves the instructions that would push and
+// store the values.
+const (
+	fromStack = iota
+	fromConst
+	fromVar
+	leftVar = 4
+	toVar   = 8
+)
+
+// instr is one instruction with its operands.
+type instr struct {
+	op      opcode
+	a, b, c int32
+}
@@ -0,0 +1,171 @@
+package vm
+
+import (
+	"math"
+
+	"github.com/basis-ex/evaluator"
+)
+
+// operatorNames maps the operator instructions back to their operators,
+// for error messages.
+var operatorNames = map[opcode]string{}
+
+func init() {
+	for name, op := range infixOps {
+		operatorNames[op] = name
+	}
+}
+
+// binary applies an operator instruction to two values, as the evaluator
+// does: arithmetic, comparison and logic on numbers, and joining and
+// comparing for equality on strings.
+func (m *Machine) binary(op opcode, left, right evaluator.Value) (evaluator.Value, error) {
+	x, leftIsNum := left.AsNumber()
+	y, rightIsNum := right.AsNumber()
+	if leftIsNum && rightIsNum {
+		switch op {
+		case opAdd:
+			return evaluator.Number(x + y), nil
+		case opSub:
+			return evaluator.Number(x - y), nil
+		case opMul:
+			return evaluator.Number(x * y), nil
+		case opDiv:
+			if y == 0 {
+				return evaluator.Value{}, errorf(evaluator.DivisionByZero, "division by zero")
+			}
+			return evaluator.Number(x / y), nil
+		case opMod:
+			return evaluator.Number(mod(x, y)), nil
+		case opLess, opGreater, opLessEqual, opGreaterEqual, opEqual, opNotEqual:
+			return evaluator.Number(m.compare(op, x, y)), nil
+		default:
+			return m.logical(op, x, y)
+		}
+	}
+
+	s, leftIsStr := left.AsString()
+	t, rightIsStr := right.AsString()
+	if leftIsStr && rightIsStr {
+		switch op {
+		case opAdd:
+			if err := m.checkStringLength(len(s) + len(t)); err != nil {
+				return evaluator.Value{}, err
+			}
+			return evaluator.String(s + t), nil
+		case opEqual:
+			return m.boolValue(s == t), nil
+		case opNotEqual:
+			return m.boolValue(s != t), nil
+		}
+	}
+
+	return evaluator.Value{}, errorf(evaluator.TypeMismatch, "unsupported operation: %s %s %s", left.Type(), operatorNames[op], right.Type())
+}
+
+// mod is math.Mod, worked out with integer division when x and y are
+// whole numbers that fit exactly, which is far quicker.
+func mod(x, y float64) float64 {
+	const exact = 1 << 53
+	if x != math.Trunc(x) || y != math.Trunc(y) || y == 0 ||
+		math.Abs(x) >= exact || math.Abs(y) >= exact {
+		return math.Mod(x, y)
+	}
+	// The result takes the sign of x, even when it is zero.
+	return math.Copysign(float64(int64(x)%int64(y)), x)
+}
+
+// compare applies a comparison instruction to two numbers, giving the
+// dialect's true value or 0.
+func (m *Machine) compare(op opcode, x, y float64) float64 {
+	var result bool
+	switch op {
+	case opLess:
+		result = x < y
+	case opGreater:
+		result = x > y
+	case opLessEqual:
+		result = x <= y
+	case opGreaterEqual:
+		result = x >= y
+	case opEqual:
+		result = x == y
+	default:
+		result = x != y
+	}
+	if result {
+		return m.truth
+	}
+	return 0
+}
+
+// logical applies AND, OR, XOR, EQV or IMP: bit by bit on 16-bit integers
+// when the dialect says so, otherwise to truth values.
+func (m *Machine) logical(op opcode, a, b float64) (evaluator.Value, error) {
+	if !m.opts.Dialect.BitwiseLogic {
+		x, y := a != 0, b != 0
+		switch op {
+		case opAnd:
+			return m.boolValue(x && y), nil
+		case opOr:
+			return m.boolValue(x || y), nil
+		case opXor:
+			return m.boolValue(x != y), nil
+		case opEqv:
+			return m.boolValue(x == y), nil
+		default: // opImp
+			return m.boolValue(!x || y), nil
+		}
+	}
+
+	x, err := toInt16(a)
+	if err != nil {
+		return evaluator.Value{}, err
+	}
+	y, err := toInt16(b)
+	if err != nil {
+		return evaluator.Value{}, err
+	}
+	var r int16
+	switch op {
+	case opAnd:
+		r = x & y
+	case opOr:
+		r = x | y
+	case opXor:
+		r = x ^ y
+	case opEqv:
+		r = ^(x ^ y)
+	default: // opImp
+		r = ^x | y
+	}
+	return evaluator.Number(float64(r)), nil
+}
+
+// unary applies negation or NOT.
+func (m *Machine) unary(op opcode, val evaluator.Value) (evaluator.Value, error) {
+	num, isNum := val.AsNumber()
+	if op == opNeg {
+		if !isNum {
+			return evaluator.Value{}, errorf(evaluator.TypeMismatch, "cannot negate non-number")
+		}
+		return evaluator.Number(-num), nil
+	}
+	if isNum && m.opts.Dialect.BitwiseLogic {
+		n, err := toInt16(num)
+		if err != nil {
+			return evaluator.Value{}, err
+		}
+		return evaluator.Number(float64(^n)), nil
+	}
+	return m.boolValue(!truthy(val)), nil
+}
+
+// toInt16 rounds a number to the 16-bit integer the bitwise operators use.
+func toInt16(v float64) (int16, error) {
+	r := math.Round(v)
+	if !(r >= math.MinInt16 && r <= math.MaxInt16) {
+		return 0, errorf(evaluator.Overflow, "Overflow")
+	}
+	return int16(r), nil
+}
@@ -0,0 +1,650 @@
+package vm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/evaluator"
+)
+
+// Options configures a Machine. Zero limits mean no limit.
+type Options struct {
+	// Stdin is read by INPUT, and Stdout receives the program's output;
+	// nil means the process's own.
+	Stdin  io.Reader
+	Stdout io.Writer
+	// Script treats Stdin as a file of answers, as the evaluator's SetInput
+	// does: each is echoed after its prompt, and running out is an error.
+	Script bool
+	// Dialect selects semantics such as the value of true.
+	Dialect dialect.Dialect
+	// Args are the arguments COMMAND$ returns.
+	Args []string
+	// MaxGosubDepth, MaxStringLength and MaxArrayCells are the limits the
+	// evaluator's setters of the same names impose.
+	MaxGosubDepth   int
+	MaxStringLength int
+	MaxArrayCells   int
+	// Timeout stops the program with evaluator.ErrExecutionLimit once it
+	// has run this long.
+	Timeout time.Duration
+}
+
+// Machine runs one compiled Program.
+type Machine struct {
+	prog   *Program
+	opts   Options
+	in     *bufio.Reader
+	out    *bufio.Writer
+	truth  float64
+	vars   []evaluator.Value
+	arrays []array
+	gosubs []int // return addresses
+	loops  []loop
+	data   int // index of the next DATA value
+	status int
+	column int // where PRINT has left the output line
+
+	interrupted atomic.Bool
+	deadline    time.Time
+}
+
+// array is the state of one array: nil elements until it is DIMmed.
+type array struct {
+	size     int
+	elements map[int]evaluator.Value
+}
+
+// loop is an active FOR loop.
+type loop struct {
+	slot      int
+	end, step float64
+	body      int
+}
+
+// pollInterval is how many jumps run between checks for cancellation,
+// Interrupt and the timeout.
+const pollInterval = 1024
+
+var errOutOfMemory = errors.New("Out of memory")
+
+// New prepares prog to run with opts.
+func New(prog *Program, opts Options) *Machine {
+	m := &Machine{prog: prog, opts: opts, truth: opts.Dialect.True()}
+	stdin, stdout := opts.Stdin, opts.Stdout
+	if stdin == nil {
+		stdin = os.Stdin
+	}
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	m.in = bufio.NewReader(stdin)
+	m.out = bufio.NewWriter(stdout)
+	return m
+}
+
+// Interrupt stops the program soon after, with an *evaluator.BreakError.
+// It is safe to call from another goroutine, such as a signal handler.
+func (m *Machine) Interrupt() {
+	m.interrupted.Store(true)
+}
+
+// ExitStatus is the status the program gave to END n or SYSTEM n, or 0 if
+// it ended without one.
+func (m *Machine) ExitStatus() int {
+	return m.status
+}
+
+// Run runs the program from the start with no variables set. Errors are
+// reported as the evaluator reports them: an *evaluator.RuntimeError for a
+// BASIC error, an *evaluator.CancelError when ctx is cancelled, an
+// *evaluator.BreakError after Interrupt and evaluator.ErrExecutionLimit
+// past the timeout.
+func (m *Machine) Run(ctx context.Context) error {
+	p := m.prog
+	m.vars = make([]evaluator.Value, len(p.vars))
+	m.arrays = make([]array, len(p.arrays))
+	m.gosubs, m.loops, m.data, m.status = nil, nil, 0, 0
+	m.deadline = time.Now().Add(m.opts.Timeout)
+	defer m.out.Flush()
+
+	code, consts, vars := p.code, p.consts, m.vars
+	stack := make([]evaluator.Value, p.maxStack)
+	sp := 0
+	ticks := 0
+	pc := 0
+	for {
+		in := &code[pc]
+		pc++
+		switch in.op {
+		case opConst:
+			stack[sp] = consts[in.a]
+			sp++
+		case opTrue:
+			stack[sp] = evaluator.Number(m.truth)
+			sp++
+		case opFalse:
+			stack[sp] = evaluator.Number(0)
+			sp++
+		case opLoad:
+			stack[sp] = vars[in.a]
+			sp++
+		case opStore:
+			vars[in.a] = stack[sp-1]
+			sp = sp - 1
+		case opArray:
+			top := sp - 1
+			index, err := m.arrayIndex(int(in.a), stack[top])
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			val, ok := m.arrays[in.a].elements[index]
+			if !ok {
+				val = evaluator.Number(0)
+			}
+			stack[top] = val
+		case opStoreElement:
+			index, err := m.arrayIndex(int(in.a), stack[sp-2])
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			m.arrays[in.a].elements[index] = stack[sp-1]
+			sp = sp - 2
+		case opAdd, opSub, opMul, opDiv, opMod, opLess, opGreater, opLessEqual, opGreaterEqual,
+			opEqual, opNotEqual, opAnd, opOr, opXor, opEqv, opImp:
+			// The operands are read in place, as copying a Value costs more
+			// than the arithmetic.
+			var right *evaluator.Value
+			switch in.b & (fromConst | fromVar) {
+			case fromConst:
+				right = &consts[in.c]
+			case fromVar:
+				right = &vars[in.c]
+			default:
+				sp--
+				right = &stack[sp]
+			}
+			// The result goes where the left-hand value is, or on top.
+			var left *evaluator.Value
+			dest := sp - 1
+			if in.b&leftVar != 0 {
+				left, dest = &vars[in.a], sp
+				sp++
+			} else {
+				left = &stack[dest]
+			}
+			// Arithmetic and comparison on numbers are most of what a numeric
+			// program does, so they are done here rather than through binary.
+			if x, ok := left.AsNumber(); ok && in.op < opAnd {
+				if y, ok := right.AsNumber(); ok && (y != 0 || in.op != opDiv) {
+					switch in.op {
+					case opAdd:
+						x += y
+					case opSub:
+						x -= y
+					case opMul:
+						x *= y
+					case opDiv:
+						x /= y
+					case opMod:
+						x = mod(x, y)
+					default:
+						x = m.compare(in.op, x, y)
+					}
+					if in.b&toVar != 0 {
+						vars[in.b>>4] = evaluator.Number(x)
+						sp = dest
+					} else {
+						stack[dest] = evaluator.Number(x)
+					}
+					break
+				}
+			}
+			val, err := m.binary(in.op, *left, *right)
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			if in.b&toVar != 0 {
+				vars[in.b>>4] = val
+				sp = dest
+			} else {
+				stack[dest] = val
+			}
+		case opNeg, opNot:
+			top := sp - 1
+			val, err := m.unary(in.op, stack[top])
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			stack[top] = val
+		case opBadOperator:
+			op, _ := consts[in.a].AsString()
+			if in.b == 1 {
+				return m.fail(pc, fmt.Errorf("unknown operator: %s", op))
+			}
+			left, right := stack[sp-2], stack[sp-1]
+			return m.fail(pc, errorf(evaluator.TypeMismatch, "unsupported operation: %s %s %s", left.Type(), op, right.Type()))
+		case opCall:
+			base := sp - int(in.b)
+			val, err := m.call(builtins[in.a], stack[base:sp])
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			stack[base] = val
+			sp = base + 1
+		case opBadCall:
+			return m.fail(pc, builtins[in.a].CheckArity(int(in.b)))
+		case opPop:
+			sp = sp - 1
+		case opPrint:
+			m.print(stack[sp-1].Inspect())
+			sp = sp - 1
+		case opPrintText:
+			text, _ := consts[in.a].AsString()
+			m.print(text)
+		case opPrintLine:
+			m.print("\n")
+		case opPrintZone:
+			m.print(m.opts.Dialect.Zone(m.column))
+		case opJump:
+			pc = int(in.a)
+			goto poll
+		case opJumpFalse:
+			cond := stack[sp-1]
+			sp = sp - 1
+			if !truthy(cond) {
+				pc = int(in.a)
+			}
+		case opGotoLine:
+			target, err := m.lineTarget(stack[sp-1], "GOTO")
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			sp = sp - 1
+			pc = target
+			goto poll
+		case opGosub, opGosubLine:
+			target := int(in.a)
+			if in.op == opGosubLine {
+				var err error
+				if target, err = m.lineTarget(stack[sp-1], "GOSUB"); err != nil {
+					return m.fail(pc, err)
+				}
+				sp = sp - 1
+			}
+			if m.opts.MaxGosubDepth > 0 && len(m.gosubs) >= m.opts.MaxGosubDepth {
+				return m.fail(pc, errOutOfMemory)
+			}
+			m.gosubs = append(m.gosubs, int(in.c))
+			pc = target
+			goto poll
+		case opReturn:
+			if len(m.gosubs) == 0 {
+				return m.fail(pc, errorf(evaluator.ReturnWithoutGosub, "RETURN without GOSUB"))
+			}
+			pc = m.gosubs[len(m.gosubs)-1]
+			m.gosubs = m.gosubs[:len(m.gosubs)-1]
+			goto poll
+		case opFor:
+			top := sp - 3
+			next, err := m.startLoop(*in, stack[top], stack[top+1], stack[top+2])
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			sp = top
+			if next >= 0 {
+				pc = next
+			}
+		case opNext:
+			// The usual NEXT names the innermost loop, which is stepped here.
+			if n := len(m.loops) - 1; n >= 0 && m.loops[n].slot == int(in.a) {
+				l := &m.loops[n]
+				if num, ok := vars[l.slot].AsNumber(); ok {
+					num += l.step
+					if loopContinues(num, l.end, l.step) {
+						vars[l.slot] = evaluator.Number(num)
+						pc = l.body
+					} else {
+						m.loops = m.loops[:n]
+					}
+					goto poll
+				}
+			}
+			next, err := m.nextLoop(int(in.a))
+			if err != nil {
+				return m.fail(pc, err)
+			}
+			if next >= 0 {
+				pc = next
+			}
+			goto poll
+		case opInput:
+			if err := m.input(int(in.a)); err != nil {
+				return m.fail(pc, err)
+			}
+		case opRead:
+			if m.data >= len(p.data) {
+				return m.fail(pc, errorf(evaluator.OutOfData, "Out of DATA"))
+			}
+			val := p.data[m.data]
+			if _, ok := val.AsNumber(); !ok && in.a == 1 {
+				return m.fail(pc, errorf(evaluator.TypeMismatch, "Type mismatch in READ"))
+			}
+			m.data++
+			stack[sp] = val
+			sp++
+		case opRestore:
+			m.data = int(in.a)
+		case opRestoreLine:
+			num, ok := stack[sp-1].AsNumber()
+			if !ok {
+				return m.fail(pc, errorf(evaluator.TypeMismatch, "RESTORE requires a number"))
+			}
+			sp = sp - 1
+			offset, ok := p.dataOffsets[int(num)]
+			if !ok {
+				return m.fail(pc, errorf(evaluator.UndefinedLine, "line %d not found", int(num)))
+			}
+			m.data = offset
+		case opDim:
+			size, ok := stack[sp-1].AsNumber()
+			if !ok {
+				return m.fail(pc, errorf(evaluator.TypeMismatch, "DIM size must be a number"))
+			}
+			sp = sp - 1
+			if err := m.dim(int(in.a), int(size)); err != nil {
+				return m.fail(pc, err)
+			}
+		case opEnd:
+			if in.a == 1 {
+				num, ok := stack[sp-1].AsNumber()
+				if !ok || num < 0 || num > 255 || num != math.Trunc(num) {
+					keyword, _ := consts[in.b].AsString()
+					return m.fail(pc, fmt.Errorf("%s status must be 0 to 255", keyword))
+				}
+				m.status = int(num)
+			}
+			return nil
+		}
+
+		continue
+
+		// Every instruction that can go back to an earlier one comes here,
+		// so that no loop runs for long without a poll.
+	poll:
+		if ticks++; ticks%pollInterval == 0 {
+			if err := m.poll(ctx, pc); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// poll stops the program if ctx is cancelled, Interrupt was called or the
+// timeout has passed. pc is the instruction about to run.
+func (m *Machine) poll(ctx context.Context, pc int) error {
+	line := m.prog.lines[pc]
+	if err := ctx.Err(); err != nil {
+		return &evaluator.CancelError{Line: line, Err: err}
+	}
+	if m.interrupted.Swap(false) {
+		return &evaluator.BreakError{Line: line}
+	}
+	if m.opts.Timeout > 0 && time.Now().After(m.deadline) {
+		return fmt.Errorf("%w: ran longer than %v in line %d", evaluator.ErrExecutionLimit, m.opts.Timeout, line)
+	}
+	return nil
+}
+
+// fail reports err, raised by the instruction before pc, as an
+// *evaluator.RuntimeError.
+func (m *Machine) fail(pc int, err error) error {
+	line := m.prog.lines[pc-1]
+	gosubs := make([]int, 0, len(m.gosubs))
+	for i := len(m.gosubs) - 1; i >= 0; i-- {
+		gosubs = append(gosubs, m.prog.lines[m.gosubs[i]-1])
+	}
+	column, endColumn := m.prog.tree.Span(line, m.prog.stmts[pc-1])
+	return &evaluator.RuntimeError{
+		Code:      errorCode(err),
+		Line:      line,
+		Source:    m.prog.source[line],
+		Column:    column,
+		EndColumn: endColumn,
+		Gosubs:    gosubs,
+		Err:       err,
+	}
+}
+
+// lineTarget finds the first instruction of the line a computed GOTO or
+// GOSUB names.
+func (m *Machine) lineTarget(val evaluator.Value, keyword string) (int, error) {
+	num, ok := val.AsNumber()
+	if !ok {
+		return 0, errorf(evaluator.TypeMismatch, "%s requires a number", keyword)
+	}
+	pc, ok := m.prog.lineStart[int(num)]
+	if !ok {
+		return 0, errorf(evaluator.UndefinedLine, "line %d not found", int(num))
+	}
+	return pc, nil
+}
+
+// startLoop runs a FOR with the given start, end and step. It returns
+// where to continue if the loop runs no times, or -1 to carry on into the
+// body.
+func (m *Machine) startLoop(in instr, start, end, step evaluator.Value) (int, error) {
+	startNum, ok := start.AsNumber()
+	if !ok {
+		return 0, errorf(evaluator.TypeMismatch, "FOR start value must be a number")
+	}
+	endNum, ok := end.AsNumber()
+	if !ok {
+		return 0, errorf(evaluator.TypeMismatch, "FOR end value must be a number")
+	}
+	stepNum, ok := step.AsNumber()
+	if !ok {
+		return 0, errorf(evaluator.TypeMismatch, "FOR step value must be a number")
+	}
+
+	slot := int(in.b)
+	m.vars[slot] = start
+	// Re-entering a FOR on a variable that is already looping restarts it,
+	// discarding that loop and anything nested inside it.
+	if i := m.findLoop(slot); i >= 0 {
+		m.loops = m.loops[:i]
+	}
+
+	if !loopContinues(startNum, endNum, stepNum) {
+		if in.a < 0 {
+			return 0, errorf(evaluator.ForWithoutNext, "FOR without NEXT")
+		}
+		return int(in.a), nil
+	}
+	m.loops = append(m.loops, loop{slot: slot, end: endNum, step: stepNum, body: int(in.c)})
+	return -1, nil
+}
+
+// nextLoop steps the loop on the variable in slot, or the innermost loop
+// if slot is negative. It returns the start of the body if the loop goes
+// round again, or -1.
+func (m *Machine) nextLoop(slot int) (int, error) {
+	i := len(m.loops) - 1
+	if slot >= 0 {
+		i = m.findLoop(slot)
+	}
+	if i < 0 {
+		return 0, errorf(evaluator.NextWithoutFor, "NEXT without FOR")
+	}
+
+	// NEXT on an outer variable implicitly closes any loops nested inside it.
+	m.loops = m.loops[:i+1]
+	l := m.loops[i]
+	num, ok := m.vars[l.slot].AsNumber()
+	if !ok {
+		return 0, errorf(evaluator.TypeMismatch, "loop variable must be a number")
+	}
+	num += l.step
+	if loopContinues(num, l.end, l.step) {
+		m.vars[l.slot] = evaluator.Number(num)
+		return l.body, nil
+	}
+	m.loops = m.loops[:i]
+	return -1, nil
+}
+
+func (m *Machine) findLoop(slot int) int {
+	for i := len(m.loops) - 1; i >= 0; i-- {
+		if m.loops[i].slot == slot {
+			return i
+		}
+	}
+	return -1
+}
+
+// loopContinues reports whether a loop variable holding value is still
+// within bounds.
+func loopContinues(value, end, step float64) bool {
+	if step < 0 {
+		return value >= end
+	}
+	return value <= end
+}
+
+// input runs the INPUT statement inputs[i], asking again until the answer
+// fits the variables.
+// print writes text for PRINT, keeping track of the column it leaves the
+// output at.
+func (m *Machine) print(text string) {
+	m.out.WriteString(text)
+	m.column = dialect.Column(m.column, text)
+}
+
+func (m *Machine) input(i int) error {
+	stmt := m.prog.inputs[i].stmt
+	for {
+		m.out.WriteString(stmt.PromptText())
+		m.out.Flush()
+
+		text, err := m.in.ReadString('\n')
+		if m.opts.Script {
+			if err == io.EOF && text == "" {
+				return errorf(evaluator.InputPastEnd, "Out of INPUT answers")
+			}
+			fmt.Fprintln(m.out, strings.TrimRight(text, "\r\n"))
+			if err == io.EOF {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		// The answer ends the line.
+		m.column = 0
+
+		values, ok := evaluator.InputValues(text, stmt.Variables)
+		if !ok {
+			fmt.Fprintln(m.out, "?Redo from start")
+			continue
+		}
+		for n, slot := range m.prog.inputs[i].slots {
+			m.vars[slot] = values[n]
+		}
+		return nil
+	}
+}
+
+// dim declares array a with elements 0 to size.
+func (m *Machine) dim(a, size int) error {
+	if limit := m.opts.MaxArrayCells; limit > 0 {
+		cells := size + 1
+		for other, arr := range m.arrays {
+			if other != a && arr.elements != nil {
+				cells += arr.size + 1
+			}
+		}
+		if size < 0 || cells > limit {
+			return fmt.Errorf("%w: arrays would need more than %d cells", errOutOfMemory, limit)
+		}
+	}
+	m.arrays[a] = array{size: size, elements: make(map[int]evaluator.Value)}
+	return nil
+}
+
+// arrayIndex turns val into a subscript of array a, which runs from 0 to
+// its DIM size, failing as the evaluator does.
+func (m *Machine) arrayIndex(a int, val evaluator.Value) (int, error) {
+	arr, name := m.arrays[a], m.prog.arrays[a]
+	if arr.elements == nil {
+		return 0, errorf(evaluator.SubscriptOutOfRange, "array %s not defined", name)
+	}
+	num, ok := val.AsNumber()
+	if !ok {
+		return 0, errorf(evaluator.TypeMismatch, "array index must be a number")
+	}
+	index := int(num)
+	if index < 0 || index > arr.size {
+		return 0, errorf(evaluator.SubscriptOutOfRange, "subscript %d out of range for %s(%d)", index, name, arr.size)
+	}
+	return index, nil
+}
+
+// checkStringLength returns an Out of memory error for a string of n bytes
+// longer than the limit.
+func (m *Machine) checkStringLength(n int) error {
+	if limit := m.opts.MaxStringLength; limit > 0 && n > limit {
+		return fmt.Errorf("%w: string longer than %d characters", errOutOfMemory, limit)
+	}
+	return nil
+}
+
+func (m *Machine) boolValue(b bool) evaluator.Value {
+	if b {
+		return evaluator.Number(m.truth)
+	}
+	return evaluator.Number(0)
+}
+
+// truthy decides conditions: any non-zero number, or any non-empty
+// string, is true.
+func truthy(val evaluator.Value) bool {
+	if s, ok := val.AsString(); ok {
+		return s != ""
+	}
+	num, _ := val.AsNumber()
+	return num != 0
+}
+
+// vmError is an error raised with a BASIC error code.
+type vmError struct {
+	code evaluator.ErrorCode
+	msg  string
+}
+
+func (e *vmError) Error() string { return e.msg }
+
+func errorf(code evaluator.ErrorCode, format string, args ...any) error {
+	return &vmError{code: code, msg: fmt.Sprintf(format, args...)}
+}
+
+// errorCode finds the code for err, as the evaluator does.
+func errorCode(err error) evaluator.ErrorCode {
+	var coded *vmError
+	switch {
+	case errors.As(err, &coded):
+		return coded.code
+	case errors.Is(err, errOutOfMemory):
+		return evaluator.OutOfMemory
+	}
+	return evaluator.IllegalFunctionCall
+}
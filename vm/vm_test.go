@@ -0,0 +1,105 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/basis-ex/dialect"
+	"github.com/basis-ex/evaluator"
+	"github.com/basis-ex/lexer"
+	"github.com/basis-ex/parser"
+)
+
+// run compiles src to bytecode, runs it and returns what it printed.
+func run(t testing.TB, src string) (string, error) {
+	t.Helper()
+	return runDialect(t, src, dialect.Standard)
+}
+
+// runDialect is run for a program written in d.
+func runDialect(t testing.TB, src string, d dialect.Dialect) (string, error) {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if errs := p.Errors(); len(errs) > 0 {
+		t.Fatalf("parse %q: %s", src, strings.Join(errs, "; "))
+	}
+	prog, err := Compile(program)
+	if err != nil {
+		t.Fatalf("compile %q: %v", src, err)
+	}
+	var out strings.Builder
+	err = New(prog, Options{Dialect: d, Stdin: strings.NewReader(""), Stdout: &out}).Run(context.Background())
+	return out.String(), err
+}
+
+func TestForRunningNoTimesCarriesOnAfterNext(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			name: "rest of the NEXT's line",
+			src:  "10 FOR I = 5 TO 1: PRINT \"BODY\": NEXT I: PRINT \"AFTER\"\n20 PRINT \"L20\"\n",
+			want: "AFTER\nL20\n",
+		},
+		{
+			name: "NEXT on a later line",
+			src:  "10 FOR I = 5 TO 1\n20 PRINT \"BODY\"\n30 NEXT I: PRINT \"AFTER\"\n40 PRINT \"L40\"\n",
+			want: "AFTER\nL40\n",
+		},
+		{
+			name: "NEXT ends the program",
+			src:  "10 FOR I = 1 TO 0: PRINT \"BODY\": NEXT\n",
+			want: "",
+		},
+		{
+			name: "inner loop of one that runs",
+			src:  "10 FOR I = 1 TO 2: FOR J = 1 TO 0: PRINT \"BODY\": NEXT J: PRINT I: NEXT I\n",
+			want: "1\n2\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(t, tt.src)
+			if err != nil {
+				t.Fatalf("run: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("printed %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBitwiseOverflow(t *testing.T) {
+	// N is infinity less itself, not a number.
+	const nan = "10 LET A = 1000000000: FOR I = 1 TO 9: LET A = A * A: NEXT I: LET N = A - A\n"
+	tests := []struct {
+		name, src string
+	}{
+		{"past 16 bits", "20 PRINT 40000 AND 1\n"},
+		{"NaN operand", nan + "20 PRINT N AND 1\n"},
+		{"NaN under NOT", nan + "20 PRINT NOT N\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runDialect(t, tt.src, dialect.MSBasic)
+			var rt *evaluator.RuntimeError
+			if !errors.As(err, &rt) || rt.Code != evaluator.Overflow {
+				t.Errorf("error %v, want Overflow", err)
+			}
+		})
+	}
+}
+
+func TestFixAndRoundGiveNoNegativeZero(t *testing.T) {
+	got, err := run(t, "10 PRINT FIX(-0.5); ROUND(-0.4); ROUND(-0.04, 1); FIX(-1.5)\n")
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if want := "000-1\n"; got != want {
+		t.Errorf("printed %q, want %q", got, want)
+	}
+}
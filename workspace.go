@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/basis-ex/evaluator"
+)
+
+// workspace is one of the REPL's program slots. Each keeps its own lines
+// and the state left by its last run, so switching slots loses nothing.
+type workspace struct {
+	lines map[int]string
+	// stopped is the program broken off by Ctrl-C or the debugger, if any,
+	// and stoppedSource the program text it was run from.
+	stopped       *evaluator.Evaluator
+	stoppedSource string
+	// last is the program most recently run, for VARS.
+	last *evaluator.Evaluator
+	// session holds the variables left by RUN, which statements typed
+	// without a line number go on to use.
+	session *evaluator.Environment
+}
+
+func newWorkspace() *workspace {
+	return &workspace{
+		lines:   make(map[int]string),
+		session: evaluator.NewEnvironment(),
+	}
+}
+
+// workspacePrompt is the REPL prompt, which names the workspace unless it
+// is the first.
+func workspacePrompt(current int) string {
+	if current == 1 {
+		return promptText
+	}
+	return fmt.Sprintf("%d%s", current, promptText)
+}
+
+// workspaceCommand handles WORKSPACE. With no argument it names the
+// current workspace, WORKSPACE LIST shows them all, and WORKSPACE n
+// switches to workspace n, creating it empty the first time. It returns
+// the workspace to use from now on.
+func workspaceCommand(workspaces map[int]*workspace, current int, arg string) (int, error) {
+	switch {
+	case arg == "":
+		fmt.Printf("Workspace %d\n", current)
+		return current, nil
+	case strings.EqualFold(arg, "LIST"):
+		nums := make([]int, 0, len(workspaces))
+		for n := range workspaces {
+			nums = append(nums, n)
+		}
+		sort.Ints(nums)
+		for _, n := range nums {
+			marker := " "
+			if n == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %d  %s\n", marker, n, workspaces[n].describe())
+		}
+		return current, nil
+	}
+
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 1 {
+		return current, fmt.Errorf("usage: WORKSPACE [n | LIST]")
+	}
+	if _, ok := workspaces[n]; !ok {
+		workspaces[n] = newWorkspace()
+	}
+	fmt.Printf("Workspace %d\n", n)
+	return n, nil
+}
+
+// describe summarises a workspace for WORKSPACE LIST.
+func (ws *workspace) describe() string {
+	desc := fmt.Sprintf("%d line(s)", len(ws.lines))
+	if len(ws.lines) > 0 {
+		nums := sortedLineNumbers(ws.lines)
+		desc += fmt.Sprintf(", %d-%d", nums[0], nums[len(nums)-1])
+	}
+	if ws.stopped != nil {
+		if line, ok := ws.stopped.NextLine(); ok {
+			desc += fmt.Sprintf(", stopped at line %d", line)
+		}
+	}
+	return desc
+}